@@ -27,6 +27,37 @@ type Response struct {
 	CheckResults  []lib.CheckResult // check results for the message
 }
 
+// Degraded returns true if some checks of the message were skipped or interrupted by the check budget
+func (r Response) Degraded() bool {
+	for _, cr := range r.CheckResults {
+		if cr.Name == lib.CheckDegraded {
+			return true
+		}
+	}
+	return false
+}
+
+// Suspicious returns the veto result if spam verdict of the message was vetoed by similarity to ham samples,
+// or not confirmed by the remote instance of consensus check
+func (r Response) Suspicious() (lib.CheckResult, bool) {
+	for _, cr := range r.CheckResults {
+		if cr.Name == lib.CheckHamVeto || cr.Name == CheckConsensus && !cr.Spam {
+			return cr, true
+		}
+	}
+	return lib.CheckResult{}, false
+}
+
+// Category returns the result of openai category with warn or report action, if the message was classified so
+func (r Response) Category() (lib.CheckResult, bool) {
+	for _, cr := range r.CheckResults {
+		if cr.Name == lib.CheckOpenAICategory {
+			return cr, true
+		}
+	}
+	return lib.CheckResult{}, false
+}
+
 // SenderChat is the sender of the message, sent on behalf of a chat. The
 // channel itself for channel messages. The supergroup itself for messages
 // from anonymous group administrators. The linked channel for messages
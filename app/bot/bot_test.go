@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/umputun/tg-spam/lib"
 )
 
 func TestDisplayName(t *testing.T) {
@@ -50,3 +52,19 @@ func TestDisplayName(t *testing.T) {
 		})
 	}
 }
+
+func TestResponse_Degraded(t *testing.T) {
+	assert.False(t, Response{}.Degraded())
+	assert.False(t, Response{CheckResults: []lib.CheckResult{{Name: "cas", Details: "not found"}}}.Degraded())
+	assert.True(t, Response{CheckResults: []lib.CheckResult{{Name: "cas"},
+		{Name: lib.CheckDegraded, Details: "check budget 2s exceeded, cas interrupted"}}}.Degraded())
+}
+
+func TestResponse_Suspicious(t *testing.T) {
+	_, ok := Response{CheckResults: []lib.CheckResult{{Name: "similarity", Details: "0.10/0.50"}}}.Suspicious()
+	assert.False(t, ok)
+	cr, ok := Response{CheckResults: []lib.CheckResult{{Name: "similarity", Details: "0.75/0.50, vetoed"},
+		{Name: lib.CheckHamVeto, Details: "suspicious"}}}.Suspicious()
+	assert.True(t, ok)
+	assert.Equal(t, "suspicious", cr.Details)
+}
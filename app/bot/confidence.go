@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// checkConfidence is the confidence of spam verdicts of checks with no probability reported, in percents.
+// External lists of confirmed spammers are trusted more than heuristics of the detector.
+var checkConfidence = map[string]float64{
+	"cas":        90,
+	"lols":       90,
+	"denylist":   95,
+	"stopword":   80,
+	"similarity": 70,
+	"consensus":  90,
+}
+
+// defaultCheckConfidence is the confidence of spam verdicts of other checks, i.e. emoji, in percents
+const defaultCheckConfidence = 50
+
+// percentRe matches percents in details of checks, i.e. "probability of spam: 97.50%"
+var percentRe = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
+
+// Confidence returns the combined confidence of spam verdicts of the checks, in percents, 0 if no check found spam.
+// Classifier and openai report their probability and confidence in details, other checks have fixed confidence.
+// Checks are combined as independent evidence, 1 - (1-p1)*(1-p2)..., so cas with classifier at 95% makes 99.5%.
+func Confidence(checks []lib.CheckResult) float64 {
+	doubt := 1.0
+	found := false
+	for _, cr := range checks {
+		if !cr.Spam {
+			continue
+		}
+		p, ok := checkConfidence[cr.Name]
+		if !ok {
+			p = defaultCheckConfidence
+		}
+		if reported, ok := reportedConfidence(cr); ok {
+			p = reported
+		}
+		doubt *= 1 - min(p, 100)/100
+		found = true
+	}
+	if !found {
+		return 0
+	}
+	return (1 - doubt) * 100
+}
+
+// reportedConfidence returns probability of spam reported by the classifier, the first percents of details,
+// or confidence reported by openai, the last percents of details
+func reportedConfidence(cr lib.CheckResult) (float64, bool) {
+	matches := percentRe.FindAllStringSubmatch(cr.Details, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	var m []string
+	switch cr.Name {
+	case "classifier":
+		m = matches[0]
+	case "openai":
+		m = matches[len(matches)-1]
+	default:
+		return 0, false
+	}
+	res, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return res, true
+}
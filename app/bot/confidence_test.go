@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestConfidence(t *testing.T) {
+	tbl := []struct {
+		name   string
+		checks []lib.CheckResult
+		res    float64
+	}{
+		{"no checks", nil, 0},
+		{"no spam", []lib.CheckResult{{Name: "stopword", Spam: false, Details: "not found"},
+			{Name: "classifier", Spam: false, Details: "probability of ham: 99.00%"}}, 0},
+		{"cas and classifier", []lib.CheckResult{{Name: "cas", Spam: true, Details: "listed"},
+			{Name: "classifier", Spam: true, Details: "probability of spam: 96.00%"}}, 99.6},
+		{"boosted classifier", []lib.CheckResult{
+			{Name: "classifier", Spam: true, Details: "probability of spam: 80.00%, boosted by 10.00%"}}, 80},
+		{"openai confidence", []lib.CheckResult{
+			{Name: "openai", Spam: true, Details: "promo of 100% profit, confidence: 85%"}}, 85},
+		{"stopword and emoji", []lib.CheckResult{{Name: "stopword", Spam: true, Details: "earn"},
+			{Name: "emoji", Spam: true, Details: "5/2"}}, 90},
+		{"classifier without probability", []lib.CheckResult{{Name: "classifier", Spam: true, Details: "unknown"}}, 50},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.res, Confidence(tt.checks), 0.001)
+		})
+	}
+}
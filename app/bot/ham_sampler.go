@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// HamSamplerConfig is a configuration of ham sampler
+type HamSamplerConfig struct {
+	Rate    float64 // share of messages to record, above 0 and up to 1
+	MinLen  int     // min length of recorded message, in runes, after redaction
+	Max     int     // max number of recorded candidates, 0 - unlimited
+	KeepPII bool    // don't remove mentions, links, emails and phone numbers from recorded messages
+}
+
+// HamSampler records a random share of messages passed all checks as candidates of ham samples, so operators
+// can review them and grow a representative ham corpus. Authors of messages are not recorded, and mentions, links,
+// emails and phone numbers are removed from texts, unless KeepPII set. Duplicated candidates are not recorded.
+type HamSampler struct {
+	params  HamSamplerConfig
+	updater lib.SampleUpdater
+	random  func() float64
+
+	lock  sync.Mutex
+	count int                 // number of recorded candidates
+	known map[uint64]struct{} // hashes of recorded candidates
+}
+
+// piiRe matches mentions, links, emails and phone numbers removed from candidates
+var piiRe = regexp.MustCompile(`(?i)\S+@\S+\.\S+|@\w+|(https?://|www\.|t\.me/)\S+|\+?\d[\d\s\-()]{6,}\d`)
+
+// NewHamSampler makes ham sampler writing candidates with the updater. Candidates recorded before are read
+// with the updater, to be counted and not recorded again.
+func NewHamSampler(updater lib.SampleUpdater, params HamSamplerConfig) *HamSampler {
+	res := &HamSampler{params: params, updater: updater, random: rand.Float64, known: map[uint64]struct{}{}} //nolint:gosec // no need for crypto rand
+	rd, err := updater.Reader()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WARN] can't read ham candidates, %v", err)
+		}
+		return res
+	}
+	defer rd.Close()
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			res.known[candidateHash(line)] = struct{}{}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		log.Printf("[WARN] can't read ham candidates, %v", err)
+	}
+	res.count = len(res.known)
+	return res
+}
+
+// Sample records the message as a candidate of ham samples with probability of Rate, returns true if recorded.
+// Messages shorter than MinLen, known already, or over Max candidates are not recorded.
+func (h *HamSampler) Sample(msg string) bool {
+	if h.params.Rate <= 0 || h.random() >= h.params.Rate {
+		return false
+	}
+	if !h.params.KeepPII {
+		msg = piiRe.ReplaceAllString(msg, " ")
+	}
+	msg = strings.Join(strings.Fields(msg), " ") // one line, without extra spaces
+	if msg == "" || utf8.RuneCountInString(msg) < h.params.MinLen {
+		return false
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.params.Max > 0 && h.count >= h.params.Max {
+		return false
+	}
+	hash := candidateHash(msg)
+	if _, ok := h.known[hash]; ok {
+		return false
+	}
+	if err := h.updater.Append(msg); err != nil {
+		log.Printf("[WARN] can't record ham candidate, %v", err)
+		return false
+	}
+	h.known[hash] = struct{}{}
+	h.count++
+	if h.params.Max > 0 && h.count == h.params.Max {
+		log.Printf("[INFO] %d ham candidates recorded, the limit reached", h.count)
+	}
+	return true
+}
+
+// candidateHash returns hash of the candidate, case insensitive
+func candidateHash(msg string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.ToLower(msg)))
+	return h.Sum64()
+}
@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHamSampler_Sample(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ham-candidates.txt")
+	require.NoError(t, os.WriteFile(file, []byte("known message from the last run\n"), 0o600))
+	read := func() []string {
+		data, err := os.ReadFile(file) //nolint:gosec // test file
+		require.NoError(t, err)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	h := NewHamSampler(NewSampleUpdater(file), HamSamplerConfig{Rate: 0.5, MinLen: 10, Max: 4})
+	assert.Equal(t, 1, h.count)
+	rnd := 0.1
+	h.random = func() float64 { return rnd }
+
+	assert.True(t, h.Sample("hello @user, see https://example.com/page and mail me at user@example.com\nor call +1 (555) 123-4567"))
+	assert.False(t, h.Sample("Known  message FROM the last run"), "known candidate, case and spaces ignored")
+	assert.False(t, h.Sample("@user short"), "too short after redaction")
+	rnd = 0.5
+	assert.False(t, h.Sample("not sampled by the rate"))
+	rnd = 0.1
+	assert.True(t, h.Sample("another good message of the chat"))
+	assert.True(t, h.Sample("and the last one to fit the limit"))
+	assert.False(t, h.Sample("over the limit of candidates"))
+
+	assert.Equal(t, []string{"known message from the last run", "hello , see and mail me at or call",
+		"another good message of the chat", "and the last one to fit the limit"}, read())
+
+	t.Run("keep pii", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "ham-candidates.txt")
+		h := NewHamSampler(NewSampleUpdater(file), HamSamplerConfig{Rate: 1, KeepPII: true})
+		assert.Equal(t, 0, h.count, "no candidates file yet")
+		assert.True(t, h.Sample("ask @user at t.me/chat\n  please"))
+		data, err := os.ReadFile(file) //nolint:gosec // test file
+		require.NoError(t, err)
+		assert.Equal(t, "ask @user at t.me/chat please\n", string(data))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := NewHamSampler(NewSampleUpdater(filepath.Join(t.TempDir(), "ham-candidates.txt")), HamSamplerConfig{})
+		assert.False(t, h.Sample("a message which is not sampled"))
+	})
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// JargonStore keeps counts of tokens in ham messages
+type JargonStore interface {
+	Add(tokens map[string]int, messages int) error
+}
+
+// defaultJargonBatch is the number of counted messages written to the store at once, if not set
+const defaultJargonBatch = 100
+
+// JargonCounter counts tokens of ham messages of the group, to find group jargon, i.e. the name of the project
+// or local slang used in many messages. Such tokens add noise to the classifier and are suggested as excluded tokens.
+// Each token is counted once per message. Counts are kept in memory and written to the store in batches.
+type JargonCounter struct {
+	store JargonStore
+	batch int
+
+	lock     sync.Mutex
+	tokens   map[string]int // number of messages with the token, not written yet
+	messages int            // number of messages not written yet
+}
+
+// NewJargonCounter makes a counter writing counts to the store every batch messages, 100 if not set
+func NewJargonCounter(store JargonStore, batch int) *JargonCounter {
+	if batch <= 0 {
+		batch = defaultJargonBatch
+	}
+	return &JargonCounter{store: store, batch: batch, tokens: map[string]int{}}
+}
+
+// Count counts tokens of the ham message, counts are written to the store on each batch of messages
+func (j *JargonCounter) Count(msg string) {
+	tokens := jargonTokens(msg)
+	if len(tokens) == 0 {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, t := range tokens {
+		j.tokens[t]++
+	}
+	j.messages++
+	if j.messages >= j.batch {
+		j.flush()
+	}
+}
+
+// Flush writes counts not written yet to the store, called on shutdown
+func (j *JargonCounter) Flush() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.flush()
+}
+
+func (j *JargonCounter) flush() {
+	if j.messages == 0 {
+		return
+	}
+	if err := j.store.Add(j.tokens, j.messages); err != nil {
+		log.Printf("[WARN] failed to write jargon counts of %d messages, %v", j.messages, err)
+	}
+	j.tokens, j.messages = map[string]int{}, 0 // counts are dropped on failure, they are stats only
+}
+
+// jargonTokens returns unique tokens of the message, cleaned the same way the classifier does.
+// Only words of letters are counted, numbers, links and mentions are not jargon.
+func jargonTokens(msg string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, token := range strings.Fields(msg) {
+		token = strings.ToLower(strings.Trim(token, ".,!?-:;()#\"'«»"))
+		if utf8.RuneCountInString(token) < 3 || seen[token] || strings.IndexFunc(token, notLetter) >= 0 {
+			continue
+		}
+		seen[token] = true
+		res = append(res, token)
+	}
+	return res
+}
+
+func notLetter(r rune) bool {
+	return !unicode.IsLetter(r)
+}
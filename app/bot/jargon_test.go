@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type jargonStoreFn func(tokens map[string]int, messages int) error
+
+func (f jargonStoreFn) Add(tokens map[string]int, messages int) error { return f(tokens, messages) }
+
+func TestJargonCounter(t *testing.T) {
+	var calls []map[string]int
+	var messages []int
+	var fail error
+	store := jargonStoreFn(func(tokens map[string]int, n int) error {
+		calls, messages = append(calls, tokens), append(messages, n)
+		return fail
+	})
+
+	j := NewJargonCounter(store, 2)
+	j.Count("Hello, tgspam! hello again")
+	j.Count("1234 ok :)")
+	assert.Empty(t, calls, "no tokens in the second message, not counted")
+	j.Count("tgspam rocks, see t.me/x @user")
+	assert.Equal(t, []map[string]int{{"hello": 1, "tgspam": 2, "again": 1, "rocks": 1, "see": 1}}, calls)
+	assert.Equal(t, []int{2}, messages)
+
+	j.Count("«Привет» мир")
+	j.Flush()
+	j.Flush()
+	assert.Len(t, calls, 2, "nothing to flush second time")
+	assert.Equal(t, map[string]int{"привет": 1, "мир": 1}, calls[1])
+	assert.Equal(t, 1, messages[1])
+
+	fail = errors.New("db error")
+	j.Count("one more")
+	j.Flush()
+	assert.Len(t, calls, 3)
+	j.Flush()
+	assert.Len(t, calls, 3, "failed counts dropped")
+}
@@ -4,6 +4,7 @@
 package mocks
 
 import (
+	"context"
 	"github.com/umputun/tg-spam/lib"
 	"io"
 	"sync"
@@ -15,15 +16,30 @@ import (
 //
 //		// make and configure a mocked bot.Detector
 //		mockedDetector := &DetectorMock{
+//			AddApprovedUserFunc: func(user lib.ApprovedUser)  {
+//				panic("mock out the AddApprovedUser method")
+//			},
 //			AddApprovedUsersFunc: func(ids ...string)  {
 //				panic("mock out the AddApprovedUsers method")
 //			},
-//			ApprovedUsersFunc: func() []string {
+//			ApprovedUsersFunc: func() []lib.ApprovedUser {
 //				panic("mock out the ApprovedUsers method")
 //			},
 //			CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
 //				panic("mock out the Check method")
 //			},
+//			CheckContextFunc: func(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult) {
+//				panic("mock out the CheckContext method")
+//			},
+//			CheckLocalFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+//				panic("mock out the CheckLocal method")
+//			},
+//			CheckUserFunc: func(ctx context.Context, userID string) (bool, []lib.CheckResult) {
+//				panic("mock out the CheckUser method")
+//			},
+//			IsNewUserFunc: func(userID string) bool {
+//				panic("mock out the IsNewUser method")
+//			},
 //			LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (lib.LoadResult, error) {
 //				panic("mock out the LoadSamples method")
 //			},
@@ -33,11 +49,14 @@ import (
 //			RemoveApprovedUsersFunc: func(ids ...string)  {
 //				panic("mock out the RemoveApprovedUsers method")
 //			},
-//			UpdateHamFunc: func(msg string) error {
-//				panic("mock out the UpdateHam method")
+//			SetApprovedUserNameFunc: func(userID string, userName string)  {
+//				panic("mock out the SetApprovedUserName method")
 //			},
-//			UpdateSpamFunc: func(msg string) error {
-//				panic("mock out the UpdateSpam method")
+//			UpdateHamFromFunc: func(msg string, source string) error {
+//				panic("mock out the UpdateHamFrom method")
+//			},
+//			UpdateSpamFromFunc: func(msg string, source string) error {
+//				panic("mock out the UpdateSpamFrom method")
 //			},
 //		}
 //
@@ -46,15 +65,30 @@ import (
 //
 //	}
 type DetectorMock struct {
+	// AddApprovedUserFunc mocks the AddApprovedUser method.
+	AddApprovedUserFunc func(user lib.ApprovedUser)
+
 	// AddApprovedUsersFunc mocks the AddApprovedUsers method.
 	AddApprovedUsersFunc func(ids ...string)
 
 	// ApprovedUsersFunc mocks the ApprovedUsers method.
-	ApprovedUsersFunc func() []string
+	ApprovedUsersFunc func() []lib.ApprovedUser
 
 	// CheckFunc mocks the Check method.
 	CheckFunc func(msg string, userID string) (bool, []lib.CheckResult)
 
+	// CheckContextFunc mocks the CheckContext method.
+	CheckContextFunc func(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult)
+
+	// CheckLocalFunc mocks the CheckLocal method.
+	CheckLocalFunc func(msg string, userID string) (bool, []lib.CheckResult)
+
+	// CheckUserFunc mocks the CheckUser method.
+	CheckUserFunc func(ctx context.Context, userID string) (bool, []lib.CheckResult)
+
+	// IsNewUserFunc mocks the IsNewUser method.
+	IsNewUserFunc func(userID string) bool
+
 	// LoadSamplesFunc mocks the LoadSamples method.
 	LoadSamplesFunc func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (lib.LoadResult, error)
 
@@ -64,14 +98,22 @@ type DetectorMock struct {
 	// RemoveApprovedUsersFunc mocks the RemoveApprovedUsers method.
 	RemoveApprovedUsersFunc func(ids ...string)
 
-	// UpdateHamFunc mocks the UpdateHam method.
-	UpdateHamFunc func(msg string) error
+	// SetApprovedUserNameFunc mocks the SetApprovedUserName method.
+	SetApprovedUserNameFunc func(userID string, userName string)
+
+	// UpdateHamFromFunc mocks the UpdateHamFrom method.
+	UpdateHamFromFunc func(msg string, source string) error
 
-	// UpdateSpamFunc mocks the UpdateSpam method.
-	UpdateSpamFunc func(msg string) error
+	// UpdateSpamFromFunc mocks the UpdateSpamFrom method.
+	UpdateSpamFromFunc func(msg string, source string) error
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// AddApprovedUser holds details about calls to the AddApprovedUser method.
+		AddApprovedUser []struct {
+			// User is the user argument value.
+			User lib.ApprovedUser
+		}
 		// AddApprovedUsers holds details about calls to the AddApprovedUsers method.
 		AddApprovedUsers []struct {
 			// Ids is the ids argument value.
@@ -87,6 +129,34 @@ type DetectorMock struct {
 			// UserID is the userID argument value.
 			UserID string
 		}
+		// CheckContext holds details about calls to the CheckContext method.
+		CheckContext []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// Msg is the msg argument value.
+			Msg string
+			// UserID is the userID argument value.
+			UserID string
+		}
+		// CheckLocal holds details about calls to the CheckLocal method.
+		CheckLocal []struct {
+			// Msg is the msg argument value.
+			Msg string
+			// UserID is the userID argument value.
+			UserID string
+		}
+		// CheckUser holds details about calls to the CheckUser method.
+		CheckUser []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// UserID is the userID argument value.
+			UserID string
+		}
+		// IsNewUser holds details about calls to the IsNewUser method.
+		IsNewUser []struct {
+			// UserID is the userID argument value.
+			UserID string
+		}
 		// LoadSamples holds details about calls to the LoadSamples method.
 		LoadSamples []struct {
 			// ExclReader is the exclReader argument value.
@@ -106,25 +176,81 @@ type DetectorMock struct {
 			// Ids is the ids argument value.
 			Ids []string
 		}
-		// UpdateHam holds details about calls to the UpdateHam method.
-		UpdateHam []struct {
+		// SetApprovedUserName holds details about calls to the SetApprovedUserName method.
+		SetApprovedUserName []struct {
+			// UserID is the userID argument value.
+			UserID string
+			// UserName is the userName argument value.
+			UserName string
+		}
+		// UpdateHamFrom holds details about calls to the UpdateHamFrom method.
+		UpdateHamFrom []struct {
 			// Msg is the msg argument value.
 			Msg string
+			// Source is the source argument value.
+			Source string
 		}
-		// UpdateSpam holds details about calls to the UpdateSpam method.
-		UpdateSpam []struct {
+		// UpdateSpamFrom holds details about calls to the UpdateSpamFrom method.
+		UpdateSpamFrom []struct {
 			// Msg is the msg argument value.
 			Msg string
+			// Source is the source argument value.
+			Source string
 		}
 	}
+	lockAddApprovedUser     sync.RWMutex
 	lockAddApprovedUsers    sync.RWMutex
 	lockApprovedUsers       sync.RWMutex
 	lockCheck               sync.RWMutex
+	lockCheckContext        sync.RWMutex
+	lockCheckLocal          sync.RWMutex
+	lockCheckUser           sync.RWMutex
+	lockIsNewUser           sync.RWMutex
 	lockLoadSamples         sync.RWMutex
 	lockLoadStopWords       sync.RWMutex
 	lockRemoveApprovedUsers sync.RWMutex
-	lockUpdateHam           sync.RWMutex
-	lockUpdateSpam          sync.RWMutex
+	lockSetApprovedUserName sync.RWMutex
+	lockUpdateHamFrom       sync.RWMutex
+	lockUpdateSpamFrom      sync.RWMutex
+}
+
+// AddApprovedUser calls AddApprovedUserFunc.
+func (mock *DetectorMock) AddApprovedUser(user lib.ApprovedUser) {
+	if mock.AddApprovedUserFunc == nil {
+		panic("DetectorMock.AddApprovedUserFunc: method is nil but Detector.AddApprovedUser was just called")
+	}
+	callInfo := struct {
+		User lib.ApprovedUser
+	}{
+		User: user,
+	}
+	mock.lockAddApprovedUser.Lock()
+	mock.calls.AddApprovedUser = append(mock.calls.AddApprovedUser, callInfo)
+	mock.lockAddApprovedUser.Unlock()
+	mock.AddApprovedUserFunc(user)
+}
+
+// AddApprovedUserCalls gets all the calls that were made to AddApprovedUser.
+// check the length with:
+//
+//	len(mockedDetector.AddApprovedUserCalls())
+func (mock *DetectorMock) AddApprovedUserCalls() []struct {
+	User lib.ApprovedUser
+} {
+	var calls []struct {
+		User lib.ApprovedUser
+	}
+	mock.lockAddApprovedUser.RLock()
+	calls = mock.calls.AddApprovedUser
+	mock.lockAddApprovedUser.RUnlock()
+	return calls
+}
+
+// ResetAddApprovedUserCalls reset all the calls that were made to AddApprovedUser.
+func (mock *DetectorMock) ResetAddApprovedUserCalls() {
+	mock.lockAddApprovedUser.Lock()
+	mock.calls.AddApprovedUser = nil
+	mock.lockAddApprovedUser.Unlock()
 }
 
 // AddApprovedUsers calls AddApprovedUsersFunc.
@@ -144,7 +270,7 @@ func (mock *DetectorMock) AddApprovedUsers(ids ...string) {
 }
 
 // AddApprovedUsersCalls gets all the calls that were made to AddApprovedUsers.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedDetector.AddApprovedUsersCalls())
 func (mock *DetectorMock) AddApprovedUsersCalls() []struct {
@@ -167,7 +293,7 @@ func (mock *DetectorMock) ResetAddApprovedUsersCalls() {
 }
 
 // ApprovedUsers calls ApprovedUsersFunc.
-func (mock *DetectorMock) ApprovedUsers() []string {
+func (mock *DetectorMock) ApprovedUsers() []lib.ApprovedUser {
 	if mock.ApprovedUsersFunc == nil {
 		panic("DetectorMock.ApprovedUsersFunc: method is nil but Detector.ApprovedUsers was just called")
 	}
@@ -180,7 +306,7 @@ func (mock *DetectorMock) ApprovedUsers() []string {
 }
 
 // ApprovedUsersCalls gets all the calls that were made to ApprovedUsers.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedDetector.ApprovedUsersCalls())
 func (mock *DetectorMock) ApprovedUsersCalls() []struct {
@@ -219,7 +345,7 @@ func (mock *DetectorMock) Check(msg string, userID string) (bool, []lib.CheckRes
 }
 
 // CheckCalls gets all the calls that were made to Check.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedDetector.CheckCalls())
 func (mock *DetectorMock) CheckCalls() []struct {
@@ -243,6 +369,178 @@ func (mock *DetectorMock) ResetCheckCalls() {
 	mock.lockCheck.Unlock()
 }
 
+// CheckContext calls CheckContextFunc.
+func (mock *DetectorMock) CheckContext(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult) {
+	if mock.CheckContextFunc == nil {
+		panic("DetectorMock.CheckContextFunc: method is nil but Detector.CheckContext was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		Msg    string
+		UserID string
+	}{
+		Ctx:    ctx,
+		Msg:    msg,
+		UserID: userID,
+	}
+	mock.lockCheckContext.Lock()
+	mock.calls.CheckContext = append(mock.calls.CheckContext, callInfo)
+	mock.lockCheckContext.Unlock()
+	return mock.CheckContextFunc(ctx, msg, userID)
+}
+
+// CheckContextCalls gets all the calls that were made to CheckContext.
+// check the length with:
+//
+//	len(mockedDetector.CheckContextCalls())
+func (mock *DetectorMock) CheckContextCalls() []struct {
+	Ctx    context.Context
+	Msg    string
+	UserID string
+} {
+	var calls []struct {
+		Ctx    context.Context
+		Msg    string
+		UserID string
+	}
+	mock.lockCheckContext.RLock()
+	calls = mock.calls.CheckContext
+	mock.lockCheckContext.RUnlock()
+	return calls
+}
+
+// ResetCheckContextCalls reset all the calls that were made to CheckContext.
+func (mock *DetectorMock) ResetCheckContextCalls() {
+	mock.lockCheckContext.Lock()
+	mock.calls.CheckContext = nil
+	mock.lockCheckContext.Unlock()
+}
+
+// CheckLocal calls CheckLocalFunc.
+func (mock *DetectorMock) CheckLocal(msg string, userID string) (bool, []lib.CheckResult) {
+	if mock.CheckLocalFunc == nil {
+		panic("DetectorMock.CheckLocalFunc: method is nil but Detector.CheckLocal was just called")
+	}
+	callInfo := struct {
+		Msg    string
+		UserID string
+	}{
+		Msg:    msg,
+		UserID: userID,
+	}
+	mock.lockCheckLocal.Lock()
+	mock.calls.CheckLocal = append(mock.calls.CheckLocal, callInfo)
+	mock.lockCheckLocal.Unlock()
+	return mock.CheckLocalFunc(msg, userID)
+}
+
+// CheckLocalCalls gets all the calls that were made to CheckLocal.
+// check the length with:
+//
+//	len(mockedDetector.CheckLocalCalls())
+func (mock *DetectorMock) CheckLocalCalls() []struct {
+	Msg    string
+	UserID string
+} {
+	var calls []struct {
+		Msg    string
+		UserID string
+	}
+	mock.lockCheckLocal.RLock()
+	calls = mock.calls.CheckLocal
+	mock.lockCheckLocal.RUnlock()
+	return calls
+}
+
+// ResetCheckLocalCalls reset all the calls that were made to CheckLocal.
+func (mock *DetectorMock) ResetCheckLocalCalls() {
+	mock.lockCheckLocal.Lock()
+	mock.calls.CheckLocal = nil
+	mock.lockCheckLocal.Unlock()
+}
+
+// CheckUser calls CheckUserFunc.
+func (mock *DetectorMock) CheckUser(ctx context.Context, userID string) (bool, []lib.CheckResult) {
+	if mock.CheckUserFunc == nil {
+		panic("DetectorMock.CheckUserFunc: method is nil but Detector.CheckUser was just called")
+	}
+	callInfo := struct {
+		Ctx    context.Context
+		UserID string
+	}{
+		Ctx:    ctx,
+		UserID: userID,
+	}
+	mock.lockCheckUser.Lock()
+	mock.calls.CheckUser = append(mock.calls.CheckUser, callInfo)
+	mock.lockCheckUser.Unlock()
+	return mock.CheckUserFunc(ctx, userID)
+}
+
+// CheckUserCalls gets all the calls that were made to CheckUser.
+// check the length with:
+//
+//	len(mockedDetector.CheckUserCalls())
+func (mock *DetectorMock) CheckUserCalls() []struct {
+	Ctx    context.Context
+	UserID string
+} {
+	var calls []struct {
+		Ctx    context.Context
+		UserID string
+	}
+	mock.lockCheckUser.RLock()
+	calls = mock.calls.CheckUser
+	mock.lockCheckUser.RUnlock()
+	return calls
+}
+
+// ResetCheckUserCalls reset all the calls that were made to CheckUser.
+func (mock *DetectorMock) ResetCheckUserCalls() {
+	mock.lockCheckUser.Lock()
+	mock.calls.CheckUser = nil
+	mock.lockCheckUser.Unlock()
+}
+
+// IsNewUser calls IsNewUserFunc.
+func (mock *DetectorMock) IsNewUser(userID string) bool {
+	if mock.IsNewUserFunc == nil {
+		panic("DetectorMock.IsNewUserFunc: method is nil but Detector.IsNewUser was just called")
+	}
+	callInfo := struct {
+		UserID string
+	}{
+		UserID: userID,
+	}
+	mock.lockIsNewUser.Lock()
+	mock.calls.IsNewUser = append(mock.calls.IsNewUser, callInfo)
+	mock.lockIsNewUser.Unlock()
+	return mock.IsNewUserFunc(userID)
+}
+
+// IsNewUserCalls gets all the calls that were made to IsNewUser.
+// check the length with:
+//
+//	len(mockedDetector.IsNewUserCalls())
+func (mock *DetectorMock) IsNewUserCalls() []struct {
+	UserID string
+} {
+	var calls []struct {
+		UserID string
+	}
+	mock.lockIsNewUser.RLock()
+	calls = mock.calls.IsNewUser
+	mock.lockIsNewUser.RUnlock()
+	return calls
+}
+
+// ResetIsNewUserCalls reset all the calls that were made to IsNewUser.
+func (mock *DetectorMock) ResetIsNewUserCalls() {
+	mock.lockIsNewUser.Lock()
+	mock.calls.IsNewUser = nil
+	mock.lockIsNewUser.Unlock()
+}
+
 // LoadSamples calls LoadSamplesFunc.
 func (mock *DetectorMock) LoadSamples(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (lib.LoadResult, error) {
 	if mock.LoadSamplesFunc == nil {
@@ -264,7 +562,7 @@ func (mock *DetectorMock) LoadSamples(exclReader io.Reader, spamReaders []io.Rea
 }
 
 // LoadSamplesCalls gets all the calls that were made to LoadSamples.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedDetector.LoadSamplesCalls())
 func (mock *DetectorMock) LoadSamplesCalls() []struct {
@@ -307,7 +605,7 @@ func (mock *DetectorMock) LoadStopWords(readers ...io.Reader) (lib.LoadResult, e
 }
 
 // LoadStopWordsCalls gets all the calls that were made to LoadStopWords.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedDetector.LoadStopWordsCalls())
 func (mock *DetectorMock) LoadStopWordsCalls() []struct {
@@ -346,7 +644,7 @@ func (mock *DetectorMock) RemoveApprovedUsers(ids ...string) {
 }
 
 // RemoveApprovedUsersCalls gets all the calls that were made to RemoveApprovedUsers.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedDetector.RemoveApprovedUsersCalls())
 func (mock *DetectorMock) RemoveApprovedUsersCalls() []struct {
@@ -368,86 +666,141 @@ func (mock *DetectorMock) ResetRemoveApprovedUsersCalls() {
 	mock.lockRemoveApprovedUsers.Unlock()
 }
 
-// UpdateHam calls UpdateHamFunc.
-func (mock *DetectorMock) UpdateHam(msg string) error {
-	if mock.UpdateHamFunc == nil {
-		panic("DetectorMock.UpdateHamFunc: method is nil but Detector.UpdateHam was just called")
+// SetApprovedUserName calls SetApprovedUserNameFunc.
+func (mock *DetectorMock) SetApprovedUserName(userID string, userName string) {
+	if mock.SetApprovedUserNameFunc == nil {
+		panic("DetectorMock.SetApprovedUserNameFunc: method is nil but Detector.SetApprovedUserName was just called")
+	}
+	callInfo := struct {
+		UserID   string
+		UserName string
+	}{
+		UserID:   userID,
+		UserName: userName,
+	}
+	mock.lockSetApprovedUserName.Lock()
+	mock.calls.SetApprovedUserName = append(mock.calls.SetApprovedUserName, callInfo)
+	mock.lockSetApprovedUserName.Unlock()
+	mock.SetApprovedUserNameFunc(userID, userName)
+}
+
+// SetApprovedUserNameCalls gets all the calls that were made to SetApprovedUserName.
+// check the length with:
+//
+//	len(mockedDetector.SetApprovedUserNameCalls())
+func (mock *DetectorMock) SetApprovedUserNameCalls() []struct {
+	UserID   string
+	UserName string
+} {
+	var calls []struct {
+		UserID   string
+		UserName string
+	}
+	mock.lockSetApprovedUserName.RLock()
+	calls = mock.calls.SetApprovedUserName
+	mock.lockSetApprovedUserName.RUnlock()
+	return calls
+}
+
+// ResetSetApprovedUserNameCalls reset all the calls that were made to SetApprovedUserName.
+func (mock *DetectorMock) ResetSetApprovedUserNameCalls() {
+	mock.lockSetApprovedUserName.Lock()
+	mock.calls.SetApprovedUserName = nil
+	mock.lockSetApprovedUserName.Unlock()
+}
+
+// UpdateHamFrom calls UpdateHamFromFunc.
+func (mock *DetectorMock) UpdateHamFrom(msg string, source string) error {
+	if mock.UpdateHamFromFunc == nil {
+		panic("DetectorMock.UpdateHamFromFunc: method is nil but Detector.UpdateHamFrom was just called")
 	}
 	callInfo := struct {
-		Msg string
+		Msg    string
+		Source string
 	}{
-		Msg: msg,
+		Msg:    msg,
+		Source: source,
 	}
-	mock.lockUpdateHam.Lock()
-	mock.calls.UpdateHam = append(mock.calls.UpdateHam, callInfo)
-	mock.lockUpdateHam.Unlock()
-	return mock.UpdateHamFunc(msg)
+	mock.lockUpdateHamFrom.Lock()
+	mock.calls.UpdateHamFrom = append(mock.calls.UpdateHamFrom, callInfo)
+	mock.lockUpdateHamFrom.Unlock()
+	return mock.UpdateHamFromFunc(msg, source)
 }
 
-// UpdateHamCalls gets all the calls that were made to UpdateHam.
-// Check the length with:
+// UpdateHamFromCalls gets all the calls that were made to UpdateHamFrom.
+// check the length with:
 //
-//	len(mockedDetector.UpdateHamCalls())
-func (mock *DetectorMock) UpdateHamCalls() []struct {
-	Msg string
+//	len(mockedDetector.UpdateHamFromCalls())
+func (mock *DetectorMock) UpdateHamFromCalls() []struct {
+	Msg    string
+	Source string
 } {
 	var calls []struct {
-		Msg string
+		Msg    string
+		Source string
 	}
-	mock.lockUpdateHam.RLock()
-	calls = mock.calls.UpdateHam
-	mock.lockUpdateHam.RUnlock()
+	mock.lockUpdateHamFrom.RLock()
+	calls = mock.calls.UpdateHamFrom
+	mock.lockUpdateHamFrom.RUnlock()
 	return calls
 }
 
-// ResetUpdateHamCalls reset all the calls that were made to UpdateHam.
-func (mock *DetectorMock) ResetUpdateHamCalls() {
-	mock.lockUpdateHam.Lock()
-	mock.calls.UpdateHam = nil
-	mock.lockUpdateHam.Unlock()
+// ResetUpdateHamFromCalls reset all the calls that were made to UpdateHamFrom.
+func (mock *DetectorMock) ResetUpdateHamFromCalls() {
+	mock.lockUpdateHamFrom.Lock()
+	mock.calls.UpdateHamFrom = nil
+	mock.lockUpdateHamFrom.Unlock()
 }
 
-// UpdateSpam calls UpdateSpamFunc.
-func (mock *DetectorMock) UpdateSpam(msg string) error {
-	if mock.UpdateSpamFunc == nil {
-		panic("DetectorMock.UpdateSpamFunc: method is nil but Detector.UpdateSpam was just called")
+// UpdateSpamFrom calls UpdateSpamFromFunc.
+func (mock *DetectorMock) UpdateSpamFrom(msg string, source string) error {
+	if mock.UpdateSpamFromFunc == nil {
+		panic("DetectorMock.UpdateSpamFromFunc: method is nil but Detector.UpdateSpamFrom was just called")
 	}
 	callInfo := struct {
-		Msg string
+		Msg    string
+		Source string
 	}{
-		Msg: msg,
+		Msg:    msg,
+		Source: source,
 	}
-	mock.lockUpdateSpam.Lock()
-	mock.calls.UpdateSpam = append(mock.calls.UpdateSpam, callInfo)
-	mock.lockUpdateSpam.Unlock()
-	return mock.UpdateSpamFunc(msg)
+	mock.lockUpdateSpamFrom.Lock()
+	mock.calls.UpdateSpamFrom = append(mock.calls.UpdateSpamFrom, callInfo)
+	mock.lockUpdateSpamFrom.Unlock()
+	return mock.UpdateSpamFromFunc(msg, source)
 }
 
-// UpdateSpamCalls gets all the calls that were made to UpdateSpam.
-// Check the length with:
+// UpdateSpamFromCalls gets all the calls that were made to UpdateSpamFrom.
+// check the length with:
 //
-//	len(mockedDetector.UpdateSpamCalls())
-func (mock *DetectorMock) UpdateSpamCalls() []struct {
-	Msg string
+//	len(mockedDetector.UpdateSpamFromCalls())
+func (mock *DetectorMock) UpdateSpamFromCalls() []struct {
+	Msg    string
+	Source string
 } {
 	var calls []struct {
-		Msg string
+		Msg    string
+		Source string
 	}
-	mock.lockUpdateSpam.RLock()
-	calls = mock.calls.UpdateSpam
-	mock.lockUpdateSpam.RUnlock()
+	mock.lockUpdateSpamFrom.RLock()
+	calls = mock.calls.UpdateSpamFrom
+	mock.lockUpdateSpamFrom.RUnlock()
 	return calls
 }
 
-// ResetUpdateSpamCalls reset all the calls that were made to UpdateSpam.
-func (mock *DetectorMock) ResetUpdateSpamCalls() {
-	mock.lockUpdateSpam.Lock()
-	mock.calls.UpdateSpam = nil
-	mock.lockUpdateSpam.Unlock()
+// ResetUpdateSpamFromCalls reset all the calls that were made to UpdateSpamFrom.
+func (mock *DetectorMock) ResetUpdateSpamFromCalls() {
+	mock.lockUpdateSpamFrom.Lock()
+	mock.calls.UpdateSpamFrom = nil
+	mock.lockUpdateSpamFrom.Unlock()
 }
 
 // ResetCalls reset all the calls that were made to all mocked methods.
 func (mock *DetectorMock) ResetCalls() {
+	mock.lockAddApprovedUser.Lock()
+	mock.calls.AddApprovedUser = nil
+	mock.lockAddApprovedUser.Unlock()
+
 	mock.lockAddApprovedUsers.Lock()
 	mock.calls.AddApprovedUsers = nil
 	mock.lockAddApprovedUsers.Unlock()
@@ -460,6 +813,22 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.Check = nil
 	mock.lockCheck.Unlock()
 
+	mock.lockCheckContext.Lock()
+	mock.calls.CheckContext = nil
+	mock.lockCheckContext.Unlock()
+
+	mock.lockCheckLocal.Lock()
+	mock.calls.CheckLocal = nil
+	mock.lockCheckLocal.Unlock()
+
+	mock.lockCheckUser.Lock()
+	mock.calls.CheckUser = nil
+	mock.lockCheckUser.Unlock()
+
+	mock.lockIsNewUser.Lock()
+	mock.calls.IsNewUser = nil
+	mock.lockIsNewUser.Unlock()
+
 	mock.lockLoadSamples.Lock()
 	mock.calls.LoadSamples = nil
 	mock.lockLoadSamples.Unlock()
@@ -472,11 +841,15 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.RemoveApprovedUsers = nil
 	mock.lockRemoveApprovedUsers.Unlock()
 
-	mock.lockUpdateHam.Lock()
-	mock.calls.UpdateHam = nil
-	mock.lockUpdateHam.Unlock()
+	mock.lockSetApprovedUserName.Lock()
+	mock.calls.SetApprovedUserName = nil
+	mock.lockSetApprovedUserName.Unlock()
+
+	mock.lockUpdateHamFrom.Lock()
+	mock.calls.UpdateHamFrom = nil
+	mock.lockUpdateHamFrom.Unlock()
 
-	mock.lockUpdateSpam.Lock()
-	mock.calls.UpdateSpam = nil
-	mock.lockUpdateSpam.Unlock()
+	mock.lockUpdateSpamFrom.Lock()
+	mock.calls.UpdateSpamFrom = nil
+	mock.lockUpdateSpamFrom.Unlock()
 }
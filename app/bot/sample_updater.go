@@ -1,10 +1,16 @@
 package bot
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
+
+	"github.com/umputun/tg-spam/app/storage"
 )
 
 // SampleUpdater represents a file that can be read and appended to.
@@ -13,6 +19,14 @@ type SampleUpdater struct {
 	fileName string
 }
 
+// SampleProvenance is a record of sample added to samples file with AppendFrom, kept in provenance file
+// next to samples file, as json line per sample.
+type SampleProvenance struct {
+	Time    time.Time `json:"ts"`
+	Source  string    `json:"source"`
+	Message string    `json:"message"`
+}
+
 // NewSampleUpdater creates a new SampleUpdater
 func NewSampleUpdater(fileName string) *SampleUpdater {
 	return &SampleUpdater{fileName: fileName}
@@ -40,3 +54,159 @@ func (s *SampleUpdater) Append(msg string) error {
 	}
 	return nil
 }
+
+// AppendFrom appends a message added by the source to the file, and records its provenance.
+// Source is storage.SampleSourceAuto if not set. The message is added even if provenance can't be recorded.
+func (s *SampleUpdater) AppendFrom(msg, source string) error {
+	if err := s.Append(msg); err != nil {
+		return err
+	}
+	if source == "" {
+		source = storage.SampleSourceAuto
+	}
+	rec := SampleProvenance{Time: time.Now(), Source: source, Message: strings.ReplaceAll(msg, "\n", " ")}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provenance of sample: %w", err)
+	}
+	fh, err := os.OpenFile(s.provenanceFile(), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.provenanceFile(), err)
+	}
+	defer fh.Close()
+	if _, err = fh.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to %s: %w", s.provenanceFile(), err)
+	}
+	return nil
+}
+
+// Provenance returns records of samples added by the source since the time, in order of adding. The source
+// matches itself and its actors, i.e. "admin" matches "admin:bob", empty source and zero since match all.
+func (s *SampleUpdater) Provenance(source string, since time.Time) ([]SampleProvenance, error) {
+	all, err := s.readProvenance()
+	if err != nil {
+		return nil, err
+	}
+	res := []SampleProvenance{}
+	for _, rec := range all {
+		if rec.matches(source, since) {
+			res = append(res, rec)
+		}
+	}
+	return res, nil
+}
+
+// Revert removes samples added by the source since the time from the file, i.e. to revert a bad training session.
+// The latest occurrence of each sample is removed, the source is matched the same way as by Provenance.
+// Returns number of removed samples. The file is reloaded by the watcher of samples, if the bot is running.
+func (s *SampleUpdater) Revert(source string, since time.Time) (int, error) {
+	if source == "" {
+		return 0, errors.New("empty source")
+	}
+	all, err := s.readProvenance()
+	if err != nil {
+		return 0, err
+	}
+	revert := map[string]int{} // messages to remove, with number of occurrences
+	kept := make([]SampleProvenance, 0, len(all))
+	for _, rec := range all {
+		if rec.matches(source, since) {
+			revert[rec.Message]++
+			continue
+		}
+		kept = append(kept, rec)
+	}
+	if len(revert) == 0 {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(s.fileName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", s.fileName, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	removed := 0
+	for i := len(lines) - 1; i >= 0; i-- { // the latest occurrences are removed
+		if revert[lines[i]] > 0 {
+			revert[lines[i]]--
+			lines = append(lines[:i], lines[i+1:]...)
+			removed++
+		}
+	}
+	text := strings.Join(lines, "\n")
+	if text != "" {
+		text += "\n"
+	}
+	if err = writeFileAtomic(s.fileName, []byte(text), 0o644); err != nil {
+		return 0, err
+	}
+
+	var sb strings.Builder
+	for _, rec := range kept {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return removed, fmt.Errorf("failed to marshal provenance of sample: %w", err)
+		}
+		sb.Write(append(line, '\n'))
+	}
+	if err = writeFileAtomic(s.provenanceFile(), []byte(sb.String()), 0o600); err != nil {
+		return removed, err
+	}
+	return removed, nil
+}
+
+// provenanceFile returns name of the file with provenance of samples, next to samples file
+func (s *SampleUpdater) provenanceFile() string {
+	return s.fileName + ".provenance"
+}
+
+// readProvenance reads all provenance records, empty list if the file doesn't exist
+func (s *SampleUpdater) readProvenance() ([]SampleProvenance, error) {
+	fh, err := os.Open(s.provenanceFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", s.provenanceFile(), err)
+	}
+	defer fh.Close()
+
+	var res []SampleProvenance
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var rec SampleProvenance
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of %s: %w", n, s.provenanceFile(), err)
+		}
+		res = append(res, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.provenanceFile(), err)
+	}
+	return res, nil
+}
+
+// matches checks if the sample was added by the source, or its actor, since the time
+func (p SampleProvenance) matches(source string, since time.Time) bool {
+	if p.Time.Before(since) {
+		return false
+	}
+	return source == "" || p.Source == source || strings.HasPrefix(p.Source, source+":")
+}
+
+// writeFileAtomic writes data to the temp file and renames it to the file, so the file is not damaged on failure
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmpFile := file + ".tmp"
+	if err := os.WriteFile(tmpFile, data, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmpFile, err)
+	}
+	if err := os.Rename(tmpFile, file); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to rename %s: %w", tmpFile, err)
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package bot
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -54,3 +56,48 @@ func TestSampleUpdater(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestSampleUpdater_Provenance(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spam-dynamic.txt")
+	updater := NewSampleUpdater(file)
+	require.NoError(t, updater.Append("without source"))
+	require.NoError(t, updater.AppendFrom("bob 1", "admin:bob"))
+	require.NoError(t, updater.AppendFrom("alice\nmultiline", "admin:alice"))
+	require.NoError(t, updater.AppendFrom("api 1", "api:key:ci"))
+	require.NoError(t, updater.AppendFrom("bob 1", "admin:bob"))
+	require.NoError(t, updater.AppendFrom("auto", ""))
+
+	recs, err := updater.Provenance("admin", time.Time{})
+	require.NoError(t, err)
+	require.Len(t, recs, 3)
+	assert.Equal(t, "admin:bob", recs[0].Source)
+	assert.Equal(t, "alice multiline", recs[1].Message)
+	assert.False(t, recs[0].Time.IsZero())
+	recs, err = updater.Provenance("", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, recs, 5, "sample without source is not recorded")
+	assert.Equal(t, "auto", recs[4].Source)
+	recs, err = updater.Provenance("admin", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+
+	removed, err := updater.Revert("admin:bob", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "without source\nalice multiline\napi 1\nauto\n", string(data))
+	recs, err = updater.Provenance("", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, recs, 3, "provenance of reverted samples removed")
+
+	removed, err = updater.Revert("admin", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed, "nothing added since")
+	_, err = updater.Revert("", time.Time{})
+	assert.Error(t, err)
+
+	recs, err = NewSampleUpdater(filepath.Join(t.TempDir(), "none.txt")).Provenance("admin", time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, recs, "no provenance file")
+}
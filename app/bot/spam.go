@@ -3,33 +3,57 @@ package bot
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/hashicorp/go-multierror"
 
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/tracing"
 	"github.com/umputun/tg-spam/lib"
 )
 
 //go:generate moq --out mocks/detector.go --pkg mocks --skip-ensure --with-resets . Detector
+//go:generate moq --out mocks/denylist.go --pkg mocks --skip-ensure --with-resets . Denylist
+//go:generate moq --out mocks/consensus.go --pkg mocks --skip-ensure --with-resets . Consensus
+
+// CheckConsensus is a name of check result of the second opinion of the remote instance on spam verdict.
+// It is spam if the remote instance confirmed the verdict, and ham if not, the message is suspicious then.
+const CheckConsensus = "consensus"
 
 // SpamFilter bot checks if a user is a spammer using lib.Detector
 // Reloads spam samples, stop words and excluded tokens on file change.
 type SpamFilter struct {
 	Detector
-	params SpamConfig
+	params     SpamConfig
+	paramsLock sync.RWMutex // guards responses and dry mode, can be changed at runtime
+
+	shadowStats struct {
+		sync.Mutex
+		ShadowStats
+	}
+
+	samplesStatus struct {
+		sync.RWMutex
+		loaded bool           // samples loaded at least once
+		err    error          // error of the last reload, nil if succeeded
+		counts lib.LoadResult // numbers of samples and stop-words loaded by the last successful reload
+	}
 }
 
 // SpamConfig is a full set of parameters for spam bot
 type SpamConfig struct {
 
 	// samples file names need to be watched for changes and reload.
+	// ignored for samples and dictionaries loaded from the stores.
 	SpamSamplesFile    string
 	HamSamplesFile     string
 	StopWordsFile      string
@@ -37,24 +61,76 @@ type SpamConfig struct {
 	SpamDynamicFile    string
 	HamDynamicFile     string
 
+	// optional database stores, used instead of samples and stop-words/excluded tokens files if set
+	SamplesStore    SamplesStore
+	DictionaryStore DictionaryStore
+
 	SpamMsg    string
 	SpamDryMsg string
 
 	WatchDelay time.Duration
 
 	Dry bool
+
+	// Shadow is an optional candidate detector evaluated side-by-side with the live one.
+	// Its verdicts never affect moderation, only differences are reported.
+	Shadow              Detector
+	ShadowStopWordsFile string // stop-words for shadow detector, if empty the live one is used
+
+	// Denylist is an optional list of spammers and spam messages confirmed by this and peer instances,
+	// checked for new users if the detector passed them
+	Denylist Denylist
+
+	// Consensus is an optional remote instance asked for the second opinion on spam verdicts with confidence
+	// below ConsensusConfidence, in percents. Such message is spam only if the remote instance agrees.
+	Consensus           Consensus
+	ConsensusConfidence float64
+}
+
+// ShadowStats is a summary of live vs shadow (candidate) detector verdicts
+type ShadowStats struct {
+	Checked        int `json:"checked"`          // messages checked by both detectors
+	Differ         int `json:"differ"`           // messages with different verdicts
+	LiveSpamOnly   int `json:"live_spam_only"`   // spam by live detector, but the candidate would let it pass
+	ShadowSpamOnly int `json:"shadow_spam_only"` // spam by candidate, but the live detector let it pass
 }
 
 // Detector is a spam detector interface
 type Detector interface {
 	Check(msg string, userID string) (spam bool, cr []lib.CheckResult)
+	CheckContext(ctx context.Context, msg string, userID string) (spam bool, cr []lib.CheckResult)
+	CheckLocal(msg string, userID string) (spam bool, cr []lib.CheckResult)
+	CheckUser(ctx context.Context, userID string) (spam bool, cr []lib.CheckResult)
 	LoadSamples(exclReader io.Reader, spamReaders, hamReaders []io.Reader) (lib.LoadResult, error)
 	LoadStopWords(readers ...io.Reader) (lib.LoadResult, error)
-	UpdateSpam(msg string) error
-	UpdateHam(msg string) error
+	UpdateSpamFrom(msg, source string) error
+	UpdateHamFrom(msg, source string) error
 	AddApprovedUsers(ids ...string)
+	AddApprovedUser(user lib.ApprovedUser)
 	RemoveApprovedUsers(ids ...string)
-	ApprovedUsers() (res []string)
+	ApprovedUsers() (res []lib.ApprovedUser)
+	SetApprovedUserName(userID, userName string)
+	IsNewUser(userID string) bool
+}
+
+// SamplesStore provides readers for spam and ham samples kept in the database
+type SamplesStore interface {
+	Reader(t storage.SampleType, origin storage.SampleOrigin) (io.ReadCloser, error)
+}
+
+// DictionaryStore provides readers for stop-words and excluded tokens kept in the database
+type DictionaryStore interface {
+	Reader(t storage.DictionaryType) (io.ReadCloser, error)
+}
+
+// Denylist checks users and messages confirmed as spam by this and peer instances
+type Denylist interface {
+	Check(userID int64, msg string) (storage.DenylistEntry, bool)
+}
+
+// Consensus checks messages with another tg-spam instance, for the second opinion on borderline verdicts
+type Consensus interface {
+	Check(ctx context.Context, msg, userID string) (spam bool, cr []lib.CheckResult, err error)
 }
 
 // NewSpamFilter creates new spam filter
@@ -68,46 +144,209 @@ func NewSpamFilter(ctx context.Context, detector Detector, params SpamConfig) *S
 	return res
 }
 
-// OnMessage checks if user already approved and if not checks if user is a spammer
-func (s *SpamFilter) OnMessage(msg Message) (response Response) {
+// OnMessage checks if user already approved and if not checks if user is a spammer.
+// The context is passed to network-based checks of the detector, and traces the check.
+func (s *SpamFilter) OnMessage(ctx context.Context, msg Message) (response Response) {
 	if msg.From.ID == 0 { // don't check system messages
 		return Response{}
 	}
 	displayUsername := DisplayName(msg)
-	isSpam, checkResults := s.Check(msg.Text, strconv.FormatInt(msg.From.ID, 10))
-	crs := []string{}
+	ctx, span := tracing.Start(ctx, "detector check", tracing.Int64("user.id", msg.From.ID))
+	isSpam, checkResults := s.CheckContext(ctx, msg.Text, strconv.FormatInt(msg.From.ID, 10))
+	if cr, listed := s.checkDenylist(isSpam, msg.From.ID, msg.Text); listed {
+		isSpam, checkResults = true, append(checkResults, cr)
+	}
+	if isSpam && s.params.Consensus != nil {
+		isSpam, checkResults = s.checkConsensus(ctx, msg, checkResults)
+	}
+	crs, spamChecks := []string{}, []string{}
+	degraded := false
 	for _, cr := range checkResults {
 		crs = append(crs, fmt.Sprintf("{name: %s, spam: %v, details: %s}", cr.Name, cr.Spam, cr.Details))
+		if cr.Spam {
+			spamChecks = append(spamChecks, cr.Name)
+		}
+		if cr.Name == lib.CheckDegraded {
+			degraded = true
+			log.Printf("[WARN] degraded check of message of %s, %s", displayUsername, cr.Details)
+		}
 	}
+	span.SetAttributes(tracing.Bool("spam", isSpam), tracing.String("spam.checks", strings.Join(spamChecks, ",")),
+		tracing.Bool("degraded", degraded))
+	span.Finish()
 	checkResultStr := strings.Join(crs, ", ")
+	if s.params.Shadow != nil {
+		go s.compareShadow(msg, isSpam, checkResultStr) // doesn't delay the response, the verdict is logged only
+	}
 	if isSpam {
 		log.Printf("[INFO] user %s detected as spammer: %s, %q", displayUsername, checkResultStr, msg.Text)
+		s.paramsLock.RLock()
 		msgPrefix := s.params.SpamMsg
 		if s.params.Dry {
 			msgPrefix = s.params.SpamDryMsg
 		}
+		s.paramsLock.RUnlock()
 		spamRespMsg := fmt.Sprintf("%s: %q (%d)", msgPrefix, displayUsername, msg.From.ID)
 		return Response{Text: spamRespMsg, Send: true, ReplyTo: msg.ID, BanInterval: PermanentBanDuration, CheckResults: checkResults,
 			DeleteReplyTo: true, User: User{Username: msg.From.Username, ID: msg.From.ID, DisplayName: msg.From.DisplayName},
 		}
 	}
 	log.Printf("[DEBUG] user %s is not a spammer, %s", displayUsername, checkResultStr)
+	// keep the name of the user, to show it in the list of approved users
+	s.Detector.SetApprovedUserName(strconv.FormatInt(msg.From.ID, 10), displayUsername)
 	return Response{CheckResults: checkResults} // not a spam
 }
 
-// UpdateSpam appends a message to the spam samples file and updates the classifier
-func (s *SpamFilter) UpdateSpam(msg string) error {
-	log.Printf("[DEBUG] update spam samples with %q", msg)
-	if err := s.Detector.UpdateSpam(msg); err != nil {
+// OnJoin checks if the user joined the chat is a known spammer, with CAS, lols.bot and denylist.
+// Returns response with ban interval set for a spammer, the response has no text, as there is no message to reply to.
+func (s *SpamFilter) OnJoin(ctx context.Context, user User) (response Response) {
+	ctx, span := tracing.Start(ctx, "detector user check", tracing.Int64("user.id", user.ID))
+	isSpam, checkResults := s.CheckUser(ctx, strconv.FormatInt(user.ID, 10))
+	if cr, listed := s.checkDenylist(isSpam, user.ID, ""); listed {
+		isSpam, checkResults = true, append(checkResults, cr)
+	}
+	span.SetAttributes(tracing.Bool("spam", isSpam))
+	span.Finish()
+	if !isSpam {
+		log.Printf("[DEBUG] joined user %d is not a known spammer, %+v", user.ID, checkResults)
+		return Response{CheckResults: checkResults}
+	}
+	log.Printf("[INFO] joined user %d (%s) is a known spammer, %+v", user.ID, user.Username, checkResults)
+	return Response{Send: true, BanInterval: PermanentBanDuration, User: user, CheckResults: checkResults}
+}
+
+// checkDenylist checks the user and the message with denylist, if set. Only new users passed the detector are checked,
+// approved users are trusted over the denylist shared with peers.
+func (s *SpamFilter) checkDenylist(spam bool, userID int64, msg string) (lib.CheckResult, bool) {
+	if spam || s.params.Denylist == nil || !s.Detector.IsNewUser(strconv.FormatInt(userID, 10)) {
+		return lib.CheckResult{}, false
+	}
+	entry, ok := s.params.Denylist.Check(userID, msg)
+	if !ok {
+		return lib.CheckResult{}, false
+	}
+	source := "locally"
+	if entry.Source != "" {
+		source = "by " + entry.Source
+	}
+	details := fmt.Sprintf("user listed %s", source)
+	switch entry.Kind {
+	case storage.DenylistHash:
+		details = fmt.Sprintf("message of user %d listed %s", entry.UserID, source)
+	case storage.DenylistNorm:
+		details = fmt.Sprintf("similar message of user %d listed %s", entry.UserID, source)
+	}
+	return lib.CheckResult{Name: "denylist", Spam: true, Details: details}, true
+}
+
+// checkConsensus asks the remote instance for the second opinion on spam verdict with confidence below
+// ConsensusConfidence. Not confirmed verdict is changed to ham, with spam results of local checks vetoed in place,
+// and the message is reported as suspicious. The local verdict is kept if the remote check failed.
+func (s *SpamFilter) checkConsensus(ctx context.Context, msg Message, checks []lib.CheckResult) (bool, []lib.CheckResult) {
+	confidence := Confidence(checks)
+	if confidence >= s.params.ConsensusConfidence {
+		return true, checks
+	}
+	ctx, span := tracing.Start(ctx, "consensus check", tracing.Int64("user.id", msg.From.ID))
+	defer span.Finish()
+	spam, remote, err := s.params.Consensus.Check(ctx, msg.Text, strconv.FormatInt(msg.From.ID, 10))
+	if err != nil {
+		log.Printf("[WARN] consensus check of message of %d failed, %v", msg.From.ID, err)
+		return true, append(checks, lib.CheckResult{Name: lib.CheckDegraded, Spam: false,
+			Details: fmt.Sprintf("consensus check failed, local verdict kept, %v", err)})
+	}
+	span.SetAttributes(tracing.Bool("spam", spam))
+	if spam {
+		names := []string{}
+		for _, cr := range remote {
+			if cr.Spam {
+				names = append(names, cr.Name)
+			}
+		}
+		return true, append(checks, lib.CheckResult{Name: CheckConsensus, Spam: true,
+			Details: fmt.Sprintf("confirmed by remote instance, %s", strings.Join(names, ", "))})
+	}
+	names := []string{}
+	for i := range checks {
+		if checks[i].Spam {
+			checks[i].Spam = false
+			checks[i].Details += ", vetoed"
+			names = append(names, checks[i].Name)
+		}
+	}
+	details := fmt.Sprintf("suspicious, spam verdict with confidence %.0f%% not confirmed by remote instance, vetoed %s",
+		confidence, strings.Join(names, ", "))
+	log.Printf("[INFO] spam verdict vetoed, %s: %q", details, msg.Text)
+	return false, append(checks, lib.CheckResult{Name: CheckConsensus, Spam: false, Details: details})
+}
+
+// Messages returns responses to detected spam, in normal and dry modes
+func (s *SpamFilter) Messages() (spamMsg, spamDryMsg string) {
+	s.paramsLock.RLock()
+	defer s.paramsLock.RUnlock()
+	return s.params.SpamMsg, s.params.SpamDryMsg
+}
+
+// SetMessages changes responses to detected spam, in normal and dry modes. Thread-safe, can be called at runtime.
+func (s *SpamFilter) SetMessages(spamMsg, spamDryMsg string) {
+	s.paramsLock.Lock()
+	defer s.paramsLock.Unlock()
+	s.params.SpamMsg, s.params.SpamDryMsg = spamMsg, spamDryMsg
+}
+
+// SetDry changes dry mode, detected spam is responded with dry mode message in it. Thread-safe.
+func (s *SpamFilter) SetDry(dry bool) {
+	s.paramsLock.Lock()
+	defer s.paramsLock.Unlock()
+	s.params.Dry = dry
+}
+
+// ShadowStats returns summary of live vs shadow detector verdicts, zero if shadow detector is not set
+func (s *SpamFilter) ShadowStats() ShadowStats {
+	s.shadowStats.Lock()
+	defer s.shadowStats.Unlock()
+	return s.shadowStats.ShadowStats
+}
+
+// compareShadow checks the message with shadow detector and reports if the verdict differs from the live one
+func (s *SpamFilter) compareShadow(msg Message, liveSpam bool, liveResults string) {
+	shadowSpam, shadowResults := s.params.Shadow.Check(msg.Text, strconv.FormatInt(msg.From.ID, 10))
+
+	s.shadowStats.Lock()
+	defer s.shadowStats.Unlock()
+	s.shadowStats.Checked++
+	if shadowSpam != liveSpam {
+		s.shadowStats.Differ++
+		if liveSpam {
+			s.shadowStats.LiveSpamOnly++
+		} else {
+			s.shadowStats.ShadowSpamOnly++
+		}
+		crs := []string{}
+		for _, cr := range shadowResults {
+			crs = append(crs, fmt.Sprintf("{name: %s, spam: %v, details: %s}", cr.Name, cr.Spam, cr.Details))
+		}
+		log.Printf("[INFO] shadow verdict differs for %s, live spam: %v, shadow spam: %v, %q\n live: %s\n shadow: %s",
+			DisplayName(msg), liveSpam, shadowSpam, msg.Text, liveResults, strings.Join(crs, ", "))
+	}
+	if s.shadowStats.Checked%100 == 0 {
+		log.Printf("[INFO] shadow stats: %+v", s.shadowStats.ShadowStats)
+	}
+}
+
+// UpdateSpam appends a message added by the source to the spam samples and updates the classifier
+func (s *SpamFilter) UpdateSpam(msg, source string) error {
+	log.Printf("[DEBUG] update spam samples with %q, source %s", msg, source)
+	if err := s.Detector.UpdateSpamFrom(msg, source); err != nil {
 		return fmt.Errorf("can't update spam samples: %w", err)
 	}
 	return nil
 }
 
-// UpdateHam appends a message to the ham samples file and updates the classifier
-func (s *SpamFilter) UpdateHam(msg string) error {
-	log.Printf("[DEBUG] update ham samples with %q", msg)
-	if err := s.Detector.UpdateHam(msg); err != nil {
+// UpdateHam appends a message added by the source to the ham samples and updates the classifier
+func (s *SpamFilter) UpdateHam(msg, source string) error {
+	log.Printf("[DEBUG] update ham samples with %q, source %s", msg, source)
+	if err := s.Detector.UpdateHamFrom(msg, source); err != nil {
 		return fmt.Errorf("can't update ham samples: %w", err)
 	}
 	return nil
@@ -122,6 +361,14 @@ func (s *SpamFilter) AddApprovedUsers(id int64, ids ...int64) {
 		sids[i] = strconv.FormatInt(id, 10)
 	}
 	s.Detector.AddApprovedUsers(sids...)
+	if s.params.Shadow != nil {
+		s.params.Shadow.AddApprovedUsers(sids...)
+	}
+}
+
+// IsNewUser returns true if the user has no messages checked as ham yet, i.e. the next message is the first one
+func (s *SpamFilter) IsNewUser(id int64) bool {
+	return s.Detector.IsNewUser(strconv.FormatInt(id, 10))
 }
 
 // RemoveApprovedUsers removes users from the list of approved users
@@ -133,6 +380,9 @@ func (s *SpamFilter) RemoveApprovedUsers(id int64, ids ...int64) {
 		sids[i] = strconv.FormatInt(id, 10)
 	}
 	s.Detector.RemoveApprovedUsers(sids...)
+	if s.params.Shadow != nil {
+		s.params.Shadow.RemoveApprovedUsers(sids...)
+	}
 }
 
 // watch watches for changes in samples files and reloads them
@@ -188,10 +438,17 @@ func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 		log.Printf("[DEBUG] add file %q to watcher", file)
 		return watcher.Add(file)
 	}
-	errs = multierror.Append(errs, addToWatcher(s.params.ExcludedTokensFile))
-	errs = multierror.Append(errs, addToWatcher(s.params.SpamSamplesFile))
-	errs = multierror.Append(errs, addToWatcher(s.params.HamSamplesFile))
-	errs = multierror.Append(errs, addToWatcher(s.params.StopWordsFile))
+	if s.params.DictionaryStore == nil {
+		errs = multierror.Append(errs, addToWatcher(s.params.ExcludedTokensFile))
+		errs = multierror.Append(errs, addToWatcher(s.params.StopWordsFile))
+	}
+	if s.params.SamplesStore == nil {
+		errs = multierror.Append(errs, addToWatcher(s.params.SpamSamplesFile))
+		errs = multierror.Append(errs, addToWatcher(s.params.HamSamplesFile))
+	}
+	if s.params.Shadow != nil && s.params.ShadowStopWordsFile != "" {
+		errs = multierror.Append(errs, addToWatcher(s.params.ShadowStopWordsFile))
+	}
 	if err := errs.ErrorOrNil(); err != nil {
 		return fmt.Errorf("failed to add some files to watcher: %w", err)
 	}
@@ -199,60 +456,137 @@ func (s *SpamFilter) watch(ctx context.Context, delay time.Duration) error {
 	return nil
 }
 
-// ReloadSamples reloads samples and stop-words
+// ReloadSamples reloads samples and stop-words, for both live and shadow detectors
 func (s *SpamFilter) ReloadSamples() (err error) {
 	log.Printf("[DEBUG] reloading samples")
+	defer func() {
+		s.samplesStatus.Lock()
+		s.samplesStatus.loaded = s.samplesStatus.loaded || err == nil
+		s.samplesStatus.err = err
+		s.samplesStatus.Unlock()
+	}()
 
-	var exclReader, spamReader, hamReader, stopWordsReader, spamDynamicReader, hamDynamicReader io.ReadCloser
-
-	// open mandatory spam and ham samples files
-	if spamReader, err = os.Open(s.params.SpamSamplesFile); err != nil {
-		return fmt.Errorf("failed to open spam samples file %q: %w", s.params.SpamSamplesFile, err)
+	lr, ls, err := s.loadSamples(s.Detector, "")
+	if err != nil {
+		return err
 	}
-	defer spamReader.Close()
+	log.Printf("[INFO] loaded samples - spam: %d, ham: %d, excluded tokens: %d, stop-words: %d",
+		lr.SpamSamples, lr.HamSamples, lr.ExcludedTokens, ls.StopWords)
+	s.samplesStatus.Lock()
+	s.samplesStatus.counts = lib.LoadResult{SpamSamples: lr.SpamSamples, HamSamples: lr.HamSamples,
+		ExcludedTokens: lr.ExcludedTokens, StopWords: ls.StopWords}
+	s.samplesStatus.Unlock()
 
-	if hamReader, err = os.Open(s.params.HamSamplesFile); err != nil {
-		return fmt.Errorf("failed to open ham samples file %q: %w", s.params.HamSamplesFile, err)
+	if s.params.Shadow == nil {
+		return nil
 	}
-	defer hamReader.Close()
-
-	// stop-words are optional
-	if stopWordsReader, err = os.Open(s.params.StopWordsFile); err != nil {
-		stopWordsReader = io.NopCloser(bytes.NewReader([]byte("")))
+	if _, ls, err = s.loadSamples(s.params.Shadow, s.params.ShadowStopWordsFile); err != nil {
+		return fmt.Errorf("shadow detector: %w", err)
 	}
-	defer stopWordsReader.Close()
+	log.Printf("[INFO] loaded shadow samples, stop-words: %d", ls.StopWords)
+	return nil
+}
 
-	// excluded tokens are optional
-	if exclReader, err = os.Open(s.params.ExcludedTokensFile); err != nil {
-		exclReader = io.NopCloser(bytes.NewReader([]byte("")))
+// SamplesReady returns error if samples are not loaded yet or the last reload failed
+func (s *SpamFilter) SamplesReady() error {
+	s.samplesStatus.RLock()
+	defer s.samplesStatus.RUnlock()
+	if s.samplesStatus.err != nil {
+		return fmt.Errorf("last reload of samples failed: %w", s.samplesStatus.err)
 	}
-	defer exclReader.Close()
+	if !s.samplesStatus.loaded {
+		return errors.New("samples not loaded")
+	}
+	return nil
+}
 
-	// dynamic samples are optional
-	if spamDynamicReader, err = os.Open(s.params.SpamDynamicFile); err != nil {
-		spamDynamicReader = io.NopCloser(bytes.NewReader([]byte("")))
+// LoadedSamples returns numbers of samples, excluded tokens and stop-words loaded by the last successful reload
+func (s *SpamFilter) LoadedSamples() lib.LoadResult {
+	s.samplesStatus.RLock()
+	defer s.samplesStatus.RUnlock()
+	return s.samplesStatus.counts
+}
+
+// loadSamples loads samples and stop-words to the given detector.
+// Samples and dictionaries are read from the stores if set, otherwise from the files.
+// stopWordsFile overrides the stop-words source, empty value means default one.
+func (s *SpamFilter) loadSamples(det Detector, stopWordsFile string) (lr, ls lib.LoadResult, err error) {
+	var exclReader, spamReader, hamReader, stopWordsReader, spamDynamicReader, hamDynamicReader io.ReadCloser
+
+	if s.params.SamplesStore != nil {
+		// database keeps both preset and dynamic samples
+		if spamReader, err = s.params.SamplesStore.Reader(storage.SampleTypeSpam, storage.SampleOriginAny); err != nil {
+			return lr, ls, fmt.Errorf("failed to read spam samples: %w", err)
+		}
+		defer spamReader.Close()
+		if hamReader, err = s.params.SamplesStore.Reader(storage.SampleTypeHam, storage.SampleOriginAny); err != nil {
+			return lr, ls, fmt.Errorf("failed to read ham samples: %w", err)
+		}
+		defer hamReader.Close()
+		spamDynamicReader, hamDynamicReader = emptyReader(), emptyReader()
+	} else {
+		// open mandatory spam and ham samples files
+		if spamReader, err = os.Open(s.params.SpamSamplesFile); err != nil {
+			return lr, ls, fmt.Errorf("failed to open spam samples file %q: %w", s.params.SpamSamplesFile, err)
+		}
+		defer spamReader.Close()
+
+		if hamReader, err = os.Open(s.params.HamSamplesFile); err != nil {
+			return lr, ls, fmt.Errorf("failed to open ham samples file %q: %w", s.params.HamSamplesFile, err)
+		}
+		defer hamReader.Close()
+
+		// dynamic samples are optional
+		spamDynamicReader, hamDynamicReader = optionalFile(s.params.SpamDynamicFile), optionalFile(s.params.HamDynamicFile)
 	}
 	defer spamDynamicReader.Close()
+	defer hamDynamicReader.Close()
 
-	if hamDynamicReader, err = os.Open(s.params.HamDynamicFile); err != nil {
-		hamDynamicReader = io.NopCloser(bytes.NewReader([]byte("")))
+	// stop-words and excluded tokens are optional
+	if s.params.DictionaryStore != nil {
+		if exclReader, err = s.params.DictionaryStore.Reader(storage.DictionaryTypeIgnoredWord); err != nil {
+			return lr, ls, fmt.Errorf("failed to read excluded tokens: %w", err)
+		}
+		stopWordsReader = optionalFile(stopWordsFile)
+		if stopWordsFile == "" {
+			if stopWordsReader, err = s.params.DictionaryStore.Reader(storage.DictionaryTypeStopPhrase); err != nil {
+				return lr, ls, fmt.Errorf("failed to read stop-words: %w", err)
+			}
+		}
+	} else {
+		exclReader = optionalFile(s.params.ExcludedTokensFile)
+		if stopWordsFile == "" {
+			stopWordsFile = s.params.StopWordsFile
+		}
+		stopWordsReader = optionalFile(stopWordsFile)
 	}
-	defer hamDynamicReader.Close()
+	defer exclReader.Close()
+	defer stopWordsReader.Close()
 
 	// reload samples and stop-words. note: we don't need reset as LoadSamples and LoadStopWords clear the state first
-	lr, err := s.LoadSamples(exclReader, []io.Reader{spamReader, spamDynamicReader},
+	lr, err = det.LoadSamples(exclReader, []io.Reader{spamReader, spamDynamicReader},
 		[]io.Reader{hamReader, hamDynamicReader})
 	if err != nil {
-		return fmt.Errorf("failed to reload samples: %w", err)
+		return lr, ls, fmt.Errorf("failed to reload samples: %w", err)
 	}
 
-	ls, err := s.LoadStopWords(stopWordsReader)
+	ls, err = det.LoadStopWords(stopWordsReader)
 	if err != nil {
-		return fmt.Errorf("failed to reload stop words: %w", err)
+		return lr, ls, fmt.Errorf("failed to reload stop words: %w", err)
 	}
+	return lr, ls, nil
+}
 
-	log.Printf("[INFO] loaded samples - spam: %d, ham: %d, excluded tokens: %d, stop-words: %d",
-		lr.SpamSamples, lr.HamSamples, lr.ExcludedTokens, ls.StopWords)
-
-	return nil
+// optionalFile opens the file if it exists, otherwise returns an empty reader
+func optionalFile(fileName string) io.ReadCloser {
+	if fileName == "" {
+		return emptyReader()
+	}
+	fh, err := os.Open(fileName) //nolint:gosec // file name is from config
+	if err != nil {
+		return emptyReader()
+	}
+	return fh
 }
+
+func emptyReader() io.ReadCloser { return io.NopCloser(bytes.NewReader([]byte(""))) }
@@ -14,6 +14,8 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/tg-spam/app/bot/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/tracing"
 	"github.com/umputun/tg-spam/lib"
 )
 
@@ -22,17 +24,18 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 	defer cancel()
 
 	det := &mocks.DetectorMock{
-		CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+		CheckContextFunc: func(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult) {
 			if msg == "spam" {
 				return true, []lib.CheckResult{{Name: "something", Spam: true, Details: "some spam"}}
 			}
 			return false, []lib.CheckResult{{Name: "already approved", Spam: false, Details: "some ham"}}
 		},
+		SetApprovedUserNameFunc: func(userID, userName string) {},
 	}
 
 	t.Run("spam detected", func(t *testing.T) {
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
-		resp := s.OnMessage(Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		resp := s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
 		assert.Equal(t, Response{Text: `detected: "john" (1)`, Send: true, BanInterval: PermanentBanDuration,
 			User: User{ID: 1, Username: "john"}, DeleteReplyTo: true,
 			CheckResults: []lib.CheckResult{{Name: "something", Spam: true, Details: "some spam"}}}, resp)
@@ -41,18 +44,77 @@ func TestSpamFilter_OnMessage(t *testing.T) {
 
 	t.Run("spam detected, dry", func(t *testing.T) {
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry", Dry: true})
-		resp := s.OnMessage(Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		resp := s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
 		assert.Equal(t, `detected dry: "john" (1)`, resp.Text)
 		assert.True(t, resp.Send)
 		assert.Equal(t, []lib.CheckResult{{Name: "something", Spam: true, Details: "some spam"}}, resp.CheckResults)
 	})
 
+	t.Run("messages and dry mode changed", func(t *testing.T) {
+		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
+		s.SetMessages("spam found", "spam found, dry")
+		spamMsg, dryMsg := s.Messages()
+		assert.Equal(t, "spam found", spamMsg)
+		assert.Equal(t, "spam found, dry", dryMsg)
+		resp := s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		assert.Equal(t, `spam found: "john" (1)`, resp.Text)
+
+		s.SetDry(true)
+		resp = s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		assert.Equal(t, `spam found, dry: "john" (1)`, resp.Text)
+	})
+
 	t.Run("ham detected", func(t *testing.T) {
 		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
-		resp := s.OnMessage(Message{Text: "good", From: User{ID: 1, Username: "john"}})
+		det.ResetCalls()
+		resp := s.OnMessage(ctx, Message{Text: "good", From: User{ID: 1, Username: "john"}})
 		assert.Equal(t, Response{CheckResults: []lib.CheckResult{{Name: "already approved", Spam: false, Details: "some ham"}}}, resp)
+		require.Equal(t, 1, len(det.SetApprovedUserNameCalls()))
+		assert.Equal(t, "1", det.SetApprovedUserNameCalls()[0].UserID)
+		assert.Equal(t, "john", det.SetApprovedUserNameCalls()[0].UserName)
 	})
 
+	t.Run("traced check", func(t *testing.T) {
+		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry"})
+		det.ResetCalls()
+		tracedCtx, span := tracing.Start(tracing.WithExporter(ctx, &tracing.Exporter{}), "telegram update")
+		s.OnMessage(tracedCtx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		require.Equal(t, 1, len(det.CheckContextCalls()))
+		checkSpan := tracing.FromContext(det.CheckContextCalls()[0].Ctx)
+		require.NotNil(t, checkSpan, "detector called with the context of check span")
+		assert.Equal(t, "detector check", checkSpan.Name)
+		assert.Equal(t, span.SpanID, checkSpan.ParentID)
+		assert.Contains(t, checkSpan.Attrs, tracing.String("spam.checks", "something"))
+	})
+
+	t.Run("with shadow detector", func(t *testing.T) {
+		shadow := &mocks.DetectorMock{
+			CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+				if msg == "spam" || msg == "suspicious" {
+					return true, []lib.CheckResult{{Name: "shadow", Spam: true, Details: "shadow spam"}}
+				}
+				return false, []lib.CheckResult{{Name: "shadow", Spam: false, Details: "shadow ham"}}
+			},
+		}
+		s := NewSpamFilter(ctx, det, SpamConfig{SpamMsg: "detected", SpamDryMsg: "detected dry", Shadow: shadow})
+
+		resp := s.OnMessage(ctx, Message{Text: "spam", From: User{ID: 1, Username: "john"}})
+		assert.True(t, resp.Send)
+		resp = s.OnMessage(ctx, Message{Text: "suspicious", From: User{ID: 2, Username: "jane"}})
+		assert.False(t, resp.Send, "shadow verdict doesn't affect response")
+		assert.Equal(t, []lib.CheckResult{{Name: "already approved", Spam: false, Details: "some ham"}}, resp.CheckResults)
+		resp = s.OnMessage(ctx, Message{Text: "good", From: User{ID: 3, Username: "bob"}})
+		assert.False(t, resp.Send)
+
+		assert.Eventually(t, func() bool { return s.ShadowStats().Checked == 3 }, time.Second, 10*time.Millisecond,
+			"compared in background")
+		assert.Equal(t, ShadowStats{Checked: 3, Differ: 1, ShadowSpamOnly: 1}, s.ShadowStats())
+		users := []string{}
+		for _, c := range shadow.CheckCalls() {
+			users = append(users, c.UserID)
+		}
+		assert.ElementsMatch(t, []string{"1", "2", "3"}, users)
+	})
 }
 
 func TestSpamFilter_reloadSamples(t *testing.T) {
@@ -158,13 +220,61 @@ func TestSpamFilter_reloadSamples(t *testing.T) {
 			if tc.expectedErr != nil {
 				require.Error(t, err)
 				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+				assert.EqualError(t, s.SamplesReady(), "last reload of samples failed: "+tc.expectedErr.Error())
 			} else {
 				assert.NoError(t, err)
+				assert.NoError(t, s.SamplesReady())
 			}
 		})
 	}
 }
 
+func TestSpamFilter_reloadSamplesFromStores(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := storage.NewSqliteDB(filepath.Join(t.TempDir(), "samples.db"))
+	require.NoError(t, err)
+	samples, err := storage.NewSamples(db)
+	require.NoError(t, err)
+	dict, err := storage.NewDictionary(db)
+	require.NoError(t, err)
+
+	require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginPreset, storage.SampleSourceBase, "spam preset"))
+	require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginUser, "admin:bob", "spam user"))
+	require.NoError(t, samples.Add(storage.SampleTypeHam, storage.SampleOriginPreset, storage.SampleSourceBase, "ham preset"))
+	require.NoError(t, dict.Add(storage.DictionaryTypeStopPhrase, "stop phrase"))
+	require.NoError(t, dict.Add(storage.DictionaryTypeIgnoredWord, "ignored"))
+
+	readAll := func(r io.Reader) string {
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		return string(data)
+	}
+	var spam, ham, excl, stopWords string
+	det := &mocks.DetectorMock{
+		LoadSamplesFunc: func(exclReader io.Reader, spamReaders []io.Reader, hamReaders []io.Reader) (lib.LoadResult, error) {
+			excl, spam, ham = readAll(exclReader), readAll(io.MultiReader(spamReaders...)), readAll(io.MultiReader(hamReaders...))
+			return lib.LoadResult{SpamSamples: 2, HamSamples: 1, ExcludedTokens: 1}, nil
+		},
+		LoadStopWordsFunc: func(readers ...io.Reader) (lib.LoadResult, error) {
+			stopWords = readAll(io.MultiReader(readers...))
+			return lib.LoadResult{StopWords: 1}, nil
+		},
+	}
+
+	s := NewSpamFilter(ctx, det, SpamConfig{SamplesStore: samples, DictionaryStore: dict, SpamSamplesFile: "not-used"})
+	assert.EqualError(t, s.SamplesReady(), "samples not loaded")
+	assert.Equal(t, lib.LoadResult{}, s.LoadedSamples())
+	require.NoError(t, s.ReloadSamples())
+	assert.NoError(t, s.SamplesReady())
+	assert.Equal(t, lib.LoadResult{SpamSamples: 2, HamSamples: 1, ExcludedTokens: 1, StopWords: 1}, s.LoadedSamples())
+	assert.Equal(t, "spam preset\nspam user\n", spam)
+	assert.Equal(t, "ham preset\n", ham)
+	assert.Equal(t, "ignored\n", excl)
+	assert.Equal(t, "stop phrase\n", stopWords)
+}
+
 func TestSpamFilter_watch(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -304,13 +414,13 @@ func TestSpamFilter_Update(t *testing.T) {
 	defer cancel()
 
 	mockDetector := &mocks.DetectorMock{
-		UpdateSpamFunc: func(msg string) error {
+		UpdateSpamFromFunc: func(msg, source string) error {
 			if msg == "err" {
 				return errors.New("error")
 			}
 			return nil
 		},
-		UpdateHamFunc: func(msg string) error {
+		UpdateHamFromFunc: func(msg, source string) error {
 			if msg == "err" {
 				return errors.New("error")
 			}
@@ -321,18 +431,23 @@ func TestSpamFilter_Update(t *testing.T) {
 	sf := NewSpamFilter(ctx, mockDetector, SpamConfig{})
 
 	t.Run("good update", func(t *testing.T) {
-		err := sf.UpdateSpam("spam")
+		err := sf.UpdateSpam("spam", "admin:bob")
 		assert.NoError(t, err)
 
-		err = sf.UpdateHam("ham")
+		err = sf.UpdateHam("ham", "api:basic")
 		assert.NoError(t, err)
+
+		require.Len(t, mockDetector.UpdateSpamFromCalls(), 1)
+		assert.Equal(t, "admin:bob", mockDetector.UpdateSpamFromCalls()[0].Source)
+		require.Len(t, mockDetector.UpdateHamFromCalls(), 1)
+		assert.Equal(t, "api:basic", mockDetector.UpdateHamFromCalls()[0].Source)
 	})
 
 	t.Run("bad update", func(t *testing.T) {
-		err := sf.UpdateSpam("err")
+		err := sf.UpdateSpam("err", "")
 		assert.Error(t, err)
 
-		err = sf.UpdateHam("err")
+		err = sf.UpdateHam("err", "")
 		assert.Error(t, err)
 	})
 }
@@ -365,6 +480,15 @@ func TestAddApprovedUsers(t *testing.T) {
 	})
 }
 
+func TestSpamFilter_IsNewUser(t *testing.T) {
+	mockDirector := &mocks.DetectorMock{IsNewUserFunc: func(userID string) bool { return userID == "1" }}
+	sf := SpamFilter{Detector: mockDirector}
+	assert.True(t, sf.IsNewUser(1))
+	assert.False(t, sf.IsNewUser(2))
+	require.Equal(t, 2, len(mockDirector.IsNewUserCalls()))
+	assert.Equal(t, "1", mockDirector.IsNewUserCalls()[0].UserID)
+}
+
 func TestRemoveApprovedUsers(t *testing.T) {
 	mockDirector := &mocks.DetectorMock{RemoveApprovedUsersFunc: func(ids ...string) {}}
 
@@ -392,3 +516,143 @@ func TestRemoveApprovedUsers(t *testing.T) {
 		assert.Equal(t, []string{"1", "2", "3"}, mockDirector.RemoveApprovedUsersCalls()[0].Ids)
 	})
 }
+
+func TestSpamFilter_OnJoin(t *testing.T) {
+	mockDirector := &mocks.DetectorMock{CheckUserFunc: func(ctx context.Context, userID string) (bool, []lib.CheckResult) {
+		if userID == "1" {
+			return true, []lib.CheckResult{{Name: "cas", Spam: true, Details: "record found"}}
+		}
+		return false, []lib.CheckResult{{Name: "cas", Spam: false, Details: "not found"}}
+	}}
+	sf := SpamFilter{Detector: mockDirector}
+
+	resp := sf.OnJoin(context.Background(), User{ID: 1, Username: "spammer"})
+	assert.Equal(t, Response{Send: true, BanInterval: PermanentBanDuration, User: User{ID: 1, Username: "spammer"},
+		CheckResults: []lib.CheckResult{{Name: "cas", Spam: true, Details: "record found"}}}, resp)
+
+	resp = sf.OnJoin(context.Background(), User{ID: 2, Username: "user"})
+	assert.Equal(t, Response{CheckResults: []lib.CheckResult{{Name: "cas", Spam: false, Details: "not found"}}}, resp)
+	require.Equal(t, 2, len(mockDirector.CheckUserCalls()))
+	assert.Equal(t, "2", mockDirector.CheckUserCalls()[1].UserID)
+}
+
+func TestSpamFilter_Denylist(t *testing.T) {
+	det := &mocks.DetectorMock{
+		CheckContextFunc: func(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult) {
+			return msg == "spam", []lib.CheckResult{{Name: "stopword", Spam: msg == "spam"}}
+		},
+		CheckUserFunc: func(ctx context.Context, userID string) (bool, []lib.CheckResult) {
+			return false, nil
+		},
+		IsNewUserFunc:           func(userID string) bool { return userID != "3" },
+		SetApprovedUserNameFunc: func(userID, userName string) {},
+	}
+	dl := &mocks.DenylistMock{CheckFunc: func(userID int64, msg string) (storage.DenylistEntry, bool) {
+		switch {
+		case userID == 1 || userID == 3:
+			return storage.DenylistEntry{Kind: storage.DenylistUser, Value: "1", UserID: 1, Source: "https://peer"}, true
+		case msg == "listed message":
+			return storage.DenylistEntry{Kind: storage.DenylistHash, Value: "hash", UserID: 10}, true
+		case msg == "mutated message":
+			return storage.DenylistEntry{Kind: storage.DenylistNorm, Value: "norm", UserID: 11, Source: "https://peer"}, true
+		}
+		return storage.DenylistEntry{}, false
+	}}
+	sf := NewSpamFilter(context.Background(), det, SpamConfig{SpamMsg: "spam", Denylist: dl})
+
+	resp := sf.OnMessage(context.Background(), Message{From: User{ID: 1, Username: "user1"}, Text: "hello", ID: 5})
+	assert.True(t, resp.Send)
+	assert.Equal(t, PermanentBanDuration, resp.BanInterval)
+	assert.Equal(t, lib.CheckResult{Name: "denylist", Spam: true, Details: "user listed by https://peer"},
+		resp.CheckResults[len(resp.CheckResults)-1])
+
+	resp = sf.OnMessage(context.Background(), Message{From: User{ID: 2, Username: "user2"}, Text: "listed message", ID: 6})
+	assert.True(t, resp.Send)
+	assert.Equal(t, lib.CheckResult{Name: "denylist", Spam: true, Details: "message of user 10 listed locally"},
+		resp.CheckResults[len(resp.CheckResults)-1])
+
+	resp = sf.OnMessage(context.Background(), Message{From: User{ID: 2, Username: "user2"}, Text: "mutated message", ID: 6})
+	assert.True(t, resp.Send)
+	assert.Equal(t, lib.CheckResult{Name: "denylist", Spam: true, Details: "similar message of user 11 listed by https://peer"},
+		resp.CheckResults[len(resp.CheckResults)-1])
+
+	resp = sf.OnMessage(context.Background(), Message{From: User{ID: 2, Username: "user2"}, Text: "hello", ID: 7})
+	assert.False(t, resp.Send)
+
+	resp = sf.OnMessage(context.Background(), Message{From: User{ID: 3, Username: "approved"}, Text: "hello", ID: 8})
+	assert.False(t, resp.Send, "approved user not checked")
+
+	dl.ResetCalls()
+	resp = sf.OnMessage(context.Background(), Message{From: User{ID: 1, Username: "user1"}, Text: "spam", ID: 9})
+	assert.True(t, resp.Send)
+	assert.Empty(t, dl.CheckCalls(), "spam detected, denylist not checked")
+
+	resp = sf.OnJoin(context.Background(), User{ID: 1, Username: "user1"})
+	assert.True(t, resp.Send)
+	assert.Equal(t, []lib.CheckResult{{Name: "denylist", Spam: true, Details: "user listed by https://peer"}}, resp.CheckResults)
+	resp = sf.OnJoin(context.Background(), User{ID: 2, Username: "user2"})
+	assert.False(t, resp.Send)
+}
+
+func TestSpamFilter_Consensus(t *testing.T) {
+	det := &mocks.DetectorMock{
+		CheckContextFunc: func(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult) {
+			switch msg {
+			case "sure spam":
+				return true, []lib.CheckResult{{Name: "cas", Spam: true}, {Name: "stopword", Spam: true}}
+			case "ham":
+				return false, []lib.CheckResult{{Name: "stopword", Spam: false}}
+			}
+			return true, []lib.CheckResult{{Name: "emoji", Spam: true, Details: "3/2"}, {Name: "stopword", Spam: false}}
+		},
+		SetApprovedUserNameFunc: func(userID, userName string) {},
+	}
+	consensus := &mocks.ConsensusMock{CheckFunc: func(ctx context.Context, msg string, userID string) (bool, []lib.CheckResult, error) {
+		switch msg {
+		case "remote fails":
+			return false, nil, errors.New("timeout")
+		case "remote spam":
+			return true, []lib.CheckResult{{Name: "openai", Spam: true}, {Name: "similarity", Spam: false}}, nil
+		}
+		return false, []lib.CheckResult{{Name: "openai", Spam: false}}, nil
+	}}
+	sf := NewSpamFilter(context.Background(), det, SpamConfig{SpamMsg: "spam", Consensus: consensus, ConsensusConfidence: 90})
+
+	t.Run("confident verdict not forwarded", func(t *testing.T) {
+		consensus.ResetCalls()
+		resp := sf.OnMessage(context.Background(), Message{From: User{ID: 1}, Text: "sure spam"})
+		assert.True(t, resp.Send)
+		assert.Empty(t, consensus.CheckCalls())
+		resp = sf.OnMessage(context.Background(), Message{From: User{ID: 1}, Text: "ham"})
+		assert.False(t, resp.Send)
+		assert.Empty(t, consensus.CheckCalls(), "ham not forwarded")
+	})
+
+	t.Run("confirmed by remote", func(t *testing.T) {
+		consensus.ResetCalls()
+		resp := sf.OnMessage(context.Background(), Message{From: User{ID: 2}, Text: "remote spam"})
+		assert.True(t, resp.Send)
+		require.Len(t, consensus.CheckCalls(), 1)
+		assert.Equal(t, "2", consensus.CheckCalls()[0].UserID)
+		assert.Equal(t, lib.CheckResult{Name: CheckConsensus, Spam: true, Details: "confirmed by remote instance, openai"},
+			resp.CheckResults[len(resp.CheckResults)-1])
+		_, suspicious := resp.Suspicious()
+		assert.False(t, suspicious)
+	})
+
+	t.Run("not confirmed by remote", func(t *testing.T) {
+		resp := sf.OnMessage(context.Background(), Message{From: User{ID: 3}, Text: "remote ham"})
+		assert.False(t, resp.Send)
+		assert.Equal(t, lib.CheckResult{Name: "emoji", Spam: false, Details: "3/2, vetoed"}, resp.CheckResults[0])
+		cr, suspicious := resp.Suspicious()
+		require.True(t, suspicious)
+		assert.Equal(t, CheckConsensus, cr.Name)
+		assert.Equal(t, "suspicious, spam verdict with confidence 50% not confirmed by remote instance, vetoed emoji", cr.Details)
+	})
+
+	t.Run("remote failed", func(t *testing.T) {
+		resp := sf.OnMessage(context.Background(), Message{From: User{ID: 4}, Text: "remote fails"})
+		assert.True(t, resp.Send, "local verdict kept")
+		assert.True(t, resp.Degraded())
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// checkResult is the verdict of check command, printed as json with --json
+type checkResult struct {
+	Spam   bool              `json:"spam"`
+	Checks []lib.CheckResult `json:"checks"`
+}
+
+// checkMessage checks the message set by check --msg, or read from in if not set, with the configured samples,
+// stop-words and thresholds, and prints the verdict with results of all checks to out. Telegram is not used, and
+// CAS and OpenAI checks are disabled, so the result depends on the local configuration only.
+func checkMessage(ctx context.Context, opts options, in io.Reader, out io.Writer) error {
+	msg := opts.Check.Msg
+	if msg == "" {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return fmt.Errorf("can't read message, %w", err)
+		}
+		msg = strings.TrimSpace(string(data))
+	}
+	if msg == "" {
+		return errors.New("no message to check, set --msg or pass it to stdin")
+	}
+
+	opts.CAS.API, opts.Lols.API, opts.OpenAI.Token = "", "", ""
+	var dataDB *sqlx.DB
+	if opts.Files.SamplesStorage == "db" {
+		db, err := storage.NewSqliteDB(filepath.Join(opts.Files.DynamicDataPath, dataFile))
+		if err != nil {
+			return fmt.Errorf("can't make data db, %w", err)
+		}
+		defer db.Close()
+		dataDB = db
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops watching of samples files
+	detector := makeDetector(opts, nil)
+	if _, err := makeSpamBot(ctx, opts, detector, dataDB, nil, nil); err != nil {
+		return fmt.Errorf("can't load samples, %w", err)
+	}
+
+	res := checkResult{}
+	res.Spam, res.Checks = detector.Check(msg, opts.Check.UserID)
+	if opts.Check.JSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	verdict := "ham"
+	if res.Spam {
+		verdict = "spam"
+	}
+	if _, err := fmt.Fprintf(out, "verdict: %s\n", verdict); err != nil {
+		return err
+	}
+	for _, cr := range res.Checks {
+		if _, err := fmt.Fprintf(out, "- %s\n", cr.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
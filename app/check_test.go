@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkMessage(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte("win a prize now\nfree money here\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte("hello there friends\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, stopWordsFile), []byte("buy crypto\n"), 0o600))
+
+	check := func(in string, args ...string) (string, error) {
+		opts, _, err := loadOptions(append([]string{"--files.samples=" + tmpDir, "--files.dynamic=" + tmpDir,
+			"--min-msg-len=0", "check"}, args...))
+		require.NoError(t, err)
+		out := bytes.Buffer{}
+		err = checkMessage(context.Background(), opts, strings.NewReader(in), &out)
+		return out.String(), err
+	}
+
+	out, err := check("", "--msg=please buy crypto")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "verdict: spam\n"), out)
+	assert.Contains(t, out, "- stopword: spam, buy crypto\n")
+
+	out, err = check("hello there friends\n")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "verdict: ham\n"), out)
+	assert.NotContains(t, out, "cas", "cas disabled")
+
+	out, err = check("", "--msg=free money here", "--json")
+	require.NoError(t, err)
+	var res checkResult
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	assert.True(t, res.Spam)
+	require.NotEmpty(t, res.Checks)
+	names := []string{}
+	for _, cr := range res.Checks {
+		names = append(names, cr.Name)
+	}
+	assert.Contains(t, names, "similarity")
+
+	_, err = check("  \n")
+	assert.EqualError(t, err, "no message to check, set --msg or pass it to stdin")
+
+	t.Run("no samples", func(t *testing.T) {
+		opts, _, err := loadOptions([]string{"--files.samples=/no/such/dir", "--files.dynamic=" + tmpDir, "check", "--msg=hi"})
+		require.NoError(t, err)
+		err = checkMessage(context.Background(), opts, strings.NewReader(""), &bytes.Buffer{})
+		assert.ErrorContains(t, err, "can't load samples")
+	})
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/go-multierror"
+	"github.com/umputun/go-flags"
+	"gopkg.in/yaml.v3"
+
+	"github.com/umputun/tg-spam/app/consensus"
+	"github.com/umputun/tg-spam/app/denylist"
+	"github.com/umputun/tg-spam/app/webapi"
+)
+
+// secretOptions are options redacted by config print
+var secretOptions = []string{"telegram.token", "openai.token", "storage.encryption-key", "server.auth",
+	"server.check.auth", "server.jwt.secret", "webhook.secret", "tracing.header", "logger.url",
+	"telegram.proxy", "cas.proxy", "openai.proxy", "notify.slack", "notify.discord", "notify.mattermost",
+	"denylist.peer", "consensus.url", "quota.secret", "redis.url"}
+
+// redacted replaces values of secret options in the printed config
+const redacted = "*****"
+
+// loadConfigFile sets options from yaml or toml config file as defaults of the parser, so options set by env and flags
+// take precedence when parsed again. Files with .toml extension are parsed as toml, others as yaml. Keys of the file
+// are long names of options, nested by namespaces, i.e. "server: {limits: {rate: 10}}" or "server.limits.rate: 10".
+// Lists are used for repeated options.
+func loadConfigFile(p *flags.Parser, file string) error {
+	data, err := os.ReadFile(file) //nolint:gosec // file set by user
+	if err != nil {
+		return fmt.Errorf("can't read config file, %w", err)
+	}
+	var cfg map[string]any
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		err = toml.Unmarshal(data, &cfg)
+	} else {
+		err = yaml.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("can't parse config file %s, %w", file, err)
+	}
+
+	values := map[string][]string{}
+	if err = flattenConfig("", cfg, values); err != nil {
+		return fmt.Errorf("invalid config file %s, %w", file, err)
+	}
+	// invalid defaults are ignored by the parser, so values are checked as flags of a throwaway parser first
+	args := []string{}
+	for name, vals := range values {
+		opt := p.FindOptionByLongName(name)
+		if opt == nil || name == "config" {
+			return fmt.Errorf("unknown option %q in config file %s", name, file)
+		}
+		opt.Default = vals
+		for _, v := range vals {
+			if opt.Field().Type.Kind() != reflect.Bool {
+				args = append(args, "--"+name+"="+v)
+				continue
+			}
+			switch v {
+			case "true":
+				args = append(args, "--"+name)
+			case "false":
+			default:
+				return fmt.Errorf("invalid value %q of %q in config file %s, expected true or false", v, name, file)
+			}
+		}
+	}
+	check := flags.NewParser(&options{}, flags.None)
+	check.SubcommandsOptional = true
+	if _, err = check.ParseArgs(args); err != nil {
+		return fmt.Errorf("invalid config file %s, %w", file, err)
+	}
+	return nil
+}
+
+// flattenConfig collects values of nested config into values, keyed by long names of options
+func flattenConfig(prefix string, cfg map[string]any, values map[string][]string) error {
+	for k, v := range cfg {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			if err := flattenConfig(name, val, values); err != nil {
+				return err
+			}
+		case []any:
+			res := make([]string, 0, len(val))
+			for _, item := range val {
+				s, err := configScalar(name, item)
+				if err != nil {
+					return err
+				}
+				res = append(res, s)
+			}
+			values[name] = res
+		default:
+			s, err := configScalar(name, val)
+			if err != nil {
+				return err
+			}
+			values[name] = []string{s}
+		}
+	}
+	return nil
+}
+
+// configScalar returns the value of the option as a string, as it would be passed in a flag
+func configScalar(name string, v any) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", fmt.Errorf("empty value of %q", name)
+	case map[string]any, []any:
+		return "", fmt.Errorf("unexpected nested value of %q", name)
+	case time.Time:
+		return val.Format(time.RFC3339), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// printConfig writes the effective configuration as yaml, with secrets redacted.
+// The output can be used as a config file.
+func printConfig(p *flags.Parser, w io.Writer) error {
+	cfg := map[string]any{}
+	for _, opt := range configOptions(p) {
+		name := opt.LongNameWithNamespace()
+		val := configValue(reflect.ValueOf(opt.Value()))
+		if slices.Contains(secretOptions, name) {
+			val = redactConfigValue(val)
+		}
+		// nest by namespaces, i.e. server.limits.rate is written as server: {limits: {rate: ...}}
+		parts, node := strings.Split(name, "."), cfg
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = val
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("can't marshal config, %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// redactConfigValue replaces non-empty value of secret option, each item of list options is redacted
+func redactConfigValue(v any) any {
+	switch val := v.(type) {
+	case string:
+		if val != "" {
+			return redacted
+		}
+	case []any:
+		res := make([]any, len(val))
+		for i := range val {
+			res[i] = redacted
+		}
+		return res
+	}
+	return v
+}
+
+// configOptions returns options allowed in config file, i.e. all options except of commands, help and config file itself
+func configOptions(p *flags.Parser) (res []*flags.Option) {
+	var walk func(g *flags.Group)
+	walk = func(g *flags.Group) {
+		for _, opt := range g.Options() {
+			if opt.LongName == "" || opt.LongName == "config" || reflect.ValueOf(opt.Value()).Kind() == reflect.Func {
+				continue // help options are funcs
+			}
+			res = append(res, opt)
+		}
+		for _, gg := range g.Groups() {
+			walk(gg)
+		}
+	}
+	walk(p.Command.Group)
+	sort.Slice(res, func(i, j int) bool { return res[i].LongNameWithNamespace() < res[j].LongNameWithNamespace() })
+	return res
+}
+
+// configValue returns the value of the option to print, durations are printed as strings, i.e. 30s
+func configValue(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	if v.Kind() == reflect.Slice {
+		res := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res = append(res, configValue(v.Index(i)))
+		}
+		return res
+	}
+	if v.Kind() == reflect.String {
+		return v.String() // named string types printed as plain strings
+	}
+	return v.Interface()
+}
+
+// runConfigCommand runs config print or config validate command
+func runConfigCommand(p *flags.Parser, opts options, w io.Writer) error {
+	if p.Active.Active == nil {
+		return errors.New("config command requires print or validate subcommand")
+	}
+	switch p.Active.Active.Name {
+	case "print":
+		return printConfig(p, w)
+	case "validate":
+		if err := validateConfig(opts); err != nil {
+			return fmt.Errorf("invalid config, %w", err)
+		}
+		_, err := fmt.Fprintln(w, "config is valid")
+		return err
+	}
+	return fmt.Errorf("unknown config command %q", p.Active.Active.Name)
+}
+
+// validateConfig checks the options for errors detected on start otherwise, all errors are reported
+func validateConfig(opts options) error {
+	errs := new(multierror.Error)
+	if !opts.Server.Enabled && (opts.Telegram.Token == "" || opts.Telegram.Group == "") {
+		errs = multierror.Append(errs, errors.New("telegram token and group are required"))
+	}
+	if (opts.Server.TLS.Cert == "") != (opts.Server.TLS.Key == "") {
+		errs = multierror.Append(errs, errors.New("both tls certificate and key files should be set"))
+	}
+	if _, err := parseRetention(opts.Storage.Retention); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid storage retention, %w", err))
+	}
+	if opts.Logger.Enabled {
+		if _, err := parseSize(opts.Logger.MaxSize); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid logger max size, %w", err))
+		}
+		if _, _, err := parseSyslogAddr(opts.Logger.SyslogAddr); opts.Logger.Sink == "syslog" && err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if opts.Logger.Sink == "http" && opts.Logger.URL == "" {
+			errs = multierror.Append(errs, errors.New("logger url is required for http sink"))
+		}
+	}
+	if opts.Server.AccessLog != "" {
+		if _, err := parseSize(opts.Server.AccessLogMaxSize); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid access log max size, %w", err))
+		}
+	}
+	if _, err := webapi.ParseTrustedProxies(opts.Server.TrustedProxies); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("invalid trusted proxies, %w", err))
+	}
+	if err := checkProxies(opts); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if opts.Join.Check && opts.CAS.API == "" && opts.Lols.API == "" {
+		errs = multierror.Append(errs, errors.New("join check requires cas or lols.bot api"))
+	}
+	// telegram considers restrictions shorter than 30 seconds or longer than 366 days as forever
+	if r := opts.Greeting.Restrict; r != 0 && (r < 30*time.Second || r > 366*24*time.Hour) {
+		errs = multierror.Append(errs, fmt.Errorf("invalid newcomer restriction %v, should be 30s-366d or 0", r))
+	}
+	if opts.Greeting.TTL < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid greeting ttl %v, should be 0 or positive", opts.Greeting.TTL))
+	}
+	if opts.Join.Ban && !opts.Join.Check {
+		errs = multierror.Append(errs, errors.New("join ban requires join check"))
+	}
+	if opts.Storage.EncryptionKey != "" && opts.Storage.EncryptionFile != "" {
+		errs = multierror.Append(errs, errors.New("both encryption key and key file set"))
+	}
+	if _, err := parseSimilarityCategories(opts.SimilarityCategory); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if _, err := parseOpenAICategories(opts.OpenAI.Category); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if opts.Checks.ScamsFeed != "" {
+		if !opts.Checks.BuiltinScams {
+			errs = multierror.Append(errs, errors.New("scams feed requires builtin scams"))
+		}
+		if _, err := parseScamsKey(opts.Checks.ScamsKey); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if opts.Checks.ScamsInterval <= 0 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid scams interval %v, should be positive", opts.Checks.ScamsInterval))
+		}
+	}
+	if opts.HamSampler.Rate < 0 || opts.HamSampler.Rate > 1 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid ham sampler rate %v, should be 0-1", opts.HamSampler.Rate))
+	}
+	if opts.Activity.Boost != 0 {
+		if opts.Activity.Boost < 0 || opts.Activity.Boost > 100 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid activity boost %v, should be 0-100", opts.Activity.Boost))
+		}
+		if _, err := parseActivityHours(opts.Activity.Timezone, opts.Activity.Hours); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if opts.ParanoidMode {
+			errs = multierror.Append(errs, errors.New("activity boost requires new users tracking, not available in paranoid mode"))
+		}
+	}
+	if opts.MaxMsgLen < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid max message length %d, should be 0 or positive", opts.MaxMsgLen))
+	}
+	if opts.CheckBudget < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid check budget %v, should be 0 or positive", opts.CheckBudget))
+	}
+	if opts.OpenAI.ContextMessages < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid openai context messages %d, should be 0 or positive", opts.OpenAI.ContextMessages))
+	}
+	if len(opts.Denylist.Peers) > 0 && !opts.Denylist.Enabled {
+		errs = multierror.Append(errs, errors.New("denylist peers require denylist enabled"))
+	}
+	for _, p := range opts.Denylist.Peers {
+		if _, err := denylist.ParsePeer(p); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if opts.Consensus.URL != "" {
+		if _, err := consensus.ParseRemote(opts.Consensus.URL); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if opts.Consensus.Confidence <= 0 || opts.Consensus.Confidence > 100 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid consensus confidence %v, should be 0-100", opts.Consensus.Confidence))
+		}
+		if opts.Consensus.Timeout <= 0 {
+			errs = multierror.Append(errs, fmt.Errorf("invalid consensus timeout %v, should be positive", opts.Consensus.Timeout))
+		}
+	}
+	if opts.OpenAI.Veto && len(opts.OpenAI.Check) > 0 {
+		errs = multierror.Append(errs, errors.New("openai veto can't be used with openai check, use check spam with override rescue"))
+	}
+	if len(opts.OpenAI.Check) == 0 && (len(opts.OpenAI.Override) > 0 || opts.OpenAI.MinConfidence > 0) {
+		errs = multierror.Append(errs, errors.New("openai override and min confidence require openai check"))
+	}
+	if opts.OpenAI.MinConfidence < 0 || opts.OpenAI.MinConfidence > 100 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid openai min confidence %d, should be 0-100", opts.OpenAI.MinConfidence))
+	}
+	if _, err := makeOpenAIPrompt(opts).Render(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if opts.ClassifierSmoothing < 0 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid classifier smoothing %v, should be 0 or positive", opts.ClassifierSmoothing))
+	}
+	if opts.HamVetoMargin < 0 || opts.HamVetoMargin > 1 {
+		errs = multierror.Append(errs, fmt.Errorf("invalid ham veto margin %.2f, should be 0-1", opts.HamVetoMargin))
+	}
+	if opts.LowMemory && len(opts.SimilarityCategory) > 0 {
+		errs = multierror.Append(errs, errors.New("similarity categories can't be used in low memory mode, similarity check is disabled"))
+	}
+	if _, err := makeSettingsSchedule(opts, nil); err != nil { // rules of options and timezone only, without store
+		errs = multierror.Append(errs, err)
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_loadConfigFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tg-spam.yml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+telegram:
+  token: tg-token
+  group: mygroup
+  timeout: 10s
+server:
+  enabled: true
+  limits:
+    rate: 10
+  trusted-proxy: [10.0.0.0/8, 192.168.1.1]
+server.listen: ":9090"
+admin.group: admins
+super: [alice, bob]
+dry: true
+paranoid: false
+min-msg-len: 20
+similarity-threshold: 0.7
+`), 0o600))
+
+	parse := func(args ...string) options {
+		var opts options
+		p := newParser(&opts)
+		require.NoError(t, loadConfigFile(p, file))
+		_, err := p.ParseArgs(args)
+		require.NoError(t, err)
+		return opts
+	}
+
+	opts := parse()
+	assert.Equal(t, "tg-token", opts.Telegram.Token)
+	assert.Equal(t, "mygroup", opts.Telegram.Group)
+	assert.Equal(t, 10*time.Second, opts.Telegram.Timeout, "default overridden by file")
+	assert.Equal(t, 30*time.Second, opts.Telegram.IdleDuration, "default kept")
+	assert.True(t, opts.Server.Enabled)
+	assert.Equal(t, ":9090", opts.Server.ListenAddr)
+	assert.Equal(t, 10.0, opts.Server.Limits.RatePerIP)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.1"}, opts.Server.TrustedProxies)
+	assert.Equal(t, "admins", opts.AdminGroup)
+	assert.Equal(t, []string{"alice", "bob"}, []string(opts.SuperUsers))
+	assert.True(t, opts.Dry)
+	assert.Equal(t, 20, opts.MinMsgLen)
+	assert.Equal(t, 0.7, opts.SimilarityThreshold)
+
+	t.Setenv("SERVER_LIMITS_RATE", "5")
+	t.Setenv("TELEGRAM_GROUP", "envgroup")
+	opts = parse("--telegram.group=flaggroup", "--min-msg-len=30", "--super=carol")
+	assert.Equal(t, 5.0, opts.Server.Limits.RatePerIP, "env wins over file")
+	assert.Equal(t, "flaggroup", opts.Telegram.Group, "flag wins over env and file")
+	assert.Equal(t, 30, opts.MinMsgLen, "flag wins over file")
+	assert.Equal(t, []string{"carol"}, []string(opts.SuperUsers), "repeated flag replaces list")
+
+	t.Run("errors", func(t *testing.T) {
+		tbl := []struct {
+			name, data, err string
+		}{
+			{name: "unknown option", data: "blah: 1", err: `unknown option "blah"`},
+			{name: "unknown nested option", data: "server: {blah: 1}", err: `unknown option "server.blah"`},
+			{name: "config file itself", data: "config: other.yml", err: `unknown option "config"`},
+			{name: "empty value", data: "dry:", err: `empty value of "dry"`},
+			{name: "nested list", data: "super: [[a]]", err: `unexpected nested value of "super"`},
+			{name: "not yaml", data: "telegram: [", err: "can't parse config file"},
+			{name: "invalid int", data: "min-msg-len: abc", err: "invalid argument for flag `--min-msg-len' (expected int)"},
+			{name: "invalid duration", data: "telegram: {timeout: 10}", err: "--telegram.timeout"},
+			{name: "invalid choice", data: "files: {samples-storage: s3}", err: "Invalid value `s3'"},
+			{name: "invalid bool", data: "dry: yes", err: `invalid value "yes" of "dry"`},
+		}
+		for _, tt := range tbl {
+			t.Run(tt.name, func(t *testing.T) {
+				f := filepath.Join(t.TempDir(), "bad.yml")
+				require.NoError(t, os.WriteFile(f, []byte(tt.data), 0o600))
+				var opts options
+				err := loadConfigFile(newParser(&opts), f)
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+			})
+		}
+		var opts options
+		assert.ErrorContains(t, loadConfigFile(newParser(&opts), "/no/such/file.yml"), "can't read config file")
+	})
+
+}
+
+func Test_loadConfigFileTOML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tg-spam.toml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+super = ["alice", "bob"]
+dry = true
+min-msg-len = 20
+similarity-threshold = 0.7
+admin.group = "admins"
+
+[telegram]
+token = "tg-token"
+timeout = "10s"
+
+[server]
+enabled = true
+limits.rate = 10
+trusted-proxy = ["10.0.0.0/8"]
+`), 0o600))
+	var opts options
+	p := newParser(&opts)
+	require.NoError(t, loadConfigFile(p, file))
+	_, err := p.ParseArgs(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tg-token", opts.Telegram.Token)
+	assert.Equal(t, 10*time.Second, opts.Telegram.Timeout)
+	assert.True(t, opts.Server.Enabled)
+	assert.Equal(t, 10.0, opts.Server.Limits.RatePerIP)
+	assert.Equal(t, []string{"10.0.0.0/8"}, opts.Server.TrustedProxies)
+	assert.Equal(t, "admins", opts.AdminGroup)
+	assert.Equal(t, []string{"alice", "bob"}, []string(opts.SuperUsers))
+	assert.True(t, opts.Dry)
+	assert.Equal(t, 20, opts.MinMsgLen)
+	assert.Equal(t, 0.7, opts.SimilarityThreshold)
+
+	require.NoError(t, os.WriteFile(file, []byte("telegram = ["), 0o600))
+	assert.ErrorContains(t, loadConfigFile(newParser(&opts), file), "can't parse config file")
+}
+
+func Test_printConfig(t *testing.T) {
+	var opts options
+	p := newParser(&opts)
+	_, err := p.ParseArgs([]string{"--telegram.token=tg-token", "--telegram.group=mygroup", "--server.auth=passwd",
+		"--super=alice", "--server.limits.rate=10", "--tracing.header=Authorization: Bearer otlp-token",
+		"--redis.url=redis://:rsecret@redis:6379/0", "--denylist.peer=https://tgs_peerkey@spam.example.com"})
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, printConfig(p, &buf))
+	assert.NotContains(t, buf.String(), "tg-token")
+	assert.NotContains(t, buf.String(), "passwd")
+	assert.NotContains(t, buf.String(), "otlp-token")
+	assert.NotContains(t, buf.String(), "rsecret", "redis url with password redacted")
+	assert.NotContains(t, buf.String(), "tgs_peerkey", "denylist peer with api key redacted")
+
+	var cfg map[string]any
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &cfg))
+	telegram := cfg["telegram"].(map[string]any)
+	assert.Equal(t, redacted, telegram["token"])
+	assert.Equal(t, "mygroup", telegram["group"])
+	assert.Equal(t, "30s", telegram["timeout"], "durations as strings")
+	server := cfg["server"].(map[string]any)
+	assert.Equal(t, redacted, server["auth"])
+	assert.Equal(t, 10, server["limits"].(map[string]any)["rate"])
+	assert.Equal(t, "", server["jwt"].(map[string]any)["secret"], "empty secret not redacted")
+	assert.Equal(t, []any{"alice"}, cfg["super"])
+	assert.Equal(t, []any{redacted}, cfg["tracing"].(map[string]any)["header"], "items of secret lists redacted")
+	assert.Equal(t, []any{redacted}, cfg["denylist"].(map[string]any)["peer"])
+	assert.NotContains(t, cfg, "config")
+	assert.NotContains(t, cfg, "help")
+	assert.NotContains(t, cfg, "backup", "command options not included")
+
+	t.Run("printed config can be loaded", func(t *testing.T) {
+		f := filepath.Join(t.TempDir(), "printed.yml")
+		require.NoError(t, os.WriteFile(f, buf.Bytes(), 0o600))
+		var loaded options
+		lp := newParser(&loaded)
+		require.NoError(t, loadConfigFile(lp, f))
+		_, err := lp.ParseArgs(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "mygroup", loaded.Telegram.Group)
+		assert.Equal(t, 10.0, loaded.Server.Limits.RatePerIP)
+		assert.Equal(t, opts.Server.TrustedProxies, loaded.Server.TrustedProxies)
+		assert.Equal(t, opts.Telegram.Timeout, loaded.Telegram.Timeout)
+	})
+}
+
+func Test_runConfigCommand(t *testing.T) {
+	run := func(args ...string) (string, error) {
+		var opts options
+		p := newParser(&opts)
+		_, err := p.ParseArgs(args)
+		require.NoError(t, err)
+		buf := bytes.Buffer{}
+		err = runConfigCommand(p, opts, &buf)
+		return buf.String(), err
+	}
+
+	out, err := run("--telegram.token=tg-token", "--telegram.group=mygroup", "config", "validate")
+	require.NoError(t, err)
+	assert.Equal(t, "config is valid\n", out)
+
+	_, err = run("--telegram.token=tg-token", "config", "validate")
+	assert.ErrorContains(t, err, "telegram token and group are required")
+
+	out, err = run("--telegram.group=mygroup", "config", "print")
+	require.NoError(t, err)
+	assert.Contains(t, out, "group: mygroup")
+}
+
+func Test_validateConfig(t *testing.T) {
+	valid := func() options {
+		var opts options
+		_, err := newParser(&opts).ParseArgs([]string{"--telegram.token=t", "--telegram.group=g"})
+		require.NoError(t, err)
+		return opts
+	}
+	require.NoError(t, validateConfig(valid()))
+
+	opts := valid()
+	opts.Telegram.Token = ""
+	opts.Server.TLS.Cert = "cert.pem"
+	opts.Storage.Retention = "abc"
+	opts.Logger.Enabled, opts.Logger.MaxSize = true, "big"
+	opts.Server.AccessLog, opts.Server.AccessLogMaxSize = "access.log", ""
+	opts.Server.TrustedProxies = []string{"bad"}
+	opts.Storage.EncryptionKey, opts.Storage.EncryptionFile = "key", "key.txt"
+	err := validateConfig(opts)
+	require.Error(t, err)
+	for _, msg := range []string{"telegram token and group are required", "both tls certificate and key files should be set",
+		"invalid storage retention", "invalid logger max size", "invalid access log max size", "invalid trusted proxies",
+		"both encryption key and key file set"} {
+		assert.Contains(t, err.Error(), msg)
+	}
+
+	opts = valid()
+	opts.Telegram.Token, opts.Server.Enabled = "", true
+	assert.NoError(t, validateConfig(opts), "telegram not required in server only mode")
+	opts = valid()
+	opts.Logger.Enabled, opts.Logger.Sink = true, "http"
+	assert.ErrorContains(t, validateConfig(opts), "logger url is required for http sink")
+	opts.Logger.Sink, opts.Logger.SyslogAddr = "syslog", "ftp://localhost"
+	assert.ErrorContains(t, validateConfig(opts), "network should be udp, tcp, unix or unixgram")
+	opts = valid()
+	opts.Join.Check, opts.CAS.API = true, ""
+	assert.ErrorContains(t, validateConfig(opts), "join check requires cas or lols.bot api")
+	opts.Lols.API = "https://api.lols.bot"
+	assert.NoError(t, validateConfig(opts))
+	opts.Join.Check, opts.Join.Ban = false, true
+	assert.ErrorContains(t, validateConfig(opts), "join ban requires join check")
+	opts = valid()
+	opts.HamSampler.Rate = 0.01
+	assert.NoError(t, validateConfig(opts))
+	opts.HamSampler.Rate = 1.5
+	assert.ErrorContains(t, validateConfig(opts), "invalid ham sampler rate 1.5, should be 0-1")
+
+	opts = valid()
+	opts.SimilarityCategory = []string{"crypto:0.3", "job-scam:0.8:report"}
+	assert.NoError(t, validateConfig(opts))
+	opts.SimilarityCategory = []string{"crypto:0.3:ban"}
+	assert.ErrorContains(t, validateConfig(opts), `invalid action of similarity category "crypto:0.3:ban"`)
+
+	opts = valid()
+	opts.OpenAI.Category = []string{"scam:80", "off-topic:70:warn"}
+	assert.NoError(t, validateConfig(opts))
+	opts.OpenAI.Category = []string{"scam:80:ban"}
+	assert.ErrorContains(t, validateConfig(opts), `invalid action of openai category "scam:80:ban"`)
+
+	opts = valid()
+	opts.Checks.BuiltinScams, opts.Checks.ScamsInterval = true, time.Hour
+	opts.Checks.ScamsFeed, opts.Checks.ScamsKey = "https://example.com/scams.json", "O2onvM62pC1io6jQKm8Nc2UyFXcd4kOmOsBIoYtZ2ik="
+	assert.NoError(t, validateConfig(opts))
+	opts.Checks.BuiltinScams, opts.Checks.ScamsKey = false, "bad"
+	err = validateConfig(opts)
+	assert.ErrorContains(t, err, "scams feed requires builtin scams")
+	assert.ErrorContains(t, err, "invalid public key of scams feed")
+
+	opts = valid()
+	opts.Activity.Timezone, opts.Activity.Hours, opts.Activity.Boost = "Europe/Berlin", "08-23", 10
+	assert.NoError(t, validateConfig(opts))
+	opts.Activity.Timezone, opts.Activity.Hours, opts.Activity.Boost = "Mars/Olympus", "8-25", 200
+	err = validateConfig(opts)
+	assert.ErrorContains(t, err, "invalid activity boost 200, should be 0-100")
+	assert.ErrorContains(t, err, `invalid activity timezone "Mars/Olympus"`)
+	opts.Activity.Timezone, opts.Activity.Boost = "UTC", 10
+	assert.ErrorContains(t, validateConfig(opts), `invalid activity hours "8-25"`)
+	opts.Activity.Hours, opts.ParanoidMode = "08-23", true
+	assert.ErrorContains(t, validateConfig(opts), "activity boost requires new users tracking")
+
+	opts = valid()
+	opts.CheckBudget = 2 * time.Second
+	assert.NoError(t, validateConfig(opts))
+	opts.CheckBudget = -time.Second
+	assert.ErrorContains(t, validateConfig(opts), "invalid check budget -1s, should be 0 or positive")
+
+	opts = valid()
+	opts.MaxMsgLen = -1
+	assert.ErrorContains(t, validateConfig(opts), "invalid max message length -1, should be 0 or positive")
+
+	opts = valid()
+	opts.LowMemory = true
+	assert.NoError(t, validateConfig(opts))
+	opts.SimilarityCategory = []string{"crypto:0.3"}
+	assert.ErrorContains(t, validateConfig(opts), "similarity categories can't be used in low memory mode")
+
+	opts = valid()
+	opts.OpenAI.ContextMessages = -1
+	assert.ErrorContains(t, validateConfig(opts), "invalid openai context messages -1, should be 0 or positive")
+
+	opts = valid()
+	opts.Denylist.Peers = []string{"https://tgs_key@spam.example.com"}
+	assert.ErrorContains(t, validateConfig(opts), "denylist peers require denylist enabled")
+	opts.Denylist.Enabled = true
+	assert.NoError(t, validateConfig(opts))
+	opts.Denylist.Peers = append(opts.Denylist.Peers, "https://spam.example.com")
+	assert.ErrorContains(t, validateConfig(opts), "no api key in denylist peer url https://spam.example.com")
+
+	opts = valid()
+	opts.Consensus.URL, opts.Consensus.Confidence, opts.Consensus.Timeout = "https://tgs_key@spam.example.com", 90, time.Second
+	assert.NoError(t, validateConfig(opts))
+	opts.Consensus.URL, opts.Consensus.Confidence, opts.Consensus.Timeout = "https://spam.example.com", 120, 0
+	err = validateConfig(opts)
+	assert.ErrorContains(t, err, "no api key in consensus url https://spam.example.com")
+	assert.ErrorContains(t, err, "invalid consensus confidence 120, should be 0-100")
+	assert.ErrorContains(t, err, "invalid consensus timeout 0s, should be positive")
+
+	opts = valid()
+	opts.ClassifierSmoothing = -1
+	assert.ErrorContains(t, validateConfig(opts), "invalid classifier smoothing -1, should be 0 or positive")
+
+	opts = valid()
+	opts.HamVetoMargin = 1.5
+	assert.ErrorContains(t, validateConfig(opts), "invalid ham veto margin 1.50, should be 0-1")
+
+	opts = valid()
+	opts.Greeting.Restrict = 10 * time.Second
+	assert.ErrorContains(t, validateConfig(opts), "invalid newcomer restriction 10s, should be 30s-366d or 0")
+	opts.Greeting.Restrict, opts.Greeting.TTL = 24*time.Hour, -time.Second
+	assert.ErrorContains(t, validateConfig(opts), "invalid greeting ttl -1s, should be 0 or positive")
+
+	opts = valid()
+	opts.OpenAI.Check, opts.OpenAI.Override, opts.OpenAI.MinConfidence = []string{"spam"}, []string{"rescue"}, 80
+	assert.NoError(t, validateConfig(opts))
+	opts.OpenAI.Veto = true
+	assert.ErrorContains(t, validateConfig(opts), "openai veto can't be used with openai check")
+	opts.OpenAI.Veto, opts.OpenAI.MinConfidence = false, 101
+	assert.ErrorContains(t, validateConfig(opts), "invalid openai min confidence 101, should be 0-100")
+	opts.OpenAI.Check, opts.OpenAI.MinConfidence = nil, 0
+	assert.ErrorContains(t, validateConfig(opts), "openai override and min confidence require openai check")
+
+	opts = valid()
+	opts.OpenAI.Prompt = "spam in {{.Topic}} group"
+	assert.NoError(t, validateConfig(opts))
+	opts.OpenAI.Prompt = "spam in {{.Topic group"
+	assert.ErrorContains(t, validateConfig(opts), "can't parse openai prompt template")
+	opts.OpenAI.Prompt, opts.OpenAI.PromptFile = "", "/no/such/prompt.txt"
+	assert.ErrorContains(t, validateConfig(opts), "can't read openai prompt file")
+
+	opts = valid()
+	opts.Schedule.Rules, opts.Schedule.Timezone = []string{`night|* 0-6 * * *|{"min_spam_probability": 40}`}, "Europe/Berlin"
+	assert.NoError(t, validateConfig(opts))
+	opts.Schedule.Timezone = "Mars/Olympus"
+	assert.ErrorContains(t, validateConfig(opts), `invalid schedule timezone "Mars/Olympus"`)
+	opts.Schedule.Timezone, opts.Schedule.Rules = "UTC", []string{`night|* 25 * * *|{"min_spam_probability": 40}`}
+	assert.ErrorContains(t, validateConfig(opts), "invalid schedule rule")
+}
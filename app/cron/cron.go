@@ -0,0 +1,125 @@
+// Package cron matches time with cron-like expressions of five fields: minute, hour, day of month, month
+// and day of week, i.e. "* 0-6 * * *" matches every minute from midnight till 7am. Each field is "*",
+// a value, a range "1-5", a step "*/15" or "1-30/5", or a comma separated list of them. Days of week
+// are 0-6 from Sunday, 7 is Sunday as well. If both days of month and week are restricted, the time matches
+// either of them, as in cron.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	expr   string
+	minute uint64 // bit set of matched values of each field
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDom bool // day of month is not restricted, "*"
+	anyDow bool // day of week is not restricted, "*"
+}
+
+// field is a range of values of the field of expression
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+// Parse parses cron expression of five fields
+func Parse(expr string) (Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q, expected 5 fields: minute hour day month weekday", expr)
+	}
+	res := Schedule{expr: strings.Join(parts, " "), anyDom: parts[2] == "*", anyDow: parts[4] == "*"}
+	sets := []*uint64{&res.minute, &res.hour, &res.dom, &res.month, &res.dow}
+	for i, p := range parts {
+		set, err := parseField(p, fields[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid cron expression %q, %w", expr, err)
+		}
+		*sets[i] = set
+	}
+	if res.dow&(1<<7) != 0 {
+		res.dow |= 1 // 7 is Sunday
+	}
+	return res, nil
+}
+
+// Match returns true if the time, truncated to minute, matches the schedule
+func (s Schedule) Match(t time.Time) bool {
+	has := func(set uint64, v int) bool { return set&(1<<uint(v)) != 0 }
+	if !has(s.minute, t.Minute()) || !has(s.hour, t.Hour()) || !has(s.month, int(t.Month())) {
+		return false
+	}
+	domMatch, dowMatch := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.anyDom || s.anyDow {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// String returns the expression of the schedule
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// parseField parses comma separated list of values, ranges and steps of the field to bit set of values
+func parseField(s string, f field) (uint64, error) {
+	var res uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			v, err := strconv.Atoi(stepStr)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid step %q of %s", stepStr, f.name)
+			}
+			step = v
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			loStr, hiStr, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(loStr, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(hiStr, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q of %s", rng, f.name)
+			}
+		default:
+			v, err := parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max // "5/15" is "5-max/15"
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			res |= 1 << uint(v)
+		}
+	}
+	return res, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
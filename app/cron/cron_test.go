@@ -0,0 +1,68 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule_Match(t *testing.T) {
+	// 2024-05-04 is Saturday
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 5, day, hour, minute, 30, 0, time.UTC) }
+	tbl := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", at(4, 12, 0), true},
+		{"* 0-6 * * *", at(4, 3, 15), true},
+		{"* 0-6 * * *", at(4, 7, 0), false},
+		{"* 22,23,0-5 * * *", at(4, 23, 59), true},
+		{"*/15 * * * *", at(4, 10, 45), true},
+		{"*/15 * * * *", at(4, 10, 46), false},
+		{"5/20 * * * *", at(4, 10, 25), true},
+		{"0-30/10 9 * * *", at(4, 9, 20), true},
+		{"0-30/10 9 * * *", at(4, 9, 40), false},
+		{"* * * * 6", at(4, 1, 1), true},
+		{"* * * * 0,6", at(5, 1, 1), true},
+		{"* * * * 7", at(5, 1, 1), true},
+		{"* * * * 1-5", at(4, 1, 1), false},
+		{"* * 1 * *", at(1, 1, 1), true},
+		{"* * 1 * 6", at(4, 1, 1), true},  // either day of month or day of week
+		{"* * 1 * 1", at(4, 1, 1), false}, // neither
+		{"* * * 6 *", at(4, 1, 1), false},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Match(tt.t), tt.t)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse("  0   22 *  * 1-5 ")
+	require.NoError(t, err)
+	assert.Equal(t, "0 22 * * 1-5", s.String())
+
+	tbl := []struct{ expr, err string }{
+		{"* * * *", "expected 5 fields"},
+		{"60 * * * *", `invalid minute "60", expected 0-59`},
+		{"* 24 * * *", `invalid hour "24", expected 0-23`},
+		{"* * 0 * *", `invalid day of month "0", expected 1-31`},
+		{"* * * 13 *", `invalid month "13", expected 1-12`},
+		{"* * * * 8", `invalid day of week "8", expected 0-7`},
+		{"*/0 * * * *", `invalid step "0" of minute`},
+		{"10-5 * * * *", `invalid range "10-5" of minute`},
+		{"a * * * *", `invalid minute "a"`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/go-pkgz/rest"
+)
+
+// startTime is the time the process started, reported as uptime by the debug server
+var startTime = time.Now()
+
+// runDebugServer serves pprof profiles on /debug/pprof/ and runtime metrics on /debug/runtime, till the context is
+// canceled. It runs on a separate listener, not exposed with the web server, as profiles reveal internals of the
+// process. /debug/pprof/cmdline is not served, as command line arguments can contain tokens and passwords.
+func runDebugServer(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: debugRouter(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("[WARN] debug server shutdown error, %v", err)
+		}
+	}()
+	log.Printf("[INFO] debug server listening on %s, pprof on /debug/pprof/, runtime metrics on /debug/runtime", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("debug server failed, %w", err)
+	}
+	return nil
+}
+
+func debugRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/debug/pprof/cmdline" {
+			http.NotFound(w, r)
+			return
+		}
+		pprof.Index(w, r) // named profiles, i.e. heap, goroutine and allocs, and the index page
+	})
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/runtime", func(w http.ResponseWriter, _ *http.Request) {
+		rest.RenderJSON(w, runtimeMetrics())
+	})
+	return mux
+}
+
+// runtimeMetrics returns goroutines, memory and gc metrics of the process, memory is in bytes
+func runtimeMetrics() rest.JSON {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return rest.JSON{
+		"uptime":        time.Since(startTime).Round(time.Second).String(),
+		"goroutines":    runtime.NumGoroutine(),
+		"heap_alloc":    ms.HeapAlloc,
+		"heap_inuse":    ms.HeapInuse,
+		"heap_objects":  ms.HeapObjects,
+		"heap_released": ms.HeapReleased,
+		"sys":           ms.Sys,
+		"total_alloc":   ms.TotalAlloc,
+		"num_gc":        ms.NumGC,
+		"gc_pause_last": time.Duration(ms.PauseNs[(ms.NumGC+255)%256]).String(),
+		"go_version":    runtime.Version(),
+	}
+}
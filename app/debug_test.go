@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_debugRouter(t *testing.T) {
+	ts := httptest.NewServer(debugRouter())
+	defer ts.Close()
+
+	t.Run("runtime metrics", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/debug/runtime")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Greater(t, res["goroutines"], float64(0))
+		assert.Greater(t, res["heap_alloc"], float64(0))
+		assert.Contains(t, res, "num_gc")
+		assert.Contains(t, res, "uptime")
+	})
+
+	t.Run("pprof", func(t *testing.T) {
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/heap?debug=1"} {
+			resp, err := http.Get(ts.URL + path)
+			require.NoError(t, err)
+			_, err = io.Copy(io.Discard, resp.Body)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		}
+	})
+
+	t.Run("no cmdline", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/debug/pprof/cmdline")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "args can contain secrets")
+	})
+}
+
+func Test_runDebugServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runDebugServer(ctx, "127.0.0.1:9878") }()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://127.0.0.1:9878/debug/runtime")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("debug server not stopped")
+	}
+
+	assert.Error(t, runDebugServer(context.Background(), "bad-addr"), "listen failed")
+}
@@ -0,0 +1,182 @@
+// Package denylist syncs denylist of confirmed spammers and hashes of their messages between tg-spam instances.
+// Each instance exports its local entries with GET /denylist of the web server, protected by api key with
+// denylist scope, and imports entries of peers, polling them periodically. A ban in one community protects
+// others after the next poll. Unbans are exported as removed entries and remove imported ones.
+package denylist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+const (
+	pageSize        = 1000                // max number of entries requested from the peer at once, as limited by the peer
+	maxPages        = 100                 // max number of pages requested from the peer in one sync
+	maxFeedSize     = 10 * 1024 * 1024    // max size of the feed response
+	feedPath        = "/denylist"         // path of the feed of local entries of the peer
+	feedTimeout     = 30 * time.Second    // timeout of feed request, if http client is not set
+	defaultTTL      = 30 * 24 * time.Hour // expiration of imported entries, if ttl is not set
+	defaultInterval = time.Minute         // interval of polling peers, if not set
+)
+
+// Store is a denylist storage of imported entries
+type Store interface {
+	Import(source string, entries []storage.DenylistEntry) (count int, err error)
+	Synced(source string) (time.Time, error)
+	Expire(ttl time.Duration) (int64, error)
+}
+
+// Peer is another tg-spam instance sharing its denylist
+type Peer struct {
+	URL string // base url of the web server of the peer, imported entries are marked with it
+	Key string // api key issued by the peer, with denylist scope
+}
+
+// ParsePeer parses the peer from url with the api key as user, i.e. "https://tgs_key@spam.example.com"
+func ParsePeer(s string) (Peer, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Peer{}, fmt.Errorf("invalid denylist peer url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return Peer{}, fmt.Errorf("invalid denylist peer url %s, expected http(s)://key@host", u.Redacted())
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return Peer{}, fmt.Errorf("no api key in denylist peer url %s, expected http(s)://key@host", u.Redacted())
+	}
+	key := u.User.Username()
+	u.User = nil
+	return Peer{URL: strings.TrimSuffix(u.String(), "/"), Key: key}, nil
+}
+
+// Syncer imports entries of peers to the store periodically, and expires imported entries
+type Syncer struct {
+	Store    Store
+	Peers    []Peer
+	Interval time.Duration // interval of polling peers, 1m if not set
+	TTL      time.Duration // imported entries expire after ttl, older entries are not requested, 30 days if not set
+	Client   *http.Client  // http client with 30s timeout if not set
+}
+
+// Run syncs with peers on start and every interval, till context is canceled
+func (s *Syncer) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	log.Printf("[INFO] denylist sync with %d peers every %v", len(s.Peers), interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil {
+			log.Printf("[WARN] denylist sync failed, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("[DEBUG] denylist sync stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync imports new entries of all peers and expires old ones. A failed peer doesn't stop sync with others.
+func (s *Syncer) Sync(ctx context.Context) error {
+	errs := new(multierror.Error)
+	for _, p := range s.Peers {
+		count, err := s.syncPeer(ctx, p)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to sync with %s: %w", p.URL, err))
+		}
+		if count > 0 {
+			log.Printf("[INFO] denylist synced with %s, %d entries changed", p.URL, count)
+		}
+	}
+	expired, err := s.Store.Expire(s.ttl())
+	if err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if expired > 0 {
+		log.Printf("[DEBUG] %d denylist entries expired", expired)
+	}
+	return errs.ErrorOrNil()
+}
+
+// syncPeer requests entries of the peer changed since the last sync, page by page, and imports them.
+// The last sync time is the latest imported entry, limited by ttl, so expired entries are not requested again.
+func (s *Syncer) syncPeer(ctx context.Context, p Peer) (count int, err error) {
+	since, err := s.Store.Synced(p.URL)
+	if err != nil {
+		return 0, err
+	}
+	if oldest := time.Now().Add(-s.ttl()); since.Before(oldest) {
+		since = oldest
+	}
+	for i := 0; i < maxPages; i++ {
+		entries, err := s.fetch(ctx, p, since)
+		if err != nil {
+			return count, err
+		}
+		n, err := s.Store.Import(p.URL, entries)
+		if err != nil {
+			return count, err
+		}
+		count += n
+		if len(entries) < pageSize || !entries[len(entries)-1].Timestamp.After(since) {
+			return count, nil // last page, or the page of entries with the same time
+		}
+		since = entries[len(entries)-1].Timestamp
+	}
+	return count, nil
+}
+
+// fetch requests the page of entries of the peer changed since the time
+func (s *Syncer) fetch(ctx context.Context, p Peer, since time.Time) ([]storage.DenylistEntry, error) {
+	params := url.Values{"since": {since.UTC().Format(time.RFC3339Nano)}, "limit": {fmt.Sprint(pageSize)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL+feedPath+"?"+params.Encode(), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.Key)
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: feedTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request denylist: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var feed struct {
+		Entries []storage.DenylistEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxFeedSize)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to decode denylist: %w", err)
+	}
+	if len(feed.Entries) > pageSize {
+		return nil, errors.New("too many entries in denylist response")
+	}
+	return feed.Entries, nil
+}
+
+func (s *Syncer) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return defaultTTL
+	}
+	return s.TTL
+}
@@ -0,0 +1,116 @@
+package denylist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func TestParsePeer(t *testing.T) {
+	tbl := []struct {
+		in  string
+		exp Peer
+		err string
+	}{
+		{in: "https://tgs_key@spam.example.com", exp: Peer{URL: "https://spam.example.com", Key: "tgs_key"}},
+		{in: "http://tgs_key@127.0.0.1:8080/tg-spam/", exp: Peer{URL: "http://127.0.0.1:8080/tg-spam", Key: "tgs_key"}},
+		{in: "https://spam.example.com", err: "no api key in denylist peer url https://spam.example.com"},
+		{in: "ftp://key@spam.example.com", err: "invalid denylist peer url ftp://key@spam.example.com"},
+		{in: "spam.example.com", err: "invalid denylist peer url spam.example.com"},
+		{in: "https://key@spam example.com", err: "invalid denylist peer url"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.in, func(t *testing.T) {
+			res, err := ParsePeer(tt.in)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, res)
+		})
+	}
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	peerDB, err := storage.NewSqliteDB(filepath.Join(t.TempDir(), "peer.db"))
+	require.NoError(t, err)
+	defer peerDB.Close()
+	peerStore, err := storage.NewDenylist(peerDB)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/denylist" || r.Header.Get("Authorization") != "Bearer tgs_peer" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+		require.NoError(t, err)
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		require.NoError(t, err)
+		entries, err := peerStore.Local(since, limit)
+		require.NoError(t, err)
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"entries": entries, "count": len(entries)}))
+	}))
+	defer ts.Close()
+
+	db, err := storage.NewSqliteDB(filepath.Join(t.TempDir(), "local.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := storage.NewDenylist(db)
+	require.NoError(t, err)
+
+	syncer := Syncer{Store: store, Peers: []Peer{{URL: ts.URL, Key: "tgs_peer"}}, TTL: time.Hour}
+	require.NoError(t, syncer.Sync(context.Background()))
+	_, ok := store.Check(1, "")
+	assert.False(t, ok)
+
+	spam := "earn 1000$ a day, write me in private messages"
+	require.NoError(t, peerStore.Add(1, spam))
+	require.NoError(t, syncer.Sync(context.Background()))
+	entry, ok := store.Check(1, "")
+	require.True(t, ok, "banned user imported")
+	assert.Equal(t, ts.URL, entry.Source)
+	entry, ok = store.Check(2, spam)
+	require.True(t, ok, "spam message imported")
+	assert.Equal(t, storage.DenylistHash, entry.Kind)
+
+	time.Sleep(time.Millisecond) // unban is after the ban
+	require.NoError(t, peerStore.Remove(1))
+	require.NoError(t, syncer.Sync(context.Background()))
+	_, ok = store.Check(1, "")
+	assert.False(t, ok, "unbanned user removed")
+	_, ok = store.Check(2, spam)
+	assert.False(t, ok, "message of unbanned user removed")
+
+	t.Run("failed peer", func(t *testing.T) {
+		requests.Store(0)
+		syncer := Syncer{Store: store, Peers: []Peer{{URL: ts.URL, Key: "bad"}, {URL: ts.URL, Key: "tgs_peer"}}}
+		err := syncer.Sync(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to sync with "+ts.URL+": unexpected status 403")
+		assert.Equal(t, int32(2), requests.Load(), "other peer synced")
+	})
+
+	t.Run("run", func(t *testing.T) {
+		requests.Store(0)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		syncer := Syncer{Store: store, Peers: []Peer{{URL: ts.URL, Key: "tgs_peer"}}, Interval: 10 * time.Millisecond}
+		syncer.Run(ctx)
+		assert.Greater(t, requests.Load(), int32(2))
+	})
+}
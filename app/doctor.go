@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/umputun/tg-spam/app/events"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// doctorResult is a result of a doctor check, err is nil if the check passed or skipped
+type doctorResult struct {
+	name    string
+	info    string // details of the passed or skipped check
+	err     error  // error with a hint how to fix it
+	skipped bool   // check not applicable to the configuration
+}
+
+// openAIModels is a subset of openai client used to check the token and the model
+type openAIModels interface {
+	GetModel(ctx context.Context, modelID string) (openai.Model, error)
+}
+
+// doctorTimeout limits each of the network checks of doctor
+const doctorTimeout = 10 * time.Second
+
+// runDoctor checks the configuration, access to telegram, CAS and OpenAI, samples files and the database,
+// and prints results of all checks to out. Returns error if any of the checks failed.
+func runDoctor(ctx context.Context, opts options, out io.Writer) error {
+	newTelegramAPI := func(token string) (events.TbAPI, error) {
+		opts.Telegram.Token = token
+		return makeTelegramAPI(opts)
+	}
+	results := []doctorResult{doctorConfig(opts)}
+	results = append(results, doctorTelegram(opts, newTelegramAPI)...)
+	results = append(results, doctorCAS(ctx, opts.CAS.API, makeHTTPClient(opts.CAS.Timeout, opts.CAS.Proxy)))
+	if opts.Lols.API != "" {
+		results = append(results, doctorLols(ctx, opts.Lols.API, makeHTTPClient(opts.CAS.Timeout, opts.CAS.Proxy)))
+	}
+	var models openAIModels
+	if opts.OpenAI.Token != "" {
+		openAIClientConfig := openai.DefaultConfig(opts.OpenAI.Token)
+		openAIClientConfig.HTTPClient = makeHTTPClient(0, opts.OpenAI.Proxy)
+		models = openai.NewClientWithConfig(openAIClientConfig)
+	}
+	results = append(results, doctorOpenAI(ctx, models, opts.OpenAI.Model))
+	results = append(results, doctorFiles(opts)...)
+	results = append(results, doctorDatabase(opts))
+
+	failed := 0
+	for _, r := range results {
+		status, details := "ok", r.info
+		switch {
+		case r.err != nil:
+			status, details = "FAIL", r.err.Error()
+			failed++
+		case r.skipped:
+			status = "skip"
+		}
+		line := fmt.Sprintf("%-5s %s", status, r.name)
+		if details != "" {
+			line += ": " + details
+		}
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	_, err := fmt.Fprintf(out, "all %d checks passed\n", len(results))
+	return err
+}
+
+// doctorConfig validates the configuration, all problems are reported in a single line
+func doctorConfig(opts options) doctorResult {
+	err := validateConfig(opts)
+	merr := &multierror.Error{}
+	if errors.As(err, &merr) {
+		merr.ErrorFormat = func(errs []error) string {
+			msgs := make([]string, 0, len(errs))
+			for _, e := range errs {
+				msgs = append(msgs, e.Error())
+			}
+			return strings.Join(msgs, "; ")
+		}
+	}
+	return doctorResult{name: "config", err: err}
+}
+
+// doctorTelegram checks the token, resolution of the groups and permissions of the bot in the primary group
+func doctorTelegram(opts options, newAPI func(token string) (events.TbAPI, error)) []doctorResult {
+	if opts.Telegram.Token == "" || opts.Telegram.Group == "" {
+		return []doctorResult{{name: "telegram", info: "token or group not set", skipped: true}}
+	}
+	api, err := newAPI(opts.Telegram.Token)
+	if err != nil {
+		return []doctorResult{{name: "telegram token",
+			err: fmt.Errorf("can't connect to telegram, check the token given by @BotFather: %w", err)}}
+	}
+	listener := events.TelegramListener{TbAPI: api, Group: opts.Telegram.Group, AdminGroup: opts.AdminGroup}
+	res := []doctorResult{}
+	for _, d := range listener.Diagnose() {
+		res = append(res, doctorResult{name: d.Name, info: d.Info, err: d.Err})
+	}
+	return res
+}
+
+// doctorCAS checks CAS api is reachable, skipped if CAS disabled
+func doctorCAS(ctx context.Context, api string, client *http.Client) doctorResult {
+	res := doctorResult{name: "cas " + api}
+	if api == "" {
+		return doctorResult{name: "cas", info: "disabled", skipped: true}
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(api, "/")+"/check?user_id=1", http.NoBody)
+	if err != nil {
+		res.err = fmt.Errorf("invalid CAS api url, check --cas.api: %w", err)
+		return res
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		res.err = fmt.Errorf("CAS api not reachable, check network access or disable CAS with empty --cas.api: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res.err = fmt.Errorf("CAS api responded with status %d, check --cas.api", resp.StatusCode)
+		return res
+	}
+	res.info = "reachable"
+	return res
+}
+
+// doctorLols checks lols.bot api is reachable
+func doctorLols(ctx context.Context, api string, client *http.Client) doctorResult {
+	res := doctorResult{name: "lols " + api}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(api, "/")+"/account?id=1", http.NoBody)
+	if err != nil {
+		res.err = fmt.Errorf("invalid lols.bot api url, check --lols.api: %w", err)
+		return res
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		res.err = fmt.Errorf("lols.bot api not reachable, check network access or disable it with empty --lols.api: %w", err)
+		return res
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		res.err = fmt.Errorf("lols.bot api responded with status %d, check --lols.api", resp.StatusCode)
+		return res
+	}
+	res.info = "reachable"
+	return res
+}
+
+// doctorOpenAI checks the token and availability of the model, skipped if OpenAI is not enabled
+func doctorOpenAI(ctx context.Context, models openAIModels, model string) doctorResult {
+	if models == nil {
+		return doctorResult{name: "openai", info: "disabled", skipped: true}
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	if _, err := models.GetModel(ctx, model); err != nil {
+		return doctorResult{name: "openai", err: fmt.Errorf("can't get model %q, check --openai.token and --openai.model: %w", model, err)}
+	}
+	return doctorResult{name: "openai", info: fmt.Sprintf("model %s available", model)}
+}
+
+// doctorFiles checks samples files can be read and dynamic data directory can be written
+func doctorFiles(opts options) []doctorResult {
+	res := []doctorResult{}
+	for _, name := range []string{samplesSpamFile, samplesHamFile} {
+		file := filepath.Join(opts.Files.SamplesDataPath, name)
+		r := doctorResult{name: "samples " + file}
+		fh, err := os.Open(file) //nolint:gosec // file from options
+		switch {
+		case err != nil && opts.Files.SamplesStorage == "db":
+			r.info, r.skipped = "not used, samples stored in the database", true
+		case err != nil:
+			r.err = fmt.Errorf("can't read samples, check --files.samples and permissions of the file: %w", err)
+		default:
+			r.info = "readable"
+			_ = fh.Close()
+		}
+		res = append(res, r)
+	}
+
+	dir := opts.Files.DynamicDataPath
+	r := doctorResult{name: "dynamic data " + dir}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		r.info = "doesn't exist yet, created on start"
+		return append(res, r)
+	}
+	fh, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		r.err = fmt.Errorf("can't write to dynamic data directory, check --files.dynamic and its permissions: %w", err)
+		return append(res, r)
+	}
+	_ = fh.Close()
+	_ = os.Remove(fh.Name())
+	r.info = "writable"
+	return append(res, r)
+}
+
+// doctorDatabase checks integrity of the data database, if created already
+func doctorDatabase(opts options) doctorResult {
+	file := filepath.Join(opts.Files.DynamicDataPath, dataFile)
+	res := doctorResult{name: "database " + file}
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		res.info = "doesn't exist yet, created on start"
+		return res
+	}
+	db, err := storage.NewSqliteDB(file)
+	if err != nil {
+		res.err = fmt.Errorf("can't open database, check permissions of the file: %w", err)
+		return res
+	}
+	defer db.Close()
+	var problems []string
+	if err = db.Select(&problems, "PRAGMA integrity_check"); err != nil {
+		res.err = fmt.Errorf("can't check integrity of the database, restore it from backup: %w", err)
+		return res
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		res.err = fmt.Errorf("database is damaged, restore it from backup: %s", strings.Join(problems, "; "))
+		return res
+	}
+	res.info = "integrity ok"
+	return res
+}
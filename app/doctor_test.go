@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func Test_runDoctor(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte("spam\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte("ham\n"), 0o600))
+
+	opts, _, err := loadOptions([]string{"--files.samples=" + tmpDir, "--files.dynamic=" + tmpDir, "--cas.api=",
+		"--server.enabled", "doctor"})
+	require.NoError(t, err)
+	out := bytes.Buffer{}
+	require.NoError(t, runDoctor(context.Background(), opts, &out))
+	assert.Equal(t, "ok    config\n"+
+		"skip  telegram: token or group not set\n"+
+		"skip  cas: disabled\n"+
+		"skip  openai: disabled\n"+
+		"ok    samples "+filepath.Join(tmpDir, samplesSpamFile)+": readable\n"+
+		"ok    samples "+filepath.Join(tmpDir, samplesHamFile)+": readable\n"+
+		"ok    dynamic data "+tmpDir+": writable\n"+
+		"ok    database "+filepath.Join(tmpDir, dataFile)+": doesn't exist yet, created on start\n"+
+		"all 8 checks passed\n", out.String())
+
+	opts.Server.Enabled = false
+	out.Reset()
+	err = runDoctor(context.Background(), opts, &out)
+	require.EqualError(t, err, "1 of 8 checks failed")
+	assert.Contains(t, out.String(), "FAIL  config: telegram token and group are required\n")
+}
+
+func Test_doctorTelegram(t *testing.T) {
+	opts := options{}
+	opts.Telegram.Token, opts.Telegram.Group = "token", "123"
+
+	t.Run("passed", func(t *testing.T) {
+		newAPI := func(token string) (events.TbAPI, error) {
+			assert.Equal(t, "token", token)
+			return &mocks.TbAPIMock{
+				GetMeFunc:   func() (tbapi.User, error) { return tbapi.User{ID: 42, UserName: "spam_bot"}, nil },
+				GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: config.ChatID}, nil },
+				GetChatMemberFunc: func(tbapi.GetChatMemberConfig) (tbapi.ChatMember, error) {
+					return tbapi.ChatMember{Status: "administrator", CanDeleteMessages: true, CanRestrictMembers: true}, nil
+				},
+			}, nil
+		}
+		res := doctorTelegram(opts, newAPI)
+		assert.Equal(t, []doctorResult{
+			{name: "telegram token", info: "bot @spam_bot (42)"},
+			{name: "group 123", info: "chat id 123"},
+			{name: "bot permissions", info: "can delete messages and ban users"},
+		}, res)
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		newAPI := func(string) (events.TbAPI, error) { return nil, errors.New("Not Found") }
+		res := doctorTelegram(opts, newAPI)
+		require.Len(t, res, 1)
+		assert.EqualError(t, res[0].err, "can't connect to telegram, check the token given by @BotFather: Not Found")
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		res := doctorTelegram(options{}, nil)
+		assert.Equal(t, []doctorResult{{name: "telegram", info: "token or group not set", skipped: true}}, res)
+	})
+}
+
+func Test_doctorCAS(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/check", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("user_id"))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	res := doctorCAS(context.Background(), ts.URL, &http.Client{Timeout: time.Second})
+	assert.Equal(t, doctorResult{name: "cas " + ts.URL, info: "reachable"}, res)
+
+	status = http.StatusBadGateway
+	res = doctorCAS(context.Background(), ts.URL, &http.Client{Timeout: time.Second})
+	assert.EqualError(t, res.err, "CAS api responded with status 502, check --cas.api")
+
+	res = doctorCAS(context.Background(), "", &http.Client{Timeout: time.Second})
+	assert.True(t, res.skipped)
+	assert.NoError(t, res.err)
+}
+
+func Test_doctorLols(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/account", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("id"))
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	res := doctorLols(context.Background(), ts.URL, &http.Client{Timeout: time.Second})
+	assert.Equal(t, doctorResult{name: "lols " + ts.URL, info: "reachable"}, res)
+
+	status = http.StatusBadGateway
+	res = doctorLols(context.Background(), ts.URL, &http.Client{Timeout: time.Second})
+	assert.EqualError(t, res.err, "lols.bot api responded with status 502, check --lols.api")
+}
+
+func Test_doctorOpenAI(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models/gpt-4o" || r.Header.Get("Authorization") != "Bearer good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"gpt-4o","object":"model"}`))
+	}))
+	defer ts.Close()
+	client := func(token string) *openai.Client {
+		cfg := openai.DefaultConfig(token)
+		cfg.BaseURL = ts.URL + "/v1"
+		return openai.NewClientWithConfig(cfg)
+	}
+
+	res := doctorOpenAI(context.Background(), client("good"), "gpt-4o")
+	assert.Equal(t, doctorResult{name: "openai", info: "model gpt-4o available"}, res)
+
+	res = doctorOpenAI(context.Background(), client("bad"), "gpt-4o")
+	require.Error(t, res.err)
+	assert.Contains(t, res.err.Error(), `can't get model "gpt-4o", check --openai.token and --openai.model`)
+
+	res = doctorOpenAI(context.Background(), nil, "gpt-4o")
+	assert.True(t, res.skipped)
+}
+
+func Test_doctorFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	opts := options{}
+	opts.Files.SamplesDataPath, opts.Files.DynamicDataPath = tmpDir, filepath.Join(tmpDir, "dynamic")
+
+	res := doctorFiles(opts)
+	require.Len(t, res, 3)
+	assert.ErrorContains(t, res[0].err, "can't read samples, check --files.samples")
+	assert.ErrorContains(t, res[1].err, "can't read samples, check --files.samples")
+	assert.Equal(t, doctorResult{name: "dynamic data " + opts.Files.DynamicDataPath,
+		info: "doesn't exist yet, created on start"}, res[2])
+
+	opts.Files.SamplesStorage = "db"
+	require.NoError(t, os.Mkdir(opts.Files.DynamicDataPath, 0o700))
+	res = doctorFiles(opts)
+	require.Len(t, res, 3)
+	assert.True(t, res[0].skipped)
+	assert.True(t, res[1].skipped)
+	assert.Equal(t, doctorResult{name: "dynamic data " + opts.Files.DynamicDataPath, info: "writable"}, res[2])
+	entries, err := os.ReadDir(opts.Files.DynamicDataPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "temp file removed")
+}
+
+func Test_doctorDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	opts := options{}
+	opts.Files.DynamicDataPath = tmpDir
+
+	res := doctorDatabase(opts)
+	assert.Equal(t, "doesn't exist yet, created on start", res.info)
+	require.NoError(t, res.err)
+
+	db, err := storage.NewSqliteDB(filepath.Join(tmpDir, dataFile))
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE test (id INTEGER PRIMARY KEY)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	res = doctorDatabase(opts)
+	assert.Equal(t, doctorResult{name: "database " + filepath.Join(tmpDir, dataFile), info: "integrity ok"}, res)
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, dataFile), []byte("not a database, just some text"), 0o600))
+	res = doctorDatabase(opts)
+	require.Error(t, res.err)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// evalSamples evaluates detection with the configured thresholds on spam and ham samples set by eval --spam and --ham,
+// with cross-validation, and prints the confusion matrix and quality metrics to out. Stop-words and excluded tokens
+// are read from the samples data path, if present. Returns error if the metrics are below the ones set by
+// eval --min-precision and --min-f1, so changes of samples can be checked in CI.
+func evalSamples(opts options, out io.Writer) error {
+	spam, err := readSamplesFile(opts.Eval.Spam)
+	if err != nil {
+		return fmt.Errorf("can't read spam samples, %w", err)
+	}
+	ham, err := readSamplesFile(opts.Eval.Ham)
+	if err != nil {
+		return fmt.Errorf("can't read ham samples, %w", err)
+	}
+	samples := lib.EvalSamples{Spam: spam, Ham: ham}
+	if samples.StopWords, err = readOptionalSamplesFile(filepath.Join(opts.Files.SamplesDataPath, stopWordsFile)); err != nil {
+		return fmt.Errorf("can't read stop-words, %w", err)
+	}
+	excludedFile := filepath.Join(opts.Files.SamplesDataPath, excludeTokensFile)
+	if samples.ExcludedTokens, err = readOptionalSamplesFile(excludedFile); err != nil {
+		return fmt.Errorf("can't read excluded tokens, %w", err)
+	}
+
+	report, err := lib.Evaluate(makeDetectorConfig(opts), samples, opts.Eval.Folds)
+	if err != nil {
+		return fmt.Errorf("can't evaluate, %w", err)
+	}
+	if err = printEvalReport(report, opts.Eval.JSON, out); err != nil {
+		return fmt.Errorf("can't print report, %w", err)
+	}
+
+	errs := new(multierror.Error)
+	if report.Precision < opts.Eval.MinPrecision {
+		errs = multierror.Append(errs, fmt.Errorf("precision %.4f is below %.4f", report.Precision, opts.Eval.MinPrecision))
+	}
+	if report.F1 < opts.Eval.MinF1 {
+		errs = multierror.Append(errs, fmt.Errorf("f1 %.4f is below %.4f", report.F1, opts.Eval.MinF1))
+	}
+	if err = errs.ErrorOrNil(); err != nil {
+		return fmt.Errorf("quality check failed, %w", err)
+	}
+	return nil
+}
+
+// printEvalReport prints the report as text with confusion matrix, or as json
+func printEvalReport(report lib.EvalReport, asJSON bool, out io.Writer) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	_, err := fmt.Fprintf(out, "samples: spam %d, ham %d, folds: %d\n"+
+		"confusion matrix:\n"+
+		"%-14s%16s%16s\n%-14s%16d%16d\n%-14s%16d%16d\n"+
+		"precision: %.4f, recall: %.4f, f1: %.4f, accuracy: %.4f\n",
+		report.Spam, report.Ham, report.Folds,
+		"", "detected spam", "detected ham",
+		"actual spam", report.TruePositives, report.FalseNegatives,
+		"actual ham", report.FalsePositives, report.TrueNegatives,
+		report.Precision, report.Recall, report.F1, report.Accuracy)
+	return err
+}
+
+// readSamplesFile reads samples from the file, one sample per line, empty lines are skipped
+func readSamplesFile(file string) ([]string, error) {
+	fh, err := os.Open(file) //nolint:gosec // file set by user
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	res := []string{}
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // long samples are allowed
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			res = append(res, line)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// readOptionalSamplesFile reads samples as readSamplesFile does, but returns nothing if the file doesn't exist
+func readOptionalSamplesFile(file string) ([]string, error) {
+	res, err := readSamplesFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return res, err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func Test_evalSamples(t *testing.T) {
+	tmpDir := t.TempDir()
+	spamFile, hamFile := filepath.Join(tmpDir, "spam.txt"), filepath.Join(tmpDir, "ham.txt")
+	require.NoError(t, os.WriteFile(spamFile, []byte("win a free prize now\nfree prize waiting for you\n\n"+
+		"claim your free prize today\nearn money fast with crypto\ncrypto money fast and easy\nfast money with crypto trading\n"), 0o600))
+	require.NoError(t, os.WriteFile(hamFile, []byte("see you at the meeting tomorrow\nthe meeting is moved to friday\n"+
+		"thanks for the notes from the meeting\nlunch at noon works for me\ncan we have lunch on monday\nlunch place near the office\n"), 0o600))
+
+	eval := func(args ...string) (string, error) {
+		opts, _, err := loadOptions(append([]string{"--files.samples=" + tmpDir, "--min-msg-len=0", "--similarity-threshold=0.3",
+			"eval", "--spam=" + spamFile, "--ham=" + hamFile, "--folds=3"}, args...))
+		require.NoError(t, err)
+		out := bytes.Buffer{}
+		err = evalSamples(opts, &out)
+		return out.String(), err
+	}
+
+	out, err := eval("--min-f1=0.9", "--min-precision=0.9")
+	require.NoError(t, err)
+	assert.Contains(t, out, "samples: spam 6, ham 6, folds: 3\n")
+	assert.Contains(t, out, "actual spam                  6               0\n")
+	assert.Contains(t, out, "precision: 1.0000, recall: 1.0000, f1: 1.0000, accuracy: 1.0000\n")
+
+	t.Run("stop-words of samples path used", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, stopWordsFile), []byte("meeting\n"), 0o600))
+		defer os.Remove(filepath.Join(tmpDir, stopWordsFile))
+		out, err := eval("--json", "--min-precision=0.9", "--min-f1=0.9")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "quality check failed")
+		assert.Contains(t, err.Error(), "precision 0.6667 is below 0.9000")
+		assert.Contains(t, err.Error(), "f1 0.8000 is below 0.9000")
+		var report lib.EvalReport
+		require.NoError(t, json.Unmarshal([]byte(out), &report), "report printed before the failure")
+		assert.Equal(t, 3, report.FalsePositives)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := eval("--folds=10")
+		assert.ErrorContains(t, err, "can't evaluate, not enough samples for 10 folds")
+		opts, _, err := loadOptions([]string{"eval", "--spam=/no/such/file", "--ham=" + hamFile})
+		require.NoError(t, err)
+		assert.ErrorContains(t, evalSamples(opts, &bytes.Buffer{}), "can't read spam samples")
+	})
+}
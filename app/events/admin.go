@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -13,34 +14,53 @@ import (
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
 )
 
 // admin is a helper to handle all admin-group related stuff, created by listener
 // public methods kept public (on a private struct) to be able to recognize the api
 type admin struct {
-	tbAPI        TbAPI
-	bot          Bot
-	locator      Locator
-	superUsers   SuperUsers
-	primChatID   int64
-	adminChatID  int64
-	trainingMode bool
-	keepUser     bool
-	dry          bool
+	tbAPI       TbAPI
+	bot         Bot
+	locator     Locator
+	bus         *Bus // optional, actions and decisions of admins are published to subscribers
+	superUsers  SuperUsers
+	primChatID  int64
+	adminChatID int64
+	keepUser    bool
+	modes       func() (dry, training bool) // dry and training modes of the listener, can be changed at runtime
+	reload      func() error                // optional, reloads configuration on /reload command
+	deletes     *deleteQueue                // optional, queue of messages scheduled for deletion
+	resolvedTTL time.Duration               // delete resolved notifications after this duration, 0 - keep them
+	notes       UserNotes                   // optional, notes of moderators about users, added with /note command
+	audit       ModerationAudit             // optional, records reloads by admins, actions are recorded by the bus
+	protected   ProtectedUsers              // optional, users never banned by the bot, set with /protect command
+	channels    AllowedChannels             // optional, channels allowed to post without checks, set with /allowchannel
 }
 
 const (
 	confirmationPrefix = "?"
 	banPrefix          = "+"
 	infoPrefix         = "!"
+	evasionBanPrefix   = "#"
+	originalPrefix     = "="
 )
 
-// ReportBan a ban message to admin chat with a button to unban the user
-func (a *admin) ReportBan(banUserStr string, msg *bot.Message) {
+// ReportBan a ban message to admin chat with a button to unban the user. The note, i.e. about auto-training,
+// is added to the header, and with confirm set, the message has a button to confirm it as spam.
+// The latest notes of moderators about the user are added to the header too.
+func (a *admin) ReportBan(banUserStr string, msg *bot.Message, note string, confirm bool) {
 	log.Printf("[DEBUG] report to admin chat, ban msgsData for %s, group: %d", banUserStr, a.adminChatID)
-	text := strings.ReplaceAll(escapeMarkDownV1Text(msg.Text), "\n", " ")
-	forwardMsg := fmt.Sprintf("**permanently banned [%s](tg://user?id=%d)**\n\n%s\n\n", banUserStr, msg.From.ID, text)
-	if err := a.sendWithUnbanMarkup(forwardMsg, "change ban", msg.From, a.adminChatID); err != nil {
+	text := escapeMarkDownV1Text(excerpt(msg.Text))
+	header := fmt.Sprintf("**permanently banned [%s](tg://user?id=%d)**", escapeMarkDownV1Text(banUserStr), msg.From.ID)
+	if note != "" {
+		header += ", " + escapeMarkDownV1Text(note) // the header line is not a part of the message on confirmation
+	}
+	if notes := a.userNotes(msg.From.ID); notes != "" {
+		header += ", notes: " + escapeMarkDownV1Text(notes) // kept in the header line for the same reason
+	}
+	forwardMsg := fmt.Sprintf("%s\n\n%s\n\n", header, text)
+	if err := a.sendWithUnbanMarkup(forwardMsg, "change ban", msg, a.adminChatID, confirm); err != nil {
 		log.Printf("[WARN] failed to send admin message, %v", err)
 	}
 }
@@ -59,6 +79,33 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 		update.Message.MessageID, update.UpdateID, update.Message.From.UserName, update.Message.ForwardSenderName)
 
 	if update.Message.ForwardSenderName == "" && update.Message.ForwardFrom == nil {
+		if update.Message.IsCommand() && update.Message.Command() == "reload" {
+			return a.reloadCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "purge" {
+			return a.purgeCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "note" {
+			return a.noteCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "protect" {
+			return a.protectCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "unprotect" {
+			return a.unprotectCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "protected" {
+			return a.protectedCommand()
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "allowchannel" {
+			return a.allowChannelCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "blockchannel" {
+			return a.blockChannelCommand(update.Message)
+		}
+		if update.Message.IsCommand() && update.Message.Command() == "channels" {
+			return a.channelsCommand()
+		}
 		// this is a regular message from admin chat, not the forwarded one, ignore it
 		return nil
 	}
@@ -70,7 +117,7 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 
 	// it would be nice to ban this user right away, but we don't have forwarded user ID here due to tg privacy limitation.
 	// it is empty in update.Message. to ban this user, we need to get the match on the message from the locator and ban from there.
-	info, ok := a.locator.Message(update.Message.Text)
+	info, ok := a.locator.Message(a.primChatID, update.Message.Text)
 	if !ok {
 		return fmt.Errorf("not found %q in locator", shrink(update.Message.Text, 50))
 	}
@@ -88,7 +135,7 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 
 	// make a message with spam info and send to admin chat
 	spamInfo := []string{}
-	resp := a.bot.OnMessage(bot.Message{Text: update.Message.Text, From: bot.User{ID: info.UserID}})
+	resp := a.bot.OnMessage(context.Background(), bot.Message{Text: update.Message.Text, From: bot.User{ID: info.UserID}})
 	spamInfoText := "**can't get spam info**"
 	for _, check := range resp.CheckResults {
 		spamInfo = append(spamInfo, "- "+escapeMarkDownV1Text(check.String()))
@@ -102,14 +149,17 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 		errs = multierror.Append(errs, fmt.Errorf("failed to send spap detection results to admin chat: %w", err))
 	}
 
-	if a.dry {
+	dry, training := a.modes()
+	if dry {
 		return errs.ErrorOrNil()
 	}
 
 	// update spam samples
-	if err := a.bot.UpdateSpam(msgTxt); err != nil {
+	if err := a.bot.UpdateSpam(msgTxt, adminSource(update.Message.From)); err != nil {
 		return fmt.Errorf("failed to update spam for %q: %w", msgTxt, err)
 	}
+	a.bus.Publish(Event{Kind: EventAdminDecision, ChatID: a.primChatID, User: bot.User{ID: info.UserID, Username: info.UserName},
+		Text: msgTxt, Action: DecisionSpam, Source: adminSource(update.Message.From)})
 
 	// delete message
 	if _, err := a.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: a.primChatID, MessageID: info.MsgID}); err != nil {
@@ -120,10 +170,14 @@ func (a *admin) MsgHandler(update tbapi.Update) error {
 
 	// ban user
 	banReq := banRequest{duration: bot.PermanentBanDuration, userID: info.UserID, chatID: a.primChatID,
-		tbAPI: a.tbAPI, dry: a.dry, training: a.trainingMode}
+		tbAPI: a.tbAPI, dry: dry, training: training}
 
 	if err := banUserOrChannel(banReq); err != nil {
 		errs = multierror.Append(errs, fmt.Errorf("failed to ban user %d: %w", info.UserID, err))
+	} else {
+		a.bus.Publish(Event{Kind: EventActionExecuted, ChatID: a.primChatID, Text: msgTxt, Action: ActionBan, Dry: training,
+			User:   bot.User{ID: info.UserID, Username: info.UserName, DisplayName: forwardName(update.Message)},
+			Source: adminSource(update.Message.From)})
 	}
 
 	log.Printf("[INFO] user %q (%d) banned", update.Message.ForwardSenderName, info.UserID)
@@ -167,6 +221,24 @@ func (a *admin) InlineCallbackHandler(query *tbapi.CallbackQuery) error {
 		return nil
 	}
 
+	// if callback msgsData starts with "=", we should show the original message with formatting
+	if strings.HasPrefix(callbackData, originalPrefix) {
+		if err := a.callbackShowOriginal(query); err != nil {
+			return fmt.Errorf("failed to show original message: %w", err)
+		}
+		log.Printf("[DEBUG] original message sent, chatID: %d, message: %s", chatID, callbackData[1:])
+		return nil
+	}
+
+	// if callback msgsData starts with "#", we should ban the user reported as likely ban evasion
+	if strings.HasPrefix(callbackData, evasionBanPrefix) {
+		if err := a.callbackEvasionBan(query); err != nil {
+			return fmt.Errorf("failed to ban evading user: %w", err)
+		}
+		log.Printf("[DEBUG] evading user banned, chatID: %d, userID: %s", chatID, callbackData[1:])
+		return nil
+	}
+
 	// no prefix, callback msgsData here is userID, we should unban the user
 	log.Printf("[DEBUG] unban action activated, chatID: %d, userID: %s, orig: %q", chatID, callbackData, query.Message.Text)
 	if err := a.callbackUnbanConfirmed(query); err != nil {
@@ -183,7 +255,7 @@ func (a *admin) callbackAskBanConfirmation(query *tbapi.CallbackQuery) error {
 	callbackData := query.Data
 
 	keepBanned := "Keep it banned"
-	if a.trainingMode {
+	if _, training := a.modes(); training {
 		keepBanned = "Confirm ban"
 	}
 
@@ -214,36 +286,40 @@ func (a *admin) callbackBanConfirmed(query *tbapi.CallbackQuery) error {
 	if err := send(editMsg, a.tbAPI); err != nil {
 		return fmt.Errorf("failed to clear confirmation, chatID:%d, msgID:%d, %w", query.Message.Chat.ID, query.Message.MessageID, err)
 	}
+	a.deleteResolved(query.Message)
+
+	callbackData := query.Data
+	userID, parseErr := strconv.ParseInt(callbackData[1:], 10, 64)
+	if parseErr != nil {
+		return fmt.Errorf("failed to parse callback's userID %q: %w", callbackData[1:], parseErr)
+	}
 
 	cleanMsg, err := a.getCleanMessage(query.Message.Text)
 	if err != nil {
 		return fmt.Errorf("failed to get clean message: %w", err)
 	}
+	cleanMsg = a.originalMessage(userID, cleanMsg) // the report shows the excerpt, cut or with links defanged
 
-	if err := a.bot.UpdateSpam(cleanMsg); err != nil { // update spam samples
+	if err := a.bot.UpdateSpam(cleanMsg, adminSource(query.From)); err != nil { // update spam samples
 		return fmt.Errorf("failed to update spam for %q: %w", cleanMsg, err)
 	}
-
-	callbackData := query.Data
-	userID, parseErr := strconv.ParseInt(callbackData[1:], 10, 64)
-	if parseErr != nil {
-		return fmt.Errorf("failed to parse callback's userID %q: %w", callbackData[1:], parseErr)
-	}
+	a.bus.Publish(Event{Kind: EventAdminDecision, ChatID: a.primChatID, User: bot.User{ID: userID}, Text: cleanMsg,
+		Action: DecisionSpam, Source: adminSource(query.From)})
 
 	// in training mode, the user is not banned automatically. here we do the real ban & delete the message
-	if a.trainingMode {
+	if dry, training := a.modes(); training {
 		errs := new(multierror.Error)
 		banReq := banRequest{
 			duration: bot.PermanentBanDuration,
 			userID:   userID,
 			chatID:   a.primChatID,
 			tbAPI:    a.tbAPI,
-			dry:      a.dry,
+			dry:      dry,
 			training: false, // reset training flag, ban for real
 		}
 
 		// get details from locator about msg to delete and user to ban
-		msgData, found := a.locator.Message(cleanMsg)
+		msgData, found := a.locator.Message(a.primChatID, cleanMsg)
 		if !found {
 			errs = multierror.Append(errs, fmt.Errorf("failed to find message %q in locator by hash %q", cleanMsg, a.locator.MsgHash(cleanMsg)))
 		}
@@ -254,6 +330,9 @@ func (a *admin) callbackBanConfirmed(query *tbapi.CallbackQuery) error {
 		if !msgFromSuper {
 			if err := banUserOrChannel(banReq); err != nil {
 				errs = multierror.Append(errs, fmt.Errorf("failed to ban user %d: %w", userID, err))
+			} else {
+				a.bus.Publish(Event{Kind: EventActionExecuted, ChatID: a.primChatID, User: bot.User{ID: userID, Username: msgData.UserName},
+					Text: cleanMsg, Action: ActionBan, Dry: dry, Source: adminSource(query.From)})
 			}
 		}
 
@@ -304,13 +383,14 @@ func (a *admin) callbackUnbanConfirmed(query *tbapi.CallbackQuery) error {
 	if err != nil {
 		return fmt.Errorf("failed to get clean message: %w", err)
 	}
+	cleanMsg = a.originalMessage(userID, cleanMsg)
 	// update ham samples, the original message is from the second line, remove newlines and spaces
-	if derr := a.bot.UpdateHam(cleanMsg); derr != nil {
+	if derr := a.bot.UpdateHam(cleanMsg, adminSource(query.From)); derr != nil {
 		return fmt.Errorf("failed to update ham for %q: %w", cleanMsg, derr)
 	}
 
 	// unban user if not in training mode
-	if !a.trainingMode {
+	if _, training := a.modes(); !training {
 		// onlyIfBanned seems to prevent user from being removed from the chat according to this confusing doc:
 		// https://core.telegram.org/bots/api#unbanchatmember
 		_, err = a.tbAPI.Request(tbapi.UnbanChatMemberConfig{
@@ -318,10 +398,14 @@ func (a *admin) callbackUnbanConfirmed(query *tbapi.CallbackQuery) error {
 		if err != nil {
 			return fmt.Errorf("failed to unban user %d: %w", userID, err)
 		}
+		a.bus.Publish(Event{Kind: EventActionExecuted, ChatID: a.primChatID, User: bot.User{ID: userID}, Action: ActionUnban,
+			Source: adminSource(query.From)})
 	}
 
 	// add user to the approved list
 	a.bot.AddApprovedUsers(userID)
+	a.bus.Publish(Event{Kind: EventAdminDecision, ChatID: a.primChatID, User: bot.User{ID: userID}, Text: cleanMsg,
+		Action: DecisionHam, Source: adminSource(query.From)})
 
 	// Create the original forwarded message with new indication of "unbanned" and an empty keyboard
 	updText := query.Message.Text + fmt.Sprintf("\n\n_unbanned by %s in %v_",
@@ -331,6 +415,7 @@ func (a *admin) callbackUnbanConfirmed(query *tbapi.CallbackQuery) error {
 	if err := send(editMsg, a.tbAPI); err != nil {
 		return fmt.Errorf("failed to edit message, chatID:%d, msgID:%d, %w", chatID, query.Message.MessageID, err)
 	}
+	a.deleteResolved(query.Message)
 	return nil
 }
 
@@ -347,7 +432,7 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 
 	// collect spam detection details
 	if userID != 0 {
-		info, found := a.locator.Spam(userID)
+		info, found := a.locator.Spam(a.primChatID, userID)
 		if found {
 			for _, check := range info.Checks {
 				spamInfo = append(spamInfo, "- "+escapeMarkDownV1Text(check.String()))
@@ -359,10 +444,22 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 	}
 
 	updText := query.Message.Text + "\n\n**spam detection results**\n" + spamInfoText
+	if cleanMsg, err := a.getCleanMessage(query.Message.Text); err == nil && userID != 0 && continuedRe.MatchString(cleanMsg) {
+		// the message cut in the report is continued with the rest of the original message, if found
+		if original := a.originalMessage(userID, cleanMsg); original != cleanMsg {
+			updText += "\n\n**message continued**\n" + escapeMarkDownV1Text(continuation(original))
+		}
+	}
 	confirmationKeyboard := [][]tbapi.InlineKeyboardButton{}
 	if query.Message.ReplyMarkup != nil && len(query.Message.ReplyMarkup.InlineKeyboard) > 0 {
 		confirmationKeyboard = query.Message.ReplyMarkup.InlineKeyboard
-		confirmationKeyboard[0] = confirmationKeyboard[0][:1] // remove second button (info)
+		row := []tbapi.InlineKeyboardButton{}
+		for _, btn := range confirmationKeyboard[0] {
+			if btn.CallbackData == nil || !strings.HasPrefix(*btn.CallbackData, infoPrefix) {
+				row = append(row, btn) // remove info button, confirmation of spam is kept
+			}
+		}
+		confirmationKeyboard[0] = row
 	}
 	editMsg := tbapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, updText)
 	editMsg.ReplyMarkup = &tbapi.InlineKeyboardMarkup{InlineKeyboard: confirmationKeyboard}
@@ -373,6 +470,17 @@ func (a *admin) callbackShowInfo(query *tbapi.CallbackQuery) error {
 	return nil
 }
 
+// adminSource returns source of samples added by the admin, "admin:<username>", or "admin:<id>" if no username
+func adminSource(user *tbapi.User) string {
+	if user == nil {
+		return "admin"
+	}
+	if user.UserName != "" {
+		return "admin:" + user.UserName
+	}
+	return "admin:" + strconv.FormatInt(user.ID, 10)
+}
+
 // getCleanMessage returns the original message without spam info and buttons and without newlines
 func (a *admin) getCleanMessage(msg string) (string, error) {
 	// the original message is from the second line, remove newlines and spaces
@@ -395,16 +503,42 @@ func (a *admin) getCleanMessage(msg string) (string, error) {
 	return cleanMsg, nil
 }
 
+// reloadCommand reloads configuration on /reload command of super-user in admin chat and confirms it.
+// The command is ignored if reload is not supported, errors are reported to admin chat by the listener.
+func (a *admin) reloadCommand(msg *tbapi.Message) error {
+	if a.reload == nil {
+		return nil
+	}
+	if err := a.reload(); err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	auditAdd(a.audit, storage.ModerationAction{Action: "reload", Actor: adminSource(msg.From), Details: "configuration reloaded"})
+	if err := send(tbapi.NewMessage(a.adminChatID, "configuration reloaded"), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send reload confirmation: %w", err)
+	}
+	return nil
+}
+
+// deleteResolved schedules deletion of the notification resolved by admin, if enabled
+func (a *admin) deleteResolved(msg *tbapi.Message) {
+	if a.deletes == nil || a.resolvedTTL <= 0 {
+		return
+	}
+	a.deletes.schedule(msg.Chat.ID, msg.MessageID, a.resolvedTTL)
+}
+
 // sendWithUnbanMarkup sends message to admin chat and add buttons to ui.
 // text is message with details and action it for the button label to unban, which is user id prefixed with "? for confirmation
-// second button is to show info about the spam analysis.
-func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, chatID int64) error {
+// second button is to show info about the spam analysis. With locator set, the second row has a button to show
+// the original message with formatting, kept by the locator.
+func (a *admin) sendWithUnbanMarkup(text, action string, msg *bot.Message, chatID int64, confirm bool) error {
+	user := msg.From
 	log.Printf("[DEBUG] action response %q: user %+v, text: %q", action, user, strings.ReplaceAll(text, "\n", "\\n"))
 	tbMsg := tbapi.NewMessage(chatID, text)
 	tbMsg.ParseMode = tbapi.ModeMarkdown
 	tbMsg.DisableWebPagePreview = true
 
-	tbMsg.ReplyMarkup = tbapi.NewInlineKeyboardMarkup(
+	markup := tbapi.NewInlineKeyboardMarkup(
 		tbapi.NewInlineKeyboardRow(
 			// ?userID to request confirmation
 			tbapi.NewInlineKeyboardButtonData("⛔︎ "+action, fmt.Sprintf("%s%d", confirmationPrefix, user.ID)),
@@ -412,6 +546,21 @@ func (a *admin) sendWithUnbanMarkup(text, action string, user bot.User, chatID i
 			tbapi.NewInlineKeyboardButtonData("️⚑ info", fmt.Sprintf("%s%d", infoPrefix, user.ID)),
 		),
 	)
+	if confirm {
+		// +userID to confirm the ban and add the message to spam samples
+		markup.InlineKeyboard[0] = append(markup.InlineKeyboard[0],
+			tbapi.NewInlineKeyboardButtonData("✓ confirm spam", fmt.Sprintf("%s%d", banPrefix, user.ID)))
+	}
+	if a.locator != nil && msg.ID != 0 {
+		msgChatID := msg.ChatID
+		if msgChatID == 0 {
+			msgChatID = a.primChatID
+		}
+		// =chatID:msgID to show the original message
+		markup.InlineKeyboard = append(markup.InlineKeyboard, tbapi.NewInlineKeyboardRow(
+			tbapi.NewInlineKeyboardButtonData("📄 original", fmt.Sprintf("%s%d:%d", originalPrefix, msgChatID, msg.ID))))
+	}
+	tbMsg.ReplyMarkup = markup
 
 	if _, err := a.tbAPI.Send(tbMsg); err != nil {
 		return fmt.Errorf("can't send message to telegram %q: %w", text, err)
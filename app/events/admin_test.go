@@ -1,7 +1,10 @@
 package events
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
@@ -9,6 +12,7 @@ import (
 
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
 )
 
 func TestAdmin_reportBan(t *testing.T) {
@@ -30,7 +34,7 @@ func TestAdmin_reportBan(t *testing.T) {
 		Text: "Test\n\n_message_",
 	}
 
-	adm.ReportBan("testUser", msg)
+	adm.ReportBan("testUser", msg, "", false)
 
 	require.Equal(t, 1, len(mockAPI.SendCalls()))
 	t.Logf("sent text: %+v", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
@@ -83,3 +87,93 @@ func TestAdmin_getCleanMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestAdmin_MsgHandlerReload(t *testing.T) {
+	command := func(text string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{Text: text, From: &tbapi.User{UserName: "admin"},
+			Entities: []tbapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(strings.Fields(text)[0])}}}}
+	}
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+
+	reloads := 0
+	audit := &mocks.ModerationAuditMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123, reload: func() error { reloads++; return nil }, audit: audit}
+	require.NoError(t, adm.MsgHandler(command("/reload")))
+	assert.Equal(t, 1, reloads)
+	require.Len(t, audit.AddCalls(), 1)
+	assert.Equal(t, storage.ModerationAction{Action: "reload", Actor: "admin:admin", Details: "configuration reloaded"},
+		audit.AddCalls()[0].Action)
+	require.Equal(t, 1, len(mockAPI.SendCalls()))
+	assert.Equal(t, int64(123), mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ChatID)
+	assert.Equal(t, "configuration reloaded", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+
+	require.NoError(t, adm.MsgHandler(command("/reload@tgspam_bot")))
+	assert.Equal(t, 2, reloads, "command addressed to the bot")
+
+	require.NoError(t, adm.MsgHandler(command("/other")))
+	require.NoError(t, adm.MsgHandler(tbapi.Update{Message: &tbapi.Message{Text: "reload", From: &tbapi.User{}}}))
+	assert.Equal(t, 2, reloads, "not a reload command")
+
+	t.Run("reload failed", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		adm := admin{tbAPI: mockAPI, reload: func() error { return errors.New("bad config") }}
+		err := adm.MsgHandler(command("/reload"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to reload configuration: bad config")
+		assert.Empty(t, mockAPI.SendCalls(), "error reported by listener")
+	})
+
+	t.Run("reload not supported", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		adm := admin{tbAPI: mockAPI}
+		require.NoError(t, adm.MsgHandler(command("/reload")))
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+}
+
+func TestAdmin_DeleteResolved(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	b := &mocks.BotMock{UpdateHamFunc: func(msg, source string) error { return nil }, AddApprovedUsersFunc: func(id int64, ids ...int64) {}}
+	query := &tbapi.CallbackQuery{Data: "777", From: &tbapi.User{UserName: "admin"},
+		Message: &tbapi.Message{MessageID: 987, Chat: &tbapi.Chat{ID: 123}, Text: "banned user\n\nham message"}}
+	modes := func() (dry, training bool) { return false, false }
+
+	adm := admin{tbAPI: mockAPI, bot: b, adminChatID: 123, primChatID: 456, modes: modes, deletes: newDeleteQueue(mockAPI)}
+	require.NoError(t, adm.callbackUnbanConfirmed(query))
+	assert.Zero(t, adm.deletes.flush(), "resolved notifications are kept by default")
+
+	adm.resolvedTTL = time.Minute
+	require.NoError(t, adm.callbackUnbanConfirmed(query))
+	require.Len(t, adm.deletes.tasks, 1)
+	assert.Equal(t, int64(123), adm.deletes.tasks[0].chatID)
+	assert.Equal(t, 987, adm.deletes.tasks[0].msgID)
+}
+
+func TestAdmin_adminSource(t *testing.T) {
+	assert.Equal(t, "admin:bob", adminSource(&tbapi.User{UserName: "bob", ID: 12}))
+	assert.Equal(t, "admin:12", adminSource(&tbapi.User{ID: 12}))
+	assert.Equal(t, "admin", adminSource(nil))
+}
+
+func TestAdmin_reportBanConfirm(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123}
+
+	adm.ReportBan("testUser", &bot.Message{From: bot.User{ID: 456}, Text: "buy crypto"},
+		"confidence 50.0%, confirm to add to spam samples", true)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	sent := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, "**permanently banned [testUser](tg://user?id=456)**, confidence 50.0%, confirm to add to spam samples\n\n"+
+		"buy crypto\n\n", sent.Text)
+	row := sent.ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard[0]
+	require.Len(t, row, 3)
+	assert.Equal(t, "✓ confirm spam", row[2].Text)
+	assert.Equal(t, "+456", *row[2].CallbackData)
+
+	cleanMsg, err := adm.getCleanMessage("permanently banned testUser, confidence 50.0%\n\nbuy crypto\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, "buy crypto", cleanMsg, "note is not a part of the message")
+}
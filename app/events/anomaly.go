@@ -0,0 +1,152 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// anomalyMinProbation is the min number of first messages making the stats, fewer can't make a meaningful average
+const anomalyMinProbation = 3
+
+// anomalyMaxUsers is the number of tracked users after which the least recently seen ones are removed on insert
+const anomalyMaxUsers = 10000
+
+// anomalyGuard keeps simple stats of messages of users, average length, share of messages with links
+// and share of emoji, over their first messages, the probation window. Messages after the probation
+// deviating sharply from the stats are anomalies, i.e. a sleeper account posting a long ad after
+// a few short greetings passed checks of first messages. Stats are kept in memory.
+type anomalyGuard struct {
+	probation int     // number of first messages of the user making the stats
+	factor    float64 // message longer than average by this factor is an anomaly, so as emoji share
+	minLen    int     // messages shorter than this are never anomalies
+
+	lock  sync.Mutex
+	seq   int64                  // sequence of messages, to find the least recently seen users
+	users map[int64]*userProfile // stats by user id
+}
+
+// userProfile is stats of the first messages of the user
+type userProfile struct {
+	count    int     // number of messages in stats, up to probation
+	length   int     // total length of messages in characters
+	links    int     // number of messages with links
+	emoji    float64 // total share of emoji in messages
+	lastSeen int64   // sequence of the last message of the user
+}
+
+func newAnomalyGuard(probation int, factor float64, minLen int) *anomalyGuard {
+	if probation < anomalyMinProbation {
+		probation = anomalyMinProbation
+	}
+	if factor <= 1 {
+		factor = 5
+	}
+	if minLen <= 0 {
+		minLen = 300
+	}
+	return &anomalyGuard{probation: probation, factor: factor, minLen: minLen, users: map[int64]*userProfile{}}
+}
+
+// check adds the message to stats of the user in probation, or compares it with the stats after.
+// Returns the result with found=true if the message is an anomaly. The result is never spam,
+// it is a signal for admins.
+func (g *anomalyGuard) check(msg bot.Message) (cr lib.CheckResult, found bool) {
+	length := utf8.RuneCountInString(msg.Text)
+	hasLinks := bioLinkRe.MatchString(msg.Text)
+	emoji := emojiShare(msg.Text)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.seq++
+	p, ok := g.users[msg.From.ID]
+	if !ok {
+		g.cleanup()
+		p = &userProfile{}
+		g.users[msg.From.ID] = p
+	}
+	p.lastSeen = g.seq
+	if p.count < g.probation {
+		p.count++
+		p.length += length
+		p.emoji += emoji
+		if hasLinks {
+			p.links++
+		}
+		return lib.CheckResult{}, false
+	}
+
+	avgLen := float64(p.length) / float64(p.count)
+	longer := length >= g.minLen && float64(length) > avgLen*g.factor
+	newLinks := hasLinks && p.links == 0
+	moreEmoji := emoji > 0.1 && emoji > p.emoji/float64(p.count)*g.factor
+	if !longer && !(newLinks && moreEmoji) { // links or emoji alone are common in regular chatting
+		return lib.CheckResult{}, false
+	}
+
+	details := []string{}
+	if longer {
+		details = append(details, fmt.Sprintf("%d characters, average %.0f", length, avgLen))
+	}
+	if newLinks {
+		details = append(details, "links, none before")
+	}
+	if moreEmoji {
+		details = append(details, fmt.Sprintf("%.0f%% emoji, average %.0f%%", emoji*100, p.emoji/float64(p.count)*100))
+	}
+	return lib.CheckResult{Name: "anomaly", Spam: false,
+		Details: fmt.Sprintf("unusual message after %d first ones: %s", p.count, strings.Join(details, ", "))}, true
+}
+
+// cleanup removes the least recently seen users if the number of tracked users reached anomalyMaxUsers
+func (g *anomalyGuard) cleanup() {
+	if len(g.users) < anomalyMaxUsers {
+		return
+	}
+	threshold := g.seq - anomalyMaxUsers/2 // users seen in the last half of the max messages are kept, roughly
+	for id, p := range g.users {
+		if p.lastSeen < threshold {
+			delete(g.users, id)
+		}
+	}
+}
+
+// emojiShare returns the share of emoji, and other symbols, in characters of the text, spaces not counted
+func emojiShare(text string) float64 {
+	total, emoji := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) || r == '\uFE0F' || r == '\u200D' { // variation selector and joiner are parts of emoji
+			continue
+		}
+		total++
+		if unicode.Is(unicode.So, r) {
+			emoji++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(emoji) / float64(total)
+}
+
+// checkAnomaly checks the message of the user, with clean verdict, for anomaly against stats of the first messages
+// of the user. The anomaly is reported to admin chat. Returns true if the message is an anomaly.
+func (l *TelegramListener) checkAnomaly(msg bot.Message, resp *bot.Response) bool {
+	cr, found := l.anomaly.check(msg)
+	if !found {
+		return false
+	}
+	resp.CheckResults = append(resp.CheckResults, cr)
+	user := bot.User{ID: msg.From.ID, Username: msg.From.Username, DisplayName: msg.From.DisplayName}
+	log.Printf("[INFO] user %v posted %s", user, cr.Details)
+	if err := l.AdminAlert(fmt.Sprintf("user %v posted %s:\n%s", user, cr.Details, excerpt(msg.Text))); err != nil {
+		log.Printf("[WARN] failed to report anomaly of user %d, %v", user.ID, err)
+	}
+	return true
+}
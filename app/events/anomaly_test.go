@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestAnomalyGuard_check(t *testing.T) {
+	g := newAnomalyGuard(1, 0, 0)
+	assert.Equal(t, 3, g.probation, "at least 3 messages")
+	assert.InDelta(t, 5.0, g.factor, 0.001)
+	assert.Equal(t, 300, g.minLen)
+	msg := func(userID int64, text string) bot.Message {
+		return bot.Message{Text: text, From: bot.User{ID: userID}}
+	}
+
+	for _, text := range []string{"hi all", "how are you doing today?", "thanks, good to know"} {
+		_, found := g.check(msg(1, strings.Repeat(text+" ", 20)))
+		assert.False(t, found, "long messages in probation make the stats")
+		_, found = g.check(msg(2, text))
+		assert.False(t, found)
+	}
+
+	_, found := g.check(msg(2, "ok, see you tomorrow"))
+	assert.False(t, found, "usual message")
+	_, found = g.check(msg(2, "nice one https://github.com/umputun/tg-spam"))
+	assert.False(t, found, "links alone are usual")
+
+	ad := "🔥 earn $500 a day 🔥 " + strings.Repeat("no experience needed, just join us ", 20)
+	cr, found := g.check(msg(2, ad))
+	require.True(t, found, "long ad")
+	assert.Equal(t, lib.CheckResult{Name: "anomaly", Spam: false,
+		Details: "unusual message after 3 first ones: 720 characters, average 17"}, cr)
+
+	cr, found = g.check(msg(2, "🔥🔥 join t.me/promo 🔥🔥"))
+	require.True(t, found, "links with emoji, none before")
+	assert.Equal(t, "unusual message after 3 first ones: links, none before, 22% emoji, average 0%", cr.Details)
+
+	_, found = g.check(msg(1, ad))
+	assert.False(t, found, "long messages are usual for the user")
+	_, found = g.check(msg(3, ad))
+	assert.False(t, found, "first message of the user")
+}
+
+func TestEmojiShare(t *testing.T) {
+	assert.InDelta(t, 0.0, emojiShare(""), 0.001)
+	assert.InDelta(t, 0.0, emojiShare("hello world"), 0.001)
+	assert.InDelta(t, 0.5, emojiShare("ab 🔥👍"), 0.001)
+	assert.InDelta(t, 0.5, emojiShare("a ❤️"), 0.001, "variation selector not counted")
+}
+
+func TestAnomalyGuard_cleanup(t *testing.T) {
+	g := newAnomalyGuard(3, 5, 300)
+	for i := 0; i < anomalyMaxUsers; i++ {
+		g.check(bot.Message{Text: "hi", From: bot.User{ID: int64(i)}})
+	}
+	assert.Len(t, g.users, anomalyMaxUsers)
+	g.check(bot.Message{Text: "hi", From: bot.User{ID: anomalyMaxUsers}})
+	assert.Len(t, g.users, anomalyMaxUsers/2+1, "least recently seen users removed")
+	assert.Contains(t, g.users, int64(anomalyMaxUsers-1))
+	assert.NotContains(t, g.users, int64(0))
+}
+
+func TestTelegramListener_AnomalyCheck(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response { return bot.Response{} },
+		IsNewUserFunc: func(id int64) bool { return false },
+	}
+	sampler := &mocks.HamSamplerMock{SampleFunc: func(msg string) bool { return true }}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator,
+		AnomalyCheck: true, AnomalyProbation: 3, HamSampler: sampler, SuperUsers: SuperUsers{"super"}}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	for _, text := range []string{"hi", "hello all", "good morning"} {
+		srv.Push(tgtest.Message(100, tgtest.User(1, "sleeper"), text))
+		srv.Push(tgtest.Message(100, tgtest.User(2, "super"), text))
+	}
+	srv.Push(tgtest.Message(100, tgtest.User(2, "super"), strings.Repeat("long announcement ", 30)))
+	srv.Push(tgtest.Message(100, tgtest.User(1, "sleeper"), strings.Repeat("buy crypto at t.me/promo ", 30)))
+	srv.AssertSent(t, 200, "posted unusual message after 3 first ones: 750 characters, average 8")
+	assert.Len(t, srv.Requests("sendMessage"), 1, "super-user not checked")
+	assert.Len(t, sampler.SampleCalls(), 7, "anomaly is not a ham candidate")
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// bioLinkRe matches promo links in profile bio: urls, telegram links and mentions of channels or bots
+var bioLinkRe = regexp.MustCompile(`(?i)\b(?:https?://|(?:t|telegram)\.me/|www\.)[^\s,]+|\B@[a-z]\w{3,}`)
+
+// bioCacheCleanup is the number of cached results after which expired ones are removed on insert
+const bioCacheCleanup = 1000
+
+// bioChecker checks profile bio of users for promo links, as spammers keep the payload out of the message itself.
+// Bio is fetched with getChat of the user, results are cached by user for ttl, and bio texts are not kept.
+type bioChecker struct {
+	tbAPI     TbAPI
+	ttl       time.Duration
+	showLinks bool // details of the result list the links found, only their number otherwise
+	now       func() time.Time
+
+	lock  sync.Mutex
+	cache map[int64]bioEntry
+}
+
+// bioEntry is a cached result of the bio check of the user
+type bioEntry struct {
+	links   []string // links found in the bio, empty if none or bio can't be fetched
+	expires time.Time
+}
+
+func newBioChecker(tbAPI TbAPI, ttl time.Duration, showLinks bool) *bioChecker {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &bioChecker{tbAPI: tbAPI, ttl: ttl, showLinks: showLinks, now: time.Now, cache: map[int64]bioEntry{}}
+}
+
+// check checks bio of the user for links. Returns the result with found=false if there are no links in the bio,
+// or the bio can't be fetched, i.e. the user hides it. The result is never spam, it is a signal for admins.
+func (b *bioChecker) check(userID int64) (cr lib.CheckResult, found bool) {
+	b.lock.Lock()
+	entry, ok := b.cache[userID]
+	b.lock.Unlock()
+
+	if !ok || b.now().After(entry.expires) {
+		entry = bioEntry{links: b.fetchLinks(userID), expires: b.now().Add(b.ttl)}
+		b.lock.Lock()
+		if len(b.cache) >= bioCacheCleanup {
+			for id, e := range b.cache {
+				if b.now().After(e.expires) {
+					delete(b.cache, id)
+				}
+			}
+		}
+		b.cache[userID] = entry
+		b.lock.Unlock()
+	}
+
+	if len(entry.links) == 0 {
+		return lib.CheckResult{}, false
+	}
+	details := fmt.Sprintf("links in profile bio: %d", len(entry.links))
+	if b.showLinks {
+		details = "links in profile bio: " + strings.Join(entry.links, ", ")
+	}
+	return lib.CheckResult{Name: "bio", Spam: false, Details: details}, true
+}
+
+// fetchLinks returns links found in the bio of the user, nil if bio can't be fetched
+func (b *bioChecker) fetchLinks(userID int64) []string {
+	chat, err := b.tbAPI.GetChat(tbapi.ChatInfoConfig{ChatConfig: tbapi.ChatConfig{ChatID: userID}})
+	if err != nil {
+		log.Printf("[DEBUG] can't get bio of user %d, %v", userID, err)
+		return nil
+	}
+	return bioLinkRe.FindAllString(chat.Bio, -1)
+}
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestBioChecker_check(t *testing.T) {
+	bios := map[int64]string{
+		1: "crypto signals daily https://example.com/join, more at t.me/signals_channel",
+		2: "just a developer, mail me at dev@example.com",
+		3: "subscribe @best_crypto_channel",
+	}
+	mockAPI := &mocks.TbAPIMock{GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+		if config.ChatID == 4 {
+			return tbapi.Chat{}, errors.New("chat not found")
+		}
+		return tbapi.Chat{ID: config.ChatID, Type: "private", Bio: bios[config.ChatID]}, nil
+	}}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b := newBioChecker(mockAPI, time.Hour, true)
+	b.now = func() time.Time { return now }
+
+	cr, found := b.check(1)
+	assert.True(t, found)
+	assert.Equal(t, lib.CheckResult{Name: "bio", Spam: false,
+		Details: "links in profile bio: https://example.com/join, t.me/signals_channel"}, cr)
+
+	cr, found = b.check(3)
+	assert.True(t, found)
+	assert.Equal(t, "links in profile bio: @best_crypto_channel", cr.Details)
+
+	_, found = b.check(2)
+	assert.False(t, found, "email is not a link")
+	_, found = b.check(4)
+	assert.False(t, found, "bio can't be fetched")
+	require.Len(t, mockAPI.GetChatCalls(), 4)
+
+	_, found = b.check(1)
+	assert.True(t, found)
+	assert.Len(t, mockAPI.GetChatCalls(), 4, "cached")
+	now = now.Add(2 * time.Hour)
+	b.check(1)
+	assert.Len(t, mockAPI.GetChatCalls(), 5, "expired")
+
+	b = newBioChecker(mockAPI, 0, false)
+	cr, found = b.check(1)
+	assert.True(t, found)
+	assert.Equal(t, "links in profile bio: 2", cr.Details, "links are not shown")
+	assert.Equal(t, 24*time.Hour, b.ttl)
+}
+
+func TestTelegramListener_BioCheck(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	srv.AddChat(tbapi.Chat{ID: 1, Type: "private", Bio: "earn with us t.me/earn_fast"})
+	srv.AddChat(tbapi.Chat{ID: 2, Type: "private", Bio: "gopher"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			return bot.Response{CheckResults: []lib.CheckResult{{Name: "stopword", Details: "not found"}}}
+		},
+		IsNewUserFunc: func(id int64) bool { return id != 3 },
+	}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var saved []*bot.Response
+	spamLogger := SpamLoggerFunc(func(msg *bot.Message, response *bot.Response) { saved = append(saved, response) })
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator, BioCheck: true,
+		Bus: subscribed(SpamLogHandler(spamLogger), EventSpamDetected)}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	srv.Push(tgtest.Message(100, tgtest.User(1, "promo"), "hello everyone"))
+	srv.AssertSent(t, 200, "posted clean message, but links in profile bio: 1")
+	srv.ResetRequests()
+
+	srv.Push(tgtest.Message(100, tgtest.User(2, "gopher"), "hello everyone"))
+	srv.Push(tgtest.Message(100, tgtest.User(3, "approved"), "hello everyone"))
+	_, ok := srv.WaitRequest("getChat", func(r tgtest.Request) bool { return r.ChatID() == 2 })
+	assert.True(t, ok)
+	srv.AssertNoRequest(t, "sendMessage", 100*time.Millisecond)
+	srv.WaitTimeout = 10 * time.Millisecond
+	_, ok = srv.WaitRequest("getChat", func(r tgtest.Request) bool { return r.ChatID() == 3 })
+	assert.False(t, ok, "bio of approved user is not checked")
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, saved, "not spam")
+}
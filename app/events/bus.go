@@ -0,0 +1,187 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webhook"
+)
+
+// EventKind is a kind of the event published on the bus
+type EventKind string
+
+// kinds of events published by the listener and admin chat handler
+const (
+	EventMessageReceived EventKind = "message_received" // message of the group checked by the detector
+	EventSpamDetected    EventKind = "spam_detected"    // spam message or known spammer joined the group
+	EventActionExecuted  EventKind = "action_executed"  // user banned or unbanned, in dry and training modes too
+	EventAdminDecision   EventKind = "admin_decision"   // admin marked the message as spam or ham in admin chat
+)
+
+// actions of executed action events and decisions of admin decision events
+const (
+	ActionBan    = "ban"
+	ActionUnban  = "unban"
+	DecisionSpam = "spam"
+	DecisionHam  = "ham"
+)
+
+// Event is published on the bus on processing of updates. Fields not related to the kind of the event are empty.
+// Message and Response are shared by all subscribers and should not be modified.
+type Event struct {
+	Kind      EventKind
+	ChatID    int64
+	User      bot.User      // sender of the message, or the user the action or decision is about
+	ChannelID int64         // channel the message was sent on behalf of, if any
+	Text      string        // text of the message, i.e. spam message of the banned user, empty if unknown
+	Message   *bot.Message  // checked message, for message received and spam detected
+	Response  *bot.Response // response of the detector, for message received, spam detected and bans of the bot
+	Action    string        // ban or unban for executed action, spam or ham for admin decision
+	Dry       bool          // the action is not executed for real, in dry or training mode
+	Source    string        // initiator of the action or decision: "bot", "api" or "admin:<username>"
+}
+
+// EventHandler handles the event published on the bus. It is called synchronously by the publisher,
+// so it should be fast and handle its own failures.
+type EventHandler func(e Event)
+
+// Bus dispatches events of the listener and admin chat to subscribers, so consumers, i.e. webhooks, stats
+// and denylist, don't need to be wired into processing of updates. Handlers are called synchronously,
+// in order of subscription. Thread-safe, nil bus drops all events.
+type Bus struct {
+	lock sync.RWMutex
+	subs map[EventKind][]EventHandler
+}
+
+// NewBus makes a new bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subs: map[EventKind][]EventHandler{}}
+}
+
+// Subscribe registers the handler for events of given kinds
+func (b *Bus) Subscribe(h EventHandler, kinds ...EventKind) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, k := range kinds {
+		b.subs[k] = append(b.subs[k], h)
+	}
+}
+
+// Publish passes the event to all handlers subscribed to its kind
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.lock.RLock()
+	handlers := b.subs[e.Kind]
+	b.lock.RUnlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
+
+// events returns the bus of the listener, made on the first use if not set
+func (l *TelegramListener) events() *Bus {
+	l.busOnce.Do(func() {
+		if l.Bus == nil {
+			l.Bus = NewBus()
+		}
+	})
+	return l.Bus
+}
+
+// SpamLogHandler returns the handler saving detected spam messages, for spam detected events
+func SpamLogHandler(sl SpamLogger) EventHandler {
+	return func(e Event) {
+		if e.Kind == EventSpamDetected && e.Message != nil && e.Response != nil { // spammers detected on join have no message
+			sl.Save(e.Message, e.Response)
+		}
+	}
+}
+
+// StatsHandler returns the handler counting checked messages and reversed detections, for message received
+// and admin decision events
+func StatsHandler(st Stats) EventHandler {
+	return func(e Event) {
+		switch {
+		case e.Kind == EventMessageReceived && e.Response != nil:
+			st.Inc(e.ChatID, e.Response.Send && e.Response.BanInterval > 0, e.Response.Degraded())
+		case e.Kind == EventAdminDecision && e.Action == DecisionHam:
+			// count false positive, failure here doesn't affect unban
+			if _, err := st.SetReversed(e.ChatID, e.User.ID); err != nil {
+				log.Printf("[WARN] failed to mark detection of %d as reversed, %v", e.User.ID, err)
+			}
+		}
+	}
+}
+
+// NotifyHandler returns the handler sending webhook events on detected spam and executed bans and unbans,
+// for spam detected and action executed events. Actions of dry and training modes are not sent.
+func NotifyHandler(n Notifier) EventHandler {
+	return func(e Event) {
+		switch {
+		case e.Kind == EventSpamDetected:
+			we := webhook.Event{Type: webhook.EventSpam, ChatID: e.ChatID, UserID: e.User.ID, UserName: e.User.Username,
+				Text: e.Text}
+			if e.Response != nil {
+				we.Checks = e.Response.CheckResults
+			}
+			n.Notify(we)
+		case e.Kind != EventActionExecuted || e.Dry:
+			return
+		case e.Action == ActionBan:
+			n.Notify(webhook.Event{Type: webhook.EventBan, ChatID: e.ChatID, UserID: e.User.ID, UserName: e.User.Username})
+		case e.Action == ActionUnban:
+			n.Notify(webhook.Event{Type: webhook.EventUnban, ChatID: e.ChatID, UserID: e.User.ID})
+		}
+	}
+}
+
+// DenylistHandler returns the handler listing banned users with their spam messages and removing unbanned ones,
+// for action executed events. Actions of dry and training modes are not listed.
+func DenylistHandler(dl Denylist) EventHandler {
+	return func(e Event) {
+		if e.Kind != EventActionExecuted || e.Dry {
+			return
+		}
+		switch e.Action {
+		case ActionBan:
+			denylistAdd(dl, e.User.ID, e.Text)
+		case ActionUnban:
+			denylistRemove(dl, e.User.ID)
+		}
+	}
+}
+
+// AuditHandler returns the handler recording bans and unbans of the bot and admins to the moderation audit,
+// for action executed events. Actions of dry and training modes and of webapi are not recorded.
+func AuditHandler(audit ModerationAudit) EventHandler {
+	return func(e Event) {
+		if e.Kind != EventActionExecuted || e.Dry || e.Source == "api" { // actions of webapi are recorded by webapi, with the credential used
+			return
+		}
+		auditAdd(audit, storage.ModerationAction{Action: e.Action, ChatID: e.ChatID, UserID: e.User.ID, Actor: e.Source,
+			Details: auditReason(e)})
+	}
+}
+
+// auditReason returns the reason of the action recorded to the audit: the banned channel, and checks reported spam
+// for bans of the bot
+func auditReason(e Event) string {
+	res := []string{}
+	if e.ChannelID != 0 {
+		res = append(res, fmt.Sprintf("channel %d", e.ChannelID))
+	}
+	if e.Response != nil {
+		for _, cr := range e.Response.CheckResults {
+			if cr.Spam {
+				res = append(res, fmt.Sprintf("%s: %s", cr.Name, cr.Details))
+			}
+		}
+	}
+	return strings.Join(res, "; ")
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webhook"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	var got []string
+	b.Subscribe(func(e Event) { got = append(got, "first:"+string(e.Kind)) }, EventSpamDetected, EventActionExecuted)
+	b.Subscribe(func(e Event) { got = append(got, "second:"+string(e.Kind)) }, EventSpamDetected)
+
+	b.Publish(Event{Kind: EventSpamDetected})
+	b.Publish(Event{Kind: EventActionExecuted})
+	b.Publish(Event{Kind: EventMessageReceived})
+	assert.Equal(t, []string{"first:spam_detected", "second:spam_detected", "first:action_executed"}, got)
+
+	var nilBus *Bus
+	nilBus.Publish(Event{Kind: EventSpamDetected}) // no panic
+}
+
+func TestBus_concurrent(t *testing.T) {
+	b := NewBus()
+	var lock sync.Mutex
+	count := 0
+	b.Subscribe(func(e Event) { lock.Lock(); count++; lock.Unlock() }, EventMessageReceived)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); b.Publish(Event{Kind: EventMessageReceived}) }()
+		go func() { defer wg.Done(); b.Subscribe(func(e Event) {}, EventSpamDetected) }()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, count)
+}
+
+func TestTelegramListener_BusEvents(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	bus := NewBus()
+	var published []Event
+	bus.Subscribe(func(e Event) { published = append(published, e) }, EventActionExecuted, EventAdminDecision)
+	l := TelegramListener{TbAPI: mockAPI, Bus: bus, chatID: 123}
+
+	require.NoError(t, l.BanUser(0, 1, 0))
+	require.NoError(t, l.UnbanUser(0, 1))
+	l.SetModes(true, false)
+	require.NoError(t, l.BanUser(0, 2, 0))
+
+	require.Len(t, published, 3)
+	assert.Equal(t, Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 1}, Action: ActionBan, Source: "api"},
+		published[0])
+	assert.Equal(t, ActionUnban, published[1].Action)
+	assert.True(t, published[2].Dry)
+
+	l = TelegramListener{TbAPI: mockAPI, chatID: 123}
+	require.NoError(t, l.BanUser(0, 1, 0), "bus made if not set")
+	assert.NotNil(t, l.Bus)
+}
+
+func TestSpamLogHandler(t *testing.T) {
+	sl := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
+	h := SpamLogHandler(sl)
+	h(Event{Kind: EventSpamDetected, Message: &bot.Message{Text: "spam"}, Response: &bot.Response{Send: true}})
+	h(Event{Kind: EventSpamDetected, Response: &bot.Response{Send: true}}) // spammer detected on join
+	h(Event{Kind: EventMessageReceived, Message: &bot.Message{Text: "ham"}, Response: &bot.Response{}})
+	require.Len(t, sl.SaveCalls(), 1)
+	assert.Equal(t, "spam", sl.SaveCalls()[0].Msg.Text)
+}
+
+func TestStatsHandler(t *testing.T) {
+	stats := &mocks.StatsMock{IncFunc: func(chatID int64, spam, degraded bool) {},
+		SetReversedFunc: func(chatID, userID int64) (bool, error) { return true, nil }}
+	h := StatsHandler(stats)
+	h(Event{Kind: EventMessageReceived, ChatID: 123, Response: &bot.Response{Send: true, BanInterval: time.Hour}})
+	h(Event{Kind: EventMessageReceived, ChatID: 123, Response: &bot.Response{}})
+	h(Event{Kind: EventAdminDecision, ChatID: 123, User: bot.User{ID: 3}, Action: DecisionHam})
+	h(Event{Kind: EventAdminDecision, ChatID: 123, User: bot.User{ID: 4}, Action: DecisionSpam})
+
+	require.Len(t, stats.IncCalls(), 2)
+	assert.True(t, stats.IncCalls()[0].Spam)
+	assert.False(t, stats.IncCalls()[1].Spam)
+	require.Len(t, stats.SetReversedCalls(), 1)
+	assert.Equal(t, int64(3), stats.SetReversedCalls()[0].UserID)
+}
+
+func TestNotifyHandler(t *testing.T) {
+	notifier := &mocks.NotifierMock{NotifyFunc: func(event webhook.Event) {}}
+	h := NotifyHandler(notifier)
+	checks := []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"}}
+	h(Event{Kind: EventSpamDetected, ChatID: 123, User: bot.User{ID: 1, Username: "spammer"}, Text: "buy now",
+		Response: &bot.Response{CheckResults: checks}})
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 1, Username: "spammer"}, Action: ActionBan})
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 2}, Action: ActionBan, Dry: true})
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 1}, Action: ActionUnban})
+	h(Event{Kind: EventAdminDecision, ChatID: 123, User: bot.User{ID: 1}, Action: DecisionHam})
+
+	require.Len(t, notifier.NotifyCalls(), 3, "dry ban and decisions not notified")
+	assert.Equal(t, webhook.Event{Type: webhook.EventSpam, ChatID: 123, UserID: 1, UserName: "spammer", Text: "buy now",
+		Checks: checks}, notifier.NotifyCalls()[0].Event)
+	assert.Equal(t, webhook.Event{Type: webhook.EventBan, ChatID: 123, UserID: 1, UserName: "spammer"},
+		notifier.NotifyCalls()[1].Event)
+	assert.Equal(t, webhook.Event{Type: webhook.EventUnban, ChatID: 123, UserID: 1}, notifier.NotifyCalls()[2].Event)
+}
+
+func TestDenylistHandler(t *testing.T) {
+	denylist := &mocks.DenylistMock{
+		AddFunc:    func(userID int64, msg string) error { return nil },
+		RemoveFunc: func(userID int64) error { return nil },
+	}
+	h := DenylistHandler(denylist)
+	h(Event{Kind: EventActionExecuted, User: bot.User{ID: 1}, Text: "buy now", Action: ActionBan})
+	h(Event{Kind: EventActionExecuted, User: bot.User{ID: 2}, Action: ActionBan, Dry: true})
+	h(Event{Kind: EventActionExecuted, User: bot.User{ID: 1}, Action: ActionUnban})
+
+	require.Len(t, denylist.AddCalls(), 1)
+	assert.Equal(t, int64(1), denylist.AddCalls()[0].UserID)
+	assert.Equal(t, "buy now", denylist.AddCalls()[0].Msg)
+	require.Len(t, denylist.RemoveCalls(), 1)
+	assert.Equal(t, int64(1), denylist.RemoveCalls()[0].UserID)
+}
+
+func TestAuditHandler(t *testing.T) {
+	audit := &mocks.ModerationAuditMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	h := AuditHandler(audit)
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 1}, Action: ActionBan, Source: "api"})
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 2}, Action: ActionBan, Source: "bot", Dry: true})
+	assert.Empty(t, audit.AddCalls(), "actions of webapi recorded by webapi, dry ones not recorded")
+
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 4}, ChannelID: 5, Action: ActionBan,
+		Source: "bot", Response: &bot.Response{CheckResults: []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"},
+			{Name: "similarity", Details: "0.1/0.5"}, {Name: "cas", Spam: true, Details: "listed"}}}})
+	h(Event{Kind: EventActionExecuted, ChatID: 123, User: bot.User{ID: 4}, Action: ActionUnban, Source: "admin:bob"})
+	require.Len(t, audit.AddCalls(), 2)
+	assert.Equal(t, storage.ModerationAction{Action: "ban", ChatID: 123, UserID: 4, Actor: "bot",
+		Details: "channel 5; stopword: buy now; cas: listed"}, audit.AddCalls()[0].Action)
+	assert.Equal(t, storage.ModerationAction{Action: "unban", ChatID: 123, UserID: 4, Actor: "admin:bob"},
+		audit.AddCalls()[1].Action)
+}
+
+// subscribed makes the bus with the handler subscribed to events of given kinds, the way main subscribes consumers
+func subscribed(h EventHandler, kinds ...EventKind) *Bus {
+	b := NewBus()
+	b.Subscribe(h, kinds...)
+	return b
+}
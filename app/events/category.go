@@ -0,0 +1,42 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// actOnCategory acts on the message classified by openai into a category with warn or report action.
+// The user is warned with a reply to the message, if CategoryWarning is set, and the message is reported
+// to admin chat otherwise. The warning is not sent in training mode, and deleted after SpamReplyTTL, if set.
+func (l *TelegramListener) actOnCategory(msg bot.Message, cr lib.CheckResult) {
+	user := bot.User{ID: msg.From.ID, Username: msg.From.Username, DisplayName: msg.From.DisplayName}
+	category, rest, _ := strings.Cut(cr.Details, ", ")
+	action, _, _ := strings.Cut(rest, ", ")
+
+	if lib.OpenAICategoryAction(action) == lib.OpenAICategoryActionWarn && l.CategoryWarning != "" {
+		if _, training := l.Modes(); training {
+			log.Printf("[INFO] training mode: warn %v about %s message", user, category)
+			return
+		}
+		text := strings.NewReplacer("{user}", mention(user), "{category}", escapeMarkDownV1Text(category)).
+			Replace(l.CategoryWarning)
+		sent, err := l.sendBotResponse(bot.Response{Send: true, Text: text, ReplyTo: msg.ID}, l.chatID)
+		if err != nil {
+			log.Printf("[WARN] failed to warn user %d about %s message, %v", user.ID, category, err)
+			return
+		}
+		log.Printf("[INFO] %v warned about %s message", user, category)
+		if l.SpamReplyTTL > 0 {
+			l.deletes.schedule(l.chatID, sent.MessageID, l.SpamReplyTTL)
+		}
+		return
+	}
+
+	if err := l.AdminAlert(fmt.Sprintf("message of %v is %s:\n%s", user, cr.Details, excerpt(msg.Text))); err != nil {
+		log.Printf("[WARN] failed to report %s message of user %d, %v", category, user.ID, err)
+	}
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestTelegramListener_Category(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			switch msg.Text {
+			case "what about football?":
+				return bot.Response{CheckResults: []lib.CheckResult{{Name: "openai", Details: "unrelated, category: off-topic, warn"},
+					{Name: lib.CheckOpenAICategory, Details: "off-topic, warn, unrelated"}}}
+			case "you all are idiots":
+				return bot.Response{CheckResults: []lib.CheckResult{{Name: "openai", Details: "rude, category: harassment, report"},
+					{Name: lib.CheckOpenAICategory, Details: "harassment, report, rude"}}}
+			}
+			return bot.Response{}
+		},
+		IsNewUserFunc: func(id int64) bool { return true },
+	}
+	sampler := &mocks.HamSamplerMock{SampleFunc: func(msg string) bool { return true }}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator, HamSampler: sampler,
+		CategoryWarning: "{user}, this is {category}"}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	srv.Push(tgtest.Message(100, tgtest.User(1, "user1"), "what about football?"))
+	srv.AssertSent(t, 100, "this is off-topic")
+	srv.ResetRequests()
+
+	srv.Push(tgtest.Message(100, tgtest.User(2, "user2"), "you all are idiots"))
+	srv.AssertSent(t, 200, "is harassment, report, rude")
+	srv.ResetRequests()
+
+	srv.Push(tgtest.Message(100, tgtest.User(3, "user3"), "hello everyone"))
+	assert.Eventually(t, func() bool { return len(sampler.SampleCalls()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "hello everyone", sampler.SampleCalls()[0].Msg, "categorized messages not sampled as ham")
+	srv.AssertNoRequest(t, "sendMessage", 100*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// channelAllowed checks if the message sent on behalf of the chat, i.e. the linked channel, is allowed without checks.
+// Failure to check is logged only, the message is checked then.
+func (l *TelegramListener) channelAllowed(chatID int64) bool {
+	if l.Channels == nil || chatID == 0 {
+		return false
+	}
+	_, ok, err := l.Channels.Get(chatID)
+	if err != nil {
+		log.Printf("[WARN] failed to check allowed channel %d, %v", chatID, err)
+		return false
+	}
+	return ok
+}
+
+// allowChannelCommand allows the channel to post in the group on its behalf on "/allowchannel <chat id> [name]" command
+// of super-user in admin chat, i.e. "/allowchannel -1001234567890 linked channel". Messages of allowed channels are
+// not checked. The command is ignored if allowed channels are not supported.
+func (a *admin) allowChannelCommand(msg *tbapi.Message) error {
+	if a.channels == nil {
+		return nil
+	}
+	args := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 2)
+	chatID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || chatID == 0 {
+		return fmt.Errorf("invalid allowchannel command %q, expected /allowchannel <chat id> [name]", msg.Text)
+	}
+	ch := storage.AllowedChannel{ChatID: chatID, AddedBy: adminSource(msg.From)}
+	if len(args) > 1 {
+		ch.Name = strings.TrimSpace(args[1])
+	}
+	if err = a.channels.Add(ch); err != nil {
+		return fmt.Errorf("failed to allow channel %d: %w", chatID, err)
+	}
+	log.Printf("[INFO] channel %d allowed by %s", chatID, ch.AddedBy)
+	auditAdd(a.audit, storage.ModerationAction{Action: "allowchannel", UserID: chatID, Actor: ch.AddedBy, Details: ch.Name})
+	text := fmt.Sprintf("channel %d allowed, messages on behalf of it are not checked", chatID)
+	if err = send(tbapi.NewMessage(a.adminChatID, text), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send allowchannel confirmation: %w", err)
+	}
+	return nil
+}
+
+// blockChannelCommand removes the channel from allowed ones on "/blockchannel <chat id>" command of super-user
+// in admin chat, messages on behalf of it are checked as any other. Channels allowed by options can't be removed.
+func (a *admin) blockChannelCommand(msg *tbapi.Message) error {
+	if a.channels == nil {
+		return nil
+	}
+	chatID, err := strconv.ParseInt(strings.TrimSpace(msg.CommandArguments()), 10, 64)
+	if err != nil || chatID == 0 {
+		return fmt.Errorf("invalid blockchannel command %q, expected /blockchannel <chat id>", msg.Text)
+	}
+	if err = a.channels.Remove(chatID); err != nil {
+		return fmt.Errorf("failed to block channel %d: %w", chatID, err)
+	}
+	log.Printf("[INFO] channel %d blocked by %s", chatID, adminSource(msg.From))
+	auditAdd(a.audit, storage.ModerationAction{Action: "blockchannel", UserID: chatID, Actor: adminSource(msg.From)})
+	text := fmt.Sprintf("channel %d blocked, messages on behalf of it are checked", chatID)
+	if err = send(tbapi.NewMessage(a.adminChatID, text), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send blockchannel confirmation: %w", err)
+	}
+	return nil
+}
+
+// channelsCommand lists allowed channels on "/channels" command of super-user in admin chat
+func (a *admin) channelsCommand() error {
+	if a.channels == nil {
+		return nil
+	}
+	channels, err := a.channels.List()
+	if err != nil {
+		return fmt.Errorf("failed to list allowed channels: %w", err)
+	}
+	lines := []string{fmt.Sprintf("allowed channels: %d", len(channels))}
+	for _, ch := range channels {
+		line := fmt.Sprintf("- %d, by %s", ch.ChatID, ch.AddedBy)
+		if ch.Name != "" {
+			line += ": " + ch.Name
+		}
+		lines = append(lines, line)
+	}
+	if err = send(tbapi.NewMessage(a.adminChatID, escapeMarkDownV1Text(strings.Join(lines, "\n"))), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send allowed channels: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestTelegramListener_AllowedChannels(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			return bot.Response{Send: true, Text: "spam detected", BanInterval: time.Hour, User: msg.From, ReplyTo: msg.ID,
+				DeleteReplyTo: true, CheckResults: []lib.CheckResult{{Name: "stopword", Spam: true, Details: "subscribe"}}}
+		},
+		IsNewUserFunc: func(id int64) bool { return false },
+	}
+	channels := &mocks.AllowedChannelsMock{GetFunc: func(chatID int64) (storage.AllowedChannel, bool, error) {
+		switch chatID {
+		case -1001:
+			return storage.AllowedChannel{ChatID: -1001, Name: "linked"}, true, nil
+		case -1003:
+			return storage.AllowedChannel{}, false, errors.New("db error")
+		}
+		return storage.AllowedChannel{}, false, nil
+	}}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator, Channels: channels}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	onBehalf := func(chatID int64, userID int64, text string) tbapi.Update {
+		upd := tgtest.Message(100, tgtest.User(userID, "Channel_Bot"), text)
+		upd.Message.SenderChat = &tbapi.Chat{ID: chatID, Type: "channel"}
+		return upd
+	}
+	srv.Push(onBehalf(-1001, 136817688, "subscribe to the new release"))
+	srv.AssertNoRequest(t, "restrictChatMember", 100*time.Millisecond)
+	assert.Empty(t, b.OnMessageCalls(), "message of allowed channel not checked")
+
+	srv.Push(onBehalf(-1002, 136817601, "subscribe to cheap pills"))
+	srv.AssertBanned(t, 100, 136817601)
+
+	srv.Push(onBehalf(-1003, 136817602, "subscribe to cheap pills"))
+	srv.AssertBanned(t, 100, 136817602) // failed check of allowed channel doesn't skip the check
+	assert.Len(t, b.OnMessageCalls(), 2)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestAdmin_channelCommands(t *testing.T) {
+	command := func(text string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{Text: text, From: &tbapi.User{UserName: "admin"},
+			Entities: []tbapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(strings.Fields(text)[0])}}}}
+	}
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	channels := &mocks.AllowedChannelsMock{
+		AddFunc: func(ch storage.AllowedChannel) error { return nil },
+		RemoveFunc: func(chatID int64) error {
+			if chatID == -1003 {
+				return errors.New("channel -1003 is allowed by options")
+			}
+			return nil
+		},
+		ListFunc: func() ([]storage.AllowedChannel, error) {
+			return []storage.AllowedChannel{{ChatID: -1003, AddedBy: storage.AllowedChannelsConfig, Timestamp: ts},
+				{ChatID: -1001, Name: "linked_channel", AddedBy: "admin:admin", Timestamp: ts}}, nil
+		},
+	}
+	audit := &mocks.ModerationAuditMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123, channels: channels, audit: audit}
+
+	require.NoError(t, adm.MsgHandler(command("/allowchannel -1001 linked channel")))
+	require.Len(t, channels.AddCalls(), 1)
+	assert.Equal(t, storage.AllowedChannel{ChatID: -1001, Name: "linked channel", AddedBy: "admin:admin"},
+		channels.AddCalls()[0].Ch)
+	require.Len(t, audit.AddCalls(), 1)
+	assert.Equal(t, storage.ModerationAction{Action: "allowchannel", UserID: -1001, Actor: "admin:admin",
+		Details: "linked channel"}, audit.AddCalls()[0].Action)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	assert.Equal(t, "channel -1001 allowed, messages on behalf of it are not checked",
+		mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+
+	require.NoError(t, adm.MsgHandler(command("/blockchannel -1001")))
+	require.Len(t, channels.RemoveCalls(), 1)
+	assert.Equal(t, int64(-1001), channels.RemoveCalls()[0].ChatID)
+	assert.Equal(t, storage.ModerationAction{Action: "blockchannel", UserID: -1001, Actor: "admin:admin"},
+		audit.AddCalls()[1].Action)
+	assert.ErrorContains(t, adm.MsgHandler(command("/blockchannel -1003")), "allowed by options")
+
+	mockAPI.ResetCalls()
+	require.NoError(t, adm.MsgHandler(command("/channels")))
+	require.Len(t, mockAPI.SendCalls(), 1)
+	assert.Equal(t, "allowed channels: 2\n- -1003, by config\n- -1001, by admin:admin: linked\\_channel",
+		mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+
+	t.Run("invalid commands", func(t *testing.T) {
+		channels.ResetCalls()
+		require.Error(t, adm.MsgHandler(command("/allowchannel")))
+		require.Error(t, adm.MsgHandler(command("/allowchannel bad")))
+		require.Error(t, adm.MsgHandler(command("/blockchannel")))
+		require.Error(t, adm.MsgHandler(command("/blockchannel -1001 more")))
+		assert.Empty(t, channels.AddCalls())
+		assert.Empty(t, channels.RemoveCalls())
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		adm := admin{tbAPI: mockAPI, adminChatID: 123}
+		require.NoError(t, adm.MsgHandler(command("/allowchannel -1001")))
+		require.NoError(t, adm.MsgHandler(command("/channels")))
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+}
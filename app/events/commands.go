@@ -0,0 +1,152 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// commandRe matches the bot command at the start of the message, i.e. "/start@promo_bot", with optional bot name
+var commandRe = regexp.MustCompile(`^/([a-zA-Z0-9_]{1,32})(?:@([a-zA-Z0-9_]{3,}))?(?:\s|$)`)
+
+// pinCommands are commands asking group management bots to pin the message, abused to pin promo of spammers
+var pinCommands = map[string]bool{"pin": true, "pinned": true, "permapin": true, "loudpin": true}
+
+// commandsCleanup is the number of tracked users after which users with no recent commands are removed on insert
+const commandsCleanup = 1000
+
+// commandGuard checks bot commands of new users for abuse: commands of other bots with promo text,
+// i.e. "/start@promo_bot join us", requests to pin messages, and bursts of commands flooding the group.
+// Commands of a user are tracked in memory for the window, to detect bursts, or with the shared counter if set,
+// so bursts split between instances are detected too. Memory is used if the shared counter failed.
+type commandGuard struct {
+	limit   int // max number of commands of the user in the window, more is a flood
+	window  time.Duration
+	now     func() time.Time
+	counter CommandsCounter // optional, counter shared by instances
+
+	lock     sync.Mutex
+	recent   map[int64][]time.Time // times of recent commands by user, the newest first
+	reported map[int64]time.Time   // last report of the user, reported once in the window
+}
+
+func newCommandGuard(limit int, window time.Duration) *commandGuard {
+	if limit <= 0 {
+		limit = 3
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &commandGuard{limit: limit, window: window, now: time.Now, recent: map[int64][]time.Time{},
+		reported: map[int64]time.Time{}}
+}
+
+// check checks the message of the new user. Returns the result with found=false if the message is not a command,
+// or the command is not abusive. report is true for the first abusive command of the user in the window.
+// The result is never spam, it is a signal for admins.
+func (g *commandGuard) check(msg bot.Message) (cr lib.CheckResult, found, report bool) {
+	m := commandRe.FindStringSubmatch(msg.Text)
+	if m == nil {
+		return lib.CheckResult{}, false, false
+	}
+	cmd, botName := strings.ToLower(m[1]), m[2]
+	payload := strings.TrimSpace(msg.Text[len(m[0]):])
+
+	now := g.now()
+	count := g.count(msg.From.ID, now)
+
+	var details string
+	switch {
+	case count > g.limit:
+		details = fmt.Sprintf("flood of bot commands: %d in %v", count, g.window)
+	case pinCommands[cmd]:
+		details = fmt.Sprintf("request to pin message: /%s", cmd)
+	case botName != "" && payload != "":
+		details = fmt.Sprintf("command of other bot with text: /%s@%s", cmd, botName)
+	default:
+		return lib.CheckResult{}, false, false
+	}
+	return lib.CheckResult{Name: "command", Spam: false, Details: details}, true, g.reportOnce(msg.From.ID, now)
+}
+
+// count records the command of the user and returns the number of commands of the user in the window
+func (g *commandGuard) count(userID int64, now time.Time) int {
+	if g.counter != nil {
+		n, err := g.counter.Count(userID, now, g.window)
+		if err == nil {
+			return n
+		}
+		log.Printf("[WARN] failed to count commands of user %d with shared counter, counted in memory, %v", userID, err)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.recent) >= commandsCleanup {
+		for id, times := range g.recent {
+			if now.Sub(times[0]) > g.window { // the newest first
+				delete(g.recent, id)
+				delete(g.reported, id)
+			}
+		}
+	}
+	times := []time.Time{now}
+	for _, t := range g.recent[userID] {
+		if now.Sub(t) <= g.window {
+			times = append(times, t)
+		}
+	}
+	g.recent[userID] = times
+	return len(times)
+}
+
+// reportOnce returns true for the first abusive command of the user in the window
+func (g *commandGuard) reportOnce(userID int64, now time.Time) bool {
+	if g.counter != nil {
+		report, err := g.counter.Report(userID, g.window)
+		if err == nil {
+			return report
+		}
+		log.Printf("[WARN] failed to check report of user %d with shared counter, checked in memory, %v", userID, err)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if last, ok := g.reported[userID]; ok && now.Sub(last) <= g.window {
+		return false
+	}
+	g.reported[userID] = now
+	return true
+}
+
+// checkCommand checks the message of the new user for abuse of bot commands. Abusive command is reported
+// to admin chat, once in the window, and deleted with CommandsDelete set. Returns true if the command is abusive.
+func (l *TelegramListener) checkCommand(msg bot.Message, resp *bot.Response) bool {
+	cr, found, report := l.commands.check(msg)
+	if !found {
+		return false
+	}
+	resp.CheckResults = append(resp.CheckResults, cr)
+	user := bot.User{ID: msg.From.ID, Username: msg.From.Username, DisplayName: msg.From.DisplayName}
+	log.Printf("[INFO] new user %v abuses bot commands, %s", user, cr.Details)
+	if report {
+		if err := l.AdminAlert(fmt.Sprintf("new user %v abuses bot commands, %s:\n%s", user, cr.Details, excerpt(msg.Text))); err != nil {
+			log.Printf("[WARN] failed to report commands of user %d, %v", user.ID, err)
+		}
+	}
+
+	if dry, training := l.Modes(); !l.CommandsDelete || dry || training {
+		return true
+	}
+	if _, err := l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: msg.ChatID, MessageID: msg.ID}); err != nil {
+		log.Printf("[WARN] failed to delete command %d of user %d, %v", msg.ID, user.ID, err)
+	}
+	return true
+}
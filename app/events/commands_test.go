@@ -0,0 +1,139 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestCommandGuard_check(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	g := newCommandGuard(0, 0)
+	assert.Equal(t, 3, g.limit)
+	assert.Equal(t, time.Minute, g.window)
+	g.now = func() time.Time { return now }
+	msg := func(userID int64, text string) bot.Message {
+		return bot.Message{Text: text, From: bot.User{ID: userID}}
+	}
+
+	_, found, _ := g.check(msg(1, "hello /start"))
+	assert.False(t, found, "not a command")
+	_, found, _ = g.check(msg(1, "/start"))
+	assert.False(t, found, "plain command")
+	_, found, _ = g.check(msg(1, "/start@some_bot"))
+	assert.False(t, found, "command of other bot without text")
+
+	cr, found, report := g.check(msg(2, "/start@promo_bot join us t.me/promo"))
+	assert.True(t, found)
+	assert.True(t, report)
+	assert.Equal(t, lib.CheckResult{Name: "command", Spam: false, Details: "command of other bot with text: /start@promo_bot"}, cr)
+
+	cr, found, report = g.check(msg(2, "/PIN"))
+	assert.True(t, found)
+	assert.False(t, report, "reported once in the window")
+	assert.Equal(t, "request to pin message: /pin", cr.Details)
+
+	_, found, _ = g.check(msg(1, "/help"))
+	assert.False(t, found, "third command in the window")
+	cr, found, _ = g.check(msg(1, "/help"))
+	assert.True(t, found, "fourth command in the window")
+	assert.Equal(t, "flood of bot commands: 4 in 1m0s", cr.Details)
+
+	now = now.Add(2 * time.Minute)
+	_, found, _ = g.check(msg(1, "/help"))
+	assert.False(t, found, "old commands expired")
+	_, found, report = g.check(msg(2, "/pin"))
+	assert.True(t, found)
+	assert.True(t, report, "reported again after the window")
+}
+
+func TestCommandGuard_checkShared(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	count, reported := 0, false
+	counter := &mocks.CommandsCounterMock{
+		CountFunc: func(userID int64, at time.Time, window time.Duration) (int, error) {
+			if userID == 3 {
+				return 0, errors.New("redis is down")
+			}
+			count++
+			return count, nil
+		},
+		ReportFunc: func(userID int64, window time.Duration) (bool, error) {
+			res := !reported
+			reported = true
+			return res, nil
+		},
+	}
+	g := newCommandGuard(2, time.Minute)
+	g.counter = counter
+	g.now = func() time.Time { return now }
+	msg := func(userID int64, text string) bot.Message {
+		return bot.Message{Text: text, From: bot.User{ID: userID}}
+	}
+
+	_, found, _ := g.check(msg(1, "/help"))
+	assert.False(t, found)
+	count = 5 // commands counted by other instances
+	cr, found, report := g.check(msg(1, "/help"))
+	assert.True(t, found)
+	assert.True(t, report)
+	assert.Equal(t, "flood of bot commands: 6 in 1m0s", cr.Details)
+	_, _, report = g.check(msg(1, "/help"))
+	assert.False(t, report, "reported by shared counter")
+	require.Len(t, counter.CountCalls(), 3)
+	assert.Equal(t, int64(1), counter.CountCalls()[0].UserID)
+	assert.Equal(t, now, counter.CountCalls()[0].At)
+	assert.Equal(t, time.Minute, counter.CountCalls()[0].Window)
+
+	for i := 0; i < 2; i++ {
+		_, found, _ = g.check(msg(3, "/help"))
+		assert.False(t, found, "counted in memory on failure")
+	}
+	cr, found, _ = g.check(msg(3, "/help"))
+	assert.True(t, found)
+	assert.Equal(t, "flood of bot commands: 3 in 1m0s", cr.Details)
+}
+
+func TestTelegramListener_CommandsCheck(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response { return bot.Response{} },
+		IsNewUserFunc: func(id int64) bool { return id != 3 },
+	}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator,
+		CommandsCheck: true, CommandsDelete: true}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	upd := srv.Push(tgtest.Command(100, tgtest.User(1, "promo"), "/start@promo_bot earn with us"))
+	srv.AssertSent(t, 200, "abuses bot commands, command of other bot with text: /start@promo\\_bot")
+	srv.AssertDeleted(t, 100, upd.Message.MessageID)
+	srv.ResetRequests()
+
+	srv.Push(tgtest.Command(100, tgtest.User(2, "user"), "/help"))
+	srv.Push(tgtest.Command(100, tgtest.User(3, "approved"), "/pin"))
+	srv.AssertNoRequest(t, "deleteMessage", 100*time.Millisecond)
+	assert.Empty(t, srv.Requests("sendMessage"))
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// deleteCheckInterval is the interval to check messages scheduled for deletion
+const deleteCheckInterval = time.Second
+
+// deleteTask is a message scheduled for deletion
+type deleteTask struct {
+	chatID int64
+	msgID  int
+	at     time.Time
+}
+
+// deleteQueue keeps messages scheduled for deletion, i.e. bot's replies about spam, and deletes them once due.
+// Tasks are kept in memory only, so tasks pending on exit are done right away by flush.
+type deleteQueue struct {
+	tbAPI TbAPI
+	now   func() time.Time
+
+	lock  sync.Mutex
+	tasks []deleteTask
+}
+
+func newDeleteQueue(tbAPI TbAPI) *deleteQueue {
+	return &deleteQueue{tbAPI: tbAPI, now: time.Now}
+}
+
+// schedule adds the message to delete after the duration
+func (q *deleteQueue) schedule(chatID int64, msgID int, after time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.tasks = append(q.tasks, deleteTask{chatID: chatID, msgID: msgID, at: q.now().Add(after)})
+	log.Printf("[DEBUG] message %d in chat %d scheduled for deletion in %v", msgID, chatID, after)
+}
+
+// deleteDue deletes messages due by now, returns the number of deleted messages
+func (q *deleteQueue) deleteDue() int {
+	now := q.now()
+	q.lock.Lock()
+	var due, pending []deleteTask
+	for _, t := range q.tasks {
+		if t.at.After(now) {
+			pending = append(pending, t)
+			continue
+		}
+		due = append(due, t)
+	}
+	q.tasks = pending
+	q.lock.Unlock()
+	return q.delete(due)
+}
+
+// flush deletes all scheduled messages, due or not, returns the number of deleted messages
+func (q *deleteQueue) flush() int {
+	q.lock.Lock()
+	tasks := q.tasks
+	q.tasks = nil
+	q.lock.Unlock()
+	return q.delete(tasks)
+}
+
+// delete deletes messages of the tasks, failures are logged only, as the message may be deleted already
+func (q *deleteQueue) delete(tasks []deleteTask) (deleted int) {
+	for _, t := range tasks {
+		if _, err := q.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: t.chatID, MessageID: t.msgID}); err != nil {
+			log.Printf("[WARN] failed to delete scheduled message %d in chat %d, %v", t.msgID, t.chatID, err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
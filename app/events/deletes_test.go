@@ -0,0 +1,43 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestDeleteQueue(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+		if c.(tbapi.DeleteMessageConfig).MessageID == 3 {
+			return nil, errors.New("message to delete not found")
+		}
+		return &tbapi.APIResponse{Ok: true}, nil
+	}}
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	q := newDeleteQueue(mockAPI)
+	q.now = func() time.Time { return now }
+
+	q.schedule(123, 1, time.Minute)
+	q.schedule(123, 2, 10*time.Second)
+	q.schedule(456, 3, 10*time.Second)
+	assert.Zero(t, q.deleteDue(), "nothing is due yet")
+	assert.Empty(t, mockAPI.RequestCalls())
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, 1, q.deleteDue(), "failed deletion is not counted")
+	require.Len(t, mockAPI.RequestCalls(), 2)
+	assert.Equal(t, tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 2}, mockAPI.RequestCalls()[0].C)
+	assert.Equal(t, tbapi.DeleteMessageConfig{ChatID: 456, MessageID: 3}, mockAPI.RequestCalls()[1].C)
+	assert.Zero(t, q.deleteDue(), "failed deletion is not retried")
+
+	assert.Equal(t, 1, q.flush(), "not due message deleted on flush")
+	require.Len(t, mockAPI.RequestCalls(), 3)
+	assert.Equal(t, tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 1}, mockAPI.RequestCalls()[2].C)
+	assert.Zero(t, q.flush())
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"fmt"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Diagnostic is a result of a check of the listener's configuration, Err is nil if the check passed
+type Diagnostic struct {
+	Name string // name of the check
+	Info string // details of the passed check, i.e. resolved chat id
+	Err  error  // error with a hint how to fix it, nil if passed
+}
+
+// Diagnose checks telegram configuration of the listener without receiving updates: the token is valid,
+// the primary and admin groups can be resolved, and the bot can delete messages and ban users in the primary group.
+// Checks depending on a failed one are skipped. It is used to troubleshoot the configuration, before running the listener.
+func (l *TelegramListener) Diagnose() []Diagnostic {
+	me, err := l.TbAPI.GetMe()
+	if err != nil {
+		return []Diagnostic{{Name: "telegram token",
+			Err: fmt.Errorf("can't get bot info, check the token given by @BotFather: %w", err)}}
+	}
+	res := []Diagnostic{{Name: "telegram token", Info: fmt.Sprintf("bot @%s (%d)", me.UserName, me.ID)}}
+
+	chatID, err := l.resolveChat(l.Group)
+	if err != nil {
+		return append(res, Diagnostic{Name: "group " + l.Group,
+			Err: fmt.Errorf("%w, set the group by its id, or check the public name of the group", err)})
+	}
+	res = append(res, Diagnostic{Name: "group " + l.Group, Info: fmt.Sprintf("chat id %d", chatID)})
+
+	if err = l.botPermissions(chatID); err != nil {
+		res = append(res, Diagnostic{Name: "bot permissions",
+			Err: fmt.Errorf("%w, make the bot an administrator of the group with rights to delete messages and ban users", err)})
+	} else {
+		res = append(res, Diagnostic{Name: "bot permissions", Info: "can delete messages and ban users"})
+	}
+
+	if l.AdminGroup == "" {
+		return res
+	}
+	adminChatID, err := l.resolveChat(l.AdminGroup)
+	if err != nil {
+		return append(res, Diagnostic{Name: "admin group " + l.AdminGroup,
+			Err: fmt.Errorf("%w, set the admin group by its id and add the bot to it", err)})
+	}
+	return append(res, Diagnostic{Name: "admin group " + l.AdminGroup, Info: fmt.Sprintf("chat id %d", adminChatID)})
+}
+
+// resolveChat returns id of the chat set by id or public name, and checks the bot has access to it
+func (l *TelegramListener) resolveChat(group string) (int64, error) {
+	chatID, err := l.getChatID(group)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = l.TbAPI.GetChat(tbapi.ChatInfoConfig{ChatConfig: tbapi.ChatConfig{ChatID: chatID}}); err != nil {
+		return 0, fmt.Errorf("can't access chat %d: %w", chatID, err)
+	}
+	return chatID, nil
+}
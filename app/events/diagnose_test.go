@@ -0,0 +1,72 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestTelegramListener_Diagnose(t *testing.T) {
+	newAPI := func(member tbapi.ChatMember) *mocks.TbAPIMock {
+		return &mocks.TbAPIMock{
+			GetMeFunc: func() (tbapi.User, error) { return tbapi.User{ID: 42, UserName: "spam_bot"}, nil },
+			GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) {
+				switch {
+				case config.SuperGroupUsername == "@mygroup":
+					return tbapi.Chat{ID: 123}, nil
+				case config.ChatID == 123 || config.ChatID == 456:
+					return tbapi.Chat{ID: config.ChatID}, nil
+				}
+				return tbapi.Chat{}, errors.New("chat not found")
+			},
+			GetChatMemberFunc: func(config tbapi.GetChatMemberConfig) (tbapi.ChatMember, error) { return member, nil },
+		}
+	}
+	admin := tbapi.ChatMember{Status: "administrator", CanDeleteMessages: true, CanRestrictMembers: true}
+
+	t.Run("all passed", func(t *testing.T) {
+		mockAPI := newAPI(admin)
+		l := TelegramListener{TbAPI: mockAPI, Group: "mygroup", AdminGroup: "456"}
+		res := l.Diagnose()
+		require.Len(t, res, 4)
+		for _, d := range res {
+			assert.NoError(t, d.Err, d.Name)
+		}
+		assert.Equal(t, Diagnostic{Name: "telegram token", Info: "bot @spam_bot (42)"}, res[0])
+		assert.Equal(t, Diagnostic{Name: "group mygroup", Info: "chat id 123"}, res[1])
+		assert.Equal(t, "bot permissions", res[2].Name)
+		assert.Equal(t, Diagnostic{Name: "admin group 456", Info: "chat id 456"}, res[3])
+		assert.Equal(t, int64(123), mockAPI.GetChatMemberCalls()[0].Config.ChatID)
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		mockAPI := newAPI(admin)
+		mockAPI.GetMeFunc = func() (tbapi.User, error) { return tbapi.User{}, errors.New("unauthorized") }
+		l := TelegramListener{TbAPI: mockAPI, Group: "mygroup"}
+		res := l.Diagnose()
+		require.Len(t, res, 1, "other checks skipped")
+		assert.ErrorContains(t, res[0].Err, "check the token given by @BotFather: unauthorized")
+	})
+
+	t.Run("unknown group", func(t *testing.T) {
+		l := TelegramListener{TbAPI: newAPI(admin), Group: "other"}
+		res := l.Diagnose()
+		require.Len(t, res, 2)
+		assert.ErrorContains(t, res[1].Err, "can't get chat for other: chat not found, set the group by its id")
+	})
+
+	t.Run("no permissions and admin group not accessible", func(t *testing.T) {
+		l := TelegramListener{TbAPI: newAPI(tbapi.ChatMember{Status: "administrator", CanDeleteMessages: true}),
+			Group: "123", AdminGroup: "789"}
+		res := l.Diagnose()
+		require.Len(t, res, 4)
+		assert.NoError(t, res[1].Err)
+		assert.ErrorContains(t, res[2].Err, "bot has no rights to ban users, make the bot an administrator")
+		assert.ErrorContains(t, res[3].Err, "can't access chat 789: chat not found, set the admin group by its id")
+	})
+}
@@ -0,0 +1,284 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+const (
+	evasionNameSimilarity = 0.8  // min similarity of normalized usernames and display names, by edit distance
+	evasionMsgSimilarity  = 0.6  // min similarity of messages, by shared words
+	evasionMinNameLen     = 3    // shorter normalized names are not compared, too many false matches
+	evasionMinMsgWords    = 3    // messages with fewer words are not compared
+	evasionMaxRecent      = 1000 // max number of recent fingerprints compared with the new user
+	evasionMaxAlerted     = 1000 // number of alerted users after which the set is cleared
+	evasionMinMatches     = 2    // min number of matched parts of the fingerprint to report the user
+)
+
+// evasionChecker detects banned spammers re-joining with a new account. Fingerprints of banned users, username,
+// display name and the spam message, are kept for the window, and new users are compared with them.
+// The user matching at least two parts of a recent fingerprint is reported once, as likely ban evasion.
+type evasionChecker struct {
+	store  BanFingerprints
+	window time.Duration
+
+	lock    sync.Mutex
+	alerted map[int64]struct{} // users already reported
+}
+
+// evasionMatch is a recent fingerprint matched by the new user, with names of the matched parts
+type evasionMatch struct {
+	banned storage.BanFingerprint
+	parts  []string
+}
+
+func newEvasionChecker(store BanFingerprints, window time.Duration) *evasionChecker {
+	if window <= 0 {
+		window = 30 * 24 * time.Hour
+	}
+	return &evasionChecker{store: store, window: window, alerted: map[int64]struct{}{}}
+}
+
+// record keeps the fingerprint of the banned user and expires old ones. Failure is logged only, the ban is done.
+// The user known by id only, i.e. banned with api, has nothing to match and is not recorded.
+func (e *evasionChecker) record(user bot.User, msg string) {
+	if e == nil || user.ID == 0 || (user.Username == "" && user.DisplayName == "" && msg == "") {
+		return
+	}
+	fp := storage.BanFingerprint{UserID: user.ID, UserName: user.Username, DisplayName: user.DisplayName, Message: msg}
+	if err := e.store.Add(fp); err != nil {
+		log.Printf("[WARN] failed to record ban fingerprint of %v, %v", user, err)
+	}
+	if _, err := e.store.Expire(e.window); err != nil {
+		log.Printf("[WARN] failed to expire ban fingerprints, %v", err)
+	}
+}
+
+// forget removes the fingerprint of the unbanned user
+func (e *evasionChecker) forget(userID int64) {
+	if e == nil {
+		return
+	}
+	if err := e.store.Remove(userID); err != nil {
+		log.Printf("[WARN] failed to remove ban fingerprint of %d, %v", userID, err)
+	}
+}
+
+// onAction records fingerprints of users banned for real and forgets unbanned ones, subscribed to action executed events.
+// Banned channels have no fingerprints to match.
+func (e *evasionChecker) onAction(ev Event) {
+	if ev.Dry {
+		return
+	}
+	switch ev.Action {
+	case ActionBan:
+		if ev.ChannelID == 0 {
+			e.record(ev.User, ev.Text)
+		}
+	case ActionUnban:
+		e.forget(ev.User.ID)
+	}
+}
+
+// check compares the new user and the message, empty on join, with recent fingerprints.
+// Returns the best match, if the user is not reported yet.
+func (e *evasionChecker) check(user bot.User, msg string) (evasionMatch, bool) {
+	if e == nil || user.ID == 0 {
+		return evasionMatch{}, false
+	}
+	e.lock.Lock()
+	_, alerted := e.alerted[user.ID]
+	e.lock.Unlock()
+	if alerted {
+		return evasionMatch{}, false
+	}
+
+	recent, err := e.store.Recent(time.Now().Add(-e.window), evasionMaxRecent)
+	if err != nil {
+		log.Printf("[WARN] failed to get recent ban fingerprints, %v", err)
+		return evasionMatch{}, false
+	}
+	best := evasionMatch{}
+	for _, fp := range recent {
+		if fp.UserID == user.ID {
+			continue
+		}
+		if parts := matchFingerprint(fp, user, msg); len(parts) > len(best.parts) {
+			best = evasionMatch{banned: fp, parts: parts}
+		}
+	}
+	if len(best.parts) < evasionMinMatches {
+		return evasionMatch{}, false
+	}
+
+	e.lock.Lock()
+	if len(e.alerted) >= evasionMaxAlerted {
+		e.alerted = map[int64]struct{}{}
+	}
+	e.alerted[user.ID] = struct{}{}
+	e.lock.Unlock()
+	return best, true
+}
+
+// matchFingerprint returns names of the parts of the fingerprint similar to the user and the message
+func matchFingerprint(fp storage.BanFingerprint, user bot.User, msg string) []string {
+	res := []string{}
+	if similarNames(fp.UserName, user.Username) {
+		res = append(res, "username")
+	}
+	if similarNames(fp.DisplayName, user.DisplayName) {
+		res = append(res, "name")
+	}
+	if similarMessages(fp.Message, msg) {
+		res = append(res, "message")
+	}
+	return res
+}
+
+// similarNames compares names normalized to lowercase letters, so "Anna_2024" and "anna.2025" are the same.
+// Similarity is 1 - edit distance / length of the longer name.
+func similarNames(a, b string) bool {
+	na, nb := normalizeName(a), normalizeName(b)
+	if len(na) < evasionMinNameLen || len(nb) < evasionMinNameLen {
+		return false
+	}
+	dist := levenshtein(na, nb)
+	return 1-float64(dist)/float64(max(len(na), len(nb))) >= evasionNameSimilarity
+}
+
+// normalizeName keeps lowercase letters of the name only, digits, spaces and punctuation are dropped
+func normalizeName(s string) []rune {
+	res := make([]rune, 0, len(s))
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// levenshtein returns the edit distance between two strings of runes
+func levenshtein(a, b []rune) int {
+	prev, curr := make([]int, len(b)+1), make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// similarMessages compares sets of lowercase words of messages, similarity is the share of common words
+func similarMessages(a, b string) bool {
+	wa, wb := messageWords(a), messageWords(b)
+	if len(wa) < evasionMinMsgWords || len(wb) < evasionMinMsgWords {
+		return false
+	}
+	common := 0
+	for w := range wa {
+		if _, ok := wb[w]; ok {
+			common++
+		}
+	}
+	return float64(common)/float64(len(wa)+len(wb)-common) >= evasionMsgSimilarity
+}
+
+// messageWords returns the set of lowercase words of the message, made of letters and digits
+func messageWords(s string) map[string]struct{} {
+	res := map[string]struct{}{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		res[w] = struct{}{}
+	}
+	return res
+}
+
+// checkEvasion reports the new user matching a fingerprint of the recently banned user to admin chat,
+// with a button to ban the user. msg is empty on join.
+func (l *TelegramListener) checkEvasion(user bot.User, msg string) {
+	if l.evasion == nil || l.adminChatID == 0 {
+		return
+	}
+	m, ok := l.evasion.check(user, msg)
+	if !ok {
+		return
+	}
+	log.Printf("[INFO] new user %v is likely %v evading ban, similar %s", user, m.banned.UserID, strings.Join(m.parts, ", "))
+	if err := l.adminHandler.ReportEvasion(user, msg, m); err != nil {
+		log.Printf("[WARN] failed to report ban evasion of %v, %v", user, err)
+	}
+}
+
+// ReportEvasion sends the report of likely ban evasion to admin chat, with a button to ban the user
+func (a *admin) ReportEvasion(user bot.User, msg string, m evasionMatch) error {
+	banned := bot.User{ID: m.banned.UserID, Username: m.banned.UserName, DisplayName: m.banned.DisplayName}
+	text := fmt.Sprintf("likely ban evasion, new user %v is similar to %v banned %v ago, same %s",
+		user, banned, time.Since(m.banned.Timestamp).Round(time.Minute), strings.Join(m.parts, ", "))
+	if msg != "" {
+		text += ":\n" + excerpt(msg)
+	}
+	tbMsg := tbapi.NewMessage(a.adminChatID, escapeMarkDownV1Text(text))
+	tbMsg.ReplyMarkup = tbapi.NewInlineKeyboardMarkup(tbapi.NewInlineKeyboardRow(
+		tbapi.NewInlineKeyboardButtonData("⛔︎ ban", fmt.Sprintf("%s%d", evasionBanPrefix, user.ID)),
+	))
+	return send(tbMsg, a.tbAPI)
+}
+
+// callbackEvasionBan handles the callback of ban button of ban evasion report. The user is banned permanently,
+// in training mode too, as the ban is requested by admin, but not in dry mode.
+// callback data: #userID
+func (a *admin) callbackEvasionBan(query *tbapi.CallbackQuery) error {
+	userID, err := strconv.ParseInt(query.Data[1:], 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse callback's userID %q: %w", query.Data[1:], err)
+	}
+	dry, _ := a.modes()
+	banReq := banRequest{duration: bot.PermanentBanDuration, userID: userID, chatID: a.primChatID, tbAPI: a.tbAPI, dry: dry}
+	if err := banUserOrChannel(banReq); err != nil {
+		return fmt.Errorf("failed to ban user %d: %w", userID, err)
+	}
+	a.bus.Publish(Event{Kind: EventActionExecuted, ChatID: a.primChatID, User: bot.User{ID: userID}, Action: ActionBan,
+		Dry: dry, Source: adminSource(query.From)})
+	if !dry {
+		log.Printf("[INFO] user %d banned for ban evasion by %s", userID, query.From.UserName)
+		a.bot.RemoveApprovedUsers(userID)
+		a.bus.Publish(Event{Kind: EventAdminDecision, ChatID: a.primChatID, User: bot.User{ID: userID}, Action: DecisionSpam,
+			Source: adminSource(query.From)})
+	}
+
+	updText := query.Message.Text + fmt.Sprintf("\n\n_banned by %s in %v_",
+		query.From.UserName, time.Since(time.Unix(int64(query.Message.Date), 0)).Round(time.Second))
+	editMsg := tbapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, updText)
+	editMsg.ReplyMarkup = &tbapi.InlineKeyboardMarkup{InlineKeyboard: [][]tbapi.InlineKeyboardButton{}}
+	if err := send(editMsg, a.tbAPI); err != nil {
+		return fmt.Errorf("failed to clear ban button, chatID:%d, msgID:%d, %w", query.Message.Chat.ID, query.Message.MessageID, err)
+	}
+	a.deleteResolved(query.Message)
+	return nil
+}
+
+// forwardName returns the display name of the sender of the forwarded message, empty if unknown
+func forwardName(msg *tbapi.Message) string {
+	if msg.ForwardFrom != nil {
+		return strings.TrimSpace(msg.ForwardFrom.FirstName + " " + msg.ForwardFrom.LastName)
+	}
+	return msg.ForwardSenderName
+}
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func TestEvasionChecker_check(t *testing.T) {
+	recent := []storage.BanFingerprint{
+		{UserID: 1, UserName: "anna_crypto2024", DisplayName: "Anna Crypto", Message: "earn 1000$ a day with my signals, dm me",
+			Timestamp: time.Now().Add(-time.Hour)},
+		{UserID: 2, UserName: "bob", DisplayName: "Bob", Timestamp: time.Now().Add(-time.Hour)},
+	}
+	store := &mocks.BanFingerprintsMock{
+		RecentFunc: func(since time.Time, limit int) ([]storage.BanFingerprint, error) { return recent, nil },
+		AddFunc:    func(fp storage.BanFingerprint) error { return nil },
+		ExpireFunc: func(ttl time.Duration) (int64, error) { return 0, nil },
+		RemoveFunc: func(userID int64) error { return nil },
+	}
+	e := newEvasionChecker(store, 0)
+	assert.Equal(t, 30*24*time.Hour, e.window)
+
+	m, ok := e.check(bot.User{ID: 10, Username: "Anna.Crypto2025", DisplayName: "Anna Krypto"}, "")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), m.banned.UserID)
+	assert.Equal(t, []string{"username", "name"}, m.parts)
+	require.Len(t, store.RecentCalls(), 1)
+	assert.Equal(t, evasionMaxRecent, store.RecentCalls()[0].Limit)
+	assert.WithinDuration(t, time.Now().Add(-30*24*time.Hour), store.RecentCalls()[0].Since, time.Minute)
+
+	_, ok = e.check(bot.User{ID: 10, Username: "Anna.Crypto2025", DisplayName: "Anna Krypto"}, "")
+	assert.False(t, ok, "reported once")
+
+	m, ok = e.check(bot.User{ID: 11, Username: "signals_pro", DisplayName: "Anna Crypto"},
+		"Earn 1000$ a day with my signals! DM me")
+	require.True(t, ok)
+	assert.Equal(t, []string{"name", "message"}, m.parts)
+
+	_, ok = e.check(bot.User{ID: 12, Username: "bobby", DisplayName: "Alice"}, "hello everyone")
+	assert.False(t, ok, "single match is not enough")
+	_, ok = e.check(bot.User{ID: 1, Username: "anna_crypto2024", DisplayName: "Anna Crypto"}, "")
+	assert.False(t, ok, "banned user itself is not matched")
+
+	store.RecentFunc = func(since time.Time, limit int) ([]storage.BanFingerprint, error) { return nil, errors.New("db error") }
+	_, ok = e.check(bot.User{ID: 13, Username: "Anna.Crypto2025", DisplayName: "Anna Krypto"}, "")
+	assert.False(t, ok)
+
+	var nilChecker *evasionChecker
+	_, ok = nilChecker.check(bot.User{ID: 13}, "")
+	assert.False(t, ok)
+	nilChecker.record(bot.User{ID: 13}, "")
+	nilChecker.forget(13)
+}
+
+func TestEvasionChecker_recordForget(t *testing.T) {
+	store := &mocks.BanFingerprintsMock{
+		AddFunc:    func(fp storage.BanFingerprint) error { return nil },
+		ExpireFunc: func(ttl time.Duration) (int64, error) { return 1, nil },
+		RemoveFunc: func(userID int64) error { return nil },
+	}
+	e := newEvasionChecker(store, time.Hour)
+	e.record(bot.User{ID: 1, Username: "spammer", DisplayName: "Spam Bot"}, "buy now")
+	e.record(bot.User{}, "no user")
+	require.Len(t, store.AddCalls(), 1)
+	assert.Equal(t, storage.BanFingerprint{UserID: 1, UserName: "spammer", DisplayName: "Spam Bot", Message: "buy now"},
+		store.AddCalls()[0].Fp)
+	require.Len(t, store.ExpireCalls(), 1)
+	assert.Equal(t, time.Hour, store.ExpireCalls()[0].TTL)
+
+	e.forget(1)
+	require.Len(t, store.RemoveCalls(), 1)
+	assert.Equal(t, int64(1), store.RemoveCalls()[0].UserID)
+
+	e.onAction(Event{Kind: EventActionExecuted, User: bot.User{ID: 2, Username: "dry"}, Action: ActionBan, Dry: true})
+	e.onAction(Event{Kind: EventActionExecuted, User: bot.User{ID: 3, Username: "chan"}, ChannelID: 5, Action: ActionBan})
+	e.onAction(Event{Kind: EventActionExecuted, User: bot.User{ID: 4, Username: "spammer2"}, Text: "sell", Action: ActionBan})
+	e.onAction(Event{Kind: EventActionExecuted, User: bot.User{ID: 4}, Action: ActionUnban})
+	require.Len(t, store.AddCalls(), 2, "dry and channel bans not recorded")
+	assert.Equal(t, storage.BanFingerprint{UserID: 4, UserName: "spammer2", Message: "sell"}, store.AddCalls()[1].Fp)
+	require.Len(t, store.RemoveCalls(), 2)
+	assert.Equal(t, int64(4), store.RemoveCalls()[1].UserID)
+}
+
+func TestEvasion_similarity(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		res  bool
+	}{
+		{"anna_2024", "Anna.2025", true},
+		{"cryptoking", "crypto_kinq", true},
+		{"cryptoking", "gopher", false},
+		{"al", "al", false},
+		{"", "", false},
+		{"Анна Крипто", "анна крипто!", true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.res, similarNames(tt.a, tt.b))
+		})
+	}
+
+	assert.True(t, similarMessages("Join my channel for free signals", "join my CHANNEL for free signals!!"))
+	assert.False(t, similarMessages("Join my channel for free signals", "what time is the meeting today"))
+	assert.False(t, similarMessages("hi there", "hi there"), "too short")
+	assert.False(t, similarMessages("Join my channel for free signals", ""))
+}
+
+func TestAdmin_callbackEvasionBan(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	b := &mocks.BotMock{RemoveApprovedUsersFunc: func(id int64, ids ...int64) {}}
+	query := &tbapi.CallbackQuery{Data: "#777", From: &tbapi.User{UserName: "admin"},
+		Message: &tbapi.Message{MessageID: 987, Chat: &tbapi.Chat{ID: 123}, Text: "likely ban evasion"}}
+	dry := false
+	adm := admin{tbAPI: mockAPI, bot: b, adminChatID: 123, primChatID: 456, deletes: newDeleteQueue(mockAPI),
+		modes: func() (bool, bool) { return dry, false }}
+
+	require.NoError(t, adm.InlineCallbackHandler(query))
+	require.Len(t, mockAPI.RequestCalls(), 1)
+	banReq, ok := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	require.True(t, ok)
+	assert.Equal(t, int64(456), banReq.ChatID)
+	assert.Equal(t, int64(777), banReq.UserID)
+	require.Len(t, b.RemoveApprovedUsersCalls(), 1)
+	assert.Equal(t, int64(777), b.RemoveApprovedUsersCalls()[0].ID)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	edit := mockAPI.SendCalls()[0].C.(tbapi.EditMessageTextConfig)
+	assert.Contains(t, edit.Text, "likely ban evasion\n\n_banned by admin in ")
+
+	dry = true
+	require.NoError(t, adm.InlineCallbackHandler(query))
+	assert.Len(t, mockAPI.RequestCalls(), 1, "not banned in dry mode")
+	assert.Len(t, b.RemoveApprovedUsersCalls(), 1)
+
+	query.Data = "#bad"
+	assert.Error(t, adm.InlineCallbackHandler(query))
+}
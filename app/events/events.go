@@ -1,6 +1,7 @@
 package events
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webhook"
 	"github.com/umputun/tg-spam/lib"
 )
 
@@ -17,6 +19,17 @@ import (
 //go:generate moq --out mocks/spam_logger.go --pkg mocks --with-resets --skip-ensure . SpamLogger
 //go:generate moq --out mocks/bot.go --pkg mocks --with-resets --skip-ensure . Bot
 //go:generate moq --out mocks/spam_web.go --pkg mocks --with-resets --skip-ensure . SpamWeb
+//go:generate moq --out mocks/stats.go --pkg mocks --with-resets --skip-ensure . Stats
+//go:generate moq --out mocks/notifier.go --pkg mocks --with-resets --skip-ensure . Notifier
+//go:generate moq --out mocks/ham_sampler.go --pkg mocks --with-resets --skip-ensure . HamSampler
+//go:generate moq --out mocks/denylist.go --pkg mocks --with-resets --skip-ensure . Denylist
+//go:generate moq --out mocks/commands_counter.go --pkg mocks --with-resets --skip-ensure . CommandsCounter
+//go:generate moq --out mocks/ban_fingerprints.go --pkg mocks --with-resets --skip-ensure . BanFingerprints
+//go:generate moq --out mocks/user_notes.go --pkg mocks --with-resets --skip-ensure . UserNotes
+//go:generate moq --out mocks/moderation_audit.go --pkg mocks --with-resets --skip-ensure . ModerationAudit
+//go:generate moq --out mocks/protected_users.go --pkg mocks --with-resets --skip-ensure . ProtectedUsers
+//go:generate moq --out mocks/allowed_channels.go --pkg mocks --with-resets --skip-ensure . AllowedChannels
+//go:generate moq --out mocks/quota.go --pkg mocks --with-resets --skip-ensure . Quota
 
 // TbAPI is an interface for telegram bot API, only subset of methods used
 type TbAPI interface {
@@ -25,6 +38,8 @@ type TbAPI interface {
 	Request(c tbapi.Chattable) (*tbapi.APIResponse, error)
 	GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error)
 	GetChatAdministrators(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error)
+	GetChatMember(config tbapi.GetChatMemberConfig) (tbapi.ChatMember, error)
+	GetMe() (tbapi.User, error)
 }
 
 // SpamLogger is an interface for spam logger
@@ -43,19 +58,127 @@ func (f SpamLoggerFunc) Save(msg *bot.Message, response *bot.Response) {
 // Locator is an interface for message locator
 type Locator interface {
 	AddMessage(msg string, chatID, userID int64, userName string, msgID int) error
-	AddSpam(userID int64, checks []lib.CheckResult) error
-	Message(msg string) (storage.MsgMeta, bool)
-	Spam(userID int64) (storage.SpamData, bool)
+	AddSpam(chatID, userID int64, checks []lib.CheckResult) error
+	Message(chatID int64, msg string) (storage.MsgMeta, bool)
+	Spam(chatID, userID int64) (storage.SpamData, bool)
+	ChatMessages(chatID, userID int64) ([]storage.MsgMeta, error)
+	RecentMessages(chatID int64, limit int) ([]storage.MsgMeta, error)
 	MsgHash(msg string) string
+	AddEntities(chatID int64, msgID int, entities string) error
+	Original(chatID int64, msgID int) (storage.MsgMeta, bool)
+}
+
+// Stats is an interface for stats of checked messages and detections reversed by admins
+type Stats interface {
+	Inc(chatID int64, spam, degraded bool)
+	SetReversed(chatID, userID int64) (bool, error)
+}
+
+// Notifier is an interface for notifications of moderation events, i.e. webhooks
+type Notifier interface {
+	Notify(event webhook.Event)
+}
+
+// HamSampler is an interface for recording messages passed all checks as candidates of ham samples
+type HamSampler interface {
+	Sample(msg string) bool
+}
+
+// Denylist is an interface of denylist shared with peer instances, confirmed bans are listed and unbans are removed
+type Denylist interface {
+	Add(userID int64, msg string) error
+	Remove(userID int64) error
+}
+
+// CommandsCounter is an interface of counter of bot commands of users shared by instances, i.e. in redis
+type CommandsCounter interface {
+	Count(userID int64, at time.Time, window time.Duration) (int, error) // record the command, return commands in the window
+	Report(userID int64, window time.Duration) (bool, error)             // true if the user is not reported in the window yet
+}
+
+// BanFingerprints is an interface of fingerprints of banned users, matched against new users to detect ban evasion
+type BanFingerprints interface {
+	Add(fp storage.BanFingerprint) error
+	Remove(userID int64) error
+	Recent(since time.Time, limit int) ([]storage.BanFingerprint, error)
+	Expire(ttl time.Duration) (int64, error)
+}
+
+// UserNotes is an interface of notes of moderators about users, added with /note command and shown in ban reports
+type UserNotes interface {
+	Add(note storage.UserNote) (storage.UserNote, error)
+	ByUser(userID int64, limit int) ([]storage.UserNote, error)
+}
+
+// ModerationAudit is an interface of audit of moderation actions, bans and unbans of the bot and admins are recorded
+type ModerationAudit interface {
+	Add(action storage.ModerationAction) error
+}
+
+// ProtectedUsers is an interface of users never banned by the bot, spam verdicts of them are reported to admin chat.
+// Users are protected and unprotected with /protect and /unprotect commands of super-users in admin chat.
+type ProtectedUsers interface {
+	Add(user storage.ProtectedUser) error
+	Remove(userID int64) error
+	Get(userID int64) (storage.ProtectedUser, bool, error)
+	List() ([]storage.ProtectedUser, error)
+}
+
+// AllowedChannels is an interface of channels allowed to post in the group on their behalf, i.e. the linked channel,
+// their messages are not checked. Channels are allowed and blocked with /allowchannel and /blockchannel commands
+// of super-users in admin chat.
+type AllowedChannels interface {
+	Add(ch storage.AllowedChannel) error
+	Remove(chatID int64) error
+	Get(chatID int64) (storage.AllowedChannel, bool, error)
+	List() ([]storage.AllowedChannel, error)
+}
+
+// Quota is an interface of usage quota, i.e. of the tenant in multi-tenant mode, messages are not checked
+// while checks are stopped by the quota
+type Quota interface {
+	ChecksStopped() bool
 }
 
 // Bot is an interface for bot events.
 type Bot interface {
-	OnMessage(msg bot.Message) (response bot.Response)
-	UpdateSpam(msg string) error
-	UpdateHam(msg string) error
+	OnMessage(ctx context.Context, msg bot.Message) (response bot.Response)
+	OnJoin(ctx context.Context, user bot.User) (response bot.Response)
+	UpdateSpam(msg, source string) error
+	UpdateHam(msg, source string) error
 	AddApprovedUsers(id int64, ids ...int64)
 	RemoveApprovedUsers(id int64, ids ...int64)
+	IsNewUser(id int64) bool
+}
+
+// denylistAdd lists the banned user with the spam message, if denylist is set. Failure is logged only, the ban is done.
+func denylistAdd(dl Denylist, userID int64, msg string) {
+	if dl == nil || userID == 0 {
+		return
+	}
+	if err := dl.Add(userID, msg); err != nil {
+		log.Printf("[WARN] failed to add user %d to denylist, %v", userID, err)
+	}
+}
+
+// denylistRemove removes the unbanned user from denylist, if set
+func denylistRemove(dl Denylist, userID int64) {
+	if dl == nil {
+		return
+	}
+	if err := dl.Remove(userID); err != nil {
+		log.Printf("[WARN] failed to remove user %d from denylist, %v", userID, err)
+	}
+}
+
+// auditAdd records the moderation action, if audit is set. Failure is logged only, the action is done.
+func auditAdd(audit ModerationAudit, rec storage.ModerationAction) {
+	if audit == nil {
+		return
+	}
+	if err := audit.Add(rec); err != nil {
+		log.Printf("[WARN] failed to record %s of user %d to audit, %v", rec.Action, rec.UserID, err)
+	}
 }
 
 func escapeMarkDownV1Text(text string) string {
@@ -68,6 +191,12 @@ func escapeMarkDownV1Text(text string) string {
 
 // send a message to the telegram as markdown first and if failed - as plain text
 func send(tbMsg tbapi.Chattable, tbAPI TbAPI) error {
+	_, err := sendMessage(tbMsg, tbAPI)
+	return err
+}
+
+// sendMessage is send returning the sent message, i.e. to delete it later
+func sendMessage(tbMsg tbapi.Chattable, tbAPI TbAPI) (tbapi.Message, error) {
 	withParseMode := func(tbMsg tbapi.Chattable, parseMode string) tbapi.Chattable {
 		switch msg := tbMsg.(type) {
 		case tbapi.MessageConfig:
@@ -85,14 +214,15 @@ func send(tbMsg tbapi.Chattable, tbAPI TbAPI) error {
 	}
 
 	msg := withParseMode(tbMsg, tbapi.ModeMarkdown) // try markdown first
-	if _, err := tbAPI.Send(msg); err != nil {
+	sent, err := tbAPI.Send(msg)
+	if err != nil {
 		log.Printf("[WARN] failed to send message as markdown, %v", err)
 		msg = withParseMode(tbMsg, "") // try plain text
-		if _, err := tbAPI.Send(msg); err != nil {
-			return fmt.Errorf("can't send message to telegram: %w", err)
+		if sent, err = tbAPI.Send(msg); err != nil {
+			return tbapi.Message{}, fmt.Errorf("can't send message to telegram: %w", err)
 		}
 	}
-	return nil
+	return sent, nil
 }
 
 type banRequest struct {
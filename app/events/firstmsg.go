@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// firstMessageCheckInterval is the interval to check first messages held for aggregation
+const firstMessageCheckInterval = 250 * time.Millisecond
+
+// heldKey is a key of the held first message, user in the chat
+type heldKey struct {
+	chatID int64
+	userID int64
+}
+
+// heldMessage is the first message of a new user, held to be checked together with immediate follow-ups,
+// i.e. a short innocent greeting followed by a spam link in the next message
+type heldMessage struct {
+	update    tbapi.Update // update of the first message
+	texts     []string     // texts of the first message and follow-ups
+	followUps []int        // ids of follow-up messages, deleted with the first one if spam
+	due       time.Time    // time to check the messages
+}
+
+// holdFirstMessage holds the first message of a new user for FirstMessageWindow, follow-ups of the user sent
+// during the window are added to the held message. Returns true if the update is held and shouldn't be processed now.
+func (l *TelegramListener) holdFirstMessage(update tbapi.Update) bool {
+	if l.FirstMessageWindow <= 0 || update.Message == nil || update.Message.From == nil || update.Message.Chat == nil {
+		return false
+	}
+	msg := update.Message
+	if !l.isChatAllowed(msg.Chat.ID) || strings.TrimSpace(msg.Text) == "" || l.SuperUsers.IsSuper(msg.From.UserName) {
+		return false
+	}
+
+	key := heldKey{chatID: msg.Chat.ID, userID: msg.From.ID}
+	if held, ok := l.held[key]; ok {
+		held.texts = append(held.texts, msg.Text)
+		held.followUps = append(held.followUps, msg.MessageID)
+		log.Printf("[DEBUG] follow-up message %d of new user %d added to the held one", msg.MessageID, msg.From.ID)
+		return true
+	}
+	if !l.Bot.IsNewUser(msg.From.ID) {
+		return false
+	}
+	l.held[key] = &heldMessage{update: update, texts: []string{msg.Text}, due: time.Now().Add(l.FirstMessageWindow)}
+	log.Printf("[DEBUG] first message %d of new user %d held for %v", msg.MessageID, msg.From.ID, l.FirstMessageWindow)
+	return true
+}
+
+// releaseFirstMessages processes held messages due by now, or all of them if all is set, i.e. on exit.
+// Follow-ups are joined to the text of the first message, so the verdict is made on all of them.
+func (l *TelegramListener) releaseFirstMessages(ctx context.Context, all bool) {
+	now := time.Now()
+	for key, held := range l.held {
+		if !all && now.Before(held.due) {
+			continue
+		}
+		delete(l.held, key)
+		update := held.update
+		msg := *update.Message
+		msg.Text = strings.Join(held.texts, "\n")
+		update.Message = &msg
+		if err := l.procEvents(ctx, update, held.followUps...); err != nil {
+			log.Printf("[WARN] failed to process held first message: %v", err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/umputun/tg-spam/app/bot"
+)
+
+// welcome greets the user joined the chat, if Greeting is set, and restricts the user from posting media
+// and link previews for NewcomerRestrict, if set. Plain text messages are allowed, so the user can introduce
+// themselves, while the detector checks them as usual. Nothing is restricted in dry and training modes.
+func (l *TelegramListener) welcome(chatID int64, user bot.User) error {
+	errs := new(multierror.Error)
+	dry, training := l.Modes()
+	if l.NewcomerRestrict > 0 && !dry && !training {
+		if err := restrictNewcomer(l.TbAPI, chatID, user.ID, l.NewcomerRestrict); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to restrict newcomer %v: %w", user, err))
+		} else {
+			log.Printf("[INFO] newcomer %v restricted from posting media and links for %v", user, l.NewcomerRestrict)
+		}
+	}
+
+	if l.Greeting != "" && !training {
+		text := strings.ReplaceAll(l.Greeting, "{user}", mention(user))
+		sent, err := l.sendBotResponse(bot.Response{Send: true, Text: text}, chatID)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to greet %v: %w", user, err))
+		}
+		if err == nil && l.GreetingTTL > 0 {
+			l.deletes.schedule(chatID, sent.MessageID, l.GreetingTTL)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// restrictNewcomer restricts the user from sending media, stickers, polls and link previews for the duration,
+// text messages are allowed. Telegram can't restrict plain links in text, only their previews.
+func restrictNewcomer(tbAPI TbAPI, chatID, userID int64, duration time.Duration) error {
+	resp, err := tbAPI.Request(tbapi.RestrictChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: chatID, UserID: userID},
+		UntilDate:        time.Now().Add(duration).Unix(),
+		Permissions: &tbapi.ChatPermissions{
+			CanSendMessages:       true,
+			CanSendMediaMessages:  false,
+			CanSendPolls:          false,
+			CanSendOtherMessages:  false,
+			CanAddWebPagePreviews: false,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
+	}
+	return nil
+}
+
+// mention makes markdown mention of the user, by name if set, by username otherwise
+func mention(user bot.User) string {
+	name := user.DisplayName
+	if name == "" {
+		name = user.Username
+	}
+	if name == "" {
+		name = fmt.Sprintf("%d", user.ID)
+	}
+	name = strings.NewReplacer("[", "", "]", "").Replace(name) // brackets can't be escaped in text of the link
+	return fmt.Sprintf("[%s](tg://user?id=%d)", escapeMarkDownV1Text(name), user.ID)
+}
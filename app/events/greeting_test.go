@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestTelegramListener_welcome(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{MessageID: 42}, nil },
+	}
+	b := &mocks.BotMock{OnJoinFunc: func(ctx context.Context, user bot.User) bot.Response {
+		if user.ID == 1 {
+			return bot.Response{Send: true, BanInterval: bot.PermanentBanDuration, User: user}
+		}
+		return bot.Response{}
+	}}
+	l := &TelegramListener{TbAPI: mockAPI, Bot: b, JoinCheck: true, JoinBan: true, chatID: 123,
+		Greeting: "welcome, {user}! no ads here", GreetingTTL: time.Hour, NewcomerRestrict: 24 * time.Hour,
+		deletes: newDeleteQueue(mockAPI)}
+	l.running.Store(true)
+
+	join := func(userID int64, firstName string) *tbapi.ChatMemberUpdated {
+		return &tbapi.ChatMemberUpdated{Chat: tbapi.Chat{ID: 123}, OldChatMember: tbapi.ChatMember{Status: "left"},
+			NewChatMember: tbapi.ChatMember{Status: "member", User: &tbapi.User{ID: userID, FirstName: firstName}}}
+	}
+
+	require.NoError(t, l.procJoin(context.Background(), join(2, "new_[user]")))
+	require.Len(t, mockAPI.RequestCalls(), 1)
+	req := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(2), req.UserID)
+	assert.InDelta(t, time.Now().Add(24*time.Hour).Unix(), req.UntilDate, 5)
+	assert.Equal(t, tbapi.ChatPermissions{CanSendMessages: true}, *req.Permissions, "text allowed only")
+	require.Len(t, mockAPI.SendCalls(), 1)
+	msg := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, int64(123), msg.ChatID)
+	assert.Equal(t, `welcome, [new\_user](tg://user?id=2)! no ads here`, msg.Text)
+	require.Len(t, l.deletes.tasks, 1)
+	assert.Equal(t, 42, l.deletes.tasks[0].msgID, "greeting scheduled for deletion")
+
+	t.Run("banned spammer not greeted", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		require.NoError(t, l.procJoin(context.Background(), join(1, "spammer")))
+		require.Len(t, mockAPI.RequestCalls(), 1, "banned only")
+		assert.False(t, mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).Permissions.CanSendMessages)
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+
+	t.Run("dry and training modes", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		l.JoinCheck = false
+		l.SetModes(true, false)
+		require.NoError(t, l.procJoin(context.Background(), join(3, "user")))
+		assert.Empty(t, mockAPI.RequestCalls(), "not restricted in dry mode")
+		assert.Len(t, mockAPI.SendCalls(), 1, "greeted in dry mode")
+
+		l.SetModes(false, true)
+		require.NoError(t, l.procJoin(context.Background(), join(4, "user")))
+		assert.Empty(t, mockAPI.RequestCalls())
+		assert.Len(t, mockAPI.SendCalls(), 1, "not greeted in training mode")
+	})
+}
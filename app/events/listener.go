@@ -4,45 +4,134 @@
 //
 // In addition to that, it provides support for admin chat handling allowing to unban users via the web service and
 // update the list of spam samples.
+//
+// Events of processing, i.e. detected spam, bans and decisions of admins, are published to the Bus,
+// and consumers, like webhooks, stats and denylist, subscribe to them instead of being called by the listener.
 package events
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/tracing"
+	"github.com/umputun/tg-spam/lib"
 )
 
+// readyCheckInterval is the min interval between telegram connectivity checks of Ready
+const readyCheckInterval = 10 * time.Second
+
+// autoTrainSource is the source of spam samples added by auto-training on confident bans
+const autoTrainSource = storage.SampleSourceAuto + ":ban"
+
+// maxProcessingTime is the max time of processing an update, the loop is considered stuck by Alive after it
+const maxProcessingTime = 5 * time.Minute
+
 // TelegramListener listens to tg update, forward to bots and send back responses
 // Not thread safe
 type TelegramListener struct {
-	TbAPI        TbAPI
-	SpamLogger   SpamLogger
-	Bot          Bot
-	Group        string // can be int64 or public group username (without "@" prefix)
-	AdminGroup   string // can be int64 or public group username (without "@" prefix)
-	IdleDuration time.Duration
-	SuperUsers   SuperUsers
-	TestingIDs   []int64
-	StartupMsg   string
-	NoSpamReply  bool
-	TrainingMode bool
-	Dry          bool
-	KeepUser     bool
-	Locator      Locator
+	TbAPI         TbAPI
+	Bot           Bot
+	Group         string // can be int64 or public group username (without "@" prefix)
+	AdminGroup    string // can be int64 or public group username (without "@" prefix)
+	IdleDuration  time.Duration
+	SuperUsers    SuperUsers
+	AdminsRefresh time.Duration // interval to re-fetch chat admins as super-users, 0 - fetch once on start
+	PermsCheck    time.Duration // interval to verify bot still has delete/ban rights in the group, 0 - disabled
+	TestingIDs    []int64
+	StartupMsg    string
+	StartupReport func() string // optional, summary of configuration posted to admin chat on start, with modes and permissions
+	NoSpamReply   bool
+	TrainingMode  bool // can be changed at runtime with SetModes
+	Dry           bool // can be changed at runtime with SetModes
+	KeepUser      bool
+	Locator       Locator
+	HamSampler    HamSampler      // optional, records a share of messages passed all checks as candidates of ham samples
+	Reload        func() error    // optional, reloads configuration on /reload command of super-users in admin chat
+	Audit         ModerationAudit // optional, records bans and unbans of the bot and admins, and reloads by admins
+	Bus           *Bus            // optional, events of processing are published to subscribers, i.e. spam logger, stats and webhooks, made if not set
+
+	SpamReplyTTL     time.Duration // delete bot's reply about spam after this duration, 0 - keep the reply
+	AdminResolvedTTL time.Duration // delete admin chat notification after this duration once resolved, 0 - keep it
+
+	AutoTrain float64 // min confidence of the ban in percents to add the message to spam samples, pending for admins below, 0 - disabled
+
+	FirstMessageWindow time.Duration // hold the first message of a new user to check it with follow-ups, 0 - disabled
+	ConversationSize   int           // recent messages of the group passed to checks as context, with replied one, 0 - disabled
+	CategoryWarning    string        // reply to message of openai category with warn action, "{user}" and "{category}" are replaced
+
+	JoinCheck bool // check users on join with CAS and lols.bot, the bot should be admin to get chat_member updates
+	JoinBan   bool // ban users found as known spammers on join, only reported to admin chat otherwise
+
+	Greeting         string        // greeting of new members with rules, posted on join, "{user}" is replaced with mention of the user
+	GreetingTTL      time.Duration // delete the greeting after this duration, 0 - keep it
+	NewcomerRestrict time.Duration // new members can't post media and link previews for this duration after join, 0 - disabled
+
+	BioCheck     bool          // check profile bio of new users with clean messages for promo links, reported to admin chat
+	BioCacheTTL  time.Duration // time to keep results of bio checks, 24h if not set
+	BioShowLinks bool          // show links of bio in reports, only their number otherwise
+
+	CommandsCheck  bool            // check bot commands of new users for abuse, reported to admin chat
+	CommandsLimit  int             // max bot commands of new user in the window, more is a flood, 3 if not set
+	CommandsWindow time.Duration   // window of bot commands flood, 1m if not set
+	CommandsDelete bool            // delete abusive bot commands of new users
+	CommandsShared CommandsCounter // optional, counter of bot commands shared by instances, counted in memory if not set
+
+	AnomalyCheck     bool    // report messages deviating sharply from stats of the first messages of the user to admin chat
+	AnomalyProbation int     // number of first messages of the user making the stats, at least 3
+	AnomalyFactor    float64 // message longer than average of the user by this factor is an anomaly, 5 if not set
+	AnomalyMinLen    int     // messages shorter than this are never anomalies, 300 if not set
+
+	BanEvasion       BanFingerprints // optional, fingerprints of banned users, new users matching them are reported to admin chat
+	BanEvasionWindow time.Duration   // fingerprints of banned users are kept for this duration, 30 days if not set
+
+	Notes UserNotes // optional, notes of moderators about users, added with /note command and shown in ban reports
+
+	Protected ProtectedUsers // optional, users never banned by the bot, their spam verdicts are reported to admin chat
+
+	Channels AllowedChannels // optional, channels allowed to post on their behalf, i.e. the linked one, not checked
+
+	Quota Quota // optional, messages are not checked while checks are stopped by the quota
 
 	adminHandler *admin
+	bio          *bioChecker              // nil if BioCheck is not set
+	evasion      *evasionChecker          // nil if BanEvasion is not set
+	commands     *commandGuard            // nil if CommandsCheck is not set
+	anomaly      *anomalyGuard            // nil if AnomalyCheck is not set
+	deletes      *deleteQueue             // messages scheduled for deletion
+	held         map[heldKey]*heldMessage // first messages of new users, held for FirstMessageWindow
 	chatID       int64
 	adminChatID  int64
+	modesLock    sync.RWMutex // guards Dry and TrainingMode
+
+	configuredSupers SuperUsers // super-users set by config, kept to rebuild the list on admins refresh
+	supersOnce       sync.Once
+	busOnce          sync.Once // bus is made once, on first use, if not set
+
+	perms struct {
+		sync.RWMutex
+		err error // last permissions check error, nil if bot has all the rights needed
+	}
+
+	running   atomic.Bool  // listener receives updates, set by Do
+	heartbeat atomic.Int64 // time of the last iteration of the processing loop, unix nanoseconds
+	ready     struct {
+		sync.Mutex
+		checked time.Time // time of the last connectivity check
+		err     error     // last connectivity check error, nil if telegram is reachable
+	}
 
 	msgs struct {
 		once sync.Once
@@ -54,7 +143,7 @@ type TelegramListener struct {
 func (l *TelegramListener) Do(ctx context.Context) error {
 	log.Printf("[INFO] start telegram listener for %q", l.Group)
 
-	if l.TrainingMode {
+	if _, training := l.Modes(); training {
 		log.Printf("[WARN] training mode, no bans")
 	}
 
@@ -84,22 +173,97 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 	})
 
 	// send startup message if any set
-	if l.StartupMsg != "" && !l.TrainingMode && !l.Dry {
-		if err := l.sendBotResponse(bot.Response{Send: true, Text: l.StartupMsg}, l.chatID); err != nil {
+	if dry, training := l.Modes(); l.StartupMsg != "" && !training && !dry {
+		if _, err := l.sendBotResponse(bot.Response{Send: true, Text: l.StartupMsg}, l.chatID); err != nil {
 			log.Printf("[WARN] failed to send startup message, %v", err)
 		}
 	}
 
-	l.adminHandler = &admin{tbAPI: l.TbAPI, bot: l.Bot, locator: l.Locator, primChatID: l.chatID, adminChatID: l.adminChatID,
-		superUsers: l.SuperUsers, trainingMode: l.TrainingMode, keepUser: l.KeepUser, dry: l.Dry}
+	l.deletes = newDeleteQueue(l.TbAPI)
+	if l.BioCheck {
+		l.bio = newBioChecker(l.TbAPI, l.BioCacheTTL, l.BioShowLinks)
+		log.Printf("[INFO] profile bio of new users checked for links")
+	}
+	if l.CommandsCheck {
+		l.commands = newCommandGuard(l.CommandsLimit, l.CommandsWindow)
+		l.commands.counter = l.CommandsShared
+		log.Printf("[INFO] bot commands of new users checked for abuse, flood is more than %d in %v, delete: %v",
+			l.commands.limit, l.commands.window, l.CommandsDelete)
+	}
+	if l.AnomalyCheck {
+		l.anomaly = newAnomalyGuard(l.AnomalyProbation, l.AnomalyFactor, l.AnomalyMinLen)
+		log.Printf("[INFO] messages checked for anomaly after %d first ones, %.1fx of average length, min %d characters",
+			l.anomaly.probation, l.anomaly.factor, l.anomaly.minLen)
+	}
+	if l.BanEvasion != nil {
+		l.evasion = newEvasionChecker(l.BanEvasion, l.BanEvasionWindow)
+		l.events().Subscribe(l.evasion.onAction, EventActionExecuted) // fingerprints of banned users, removed on unban
+		log.Printf("[INFO] new users checked for ban evasion, fingerprints kept for %v", l.evasion.window)
+	}
+	defer func() {
+		if n := l.deletes.flush(); n > 0 {
+			log.Printf("[INFO] %d scheduled messages deleted on exit", n)
+		}
+	}()
+
+	l.adminHandler = &admin{tbAPI: l.TbAPI, bot: l.Bot, locator: l.Locator, bus: l.events(), primChatID: l.chatID,
+		adminChatID: l.adminChatID, superUsers: l.SuperUsers, keepUser: l.KeepUser, modes: l.Modes, reload: l.Reload,
+		deletes: l.deletes, resolvedTTL: l.AdminResolvedTTL, notes: l.Notes, audit: l.Audit, protected: l.Protected,
+		channels: l.Channels}
 	log.Printf("[DEBUG] admin handler created. %+v", l.adminHandler)
 
 	u := tbapi.NewUpdate(0)
 	u.Timeout = 60
+	if l.JoinCheck || l.Greeting != "" || l.NewcomerRestrict > 0 || l.BanEvasion != nil {
+		// chat_member updates are sent only if requested explicitly
+		u.AllowedUpdates = []string{"message", "edited_message", "callback_query", "chat_member"}
+	}
 
 	updates := l.TbAPI.GetUpdatesChan(u)
+	l.running.Store(true)
+	defer l.running.Store(false)
+
+	var adminsRefreshCh <-chan time.Time // nil channel blocks forever, i.e. no refresh
+	if l.AdminsRefresh > 0 {
+		adminsTicker := time.NewTicker(l.AdminsRefresh)
+		defer adminsTicker.Stop()
+		adminsRefreshCh = adminsTicker.C
+		log.Printf("[INFO] chat admins refresh every %v", l.AdminsRefresh)
+	}
+
+	var permsCheckCh <-chan time.Time
+	if l.PermsCheck > 0 {
+		l.checkPermissions() // initial check, reports problems to admin chat right away
+		permsTicker := time.NewTicker(l.PermsCheck)
+		defer permsTicker.Stop()
+		permsCheckCh = permsTicker.C
+		log.Printf("[INFO] bot permissions check every %v", l.PermsCheck)
+	}
+
+	if l.StartupReport != nil && l.adminChatID != 0 {
+		l.sendStartupReport()
+	}
+
+	var deleteCh <-chan time.Time
+	if l.SpamReplyTTL > 0 || l.AdminResolvedTTL > 0 || l.GreetingTTL > 0 {
+		deleteTicker := time.NewTicker(deleteCheckInterval)
+		defer deleteTicker.Stop()
+		deleteCh = deleteTicker.C
+		log.Printf("[INFO] delete spam replies after %v, resolved admin notifications after %v", l.SpamReplyTTL, l.AdminResolvedTTL)
+	}
+
+	l.held = map[heldKey]*heldMessage{}
+	defer l.releaseFirstMessages(context.WithoutCancel(ctx), true) // held messages are checked on exit, before scheduled deletes
+	var firstMsgCh <-chan time.Time
+	if l.FirstMessageWindow > 0 {
+		firstMsgTicker := time.NewTicker(firstMessageCheckInterval)
+		defer firstMsgTicker.Stop()
+		firstMsgCh = firstMsgTicker.C
+		log.Printf("[INFO] first messages of new users held for %v", l.FirstMessageWindow)
+	}
 
 	for {
+		l.heartbeat.Store(time.Now().UnixNano())
 		select {
 
 		case <-ctx.Done():
@@ -113,7 +277,7 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 			if update.Message != nil && l.isAdminChat(update.Message.Chat.ID, update.Message.From.UserName) {
 				if err := l.adminHandler.MsgHandler(update); err != nil {
 					log.Printf("[WARN] failed to process admin chat message: %v", err)
-					_ = l.sendBotResponse(bot.Response{Send: true, Text: "error: " + err.Error()}, l.adminChatID)
+					_, _ = l.sendBotResponse(bot.Response{Send: true, Text: "error: " + err.Error()}, l.adminChatID)
 				}
 				continue
 			}
@@ -121,7 +285,14 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 			if update.CallbackQuery != nil {
 				if err := l.adminHandler.InlineCallbackHandler(update.CallbackQuery); err != nil {
 					log.Printf("[WARN] failed to process callback: %v", err)
-					_ = l.sendBotResponse(bot.Response{Send: true, Text: "error: " + err.Error()}, l.adminChatID)
+					_, _ = l.sendBotResponse(bot.Response{Send: true, Text: "error: " + err.Error()}, l.adminChatID)
+				}
+				continue
+			}
+
+			if update.ChatMember != nil {
+				if err := l.procJoin(context.WithoutCancel(ctx), update.ChatMember); err != nil {
+					log.Printf("[WARN] failed to process chat member update: %v", err)
 				}
 				continue
 			}
@@ -134,21 +305,43 @@ func (l *TelegramListener) Do(ctx context.Context) error {
 				continue
 			}
 
-			if err := l.procEvents(update); err != nil {
+			if l.holdFirstMessage(update) {
+				continue
+			}
+
+			// the update is processed to the end on shutdown, so moderation actions are not interrupted
+			if err := l.procEvents(context.WithoutCancel(ctx), update); err != nil {
 				log.Printf("[WARN] failed to process update: %v", err)
 				continue
 			}
 
+		case <-adminsRefreshCh:
+			if err := l.updateSupers(); err != nil {
+				log.Printf("[WARN] failed to refresh superusers: %v", err)
+			}
+
+		case <-permsCheckCh:
+			l.checkPermissions()
+
+		case <-deleteCh:
+			l.deletes.deleteDue()
+
+		case <-firstMsgCh:
+			l.releaseFirstMessages(context.WithoutCancel(ctx), false)
+
 		case <-time.After(l.IdleDuration): // hit bots on idle timeout
-			resp := l.Bot.OnMessage(bot.Message{Text: "idle"})
-			if err := l.sendBotResponse(resp, l.chatID); err != nil {
+			resp := l.Bot.OnMessage(ctx, bot.Message{Text: "idle"})
+			if _, err := l.sendBotResponse(resp, l.chatID); err != nil {
 				log.Printf("[WARN] failed to respond on idle, %v", err)
 			}
 		}
 	}
 }
 
-func (l *TelegramListener) procEvents(update tbapi.Update) error {
+// procEvents checks the message of the update and takes actions requested by the bot, i.e. bans the spammer.
+// The processing is traced, with child spans for the detector check and telegram actions.
+// followUps are ids of messages aggregated into the update, deleted with the message if it's spam.
+func (l *TelegramListener) procEvents(ctx context.Context, update tbapi.Update, followUps ...int) error {
 	msgJSON, errJSON := json.Marshal(update.Message)
 	if errJSON != nil {
 		return fmt.Errorf("failed to marshal update.Message to json: %w", errJSON)
@@ -167,17 +360,91 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 		return nil
 	}
 
+	// messages on behalf of allowed channels, i.e. the linked channel of the group, are not checked
+	if l.channelAllowed(msg.SenderChat.ID) {
+		log.Printf("[DEBUG] message %d on behalf of allowed channel %d, not checked", msg.ID, msg.SenderChat.ID)
+		return nil
+	}
+
+	if l.Quota != nil && l.Quota.ChecksStopped() {
+		log.Printf("[DEBUG] message %d not checked, checks stopped by quota", msg.ID)
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "telegram update", tracing.Int64("update.id", int64(update.UpdateID)),
+		tracing.Int64("chat.id", fromChat), tracing.Int64("user.id", msg.From.ID))
+	defer span.Finish()
+
 	log.Printf("[DEBUG] incoming msg: %+v", strings.ReplaceAll(msg.Text, "\n", " "))
+	if l.ConversationSize > 0 {
+		ctx = lib.WithConversation(ctx, l.conversation(msg, fromChat)) // made before the message is added to locator
+	}
 	if err := l.Locator.AddMessage(update.Message.Text, fromChat, msg.From.ID, msg.From.Username, msg.ID); err != nil {
 		log.Printf("[WARN] failed to add message to locator: %v", err)
 	}
-	resp := l.Bot.OnMessage(*msg)
+	l.addEntities(update.Message)
+	newUser := !l.SuperUsers.IsSuper(msg.From.Username) && (l.bio != nil || l.evasion != nil || l.commands != nil) &&
+		l.Bot.IsNewUser(msg.From.ID) // before the check approves
+	resp := l.Bot.OnMessage(ctx, *msg)
+	span.SetAttributes(tracing.Bool("spam", resp.Send && resp.BanInterval > 0), tracing.Bool("degraded", resp.Degraded()))
+	l.events().Publish(Event{Kind: EventMessageReceived, ChatID: fromChat, User: msg.From, Text: msg.Text, Message: msg,
+		Response: &resp})
+	bioLinks, abusedCommands := false, false
+	if newUser && !(resp.Send && resp.BanInterval > 0) {
+		l.checkEvasion(msg.From, msg.Text)
+	}
+	if newUser && l.commands != nil && !(resp.Send && resp.BanInterval > 0) {
+		abusedCommands = l.checkCommand(*msg, &resp)
+	}
+	if newUser && l.bio != nil && !(resp.Send && resp.BanInterval > 0) {
+		var cr lib.CheckResult
+		if cr, bioLinks = l.bio.check(msg.From.ID); bioLinks {
+			resp.CheckResults = append(resp.CheckResults, cr)
+			l.reportBio(*msg, cr)
+		}
+	}
+	anomalous := false
+	if l.anomaly != nil && !l.SuperUsers.IsSuper(msg.From.Username) && !(resp.Send && resp.BanInterval > 0) {
+		anomalous = l.checkAnomaly(*msg, &resp)
+	}
+	suspicious := false
+	if cr, ok := resp.Suspicious(); ok && !(resp.Send && resp.BanInterval > 0) {
+		suspicious = true
+		l.reportSuspicious(*msg, cr)
+	}
+	categorized := false
+	if cr, ok := resp.Category(); ok && !(resp.Send && resp.BanInterval > 0) {
+		categorized = true
+		l.actOnCategory(*msg, cr)
+	}
+	if l.HamSampler != nil && !(resp.Send && resp.BanInterval > 0) && !bioLinks && !suspicious && !abusedCommands &&
+		!anomalous && !categorized {
+		l.HamSampler.Sample(msg.Text)
+	}
+
+	// spam verdict of protected user is reported to admin chat instead of any action, as a safety net of false positives
+	if resp.Send && resp.BanInterval > 0 {
+		if pu, ok := l.protectedUser(msg.From.ID, resp.User.ID, resp.ChannelID); ok {
+			l.reportProtected(msg.From, msg.Text, resp, pu)
+			return nil
+		}
+	}
+
+	dry, training := l.Modes()
 
 	// send response to the channel if allowed
-	if resp.Send && !l.NoSpamReply && !l.TrainingMode {
-		if err := l.sendBotResponse(resp, fromChat); err != nil {
+	if resp.Send && !l.NoSpamReply && !training {
+		_, sendSpan := tracing.Start(ctx, "telegram send response")
+		sent, err := l.sendBotResponse(resp, fromChat)
+		if err != nil {
+			sendSpan.SetError(err)
 			log.Printf("[WARN] failed to respond on update, %v", err)
 		}
+		sendSpan.Finish()
+		// reply about spam is deleted after a while, to keep the group clean
+		if err == nil && resp.BanInterval > 0 && l.SpamReplyTTL > 0 {
+			l.deletes.schedule(fromChat, sent.MessageID, l.SpamReplyTTL)
+		}
 	}
 
 	errs := new(multierror.Error)
@@ -185,26 +452,42 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 	// ban user if requested by bot
 	if resp.Send && resp.BanInterval > 0 {
 		log.Printf("[DEBUG] ban initiated for %+v", resp)
-		l.SpamLogger.Save(msg, &resp)
-		if err := l.Locator.AddSpam(msg.From.ID, resp.CheckResults); err != nil {
+		l.events().Publish(Event{Kind: EventSpamDetected, ChatID: fromChat, User: resp.User, ChannelID: resp.ChannelID,
+			Text: msg.Text, Message: msg, Response: &resp, Source: "bot"})
+		if err := l.Locator.AddSpam(fromChat, msg.From.ID, resp.CheckResults); err != nil {
 			log.Printf("[WARN] failed to add spam to locator: %v", err)
 		}
 		banUserStr := l.getBanUsername(resp, update)
 
 		if l.SuperUsers.IsSuper(msg.From.Username) {
-			if l.TrainingMode {
-				l.adminHandler.ReportBan(banUserStr, msg)
+			if training {
+				l.adminHandler.ReportBan(banUserStr, msg, "", false)
 			}
 			log.Printf("[DEBUG] superuser %s requested ban, ignored", banUserStr)
 			return nil
 		}
 
 		banReq := banRequest{duration: resp.BanInterval, userID: resp.User.ID, channelID: resp.ChannelID,
-			chatID: fromChat, dry: l.Dry, training: l.TrainingMode, tbAPI: l.TbAPI}
-		if err := banUserOrChannel(banReq); err == nil {
+			chatID: fromChat, dry: dry, training: training, tbAPI: l.TbAPI}
+		_, banSpan := tracing.Start(ctx, "telegram ban", tracing.Int64("user.id", resp.User.ID),
+			tracing.Int64("channel.id", resp.ChannelID), tracing.Bool("dry", dry || training))
+		err := banUserOrChannel(banReq)
+		banSpan.SetError(err)
+		banSpan.Finish()
+		if err == nil {
 			log.Printf("[INFO] %s banned by bot for %v", banUserStr, resp.BanInterval)
+			banned := resp.User
+			if banned.ID == msg.From.ID {
+				banned = msg.From // with display name
+			}
+			l.events().Publish(Event{Kind: EventActionExecuted, ChatID: fromChat, User: banned, ChannelID: resp.ChannelID,
+				Text: msg.Text, Response: &resp, Action: ActionBan, Dry: dry || training, Source: "bot"})
+			note, pending := "", false
+			if !dry && !training {
+				note, pending = l.autoTrain(msg, resp)
+			}
 			if l.adminChatID != 0 && msg.From.ID != 0 {
-				l.adminHandler.ReportBan(banUserStr, msg)
+				l.adminHandler.ReportBan(banUserStr, msg, note, pending)
 			}
 		} else {
 			errs = multierror.Append(errs, fmt.Errorf("failed to ban %s: %w", banUserStr, err))
@@ -212,15 +495,146 @@ func (l *TelegramListener) procEvents(update tbapi.Update) error {
 	}
 
 	// delete message if requested by bot
-	if resp.DeleteReplyTo && resp.ReplyTo != 0 && !l.Dry && !l.SuperUsers.IsSuper(msg.From.Username) && !l.TrainingMode {
-		if _, err := l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: l.chatID, MessageID: resp.ReplyTo}); err != nil {
-			errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", resp.ReplyTo, err))
+	if resp.DeleteReplyTo && resp.ReplyTo != 0 && !dry && !l.SuperUsers.IsSuper(msg.From.Username) && !training {
+		_, delSpan := tracing.Start(ctx, "telegram delete message", tracing.Int64("message.id", int64(resp.ReplyTo)))
+		for _, msgID := range append([]int{resp.ReplyTo}, followUps...) {
+			if _, err := l.TbAPI.Request(tbapi.DeleteMessageConfig{ChatID: l.chatID, MessageID: msgID}); err != nil {
+				delSpan.SetError(err)
+				errs = multierror.Append(errs, fmt.Errorf("failed to delete message %d: %w", msgID, err))
+			}
 		}
+		delSpan.Finish()
 	}
 
+	err := errs.ErrorOrNil()
+	span.SetError(err)
+	return err
+}
+
+// autoTrain adds the message of the banned spammer to spam samples, if the confidence of the ban is at least AutoTrain.
+// Messages banned with lower confidence are pending confirmation of admins in admin chat. Returns the note about
+// training for the report of the ban, empty if auto-training is disabled, and true if the message is pending.
+func (l *TelegramListener) autoTrain(msg *bot.Message, resp bot.Response) (note string, pending bool) {
+	if l.AutoTrain <= 0 {
+		return "", false
+	}
+	confidence := bot.Confidence(resp.CheckResults)
+	if confidence < l.AutoTrain {
+		log.Printf("[DEBUG] spam of %v banned with confidence %.1f%%, pending confirmation", msg.From, confidence)
+		return fmt.Sprintf("confidence %.1f%%, confirm to add to spam samples", confidence), true
+	}
+	if err := l.Bot.UpdateSpam(msg.Text, autoTrainSource); err != nil {
+		log.Printf("[WARN] failed to add spam of %v to samples, %v", msg.From, err)
+		return fmt.Sprintf("confidence %.1f%%, failed to add to spam samples", confidence), true
+	}
+	log.Printf("[INFO] spam of %v added to samples, confidence %.1f%%", msg.From, confidence)
+	return fmt.Sprintf("confidence %.1f%%, added to spam samples", confidence), false
+}
+
+// reportBio reports the new user with clean message, but with links in profile bio, to admin chat
+func (l *TelegramListener) reportBio(msg bot.Message, cr lib.CheckResult) {
+	user := bot.User{ID: msg.From.ID, Username: msg.From.Username, DisplayName: msg.From.DisplayName}
+	log.Printf("[INFO] new user %v posted clean message, %s", user, cr.Details)
+	if err := l.AdminAlert(fmt.Sprintf("new user %v posted clean message, but %s", user, cr.Details)); err != nil {
+		log.Printf("[WARN] failed to report bio of user %d, %v", user.ID, err)
+	}
+}
+
+// reportSuspicious reports the message with spam verdict vetoed by similarity to ham samples to admin chat, for review
+func (l *TelegramListener) reportSuspicious(msg bot.Message, cr lib.CheckResult) {
+	user := bot.User{ID: msg.From.ID, Username: msg.From.Username, DisplayName: msg.From.DisplayName}
+	if err := l.AdminAlert(fmt.Sprintf("message of %v is %s:\n%s", user, cr.Details, excerpt(msg.Text))); err != nil {
+		log.Printf("[WARN] failed to report suspicious message of user %d, %v", user.ID, err)
+	}
+}
+
+// procJoin processes the user joined the chat. The user is checked with CAS and lols.bot, if JoinCheck is set,
+// and greeted and restricted, if set, unless banned as known spammer. The user similar to recently banned one
+// is reported to admin chat, if BanEvasion is set.
+func (l *TelegramListener) procJoin(ctx context.Context, upd *tbapi.ChatMemberUpdated) error {
+	if upd.Chat.ID != l.chatID || upd.NewChatMember.User == nil || upd.NewChatMember.User.IsBot {
+		return nil
+	}
+	if isChatMember(upd.OldChatMember) || !isChatMember(upd.NewChatMember) {
+		return nil // not a join, i.e. promotion or restriction of a member
+	}
+	tbUser := upd.NewChatMember.User
+	if l.SuperUsers.IsSuper(tbUser.UserName) {
+		return nil
+	}
+
+	ctx, span := tracing.Start(ctx, "telegram join", tracing.Int64("chat.id", upd.Chat.ID), tracing.Int64("user.id", tbUser.ID))
+	defer span.Finish()
+	user := bot.User{ID: tbUser.ID, Username: tbUser.UserName, DisplayName: strings.TrimSpace(tbUser.FirstName + " " + tbUser.LastName)}
+	errs := new(multierror.Error)
+	if l.JoinCheck {
+		banned, err := l.checkJoin(ctx, upd.Chat.ID, user)
+		if err != nil {
+			span.SetError(err)
+			errs = multierror.Append(errs, err)
+		}
+		if banned {
+			return errs.ErrorOrNil()
+		}
+	}
+	l.checkEvasion(user, "")
+	if err := l.welcome(upd.Chat.ID, user); err != nil {
+		errs = multierror.Append(errs, err)
+	}
 	return errs.ErrorOrNil()
 }
 
+// checkJoin checks the user joined the chat with CAS and lols.bot. Known spammer is banned right away with JoinBan set,
+// so the first message is not posted at all, and reported to admin chat otherwise. Returns true if the user is banned.
+func (l *TelegramListener) checkJoin(ctx context.Context, chatID int64, user bot.User) (banned bool, err error) {
+	resp := l.Bot.OnJoin(ctx, user)
+	tracing.FromContext(ctx).SetAttributes(tracing.Bool("spam", resp.Send && resp.BanInterval > 0))
+	if !resp.Send || resp.BanInterval <= 0 {
+		return false, nil
+	}
+	if pu, ok := l.protectedUser(user.ID); ok {
+		l.reportProtected(user, "", resp, pu)
+		return false, nil
+	}
+
+	checks := []string{}
+	for _, cr := range resp.CheckResults {
+		if cr.Spam {
+			checks = append(checks, fmt.Sprintf("%s: %s", cr.Name, cr.Details))
+		}
+	}
+	l.events().Publish(Event{Kind: EventSpamDetected, ChatID: chatID, User: user, Response: &resp, Source: "bot"})
+
+	dry, training := l.Modes()
+	if !l.JoinBan {
+		return false, l.AdminAlert(fmt.Sprintf("known spammer %v joined, %s", user, strings.Join(checks, ", ")))
+	}
+	banReq := banRequest{duration: resp.BanInterval, userID: user.ID, chatID: chatID, dry: dry, training: training,
+		tbAPI: l.TbAPI}
+	if err := banUserOrChannel(banReq); err != nil {
+		return false, fmt.Errorf("failed to ban joined %v: %w", user, err)
+	}
+	l.events().Publish(Event{Kind: EventActionExecuted, ChatID: chatID, User: user, Response: &resp, Action: ActionBan,
+		Dry: dry || training, Source: "bot"})
+	if dry || training {
+		return false, l.AdminAlert(fmt.Sprintf("known spammer %v joined, not banned in dry or training mode, %s", user,
+			strings.Join(checks, ", ")))
+	}
+	log.Printf("[INFO] known spammer %v banned on join for %v", user, resp.BanInterval)
+	return true, l.AdminAlert(fmt.Sprintf("known spammer %v banned on join, %s", user, strings.Join(checks, ", ")))
+}
+
+// isChatMember returns true if the user is a member of the chat, restricted members included
+func isChatMember(m tbapi.ChatMember) bool {
+	switch m.Status {
+	case "creator", "administrator", "member":
+		return true
+	case "restricted":
+		return m.IsMember
+	}
+	return false
+}
+
 func (l *TelegramListener) isChatAllowed(fromChat int64) bool {
 	if fromChat == l.chatID {
 		return true
@@ -262,11 +676,10 @@ func (l *TelegramListener) getBanUsername(resp bot.Response, update tbapi.Update
 	return fmt.Sprintf("%v", botChat)
 }
 
-// sendBotResponse sends bot's answer to tg channel
-// actionText is a text for the button to unban user, optional
-func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) error {
+// sendBotResponse sends bot's answer to tg channel, returns the sent message
+func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) (tbapi.Message, error) {
 	if !resp.Send {
-		return nil
+		return tbapi.Message{}, nil
 	}
 
 	log.Printf("[DEBUG] bot response - %+v, reply-to:%d", strings.ReplaceAll(resp.Text, "\n", "\\n"), resp.ReplyTo)
@@ -275,11 +688,12 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 	tbMsg.DisableWebPagePreview = true
 	tbMsg.ReplyToMessageID = resp.ReplyTo
 
-	if err := send(tbMsg, l.TbAPI); err != nil {
-		return fmt.Errorf("can't send message to telegram %q: %w", resp.Text, err)
+	sent, err := sendMessage(tbMsg, l.TbAPI)
+	if err != nil {
+		return tbapi.Message{}, fmt.Errorf("can't send message to telegram %q: %w", resp.Text, err)
 	}
 
-	return nil
+	return sent, nil
 }
 
 func (l *TelegramListener) getChatID(group string) (int64, error) {
@@ -297,35 +711,253 @@ func (l *TelegramListener) getChatID(group string) (int64, error) {
 }
 
 // updateSupers updates the list of super-users based on the chat administrators fetched from the Telegram API.
+// The list is rebuilt from configured super-users and current admins, so admins who lost their role are dropped on refresh.
 func (l *TelegramListener) updateSupers() error {
-	isSuper := func(username string) bool {
-		for _, super := range l.SuperUsers {
-			if super == username {
-				return true
-			}
-		}
-		return false
-	}
+	l.supersOnce.Do(func() {
+		l.configuredSupers = append(SuperUsers{}, l.SuperUsers...)
+	})
 
 	admins, err := l.TbAPI.GetChatAdministrators(tbapi.ChatAdministratorsConfig{ChatConfig: tbapi.ChatConfig{ChatID: l.chatID}})
 	if err != nil {
 		return fmt.Errorf("failed to get chat administrators: %w", err)
 	}
 
+	supers := append(SuperUsers{}, l.configuredSupers...)
 	for _, admin := range admins {
 		if strings.TrimSpace(admin.User.UserName) == "" {
 			continue
 		}
-		if isSuper(admin.User.UserName) {
+		if supers.IsSuper(admin.User.UserName) {
 			continue // already in the list
 		}
-		l.SuperUsers = append(l.SuperUsers, admin.User.UserName)
+		supers = append(supers, admin.User.UserName)
+	}
+
+	l.SuperUsers = supers
+	if l.adminHandler != nil {
+		l.adminHandler.superUsers = supers
 	}
 
 	log.Printf("[INFO] added admins, full list of supers: {%s}", strings.Join(l.SuperUsers, ", "))
+	return nil
+}
+
+// Health returns the result of the last bot permissions check, nil if the bot has all the rights it needs.
+// Thread-safe, can be used by health endpoint.
+func (l *TelegramListener) Health() error {
+	l.perms.RLock()
+	defer l.perms.RUnlock()
+	return l.perms.err
+}
+
+// Alive returns error if the listener doesn't run or its processing loop is stuck, i.e. the update is processed
+// for too long. The loop wakes up on each update and on idle timeout, so it should never be blocked for long.
+// Thread-safe, can be used by watchdog.
+func (l *TelegramListener) Alive() error {
+	if !l.running.Load() {
+		return errors.New("telegram listener not running")
+	}
+	if since := time.Since(time.Unix(0, l.heartbeat.Load())); since > l.IdleDuration+maxProcessingTime {
+		return fmt.Errorf("telegram listener stuck for %v", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready returns error if the listener doesn't receive updates or telegram is not reachable.
+// Connectivity is checked with getMe request, not more often than readyCheckInterval, as readiness
+// is checked by probes and the result of the last check is good enough in between.
+func (l *TelegramListener) Ready() error {
+	if !l.running.Load() {
+		return errors.New("telegram listener not running")
+	}
+	l.ready.Lock()
+	defer l.ready.Unlock()
+	if !l.ready.checked.IsZero() && time.Since(l.ready.checked) < readyCheckInterval {
+		return l.ready.err
+	}
+	l.ready.err = nil
+	if _, err := l.TbAPI.GetMe(); err != nil {
+		l.ready.err = fmt.Errorf("telegram not reachable: %w", err)
+	}
+	l.ready.checked = time.Now()
+	return l.ready.err
+}
+
+// BanUser bans the user in the chat for the duration, i.e. by admin outside of telegram.
+// Chat 0 is the primary group, and zero duration is a permanent ban. Does nothing in dry and training modes.
+func (l *TelegramListener) BanUser(chatID, userID int64, d time.Duration) error {
+	if chatID == 0 {
+		chatID = l.chatID
+	}
+	if d == 0 {
+		d = bot.PermanentBanDuration
+	}
+	dry, training := l.Modes()
+	banReq := banRequest{duration: d, userID: userID, chatID: chatID, dry: dry, training: training, tbAPI: l.TbAPI}
+	if err := banUserOrChannel(banReq); err != nil {
+		return fmt.Errorf("failed to ban user %d: %w", userID, err)
+	}
+	l.events().Publish(Event{Kind: EventActionExecuted, ChatID: chatID, User: bot.User{ID: userID}, Action: ActionBan,
+		Dry: dry || training, Source: "api"})
+	if dry || training {
+		return nil
+	}
+	log.Printf("[INFO] user %d banned in %d for %v", userID, chatID, d)
+	return nil
+}
+
+// UnbanUser unbans the user in the chat, i.e. after the detection was reversed outside of telegram.
+// Chat 0 is the primary group. Does nothing in training mode, as users are not banned.
+func (l *TelegramListener) UnbanUser(chatID, userID int64) error {
+	if _, training := l.Modes(); training {
+		return nil
+	}
+	if chatID == 0 {
+		chatID = l.chatID
+	}
+	_, err := l.TbAPI.Request(tbapi.UnbanChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{UserID: userID, ChatID: chatID}, OnlyIfBanned: l.KeepUser})
+	if err != nil {
+		return fmt.Errorf("failed to unban user %d: %w", userID, err)
+	}
+	log.Printf("[INFO] user %d unbanned in %d", userID, chatID)
+	l.events().Publish(Event{Kind: EventActionExecuted, ChatID: chatID, User: bot.User{ID: userID}, Action: ActionUnban, Source: "api"})
+	return nil
+}
+
+// Modes returns dry and training modes. Thread-safe, modes can be changed at runtime.
+func (l *TelegramListener) Modes() (dry, training bool) {
+	l.modesLock.RLock()
+	defer l.modesLock.RUnlock()
+	return l.Dry, l.TrainingMode
+}
+
+// SetModes changes dry and training modes without restart, i.e. to start training on a live system.
+// Thread-safe, messages in processing are handled with the previous modes.
+func (l *TelegramListener) SetModes(dry, training bool) {
+	l.modesLock.Lock()
+	defer l.modesLock.Unlock()
+	if l.Dry != dry || l.TrainingMode != training {
+		log.Printf("[INFO] listener modes changed, dry: %v, training: %v", dry, training)
+	}
+	l.Dry, l.TrainingMode = dry, training
+}
+
+// AdminAlert sends the plain text alert to the admin chat, markdown is escaped.
+// It is no-op if the admin chat is not set, or the listener is not running.
+func (l *TelegramListener) AdminAlert(text string) error {
+	if !l.running.Load() || l.adminChatID == 0 {
+		return nil
+	}
+	_, err := l.sendBotResponse(bot.Response{Send: true, Text: escapeMarkDownV1Text(text)}, l.adminChatID)
 	return err
 }
 
+// conversation returns the replied message and recent messages of the chat, the context of the message for checks
+func (l *TelegramListener) conversation(msg *bot.Message, chatID int64) lib.Conversation {
+	res := lib.Conversation{ReplyTo: msg.ReplyTo.Text}
+	recent, err := l.Locator.RecentMessages(chatID, l.ConversationSize)
+	if err != nil {
+		log.Printf("[WARN] failed to get recent messages of chat %d, %v", chatID, err)
+		return res
+	}
+	for _, m := range recent {
+		if m.Text != "" {
+			res.Recent = append(res.Recent, m.Text)
+		}
+	}
+	return res
+}
+
+// sendStartupReport posts summary of the configuration to the admin chat, with current modes and problems
+// with permissions of the bot, so misconfiguration, i.e. forgotten dry mode, is noticed right away
+func (l *TelegramListener) sendStartupReport() {
+	mode := "normal"
+	switch dry, training := l.Modes(); {
+	case training:
+		mode = "⚠️ training, spam is not removed and users are not banned"
+	case dry:
+		mode = "⚠️ dry, spam is not removed and users are not banned"
+	}
+	perms := "ok"
+	permsErr := l.Health()
+	if l.PermsCheck <= 0 {
+		permsErr = l.botPermissions(l.chatID) // not checked periodically, so not checked yet
+	}
+	if permsErr != nil {
+		perms = "⚠️ " + permsErr.Error()
+	}
+
+	text := fmt.Sprintf("**tg-spam started**\n\nmode: %s\n%s\npermissions: %s", mode,
+		escapeMarkDownV1Text(l.StartupReport()), escapeMarkDownV1Text(perms))
+	if _, err := l.sendBotResponse(bot.Response{Send: true, Text: text}, l.adminChatID); err != nil {
+		log.Printf("[WARN] failed to send startup report, %v", err)
+	}
+}
+
+// checkPermissions verifies the bot still can delete messages and ban users in the primary group.
+// On the change of the status it reports to the admin chat, loudly if permissions are lost.
+func (l *TelegramListener) checkPermissions() {
+	err := l.botPermissions(l.chatID)
+
+	l.perms.Lock()
+	prevErr := l.perms.err
+	l.perms.err = err
+	l.perms.Unlock()
+
+	var text string
+	switch {
+	case err != nil && (prevErr == nil || prevErr.Error() != err.Error()):
+		log.Printf("[ERROR] bot permissions problem: %v", err)
+		text = fmt.Sprintf("⚠️ **bot permissions problem in the group, spam can't be removed!**\n\n%s",
+			escapeMarkDownV1Text(err.Error()))
+	case err == nil && prevErr != nil:
+		log.Printf("[INFO] bot permissions restored")
+		text = "bot permissions restored"
+	default:
+		return
+	}
+
+	if l.adminChatID == 0 {
+		return
+	}
+	if _, serr := l.sendBotResponse(bot.Response{Send: true, Text: text}, l.adminChatID); serr != nil {
+		log.Printf("[WARN] failed to send permissions alert to admin chat, %v", serr)
+	}
+}
+
+// botPermissions returns an error if the bot is not an admin of the chat or misses delete/ban rights
+func (l *TelegramListener) botPermissions(chatID int64) error {
+	me, err := l.TbAPI.GetMe()
+	if err != nil {
+		return fmt.Errorf("can't get bot info: %w", err)
+	}
+	member, err := l.TbAPI.GetChatMember(tbapi.GetChatMemberConfig{
+		ChatConfigWithUser: tbapi.ChatConfigWithUser{ChatID: chatID, UserID: me.ID}})
+	if err != nil {
+		return fmt.Errorf("can't get bot membership in chat %d: %w", chatID, err)
+	}
+
+	if member.Status == "creator" {
+		return nil
+	}
+	if member.Status != "administrator" {
+		return fmt.Errorf("bot is not an administrator of the group, status %q", member.Status)
+	}
+
+	missing := []string{}
+	if !member.CanDeleteMessages {
+		missing = append(missing, "delete messages")
+	}
+	if !member.CanRestrictMembers {
+		missing = append(missing, "ban users")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("bot has no rights to %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
 func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 	message := bot.Message{
 		ID:   msg.MessageID,
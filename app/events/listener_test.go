@@ -2,8 +2,15 @@ package events
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,6 +21,9 @@ import (
 	"github.com/umputun/tg-spam/app/bot"
 	"github.com/umputun/tg-spam/app/events/mocks"
 	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/app/tracing"
+	"github.com/umputun/tg-spam/app/webhook"
 	"github.com/umputun/tg-spam/lib"
 )
 
@@ -38,7 +48,7 @@ func TestTelegramListener_Do(t *testing.T) {
 			}, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{Send: true, Text: "bot's answer"}
@@ -50,7 +60,7 @@ func TestTelegramListener_Do(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
+		Bus:        subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:      mockAPI,
 		Bot:        b,
 		Group:      "gr",
@@ -99,13 +109,13 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text, From: &tbapi.User{UserName: "user"}}, nil
 		},
 		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
-			return &tbapi.APIResponse{}, nil
+			return &tbapi.APIResponse{Ok: true}, nil
 		},
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{Send: true, Text: "bot's answer", BanInterval: 2 * time.Minute, User: bot.User{Username: "user", ID: 1}}
@@ -121,14 +131,20 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 
 	locator, teardown := prepTestLocator(t)
 	defer teardown()
+	stats := &mocks.StatsMock{IncFunc: func(chatID int64, spam, degraded bool) {}}
+	notifier := &mocks.NotifierMock{NotifyFunc: func(event webhook.Event) {}}
+	bus := NewBus()
+	bus.Subscribe(SpamLogHandler(mockLogger), EventSpamDetected)
+	bus.Subscribe(StatsHandler(stats), EventMessageReceived, EventAdminDecision)
+	bus.Subscribe(NotifyHandler(notifier), EventSpamDetected, EventActionExecuted)
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
 		TbAPI:      mockAPI,
 		Bot:        b,
 		SuperUsers: SuperUsers{"admin"},
 		Group:      "gr",
 		Locator:    locator,
+		Bus:        bus,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
@@ -159,6 +175,51 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 		assert.Equal(t, "bot's answer", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
 		assert.Equal(t, 1, len(mockAPI.RequestCalls()))
 		assert.Equal(t, int64(123), mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).ChatID)
+		require.Equal(t, 1, len(stats.IncCalls()))
+		assert.Equal(t, int64(123), stats.IncCalls()[0].ChatID)
+		assert.True(t, stats.IncCalls()[0].Spam)
+		assert.False(t, stats.IncCalls()[0].Degraded)
+		require.Equal(t, 2, len(notifier.NotifyCalls()))
+		assert.Equal(t, webhook.Event{Type: webhook.EventSpam, ChatID: 123, UserID: 1, UserName: "user", Text: "text 123"},
+			notifier.NotifyCalls()[0].Event)
+		assert.Equal(t, webhook.Event{Type: webhook.EventBan, ChatID: 123, UserID: 1, UserName: "user"},
+			notifier.NotifyCalls()[1].Event)
+	})
+
+	t.Run("traced ban of the user", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		b.ResetCalls()
+		var names []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				ResourceSpans []struct {
+					ScopeSpans []struct {
+						Spans []struct{ Name string } `json:"spans"`
+					} `json:"scopeSpans"`
+				} `json:"resourceSpans"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			for _, s := range req.ResourceSpans[0].ScopeSpans[0].Spans {
+				names = append(names, s.Name)
+			}
+		}))
+		defer ts.Close()
+		exporter := &tracing.Exporter{Endpoint: ts.URL}
+
+		updChan := make(chan tbapi.Update, 1)
+		updChan <- tbapi.Update{UpdateID: 1, Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "text 123",
+			From: &tbapi.User{UserName: "user", ID: 123}}}
+		close(updChan)
+		mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+		err := l.Do(tracing.WithExporter(ctx, exporter))
+		assert.EqualError(t, err, "telegram update chan closed")
+		require.Equal(t, 1, len(b.OnMessageCalls()))
+		span := tracing.FromContext(b.OnMessageCalls()[0].Ctx)
+		require.NotNil(t, span, "bot called with traced context")
+		assert.Equal(t, "telegram update", span.Name)
+		require.NoError(t, exporter.Flush(ctx))
+		assert.Equal(t, []string{"telegram send response", "telegram ban", "telegram update"}, names)
 	})
 
 	t.Run("test ban of the channel", func(t *testing.T) {
@@ -200,6 +261,7 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 	t.Run("test ban of the channel on behalf of the superuser", func(t *testing.T) {
 		mockLogger.ResetCalls()
 		mockAPI.ResetCalls()
+		notifier.ResetCalls()
 		updMsg := tbapi.Update{
 			Message: &tbapi.Message{
 				ReplyToMessage: &tbapi.Message{
@@ -229,9 +291,159 @@ func TestTelegramListener_DoWithBotBan(t *testing.T) {
 		assert.Equal(t, 1, len(mockAPI.SendCalls()))
 		assert.Equal(t, "bot's answer for admin", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
 		require.Equal(t, 0, len(mockAPI.RequestCalls()))
+		require.Equal(t, 1, len(notifier.NotifyCalls()), "detection reported, no ban")
+		assert.Equal(t, webhook.EventSpam, notifier.NotifyCalls()[0].Event.Type)
 	})
 }
 
+func TestTelegramListener_DoWithSpamReplyTTL(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: 123}, nil },
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{MessageID: 555, Text: c.(tbapi.MessageConfig).Text}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return nil, nil
+		},
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+		if msg.Text == "spam" {
+			return bot.Response{Send: true, Text: "this is spam", BanInterval: 2 * time.Minute, User: bot.User{Username: "user", ID: 1}}
+		}
+		return bot.Response{Send: true, Text: "not a spam reply"}
+	}}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		TbAPI:        mockAPI,
+		Bot:          b,
+		Group:        "gr",
+		Locator:      locator,
+		SpamReplyTTL: time.Hour,
+	}
+
+	updChan := make(chan tbapi.Update, 2)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "spam", From: &tbapi.User{UserName: "user", ID: 1}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "ham", From: &tbapi.User{UserName: "user2", ID: 2}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 2, len(mockAPI.SendCalls()))
+	var deleted []tbapi.DeleteMessageConfig
+	for _, c := range mockAPI.RequestCalls() {
+		if d, ok := c.C.(tbapi.DeleteMessageConfig); ok {
+			deleted = append(deleted, d)
+		}
+	}
+	assert.Equal(t, []tbapi.DeleteMessageConfig{{ChatID: 123, MessageID: 555}}, deleted,
+		"only spam reply scheduled for deletion, and deleted on exit")
+}
+
+func TestTelegramListener_DoWithHamSampler(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: 123}, nil },
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return nil, nil
+		},
+	}
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+		if msg.Text == "spam" {
+			return bot.Response{Send: true, Text: "this is spam", BanInterval: 2 * time.Minute, User: bot.User{Username: "user", ID: 1}}
+		}
+		return bot.Response{}
+	}}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+	sampler := &mocks.HamSamplerMock{SampleFunc: func(msg string) bool { return true }}
+
+	l := TelegramListener{
+		TbAPI:      mockAPI,
+		Bot:        b,
+		Group:      "gr",
+		Locator:    locator,
+		HamSampler: sampler,
+	}
+
+	updChan := make(chan tbapi.Update, 2)
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "spam", From: &tbapi.User{UserName: "user", ID: 1}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{Chat: &tbapi.Chat{ID: 123}, Text: "ham", From: &tbapi.User{UserName: "user2", ID: 2}}}
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Len(t, sampler.SampleCalls(), 1, "only ham is sampled")
+	assert.Equal(t, "ham", sampler.SampleCalls()[0].Msg)
+}
+
+func TestTelegramListener_DoWithFirstMessageWindow(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		GetChatFunc: func(config tbapi.ChatInfoConfig) (tbapi.Chat, error) { return tbapi.Chat{ID: 123}, nil },
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) {
+			return tbapi.Message{Text: c.(tbapi.MessageConfig).Text}, nil
+		},
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return nil, nil
+		},
+	}
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			if strings.Contains(msg.Text, "http://spam.example.com") {
+				return bot.Response{Send: true, Text: "this is spam", BanInterval: bot.PermanentBanDuration, ReplyTo: msg.ID,
+					DeleteReplyTo: true, User: bot.User{Username: msg.From.Username, ID: msg.From.ID}}
+			}
+			return bot.Response{}
+		},
+		IsNewUserFunc: func(id int64) bool { return id == 1 },
+	}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	l := TelegramListener{
+		TbAPI:              mockAPI,
+		Bot:                b,
+		Group:              "gr",
+		Locator:            locator,
+		FirstMessageWindow: time.Hour,
+	}
+
+	message := func(id int, userID int64, text string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{MessageID: id, Chat: &tbapi.Chat{ID: 123}, Text: text,
+			From: &tbapi.User{UserName: fmt.Sprintf("user%d", userID), ID: userID}}}
+	}
+	updChan := make(chan tbapi.Update, 3)
+	updChan <- message(10, 1, "hi all")
+	updChan <- message(11, 2, "hello from known user")
+	updChan <- message(12, 1, "http://spam.example.com")
+	close(updChan)
+	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
+
+	err := l.Do(context.Background())
+	assert.EqualError(t, err, "telegram update chan closed")
+	require.Equal(t, 2, len(b.OnMessageCalls()))
+	assert.Equal(t, "hello from known user", b.OnMessageCalls()[0].Msg.Text, "known user is not held")
+	assert.Equal(t, "hi all\nhttp://spam.example.com", b.OnMessageCalls()[1].Msg.Text, "held on exit, checked with the follow-up")
+	assert.Equal(t, 10, b.OnMessageCalls()[1].Msg.ID)
+	assert.Empty(t, l.held)
+
+	var deleted []int
+	for _, c := range mockAPI.RequestCalls() {
+		if d, ok := c.C.(tbapi.DeleteMessageConfig); ok {
+			deleted = append(deleted, d.MessageID)
+		}
+	}
+	assert.Equal(t, []int{10, 12}, deleted, "first message deleted with the follow-up")
+}
+
 func TestTelegramListener_DoWithTraining(t *testing.T) {
 	mockLogger := &mocks.SpamLoggerMock{SaveFunc: func(msg *bot.Message, response *bot.Response) {}}
 	mockAPI := &mocks.TbAPIMock{
@@ -248,7 +460,7 @@ func TestTelegramListener_DoWithTraining(t *testing.T) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		return bot.Response{DeleteReplyTo: true, ReplyTo: msg.ID, ChannelID: msg.ChatID, BanInterval: time.Hour,
 			Send: true, Text: "bot's answer", User: bot.User{Username: "user", ID: 1, DisplayName: "First Last"}}
@@ -258,7 +470,7 @@ func TestTelegramListener_DoWithTraining(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger:   mockLogger,
+		Bus:          subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:        mockAPI,
 		Bot:          b,
 		Group:        "gr",
@@ -313,7 +525,7 @@ func TestTelegramListener_DoDeleteMessages(t *testing.T) {
 			return nil, nil
 		},
 	}
-	b := &mocks.BotMock{OnMessageFunc: func(msg bot.Message) bot.Response {
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 		t.Logf("on-message: %+v", msg)
 		if msg.Text == "text 123" && msg.From.Username == "user" {
 			return bot.Response{DeleteReplyTo: true, ReplyTo: msg.ID, ChannelID: msg.ChatID, BanInterval: time.Hour,
@@ -326,11 +538,11 @@ func TestTelegramListener_DoDeleteMessages(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
-		TbAPI:      mockAPI,
-		Bot:        b,
-		Group:      "gr",
-		Locator:    locator,
+		Bus:     subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
+		TbAPI:   mockAPI,
+		Bot:     b,
+		Group:   "gr",
+		Locator: locator,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
@@ -383,14 +595,14 @@ func TestTelegramListener_DoWithForwarded(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		OnMessageFunc: func(msg bot.Message) bot.Response {
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 			t.Logf("on-message: %+v", msg)
 			if msg.Text == "text 123" && msg.From.Username == "user" {
 				return bot.Response{Send: true, Text: "bot's answer"}
 			}
 			return bot.Response{}
 		},
-		UpdateSpamFunc: func(msg string) error {
+		UpdateSpamFunc: func(msg, source string) error {
 			t.Logf("update-spam: %s", msg)
 			return nil
 		},
@@ -401,7 +613,7 @@ func TestTelegramListener_DoWithForwarded(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
+		Bus:        subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:      mockAPI,
 		Bot:        b,
 		Group:      "gr",
@@ -443,6 +655,7 @@ func TestTelegramListener_DoWithForwarded(t *testing.T) {
 
 	require.Equal(t, 1, len(b.UpdateSpamCalls()))
 	assert.Equal(t, "text 123", b.UpdateSpamCalls()[0].Msg)
+	assert.Equal(t, "admin:umputun", b.UpdateSpamCalls()[0].Source)
 
 	assert.Equal(t, 2, len(mockAPI.RequestCalls()))
 	assert.Equal(t, int64(123), mockAPI.RequestCalls()[0].C.(tbapi.DeleteMessageConfig).ChatID)
@@ -472,7 +685,7 @@ func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		UpdateHamFunc: func(msg string) error {
+		UpdateHamFunc: func(msg, source string) error {
 			return nil
 		},
 		AddApprovedUsersFunc: func(id int64, ids ...int64) {},
@@ -480,15 +693,21 @@ func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 
 	locator, teardown := prepTestLocator(t)
 	defer teardown()
+	stats := &mocks.StatsMock{SetReversedFunc: func(chatID, userID int64) (bool, error) { return true, nil }}
+	notifier := &mocks.NotifierMock{NotifyFunc: func(event webhook.Event) {}}
+	bus := NewBus()
+	bus.Subscribe(SpamLogHandler(mockLogger), EventSpamDetected)
+	bus.Subscribe(StatsHandler(stats), EventMessageReceived, EventAdminDecision)
+	bus.Subscribe(NotifyHandler(notifier), EventSpamDetected, EventActionExecuted)
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
 		TbAPI:      mockAPI,
 		Bot:        b,
 		SuperUsers: SuperUsers{"admin"},
 		Group:      "gr",
 		Locator:    locator,
 		AdminGroup: "123",
+		Bus:        bus,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Minute)
@@ -523,8 +742,14 @@ func TestTelegramListener_DoWithAdminUnBan(t *testing.T) {
 	assert.Equal(t, int64(777), mockAPI.RequestCalls()[1].C.(tbapi.UnbanChatMemberConfig).UserID)
 	require.Equal(t, 1, len(b.UpdateHamCalls()))
 	assert.Equal(t, "this was the ham, not spam", b.UpdateHamCalls()[0].Msg)
+	assert.Equal(t, "admin:admin", b.UpdateHamCalls()[0].Source)
 	require.Equal(t, 1, len(b.AddApprovedUsersCalls()))
 	assert.Equal(t, int64(777), b.AddApprovedUsersCalls()[0].ID)
+	require.Equal(t, 1, len(stats.SetReversedCalls()), "false positive counted")
+	assert.Equal(t, int64(123), stats.SetReversedCalls()[0].ChatID)
+	assert.Equal(t, int64(777), stats.SetReversedCalls()[0].UserID)
+	require.Equal(t, 1, len(notifier.NotifyCalls()))
+	assert.Equal(t, webhook.Event{Type: webhook.EventUnban, ChatID: 123, UserID: 777}, notifier.NotifyCalls()[0].Event)
 }
 
 func TestTelegramListener_DoWithAdminUnBan_Training(t *testing.T) {
@@ -545,7 +770,7 @@ func TestTelegramListener_DoWithAdminUnBan_Training(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		UpdateHamFunc: func(msg string) error {
+		UpdateHamFunc: func(msg, source string) error {
 			return nil
 		},
 		AddApprovedUsersFunc: func(id int64, ids ...int64) {},
@@ -555,7 +780,7 @@ func TestTelegramListener_DoWithAdminUnBan_Training(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger:   mockLogger,
+		Bus:          subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:        mockAPI,
 		Bot:          b,
 		SuperUsers:   SuperUsers{"admin"},
@@ -617,7 +842,7 @@ func TestTelegramListener_DoWithAdminUnBanConfirmation(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		UpdateHamFunc: func(msg string) error {
+		UpdateHamFunc: func(msg, source string) error {
 			return nil
 		},
 		AddApprovedUsersFunc: func(id int64, ids ...int64) {},
@@ -627,7 +852,7 @@ func TestTelegramListener_DoWithAdminUnBanConfirmation(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
+		Bus:        subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:      mockAPI,
 		Bot:        b,
 		SuperUsers: SuperUsers{"admin"},
@@ -686,7 +911,7 @@ func TestTelegramListener_DoWithAdminUnbanDecline(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		UpdateSpamFunc: func(msg string) error {
+		UpdateSpamFunc: func(msg, source string) error {
 			return nil
 		},
 		AddApprovedUsersFunc: func(id int64, ids ...int64) {},
@@ -696,7 +921,7 @@ func TestTelegramListener_DoWithAdminUnbanDecline(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
+		Bus:        subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:      mockAPI,
 		Bot:        b,
 		SuperUsers: SuperUsers{"admin"},
@@ -757,7 +982,7 @@ func TestTelegramListener_DoWithAdminBanConfirmedTraining(t *testing.T) {
 		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) { return nil, nil },
 	}
 	b := &mocks.BotMock{
-		UpdateSpamFunc: func(msg string) error {
+		UpdateSpamFunc: func(msg, source string) error {
 			return nil
 		},
 		AddApprovedUsersFunc: func(id int64, ids ...int64) {},
@@ -767,7 +992,7 @@ func TestTelegramListener_DoWithAdminBanConfirmedTraining(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger:   mockLogger,
+		Bus:          subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:        mockAPI,
 		Bot:          b,
 		SuperUsers:   SuperUsers{"admin"},
@@ -835,7 +1060,7 @@ func TestTelegramListener_DoWithAdminShowInfo(t *testing.T) {
 	defer teardown()
 
 	l := TelegramListener{
-		SpamLogger: mockLogger,
+		Bus:        subscribed(SpamLogHandler(mockLogger), EventSpamDetected),
 		TbAPI:      mockAPI,
 		Bot:        b,
 		SuperUsers: SuperUsers{"admin"},
@@ -865,7 +1090,7 @@ func TestTelegramListener_DoWithAdminShowInfo(t *testing.T) {
 	close(updChan)
 	mockAPI.GetUpdatesChanFunc = func(config tbapi.UpdateConfig) tbapi.UpdatesChannel { return updChan }
 
-	l.Locator.AddSpam(999, []lib.CheckResult{{Name: "rule1", Spam: true, Details: "details1"}, {Name: "rule2", Spam: true, Details: "details2"}})
+	l.Locator.AddSpam(123, 999, []lib.CheckResult{{Name: "rule1", Spam: true, Details: "details1"}, {Name: "rule2", Spam: true, Details: "details2"}})
 
 	err := l.Do(ctx)
 	assert.EqualError(t, err, "telegram update chan closed")
@@ -1217,6 +1442,210 @@ func TestUpdateSupers(t *testing.T) {
 	}
 }
 
+func TestUpdateSupers_Refresh(t *testing.T) {
+	admins := []tbapi.ChatMember{{User: &tbapi.User{UserName: "admin1"}}, {User: &tbapi.User{UserName: "admin2"}}}
+	mockAPI := &mocks.TbAPIMock{
+		GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
+			return admins, nil
+		},
+	}
+	l := &TelegramListener{TbAPI: mockAPI, SuperUsers: SuperUsers{"super1"}, adminHandler: &admin{}}
+
+	require.NoError(t, l.updateSupers())
+	assert.ElementsMatch(t, []string{"super1", "admin1", "admin2"}, l.SuperUsers)
+	assert.ElementsMatch(t, []string{"super1", "admin1", "admin2"}, l.adminHandler.superUsers)
+
+	// admin2 demoted, admin3 promoted
+	admins = []tbapi.ChatMember{{User: &tbapi.User{UserName: "admin1"}}, {User: &tbapi.User{UserName: "admin3"}}}
+	require.NoError(t, l.updateSupers())
+	assert.ElementsMatch(t, []string{"super1", "admin1", "admin3"}, l.SuperUsers)
+	assert.ElementsMatch(t, []string{"super1", "admin1", "admin3"}, l.adminHandler.superUsers)
+	assert.Equal(t, 2, len(mockAPI.GetChatAdministratorsCalls()))
+}
+
+func TestTelegramListener_checkPermissions(t *testing.T) {
+	member := tbapi.ChatMember{Status: "administrator", CanDeleteMessages: true, CanRestrictMembers: true}
+	mockAPI := &mocks.TbAPIMock{
+		GetMeFunc: func() (tbapi.User, error) { return tbapi.User{ID: 42}, nil },
+		GetChatMemberFunc: func(config tbapi.GetChatMemberConfig) (tbapi.ChatMember, error) {
+			return member, nil
+		},
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+	}
+	l := &TelegramListener{TbAPI: mockAPI, chatID: 123, adminChatID: 456}
+
+	l.checkPermissions()
+	assert.NoError(t, l.Health())
+	assert.Equal(t, 0, len(mockAPI.SendCalls()), "no alert if permissions are fine")
+	require.Equal(t, 1, len(mockAPI.GetChatMemberCalls()))
+	assert.Equal(t, int64(123), mockAPI.GetChatMemberCalls()[0].Config.ChatID)
+	assert.Equal(t, int64(42), mockAPI.GetChatMemberCalls()[0].Config.UserID)
+
+	member.CanRestrictMembers = false // ban rights revoked
+	l.checkPermissions()
+	assert.EqualError(t, l.Health(), "bot has no rights to ban users")
+	require.Equal(t, 1, len(mockAPI.SendCalls()))
+	assert.Equal(t, int64(456), mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ChatID)
+	assert.Contains(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text, "bot permissions problem")
+
+	l.checkPermissions()
+	assert.Equal(t, 1, len(mockAPI.SendCalls()), "no repeated alert for the same problem")
+
+	member = tbapi.ChatMember{Status: "member"} // bot demoted
+	l.checkPermissions()
+	assert.EqualError(t, l.Health(), `bot is not an administrator of the group, status "member"`)
+	assert.Equal(t, 2, len(mockAPI.SendCalls()))
+
+	member = tbapi.ChatMember{Status: "creator"}
+	l.checkPermissions()
+	assert.NoError(t, l.Health())
+	require.Equal(t, 3, len(mockAPI.SendCalls()))
+	assert.Equal(t, "bot permissions restored", mockAPI.SendCalls()[2].C.(tbapi.MessageConfig).Text)
+
+	mockAPI.GetMeFunc = func() (tbapi.User, error) { return tbapi.User{}, errors.New("network error") }
+	l.checkPermissions()
+	assert.EqualError(t, l.Health(), "can't get bot info: network error")
+}
+
+func TestTelegramListener_EndToEnd(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	srv.SetAdmins(100, tgtest.User(10, "admin"))
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	detector := lib.NewDetector(lib.Config{MaxAllowedEmoji: -1, FirstMessagesCount: 1})
+	_, err = detector.LoadStopWords(strings.NewReader("buy crypto"))
+	require.NoError(t, err)
+	spamFilter := bot.NewSpamFilter(ctx, detector, bot.SpamConfig{SpamMsg: "this is spam", SpamDryMsg: "this is spam (dry)"})
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	listener := TelegramListener{TbAPI: api, Bot: spamFilter, Group: "group", AdminGroup: "200", Locator: locator}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	var report tgtest.Request
+	t.Run("spam", func(t *testing.T) {
+		upd := srv.Push(tgtest.Message(100, tgtest.User(1, "spammer"), "buy crypto here, cheap and fast"))
+		srv.AssertSent(t, 100, "this is spam")
+		srv.AssertDeleted(t, 100, upd.Message.MessageID)
+		srv.AssertBanned(t, 100, 1)
+		report = srv.AssertSent(t, 200, "buy crypto here")
+		require.NotNil(t, report.Message)
+		require.NotNil(t, report.Message.ReplyMarkup, "report has buttons")
+	})
+
+	t.Run("ham", func(t *testing.T) {
+		srv.ResetRequests()
+		srv.Push(tgtest.Message(100, tgtest.User(2, "user"), "hello everyone, nice to meet you all"))
+		srv.AssertNoRequest(t, "banChatMember", 100*time.Millisecond)
+		srv.AssertNoRequest(t, "deleteMessage", 0)
+		assert.False(t, detector.IsNewUser("2"), "user checked as ham")
+	})
+
+	t.Run("unban by admin", func(t *testing.T) {
+		require.NotNil(t, report.Message)
+		srv.Push(tgtest.Callback(tgtest.User(10, "admin"), report.Message, "1"))
+		_, ok := srv.WaitRequest("unbanChatMember", func(r tgtest.Request) bool {
+			return r.ChatID() == 100 && r.Int("user_id") == 1
+		})
+		assert.True(t, ok, "user unbanned")
+		_, ok = srv.WaitRequest("answerCallbackQuery", nil)
+		assert.True(t, ok, "callback answered")
+	})
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestTelegramListener_StartupReport(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: &mocks.BotMock{}, Group: "group", AdminGroup: "200", Dry: true,
+		StartupReport: func() string { return "samples: spam 10, ham 20" }}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	req := srv.AssertSent(t, 200, "tg-spam started")
+	assert.Contains(t, req.Text(), "mode: ⚠️ dry, spam is not removed")
+	assert.Contains(t, req.Text(), "samples: spam 10, ham 20")
+	assert.Contains(t, req.Text(), "permissions: ok")
+	assert.Len(t, srv.Requests("sendMessage"), 1, "startup message is not set")
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	t.Run("no admin chat", func(t *testing.T) {
+		srv.ResetRequests()
+		ctx, cancel := context.WithCancel(context.Background())
+		listener := TelegramListener{TbAPI: api, Bot: &mocks.BotMock{}, Group: "group",
+			StartupReport: func() string { return "samples: spam 10, ham 20" }}
+		done := make(chan error)
+		go func() { done <- listener.Do(ctx) }()
+		srv.AssertNoRequest(t, "sendMessage", 100*time.Millisecond)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestTelegramListener_Conversation(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	conversations := map[string]lib.Conversation{}
+	b := &mocks.BotMock{OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+		lock.Lock()
+		defer lock.Unlock()
+		conv, _ := lib.ConversationFrom(ctx)
+		conversations[msg.Text] = conv
+		return bot.Response{}
+	}}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", Locator: locator, ConversationSize: 2}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	waitChecked := func(text string) lib.Conversation {
+		require.Eventually(t, func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			_, ok := conversations[text]
+			return ok
+		}, time.Second, time.Millisecond)
+		lock.Lock()
+		defer lock.Unlock()
+		return conversations[text]
+	}
+
+	srv.Push(tgtest.Message(100, tgtest.User(1, "user1"), "hello all"))
+	assert.Equal(t, lib.Conversation{}, waitChecked("hello all"))
+	srv.Push(tgtest.Message(100, tgtest.User(2, "user2"), "interesting article about go"))
+	waitChecked("interesting article about go")
+	question := srv.Push(tgtest.Message(100, tgtest.User(1, "user1"), "where can I read more?"))
+	waitChecked("where can I read more?")
+	srv.Push(tgtest.Reply(100, tgtest.User(2, "user2"), "check my channel", question.Message))
+	assert.Equal(t, lib.Conversation{ReplyTo: "where can I read more?",
+		Recent: []string{"interesting article about go", "where can I read more?"}}, waitChecked("check my channel"))
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
 func prepTestLocator(t *testing.T) (loc *storage.Locator, teardown func()) {
 	f, err := os.CreateTemp("", "locator")
 	require.NoError(t, err)
@@ -1229,3 +1658,376 @@ func prepTestLocator(t *testing.T) (loc *storage.Locator, teardown func()) {
 		os.Remove(f.Name())
 	}
 }
+
+func TestTelegramListener_UnbanUser(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			if c.(tbapi.UnbanChatMemberConfig).UserID == 13 {
+				return nil, errors.New("api error")
+			}
+			return &tbapi.APIResponse{}, nil
+		},
+	}
+	notifier := &mocks.NotifierMock{NotifyFunc: func(event webhook.Event) {}}
+	l := &TelegramListener{TbAPI: mockAPI, KeepUser: true,
+		Bus: subscribed(NotifyHandler(notifier), EventSpamDetected, EventActionExecuted)}
+
+	require.NoError(t, l.UnbanUser(123, 777))
+	require.Len(t, mockAPI.RequestCalls(), 1)
+	req := mockAPI.RequestCalls()[0].C.(tbapi.UnbanChatMemberConfig)
+	assert.Equal(t, int64(123), req.ChatID)
+	assert.Equal(t, int64(777), req.UserID)
+	assert.True(t, req.OnlyIfBanned)
+	require.Len(t, notifier.NotifyCalls(), 1)
+	assert.Equal(t, webhook.Event{Type: webhook.EventUnban, ChatID: 123, UserID: 777}, notifier.NotifyCalls()[0].Event)
+
+	assert.EqualError(t, l.UnbanUser(123, 13), "failed to unban user 13: api error")
+
+	mockAPI.ResetCalls()
+	l.TrainingMode = true
+	require.NoError(t, l.UnbanUser(123, 777))
+	assert.Empty(t, mockAPI.RequestCalls(), "no unban in training mode")
+	assert.Len(t, notifier.NotifyCalls(), 1, "no unban notifications on failure and in training mode")
+
+	mockAPI.ResetCalls()
+	l.TrainingMode, l.chatID = false, 456
+	require.NoError(t, l.UnbanUser(0, 777))
+	require.Len(t, mockAPI.RequestCalls(), 1)
+	assert.Equal(t, int64(456), mockAPI.RequestCalls()[0].C.(tbapi.UnbanChatMemberConfig).ChatID, "primary group by default")
+}
+
+func TestTelegramListener_SetModes(t *testing.T) {
+	l := &TelegramListener{Dry: true}
+	dry, training := l.Modes()
+	assert.True(t, dry)
+	assert.False(t, training)
+
+	l.SetModes(false, true)
+	dry, training = l.Modes()
+	assert.False(t, dry)
+	assert.True(t, training)
+	assert.True(t, l.TrainingMode)
+}
+
+func TestTelegramListener_Ready(t *testing.T) {
+	var getMeErr error
+	mockAPI := &mocks.TbAPIMock{GetMeFunc: func() (tbapi.User, error) { return tbapi.User{ID: 42}, getMeErr }}
+	l := &TelegramListener{TbAPI: mockAPI}
+	assert.EqualError(t, l.Ready(), "telegram listener not running")
+	assert.Empty(t, mockAPI.GetMeCalls())
+
+	l.running.Store(true)
+	assert.NoError(t, l.Ready())
+	require.Len(t, mockAPI.GetMeCalls(), 1)
+
+	getMeErr = errors.New("connection refused")
+	assert.NoError(t, l.Ready(), "last check result reused")
+	assert.Len(t, mockAPI.GetMeCalls(), 1)
+
+	l.ready.checked = time.Now().Add(-readyCheckInterval)
+	assert.EqualError(t, l.Ready(), "telegram not reachable: connection refused")
+	assert.Len(t, mockAPI.GetMeCalls(), 2)
+}
+
+func TestTelegramListener_Alive(t *testing.T) {
+	l := &TelegramListener{IdleDuration: time.Minute}
+	assert.EqualError(t, l.Alive(), "telegram listener not running")
+
+	l.running.Store(true)
+	l.heartbeat.Store(time.Now().UnixNano())
+	assert.NoError(t, l.Alive())
+
+	l.heartbeat.Store(time.Now().Add(-time.Minute - maxProcessingTime - time.Second).UnixNano())
+	assert.ErrorContains(t, l.Alive(), "telegram listener stuck for 6m1s")
+}
+
+func TestTelegramListener_AdminAlert(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+	}
+	l := &TelegramListener{TbAPI: mockAPI}
+	require.NoError(t, l.AdminAlert("alert"))
+	assert.Empty(t, mockAPI.SendCalls(), "not running")
+
+	l.running.Store(true)
+	require.NoError(t, l.AdminAlert("alert"))
+	assert.Empty(t, mockAPI.SendCalls(), "no admin chat")
+
+	l.adminChatID = 123
+	require.NoError(t, l.AdminAlert("openai failed: bad_request"))
+	require.Len(t, mockAPI.SendCalls(), 1)
+	msg := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+	assert.Equal(t, int64(123), msg.ChatID)
+	assert.Equal(t, "openai failed: bad\\_request", msg.Text)
+}
+
+func TestTelegramListener_BanUser(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			if c.(tbapi.RestrictChatMemberConfig).UserID == 13 {
+				return nil, errors.New("api error")
+			}
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	notifier := &mocks.NotifierMock{NotifyFunc: func(event webhook.Event) {}}
+	l := &TelegramListener{TbAPI: mockAPI, Bus: subscribed(NotifyHandler(notifier), EventSpamDetected, EventActionExecuted),
+		chatID: 456}
+
+	require.NoError(t, l.BanUser(123, 777, time.Hour))
+	require.Len(t, mockAPI.RequestCalls(), 1)
+	req := mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(123), req.ChatID)
+	assert.Equal(t, int64(777), req.UserID)
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), req.UntilDate, 5)
+	require.Len(t, notifier.NotifyCalls(), 1)
+	assert.Equal(t, webhook.Event{Type: webhook.EventBan, ChatID: 123, UserID: 777}, notifier.NotifyCalls()[0].Event)
+
+	require.NoError(t, l.BanUser(0, 777, 0))
+	req = mockAPI.RequestCalls()[1].C.(tbapi.RestrictChatMemberConfig)
+	assert.Equal(t, int64(456), req.ChatID, "primary group by default")
+	assert.InDelta(t, time.Now().Add(bot.PermanentBanDuration).Unix(), req.UntilDate, 5, "permanent by default")
+
+	assert.EqualError(t, l.BanUser(123, 13, time.Hour), "failed to ban user 13: api error")
+
+	mockAPI.ResetCalls()
+	notifier.ResetCalls()
+	l.Dry = true
+	require.NoError(t, l.BanUser(123, 777, time.Hour))
+	l.Dry, l.TrainingMode = false, true
+	require.NoError(t, l.BanUser(123, 777, time.Hour))
+	assert.Empty(t, mockAPI.RequestCalls(), "no ban in dry and training modes")
+	assert.Empty(t, notifier.NotifyCalls())
+}
+
+func TestTelegramListener_procJoin(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+	}
+	b := &mocks.BotMock{OnJoinFunc: func(ctx context.Context, user bot.User) bot.Response {
+		if user.ID == 1 {
+			return bot.Response{Send: true, BanInterval: bot.PermanentBanDuration, User: user,
+				CheckResults: []lib.CheckResult{{Name: "cas", Spam: true, Details: "record found"}}}
+		}
+		return bot.Response{}
+	}}
+	notifier := &mocks.NotifierMock{NotifyFunc: func(event webhook.Event) {}}
+	l := &TelegramListener{TbAPI: mockAPI, Bot: b, Bus: subscribed(NotifyHandler(notifier), EventSpamDetected, EventActionExecuted),
+		SuperUsers: SuperUsers{"super"}, JoinCheck: true, chatID: 123, adminChatID: 456}
+	l.running.Store(true)
+
+	join := func(userID int64, userName, oldStatus, newStatus string) *tbapi.ChatMemberUpdated {
+		return &tbapi.ChatMemberUpdated{Chat: tbapi.Chat{ID: 123}, OldChatMember: tbapi.ChatMember{Status: oldStatus},
+			NewChatMember: tbapi.ChatMember{Status: newStatus, User: &tbapi.User{ID: userID, UserName: userName}}}
+	}
+
+	t.Run("known spammer reported", func(t *testing.T) {
+		require.NoError(t, l.procJoin(context.Background(), join(1, "spammer", "left", "member")))
+		require.Len(t, b.OnJoinCalls(), 1)
+		assert.Equal(t, bot.User{ID: 1, Username: "spammer"}, b.OnJoinCalls()[0].User)
+		assert.Empty(t, mockAPI.RequestCalls(), "not banned")
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, int64(456), mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ChatID)
+		assert.Contains(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text, "joined, cas: record found")
+		require.Len(t, notifier.NotifyCalls(), 1)
+		assert.Equal(t, webhook.EventSpam, notifier.NotifyCalls()[0].Event.Type)
+	})
+
+	t.Run("known spammer banned", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		notifier.ResetCalls()
+		l.JoinBan = true
+		require.NoError(t, l.procJoin(context.Background(), join(1, "spammer", "kicked", "member")))
+		require.Len(t, mockAPI.RequestCalls(), 1)
+		assert.Equal(t, int64(1), mockAPI.RequestCalls()[0].C.(tbapi.RestrictChatMemberConfig).UserID)
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Contains(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text, "banned on join, cas: record found")
+		require.Len(t, notifier.NotifyCalls(), 2)
+		assert.Equal(t, webhook.Event{Type: webhook.EventBan, ChatID: 123, UserID: 1, UserName: "spammer"},
+			notifier.NotifyCalls()[1].Event)
+	})
+
+	t.Run("not a spammer, or not a join", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		b.ResetCalls()
+		require.NoError(t, l.procJoin(context.Background(), join(2, "user", "left", "member")))
+		require.NoError(t, l.procJoin(context.Background(), join(1, "spammer", "member", "administrator")))
+		require.NoError(t, l.procJoin(context.Background(), join(1, "spammer", "member", "left")))
+		require.NoError(t, l.procJoin(context.Background(), join(1, "super", "left", "member")))
+		other := join(1, "spammer", "left", "member")
+		other.Chat.ID = 789
+		require.NoError(t, l.procJoin(context.Background(), other))
+		assert.Len(t, b.OnJoinCalls(), 1, "only user 2 checked")
+		assert.Empty(t, mockAPI.RequestCalls())
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+}
+
+func TestTelegramListener_Denylist(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			if msg.Text != "spam message" {
+				return bot.Response{}
+			}
+			return bot.Response{Send: true, Text: "this is spam", BanInterval: bot.PermanentBanDuration, ReplyTo: msg.ID,
+				DeleteReplyTo: true, User: bot.User{ID: msg.From.ID, Username: msg.From.Username}}
+		},
+		IsNewUserFunc: func(id int64) bool { return true },
+	}
+	dl := &mocks.DenylistMock{
+		AddFunc:    func(userID int64, msg string) error { return nil },
+		RemoveFunc: func(userID int64) error { return nil },
+	}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator,
+		Bus: subscribed(DenylistHandler(dl), EventActionExecuted)}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	srv.Push(tgtest.Message(100, tgtest.User(1, "spammer"), "spam message"))
+	srv.AssertBanned(t, 100, 1)
+	assert.Eventually(t, func() bool { return len(dl.AddCalls()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), dl.AddCalls()[0].UserID)
+	assert.Equal(t, "spam message", dl.AddCalls()[0].Msg)
+
+	require.NoError(t, listener.UnbanUser(0, 1))
+	require.Len(t, dl.RemoveCalls(), 1)
+	assert.Equal(t, int64(1), dl.RemoveCalls()[0].UserID)
+
+	require.NoError(t, listener.BanUser(0, 2, 0))
+	require.Len(t, dl.AddCalls(), 2)
+	assert.Equal(t, int64(2), dl.AddCalls()[1].UserID)
+	assert.Empty(t, dl.AddCalls()[1].Msg)
+
+	// bans in dry mode are not listed
+	listener.SetModes(true, false)
+	srv.ResetRequests()
+	srv.Push(tgtest.Message(100, tgtest.User(3, "spammer2"), "spam message"))
+	srv.AssertSent(t, 100, "this is spam")
+	require.NoError(t, listener.BanUser(0, 4, 0))
+	assert.Len(t, dl.AddCalls(), 2)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestTelegramListener_Suspicious(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			if msg.Text != "crypto signals are scam" {
+				return bot.Response{}
+			}
+			return bot.Response{CheckResults: []lib.CheckResult{{Name: "similarity", Details: "0.75/0.50, vetoed"},
+				{Name: lib.CheckHamVeto, Details: "suspicious, ham similarity 0.86, spam similarity 0.75, vetoed similarity"}}}
+		},
+		IsNewUserFunc: func(id int64) bool { return true },
+	}
+	sampler := &mocks.HamSamplerMock{SampleFunc: func(msg string) bool { return true }}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator, HamSampler: sampler}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	srv.Push(tgtest.Message(100, tgtest.User(1, "user1"), "crypto signals are scam"))
+	srv.AssertSent(t, 200, "is suspicious, ham similarity 0.86, spam similarity 0.75")
+	srv.ResetRequests()
+
+	srv.Push(tgtest.Message(100, tgtest.User(2, "user2"), "hello everyone"))
+	assert.Eventually(t, func() bool { return len(sampler.SampleCalls()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "hello everyone", sampler.SampleCalls()[0].Msg, "suspicious message not sampled as ham")
+	srv.AssertNoRequest(t, "sendMessage", 100*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestTelegramListener_autoTrain(t *testing.T) {
+	b := &mocks.BotMock{UpdateSpamFunc: func(msg, source string) error {
+		if msg == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	}}
+	l := TelegramListener{Bot: b}
+	confident := bot.Response{CheckResults: []lib.CheckResult{{Name: "cas", Spam: true, Details: "listed"},
+		{Name: "classifier", Spam: true, Details: "probability of spam: 96.00%"}}}
+	doubtful := bot.Response{CheckResults: []lib.CheckResult{{Name: "emoji", Spam: true, Details: "5/2"}}}
+
+	note, pending := l.autoTrain(&bot.Message{Text: "buy crypto"}, confident)
+	assert.Equal(t, "", note, "disabled")
+	assert.False(t, pending)
+
+	l.AutoTrain = 99
+	note, pending = l.autoTrain(&bot.Message{Text: "buy crypto"}, confident)
+	assert.Equal(t, "confidence 99.6%, added to spam samples", note)
+	assert.False(t, pending)
+	require.Len(t, b.UpdateSpamCalls(), 1)
+	assert.Equal(t, "buy crypto", b.UpdateSpamCalls()[0].Msg)
+	assert.Equal(t, "auto:ban", b.UpdateSpamCalls()[0].Source)
+
+	note, pending = l.autoTrain(&bot.Message{Text: "buy crypto"}, doubtful)
+	assert.Equal(t, "confidence 50.0%, confirm to add to spam samples", note)
+	assert.True(t, pending)
+	assert.Len(t, b.UpdateSpamCalls(), 1, "not learned")
+
+	note, pending = l.autoTrain(&bot.Message{Text: "fail"}, confident)
+	assert.Equal(t, "confidence 99.6%, failed to add to spam samples", note)
+	assert.True(t, pending)
+}
+
+func TestTelegramListener_Quota(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			return bot.Response{Send: true, Text: "spam detected", BanInterval: time.Hour, User: msg.From, ReplyTo: msg.ID,
+				DeleteReplyTo: true, CheckResults: []lib.CheckResult{{Name: "stopword", Spam: true, Details: "pills"}}}
+		},
+		IsNewUserFunc: func(id int64) bool { return false },
+	}
+	var stopped atomic.Bool
+	stopped.Store(true)
+	quota := &mocks.QuotaMock{ChecksStoppedFunc: stopped.Load}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator, Quota: quota}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	srv.Push(tgtest.Message(100, tgtest.User(136817601, "spammer"), "cheap pills"))
+	srv.AssertNoRequest(t, "restrictChatMember", 100*time.Millisecond)
+	assert.Empty(t, b.OnMessageCalls(), "not checked while checks stopped")
+
+	stopped.Store(false)
+	srv.Push(tgtest.Message(100, tgtest.User(136817602, "spammer2"), "cheap pills"))
+	srv.AssertBanned(t, 100, 136817602)
+	assert.Len(t, b.OnMessageCalls(), 1)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
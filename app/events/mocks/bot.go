@@ -4,6 +4,7 @@
 package mocks
 
 import (
+	"context"
 	"github.com/umputun/tg-spam/app/bot"
 	"sync"
 )
@@ -17,16 +18,22 @@ import (
 //			AddApprovedUsersFunc: func(id int64, ids ...int64)  {
 //				panic("mock out the AddApprovedUsers method")
 //			},
-//			OnMessageFunc: func(msg bot.Message) bot.Response {
+//			IsNewUserFunc: func(id int64) bool {
+//				panic("mock out the IsNewUser method")
+//			},
+//			OnJoinFunc: func(ctx context.Context, user bot.User) bot.Response {
+//				panic("mock out the OnJoin method")
+//			},
+//			OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
 //				panic("mock out the OnMessage method")
 //			},
 //			RemoveApprovedUsersFunc: func(id int64, ids ...int64)  {
 //				panic("mock out the RemoveApprovedUsers method")
 //			},
-//			UpdateHamFunc: func(msg string) error {
+//			UpdateHamFunc: func(msg string, source string) error {
 //				panic("mock out the UpdateHam method")
 //			},
-//			UpdateSpamFunc: func(msg string) error {
+//			UpdateSpamFunc: func(msg string, source string) error {
 //				panic("mock out the UpdateSpam method")
 //			},
 //		}
@@ -39,17 +46,23 @@ type BotMock struct {
 	// AddApprovedUsersFunc mocks the AddApprovedUsers method.
 	AddApprovedUsersFunc func(id int64, ids ...int64)
 
+	// IsNewUserFunc mocks the IsNewUser method.
+	IsNewUserFunc func(id int64) bool
+
+	// OnJoinFunc mocks the OnJoin method.
+	OnJoinFunc func(ctx context.Context, user bot.User) bot.Response
+
 	// OnMessageFunc mocks the OnMessage method.
-	OnMessageFunc func(msg bot.Message) bot.Response
+	OnMessageFunc func(ctx context.Context, msg bot.Message) bot.Response
 
 	// RemoveApprovedUsersFunc mocks the RemoveApprovedUsers method.
 	RemoveApprovedUsersFunc func(id int64, ids ...int64)
 
 	// UpdateHamFunc mocks the UpdateHam method.
-	UpdateHamFunc func(msg string) error
+	UpdateHamFunc func(msg string, source string) error
 
 	// UpdateSpamFunc mocks the UpdateSpam method.
-	UpdateSpamFunc func(msg string) error
+	UpdateSpamFunc func(msg string, source string) error
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -60,8 +73,22 @@ type BotMock struct {
 			// Ids is the ids argument value.
 			Ids []int64
 		}
+		// IsNewUser holds details about calls to the IsNewUser method.
+		IsNewUser []struct {
+			// ID is the id argument value.
+			ID int64
+		}
+		// OnJoin holds details about calls to the OnJoin method.
+		OnJoin []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// User is the user argument value.
+			User bot.User
+		}
 		// OnMessage holds details about calls to the OnMessage method.
 		OnMessage []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
 			// Msg is the msg argument value.
 			Msg bot.Message
 		}
@@ -76,14 +103,20 @@ type BotMock struct {
 		UpdateHam []struct {
 			// Msg is the msg argument value.
 			Msg string
+			// Source is the source argument value.
+			Source string
 		}
 		// UpdateSpam holds details about calls to the UpdateSpam method.
 		UpdateSpam []struct {
 			// Msg is the msg argument value.
 			Msg string
+			// Source is the source argument value.
+			Source string
 		}
 	}
 	lockAddApprovedUsers    sync.RWMutex
+	lockIsNewUser           sync.RWMutex
+	lockOnJoin              sync.RWMutex
 	lockOnMessage           sync.RWMutex
 	lockRemoveApprovedUsers sync.RWMutex
 	lockUpdateHam           sync.RWMutex
@@ -109,7 +142,7 @@ func (mock *BotMock) AddApprovedUsers(id int64, ids ...int64) {
 }
 
 // AddApprovedUsersCalls gets all the calls that were made to AddApprovedUsers.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedBot.AddApprovedUsersCalls())
 func (mock *BotMock) AddApprovedUsersCalls() []struct {
@@ -133,30 +166,116 @@ func (mock *BotMock) ResetAddApprovedUsersCalls() {
 	mock.lockAddApprovedUsers.Unlock()
 }
 
+// IsNewUser calls IsNewUserFunc.
+func (mock *BotMock) IsNewUser(id int64) bool {
+	if mock.IsNewUserFunc == nil {
+		panic("BotMock.IsNewUserFunc: method is nil but Bot.IsNewUser was just called")
+	}
+	callInfo := struct {
+		ID int64
+	}{
+		ID: id,
+	}
+	mock.lockIsNewUser.Lock()
+	mock.calls.IsNewUser = append(mock.calls.IsNewUser, callInfo)
+	mock.lockIsNewUser.Unlock()
+	return mock.IsNewUserFunc(id)
+}
+
+// IsNewUserCalls gets all the calls that were made to IsNewUser.
+// check the length with:
+//
+//	len(mockedBot.IsNewUserCalls())
+func (mock *BotMock) IsNewUserCalls() []struct {
+	ID int64
+} {
+	var calls []struct {
+		ID int64
+	}
+	mock.lockIsNewUser.RLock()
+	calls = mock.calls.IsNewUser
+	mock.lockIsNewUser.RUnlock()
+	return calls
+}
+
+// ResetIsNewUserCalls reset all the calls that were made to IsNewUser.
+func (mock *BotMock) ResetIsNewUserCalls() {
+	mock.lockIsNewUser.Lock()
+	mock.calls.IsNewUser = nil
+	mock.lockIsNewUser.Unlock()
+}
+
+// OnJoin calls OnJoinFunc.
+func (mock *BotMock) OnJoin(ctx context.Context, user bot.User) bot.Response {
+	if mock.OnJoinFunc == nil {
+		panic("BotMock.OnJoinFunc: method is nil but Bot.OnJoin was just called")
+	}
+	callInfo := struct {
+		Ctx  context.Context
+		User bot.User
+	}{
+		Ctx:  ctx,
+		User: user,
+	}
+	mock.lockOnJoin.Lock()
+	mock.calls.OnJoin = append(mock.calls.OnJoin, callInfo)
+	mock.lockOnJoin.Unlock()
+	return mock.OnJoinFunc(ctx, user)
+}
+
+// OnJoinCalls gets all the calls that were made to OnJoin.
+// check the length with:
+//
+//	len(mockedBot.OnJoinCalls())
+func (mock *BotMock) OnJoinCalls() []struct {
+	Ctx  context.Context
+	User bot.User
+} {
+	var calls []struct {
+		Ctx  context.Context
+		User bot.User
+	}
+	mock.lockOnJoin.RLock()
+	calls = mock.calls.OnJoin
+	mock.lockOnJoin.RUnlock()
+	return calls
+}
+
+// ResetOnJoinCalls reset all the calls that were made to OnJoin.
+func (mock *BotMock) ResetOnJoinCalls() {
+	mock.lockOnJoin.Lock()
+	mock.calls.OnJoin = nil
+	mock.lockOnJoin.Unlock()
+}
+
 // OnMessage calls OnMessageFunc.
-func (mock *BotMock) OnMessage(msg bot.Message) bot.Response {
+func (mock *BotMock) OnMessage(ctx context.Context, msg bot.Message) bot.Response {
 	if mock.OnMessageFunc == nil {
 		panic("BotMock.OnMessageFunc: method is nil but Bot.OnMessage was just called")
 	}
 	callInfo := struct {
+		Ctx context.Context
 		Msg bot.Message
 	}{
+		Ctx: ctx,
 		Msg: msg,
 	}
 	mock.lockOnMessage.Lock()
 	mock.calls.OnMessage = append(mock.calls.OnMessage, callInfo)
 	mock.lockOnMessage.Unlock()
-	return mock.OnMessageFunc(msg)
+	return mock.OnMessageFunc(ctx, msg)
 }
 
 // OnMessageCalls gets all the calls that were made to OnMessage.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedBot.OnMessageCalls())
 func (mock *BotMock) OnMessageCalls() []struct {
+	Ctx context.Context
 	Msg bot.Message
 } {
 	var calls []struct {
+		Ctx context.Context
 		Msg bot.Message
 	}
 	mock.lockOnMessage.RLock()
@@ -191,7 +310,7 @@ func (mock *BotMock) RemoveApprovedUsers(id int64, ids ...int64) {
 }
 
 // RemoveApprovedUsersCalls gets all the calls that were made to RemoveApprovedUsers.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedBot.RemoveApprovedUsersCalls())
 func (mock *BotMock) RemoveApprovedUsersCalls() []struct {
@@ -216,30 +335,34 @@ func (mock *BotMock) ResetRemoveApprovedUsersCalls() {
 }
 
 // UpdateHam calls UpdateHamFunc.
-func (mock *BotMock) UpdateHam(msg string) error {
+func (mock *BotMock) UpdateHam(msg string, source string) error {
 	if mock.UpdateHamFunc == nil {
 		panic("BotMock.UpdateHamFunc: method is nil but Bot.UpdateHam was just called")
 	}
 	callInfo := struct {
-		Msg string
+		Msg    string
+		Source string
 	}{
-		Msg: msg,
+		Msg:    msg,
+		Source: source,
 	}
 	mock.lockUpdateHam.Lock()
 	mock.calls.UpdateHam = append(mock.calls.UpdateHam, callInfo)
 	mock.lockUpdateHam.Unlock()
-	return mock.UpdateHamFunc(msg)
+	return mock.UpdateHamFunc(msg, source)
 }
 
 // UpdateHamCalls gets all the calls that were made to UpdateHam.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedBot.UpdateHamCalls())
 func (mock *BotMock) UpdateHamCalls() []struct {
-	Msg string
+	Msg    string
+	Source string
 } {
 	var calls []struct {
-		Msg string
+		Msg    string
+		Source string
 	}
 	mock.lockUpdateHam.RLock()
 	calls = mock.calls.UpdateHam
@@ -255,30 +378,34 @@ func (mock *BotMock) ResetUpdateHamCalls() {
 }
 
 // UpdateSpam calls UpdateSpamFunc.
-func (mock *BotMock) UpdateSpam(msg string) error {
+func (mock *BotMock) UpdateSpam(msg string, source string) error {
 	if mock.UpdateSpamFunc == nil {
 		panic("BotMock.UpdateSpamFunc: method is nil but Bot.UpdateSpam was just called")
 	}
 	callInfo := struct {
-		Msg string
+		Msg    string
+		Source string
 	}{
-		Msg: msg,
+		Msg:    msg,
+		Source: source,
 	}
 	mock.lockUpdateSpam.Lock()
 	mock.calls.UpdateSpam = append(mock.calls.UpdateSpam, callInfo)
 	mock.lockUpdateSpam.Unlock()
-	return mock.UpdateSpamFunc(msg)
+	return mock.UpdateSpamFunc(msg, source)
 }
 
 // UpdateSpamCalls gets all the calls that were made to UpdateSpam.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedBot.UpdateSpamCalls())
 func (mock *BotMock) UpdateSpamCalls() []struct {
-	Msg string
+	Msg    string
+	Source string
 } {
 	var calls []struct {
-		Msg string
+		Msg    string
+		Source string
 	}
 	mock.lockUpdateSpam.RLock()
 	calls = mock.calls.UpdateSpam
@@ -299,6 +426,14 @@ func (mock *BotMock) ResetCalls() {
 	mock.calls.AddApprovedUsers = nil
 	mock.lockAddApprovedUsers.Unlock()
 
+	mock.lockIsNewUser.Lock()
+	mock.calls.IsNewUser = nil
+	mock.lockIsNewUser.Unlock()
+
+	mock.lockOnJoin.Lock()
+	mock.calls.OnJoin = nil
+	mock.lockOnJoin.Unlock()
+
 	mock.lockOnMessage.Lock()
 	mock.calls.OnMessage = nil
 	mock.lockOnMessage.Unlock()
@@ -20,6 +20,12 @@ import (
 //			GetChatAdministratorsFunc: func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error) {
 //				panic("mock out the GetChatAdministrators method")
 //			},
+//			GetChatMemberFunc: func(config tbapi.GetChatMemberConfig) (tbapi.ChatMember, error) {
+//				panic("mock out the GetChatMember method")
+//			},
+//			GetMeFunc: func() (tbapi.User, error) {
+//				panic("mock out the GetMe method")
+//			},
 //			GetUpdatesChanFunc: func(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
 //				panic("mock out the GetUpdatesChan method")
 //			},
@@ -42,6 +48,12 @@ type TbAPIMock struct {
 	// GetChatAdministratorsFunc mocks the GetChatAdministrators method.
 	GetChatAdministratorsFunc func(config tbapi.ChatAdministratorsConfig) ([]tbapi.ChatMember, error)
 
+	// GetChatMemberFunc mocks the GetChatMember method.
+	GetChatMemberFunc func(config tbapi.GetChatMemberConfig) (tbapi.ChatMember, error)
+
+	// GetMeFunc mocks the GetMe method.
+	GetMeFunc func() (tbapi.User, error)
+
 	// GetUpdatesChanFunc mocks the GetUpdatesChan method.
 	GetUpdatesChanFunc func(config tbapi.UpdateConfig) tbapi.UpdatesChannel
 
@@ -63,6 +75,14 @@ type TbAPIMock struct {
 			// Config is the config argument value.
 			Config tbapi.ChatAdministratorsConfig
 		}
+		// GetChatMember holds details about calls to the GetChatMember method.
+		GetChatMember []struct {
+			// Config is the config argument value.
+			Config tbapi.GetChatMemberConfig
+		}
+		// GetMe holds details about calls to the GetMe method.
+		GetMe []struct {
+		}
 		// GetUpdatesChan holds details about calls to the GetUpdatesChan method.
 		GetUpdatesChan []struct {
 			// Config is the config argument value.
@@ -81,6 +101,8 @@ type TbAPIMock struct {
 	}
 	lockGetChat               sync.RWMutex
 	lockGetChatAdministrators sync.RWMutex
+	lockGetChatMember         sync.RWMutex
+	lockGetMe                 sync.RWMutex
 	lockGetUpdatesChan        sync.RWMutex
 	lockRequest               sync.RWMutex
 	lockSend                  sync.RWMutex
@@ -103,7 +125,7 @@ func (mock *TbAPIMock) GetChat(config tbapi.ChatInfoConfig) (tbapi.Chat, error)
 }
 
 // GetChatCalls gets all the calls that were made to GetChat.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedTbAPI.GetChatCalls())
 func (mock *TbAPIMock) GetChatCalls() []struct {
@@ -142,7 +164,7 @@ func (mock *TbAPIMock) GetChatAdministrators(config tbapi.ChatAdministratorsConf
 }
 
 // GetChatAdministratorsCalls gets all the calls that were made to GetChatAdministrators.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedTbAPI.GetChatAdministratorsCalls())
 func (mock *TbAPIMock) GetChatAdministratorsCalls() []struct {
@@ -164,6 +186,79 @@ func (mock *TbAPIMock) ResetGetChatAdministratorsCalls() {
 	mock.lockGetChatAdministrators.Unlock()
 }
 
+// GetChatMember calls GetChatMemberFunc.
+func (mock *TbAPIMock) GetChatMember(config tbapi.GetChatMemberConfig) (tbapi.ChatMember, error) {
+	if mock.GetChatMemberFunc == nil {
+		panic("TbAPIMock.GetChatMemberFunc: method is nil but TbAPI.GetChatMember was just called")
+	}
+	callInfo := struct {
+		Config tbapi.GetChatMemberConfig
+	}{
+		Config: config,
+	}
+	mock.lockGetChatMember.Lock()
+	mock.calls.GetChatMember = append(mock.calls.GetChatMember, callInfo)
+	mock.lockGetChatMember.Unlock()
+	return mock.GetChatMemberFunc(config)
+}
+
+// GetChatMemberCalls gets all the calls that were made to GetChatMember.
+// check the length with:
+//
+//	len(mockedTbAPI.GetChatMemberCalls())
+func (mock *TbAPIMock) GetChatMemberCalls() []struct {
+	Config tbapi.GetChatMemberConfig
+} {
+	var calls []struct {
+		Config tbapi.GetChatMemberConfig
+	}
+	mock.lockGetChatMember.RLock()
+	calls = mock.calls.GetChatMember
+	mock.lockGetChatMember.RUnlock()
+	return calls
+}
+
+// ResetGetChatMemberCalls reset all the calls that were made to GetChatMember.
+func (mock *TbAPIMock) ResetGetChatMemberCalls() {
+	mock.lockGetChatMember.Lock()
+	mock.calls.GetChatMember = nil
+	mock.lockGetChatMember.Unlock()
+}
+
+// GetMe calls GetMeFunc.
+func (mock *TbAPIMock) GetMe() (tbapi.User, error) {
+	if mock.GetMeFunc == nil {
+		panic("TbAPIMock.GetMeFunc: method is nil but TbAPI.GetMe was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockGetMe.Lock()
+	mock.calls.GetMe = append(mock.calls.GetMe, callInfo)
+	mock.lockGetMe.Unlock()
+	return mock.GetMeFunc()
+}
+
+// GetMeCalls gets all the calls that were made to GetMe.
+// check the length with:
+//
+//	len(mockedTbAPI.GetMeCalls())
+func (mock *TbAPIMock) GetMeCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockGetMe.RLock()
+	calls = mock.calls.GetMe
+	mock.lockGetMe.RUnlock()
+	return calls
+}
+
+// ResetGetMeCalls reset all the calls that were made to GetMe.
+func (mock *TbAPIMock) ResetGetMeCalls() {
+	mock.lockGetMe.Lock()
+	mock.calls.GetMe = nil
+	mock.lockGetMe.Unlock()
+}
+
 // GetUpdatesChan calls GetUpdatesChanFunc.
 func (mock *TbAPIMock) GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesChannel {
 	if mock.GetUpdatesChanFunc == nil {
@@ -181,7 +276,7 @@ func (mock *TbAPIMock) GetUpdatesChan(config tbapi.UpdateConfig) tbapi.UpdatesCh
 }
 
 // GetUpdatesChanCalls gets all the calls that were made to GetUpdatesChan.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedTbAPI.GetUpdatesChanCalls())
 func (mock *TbAPIMock) GetUpdatesChanCalls() []struct {
@@ -220,7 +315,7 @@ func (mock *TbAPIMock) Request(c tbapi.Chattable) (*tbapi.APIResponse, error) {
 }
 
 // RequestCalls gets all the calls that were made to Request.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedTbAPI.RequestCalls())
 func (mock *TbAPIMock) RequestCalls() []struct {
@@ -259,7 +354,7 @@ func (mock *TbAPIMock) Send(c tbapi.Chattable) (tbapi.Message, error) {
 }
 
 // SendCalls gets all the calls that were made to Send.
-// Check the length with:
+// check the length with:
 //
 //	len(mockedTbAPI.SendCalls())
 func (mock *TbAPIMock) SendCalls() []struct {
@@ -291,6 +386,14 @@ func (mock *TbAPIMock) ResetCalls() {
 	mock.calls.GetChatAdministrators = nil
 	mock.lockGetChatAdministrators.Unlock()
 
+	mock.lockGetChatMember.Lock()
+	mock.calls.GetChatMember = nil
+	mock.lockGetChatMember.Unlock()
+
+	mock.lockGetMe.Lock()
+	mock.calls.GetMe = nil
+	mock.lockGetMe.Unlock()
+
 	mock.lockGetUpdatesChan.Lock()
 	mock.calls.GetUpdatesChan = nil
 	mock.lockGetUpdatesChan.Unlock()
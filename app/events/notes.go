@@ -0,0 +1,65 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// maxReportedNotes is the max number of the latest notes of the user shown in ban reports
+const maxReportedNotes = 3
+
+// noteCommand adds a note about the user on "/note <user id> <text>" command of super-user in admin chat,
+// i.e. "/note 123 warned twice for self-promo #promo", and confirms it with all the latest notes of the user.
+// The command is ignored if notes are not supported.
+func (a *admin) noteCommand(msg *tbapi.Message) error {
+	if a.notes == nil {
+		return nil
+	}
+	args := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 2)
+	if len(args) < 2 || strings.TrimSpace(args[1]) == "" {
+		return fmt.Errorf("invalid note command %q, expected /note <user id> <text>", msg.Text)
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || userID == 0 {
+		return fmt.Errorf("invalid user id %q in note command", args[0])
+	}
+	note, err := a.notes.Add(storage.UserNote{UserID: userID, Text: args[1], Author: adminSource(msg.From)})
+	if err != nil {
+		return fmt.Errorf("failed to add note of user %d: %w", userID, err)
+	}
+	log.Printf("[INFO] note %d of user %d added by %s", note.ID, userID, note.Author)
+
+	text := fmt.Sprintf("note added to user %d", userID)
+	if notes := a.userNotes(userID); notes != "" {
+		text += ", notes: " + notes
+	}
+	if err = send(tbapi.NewMessage(a.adminChatID, text), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send note confirmation: %w", err)
+	}
+	return nil
+}
+
+// userNotes returns the latest notes of the user in a line, newest first, empty if no notes or notes not supported.
+// Failures to read notes are logged only, notes are informational.
+func (a *admin) userNotes(userID int64) string {
+	if a.notes == nil {
+		return ""
+	}
+	notes, err := a.notes.ByUser(userID, maxReportedNotes)
+	if err != nil {
+		log.Printf("[WARN] failed to read notes of user %d, %v", userID, err)
+		return ""
+	}
+	res := make([]string, 0, len(notes))
+	for _, n := range notes {
+		res = append(res, fmt.Sprintf("%q (%s, %s)", strings.ReplaceAll(n.Text, "\n", " "), n.Author,
+			n.Timestamp.Format("2006-01-02")))
+	}
+	return strings.Join(res, "; ")
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func TestAdmin_noteCommand(t *testing.T) {
+	command := func(text string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{Text: text, From: &tbapi.User{UserName: "admin"},
+			Entities: []tbapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(strings.Fields(text)[0])}}}}
+	}
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	notes := &mocks.UserNotesMock{
+		AddFunc: func(note storage.UserNote) (storage.UserNote, error) {
+			if note.UserID == 13 {
+				return storage.UserNote{}, errors.New("db error")
+			}
+			note.ID = 1
+			return note, nil
+		},
+		ByUserFunc: func(userID int64, limit int) ([]storage.UserNote, error) {
+			return []storage.UserNote{{ID: 1, UserID: userID, Text: "warned twice\nfor #promo", Author: "admin:admin",
+				Timestamp: ts}}, nil
+		},
+	}
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123, notes: notes}
+
+	t.Run("add note", func(t *testing.T) {
+		require.NoError(t, adm.MsgHandler(command("/note 10 warned twice\nfor #promo")))
+		require.Len(t, notes.AddCalls(), 1)
+		assert.Equal(t, storage.UserNote{UserID: 10, Text: "warned twice\nfor #promo", Author: "admin:admin"},
+			notes.AddCalls()[0].Note)
+		require.Len(t, notes.ByUserCalls(), 1)
+		assert.Equal(t, maxReportedNotes, notes.ByUserCalls()[0].Limit)
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, `note added to user 10, notes: "warned twice for #promo" (admin:admin, 2024-05-01)`,
+			mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	})
+
+	t.Run("invalid commands", func(t *testing.T) {
+		notes.ResetCalls()
+		mockAPI.ResetCalls()
+		require.Error(t, adm.MsgHandler(command("/note")))
+		require.Error(t, adm.MsgHandler(command("/note 10")))
+		require.Error(t, adm.MsgHandler(command("/note bad text")))
+		require.Error(t, adm.MsgHandler(command("/note 13 failed to store")))
+		assert.Len(t, notes.AddCalls(), 1)
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+
+	t.Run("notes not supported", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		noNotes := admin{tbAPI: mockAPI, adminChatID: 123}
+		require.NoError(t, noNotes.MsgHandler(command("/note 10 some text")))
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+}
+
+func TestAdmin_reportBanWithNotes(t *testing.T) {
+	notes := &mocks.UserNotesMock{
+		ByUserFunc: func(userID int64, limit int) ([]storage.UserNote, error) {
+			if userID == 13 {
+				return nil, errors.New("db error")
+			}
+			return []storage.UserNote{
+				{Text: "second warning", Author: "admin:bob", Timestamp: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+				{Text: "self_promo", Author: "web:basic", Timestamp: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+			}, nil
+		},
+	}
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123, notes: notes}
+
+	adm.ReportBan("testUser", &bot.Message{From: bot.User{ID: 456}, Text: "buy crypto"}, "", false)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	assert.Equal(t, "**permanently banned [testUser](tg://user?id=456)**, notes: "+
+		`"second warning" (admin:bob, 2024-05-02); "self\_promo" (web:basic, 2024-05-01)`+"\n\nbuy crypto\n\n",
+		mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	assert.Equal(t, int64(456), notes.ByUserCalls()[0].UserID)
+
+	adm.ReportBan("testUser", &bot.Message{From: bot.User{ID: 13}, Text: "buy crypto"}, "", false)
+	require.Len(t, mockAPI.SendCalls(), 2)
+	assert.Equal(t, "**permanently banned [testUser](tg://user?id=13)**\n\nbuy crypto\n\n",
+		mockAPI.SendCalls()[1].C.(tbapi.MessageConfig).Text, "notes skipped on error")
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// addEntities keeps formatting of the message in the locator, i.e. links hidden behind text,
+// to show the original message to admins. Failure is logged only.
+func (l *TelegramListener) addEntities(msg *tbapi.Message) {
+	if len(msg.Entities) == 0 || msg.Chat == nil {
+		return
+	}
+	entities, err := json.Marshal(msg.Entities)
+	if err != nil {
+		log.Printf("[WARN] failed to marshal entities of message %d, %v", msg.MessageID, err)
+		return
+	}
+	if err = l.Locator.AddEntities(msg.Chat.ID, msg.MessageID, string(entities)); err != nil {
+		log.Printf("[WARN] failed to add entities of message %d to locator, %v", msg.MessageID, err)
+	}
+}
+
+// callbackShowOriginal handles the callback when admin asks for the original message of the report. The message
+// kept by the locator is posted as a reply to the report, with formatting and link preview, as the report shows
+// the plain text excerpt only. If the message is not kept anymore, i.e. expired, admin is notified with the callback answer.
+// callback data: =chatID:msgID
+func (a *admin) callbackShowOriginal(query *tbapi.CallbackQuery) error {
+	chatStr, msgStr, _ := strings.Cut(query.Data[1:], ":")
+	chatID, errChat := strconv.ParseInt(chatStr, 10, 64)
+	msgID, errMsg := strconv.Atoi(msgStr)
+	if errChat != nil || errMsg != nil {
+		return fmt.Errorf("failed to parse original message %q", query.Data[1:])
+	}
+
+	original, ok := a.locator.Original(chatID, msgID)
+	if !ok || original.Text == "" {
+		if _, err := a.tbAPI.Request(tbapi.NewCallback(query.ID, "original message is not kept anymore")); err != nil {
+			return fmt.Errorf("failed to answer original message callback: %w", err)
+		}
+		return nil
+	}
+	tbMsg := tbapi.NewMessage(query.Message.Chat.ID, original.Text)
+	tbMsg.ReplyToMessageID = query.Message.MessageID
+	if original.Entities != "" {
+		if err := json.Unmarshal([]byte(original.Entities), &tbMsg.Entities); err != nil {
+			log.Printf("[WARN] failed to unmarshal entities of message %d, %v", msgID, err)
+		}
+	}
+	// sent as is, without parse mode, formatting is set by entities
+	if _, err := a.tbAPI.Send(tbMsg); err != nil {
+		return fmt.Errorf("failed to send original message %d: %w", msgID, err)
+	}
+	return nil
+}
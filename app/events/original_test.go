@@ -0,0 +1,80 @@
+package events
+
+import (
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestAdmin_showOriginal(t *testing.T) {
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	l := TelegramListener{Locator: locator}
+	tgMsg := &tbapi.Message{MessageID: 10, Chat: &tbapi.Chat{ID: 100}, Text: "free crypto here",
+		Entities: []tbapi.MessageEntity{{Type: "bold", Offset: 0, Length: 4},
+			{Type: "text_link", Offset: 5, Length: 6, URL: "https://spam.example.com"}}}
+	require.NoError(t, locator.AddMessage(tgMsg.Text, 100, 1, "spammer", 10))
+	l.addEntities(tgMsg)
+	require.NoError(t, locator.AddMessage("plain spam", 100, 1, "spammer", 11))
+	l.addEntities(&tbapi.Message{MessageID: 11, Chat: &tbapi.Chat{ID: 100}, Text: "plain spam"})
+
+	adm := admin{tbAPI: mockAPI, locator: locator, primChatID: 100, adminChatID: 200}
+	adm.ReportBan("spammer", &bot.Message{ID: 10, ChatID: 100, From: bot.User{ID: 1}, Text: tgMsg.Text}, "", false)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	keyboard := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard
+	require.Len(t, keyboard, 2)
+	assert.Len(t, keyboard[0], 2, "unban and info buttons")
+	assert.Equal(t, "📄 original", keyboard[1][0].Text)
+	assert.Equal(t, "=100:10", *keyboard[1][0].CallbackData)
+
+	report := &tbapi.Message{MessageID: 50, Chat: &tbapi.Chat{ID: 200}}
+	t.Run("original with formatting", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		require.NoError(t, adm.InlineCallbackHandler(&tbapi.CallbackQuery{ID: "1", Message: report, Data: "=100:10"}))
+		require.Len(t, mockAPI.SendCalls(), 1)
+		sent := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig)
+		assert.Equal(t, int64(200), sent.ChatID)
+		assert.Equal(t, 50, sent.ReplyToMessageID)
+		assert.Equal(t, "free crypto here", sent.Text)
+		assert.Equal(t, tgMsg.Entities, sent.Entities)
+		assert.Empty(t, sent.ParseMode)
+	})
+
+	t.Run("original without formatting", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		require.NoError(t, adm.InlineCallbackHandler(&tbapi.CallbackQuery{ID: "2", Message: report, Data: "=100:11"}))
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, "plain spam", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+		assert.Empty(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Entities)
+	})
+
+	t.Run("not kept", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		require.NoError(t, adm.InlineCallbackHandler(&tbapi.CallbackQuery{ID: "3", Message: report, Data: "=100:12"}))
+		assert.Empty(t, mockAPI.SendCalls())
+		require.Len(t, mockAPI.RequestCalls(), 1)
+		assert.Equal(t, "original message is not kept anymore", mockAPI.RequestCalls()[0].C.(tbapi.CallbackConfig).Text)
+	})
+
+	t.Run("invalid callback", func(t *testing.T) {
+		assert.Error(t, adm.InlineCallbackHandler(&tbapi.CallbackQuery{ID: "4", Message: report, Data: "=100"}))
+		assert.Error(t, adm.InlineCallbackHandler(&tbapi.CallbackQuery{ID: "5", Message: report, Data: "=abc:10"}))
+	})
+
+	t.Run("no button without locator", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		adm := admin{tbAPI: mockAPI, primChatID: 100, adminChatID: 200}
+		adm.ReportBan("spammer", &bot.Message{ID: 10, ChatID: 100, From: bot.User{ID: 1}, Text: tgMsg.Text}, "", false)
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Len(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ReplyMarkup.(tbapi.InlineKeyboardMarkup).InlineKeyboard, 1)
+	})
+}
@@ -0,0 +1,128 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// protectedUser returns the first protected user of the ids, zero ids are skipped. Failure to check
+// the protection is logged only, the user is not protected then, so spammers are banned with storage down.
+func (l *TelegramListener) protectedUser(ids ...int64) (storage.ProtectedUser, bool) {
+	if l.Protected == nil {
+		return storage.ProtectedUser{}, false
+	}
+	for _, id := range ids {
+		if id == 0 {
+			continue
+		}
+		user, ok, err := l.Protected.Get(id)
+		if err != nil {
+			log.Printf("[WARN] failed to check protection of user %d, %v", id, err)
+			continue
+		}
+		if ok {
+			return user, true
+		}
+	}
+	return storage.ProtectedUser{}, false
+}
+
+// reportProtected reports the spam verdict of the protected user to admin chat, no action is taken on it
+func (l *TelegramListener) reportProtected(user bot.User, text string, resp bot.Response, pu storage.ProtectedUser) {
+	checks := []string{}
+	for _, cr := range resp.CheckResults {
+		if cr.Spam {
+			checks = append(checks, fmt.Sprintf("%s: %s", cr.Name, cr.Details))
+		}
+	}
+	protected := "protected"
+	if pu.Note != "" {
+		protected += " (" + pu.Note + ")"
+	}
+	alert := fmt.Sprintf("spam verdict of %s user %v ignored, %s", protected, user, strings.Join(checks, ", "))
+	log.Printf("[INFO] %s", alert)
+	if text != "" {
+		alert += ":\n" + excerpt(text)
+	}
+	if err := l.AdminAlert(alert); err != nil {
+		log.Printf("[WARN] failed to report protected user %d, %v", user.ID, err)
+	}
+}
+
+// protectCommand protects the user from bans of the bot on "/protect <user id> [note]" command of super-user
+// in admin chat, i.e. "/protect 123 partner bot". The command is ignored if protected users are not supported.
+func (a *admin) protectCommand(msg *tbapi.Message) error {
+	if a.protected == nil {
+		return nil
+	}
+	args := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 2)
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || userID == 0 {
+		return fmt.Errorf("invalid protect command %q, expected /protect <user id> [note]", msg.Text)
+	}
+	user := storage.ProtectedUser{UserID: userID, AddedBy: adminSource(msg.From)}
+	if len(args) > 1 {
+		user.Note = strings.TrimSpace(args[1])
+	}
+	if err = a.protected.Add(user); err != nil {
+		return fmt.Errorf("failed to protect user %d: %w", userID, err)
+	}
+	log.Printf("[INFO] user %d protected by %s", userID, user.AddedBy)
+	auditAdd(a.audit, storage.ModerationAction{Action: "protect", UserID: userID, Actor: user.AddedBy, Details: user.Note})
+	text := fmt.Sprintf("user %d protected, spam verdicts of the user are reported here instead of ban", userID)
+	if err = send(tbapi.NewMessage(a.adminChatID, text), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send protect confirmation: %w", err)
+	}
+	return nil
+}
+
+// unprotectCommand removes the protection of the user on "/unprotect <user id>" command of super-user in admin chat.
+// Users protected by options can't be removed with the command.
+func (a *admin) unprotectCommand(msg *tbapi.Message) error {
+	if a.protected == nil {
+		return nil
+	}
+	userID, err := strconv.ParseInt(strings.TrimSpace(msg.CommandArguments()), 10, 64)
+	if err != nil || userID == 0 {
+		return fmt.Errorf("invalid unprotect command %q, expected /unprotect <user id>", msg.Text)
+	}
+	if err = a.protected.Remove(userID); err != nil {
+		return fmt.Errorf("failed to unprotect user %d: %w", userID, err)
+	}
+	log.Printf("[INFO] user %d unprotected by %s", userID, adminSource(msg.From))
+	auditAdd(a.audit, storage.ModerationAction{Action: "unprotect", UserID: userID, Actor: adminSource(msg.From)})
+	if err = send(tbapi.NewMessage(a.adminChatID, fmt.Sprintf("user %d unprotected", userID)), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send unprotect confirmation: %w", err)
+	}
+	return nil
+}
+
+// protectedCommand lists protected users on "/protected" command of super-user in admin chat
+func (a *admin) protectedCommand() error {
+	if a.protected == nil {
+		return nil
+	}
+	users, err := a.protected.List()
+	if err != nil {
+		return fmt.Errorf("failed to list protected users: %w", err)
+	}
+	lines := []string{fmt.Sprintf("protected users: %d", len(users))}
+	for _, u := range users {
+		line := fmt.Sprintf("- %d, by %s", u.UserID, u.AddedBy)
+		if u.Note != "" {
+			line += ": " + u.Note
+		}
+		lines = append(lines, line)
+	}
+	if err = send(tbapi.NewMessage(a.adminChatID, escapeMarkDownV1Text(strings.Join(lines, "\n"))), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send protected users: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/tgtest"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestTelegramListener_Protected(t *testing.T) {
+	srv := tgtest.NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	b := &mocks.BotMock{
+		OnMessageFunc: func(ctx context.Context, msg bot.Message) bot.Response {
+			return bot.Response{Send: true, Text: "spam detected", BanInterval: time.Hour, User: msg.From, ReplyTo: msg.ID,
+				DeleteReplyTo: true, CheckResults: []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"}}}
+		},
+		IsNewUserFunc: func(id int64) bool { return false },
+	}
+	protected := &mocks.ProtectedUsersMock{GetFunc: func(userID int64) (storage.ProtectedUser, bool, error) {
+		if userID == 1 {
+			return storage.ProtectedUser{UserID: 1, Note: "partner bot"}, true, nil
+		}
+		if userID == 3 {
+			return storage.ProtectedUser{}, false, errors.New("db error")
+		}
+		return storage.ProtectedUser{}, false, nil
+	}}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listener := TelegramListener{TbAPI: api, Bot: b, Group: "group", AdminGroup: "200", Locator: locator, Protected: protected}
+	done := make(chan error)
+	go func() { done <- listener.Do(ctx) }()
+
+	srv.Push(tgtest.Message(100, tgtest.User(1, "partner"), "buy now, the new release is out"))
+	alert := srv.AssertSent(t, 200, "spam verdict of protected (partner bot) user")
+	assert.Contains(t, alert.Text(), "ignored, stopword: buy now")
+	assert.Contains(t, alert.Text(), "the new release is out")
+	srv.AssertNoRequest(t, "restrictChatMember", 100*time.Millisecond)
+	assert.Empty(t, srv.Requests("deleteMessage"))
+	for _, r := range srv.Requests("sendMessage") {
+		assert.NotEqual(t, int64(100), r.ChatID(), "no reply to the group")
+	}
+
+	srv.ResetRequests()
+	srv.Push(tgtest.Message(100, tgtest.User(3, "spammer"), "buy now, cheap pills"))
+	srv.AssertBanned(t, 100, 3) // failed check of protection doesn't stop the ban
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestTelegramListener_protectedJoin(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+		SendFunc:    func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+	}
+	b := &mocks.BotMock{OnJoinFunc: func(ctx context.Context, user bot.User) bot.Response {
+		return bot.Response{Send: true, BanInterval: bot.PermanentBanDuration, User: user,
+			CheckResults: []lib.CheckResult{{Name: "cas", Spam: true, Details: "record found"}}}
+	}}
+	protected := &mocks.ProtectedUsersMock{GetFunc: func(userID int64) (storage.ProtectedUser, bool, error) {
+		return storage.ProtectedUser{UserID: userID}, true, nil
+	}}
+	l := &TelegramListener{TbAPI: mockAPI, Bot: b, JoinCheck: true, JoinBan: true, Protected: protected, chatID: 123,
+		adminChatID: 456}
+	l.running.Store(true)
+
+	upd := &tbapi.ChatMemberUpdated{Chat: tbapi.Chat{ID: 123}, OldChatMember: tbapi.ChatMember{Status: "left"},
+		NewChatMember: tbapi.ChatMember{Status: "member", User: &tbapi.User{ID: 1, UserName: "founder_alt"}}}
+	require.NoError(t, l.procJoin(context.Background(), upd))
+	assert.Empty(t, mockAPI.RequestCalls(), "not banned")
+	require.Len(t, mockAPI.SendCalls(), 1)
+	assert.Contains(t, mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text, "spam verdict of protected user")
+}
+
+func TestAdmin_protectCommands(t *testing.T) {
+	command := func(text string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{Text: text, From: &tbapi.User{UserName: "admin"},
+			Entities: []tbapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(strings.Fields(text)[0])}}}}
+	}
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	protected := &mocks.ProtectedUsersMock{
+		AddFunc: func(user storage.ProtectedUser) error { return nil },
+		RemoveFunc: func(userID int64) error {
+			if userID == 13 {
+				return errors.New("user 13 is protected by options")
+			}
+			return nil
+		},
+		ListFunc: func() ([]storage.ProtectedUser, error) {
+			return []storage.ProtectedUser{{UserID: 10, Note: "partner_bot", AddedBy: "admin:admin", Timestamp: ts},
+				{UserID: 13, AddedBy: storage.ProtectedConfig, Timestamp: ts}}, nil
+		},
+	}
+	audit := &mocks.ModerationAuditMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	adm := admin{tbAPI: mockAPI, adminChatID: 123, protected: protected, audit: audit}
+
+	require.NoError(t, adm.MsgHandler(command("/protect 10 partner bot")))
+	require.Len(t, protected.AddCalls(), 1)
+	assert.Equal(t, storage.ProtectedUser{UserID: 10, Note: "partner bot", AddedBy: "admin:admin"}, protected.AddCalls()[0].User)
+	require.Len(t, audit.AddCalls(), 1)
+	assert.Equal(t, storage.ModerationAction{Action: "protect", UserID: 10, Actor: "admin:admin", Details: "partner bot"},
+		audit.AddCalls()[0].Action)
+	require.NoError(t, adm.MsgHandler(command("/protect 11")))
+	assert.Equal(t, storage.ProtectedUser{UserID: 11, AddedBy: "admin:admin"}, protected.AddCalls()[1].User)
+
+	require.NoError(t, adm.MsgHandler(command("/unprotect 10")))
+	require.Len(t, protected.RemoveCalls(), 1)
+	assert.Equal(t, int64(10), protected.RemoveCalls()[0].UserID)
+	assert.Equal(t, storage.ModerationAction{Action: "unprotect", UserID: 10, Actor: "admin:admin"}, audit.AddCalls()[2].Action)
+	assert.ErrorContains(t, adm.MsgHandler(command("/unprotect 13")), "protected by options")
+
+	mockAPI.ResetCalls()
+	require.NoError(t, adm.MsgHandler(command("/protected")))
+	require.Len(t, mockAPI.SendCalls(), 1)
+	assert.Equal(t, "protected users: 2\n- 10, by admin:admin: partner\\_bot\n- 13, by config",
+		mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+
+	t.Run("invalid commands", func(t *testing.T) {
+		protected.ResetCalls()
+		require.Error(t, adm.MsgHandler(command("/protect")))
+		require.Error(t, adm.MsgHandler(command("/protect bad")))
+		require.Error(t, adm.MsgHandler(command("/unprotect")))
+		require.Error(t, adm.MsgHandler(command("/unprotect 10 more")))
+		assert.Empty(t, protected.AddCalls())
+		assert.Empty(t, protected.RemoveCalls())
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		adm := admin{tbAPI: mockAPI, adminChatID: 123}
+		require.NoError(t, adm.MsgHandler(command("/protect 10")))
+		require.NoError(t, adm.MsgHandler(command("/protected")))
+		assert.Empty(t, mockAPI.SendCalls())
+	})
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// PurgeResult is a result of purging messages of the user
+type PurgeResult struct {
+	Found   int // number of stored messages of the user
+	Deleted int // number of deleted messages, 0 in dry mode
+	Trained int // number of messages added to spam samples
+}
+
+// purgeRequest is a request to delete all stored messages of the user in the chat and optionally train them as spam
+type purgeRequest struct {
+	tbAPI      TbAPI
+	bot        Bot
+	locator    Locator
+	superUsers SuperUsers
+
+	chatID int64
+	userID int64
+	train  bool   // add texts of messages to spam samples
+	source string // source of added spam samples, i.e. admin:bob
+
+	dry bool
+}
+
+// purgeUserMessages deletes all messages of the user in the chat stored by locator within the history window,
+// i.e. earlier messages of confirmed spammer, not only the one triggered the detection. Failures to delete a message,
+// i.e. already deleted or too old for telegram, are logged and counted as not deleted. With train set, texts of
+// the messages are added to spam samples, known samples are not learned again. Nothing is changed in dry mode.
+func purgeUserMessages(r purgeRequest) (PurgeResult, error) {
+	messages, err := r.locator.ChatMessages(r.chatID, r.userID)
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to get messages of user %d: %w", r.userID, err)
+	}
+	res := PurgeResult{Found: len(messages)}
+	for _, m := range messages {
+		if m.UserName != "" && r.superUsers.IsSuper(m.UserName) {
+			return PurgeResult{}, fmt.Errorf("user %s (%d) is super-user, not purged", m.UserName, r.userID)
+		}
+	}
+	if r.dry {
+		log.Printf("[INFO] dry mode, %d messages of user %d in chat %d not purged", res.Found, r.userID, r.chatID)
+		return res, nil
+	}
+
+	for _, m := range messages {
+		if _, err := r.tbAPI.Request(tbapi.DeleteMessageConfig{ChatID: r.chatID, MessageID: m.MsgID}); err != nil {
+			log.Printf("[WARN] failed to delete message %d of user %d: %v", m.MsgID, r.userID, err)
+			continue
+		}
+		res.Deleted++
+	}
+	if r.train {
+		for _, m := range messages {
+			text := strings.ReplaceAll(m.Text, "\n", " ")
+			if strings.TrimSpace(text) == "" {
+				continue // stored before texts were kept
+			}
+			if err := r.bot.UpdateSpam(text, r.source); err != nil {
+				log.Printf("[WARN] failed to add message %d of user %d to spam samples: %v", m.MsgID, r.userID, err)
+				continue
+			}
+			res.Trained++
+		}
+	}
+	log.Printf("[INFO] purged %d of %d messages of user %d in chat %d, trained as spam: %d",
+		res.Deleted, res.Found, r.userID, r.chatID, res.Trained)
+	return res, nil
+}
+
+// PurgeUser deletes all stored messages of the user in the chat, i.e. earlier messages of confirmed spammer,
+// and adds them to spam samples with the source if train set. Chat 0 is the primary group. Nothing is deleted
+// in dry mode, and the number of found messages is returned.
+func (l *TelegramListener) PurgeUser(chatID, userID int64, train bool, source string) (PurgeResult, error) {
+	if chatID == 0 {
+		chatID = l.chatID
+	}
+	dry, _ := l.Modes()
+	return purgeUserMessages(purgeRequest{tbAPI: l.TbAPI, bot: l.Bot, locator: l.Locator, superUsers: l.SuperUsers,
+		chatID: chatID, userID: userID, train: train, source: source, dry: dry})
+}
+
+// purgeCommand purges messages of the user on "/purge <user id> [train]" command of super-user in admin chat,
+// and reports the result to admin chat
+func (a *admin) purgeCommand(msg *tbapi.Message) error {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 || len(args) > 2 || (len(args) == 2 && args[1] != "train") {
+		return fmt.Errorf("invalid purge command %q, expected /purge <user id> [train]", msg.Text)
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || userID == 0 {
+		return fmt.Errorf("invalid user id %q in purge command", args[0])
+	}
+	dry, _ := a.modes()
+	res, err := purgeUserMessages(purgeRequest{tbAPI: a.tbAPI, bot: a.bot, locator: a.locator, superUsers: a.superUsers,
+		chatID: a.primChatID, userID: userID, train: len(args) == 2, source: adminSource(msg.From), dry: dry})
+	if err != nil {
+		return fmt.Errorf("failed to purge messages of user %d: %w", userID, err)
+	}
+
+	text := fmt.Sprintf("purged %d of %d messages of user %d", res.Deleted, res.Found, userID)
+	if len(args) == 2 {
+		text += fmt.Sprintf(", trained as spam: %d", res.Trained)
+	}
+	if dry {
+		text = fmt.Sprintf("dry mode, found %d messages of user %d, not purged", res.Found, userID)
+	}
+	if err = send(tbapi.NewMessage(a.adminChatID, text), a.tbAPI); err != nil {
+		return fmt.Errorf("failed to send purge result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestAdmin_purgeCommand(t *testing.T) {
+	command := func(text string) tbapi.Update {
+		return tbapi.Update{Message: &tbapi.Message{Text: text, From: &tbapi.User{UserName: "admin"},
+			Entities: []tbapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(strings.Fields(text)[0])}}}}
+	}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+	require.NoError(t, locator.AddMessage("buy crypto", 456, 10, "spammer", 1))
+	require.NoError(t, locator.AddMessage("cheap crypto\nhere", 456, 10, "spammer", 2))
+	require.NoError(t, locator.AddMessage("other chat", 789, 10, "spammer", 3))
+	require.NoError(t, locator.AddMessage("hello", 456, 20, "super", 4))
+
+	mockAPI := &mocks.TbAPIMock{
+		SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil },
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) {
+			if c.(tbapi.DeleteMessageConfig).MessageID == 2 {
+				return nil, errors.New("message to delete not found")
+			}
+			return &tbapi.APIResponse{Ok: true}, nil
+		},
+	}
+	b := &mocks.BotMock{UpdateSpamFunc: func(msg, source string) error { return nil }}
+	dry := false
+	adm := admin{tbAPI: mockAPI, bot: b, locator: locator, superUsers: SuperUsers{"super"}, adminChatID: 123,
+		primChatID: 456, modes: func() (bool, bool) { return dry, false }}
+
+	t.Run("purge", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		require.NoError(t, adm.MsgHandler(command("/purge 10")))
+		require.Len(t, mockAPI.RequestCalls(), 2)
+		assert.Equal(t, tbapi.DeleteMessageConfig{ChatID: 456, MessageID: 1}, mockAPI.RequestCalls()[0].C)
+		assert.Equal(t, tbapi.DeleteMessageConfig{ChatID: 456, MessageID: 2}, mockAPI.RequestCalls()[1].C)
+		assert.Empty(t, b.UpdateSpamCalls())
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, int64(123), mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).ChatID)
+		assert.Equal(t, "purged 1 of 2 messages of user 10", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	})
+
+	t.Run("purge and train", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		require.NoError(t, adm.MsgHandler(command("/purge 10 train")))
+		assert.Len(t, mockAPI.RequestCalls(), 2)
+		require.Len(t, b.UpdateSpamCalls(), 2)
+		assert.Equal(t, "buy crypto", b.UpdateSpamCalls()[0].Msg)
+		assert.Equal(t, "cheap crypto here", b.UpdateSpamCalls()[1].Msg)
+		assert.Equal(t, "admin:admin", b.UpdateSpamCalls()[1].Source)
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, "purged 1 of 2 messages of user 10, trained as spam: 2",
+			mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	})
+
+	t.Run("dry mode", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		b.ResetCalls()
+		dry = true
+		defer func() { dry = false }()
+		require.NoError(t, adm.MsgHandler(command("/purge 10 train")))
+		assert.Empty(t, mockAPI.RequestCalls())
+		assert.Empty(t, b.UpdateSpamCalls())
+		require.Len(t, mockAPI.SendCalls(), 1)
+		assert.Equal(t, "dry mode, found 2 messages of user 10, not purged", mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text)
+	})
+
+	t.Run("super user", func(t *testing.T) {
+		mockAPI.ResetCalls()
+		err := adm.MsgHandler(command("/purge 20"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "user super (20) is super-user, not purged")
+		assert.Empty(t, mockAPI.RequestCalls())
+	})
+
+	t.Run("invalid command", func(t *testing.T) {
+		for _, cmd := range []string{"/purge", "/purge bob", "/purge 10 ham", "/purge 10 train now"} {
+			err := adm.MsgHandler(command(cmd))
+			assert.ErrorContains(t, err, "purge command", cmd)
+		}
+	})
+}
+
+func TestTelegramListener_PurgeUser(t *testing.T) {
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+	require.NoError(t, locator.AddMessage("buy crypto", 456, 10, "spammer", 1))
+	require.NoError(t, locator.AddMessage("other chat", 789, 10, "spammer", 2))
+
+	mockAPI := &mocks.TbAPIMock{
+		RequestFunc: func(c tbapi.Chattable) (*tbapi.APIResponse, error) { return &tbapi.APIResponse{Ok: true}, nil },
+	}
+	b := &mocks.BotMock{UpdateSpamFunc: func(msg, source string) error { return nil }}
+	l := TelegramListener{TbAPI: mockAPI, Bot: b, Locator: locator, chatID: 456}
+
+	res, err := l.PurgeUser(0, 10, true, "api:basic")
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{Found: 1, Deleted: 1, Trained: 1}, res)
+	require.Len(t, mockAPI.RequestCalls(), 1)
+	assert.Equal(t, tbapi.DeleteMessageConfig{ChatID: 456, MessageID: 1}, mockAPI.RequestCalls()[0].C)
+	require.Len(t, b.UpdateSpamCalls(), 1)
+	assert.Equal(t, "api:basic", b.UpdateSpamCalls()[0].Source)
+
+	res, err = l.PurgeUser(789, 10, false, "api:basic")
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{Found: 1, Deleted: 1}, res)
+	assert.Len(t, b.UpdateSpamCalls(), 1)
+
+	l.Dry = true
+	mockAPI.ResetCalls()
+	res, err = l.PurgeUser(0, 10, true, "api:basic")
+	require.NoError(t, err)
+	assert.Equal(t, PurgeResult{Found: 1}, res)
+	assert.Empty(t, mockAPI.RequestCalls())
+}
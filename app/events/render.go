@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// excerptLimit is the max number of characters of the message shown in admin reports, the rest is cut
+// and shown by the info button. Telegram limits messages to 4096 characters, with detection results.
+const excerptLimit = 1000
+
+// linkRe matches links and bare domains, i.e. "https://example.com/path" or "t.me/channel"
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://)?(?:[a-z0-9-]+\.)+[a-z]{2,}\b`)
+
+// continuedRe matches the mark of the cut excerpt, with the number of characters cut
+var continuedRe = regexp.MustCompile(`… \((\d+) more characters\)$`)
+
+// excerpt returns the message as a single line, safe to show in admin reports. Links are defanged to
+// "hxxps://example[.]com", so they are previewed but not clickable, and the message longer than excerptLimit
+// is cut with the number of characters left. The result is plain text, markdown has to be escaped by caller.
+func excerpt(text string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	runes := []rune(text)
+	more := ""
+	if len(runes) > excerptLimit {
+		more = fmt.Sprintf("… (%d more characters)", len(runes)-excerptLimit)
+		text = string(runes[:excerptLimit])
+	}
+	return defang(text) + more
+}
+
+// continuation returns the rest of the message cut by excerpt, with the same rendering, empty if not cut
+func continuation(text string) string {
+	runes := []rune(strings.ReplaceAll(text, "\n", " "))
+	if len(runes) <= excerptLimit {
+		return ""
+	}
+	return excerpt(string(runes[excerptLimit:]))
+}
+
+// defang makes links and domains of the text not clickable, Telegram detects links with dots in hosts only
+func defang(text string) string {
+	return linkRe.ReplaceAllStringFunc(text, func(link string) string {
+		if strings.HasPrefix(strings.ToLower(link), "http") {
+			link = "hxxp" + link[4:]
+		}
+		return strings.ReplaceAll(link, ".", "[.]")
+	})
+}
+
+// isExcerpt returns true if the text shown in the report differs from the original message, i.e. cut or defanged
+func isExcerpt(text string) bool {
+	return continuedRe.MatchString(text) || strings.Contains(text, "[.]")
+}
+
+// originalMessage returns the original message of the user for the excerpt shown in the report, from the locator.
+// The excerpt is returned as is if it is the original message, or the original is not found.
+func (a *admin) originalMessage(userID int64, text string) string {
+	if !isExcerpt(text) || a.locator == nil {
+		return text
+	}
+	messages, err := a.locator.ChatMessages(a.primChatID, userID)
+	if err != nil {
+		log.Printf("[WARN] failed to get messages of user %d, %v", userID, err)
+		return text
+	}
+	for i := len(messages) - 1; i >= 0; i-- { // the latest first
+		if messages[i].Text != "" && strings.TrimSpace(excerpt(messages[i].Text)) == text {
+			return messages[i].Text
+		}
+	}
+	return text
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/events/mocks"
+)
+
+func TestExcerpt(t *testing.T) {
+	tbl := []struct {
+		name, text, res string
+	}{
+		{"plain", "hello world", "hello world"},
+		{"multiline", "hello\nworld", "hello world"},
+		{"link", "join https://Example.com/path?x=1 now", "join hxxps://Example[.]com/path?x=1 now"},
+		{"bare domain", "see t.me/promo and promo.example.org", "see t[.]me/promo and promo[.]example[.]org"},
+		{"markdown kept as is", "*bold* [link](http://a.io)", "*bold* [link](hxxp://a[.]io)"},
+		{"not a domain", "i.e. 3.14 e.g", "i.e. 3.14 e.g"},
+		{"long", strings.Repeat("a", excerptLimit+5), strings.Repeat("a", excerptLimit) + "… (5 more characters)"},
+		{"long unicode", strings.Repeat("я", excerptLimit+1), strings.Repeat("я", excerptLimit) + "… (1 more characters)"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.res, excerpt(tt.text))
+		})
+	}
+
+	assert.Equal(t, "", continuation("short"))
+	assert.Equal(t, "b t[.]me/x", continuation(strings.Repeat("a", excerptLimit)+"b\nt.me/x"))
+	assert.False(t, isExcerpt("hello world"))
+	assert.True(t, isExcerpt("see t[.]me/promo"))
+	assert.True(t, isExcerpt(excerpt(strings.Repeat("a", excerptLimit+5))))
+}
+
+func TestAdmin_originalMessage(t *testing.T) {
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+	long := strings.Repeat("buy crypto ", 100) + "now"
+	require.NoError(t, locator.AddMessage("join t.me/promo", 100, 1, "user", 1))
+	require.NoError(t, locator.AddMessage(long, 100, 1, "user", 2))
+	require.NoError(t, locator.AddMessage("hello", 100, 1, "user", 3))
+
+	adm := admin{locator: locator, primChatID: 100}
+	assert.Equal(t, "join t.me/promo", adm.originalMessage(1, "join t[.]me/promo"))
+	assert.Equal(t, long, adm.originalMessage(1, strings.TrimSpace(excerpt(long))))
+	assert.Equal(t, "hello", adm.originalMessage(1, "hello"), "not an excerpt")
+	assert.Equal(t, "join t[.]me/other", adm.originalMessage(1, "join t[.]me/other"), "not found")
+	assert.Equal(t, "join t[.]me/promo", adm.originalMessage(2, "join t[.]me/promo"), "other user")
+}
+
+func TestAdmin_reportBanExcerpt(t *testing.T) {
+	mockAPI := &mocks.TbAPIMock{SendFunc: func(c tbapi.Chattable) (tbapi.Message, error) { return tbapi.Message{}, nil }}
+	b := &mocks.BotMock{UpdateSpamFunc: func(msg, source string) error { return nil }}
+	locator, teardown := prepTestLocator(t)
+	defer teardown()
+	text := "*free* money at https://promo.com/_x " + strings.Repeat("a", excerptLimit)
+	require.NoError(t, locator.AddMessage(text, 100, 456, "spammer", 1))
+	adm := admin{tbAPI: mockAPI, bot: b, locator: locator, adminChatID: 123, primChatID: 100,
+		modes: func() (dry, training bool) { return false, false }}
+
+	adm.ReportBan("spam_user", &bot.Message{From: bot.User{ID: 456}, Text: text}, "", false)
+	require.Len(t, mockAPI.SendCalls(), 1)
+	sent := mockAPI.SendCalls()[0].C.(tbapi.MessageConfig).Text
+	assert.True(t, strings.HasPrefix(sent, "**permanently banned [spam\\_user](tg://user?id=456)**\n\n"+
+		"\\*free\\* money at hxxps://promo\\[.]com/\\_x aaa"), sent)
+	assert.True(t, strings.HasSuffix(sent, "aaa… (37 more characters)\n\n"), sent)
+
+	// the report as shown in telegram, markdown parsed
+	shown := "permanently banned spam_user\n\n" + excerpt(text)
+	query := &tbapi.CallbackQuery{Data: "+456", From: &tbapi.User{UserName: "admin"},
+		Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: shown}}
+	require.NoError(t, adm.callbackBanConfirmed(query))
+	require.Len(t, b.UpdateSpamCalls(), 1)
+	assert.Equal(t, text, b.UpdateSpamCalls()[0].Msg, "original message learned")
+
+	query.Data = "!456"
+	require.NoError(t, adm.callbackShowInfo(query))
+	edit := mockAPI.SendCalls()[len(mockAPI.SendCalls())-1].C.(tbapi.EditMessageTextConfig)
+	assert.True(t, strings.HasSuffix(edit.Text, "**message continued**\n"+strings.Repeat("a", 37)), edit.Text)
+}
@@ -0,0 +1,185 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/umputun/tg-spam/app/grpcapi/pb"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// actorKey is a context key of the actor, i.e. the credential the call authenticated with
+type actorKey struct{}
+
+// actorFrom returns the actor of the call, "basic", "key:<name>" or "jwt:<subject>",
+// and "anonymous" if auth is disabled
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "anonymous"
+}
+
+// unaryAuth authenticates unary calls, see authenticate
+func (s *Server) unaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, done, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+// streamAuth authenticates streaming calls once, on start of the stream, see authenticate
+func (s *Server) streamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, done, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	err = handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	done(err)
+	return err
+}
+
+// authStream is a server stream with the context of the authenticated actor
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context with the actor
+func (s *authStream) Context() context.Context { return s.ctx }
+
+// authenticate authenticates the call the same way as webapi does: with basic auth password, giving full access,
+// or with api key or jwt, limited by their scope. Credentials are passed in "authorization" metadata, as
+// "Basic <credentials>" or "Bearer <token>", or api key in "x-api-key" metadata. Calls are not authenticated at all
+// if none of the methods is enabled. Returns the context with the actor, and the function to call with the result of
+// the call, recording usage of api keys.
+func (s *Server) authenticate(ctx context.Context, method string) (context.Context, func(error), error) {
+	noop := func(error) {}
+	if s.AuthPasswd == "" && s.APIKeys == nil && s.JWT == nil {
+		return context.WithValue(ctx, actorKey{}, "anonymous"), noop, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := firstValue(md, "authorization")
+	if creds, ok := strings.CutPrefix(authorization, "Basic "); ok && s.AuthPasswd != "" {
+		if !s.validPasswd(creds) {
+			return ctx, noop, status.Error(codes.PermissionDenied, "invalid credentials")
+		}
+		return context.WithValue(ctx, actorKey{}, "basic"), noop, nil
+	}
+
+	token := firstValue(md, "x-api-key")
+	if bearer, ok := strings.CutPrefix(authorization, "Bearer "); ok && token == "" {
+		token = strings.TrimSpace(bearer)
+	}
+	switch {
+	case token != "" && s.APIKeys != nil && strings.Count(token, ".") != 2: // keys never have dots, tokens have two
+		return s.authAPIKey(ctx, method, token)
+	case token != "" && s.JWT != nil:
+		return s.authJWT(ctx, method, token)
+	}
+	return ctx, noop, status.Error(codes.Unauthenticated, "no credentials")
+}
+
+// authAPIKey authenticates the call with api key, and returns the function recording usage of the key
+func (s *Server) authAPIKey(ctx context.Context, method, token string) (context.Context, func(error), error) {
+	noop := func(error) {}
+	key, err := s.APIKeys.Find(token)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[WARN] can't check api key, %v", err)
+		}
+		return ctx, noop, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	used := func(err error) {
+		if uErr := s.APIKeys.Used(key.ID, "GRPC", method, httpStatus(err)); uErr != nil {
+			log.Printf("[WARN] can't record usage of api key %q, %v", key.Name, uErr)
+		}
+	}
+	if !allowedScope(key.Scope, method) {
+		err := status.Errorf(codes.PermissionDenied, "not allowed for api key scope %q", key.Scope)
+		used(err)
+		return ctx, noop, err
+	}
+	return context.WithValue(ctx, actorKey{}, "key:"+key.Name), used, nil
+}
+
+// authJWT authenticates the call with jwt issued by external identity provider
+func (s *Server) authJWT(ctx context.Context, method, token string) (context.Context, func(error), error) {
+	noop := func(error) {}
+	claims, err := s.JWT.Validate(ctx, token)
+	if err != nil {
+		log.Printf("[INFO] jwt rejected for %s, %v", method, err)
+		return ctx, noop, status.Errorf(codes.Unauthenticated, "invalid token, %v", err)
+	}
+	scope, err := claims.APIScope()
+	if err != nil || !allowedScope(scope, method) {
+		log.Printf("[INFO] jwt of %q not allowed for %s, scope %q", claims.Subject, method, claims.Scope)
+		return ctx, noop, status.Errorf(codes.PermissionDenied, "not allowed for token scope %q", claims.Scope)
+	}
+	log.Printf("[DEBUG] jwt of %q accepted for %s", claims.Subject, method)
+	return context.WithValue(ctx, actorKey{}, "jwt:"+claims.Subject), noop, nil
+}
+
+// validPasswd returns true if base64 encoded credentials are user "tg-spam" with the basic auth password
+func (s *Server) validPasswd(creds string) bool {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(creds))
+	if err != nil {
+		return false
+	}
+	user, passwd, ok := strings.Cut(string(data), ":")
+	return ok && subtle.ConstantTimeCompare([]byte(user), []byte("tg-spam")) == 1 &&
+		subtle.ConstantTimeCompare([]byte(passwd), []byte(s.AuthPasswd)) == 1
+}
+
+// allowedScope returns true if the scope allows the method, the same as for webapi. Check scope allows spam checks
+// only, denylist scope allows none of the methods.
+func allowedScope(scope storage.APIKeyScope, method string) bool {
+	switch scope {
+	case storage.APIKeyScopeManage:
+		return true
+	case storage.APIKeyScopeCheck:
+		return method == pb.CheckService_Check_FullMethodName || method == pb.CheckService_CheckStream_FullMethodName
+	}
+	return false
+}
+
+// firstValue returns the first value of the metadata key, empty if not set
+func firstValue(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// httpStatus returns http status of the grpc call result, recorded to usage audit of api keys the same as for webapi
+func httpStatus(err error) int {
+	switch status.Code(err) {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Canceled:
+		return 499 // client closed request
+	default:
+		return http.StatusInternalServerError
+	}
+}
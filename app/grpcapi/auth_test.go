@@ -0,0 +1,123 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/umputun/tg-spam/app/grpcapi/mocks"
+	"github.com/umputun/tg-spam/app/grpcapi/pb"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi"
+)
+
+func TestServer_authenticate(t *testing.T) {
+	keys := &mocks.APIKeysStoreMock{
+		FindFunc: func(key string) (storage.APIKey, error) {
+			switch key {
+			case "check-key":
+				return storage.APIKey{ID: 1, Name: "ci", Scope: storage.APIKeyScopeCheck}, nil
+			case "manage-key":
+				return storage.APIKey{ID: 2, Name: "admin", Scope: storage.APIKeyScopeManage}, nil
+			}
+			return storage.APIKey{}, sql.ErrNoRows
+		},
+		UsedFunc: func(id int64, method, path string, status int) error { return nil },
+	}
+	s := NewServer(Config{AuthPasswd: "secret", APIKeys: keys, JWT: &webapi.JWT{Secret: "jwt-secret"}})
+	basic := func(user, passwd string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+passwd))
+	}
+
+	tbl := []struct {
+		name   string
+		md     metadata.MD
+		method string
+		actor  string
+		code   codes.Code
+	}{
+		{name: "no credentials", md: metadata.MD{}, method: pb.CheckService_Check_FullMethodName, code: codes.Unauthenticated},
+		{name: "basic", md: metadata.Pairs("authorization", basic("tg-spam", "secret")),
+			method: pb.CheckService_UpdateSpam_FullMethodName, actor: "basic"},
+		{name: "wrong password", md: metadata.Pairs("authorization", basic("tg-spam", "bad")),
+			method: pb.CheckService_Check_FullMethodName, code: codes.PermissionDenied},
+		{name: "check key", md: metadata.Pairs("x-api-key", "check-key"), method: pb.CheckService_CheckStream_FullMethodName,
+			actor: "key:ci"},
+		{name: "check key bearer", md: metadata.Pairs("authorization", "Bearer check-key"),
+			method: pb.CheckService_Check_FullMethodName, actor: "key:ci"},
+		{name: "check key update", md: metadata.Pairs("x-api-key", "check-key"), method: pb.CheckService_UpdateHam_FullMethodName,
+			code: codes.PermissionDenied},
+		{name: "manage key update", md: metadata.Pairs("x-api-key", "manage-key"),
+			method: pb.CheckService_UpdateHam_FullMethodName, actor: "key:admin"},
+		{name: "unknown key", md: metadata.Pairs("x-api-key", "bad-key"), method: pb.CheckService_Check_FullMethodName,
+			code: codes.Unauthenticated},
+		{name: "check jwt", md: metadata.Pairs("authorization", "Bearer "+testToken(t, "jwt-secret", "svc", "tg-spam:check")),
+			method: pb.CheckService_Check_FullMethodName, actor: "jwt:svc"},
+		{name: "check jwt update", md: metadata.Pairs("authorization", "Bearer "+testToken(t, "jwt-secret", "svc", "tg-spam:check")),
+			method: pb.CheckService_UpdateSpam_FullMethodName, code: codes.PermissionDenied},
+		{name: "invalid jwt", md: metadata.Pairs("authorization", "Bearer "+testToken(t, "other", "svc", "tg-spam:manage")),
+			method: pb.CheckService_Check_FullMethodName, code: codes.Unauthenticated},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			ctx, done, err := s.authenticate(ctx, tt.method)
+			if tt.code != codes.OK {
+				require.Error(t, err)
+				assert.Equal(t, tt.code, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.actor, actorFrom(ctx))
+			done(nil)
+		})
+	}
+
+	// usage of keys is recorded, including calls not allowed by the scope
+	calls := keys.UsedCalls()
+	require.Len(t, calls, 4)
+	assert.Equal(t, int64(1), calls[0].ID)
+	assert.Equal(t, "GRPC", calls[0].Method)
+	assert.Equal(t, pb.CheckService_CheckStream_FullMethodName, calls[0].Path)
+	assert.Equal(t, http.StatusOK, calls[0].Status)
+	assert.Equal(t, http.StatusForbidden, calls[2].Status)
+	assert.Equal(t, int64(2), calls[3].ID)
+}
+
+func TestServer_authenticateDisabled(t *testing.T) {
+	s := NewServer(Config{})
+	ctx, done, err := s.authenticate(context.Background(), pb.CheckService_UpdateSpam_FullMethodName)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous", actorFrom(ctx))
+	done(nil)
+}
+
+func Test_httpStatus(t *testing.T) {
+	assert.Equal(t, http.StatusOK, httpStatus(nil))
+	assert.Equal(t, http.StatusBadRequest, httpStatus(status.Error(codes.InvalidArgument, "bad")))
+	assert.Equal(t, http.StatusForbidden, httpStatus(status.Error(codes.PermissionDenied, "denied")))
+	assert.Equal(t, http.StatusInternalServerError, httpStatus(status.Error(codes.Internal, "failed")))
+}
+
+// testToken makes HS256 jwt of the subject with the scope, valid for an hour
+func testToken(t *testing.T, secret, subject, scope string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{"sub": subject, "scope": scope, "exp": time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
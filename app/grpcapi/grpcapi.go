@@ -0,0 +1,172 @@
+// Package grpcapi implements grpc service of spam checks and training, defined in proto/tgspam/v1/check.proto.
+// It mirrors POST /check and POST /update/{spam,ham} of webapi for internal integrations where json over http adds
+// too much overhead, with the same detector and the same auth: api keys, jwt and basic auth password.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"github.com/umputun/tg-spam/app/grpcapi/pb"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi"
+	"github.com/umputun/tg-spam/lib"
+)
+
+//go:generate moq --out mocks/detector.go --pkg mocks --with-resets --skip-ensure . Detector
+//go:generate moq --out mocks/api_keys_store.go --pkg mocks --with-resets --skip-ensure . APIKeysStore
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/umputun/tg-spam --go-grpc_out=../.. --go-grpc_opt=module=github.com/umputun/tg-spam tgspam/v1/check.proto
+
+// defaultShutdownWait is the max time to wait for in-flight calls on shutdown, if not set
+const defaultShutdownWait = 5 * time.Second
+
+// Detector checks messages for spam and updates samples, implemented by lib.Detector
+type Detector interface {
+	Check(msg string, userID string) (spam bool, cr []lib.CheckResult)
+	CheckLocal(msg string, userID string) (spam bool, cr []lib.CheckResult)
+	UpdateSpamFrom(msg, source string) error
+	UpdateHamFrom(msg, source string) error
+}
+
+// APIKeysStore finds api keys and records their usage, implemented by storage.APIKeys
+type APIKeysStore interface {
+	Find(key string) (storage.APIKey, error)
+	Used(id int64, method, path string, status int) error
+}
+
+// Config defines grpc server parameters
+type Config struct {
+	ListenAddr   string        // listen address
+	CertFile     string        // optional tls certificate file, with the full chain, plain grpc if not set
+	KeyFile      string        // optional tls private key file
+	Detector     Detector      // spam detector, shared with webapi
+	AuthPasswd   string        // basic auth password for user "tg-spam", empty disables basic auth
+	APIKeys      APIKeysStore  // optional api keys, nil disables auth with keys
+	JWT          *webapi.JWT   // optional jwt auth with tokens of external issuer, nil disables it
+	ShutdownWait time.Duration // max time to wait for in-flight calls on shutdown, 5s if not set
+}
+
+// Server is grpc server of check service
+type Server struct {
+	pb.UnimplementedCheckServiceServer
+	Config
+}
+
+// NewServer makes grpc server with the config
+func NewServer(config Config) *Server {
+	return &Server{Config: config}
+}
+
+// Run serves calls till the context is canceled, and waits for in-flight calls on shutdown, up to ShutdownWait
+func (s *Server) Run(ctx context.Context) error {
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(s.unaryAuth), grpc.ChainStreamInterceptor(s.streamAuth)}
+	if s.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(s.CertFile, s.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load tls certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterCheckServiceServer(srv, s)
+
+	lis, err := net.Listen("tcp", s.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.ListenAddr, err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		wait := s.ShutdownWait
+		if wait == 0 {
+			wait = defaultShutdownWait
+		}
+		done := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+			log.Printf("[INFO] grpc server on %s stopped", s.ListenAddr)
+		case <-time.After(wait):
+			srv.Stop() // in-flight calls, i.e. long streams, are canceled
+			log.Printf("[WARN] grpc server on %s stopped, in-flight calls canceled", s.ListenAddr)
+		}
+	}()
+
+	log.Printf("[INFO] start grpc server on %s, tls: %v", s.ListenAddr, s.CertFile != "")
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("failed to run grpc server on %s: %w", s.ListenAddr, err)
+	}
+	<-stopped
+	return nil
+}
+
+// Check checks a message for spam, as POST /check of webapi
+func (s *Server) Check(_ context.Context, req *pb.CheckRequest) (*pb.CheckResponse, error) {
+	return s.check(req), nil
+}
+
+// CheckStream checks a stream of messages, responses are sent in the order of requests
+func (s *Server) CheckStream(stream pb.CheckService_CheckStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s.check(req)); err != nil {
+			return err
+		}
+	}
+}
+
+// UpdateSpam adds a spam sample, as POST /update/spam of webapi
+func (s *Server) UpdateSpam(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	return s.update(ctx, req, s.Detector.UpdateSpamFrom)
+}
+
+// UpdateHam adds a ham sample, as POST /update/ham of webapi
+func (s *Server) UpdateHam(ctx context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	return s.update(ctx, req, s.Detector.UpdateHamFrom)
+}
+
+// check checks the message with all checks, or with local ones only if skip_network set
+func (s *Server) check(req *pb.CheckRequest) *pb.CheckResponse {
+	checkFn := s.Detector.Check
+	if req.GetSkipNetwork() {
+		checkFn = s.Detector.CheckLocal
+	}
+	spam, cr := checkFn(req.GetMsg(), req.GetUserId())
+	resp := &pb.CheckResponse{Spam: spam, Checks: make([]*pb.CheckResult, 0, len(cr))}
+	for _, r := range cr {
+		resp.Checks = append(resp.Checks, &pb.CheckResult{Name: r.Name, Spam: r.Spam, Details: r.Details})
+	}
+	return resp
+}
+
+// update adds the sample with the update function, the source is "api:<actor>", the same as of webapi
+func (s *Server) update(ctx context.Context, req *pb.UpdateRequest, updFn func(msg, source string) error) (*pb.UpdateResponse, error) {
+	if req.GetMsg() == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty message")
+	}
+	if err := updFn(req.GetMsg(), "api:"+actorFrom(ctx)); err != nil {
+		return nil, status.Errorf(codes.Internal, "can't update samples, %v", err)
+	}
+	return &pb.UpdateResponse{Updated: true}, nil
+}
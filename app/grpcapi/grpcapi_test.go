@@ -0,0 +1,235 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/umputun/tg-spam/app/grpcapi/mocks"
+	"github.com/umputun/tg-spam/app/grpcapi/pb"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	detector := &mocks.DetectorMock{
+		CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+			return msg == "spam", []lib.CheckResult{{Name: "similarity", Spam: msg == "spam", Details: "checked " + userID}}
+		},
+		CheckLocalFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+			return false, []lib.CheckResult{{Name: "local", Details: "local " + userID}}
+		},
+		UpdateSpamFromFunc: func(msg, source string) error { return nil },
+		UpdateHamFromFunc: func(msg, source string) error {
+			return errors.New("failed")
+		},
+	}
+	srv := NewServer(Config{ListenAddr: "127.0.0.1:9891", Detector: detector})
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, srv.Run(ctx))
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := grpc.Dial("127.0.0.1:9891", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewCheckServiceClient(conn)
+
+	t.Run("check", func(t *testing.T) {
+		resp, err := client.Check(ctx, &pb.CheckRequest{Msg: "spam", UserId: "123"})
+		require.NoError(t, err)
+		assert.True(t, resp.Spam)
+		require.Len(t, resp.Checks, 1)
+		assert.Equal(t, "similarity", resp.Checks[0].Name)
+		assert.True(t, resp.Checks[0].Spam)
+		assert.Equal(t, "checked 123", resp.Checks[0].Details)
+
+		resp, err = client.Check(ctx, &pb.CheckRequest{Msg: "spam", UserId: "123", SkipNetwork: true})
+		require.NoError(t, err)
+		assert.False(t, resp.Spam)
+		assert.Equal(t, "local", resp.Checks[0].Name, "local checks only")
+	})
+
+	t.Run("check stream", func(t *testing.T) {
+		stream, err := client.CheckStream(ctx)
+		require.NoError(t, err)
+		for _, msg := range []string{"ham", "spam", "ham"} {
+			require.NoError(t, stream.Send(&pb.CheckRequest{Msg: msg, UserId: "1"}))
+		}
+		require.NoError(t, stream.CloseSend())
+		var res []bool
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			res = append(res, resp.Spam)
+		}
+		assert.Equal(t, []bool{false, true, false}, res, "in the order of requests")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		resp, err := client.UpdateSpam(ctx, &pb.UpdateRequest{Msg: "buy now"})
+		require.NoError(t, err)
+		assert.True(t, resp.Updated)
+		require.Len(t, detector.UpdateSpamFromCalls(), 1)
+		assert.Equal(t, "buy now", detector.UpdateSpamFromCalls()[0].Msg)
+		assert.Equal(t, "api:anonymous", detector.UpdateSpamFromCalls()[0].Source)
+
+		_, err = client.UpdateSpam(ctx, &pb.UpdateRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = client.UpdateHam(ctx, &pb.UpdateRequest{Msg: "hello"})
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+
+	cancel()
+	<-done
+}
+
+func TestServer_RunAuth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	detector := &mocks.DetectorMock{
+		CheckFunc:          func(msg string, userID string) (bool, []lib.CheckResult) { return true, nil },
+		UpdateSpamFromFunc: func(msg, source string) error { return nil },
+	}
+	srv := NewServer(Config{ListenAddr: "127.0.0.1:9894", Detector: detector, AuthPasswd: "secret"})
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, srv.Run(ctx))
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := grpc.Dial("127.0.0.1:9894", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewCheckServiceClient(conn)
+
+	_, err = client.Check(ctx, &pb.CheckRequest{Msg: "spam"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	stream, err := client.CheckStream(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "stream rejected")
+
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization",
+		"Basic "+base64.StdEncoding.EncodeToString([]byte("tg-spam:secret")))
+	resp, err := client.Check(authCtx, &pb.CheckRequest{Msg: "spam"})
+	require.NoError(t, err)
+	assert.True(t, resp.Spam)
+
+	stream, err = client.CheckStream(authCtx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.CheckRequest{Msg: "spam"}))
+	streamResp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.True(t, streamResp.Spam)
+	require.NoError(t, stream.CloseSend())
+
+	_, err = client.UpdateSpam(authCtx, &pb.UpdateRequest{Msg: "buy now"})
+	require.NoError(t, err)
+	assert.Equal(t, "api:basic", detector.UpdateSpamFromCalls()[0].Source)
+
+	cancel()
+	<-done
+}
+
+func TestServer_RunTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := writeTestCert(t, certFile, keyFile)
+
+	detector := &mocks.DetectorMock{CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+		return true, nil
+	}}
+	srv := NewServer(Config{ListenAddr: "127.0.0.1:9892", CertFile: certFile, KeyFile: keyFile, Detector: detector})
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, srv.Run(ctx))
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certPEM))
+	creds := credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "localhost", MinVersion: tls.VersionTLS12})
+	conn, err := grpc.Dial("127.0.0.1:9892", grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := pb.NewCheckServiceClient(conn).Check(ctx, &pb.CheckRequest{Msg: "spam"})
+	require.NoError(t, err)
+	assert.True(t, resp.Spam)
+
+	cancel()
+	<-done
+}
+
+func TestServer_RunFailed(t *testing.T) {
+	srv := NewServer(Config{ListenAddr: "127.0.0.1:9893", CertFile: "/no/such/cert.pem", KeyFile: "/no/such/key.pem"})
+	err := srv.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load tls certificate")
+
+	srv = NewServer(Config{ListenAddr: "bad-address"})
+	err = srv.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to listen on bad-address")
+}
+
+// writeTestCert writes self-signed certificate for localhost, returns certificate pem
+func writeTestCert(t *testing.T, certFile, keyFile string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPEM
+}
@@ -0,0 +1,271 @@
+// Check service mirrors the check and training operations of webapi, for internal integrations
+// where json over http adds too much overhead. It is served by app/grpcapi on --server.grpc.listen.
+// Auth is the same as of webapi: api key or jwt passed in "authorization" metadata as "Bearer <token>",
+// or api key in "x-api-key" metadata, limited by the scope of the key or token, or basic auth password
+// passed as "Basic <credentials>" with full access.
+//
+// Go code is generated with protoc-gen-go and protoc-gen-go-grpc into app/grpcapi/pb, see go:generate in app/grpcapi.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: tgspam/v1/check.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CheckService_Check_FullMethodName       = "/tgspam.v1.CheckService/Check"
+	CheckService_CheckStream_FullMethodName = "/tgspam.v1.CheckService/CheckStream"
+	CheckService_UpdateSpam_FullMethodName  = "/tgspam.v1.CheckService/UpdateSpam"
+	CheckService_UpdateHam_FullMethodName   = "/tgspam.v1.CheckService/UpdateHam"
+)
+
+// CheckServiceClient is the client API for CheckService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CheckServiceClient interface {
+	// Check checks a message for spam, as POST /check. Requires check scope.
+	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	// CheckStream checks a stream of messages, responses are sent in the order of requests.
+	// Requires check scope.
+	CheckStream(ctx context.Context, opts ...grpc.CallOption) (CheckService_CheckStreamClient, error)
+	// UpdateSpam adds a spam sample, as POST /update/spam. Requires manage scope.
+	UpdateSpam(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+	// UpdateHam adds a ham sample, as POST /update/ham. Requires manage scope.
+	UpdateHam(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+}
+
+type checkServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCheckServiceClient(cc grpc.ClientConnInterface) CheckServiceClient {
+	return &checkServiceClient{cc}
+}
+
+func (c *checkServiceClient) Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error) {
+	out := new(CheckResponse)
+	err := c.cc.Invoke(ctx, CheckService_Check_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *checkServiceClient) CheckStream(ctx context.Context, opts ...grpc.CallOption) (CheckService_CheckStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &CheckService_ServiceDesc.Streams[0], CheckService_CheckStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &checkServiceCheckStreamClient{stream}
+	return x, nil
+}
+
+type CheckService_CheckStreamClient interface {
+	Send(*CheckRequest) error
+	Recv() (*CheckResponse, error)
+	grpc.ClientStream
+}
+
+type checkServiceCheckStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *checkServiceCheckStreamClient) Send(m *CheckRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *checkServiceCheckStreamClient) Recv() (*CheckResponse, error) {
+	m := new(CheckResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *checkServiceClient) UpdateSpam(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	out := new(UpdateResponse)
+	err := c.cc.Invoke(ctx, CheckService_UpdateSpam_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *checkServiceClient) UpdateHam(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	out := new(UpdateResponse)
+	err := c.cc.Invoke(ctx, CheckService_UpdateHam_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CheckServiceServer is the server API for CheckService service.
+// All implementations must embed UnimplementedCheckServiceServer
+// for forward compatibility
+type CheckServiceServer interface {
+	// Check checks a message for spam, as POST /check. Requires check scope.
+	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	// CheckStream checks a stream of messages, responses are sent in the order of requests.
+	// Requires check scope.
+	CheckStream(CheckService_CheckStreamServer) error
+	// UpdateSpam adds a spam sample, as POST /update/spam. Requires manage scope.
+	UpdateSpam(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	// UpdateHam adds a ham sample, as POST /update/ham. Requires manage scope.
+	UpdateHam(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	mustEmbedUnimplementedCheckServiceServer()
+}
+
+// UnimplementedCheckServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCheckServiceServer struct {
+}
+
+func (UnimplementedCheckServiceServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Check not implemented")
+}
+func (UnimplementedCheckServiceServer) CheckStream(CheckService_CheckStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method CheckStream not implemented")
+}
+func (UnimplementedCheckServiceServer) UpdateSpam(context.Context, *UpdateRequest) (*UpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateSpam not implemented")
+}
+func (UnimplementedCheckServiceServer) UpdateHam(context.Context, *UpdateRequest) (*UpdateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateHam not implemented")
+}
+func (UnimplementedCheckServiceServer) mustEmbedUnimplementedCheckServiceServer() {}
+
+// UnsafeCheckServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CheckServiceServer will
+// result in compilation errors.
+type UnsafeCheckServiceServer interface {
+	mustEmbedUnimplementedCheckServiceServer()
+}
+
+func RegisterCheckServiceServer(s grpc.ServiceRegistrar, srv CheckServiceServer) {
+	s.RegisterService(&CheckService_ServiceDesc, srv)
+}
+
+func _CheckService_Check_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckServiceServer).Check(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CheckService_Check_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckServiceServer).Check(ctx, req.(*CheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CheckService_CheckStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CheckServiceServer).CheckStream(&checkServiceCheckStreamServer{stream})
+}
+
+type CheckService_CheckStreamServer interface {
+	Send(*CheckResponse) error
+	Recv() (*CheckRequest, error)
+	grpc.ServerStream
+}
+
+type checkServiceCheckStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *checkServiceCheckStreamServer) Send(m *CheckResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *checkServiceCheckStreamServer) Recv() (*CheckRequest, error) {
+	m := new(CheckRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _CheckService_UpdateSpam_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckServiceServer).UpdateSpam(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CheckService_UpdateSpam_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckServiceServer).UpdateSpam(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CheckService_UpdateHam_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CheckServiceServer).UpdateHam(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CheckService_UpdateHam_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CheckServiceServer).UpdateHam(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CheckService_ServiceDesc is the grpc.ServiceDesc for CheckService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CheckService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tgspam.v1.CheckService",
+	HandlerType: (*CheckServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Check",
+			Handler:    _CheckService_Check_Handler,
+		},
+		{
+			MethodName: "UpdateSpam",
+			Handler:    _CheckService_UpdateSpam_Handler,
+		},
+		{
+			MethodName: "UpdateHam",
+			Handler:    _CheckService_UpdateHam_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CheckStream",
+			Handler:       _CheckService_CheckStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "tgspam/v1/check.proto",
+}
@@ -0,0 +1,161 @@
+// Package importer converts history of a chat exported by Telegram Desktop (JSON format) to spam and ham samples.
+// Messages of known spammers become spam samples, and messages of established users become ham samples.
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// Importer reads Telegram Desktop export and appends samples with spam and ham updaters
+type Importer struct {
+	SpamUsers       []int64 // ids of users whose messages are spam, i.e. banned spammers
+	MinMsgLen       int     // shorter messages are skipped
+	MinUserMessages int     // messages of users with fewer messages in the export are not used as ham, they are not known-good yet
+}
+
+// Report is a summary of the import
+type Report struct {
+	Messages int            `json:"messages"` // total number of messages in the export, including service ones
+	Users    int            `json:"users"`    // number of users with messages
+	Ham      int            `json:"ham"`      // number of imported ham samples
+	Spam     int            `json:"spam"`     // number of imported spam samples
+	Skipped  map[string]int `json:"skipped"`  // number of skipped messages by reason
+}
+
+// skip reasons
+const (
+	skipService   = "service"
+	skipEmpty     = "empty"
+	skipNotUser   = "not_user"
+	skipShort     = "short"
+	skipNewUser   = "new_user"
+	skipDuplicate = "duplicate"
+)
+
+// export is a part of Telegram Desktop export we need
+type export struct {
+	Messages []exportMessage `json:"messages"`
+}
+
+type exportMessage struct {
+	Type   string     `json:"type"`
+	FromID string     `json:"from_id"`
+	Text   exportText `json:"text"`
+}
+
+// exportText is a text of the message, which is either a plain string or a list of plain strings and text entities
+type exportText string
+
+// UnmarshalJSON joins all parts of the text
+func (t *exportText) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*t = exportText(plain)
+		return nil
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("unexpected text format: %w", err)
+	}
+	var sb strings.Builder
+	for _, p := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(p, &plain); err == nil {
+			sb.WriteString(plain)
+			continue
+		}
+		if err := json.Unmarshal(p, &entity); err != nil {
+			return fmt.Errorf("unexpected text entity: %w", err)
+		}
+		sb.WriteString(entity.Text)
+	}
+	*t = exportText(sb.String())
+	return nil
+}
+
+// Import reads the export and appends spam and ham samples
+func (im *Importer) Import(r io.Reader, spamUpd, hamUpd lib.SampleUpdater) (Report, error) {
+	var exp export
+	if err := json.NewDecoder(r).Decode(&exp); err != nil {
+		return Report{}, fmt.Errorf("failed to decode export: %w", err)
+	}
+
+	report := Report{Messages: len(exp.Messages), Skipped: map[string]int{}}
+	spammers := map[int64]bool{}
+	for _, id := range im.SpamUsers {
+		spammers[id] = true
+	}
+
+	// count messages of each user first, to know established users
+	userMessages := map[int64]int{}
+	for _, m := range exp.Messages {
+		if userID, ok := parseUserID(m.FromID); ok && m.Type == "message" {
+			userMessages[userID]++
+		}
+	}
+	report.Users = len(userMessages)
+
+	seen := map[string]bool{}
+	for _, m := range exp.Messages {
+		if m.Type != "message" {
+			report.Skipped[skipService]++
+			continue
+		}
+		text := strings.Join(strings.Fields(string(m.Text)), " ")
+		userID, isUser := parseUserID(m.FromID)
+		switch {
+		case text == "":
+			report.Skipped[skipEmpty]++
+			continue
+		case !isUser:
+			report.Skipped[skipNotUser]++
+			continue
+		case len([]rune(text)) < im.MinMsgLen:
+			report.Skipped[skipShort]++
+			continue
+		case seen[text]:
+			report.Skipped[skipDuplicate]++
+			continue
+		}
+
+		if spammers[userID] {
+			if err := spamUpd.Append(text); err != nil {
+				return report, fmt.Errorf("failed to add spam sample: %w", err)
+			}
+			seen[text] = true
+			report.Spam++
+			continue
+		}
+		if userMessages[userID] < im.MinUserMessages {
+			report.Skipped[skipNewUser]++
+			continue
+		}
+		if err := hamUpd.Append(text); err != nil {
+			return report, fmt.Errorf("failed to add ham sample: %w", err)
+		}
+		seen[text] = true
+		report.Ham++
+	}
+	return report, nil
+}
+
+// parseUserID parses user id from the export, i.e. "user12345". Channels and chats are not users.
+func parseUserID(fromID string) (int64, bool) {
+	id, ok := strings.CutPrefix(fromID, "user")
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return userID, true
+}
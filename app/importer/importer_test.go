@@ -0,0 +1,50 @@
+package importer
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/mocks"
+)
+
+func TestImporter_Import(t *testing.T) {
+	spamUpd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+	hamUpd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+
+	fh, err := os.Open("testdata/result.json")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	im := Importer{SpamUsers: []int64{300}, MinMsgLen: 5, MinUserMessages: 3}
+	report, err := im.Import(fh, spamUpd, hamUpd)
+	require.NoError(t, err)
+
+	assert.Equal(t, Report{Messages: 9, Users: 3, Ham: 2, Spam: 1, Skipped: map[string]int{
+		"service": 1, "short": 1, "duplicate": 1, "new_user": 1, "not_user": 1, "empty": 1}}, report)
+
+	require.Len(t, spamUpd.AppendCalls(), 1)
+	assert.Equal(t, "Earn $500 a day from home, write me!", spamUpd.AppendCalls()[0].Msg)
+	require.Len(t, hamUpd.AppendCalls(), 2)
+	assert.Equal(t, "hello everyone, how is the project going?", hamUpd.AppendCalls()[0].Msg)
+	assert.Equal(t, "check the https://example.com for the docs", hamUpd.AppendCalls()[1].Msg, "text entities joined")
+}
+
+func TestImporter_ImportErrors(t *testing.T) {
+	upd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+	im := Importer{}
+
+	_, err := im.Import(strings.NewReader("not json"), upd, upd)
+	assert.Error(t, err)
+
+	_, err = im.Import(strings.NewReader(`{"messages": [{"type": "message", "text": 123}]}`), upd, upd)
+	assert.Error(t, err)
+
+	failed := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return errors.New("failed") }}
+	_, err = im.Import(strings.NewReader(`{"messages": [{"type": "message", "from_id": "user1", "text": "some text"}]}`), upd, failed)
+	assert.EqualError(t, err, "failed to add ham sample: failed")
+}
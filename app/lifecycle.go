@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// sdNotify sends the state to systemd with sd_notify protocol, i.e. "READY=1". It is no-op, returning false,
+// if the service is not started by systemd with Type=notify, i.e. NOTIFY_SOCKET is not set.
+func sdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// abstract sockets are set with "@" prefix, translated to the leading zero byte by net package
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("can't connect to notify socket %s, %w", socket, err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("can't send %q to notify socket %s, %w", state, socket, err)
+	}
+	return true, nil
+}
+
+// notifySystemd sends the state to systemd, failures are logged only, as notifications are not critical
+func notifySystemd(state string) {
+	sent, err := sdNotify(state)
+	if err != nil {
+		log.Printf("[WARN] %v", err)
+		return
+	}
+	if sent {
+		log.Printf("[DEBUG] systemd notified, %s", strings.ReplaceAll(state, "\n", ", "))
+	}
+}
+
+// sdWatchdogInterval returns the interval of watchdog pings, half of WatchdogSec of the service,
+// 0 if watchdog is not enabled for this process
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdWatchdog pings systemd watchdog till the context is canceled, if enabled for the service with WatchdogSec.
+// Pings are skipped while alive returns error, so systemd restarts the service stuck for longer than WatchdogSec.
+// nil alive means the service is always alive.
+func sdWatchdog(ctx context.Context, alive func() error) {
+	interval := sdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	log.Printf("[INFO] systemd watchdog enabled, ping every %v", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if alive != nil {
+				if err := alive(); err != nil {
+					log.Printf("[WARN] watchdog ping skipped, %v", err)
+					continue
+				}
+			}
+			notifySystemd("WATCHDOG=1")
+		}
+	}
+}
+
+// writePidFile writes pid of the process to the file, and returns the function removing it.
+// Fails if the file exists with pid of another running process, i.e. the bot is already running.
+func writePidFile(file string) (remove func(), err error) {
+	if data, err := os.ReadFile(file); err == nil { //nolint:gosec // file set by user
+		if pid, perr := strconv.Atoi(strings.TrimSpace(string(data))); perr == nil && pid != os.Getpid() && processRunning(pid) {
+			return nil, fmt.Errorf("pid file %s exists, process %d is running", file, pid)
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return nil, fmt.Errorf("can't make pid file dir, %w", err)
+	}
+	if err = os.WriteFile(file, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil { //nolint:gosec // pid is public
+		return nil, fmt.Errorf("can't write pid file %s, %w", file, err)
+	}
+	return func() {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WARN] can't remove pid file %s, %v", file, err)
+		}
+	}, nil
+}
+
+// processRunning returns true if the process with pid exists
+func processRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM) // EPERM - exists, but owned by another user
+}
+
+// waitDone waits for wg up to the timeout, returns false if timed out
+func waitDone(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notifySocket listens to sd_notify datagrams on a unix socket set as NOTIFY_SOCKET
+func notifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sd") // short path, as unix socket path is limited to ~100 chars
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", socket)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func Test_sdNotify(t *testing.T) {
+	t.Run("not under systemd", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+		sent, err := sdNotify("READY=1")
+		require.NoError(t, err)
+		assert.False(t, sent)
+	})
+
+	t.Run("notified", func(t *testing.T) {
+		conn := notifySocket(t)
+		sent, err := sdNotify("READY=1")
+		require.NoError(t, err)
+		assert.True(t, sent)
+		assert.Equal(t, "READY=1", readNotify(t, conn))
+	})
+
+	t.Run("no socket", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+		sent, err := sdNotify("READY=1")
+		assert.ErrorContains(t, err, "can't connect to notify socket")
+		assert.False(t, sent)
+	})
+}
+
+func Test_sdWatchdogInterval(t *testing.T) {
+	tbl := []struct {
+		usec, pid string
+		res       time.Duration
+	}{
+		{"", "", 0},
+		{"bad", "", 0},
+		{"0", "", 0},
+		{"20000000", "", 10 * time.Second},
+		{"20000000", strconv.Itoa(os.Getpid()), 10 * time.Second},
+		{"20000000", "1", 0},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.usec+"/"+tt.pid, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			assert.Equal(t, tt.res, sdWatchdogInterval())
+		})
+	}
+}
+
+func Test_sdWatchdog(t *testing.T) {
+	conn := notifySocket(t)
+	t.Setenv("WATCHDOG_USEC", "20000") // ping every 10ms
+	t.Setenv("WATCHDOG_PID", "")
+
+	var lock sync.Mutex
+	aliveErr := errors.New("stuck")
+	alive := func() error {
+		lock.Lock()
+		defer lock.Unlock()
+		return aliveErr
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sdWatchdog(ctx, alive)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err := conn.Read(make([]byte, 64))
+	assert.Error(t, err, "no pings while not alive")
+
+	lock.Lock()
+	aliveErr = nil
+	lock.Unlock()
+	assert.Equal(t, "WATCHDOG=1", readNotify(t, conn))
+
+	cancel()
+	<-done
+}
+
+func Test_writePidFile(t *testing.T) {
+	t.Run("written and removed", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "run", "tg-spam.pid")
+		remove, err := writePidFile(file)
+		require.NoError(t, err)
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+		remove()
+		assert.NoFileExists(t, file)
+		remove() // removed already, no-op
+	})
+
+	t.Run("stale pid file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "tg-spam.pid")
+		require.NoError(t, os.WriteFile(file, []byte("999999999\n"), 0o600))
+		remove, err := writePidFile(file)
+		require.NoError(t, err)
+		defer remove()
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data))
+	})
+
+	t.Run("another process running", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "tg-spam.pid")
+		require.NoError(t, os.WriteFile(file, []byte(strconv.Itoa(os.Getppid())), 0o600))
+		_, err := writePidFile(file)
+		assert.ErrorContains(t, err, "is running")
+	})
+}
+
+func Test_waitDone(t *testing.T) {
+	var wg sync.WaitGroup
+	assert.True(t, waitDone(&wg, time.Millisecond))
+	wg.Add(1)
+	assert.False(t, waitDone(&wg, 10*time.Millisecond))
+	wg.Done()
+	assert.True(t, waitDone(&wg, time.Second))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// filesMigrationName is the name of the setting marking the migration of dynamic files to the database
+const filesMigrationName = "files-migration"
+
+// filesMigration is the marker of one-time migration of dynamic samples files to the database, kept in settings
+type filesMigration struct {
+	MigratedAt time.Time `json:"migrated_at"`
+	Spam       int       `json:"spam"` // number of imported dynamic spam samples
+	Ham        int       `json:"ham"`  // number of imported dynamic ham samples
+}
+
+// migrateDynamicFiles imports dynamic spam and ham files to the database as user samples, once, on the first start
+// with the database samples storage. The migration is marked in settings, so the files are not imported again, even if
+// user samples are removed later. Databases with user samples imported before the marker was introduced are marked
+// as migrated without import. Spam is imported before ham, so a message found in both files is kept as ham,
+// the same on each run. Returns nil marker if the migration was done before.
+func migrateDynamicFiles(opts options, settings *storage.Settings, samples *storage.Samples) (*filesMigration, error) {
+	marker, err := settings.Get(filesMigrationName)
+	if err != nil {
+		return nil, fmt.Errorf("can't get files migration marker, %w", err)
+	}
+	if marker != "" {
+		log.Printf("[DEBUG] dynamic files migrated already, %s", marker)
+		return nil, nil
+	}
+
+	res := filesMigration{MigratedAt: time.Now()}
+	imported, err := hasUserSamples(samples)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range dynamicSampleFiles(opts) {
+		if imported {
+			break // dynamic files imported before the marker was introduced
+		}
+		fh, err := os.Open(f.file) //nolint:gosec // file name is from config
+		if err != nil {
+			log.Printf("[DEBUG] skip migration of %s, %v", f.file, err)
+			continue
+		}
+		count, err := samples.Import(f.sampleType, storage.SampleOriginUser, storage.SampleSourceImport, fh, false)
+		fh.Close()
+		if err != nil {
+			return nil, fmt.Errorf("can't migrate %s, %w", f.file, err)
+		}
+		if f.sampleType == storage.SampleTypeSpam {
+			res.Spam = count
+		} else {
+			res.Ham = count
+		}
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal files migration marker, %w", err)
+	}
+	if err = settings.Set(filesMigrationName, string(data)); err != nil {
+		return nil, fmt.Errorf("can't set files migration marker, %w", err)
+	}
+	if imported {
+		log.Printf("[INFO] user samples imported to the database already, dynamic files marked as migrated")
+	} else {
+		log.Printf("[INFO] dynamic files migrated to the database, spam: %d, ham: %d. The files are kept in sync with "+
+			"the database, to roll back to the file storage", res.Spam, res.Ham)
+	}
+	return &res, nil
+}
+
+// hasUserSamples returns true if the database has any user samples
+func hasUserSamples(samples *storage.Samples) (bool, error) {
+	for _, t := range []storage.SampleType{storage.SampleTypeSpam, storage.SampleTypeHam} {
+		count, err := samples.Count(t, storage.SampleOriginUser)
+		if err != nil {
+			return false, fmt.Errorf("can't count %s samples, %w", t, err)
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sampleFile is a samples file of the sample type
+type sampleFile struct {
+	sampleType storage.SampleType
+	file       string
+}
+
+// dynamicSampleFiles returns dynamic samples files, spam first
+func dynamicSampleFiles(opts options) []sampleFile {
+	return []sampleFile{
+		{sampleType: storage.SampleTypeSpam, file: filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile)},
+		{sampleType: storage.SampleTypeHam, file: filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile)},
+	}
+}
+
+// dynamicFilesExporter keeps dynamic samples files in sync with user samples of the database storage,
+// so the bot can be rolled back to the file storage without losing samples added meanwhile
+type dynamicFilesExporter struct {
+	samples *storage.Samples
+	files   []sampleFile
+	written map[storage.SampleType][sha256.Size]byte // checksum of the last written content, by sample type
+}
+
+// Run exports user samples every interval (5s if not set), if changed, and on exit, till the context is canceled
+func (e *dynamicFilesExporter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Export(); err != nil {
+			log.Printf("[WARN] can't export dynamic samples, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			if err := e.Export(); err != nil {
+				log.Printf("[WARN] can't export dynamic samples on exit, %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export writes user samples to the dynamic files, files not changed since the last export are skipped.
+// Files are replaced atomically, to not leave a partial file on failure.
+func (e *dynamicFilesExporter) Export() error {
+	if e.written == nil {
+		e.written = map[storage.SampleType][sha256.Size]byte{}
+	}
+	for _, f := range e.files {
+		t, file := f.sampleType, f.file
+		r, err := e.samples.Reader(t, storage.SampleOriginUser)
+		if err != nil {
+			return fmt.Errorf("can't read %s samples, %w", t, err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("can't read %s samples, %w", t, err)
+		}
+		sum := sha256.Sum256(data)
+		if last, ok := e.written[t]; ok && last == sum {
+			continue
+		}
+		if current, err := os.ReadFile(file); err == nil && bytes.Equal(current, data) { //nolint:gosec // file from config
+			e.written[t] = sum
+			continue
+		}
+		tmpFile := file + ".tmp"
+		if err = os.WriteFile(tmpFile, data, 0o600); err != nil {
+			return fmt.Errorf("can't write %s, %w", tmpFile, err)
+		}
+		if err = os.Rename(tmpFile, file); err != nil {
+			_ = os.Remove(tmpFile)
+			return fmt.Errorf("can't replace %s, %w", file, err)
+		}
+		e.written[t] = sum
+		log.Printf("[DEBUG] exported %s samples to %s", t, file)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func Test_migrateDynamicFiles(t *testing.T) {
+	prep := func(t *testing.T) (options, *storage.Settings, *storage.Samples) {
+		var opts options
+		opts.Files.DynamicDataPath = t.TempDir()
+		db, err := storage.NewSqliteDB(filepath.Join(opts.Files.DynamicDataPath, dataFile))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		settings, err := storage.NewSettings(db)
+		require.NoError(t, err)
+		samples, err := storage.NewSamples(db)
+		require.NoError(t, err)
+		return opts, settings, samples
+	}
+
+	t.Run("migrated once", func(t *testing.T) {
+		opts, settings, samples := prep(t)
+		require.NoError(t, os.WriteFile(filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile),
+			[]byte("spam1\nspam2\n\n"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile), []byte("ham1\n"), 0o600))
+
+		res, err := migrateDynamicFiles(opts, settings, samples)
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		assert.Equal(t, 2, res.Spam)
+		assert.Equal(t, 1, res.Ham)
+		count, err := samples.Count(storage.SampleTypeSpam, storage.SampleOriginUser)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		marker, err := settings.Get(filesMigrationName)
+		require.NoError(t, err)
+		var stored filesMigration
+		require.NoError(t, json.Unmarshal([]byte(marker), &stored))
+		assert.Equal(t, 2, stored.Spam)
+		assert.False(t, stored.MigratedAt.IsZero())
+
+		// removed samples are not imported again
+		all, err := samples.Read(storage.SampleTypeSpam, storage.SampleOriginUser)
+		require.NoError(t, err)
+		for _, s := range all {
+			require.NoError(t, samples.Delete(s.ID))
+		}
+		res, err = migrateDynamicFiles(opts, settings, samples)
+		require.NoError(t, err)
+		assert.Nil(t, res)
+		count, err = samples.Count(storage.SampleTypeSpam, storage.SampleOriginUser)
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("message in both files", func(t *testing.T) {
+		// imported in the same order on each run, so the message is kept as ham, imported last
+		for i := 0; i < 10; i++ {
+			opts, settings, samples := prep(t)
+			require.NoError(t, os.WriteFile(filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile),
+				[]byte("spam1\nboth\n"), 0o600))
+			require.NoError(t, os.WriteFile(filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile),
+				[]byte("both\nham1\n"), 0o600))
+
+			_, err := migrateDynamicFiles(opts, settings, samples)
+			require.NoError(t, err)
+			ham, err := samples.Read(storage.SampleTypeHam, storage.SampleOriginUser)
+			require.NoError(t, err)
+			require.Len(t, ham, 2)
+			assert.Equal(t, "both", ham[0].Message)
+			spam, err := samples.Read(storage.SampleTypeSpam, storage.SampleOriginUser)
+			require.NoError(t, err)
+			require.Len(t, spam, 1)
+			assert.Equal(t, "spam1", spam[0].Message)
+		}
+	})
+
+	t.Run("no files", func(t *testing.T) {
+		opts, settings, samples := prep(t)
+		res, err := migrateDynamicFiles(opts, settings, samples)
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		assert.Equal(t, filesMigration{MigratedAt: res.MigratedAt}, *res)
+	})
+
+	t.Run("user samples imported before", func(t *testing.T) {
+		opts, settings, samples := prep(t)
+		require.NoError(t, samples.Add(storage.SampleTypeHam, storage.SampleOriginUser, storage.SampleSourceAuto, "ham1"))
+		require.NoError(t, os.WriteFile(filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile), []byte("spam1\n"), 0o600))
+
+		res, err := migrateDynamicFiles(opts, settings, samples)
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		assert.Equal(t, 0, res.Spam, "marked as migrated without import")
+		count, err := samples.Count(storage.SampleTypeSpam, storage.SampleOriginUser)
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+		marker, err := settings.Get(filesMigrationName)
+		require.NoError(t, err)
+		assert.NotEmpty(t, marker)
+	})
+}
+
+func Test_dynamicFilesExporter(t *testing.T) {
+	var opts options
+	opts.Files.DynamicDataPath = t.TempDir()
+	db, err := storage.NewSqliteDB(filepath.Join(opts.Files.DynamicDataPath, dataFile))
+	require.NoError(t, err)
+	defer db.Close()
+	samples, err := storage.NewSamples(db)
+	require.NoError(t, err)
+	require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginUser, storage.SampleSourceAuto, "spam1"))
+	require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginPreset, storage.SampleSourceBase, "preset spam"))
+	spamFile := filepath.Join(opts.Files.DynamicDataPath, dynamicSpamFile)
+	hamFile := filepath.Join(opts.Files.DynamicDataPath, dynamicHamFile)
+
+	e := &dynamicFilesExporter{samples: samples, files: dynamicSampleFiles(opts)}
+	require.NoError(t, e.Export())
+	data, err := os.ReadFile(spamFile)
+	require.NoError(t, err)
+	assert.Equal(t, "spam1\n", string(data), "only user samples exported")
+	data, err = os.ReadFile(hamFile)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	require.NoError(t, samples.Add(storage.SampleTypeHam, storage.SampleOriginUser, storage.SampleSourceAuto, "ham1"))
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(hamFile)
+		return err == nil && string(data) == "ham1\n"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginUser, storage.SampleSourceAuto, "spam2"))
+	cancel()
+	<-done
+	data, err = os.ReadFile(spamFile)
+	require.NoError(t, err)
+	assert.Equal(t, "spam1\nspam2\n", string(data), "exported on exit")
+	assert.NoFileExists(t, spamFile+".tmp")
+}
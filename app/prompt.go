@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// groupPromptTemplate is the template of openai prompt used if the prompt is not set, but variables of the group are.
+// It adds the context of the group to the default prompt.
+const groupPromptTemplate = `{{.Default}}
+{{- if .Topic}} The messages are from a group about {{.Topic}}.{{end}}
+{{- if .Description}} The group description: {{.Description}}{{end}}
+{{- if .Languages}} Allowed languages of the group: {{join .Languages ", "}}, messages in other languages are off-topic.{{end}}
+{{- if .Prohibited}} Topics prohibited in the group, messages about them are spam: {{join .Prohibited ", "}}.{{end}}`
+
+// openAIPromptVars are variables of openai prompt template, describing the group
+type openAIPromptVars struct {
+	Default     string   // builtin default prompt
+	Topic       string   // topic of the group, i.e. "golang programming"
+	Description string   // description of the group, i.e. its rules
+	Languages   []string // languages allowed in the group
+	Prohibited  []string // topics prohibited in the group
+}
+
+// openAIPrompt renders openai system prompt, a go template with variables of the group, set by the option or
+// kept in the file. The file is checked for changes by Watch, so the prompt can be tuned without restart.
+type openAIPrompt struct {
+	text string // template set by the option, used if file is not set
+	file string // optional file with the template
+	vars openAIPromptVars
+
+	modTime time.Time // modification time of the file rendered last
+	size    int64     // size of the file rendered last
+}
+
+// makeOpenAIPrompt makes openai prompt of the options
+func makeOpenAIPrompt(opts options) *openAIPrompt {
+	return &openAIPrompt{text: opts.OpenAI.Prompt, file: opts.OpenAI.PromptFile, vars: openAIPromptVars{
+		Default: lib.DefaultOpenAIPrompt, Topic: opts.OpenAI.Group.Topic, Description: opts.OpenAI.Group.Description,
+		Languages: opts.OpenAI.Group.Languages, Prohibited: opts.OpenAI.Group.Prohibited}}
+}
+
+// Render returns the prompt rendered with variables of the group, from the file if set. Empty prompt means
+// the default one, unless variables of the group are set, then the default prompt is extended with them.
+func (p *openAIPrompt) Render() (string, error) {
+	text := p.text
+	if p.file != "" {
+		fi, err := os.Stat(p.file)
+		if err != nil {
+			return "", fmt.Errorf("can't read openai prompt file, %w", err)
+		}
+		data, err := os.ReadFile(p.file)
+		if err != nil {
+			return "", fmt.Errorf("can't read openai prompt file, %w", err)
+		}
+		text, p.modTime, p.size = string(data), fi.ModTime(), fi.Size()
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		if p.vars.Topic == "" && p.vars.Description == "" && len(p.vars.Languages) == 0 && len(p.vars.Prohibited) == 0 {
+			return "", nil
+		}
+		text = groupPromptTemplate
+	}
+	tmpl, err := template.New("prompt").Option("missingkey=error").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("can't parse openai prompt template, %w", err)
+	}
+	buf := bytes.Buffer{}
+	if err = tmpl.Execute(&buf, p.vars); err != nil {
+		return "", fmt.Errorf("can't render openai prompt template, %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Watch checks the prompt file for changes every interval (5s if not set), till the context is canceled.
+// The changed prompt is rendered and passed to apply once the file is unchanged for an interval, so a file
+// being written is not applied half-done. The previous prompt is kept if the file is invalid.
+func (p *openAIPrompt) Watch(ctx context.Context, interval time.Duration, apply func(prompt string)) {
+	if p.file == "" {
+		return
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	w := promptWatch{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.check(&w, apply)
+		}
+	}
+}
+
+// promptWatch is a state of the prompt file kept by Watch between checks
+type promptWatch struct {
+	failed string      // the last error, repeated errors are not logged again
+	seen   os.FileInfo // state of the changed file on the previous check
+}
+
+// check checks the prompt file once, on a tick of Watch. The changed file is applied if it is the same as
+// on the previous check, otherwise its state is kept till the next check.
+func (p *openAIPrompt) check(w *promptWatch, apply func(prompt string)) {
+	fi, err := os.Stat(p.file)
+	if err == nil && fi.ModTime().Equal(p.modTime) && fi.Size() == p.size {
+		return
+	}
+	if err == nil && (w.seen == nil || !fi.ModTime().Equal(w.seen.ModTime()) || fi.Size() != w.seen.Size()) {
+		w.seen = fi // changed since the previous check, may be still written
+		return
+	}
+	w.seen = nil
+	prompt, err := p.Render()
+	if err != nil {
+		if err.Error() != w.failed {
+			log.Printf("[WARN] openai prompt not changed, %v", err)
+		}
+		w.failed = err.Error()
+		return
+	}
+	w.failed = ""
+	apply(prompt)
+	log.Printf("[INFO] openai prompt reloaded from %s", p.file)
+}
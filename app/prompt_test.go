@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func Test_openAIPromptRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		prompt  string
+		group   func(o *options)
+		want    string
+		wantErr string
+	}{
+		{name: "default", want: ""},
+		{name: "plain prompt", prompt: "  check for spam ", want: "check for spam"},
+		{name: "template", prompt: "group about {{.Topic}}, languages: {{join .Languages \"/\"}}", want: "group about golang, languages: en/de",
+			group: func(o *options) { o.OpenAI.Group.Topic, o.OpenAI.Group.Languages = "golang", []string{"en", "de"} }},
+		{name: "default with group", want: lib.DefaultOpenAIPrompt + " The messages are from a group about golang." +
+			" Topics prohibited in the group, messages about them are spam: crypto, jobs.",
+			group: func(o *options) {
+				o.OpenAI.Group.Topic, o.OpenAI.Group.Prohibited = "golang", []string{"crypto", "jobs"}
+			}},
+		{name: "default with all group variables", want: lib.DefaultOpenAIPrompt + " The messages are from a group about golang." +
+			" The group description: no ads. Allowed languages of the group: en, messages in other languages are off-topic." +
+			" Topics prohibited in the group, messages about them are spam: crypto.",
+			group: func(o *options) {
+				o.OpenAI.Group.Topic, o.OpenAI.Group.Description = "golang", "no ads."
+				o.OpenAI.Group.Languages, o.OpenAI.Group.Prohibited = []string{"en"}, []string{"crypto"}
+			}},
+		{name: "invalid template", prompt: "about {{.Topic", wantErr: "can't parse openai prompt template"},
+		{name: "unknown variable", prompt: "about {{.Unknown}}", wantErr: "can't render openai prompt template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := options{}
+			opts.OpenAI.Prompt = tt.prompt
+			if tt.group != nil {
+				tt.group(&opts)
+			}
+			res, err := makeOpenAIPrompt(opts).Render()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+}
+
+func Test_openAIPromptWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prompt.txt")
+	opts := options{}
+	opts.OpenAI.Prompt = "ignored, replaced by file"
+	opts.OpenAI.PromptFile = file
+	opts.OpenAI.Group.Topic = "golang"
+	prompt := makeOpenAIPrompt(opts)
+
+	_, err := prompt.Render()
+	require.ErrorContains(t, err, "can't read openai prompt file")
+
+	require.NoError(t, os.WriteFile(file, []byte("spam in {{.Topic}} group"), 0o600))
+	res, err := prompt.Render()
+	require.NoError(t, err)
+	assert.Equal(t, "spam in golang group", res)
+
+	var lock sync.Mutex
+	applied := []string{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		prompt.Watch(ctx, 10*time.Millisecond, func(p string) {
+			lock.Lock()
+			applied = append(applied, p)
+			lock.Unlock()
+		})
+	}()
+	last := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(applied) == 0 {
+			return ""
+		}
+		return applied[len(applied)-1]
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, last(), "not changed")
+
+	require.NoError(t, os.WriteFile(file, []byte("new prompt for {{.Topic}}"), 0o600))
+	assert.Eventually(t, func() bool { return last() == "new prompt for golang" }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(file, []byte("broken {{.Topic"), 0o600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "new prompt for golang", last(), "invalid template not applied")
+
+	cancel()
+	<-done
+	lock.Lock()
+	assert.Len(t, applied, 1)
+	lock.Unlock()
+}
+
+func Test_openAIPromptCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "prompt.txt")
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	write := func(text string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(file, []byte(text), 0o600))
+		require.NoError(t, os.Chtimes(file, modTime, modTime))
+	}
+	write("prompt v1", ts)
+	opts := options{}
+	opts.OpenAI.PromptFile = file
+	prompt := makeOpenAIPrompt(opts)
+	_, err := prompt.Render()
+	require.NoError(t, err)
+
+	applied := []string{}
+	apply := func(p string) { applied = append(applied, p) }
+	w := promptWatch{}
+	prompt.check(&w, apply)
+	assert.Empty(t, applied, "not changed")
+
+	// the file is changed on consecutive ticks, i.e. being written
+	write("prompt v2", ts.Add(time.Second))
+	prompt.check(&w, apply)
+	assert.Empty(t, applied, "changed since the previous tick")
+	write("prompt v2 longer", ts.Add(time.Second))
+	prompt.check(&w, apply)
+	assert.Empty(t, applied, "size changed since the previous tick")
+	write("prompt v2 longer", ts.Add(2*time.Second))
+	prompt.check(&w, apply)
+	assert.Empty(t, applied, "time changed since the previous tick")
+
+	// applied one tick after the file stopped changing, and only once
+	prompt.check(&w, apply)
+	assert.Equal(t, []string{"prompt v2 longer"}, applied)
+	prompt.check(&w, apply)
+	assert.Len(t, applied, 1)
+
+	// invalid template is not applied, and the valid one written after it is
+	write("broken {{.Topic", ts.Add(3*time.Second))
+	prompt.check(&w, apply)
+	prompt.check(&w, apply)
+	assert.Len(t, applied, 1)
+	assert.NotEmpty(t, w.failed)
+	write("prompt v3", ts.Add(4*time.Second))
+	prompt.check(&w, apply)
+	assert.Len(t, applied, 1)
+	prompt.check(&w, apply)
+	assert.Equal(t, []string{"prompt v2 longer", "prompt v3"}, applied)
+	assert.Empty(t, w.failed)
+}
+
+func Test_openAIPromptWatchNoFile(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		makeOpenAIPrompt(options{}).Watch(context.Background(), time.Millisecond, func(string) { t.Error("unexpected apply") })
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watch without file should return right away")
+	}
+}
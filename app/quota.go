@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webhook"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// quotaHookTimeout is a timeout of the request to the quota hook
+const quotaHookTimeout = 10 * time.Second
+
+// usageStats is a source of stats of checked messages and usage of openai, i.e. stats store
+type usageStats interface {
+	Report(from, to time.Time) (storage.StatsReport, error)
+}
+
+// openAISuspender suspends and resumes openai requests, i.e. detector
+type openAISuspender interface {
+	SuspendOpenAI(suspend bool)
+}
+
+// tenantUsage is a usage of the tenant in the current period of quota, posted to the quota hook
+type tenantUsage struct {
+	Tenant   string          `json:"tenant"`
+	Period   string          `json:"period"` // day or month
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Checked  int             `json:"checked"` // number of checked messages
+	Spam     int             `json:"spam"`    // number of detected spam messages
+	OpenAI   lib.OpenAIUsage `json:"openai"`  // usage of openai, requests, tokens and estimated cost
+	Rows     int64           `json:"rows"`    // number of stored rows, not limited by the period
+	Bytes    int64           `json:"bytes"`   // size of the database, not limited by the period
+	Limits   quotaLimits     `json:"limits"`
+	Decision quotaDecision   `json:"decision"` // decision by the limits, the hook can override it
+}
+
+// quotaLimits are limits of usage of the tenant, 0 for no limit
+type quotaLimits struct {
+	Messages     int   `json:"messages"`      // checked messages in the period
+	OpenAITokens int   `json:"openai_tokens"` // prompt and completion tokens of openai in the period
+	Rows         int64 `json:"rows"`          // stored rows
+}
+
+// quotaDecision is a decision of the quota, made by the limits or returned by the quota hook
+type quotaDecision struct {
+	StopChecks bool   `json:"stop_checks"` // messages are not checked
+	StopOpenAI bool   `json:"stop_openai"` // openai requests are suspended
+	Reason     string `json:"reason,omitempty"`
+}
+
+// quotaGuard accounts usage of the tenant in the current period and enforces its quota. Checks of messages are
+// stopped if checked messages or stored rows are over the limits, and openai requests are suspended if its tokens are
+// over the limit. The usage is posted to the quota hook of the hosting operator, if set, and the decision returned by
+// the hook replaces the one by the limits, so the operator can cap or bill tenants with own rules.
+type quotaGuard struct {
+	tenant string
+	period string // day or month
+	limits quotaLimits
+	hook   string // url of the quota hook, optional
+	secret string // payload of the hook is signed with hmac-sha256 of the secret if set
+	client *http.Client
+	stats  usageStats
+	size   func() (storage.SizeInfo, error) // size of the database of the tenant
+	openai openAISuspender
+	now    func() time.Time
+
+	checksStopped atomic.Bool
+	lock          sync.Mutex
+	decision      quotaDecision // the last applied decision
+}
+
+// makeQuotaGuard makes quota guard of the tenant, returns nil if neither limits nor hook are set.
+// Quota is used in multi-tenant mode only, it is ignored with a warning for a single bot.
+func makeQuotaGuard(opts options, tenant string, stats usageStats, size func() (storage.SizeInfo, error),
+	openai openAISuspender) (*quotaGuard, error) {
+	limits := quotaLimits{Messages: opts.Quota.Messages, OpenAITokens: opts.Quota.OpenAITokens, Rows: opts.Quota.Rows}
+	if opts.Quota.Hook == "" && limits == (quotaLimits{}) {
+		return nil, nil
+	}
+	if tenant == "" {
+		log.Printf("[WARN] quota is used in multi-tenant mode only, ignored")
+		return nil, nil
+	}
+	if opts.Quota.Hook != "" {
+		if _, err := url.ParseRequestURI(opts.Quota.Hook); err != nil {
+			return nil, fmt.Errorf("invalid quota hook url %q, %w", opts.Quota.Hook, err)
+		}
+	}
+	return &quotaGuard{tenant: tenant, period: opts.Quota.Period, limits: limits, hook: opts.Quota.Hook,
+		secret: opts.Quota.Secret, client: &http.Client{Timeout: quotaHookTimeout}, stats: stats, size: size,
+		openai: openai, now: time.Now}, nil
+}
+
+// ChecksStopped returns true if checks of messages are stopped by the quota
+func (g *quotaGuard) ChecksStopped() bool { return g.checksStopped.Load() }
+
+// Run updates the usage and the decision on start and every interval, till context is canceled
+func (g *quotaGuard) Run(ctx context.Context, interval time.Duration) {
+	if err := g.update(ctx); err != nil {
+		log.Printf("[WARN] can't update quota of tenant %s, %v", g.tenant, err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.update(ctx); err != nil {
+				log.Printf("[WARN] can't update quota of tenant %s, %v", g.tenant, err)
+			}
+		}
+	}
+}
+
+// update accounts the usage, decides by the limits and the hook, and applies the decision.
+// If the hook failed, the decision by the limits is applied.
+func (g *quotaGuard) update(ctx context.Context) error {
+	usage, err := g.usage()
+	if err != nil {
+		return err
+	}
+	usage.Decision = g.limit(usage)
+	decision := usage.Decision
+	if g.hook != "" {
+		d, ok, err := g.post(ctx, usage)
+		switch {
+		case err != nil:
+			log.Printf("[WARN] quota hook of tenant %s failed, limits applied, %v", g.tenant, err)
+		case ok:
+			decision = d
+		}
+	}
+	log.Printf("[DEBUG] usage of tenant %s: checked %d, openai tokens %d, rows %d", g.tenant, usage.Checked,
+		usage.OpenAI.PromptTokens+usage.OpenAI.CompletionTokens, usage.Rows)
+	g.apply(decision)
+	return nil
+}
+
+// usage returns usage of the tenant in the current period
+func (g *quotaGuard) usage() (tenantUsage, error) {
+	now := g.now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if g.period == "day" {
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	res := tenantUsage{Tenant: g.tenant, Period: g.period, From: from, To: now, Limits: g.limits}
+	report, err := g.stats.Report(from, now)
+	if err != nil {
+		return res, fmt.Errorf("can't get stats, %w", err)
+	}
+	res.Checked, res.Spam, res.OpenAI = report.Checked, report.Spam, report.OpenAI
+	size, err := g.size()
+	if err != nil {
+		return res, fmt.Errorf("can't get size of db, %w", err)
+	}
+	res.Bytes = size.Bytes
+	for _, n := range size.Records {
+		res.Rows += n
+	}
+	return res, nil
+}
+
+// limit returns the decision by the limits for the usage
+func (g *quotaGuard) limit(u tenantUsage) quotaDecision {
+	var res quotaDecision
+	var reasons []string
+	if g.limits.Messages > 0 && u.Checked >= g.limits.Messages {
+		res.StopChecks = true
+		reasons = append(reasons, fmt.Sprintf("checked messages %d of %d", u.Checked, g.limits.Messages))
+	}
+	if g.limits.Rows > 0 && u.Rows >= g.limits.Rows {
+		res.StopChecks = true
+		reasons = append(reasons, fmt.Sprintf("stored rows %d of %d", u.Rows, g.limits.Rows))
+	}
+	if tokens := u.OpenAI.PromptTokens + u.OpenAI.CompletionTokens; g.limits.OpenAITokens > 0 && tokens >= g.limits.OpenAITokens {
+		res.StopOpenAI = true
+		reasons = append(reasons, fmt.Sprintf("openai tokens %d of %d", tokens, g.limits.OpenAITokens))
+	}
+	res.Reason = strings.Join(reasons, ", ")
+	return res
+}
+
+// post posts the usage to the quota hook, and returns the decision of the response.
+// The decision is not returned if the response is empty, i.e. 204, to keep the decision by the limits.
+func (g *quotaGuard) post(ctx context.Context, u tenantUsage) (res quotaDecision, ok bool, err error) {
+	body, err := json.Marshal(u)
+	if err != nil {
+		return res, false, fmt.Errorf("can't marshal usage, %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.hook, bytes.NewReader(body))
+	if err != nil {
+		return res, false, fmt.Errorf("can't make request, %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(g.secret, body))
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return res, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return res, false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return res, false, fmt.Errorf("can't read response, %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return res, false, nil
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		return res, false, fmt.Errorf("can't parse response, %w", err)
+	}
+	return res, true, nil
+}
+
+// apply applies the decision, changes are logged
+func (g *quotaGuard) apply(d quotaDecision) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.checksStopped.Store(d.StopChecks)
+	g.openai.SuspendOpenAI(d.StopOpenAI)
+	if d.StopChecks == g.decision.StopChecks && d.StopOpenAI == g.decision.StopOpenAI {
+		g.decision = d
+		return
+	}
+	g.decision = d
+	if !d.StopChecks && !d.StopOpenAI {
+		log.Printf("[INFO] quota of tenant %s restored, checks and openai resumed", g.tenant)
+		return
+	}
+	log.Printf("[WARN] quota of tenant %s exceeded, checks stopped: %v, openai stopped: %v, %s", g.tenant,
+		d.StopChecks, d.StopOpenAI, d.Reason)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webhook"
+	"github.com/umputun/tg-spam/lib"
+)
+
+type statsFunc func(from, to time.Time) (storage.StatsReport, error)
+
+func (f statsFunc) Report(from, to time.Time) (storage.StatsReport, error) { return f(from, to) }
+
+type fakeSuspender struct {
+	lock      sync.Mutex
+	suspended bool
+}
+
+func (f *fakeSuspender) SuspendOpenAI(suspend bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.suspended = suspend
+}
+
+func (f *fakeSuspender) get() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.suspended
+}
+
+func Test_makeQuotaGuard(t *testing.T) {
+	var opts options
+	opts.Quota.Period = "month"
+	g, err := makeQuotaGuard(opts, "chess", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, g, "no limits and hook")
+
+	opts.Quota.Messages = 100
+	g, err = makeQuotaGuard(opts, "", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, g, "single mode")
+
+	g, err = makeQuotaGuard(opts, "chess", nil, nil, nil)
+	require.NoError(t, err)
+	require.NotNil(t, g)
+	assert.Equal(t, quotaLimits{Messages: 100}, g.limits)
+
+	opts.Quota.Hook = "not-url"
+	_, err = makeQuotaGuard(opts, "chess", nil, nil, nil)
+	require.Error(t, err)
+}
+
+func TestQuotaGuard_update(t *testing.T) {
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.Local)
+	var report storage.StatsReport
+	var reportFrom time.Time
+	suspender := &fakeSuspender{}
+	g := &quotaGuard{tenant: "chess", period: "month", limits: quotaLimits{Messages: 100, OpenAITokens: 1000, Rows: 500},
+		stats: statsFunc(func(from, to time.Time) (storage.StatsReport, error) {
+			reportFrom = from
+			return report, nil
+		}),
+		size: func() (storage.SizeInfo, error) {
+			return storage.SizeInfo{Bytes: 4096, Records: map[string]int64{"messages": 300, "detected_spam": 10}}, nil
+		},
+		openai: suspender, now: func() time.Time { return now }}
+
+	report = storage.StatsReport{Checked: 50, OpenAI: lib.OpenAIUsage{PromptTokens: 400, CompletionTokens: 100}}
+	require.NoError(t, g.update(context.Background()))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), reportFrom, "start of the month")
+	assert.False(t, g.ChecksStopped())
+	assert.False(t, suspender.get())
+
+	report = storage.StatsReport{Checked: 100, OpenAI: lib.OpenAIUsage{PromptTokens: 900, CompletionTokens: 100}}
+	require.NoError(t, g.update(context.Background()))
+	assert.True(t, g.ChecksStopped())
+	assert.True(t, suspender.get())
+	assert.Equal(t, "checked messages 100 of 100, openai tokens 1000 of 1000", g.decision.Reason)
+
+	g.period = "day"
+	report = storage.StatsReport{Checked: 10}
+	require.NoError(t, g.update(context.Background()))
+	assert.Equal(t, time.Date(2024, 5, 15, 0, 0, 0, 0, time.Local), reportFrom, "start of the day")
+	assert.False(t, g.ChecksStopped())
+	assert.False(t, suspender.get())
+
+	g.limits.Rows = 310
+	require.NoError(t, g.update(context.Background()))
+	assert.True(t, g.ChecksStopped(), "stored rows over the limit")
+	assert.False(t, suspender.get())
+}
+
+func TestQuotaGuard_hook(t *testing.T) {
+	var posted []tenantUsage
+	var signatures []string
+	response := ""
+	status := http.StatusOK
+	var lock sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		var u tenantUsage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+		posted = append(posted, u)
+		signatures = append(signatures, r.Header.Get(webhook.SignatureHeader))
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	defer ts.Close()
+
+	now := time.Date(2024, 5, 15, 10, 30, 0, 0, time.Local)
+	suspender := &fakeSuspender{}
+	g := &quotaGuard{tenant: "chess", period: "month", limits: quotaLimits{Messages: 100}, hook: ts.URL, secret: "s3cret",
+		client: http.DefaultClient, openai: suspender, now: func() time.Time { return now },
+		stats: statsFunc(func(from, to time.Time) (storage.StatsReport, error) {
+			return storage.StatsReport{Checked: 120, Spam: 5, OpenAI: lib.OpenAIUsage{Requests: 2, PromptTokens: 300}}, nil
+		}),
+		size: func() (storage.SizeInfo, error) {
+			return storage.SizeInfo{Bytes: 4096, Records: map[string]int64{"messages": 300}}, nil
+		}}
+
+	status = http.StatusNoContent
+	require.NoError(t, g.update(context.Background()))
+	require.Len(t, posted, 1)
+	assert.Equal(t, "chess", posted[0].Tenant)
+	assert.Equal(t, "month", posted[0].Period)
+	assert.True(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local).Equal(posted[0].From))
+	assert.Equal(t, 120, posted[0].Checked)
+	assert.Equal(t, 5, posted[0].Spam)
+	assert.Equal(t, 300, posted[0].OpenAI.PromptTokens)
+	assert.Equal(t, int64(300), posted[0].Rows)
+	assert.Equal(t, int64(4096), posted[0].Bytes)
+	assert.Equal(t, quotaLimits{Messages: 100}, posted[0].Limits)
+	assert.True(t, posted[0].Decision.StopChecks, "decision by limits")
+	assert.NotEmpty(t, signatures[0])
+	assert.True(t, g.ChecksStopped(), "decision by limits kept on empty response")
+
+	status, response = http.StatusOK, `{"stop_checks": false, "stop_openai": true, "reason": "unpaid"}`
+	require.NoError(t, g.update(context.Background()))
+	assert.False(t, g.ChecksStopped(), "decision of hook")
+	assert.True(t, suspender.get())
+	assert.Equal(t, "unpaid", g.decision.Reason)
+
+	status = http.StatusInternalServerError
+	require.NoError(t, g.update(context.Background()))
+	assert.True(t, g.ChecksStopped(), "limits applied on failed hook")
+	assert.False(t, suspender.get())
+	assert.Len(t, posted, 3)
+}
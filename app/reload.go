@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/umputun/tg-spam/app/webapi"
+)
+
+// configReloader reloads configuration of the running bot on SIGHUP, /reload command in admin chat and POST /reload.
+// Options are parsed again from the same flags, env and config file, and settings changed with webapi still override them.
+// Thresholds, messages, dry and training modes are applied, samples and stop-words are reloaded. The detector and
+// the telegram listener are kept, so approved users are not lost and the connection is not dropped.
+// Other options, i.e. tokens, storage and server ones, are applied on restart only.
+type configReloader struct {
+	args     []string        // command line arguments, parsed again on reload
+	env      *tenantEnv      // tenant of multi-tenant mode, options are loaded with its config file, nil in single mode
+	settings settingsUpdater // applies reloaded settings to the running detector, spam bot and listener
+
+	lock     sync.Mutex
+	reported func(webapi.RuntimeSettings) // optional, reports reloaded settings to the web server
+}
+
+// Reload parses options again and applies the ones which can be changed without restart, thread-safe
+func (r *configReloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	opts, err := r.options()
+	if err != nil {
+		return fmt.Errorf("can't load options, %w", err)
+	}
+	if r.settings.store != nil {
+		stored, err := loadRuntimeSettings(r.settings.store)
+		if err != nil {
+			return fmt.Errorf("can't load runtime settings, %w", err)
+		}
+		opts = applyRuntimeSettings(opts, stored)
+	}
+	rs := runtimeSettings(opts)
+	if err = rs.Validate(); err != nil {
+		return fmt.Errorf("invalid settings, %w", err)
+	}
+
+	applied := r.settings.scheduled(rs)
+	r.settings.apply(applied)
+	if err = r.settings.spamBot.ReloadSamples(); err != nil {
+		return fmt.Errorf("can't reload samples, %w", err)
+	}
+	if r.reported != nil {
+		r.reported(applied)
+	}
+	log.Printf("[INFO] configuration reloaded, thresholds: %+v, dry: %v, training: %v",
+		r.settings.detector.Thresholds(), opts.Dry, opts.Training)
+	return nil
+}
+
+// options parses options from the same args, with the config file of the tenant in multi-tenant mode
+func (r *configReloader) options() (options, error) {
+	if r.env != nil {
+		return loadTenantOptions(r.args, r.env.tenant)
+	}
+	opts, _, err := loadOptions(r.args)
+	return opts, err
+}
+
+// applySchedule applies settings changed by schedule rules started or ended, and reports them, thread-safe
+func (r *configReloader) applySchedule(rs webapi.RuntimeSettings) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.settings.apply(rs)
+	if r.reported != nil {
+		r.reported(rs)
+	}
+}
+
+// reportTo sets the function reporting reloaded settings, i.e. to the web server
+func (r *configReloader) reportTo(fn func(webapi.RuntimeSettings)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reported = fn
+}
+
+// watchSignals reloads configuration on SIGHUP, till context canceled
+func (r *configReloader) watchSignals(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("[INFO] hangup signal, reloading configuration")
+			if err := r.Reload(); err != nil {
+				log.Printf("[WARN] can't reload configuration, %v", err)
+			}
+		}
+	}
+}
+
+// runtimeSettings returns all settings which can be changed without restart, as set by the options
+func runtimeSettings(opts options) webapi.RuntimeSettings {
+	s := makeWebSettings(opts)
+	return webapi.RuntimeSettings{SimilarityThreshold: &s.SimilarityThreshold, MinMsgLen: &s.MinMsgLen,
+		MaxEmoji: &s.MaxEmoji, MinSpamProbability: &s.MinSpamProbability, SpamMsg: &s.SpamMsg,
+		SpamDryMsg: &s.SpamDryMsg, Training: &s.Training, Dry: &s.Dry}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/events"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func Test_configReloader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte("win a prize\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte("hello there\n"), 0o600))
+	configFile := filepath.Join(tmpDir, "tg-spam.yml")
+	require.NoError(t, os.WriteFile(configFile, []byte("min-msg-len: 30\nmax-emoji: 3\n"), 0o600))
+
+	args := []string{"--config=" + configFile, "--files.samples=" + tmpDir, "--files.dynamic=" + tmpDir}
+	opts, _, err := loadOptions(args)
+	require.NoError(t, err)
+	detector := makeDetector(opts, nil)
+	spamBot, err := makeSpamBot(ctx, opts, detector, nil, nil, nil)
+	require.NoError(t, err)
+	detector.AddApprovedUser(lib.ApprovedUser{UserID: "123"})
+
+	db, err := storage.NewSqliteDB(filepath.Join(tmpDir, dataFile))
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := storage.NewSettings(db)
+	require.NoError(t, err)
+	listener := &events.TelegramListener{}
+
+	var reported webapi.RuntimeSettings
+	r := &configReloader{args: args, settings: settingsUpdater{store: store, detector: detector, spamBot: spamBot,
+		listener: listener}}
+	r.reportTo(func(rs webapi.RuntimeSettings) { reported = rs })
+
+	// config file changed, and one of the settings changed with webapi before
+	require.NoError(t, os.WriteFile(configFile, []byte("min-msg-len: 10\nmax-emoji: 5\ntraining: true\n"+
+		"message: {spam: spam detected}\n"), 0o600))
+	threshold := 0.8
+	_, err = r.settings.Update(webapi.RuntimeSettings{SimilarityThreshold: &threshold})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte("win a prize\nfree money\n"), 0o600))
+
+	require.NoError(t, r.Reload())
+	assert.Equal(t, lib.Thresholds{SimilarityThreshold: 0.8, MinMsgLen: 10, MaxAllowedEmoji: 5, MinSpamProbability: 50},
+		detector.Thresholds(), "file changes applied, webapi changes kept")
+	msg, _ := spamBot.Messages()
+	assert.Equal(t, "spam detected", msg)
+	dry, training := listener.Modes()
+	assert.False(t, dry)
+	assert.True(t, training)
+	assert.Equal(t, 10, *reported.MinMsgLen)
+	assert.Equal(t, 0.8, *reported.SimilarityThreshold)
+	assert.True(t, *reported.Training)
+	assert.Len(t, detector.ApprovedUsers(), 1, "approved users kept")
+	spam, _ := detector.Check("free money", "456")
+	assert.True(t, spam, "samples reloaded")
+
+	t.Run("invalid config file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(configFile, []byte("min-msg-len: abc\n"), 0o600))
+		err := r.Reload()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can't load options")
+		assert.Equal(t, 10, detector.Thresholds().MinMsgLen, "nothing changed")
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(configFile, []byte("min-msg-len: -1\n"), 0o600))
+		err := r.Reload()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "min_msg_len -1 is negative")
+		assert.Equal(t, 10, detector.Thresholds().MinMsgLen, "nothing changed")
+	})
+}
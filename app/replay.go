@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// replayEntry is a detection replayed with the current configuration
+type replayEntry struct {
+	Time     time.Time         `json:"time"`
+	UserID   int64             `json:"user_id"`
+	UserName string            `json:"user_name"`
+	Text     string            `json:"text"`
+	Reversed bool              `json:"reversed"` // reversed by admins, i.e. false positive
+	Spam     bool              `json:"spam"`     // verdict of the current configuration
+	Checks   []lib.CheckResult `json:"checks"`   // results of the current configuration
+}
+
+// replayReport is the result of replay command. All replayed messages were detected as spam, so the verdict
+// is changed for messages detected as ham now.
+type replayReport struct {
+	Replayed       int           `json:"replayed"`
+	Changed        int           `json:"changed"`         // detected as ham now
+	Regressions    int           `json:"regressions"`     // detected as ham now, but not reversed by admins
+	Fixed          int           `json:"fixed"`           // detected as ham now and reversed by admins, i.e. fixed false positives
+	FalsePositives int           `json:"false_positives"` // reversed by admins, but still detected as spam
+	Entries        []replayEntry `json:"entries"`         // changed entries, or all with replay --all
+}
+
+// replayDetections re-checks detected spam, stored in the database or read from the spam log file set by
+// replay --from, with the current samples, stop-words and thresholds, and prints the messages with changed verdict
+// to out. CAS and OpenAI checks are not used, as for check command. Returns error if spam not reversed by admins
+// is not detected anymore, with replay --fail-on-regression, so changes of samples and thresholds can be checked in CI.
+func replayDetections(ctx context.Context, opts options, out io.Writer) error {
+	opts.CAS.API, opts.Lols.API, opts.OpenAI.Token = "", "", ""
+	var dataDB *sqlx.DB
+	if opts.Files.SamplesStorage == "db" || opts.Replay.From == "db" {
+		dataDBFile := filepath.Join(opts.Files.DynamicDataPath, dataFile)
+		if _, err := os.Stat(dataDBFile); err != nil {
+			return fmt.Errorf("can't find data db, %w", err)
+		}
+		db, err := storage.NewSqliteDB(dataDBFile)
+		if err != nil {
+			return fmt.Errorf("can't make data db, %w", err)
+		}
+		defer db.Close()
+		dataDB = db
+	}
+
+	var entries []replayEntry
+	var err error
+	if opts.Replay.From == "db" {
+		entries, err = readStoredDetections(opts, dataDB)
+	} else {
+		entries, err = readSpamLog(opts.Replay.From)
+	}
+	if err != nil {
+		return fmt.Errorf("can't read detections, %w", err)
+	}
+
+	if opts.Files.SamplesStorage != "db" {
+		dataDB = nil // samples are loaded from files
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops watching of samples files
+	detector := makeDetector(opts, nil)
+	if _, err = makeSpamBot(ctx, opts, detector, dataDB, nil, nil); err != nil {
+		return fmt.Errorf("can't load samples, %w", err)
+	}
+
+	report := replayReport{Entries: []replayEntry{}}
+	for _, e := range entries {
+		userID := strconv.FormatInt(e.UserID, 10)
+		e.Spam, e.Checks = detector.CheckLocal(e.Text, userID)
+		detector.RemoveApprovedUsers(userID) // user approved by ham message is checked again by the next one
+		report.Replayed++
+		switch {
+		case !e.Spam && e.Reversed:
+			report.Changed++
+			report.Fixed++
+		case !e.Spam:
+			report.Changed++
+			report.Regressions++
+		case e.Reversed:
+			report.FalsePositives++
+		}
+		if !e.Spam || opts.Replay.All {
+			report.Entries = append(report.Entries, e)
+		}
+	}
+
+	if err = printReplayReport(report, opts.Replay.JSON, out); err != nil {
+		return fmt.Errorf("can't print report, %w", err)
+	}
+	if opts.Replay.FailOnRegression && report.Regressions > 0 {
+		return fmt.Errorf("%d of %d detections are not detected as spam anymore", report.Regressions, report.Replayed)
+	}
+	return nil
+}
+
+// printReplayReport prints the report as text, with summary and replayed entries, or as json
+func printReplayReport(report replayReport, asJSON bool, out io.Writer) error {
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	if _, err := fmt.Fprintf(out, "replayed: %d, changed to ham: %d, regressions: %d, fixed false positives: %d, "+
+		"false positives still detected: %d\n", report.Replayed, report.Changed, report.Regressions, report.Fixed,
+		report.FalsePositives); err != nil {
+		return err
+	}
+	for _, e := range report.Entries {
+		change := "spam -> spam"
+		switch {
+		case !e.Spam && e.Reversed:
+			change = "spam -> ham, fixed false positive"
+		case !e.Spam:
+			change = "spam -> ham, regression"
+		case e.Reversed:
+			change = "spam -> spam, false positive"
+		}
+		if _, err := fmt.Fprintf(out, "\n%s %s (%d), %s\n  %s\n", e.Time.Format(time.RFC3339), e.UserName, e.UserID,
+			change, e.Text); err != nil {
+			return err
+		}
+		for _, cr := range e.Checks {
+			if _, err := fmt.Fprintf(out, "  - %s\n", cr.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readStoredDetections reads up to replay --limit latest detections from the database, oldest first
+func readStoredDetections(opts options, dataDB *sqlx.DB) ([]replayEntry, error) {
+	store, err := storage.NewDetectedSpam(dataDB)
+	if err != nil {
+		return nil, fmt.Errorf("can't make detected spam store, %w", err)
+	}
+	textCipher, err := makeCipher(opts)
+	if err != nil {
+		return nil, fmt.Errorf("can't make cipher, %w", err)
+	}
+	if textCipher != nil {
+		store.WithCipher(textCipher)
+	}
+	detections, err := store.Read(opts.Replay.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't read detected spam, %w", err)
+	}
+	res := make([]replayEntry, 0, len(detections))
+	for i := len(detections) - 1; i >= 0; i-- {
+		d := detections[i]
+		res = append(res, replayEntry{Time: d.Timestamp, UserID: d.UserID, UserName: d.UserName, Text: d.Text,
+			Reversed: d.Reversed.Valid})
+	}
+	return res, nil
+}
+
+// readSpamLog reads detections from the spam log file, csv lines for csv extension, and json lines otherwise
+func readSpamLog(file string) ([]replayEntry, error) {
+	fh, err := os.Open(file) //nolint:gosec // file set by user
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	res := []replayEntry{}
+	if strings.EqualFold(filepath.Ext(file), ".csv") {
+		rd := csv.NewReader(fh)
+		rd.FieldsPerRecord = 5 // ts, display_name, user_name, user_id, text
+		for {
+			rec, err := rd.Read()
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("can't read %s, %w", file, err)
+			}
+			ts, _ := time.Parse(time.RFC3339, rec[0])
+			userID, _ := strconv.ParseInt(rec[3], 10, 64)
+			res = append(res, replayEntry{Time: ts, UserName: rec[2], UserID: userID, Text: rec[4]})
+		}
+	}
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // long messages are allowed
+	for n := 1; scanner.Scan(); n++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var line struct {
+			TimeStamp string `json:"ts"`
+			UserName  string `json:"user_name"`
+			UserID    int64  `json:"user_id"`
+			Text      string `json:"text"`
+		}
+		if err = json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("can't parse line %d of %s, %w", n, file, err)
+		}
+		ts, _ := time.Parse(time.RFC3339, line.TimeStamp)
+		res = append(res, replayEntry{Time: ts, UserName: line.UserName, UserID: line.UserID, Text: line.Text})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("can't read %s, %w", file, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func Test_replayDetections(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesSpamFile), []byte("win a prize now\nfree money here\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, samplesHamFile), []byte("hello there friends\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, stopWordsFile), []byte("buy crypto\n"), 0o600))
+
+	replay := func(args ...string) (string, error) {
+		opts, _, err := loadOptions(append([]string{"--files.samples=" + tmpDir, "--files.dynamic=" + tmpDir,
+			"--min-msg-len=0", "replay"}, args...))
+		require.NoError(t, err)
+		out := bytes.Buffer{}
+		err = replayDetections(context.Background(), opts, &out)
+		return out.String(), err
+	}
+
+	t.Run("no db", func(t *testing.T) {
+		_, err := replay()
+		assert.ErrorContains(t, err, "can't find data db")
+	})
+
+	db, err := storage.NewSqliteDB(filepath.Join(tmpDir, dataFile))
+	require.NoError(t, err)
+	store, err := storage.NewDetectedSpam(db)
+	require.NoError(t, err)
+	for _, d := range []storage.DetectedSpamInfo{
+		{ChatID: 1, UserID: 10, UserName: "spammer", Text: "please buy crypto", Action: "ban"},
+		{ChatID: 1, UserID: 20, UserName: "friend", Text: "hello there friends", Action: "ban"},
+		{ChatID: 1, UserID: 30, UserName: "another", Text: "hello there my friends", Action: "dry"},
+		{ChatID: 1, UserID: 40, UserName: "fp", Text: "free money here", Action: "ban"},
+	} {
+		require.NoError(t, store.Write(d))
+	}
+	for _, userID := range []int64{20, 40} {
+		_, err = store.SetReversed(1, userID)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	t.Run("stored detections", func(t *testing.T) {
+		out, err := replay()
+		require.NoError(t, err)
+		t.Log(out)
+		assert.True(t, strings.HasPrefix(out, "replayed: 4, changed to ham: 2, regressions: 1, fixed false positives: 1, "+
+			"false positives still detected: 1\n"), out)
+		assert.Contains(t, out, "friend (20), spam -> ham, fixed false positive\n  hello there friends\n")
+		assert.Contains(t, out, "another (30), spam -> ham, regression\n  hello there my friends\n")
+		assert.NotContains(t, out, "spammer", "unchanged detections not printed")
+
+		_, err = replay("--fail-on-regression")
+		assert.EqualError(t, err, "1 of 4 detections are not detected as spam anymore")
+	})
+
+	t.Run("stored detections json", func(t *testing.T) {
+		out, err := replay("--json", "--all", "--limit=3")
+		require.NoError(t, err)
+		var report replayReport
+		require.NoError(t, json.Unmarshal([]byte(out), &report))
+		assert.Equal(t, 3, report.Replayed, "latest 3 detections")
+		require.Len(t, report.Entries, 3)
+		assert.Equal(t, "friend", report.Entries[0].UserName, "oldest first")
+		assert.False(t, report.Entries[0].Spam)
+		assert.True(t, report.Entries[0].Reversed)
+		assert.Equal(t, "fp", report.Entries[2].UserName)
+		assert.True(t, report.Entries[2].Spam)
+		assert.NotEmpty(t, report.Entries[2].Checks)
+	})
+
+	t.Run("spam log", func(t *testing.T) {
+		jsonLog := filepath.Join(tmpDir, "tg-spam.log")
+		require.NoError(t, os.WriteFile(jsonLog, []byte(
+			`{"ts":"2024-05-01T10:00:00Z","display_name":"S","user_name":"spammer","user_id":10,"text":"please buy crypto"}`+"\n"+
+				`{"ts":"2024-05-01T11:00:00Z","display_name":"F","user_name":"friend","user_id":20,"text":"hello there friends"}`+"\n"), 0o600))
+		out, err := replay("--from=" + jsonLog)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, "replayed: 2, changed to ham: 1, regressions: 1,"), out)
+		assert.Contains(t, out, "2024-05-01T11:00:00Z friend (20), spam -> ham, regression\n")
+
+		csvLog := filepath.Join(tmpDir, "tg-spam.csv")
+		require.NoError(t, os.WriteFile(csvLog, []byte("2024-05-01T10:00:00Z,S,spammer,10,please buy crypto\n"+
+			"2024-05-01T11:00:00Z,\"F, f\",friend,20,hello there friends\n"), 0o600))
+		out, err = replay("--from=" + csvLog)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(out, "replayed: 2, changed to ham: 1, regressions: 1,"), out)
+		assert.Contains(t, out, "2024-05-01T11:00:00Z friend (20), spam -> ham, regression\n")
+
+		require.NoError(t, os.WriteFile(jsonLog, []byte("not json\n"), 0o600))
+		_, err = replay("--from=" + jsonLog)
+		assert.ErrorContains(t, err, "can't parse line 1 of")
+
+		_, err = replay("--from=/no/such/file.log")
+		assert.ErrorContains(t, err, "can't read detections")
+	})
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// samplesLine replaces line breaks of multiline samples, as each sample is kept in a single line of samples files
+var samplesLine = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// jsonlSample is a line of samples file in jsonl format
+type jsonlSample struct {
+	Message string `json:"message"`
+}
+
+// processSamples runs samples dedupe, merge or convert command. Samples are read from the input files and written
+// to the output one, in formats set by extensions of the files: txt (one sample per line, the format of samples files),
+// csv (with "message" column) or jsonl (with "message" field). With samples --dry-run the diff of the output file
+// is printed to out, and nothing is written.
+func processSamples(cmd string, opts options, out io.Writer) error {
+	var inputs []string
+	var outFile string
+	switch cmd {
+	case "dedupe":
+		inputs, outFile = []string{opts.Samples.Dedupe.File}, opts.Samples.Dedupe.File
+	case "merge":
+		inputs, outFile = opts.Samples.Merge.Files, opts.Samples.Merge.Out
+	case "convert":
+		inputs, outFile = []string{opts.Samples.Convert.In}, opts.Samples.Convert.Out
+	default:
+		return fmt.Errorf("unknown samples command %q", cmd)
+	}
+
+	var samples []string
+	for _, file := range inputs {
+		res, err := readSamplesFrom(file)
+		if err != nil {
+			return fmt.Errorf("can't read samples from %s, %w", file, err)
+		}
+		samples = append(samples, res...)
+	}
+	read := len(samples)
+	if cmd != "convert" {
+		samples = dedupeSamples(samples)
+	}
+
+	if opts.Samples.DryRun {
+		current, err := readSamplesFrom(outFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("can't read samples from %s, %w", outFile, err)
+		}
+		return writeSamplesDiff(out, outFile, current, samples)
+	}
+	if err := writeSamplesTo(outFile, samples); err != nil {
+		return fmt.Errorf("can't write samples to %s, %w", outFile, err)
+	}
+	log.Printf("[INFO] %d samples written to %s, read: %d, duplicates removed: %d",
+		len(samples), outFile, read, read-len(samples))
+	return nil
+}
+
+// samplesFileFormat returns the format of samples file by its extension, txt if not csv or jsonl
+func samplesFileFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return "csv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	return "txt"
+}
+
+// readSamplesFrom reads samples from the file in the format of its extension.
+// Multiline samples are joined into a single line, empty ones are skipped.
+func readSamplesFrom(file string) ([]string, error) {
+	fh, err := os.Open(file) //nolint:gosec // file set by user
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var messages []string
+	switch samplesFileFormat(file) {
+	case "csv":
+		cr := csv.NewReader(fh)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("can't read csv header, %w", err)
+		}
+		msgIdx := -1
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), "message") {
+				msgIdx = i
+			}
+		}
+		if msgIdx < 0 {
+			return nil, errors.New("no message column in csv header")
+		}
+		for {
+			rec, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("can't read csv record, %w", err)
+			}
+			if msgIdx < len(rec) {
+				messages = append(messages, rec[msgIdx])
+			}
+		}
+	case "jsonl":
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var sample jsonlSample
+			if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+				return nil, fmt.Errorf("can't decode line %d, %w", line, err)
+			}
+			messages = append(messages, sample.Message)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("can't read samples, %w", err)
+		}
+	default:
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			messages = append(messages, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("can't read samples, %w", err)
+		}
+	}
+
+	res := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if msg = strings.TrimSpace(samplesLine.Replace(msg)); msg != "" {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+// writeSamplesTo writes samples to the file in the format of its extension. Samples are written to a temp file
+// first, so the existing file is not damaged on failure, and the file can be one of the inputs.
+func writeSamplesTo(file string, samples []string) error {
+	tmpFile := file + ".tmp"
+	fh, err := os.Create(tmpFile) //nolint:gosec // file set by user
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile) // no-op after rename
+
+	bw := bufio.NewWriter(fh)
+	switch samplesFileFormat(file) {
+	case "csv":
+		cw := csv.NewWriter(bw)
+		if err = cw.Write([]string{"message"}); err == nil {
+			for _, sample := range samples {
+				if err = cw.Write([]string{sample}); err != nil {
+					break
+				}
+			}
+		}
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+	case "jsonl":
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		for _, sample := range samples {
+			if err = enc.Encode(jsonlSample{Message: sample}); err != nil {
+				break
+			}
+		}
+	default:
+		for _, sample := range samples {
+			if _, err = bw.WriteString(sample + "\n"); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := fh.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, file)
+}
+
+// dedupeSamples removes duplicated samples, keeping the first ones in order.
+// Samples are duplicates if they are the same ignoring case and whitespace.
+func dedupeSamples(samples []string) []string {
+	seen := make(map[string]bool, len(samples))
+	res := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		key := strings.ToLower(strings.Join(strings.Fields(sample), " "))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, sample)
+	}
+	return res
+}
+
+// writeSamplesDiff writes the diff of samples of the file, removed samples prefixed with "-", and added with "+".
+// Samples are compared as a multiset, so a removed duplicate is reported as removed.
+func writeSamplesDiff(w io.Writer, file string, current, upd []string) error {
+	counts := func(samples []string) map[string]int {
+		res := make(map[string]int, len(samples))
+		for _, sample := range samples {
+			res[sample]++
+		}
+		return res
+	}
+	kept, existing := counts(upd), counts(current)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "--- %s\n+++ %s\n", file, file)
+	removed, added := 0, 0
+	for _, sample := range current { // the first occurrences are kept, the rest reported as removed
+		if kept[sample] > 0 {
+			kept[sample]--
+			continue
+		}
+		removed++
+		fmt.Fprintf(bw, "-%s\n", sample)
+	}
+	for _, sample := range upd {
+		if existing[sample] > 0 {
+			existing[sample]--
+			continue
+		}
+		added++
+		fmt.Fprintf(bw, "+%s\n", sample)
+	}
+	fmt.Fprintf(bw, "%d samples, %d added, %d removed, %d unchanged\n", len(upd), added, removed, len(upd)-added)
+	return bw.Flush()
+}
+
+// revertSamples removes dynamic samples added by the source set by samples revert --source, since the time set by
+// --since, i.e. to revert a bad training session of an admin or api client. Samples are removed from the db or from
+// dynamic samples files, by samples storage. With samples --dry-run the matched samples are printed to out,
+// and nothing is removed. The running bot reloads samples files on change, and db samples on restart or reload.
+func revertSamples(opts options, out io.Writer) error {
+	source := opts.Samples.Revert.Source
+	since, err := parseSince(opts.Samples.Revert.Since, time.Now())
+	if err != nil {
+		return fmt.Errorf("can't parse since, %w", err)
+	}
+
+	if opts.Files.SamplesStorage == "db" {
+		dataDB, err := storage.NewSqliteDB(filepath.Join(opts.Files.DynamicDataPath, dataFile))
+		if err != nil {
+			return fmt.Errorf("can't make data db, %w", err)
+		}
+		defer dataDB.Close()
+		store, err := storage.NewSamples(dataDB)
+		if err != nil {
+			return fmt.Errorf("can't make samples store, %w", err)
+		}
+		if opts.Samples.DryRun {
+			samples, err := store.ReadBySource(source, since)
+			if err != nil {
+				return fmt.Errorf("can't read samples of %s, %w", source, err)
+			}
+			for _, s := range samples {
+				if err = printRevertedSample(out, string(s.Type), s.Timestamp, s.Source, s.Message); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		count, err := store.DeleteBySource(source, since)
+		if err != nil {
+			return fmt.Errorf("can't revert samples of %s, %w", source, err)
+		}
+		log.Printf("[INFO] %d samples of %s reverted", count, source)
+		return nil
+	}
+
+	total := 0
+	for _, f := range []struct{ sample, file string }{{"spam", dynamicSpamFile}, {"ham", dynamicHamFile}} {
+		upd := bot.NewSampleUpdater(filepath.Join(opts.Files.DynamicDataPath, f.file))
+		if opts.Samples.DryRun {
+			recs, err := upd.Provenance(source, since)
+			if err != nil {
+				return fmt.Errorf("can't read provenance of %s, %w", f.file, err)
+			}
+			for _, rec := range recs {
+				if err = printRevertedSample(out, f.sample, rec.Time, rec.Source, rec.Message); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		count, err := upd.Revert(source, since)
+		if err != nil {
+			return fmt.Errorf("can't revert samples of %s in %s, %w", source, f.file, err)
+		}
+		total += count
+	}
+	if !opts.Samples.DryRun {
+		log.Printf("[INFO] %d samples of %s reverted", total, source)
+	}
+	return nil
+}
+
+// printRevertedSample prints the sample matched by samples revert --dry-run
+func printRevertedSample(out io.Writer, sample string, ts time.Time, source, msg string) error {
+	_, err := fmt.Fprintf(out, "%s %s %s: %s\n", ts.Format(time.RFC3339), sample, source, msg)
+	return err
+}
+
+// parseSince parses time as RFC3339, or as period before now, i.e. 24h or 7d. Empty value means zero time.
+func parseSince(inp string, now time.Time) (time.Time, error) {
+	if inp == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, inp); err == nil {
+		return t, nil
+	}
+	period, err := parseRetention(inp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if period <= 0 {
+		return time.Time{}, fmt.Errorf("period %s should be positive", inp)
+	}
+	return now.Add(-period), nil
+}
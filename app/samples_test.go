@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/bot"
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func Test_processSamples(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte(data), 0o600))
+		return file
+	}
+	read := func(file string) string {
+		data, err := os.ReadFile(file) //nolint:gosec // test file
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("dedupe", func(t *testing.T) {
+		file := write("spam.txt", "buy crypto now\n\nBuy  crypto NOW\nfree money\n  buy crypto now  \n")
+		var opts options
+		opts.Samples.Dedupe.File = file
+		opts.Samples.DryRun = true
+		out := bytes.Buffer{}
+		require.NoError(t, processSamples("dedupe", opts, &out))
+		assert.Equal(t, "--- "+file+"\n+++ "+file+"\n-Buy  crypto NOW\n-buy crypto now\n"+
+			"2 samples, 0 added, 2 removed, 2 unchanged\n", out.String())
+		assert.Contains(t, read(file), "Buy  crypto NOW", "not changed in dry run")
+
+		opts.Samples.DryRun = false
+		require.NoError(t, processSamples("dedupe", opts, &out))
+		assert.Equal(t, "buy crypto now\nfree money\n", read(file))
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		first := write("first.txt", "spam one\nspam two\n")
+		second := write("second.csv", "id,message\n1,spam two\n2,\"spam\nthree\"\n")
+		out := filepath.Join(dir, "merged.jsonl")
+		var opts options
+		opts.Samples.Merge.Files, opts.Samples.Merge.Out = []string{first, second}, out
+		require.NoError(t, processSamples("merge", opts, &bytes.Buffer{}))
+		assert.Equal(t, "{\"message\":\"spam one\"}\n{\"message\":\"spam two\"}\n{\"message\":\"spam three\"}\n", read(out))
+
+		// merge with the existing output in dry run, reported as added to it
+		write("third.txt", "spam four\n")
+		opts.Samples.Merge.Files = []string{out, filepath.Join(dir, "third.txt")}
+		opts.Samples.DryRun = true
+		diff := bytes.Buffer{}
+		require.NoError(t, processSamples("merge", opts, &diff))
+		assert.Equal(t, "--- "+out+"\n+++ "+out+"\n+spam four\n4 samples, 1 added, 0 removed, 3 unchanged\n", diff.String())
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		in := write("ham.jsonl", "{\"message\":\"hello, \\\"world\\\"\"}\n\n{\"message\":\"hello, \\\"world\\\"\"}\n")
+		out := filepath.Join(dir, "ham.csv")
+		var opts options
+		opts.Samples.Convert.In, opts.Samples.Convert.Out = in, out
+		require.NoError(t, processSamples("convert", opts, &bytes.Buffer{}))
+		assert.Equal(t, "message\n\"hello, \"\"world\"\"\"\n\"hello, \"\"world\"\"\"\n", read(out), "not deduped")
+
+		res, err := readSamplesFrom(out)
+		require.NoError(t, err)
+		assert.Equal(t, []string{`hello, "world"`, `hello, "world"`}, res)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var opts options
+		opts.Samples.Convert.In, opts.Samples.Convert.Out = filepath.Join(dir, "no-such.txt"), filepath.Join(dir, "out.txt")
+		assert.ErrorContains(t, processSamples("convert", opts, &bytes.Buffer{}), "can't read samples from")
+
+		opts.Samples.Convert.In = write("bad.csv", "id,text\n1,spam\n")
+		assert.ErrorContains(t, processSamples("convert", opts, &bytes.Buffer{}), "no message column in csv header")
+
+		opts.Samples.Convert.In = write("bad.jsonl", "{\"message\":\"ok\"}\nnot json\n")
+		assert.ErrorContains(t, processSamples("convert", opts, &bytes.Buffer{}), "can't decode line 2")
+
+		assert.EqualError(t, processSamples("blah", opts, &bytes.Buffer{}), `unknown samples command "blah"`)
+	})
+}
+
+func Test_samplesFileFormat(t *testing.T) {
+	tbl := []struct{ file, format string }{
+		{"spam-samples.txt", "txt"}, {"data.CSV", "csv"}, {"data.jsonl", "jsonl"}, {"data.ndjson", "jsonl"}, {"samples", "txt"},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.format, samplesFileFormat(tt.file), tt.file)
+	}
+}
+
+func Test_revertSamples(t *testing.T) {
+	t.Run("files", func(t *testing.T) {
+		dir := t.TempDir()
+		spamUpd := bot.NewSampleUpdater(filepath.Join(dir, dynamicSpamFile))
+		hamUpd := bot.NewSampleUpdater(filepath.Join(dir, dynamicHamFile))
+		require.NoError(t, spamUpd.AppendFrom("spam one", "admin:bob"))
+		require.NoError(t, spamUpd.AppendFrom("spam two", "admin:alice"))
+		require.NoError(t, hamUpd.AppendFrom("ham one", "admin:bob"))
+
+		var opts options
+		opts.Files.DynamicDataPath = dir
+		opts.Samples.Revert.Source = "admin:bob"
+		opts.Samples.Revert.Since = "1h"
+		opts.Samples.DryRun = true
+		out := bytes.Buffer{}
+		require.NoError(t, revertSamples(opts, &out))
+		assert.Contains(t, out.String(), " spam admin:bob: spam one\n")
+		assert.Contains(t, out.String(), " ham admin:bob: ham one\n")
+		assert.NotContains(t, out.String(), "spam two")
+
+		opts.Samples.DryRun = false
+		require.NoError(t, revertSamples(opts, &out))
+		data, err := os.ReadFile(filepath.Join(dir, dynamicSpamFile))
+		require.NoError(t, err)
+		assert.Equal(t, "spam two\n", string(data))
+		data, err = os.ReadFile(filepath.Join(dir, dynamicHamFile))
+		require.NoError(t, err)
+		assert.Equal(t, "", string(data))
+	})
+
+	t.Run("db", func(t *testing.T) {
+		dir := t.TempDir()
+		db, err := storage.NewSqliteDB(filepath.Join(dir, dataFile))
+		require.NoError(t, err)
+		samples, err := storage.NewSamples(db)
+		require.NoError(t, err)
+		require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginUser, "api:basic", "spam one"))
+		require.NoError(t, samples.Add(storage.SampleTypeHam, storage.SampleOriginUser, "api:basic", "ham one"))
+		require.NoError(t, samples.Add(storage.SampleTypeSpam, storage.SampleOriginUser, "admin:bob", "spam two"))
+		require.NoError(t, db.Close())
+
+		var opts options
+		opts.Files.DynamicDataPath = dir
+		opts.Files.SamplesStorage = "db"
+		opts.Samples.Revert.Source = "api"
+		opts.Samples.DryRun = true
+		out := bytes.Buffer{}
+		require.NoError(t, revertSamples(opts, &out))
+		assert.Contains(t, out.String(), " spam api:basic: spam one\n")
+		assert.Contains(t, out.String(), " ham api:basic: ham one\n")
+		assert.NotContains(t, out.String(), "spam two")
+
+		opts.Samples.DryRun = false
+		require.NoError(t, revertSamples(opts, &out))
+		db, err = storage.NewSqliteDB(filepath.Join(dir, dataFile))
+		require.NoError(t, err)
+		defer db.Close()
+		samples, err = storage.NewSamples(db)
+		require.NoError(t, err)
+		count, err := samples.Count(storage.SampleTypeSpam, storage.SampleOriginAny)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		count, err = samples.Count(storage.SampleTypeHam, storage.SampleOriginAny)
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("invalid since", func(t *testing.T) {
+		var opts options
+		opts.Files.DynamicDataPath = t.TempDir()
+		opts.Samples.Revert.Source = "admin"
+		opts.Samples.Revert.Since = "yesterday"
+		require.Error(t, revertSamples(opts, &bytes.Buffer{}))
+	})
+}
+
+func Test_parseSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		inp     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2024-05-01T00:00:00Z", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"7d", now.Add(-7 * 24 * time.Hour), false},
+		{"-1h", time.Time{}, true},
+		{"bad", time.Time{}, true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.inp, func(t *testing.T) {
+			res, err := parseSince(tt.inp, now)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// maxScamsFeedSize is the max size of the feed of scam patterns and its signature
+const maxScamsFeedSize = 1024 * 1024
+
+// scamsDetector is a detector with scam patterns, updated by the feed
+type scamsDetector interface {
+	LoadScamPatterns(p lib.ScamPatterns) error
+	ScamPatternsVersion() int
+}
+
+// scamsFeed updates scam patterns of the detector from the remote feed, signed by its publisher. The feed is
+// json of lib.ScamPatterns at url, and base64 ed25519 signature of it at url with ".sig" suffix. Patterns
+// of the feed are loaded only if their version is newer than loaded ones, i.e. the built-in patterns.
+type scamsFeed struct {
+	url    string
+	key    ed25519.PublicKey
+	client *http.Client
+}
+
+// makeScamsFeed makes the feed of scam patterns, if set
+func makeScamsFeed(opts options) (*scamsFeed, error) {
+	if opts.Checks.ScamsFeed == "" {
+		return nil, nil
+	}
+	key, err := parseScamsKey(opts.Checks.ScamsKey)
+	if err != nil {
+		return nil, err
+	}
+	return &scamsFeed{url: opts.Checks.ScamsFeed, key: key, client: makeHTTPClient(30*time.Second, "")}, nil
+}
+
+// parseScamsKey parses base64 ed25519 public key of the feed of scam patterns
+func parseScamsKey(s string) (ed25519.PublicKey, error) {
+	if s == "" {
+		return nil, fmt.Errorf("no public key of scams feed")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key of scams feed, expected base64 of %d bytes", ed25519.PublicKeySize)
+	}
+	return key, nil
+}
+
+// Run updates scam patterns on start and every interval, till context is canceled. Failures are logged,
+// and the loaded patterns are kept.
+func (f *scamsFeed) Run(ctx context.Context, interval time.Duration, d scamsDetector) {
+	log.Printf("[INFO] scam patterns updated from %s every %v", f.url, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := f.update(ctx, d); err != nil && ctx.Err() == nil {
+			log.Printf("[WARN] scam patterns not updated, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update loads patterns of the feed to the detector, if signed by the publisher and newer than loaded ones
+func (f *scamsFeed) update(ctx context.Context, d scamsDetector) error {
+	data, err := f.get(ctx, f.url)
+	if err != nil {
+		return err
+	}
+	sigData, err := f.get(ctx, f.url+".sig")
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return fmt.Errorf("can't decode signature of scams feed, %w", err)
+	}
+	patterns, err := lib.VerifyScamPatterns(data, sig, f.key)
+	if err != nil {
+		return err
+	}
+	if current := d.ScamPatternsVersion(); patterns.Version <= current {
+		log.Printf("[DEBUG] scam patterns of feed, version %d, not newer than %d", patterns.Version, current)
+		return nil
+	}
+	if err := d.LoadScamPatterns(patterns); err != nil {
+		return fmt.Errorf("can't load scam patterns of feed, %w", err)
+	}
+	log.Printf("[INFO] scam patterns updated to version %d from %s", patterns.Version, f.url)
+	return nil
+}
+
+func (f *scamsFeed) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("can't make request to %s, %w", url, err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't get %s, %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't get %s, status %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxScamsFeedSize))
+	if err != nil {
+		return nil, fmt.Errorf("can't read %s, %w", url, err)
+	}
+	return data, nil
+}
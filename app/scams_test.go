@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestScamsFeed_update(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	data := []byte(`{"version": 100, "patterns": [{"name": "crypto bot", "language": "en", "patterns": ["trading bot pays"]}]}`)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/scams.json":
+			_, _ = w.Write(data)
+		case "/scams.json.sig":
+			_, _ = w.Write([]byte(sig + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	var opts options
+	opts.Checks.ScamsFeed = ts.URL + "/scams.json"
+	opts.Checks.ScamsKey = base64.StdEncoding.EncodeToString(pub)
+	feed, err := makeScamsFeed(opts)
+	require.NoError(t, err)
+
+	d := lib.NewDetector(lib.Config{MaxAllowedEmoji: -1})
+	require.NoError(t, d.LoadScamPatterns(lib.BuiltinScamPatterns()))
+	require.NoError(t, feed.update(context.Background(), d))
+	assert.Equal(t, 100, d.ScamPatternsVersion())
+	spam, cr := d.Check("this trading bot pays 5% a day", "")
+	assert.True(t, spam)
+	assert.Equal(t, []lib.CheckResult{{Name: lib.CheckScam, Spam: true, Details: "crypto bot (en)"}}, cr)
+
+	// older or the same version is not loaded
+	require.NoError(t, d.LoadScamPatterns(lib.ScamPatterns{Version: 200, Patterns: []lib.ScamPattern{{Name: "t", Patterns: []string{"x"}}}}))
+	require.NoError(t, feed.update(context.Background(), d))
+	assert.Equal(t, 200, d.ScamPatternsVersion())
+
+	// signed by another key
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	feed.key = otherPub
+	assert.EqualError(t, feed.update(context.Background(), d), "invalid signature of scam patterns")
+
+	feed.url = ts.URL + "/missing.json"
+	assert.ErrorContains(t, feed.update(context.Background(), d), "status 404")
+	assert.Equal(t, 200, d.ScamPatternsVersion(), "patterns kept on failures")
+}
+
+func TestScamsFeed_Run(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	data := []byte(`{"version": 100, "patterns": [{"name": "test", "patterns": ["buy now"]}]}`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/scams.json.sig" {
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))))
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer ts.Close()
+
+	feed := &scamsFeed{url: ts.URL + "/scams.json", key: pub, client: http.DefaultClient}
+	d := lib.NewDetector(lib.Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		feed.Run(ctx, time.Hour, d)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return d.ScamPatternsVersion() == 100 }, time.Second, 10*time.Millisecond, "updated on start")
+	cancel()
+	<-done
+}
+
+func Test_parseScamsKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := parseScamsKey(" " + base64.StdEncoding.EncodeToString(pub) + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, pub, key)
+
+	_, err = parseScamsKey("")
+	assert.EqualError(t, err, "no public key of scams feed")
+	_, err = parseScamsKey("bad key")
+	assert.EqualError(t, err, "invalid public key of scams feed, expected base64 of 32 bytes")
+	_, err = parseScamsKey(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.ErrorContains(t, err, "invalid public key of scams feed")
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umputun/tg-spam/app/cron"
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi"
+)
+
+const (
+	scheduleSettingsName  = "schedule"       // name of rules set with webapi in the settings store
+	scheduleCheckInterval = 15 * time.Second // interval of checks of active rules
+)
+
+// settingsSchedule applies settings of scheduled rules over the base settings while the rules are active,
+// i.e. stricter thresholds at night. The base settings are the options with settings changed with webapi, and
+// settings of active rules override them, the later rule wins. When a rule ends, its settings are back to the base.
+// Rules are set by options, read-only, and with webapi, persisted in the settings store.
+type settingsSchedule struct {
+	store    *storage.Settings // nil if rules can't be set with webapi
+	location *time.Location    // timezone of cron expressions
+	now      func() time.Time
+
+	lock      sync.Mutex
+	optRules  []scheduleRule
+	apiRules  []scheduleRule
+	base      webapi.RuntimeSettings // settings without rules
+	active    []string               // names of rules active on the last check
+	activeSet bool                   // active rules were checked at least once
+}
+
+// scheduleRule is a rule of scheduled settings with parsed cron expression
+type scheduleRule struct {
+	webapi.ScheduleRule
+	cron cron.Schedule
+}
+
+// makeSettingsSchedule makes the schedule with rules of options and the ones set with webapi before, kept in the store
+func makeSettingsSchedule(opts options, store *storage.Settings) (*settingsSchedule, error) {
+	loc, err := time.LoadLocation(opts.Schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %q, %w", opts.Schedule.Timezone, err)
+	}
+	res := &settingsSchedule{store: store, location: loc, now: time.Now}
+	for _, s := range opts.Schedule.Rules {
+		rule, err := parseScheduleRule(s)
+		if err != nil {
+			return nil, err
+		}
+		if res.optRules, err = appendScheduleRule(res.optRules, rule); err != nil {
+			return nil, err
+		}
+	}
+	if store == nil {
+		return res, nil
+	}
+	data, err := store.Get(scheduleSettingsName)
+	if err != nil || data == "" {
+		return res, err
+	}
+	var rules []webapi.ScheduleRule
+	if err = json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("can't unmarshal schedule rules, %w", err)
+	}
+	for _, r := range rules {
+		r.Source = "api"
+		if res.apiRules, err = appendScheduleRule(res.apiRules, r); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// parseScheduleRule parses rule of options, set as name|cron|settings with settings in json of PUT /settings,
+// i.e. `night|* 0-6 * * *|{"min_spam_probability": 40}`
+func parseScheduleRule(s string) (webapi.ScheduleRule, error) {
+	parts := strings.SplitN(s, "|", 3)
+	if len(parts) != 3 {
+		return webapi.ScheduleRule{}, fmt.Errorf("invalid schedule rule %q, expected name|cron|settings", s)
+	}
+	res := webapi.ScheduleRule{Name: strings.TrimSpace(parts[0]), Cron: strings.TrimSpace(parts[1]), Source: "config"}
+	dec := json.NewDecoder(strings.NewReader(parts[2]))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&res.Settings); err != nil {
+		return webapi.ScheduleRule{}, fmt.Errorf("invalid settings of schedule rule %q, %w", res.Name, err)
+	}
+	return res, nil
+}
+
+// appendScheduleRule validates the rule and appends it with parsed cron expression
+func appendScheduleRule(rules []scheduleRule, r webapi.ScheduleRule) ([]scheduleRule, error) {
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid schedule rule, %w", err)
+	}
+	c, err := cron.Parse(r.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule rule, %w", err)
+	}
+	return append(rules, scheduleRule{ScheduleRule: r, cron: c}), nil
+}
+
+// Rules returns rules of options and the ones set with webapi, with names of rules active on the last check
+func (s *settingsSchedule) Rules() (rules []webapi.ScheduleRule, active []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rules = []webapi.ScheduleRule{}
+	for _, r := range append(slices.Clip(s.optRules), s.apiRules...) {
+		rules = append(rules, r.ScheduleRule)
+	}
+	return rules, append([]string{}, s.active...)
+}
+
+// SetRules replaces rules set with webapi and persists them. Names of rules should be unique, including
+// rules of options. The rules are applied on the next check.
+func (s *settingsSchedule) SetRules(rules []webapi.ScheduleRule) error {
+	if s.store == nil {
+		return fmt.Errorf("no store of schedule rules")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := []scheduleRule{}
+	for _, r := range rules {
+		if slices.ContainsFunc(s.optRules, func(o scheduleRule) bool { return o.Name == r.Name }) {
+			return fmt.Errorf("rule %q is set by options", r.Name)
+		}
+		r.Source = "api"
+		var err error
+		if res, err = appendScheduleRule(res, r); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("can't marshal schedule rules, %w", err)
+	}
+	if err = s.store.Set(scheduleSettingsName, string(data)); err != nil {
+		return fmt.Errorf("can't save schedule rules, %w", err)
+	}
+	s.apiRules = res
+	s.activeSet = false // applied on the next check, even if the same names are active
+	return nil
+}
+
+// Base merges the changed settings into the base settings and returns the settings to apply, with settings
+// of active rules overriding them
+func (s *settingsSchedule) Base(upd webapi.RuntimeSettings) webapi.RuntimeSettings {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.base = s.base.Merge(upd)
+	return s.effective(s.activeRules())
+}
+
+// check returns the settings to apply and true if the set of active rules changed since the last check
+func (s *settingsSchedule) check() (webapi.RuntimeSettings, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rules := s.activeRules()
+	names := make([]string, 0, len(rules))
+	for _, r := range rules {
+		names = append(names, r.Name)
+	}
+	if s.activeSet && slices.Equal(names, s.active) {
+		return webapi.RuntimeSettings{}, false
+	}
+	if !slices.Equal(names, s.active) {
+		log.Printf("[INFO] schedule rules active: %q, were: %q", names, s.active)
+	}
+	s.active, s.activeSet = names, true
+	return s.effective(rules), true
+}
+
+// Run checks active rules on start and every 15s, till context is canceled, and applies the settings
+// if the set of active rules changed
+func (s *settingsSchedule) Run(ctx context.Context, apply func(webapi.RuntimeSettings)) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		if rs, changed := s.check(); changed {
+			apply(rs)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// activeRules returns rules matching the current time, rules of options first
+func (s *settingsSchedule) activeRules() []scheduleRule {
+	now := s.now().In(s.location)
+	res := []scheduleRule{}
+	for _, r := range append(slices.Clip(s.optRules), s.apiRules...) {
+		if r.cron.Match(now) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// effective returns the base settings with settings of the rules merged over them
+func (s *settingsSchedule) effective(rules []scheduleRule) webapi.RuntimeSettings {
+	res := s.base
+	for _, r := range rules {
+		res = res.Merge(r.Settings)
+	}
+	return res
+}
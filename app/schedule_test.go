@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi"
+)
+
+func TestSettingsSchedule(t *testing.T) {
+	db, err := storage.NewSqliteDB(filepath.Join(t.TempDir(), "tg-spam.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := storage.NewSettings(db)
+	require.NoError(t, err)
+
+	var opts options
+	opts.Schedule.Timezone = "Europe/Berlin"
+	opts.Schedule.Rules = []string{`night|* 0-6 * * *|{"min_spam_probability": 40, "max_emoji": 0}`}
+	s, err := makeSettingsSchedule(opts, store)
+	require.NoError(t, err)
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, loc) // friday noon
+	s.now = func() time.Time { return now }
+
+	probability, maxEmoji, threshold := 50.0, 2, 0.5
+	base := s.Base(webapi.RuntimeSettings{MinSpamProbability: &probability, MaxEmoji: &maxEmoji, SimilarityThreshold: &threshold})
+	assert.Equal(t, 50.0, *base.MinSpamProbability, "no active rules")
+
+	rs, changed := s.check()
+	assert.True(t, changed, "the first check applies settings")
+	assert.Equal(t, base, rs)
+	_, changed = s.check()
+	assert.False(t, changed)
+
+	now = time.Date(2024, 5, 10, 3, 0, 0, 0, time.UTC) // 5am in Berlin
+	rs, changed = s.check()
+	require.True(t, changed)
+	assert.Equal(t, 40.0, *rs.MinSpamProbability)
+	assert.Equal(t, 0, *rs.MaxEmoji)
+	assert.Equal(t, 0.5, *rs.SimilarityThreshold, "not set by the rule")
+	rules, active := s.Rules()
+	assert.Equal(t, []string{"night"}, active)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "config", rules[0].Source)
+
+	threshold = 0.7
+	rs = s.Base(webapi.RuntimeSettings{SimilarityThreshold: &threshold, MinSpamProbability: &probability})
+	assert.Equal(t, 0.7, *rs.SimilarityThreshold, "base changed")
+	assert.Equal(t, 40.0, *rs.MinSpamProbability, "active rule overrides base change")
+
+	// rule set with api, later rule wins
+	strict := 30.0
+	require.NoError(t, s.SetRules([]webapi.ScheduleRule{{Name: "raid", Cron: "* * * * 5",
+		Settings: webapi.RuntimeSettings{MinSpamProbability: &strict}}}))
+	rs, changed = s.check()
+	require.True(t, changed)
+	assert.Equal(t, 30.0, *rs.MinSpamProbability)
+	_, active = s.Rules()
+	assert.Equal(t, []string{"night", "raid"}, active)
+
+	err = s.SetRules([]webapi.ScheduleRule{{Name: "night", Cron: "* * * * *", Settings: webapi.RuntimeSettings{MaxEmoji: &maxEmoji}}})
+	assert.ErrorContains(t, err, `rule "night" is set by options`)
+	err = s.SetRules([]webapi.ScheduleRule{{Name: "bad", Cron: "* * *", Settings: webapi.RuntimeSettings{MaxEmoji: &maxEmoji}}})
+	assert.ErrorContains(t, err, "invalid schedule rule")
+
+	// rules set with api are persisted
+	s2, err := makeSettingsSchedule(opts, store)
+	require.NoError(t, err)
+	rules, _ = s2.Rules()
+	require.Len(t, rules, 2)
+	assert.Equal(t, "raid", rules[1].Name)
+	assert.Equal(t, "api", rules[1].Source)
+
+	// rules ended, back to base
+	now = time.Date(2024, 5, 11, 12, 0, 0, 0, loc)
+	rs, changed = s.check()
+	require.True(t, changed)
+	assert.Equal(t, 50.0, *rs.MinSpamProbability)
+	assert.Equal(t, 2, *rs.MaxEmoji)
+	assert.Equal(t, 0.7, *rs.SimilarityThreshold)
+
+	t.Run("run", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		applied := make(chan webapi.RuntimeSettings, 1)
+		s.activeSet = false
+		go s.Run(ctx, func(rs webapi.RuntimeSettings) { applied <- rs; cancel() })
+		select {
+		case rs := <-applied:
+			assert.Equal(t, 50.0, *rs.MinSpamProbability)
+		case <-time.After(time.Second):
+			t.Fatal("settings not applied on start")
+		}
+	})
+}
+
+func Test_parseScheduleRule(t *testing.T) {
+	tbl := []struct {
+		in      string
+		name    string
+		cron    string
+		wantErr string
+	}{
+		{in: `night| * 0-6 * * * |{"min_spam_probability": 40}`, name: "night", cron: "* 0-6 * * *"},
+		{in: `event|0-59 18 * * 5|{"spam_msg": "a|b"}`, name: "event", cron: "0-59 18 * * 5"},
+		{in: `night|* 0-6 * * *`, wantErr: "expected name|cron|settings"},
+		{in: `night|* 0-6 * * *|{"min_spam_probability": "high"}`, wantErr: `invalid settings of schedule rule "night"`},
+		{in: `night|* 0-6 * * *|{"first_message_only": true}`, wantErr: `invalid settings of schedule rule "night"`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.in, func(t *testing.T) {
+			res, err := parseScheduleRule(tt.in)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.name, res.Name)
+			assert.Equal(t, tt.cron, res.Cron)
+			assert.Equal(t, "config", res.Source)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// DenylistStore is a denylist of the instance, implemented by storage.Denylist
+type DenylistStore interface {
+	Add(userID int64, msg string) error
+	Remove(userID int64) error
+	Check(userID int64, msg string) (storage.DenylistEntry, bool)
+}
+
+// Denylist is a denylist of spammers and their messages in redis, shared by instances. Entries are written to the
+// local denylist too, if set, to be exported to peers, and expire in redis after ttl, the same as imported from peers.
+// Entries of the user are indexed, so they are removed together on unban by any instance. Only entries imported from
+// peers are checked with the local denylist, own entries of the instance are checked in redis, as they could be
+// removed by other instances.
+type Denylist struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+	local  DenylistStore // optional
+}
+
+// NewDenylist makes denylist in redis with keys prefixed by the prefix, entries expire after ttl,
+// changes are written to the local denylist too, if set
+func NewDenylist(client redis.UniversalClient, prefix string, ttl time.Duration, local DenylistStore) *Denylist {
+	return &Denylist{client: client, prefix: prefix, ttl: ttl, local: local}
+}
+
+// Add lists the banned user and the spam message, the same entries as storage.Denylist lists
+func (d *Denylist) Add(userID int64, msg string) error {
+	if d.local != nil {
+		if err := d.local.Add(userID, msg); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	entries := storage.DenylistEntries(userID, msg, time.Now().UTC())
+	_, err := d.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range entries {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return fmt.Errorf("can't marshal %s entry, %w", e.Kind, err)
+			}
+			key := d.key(e.Kind, e.Value)
+			pipe.Set(ctx, key, data, d.ttl)
+			pipe.SAdd(ctx, d.userKey(userID), key)
+		}
+		pipe.Expire(ctx, d.userKey(userID), d.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't add user %d to shared denylist, %w", userID, err)
+	}
+	return nil
+}
+
+// Remove removes all entries of the user, i.e. on unban
+func (d *Denylist) Remove(userID int64) error {
+	if d.local != nil {
+		if err := d.local.Remove(userID); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	keys, err := d.client.SMembers(ctx, d.userKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("can't get entries of user %d, %w", userID, err)
+	}
+	if err := d.client.Del(ctx, append(keys, d.userKey(userID))...).Err(); err != nil {
+		return fmt.Errorf("can't remove user %d from shared denylist, %w", userID, err)
+	}
+	return nil
+}
+
+// Check returns the entry listing the user or the message, false if neither is listed. Entries imported from peers
+// are checked first. The user entry is preferred over the message ones, and exact match of the message over
+// the normalized one, the same as by storage.Denylist.
+func (d *Denylist) Check(userID int64, msg string) (storage.DenylistEntry, bool) {
+	if d.local != nil {
+		if entry, ok := d.local.Check(userID, msg); ok && entry.Source != "" {
+			return entry, true
+		}
+	}
+	entries := storage.DenylistEntries(userID, msg, time.Time{})
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, d.key(e.Kind, e.Value))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	vals, err := d.client.MGet(ctx, keys...).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("[WARN] can't check user %d with shared denylist, %v", userID, err)
+		return storage.DenylistEntry{}, false
+	}
+	for _, v := range vals {
+		data, ok := v.(string)
+		if !ok {
+			continue // not listed
+		}
+		var entry storage.DenylistEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			log.Printf("[WARN] can't unmarshal denylist entry, %v", err)
+			continue
+		}
+		return entry, true
+	}
+	return storage.DenylistEntry{}, false
+}
+
+// key returns redis key of the entry
+func (d *Denylist) key(kind storage.DenylistKind, value string) string {
+	return d.prefix + "denylist:" + string(kind) + ":" + value
+}
+
+// userKey returns redis key of the set of entries of the user
+func (d *Denylist) userKey(userID int64) string {
+	return d.prefix + "denylist-user:" + strconv.FormatInt(userID, 10)
+}
@@ -0,0 +1,83 @@
+package shared
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func TestDenylist(t *testing.T) {
+	client := testClient(t)
+	local := &localDenylist{}
+	d1 := NewDenylist(client, "test:", time.Hour, local)
+	d2 := NewDenylist(client, "test:", time.Hour, nil)
+	spam := "buy cheap followers now, only today 123"
+
+	require.NoError(t, d1.Add(1, spam))
+	assert.Equal(t, []int64{1}, local.added, "added to local denylist")
+
+	entry, ok := d2.Check(1, "hello")
+	require.True(t, ok, "user listed")
+	assert.Equal(t, storage.DenylistUser, entry.Kind)
+	assert.Equal(t, int64(1), entry.UserID)
+
+	entry, ok = d2.Check(2, spam)
+	require.True(t, ok, "message listed")
+	assert.Equal(t, storage.DenylistHash, entry.Kind)
+
+	entry, ok = d2.Check(2, strings.Replace(spam, "123", "456", 1))
+	require.True(t, ok, "normalized message listed")
+	assert.Equal(t, storage.DenylistNorm, entry.Kind)
+
+	_, ok = d2.Check(2, "hello")
+	assert.False(t, ok)
+
+	ttl := client.TTL(context.Background(), "test:denylist:user:1").Val()
+	assert.True(t, ttl > 0 && ttl <= time.Hour, "entries expire, %v", ttl)
+
+	require.NoError(t, d2.Remove(1))
+	_, ok = d1.Check(1, spam)
+	assert.False(t, ok, "all entries of the user removed")
+	assert.Empty(t, client.Keys(context.Background(), "test:*").Val())
+}
+
+func TestDenylist_CheckLocal(t *testing.T) {
+	local := &localDenylist{imported: map[int64]bool{10: true}, own: map[int64]bool{20: true}}
+	d := NewDenylist(testClient(t), "test:", time.Hour, local)
+	entry, ok := d.Check(10, "hello")
+	require.True(t, ok, "imported from peer")
+	assert.Equal(t, "https://peer", entry.Source)
+
+	_, ok = d.Check(20, "hello")
+	assert.False(t, ok, "own entry of the instance is not listed in redis, i.e. removed by other instance")
+}
+
+// localDenylist records users added to local denylist, and lists users imported from peer and own ones
+type localDenylist struct {
+	added    []int64
+	imported map[int64]bool
+	own      map[int64]bool
+}
+
+func (l *localDenylist) Add(userID int64, _ string) error {
+	l.added = append(l.added, userID)
+	return nil
+}
+
+func (l *localDenylist) Remove(int64) error { return nil }
+
+func (l *localDenylist) Check(userID int64, _ string) (storage.DenylistEntry, bool) {
+	switch {
+	case l.imported[userID]:
+		return storage.DenylistEntry{Kind: storage.DenylistUser, UserID: userID, Source: "https://peer"}, true
+	case l.own[userID]:
+		return storage.DenylistEntry{Kind: storage.DenylistUser, UserID: userID}, true
+	}
+	return storage.DenylistEntry{}, false
+}
@@ -0,0 +1,53 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Flood counts bot commands of users in redis, shared by instances, so flood of commands sent to several instances
+// is limited as a whole. Commands of the user are kept in a sorted set by time, expired with the window.
+type Flood struct {
+	client redis.UniversalClient
+	prefix string
+	id     string // id of the instance, to keep commands of instances at the same time apart
+}
+
+// NewFlood makes counter of commands in redis with keys prefixed by the prefix
+func NewFlood(client redis.UniversalClient, prefix string) *Flood {
+	return &Flood{client: client, prefix: prefix, id: instanceID()}
+}
+
+// Count records the command of the user at the time, and returns the number of commands in the window till the time
+func (f *Flood) Count(userID int64, at time.Time, window time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	key := f.prefix + "flood:" + strconv.FormatInt(userID, 10)
+	var card *redis.IntCmd
+	_, err := f.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(at.Add(-window).UnixNano(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(at.UnixNano()), Member: f.id + ":" + strconv.FormatInt(at.UnixNano(), 10)})
+		card = pipe.ZCard(ctx, key)
+		pipe.PExpire(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("can't count commands of user %d, %w", userID, err)
+	}
+	return int(card.Val()), nil
+}
+
+// Report returns true if the user is not reported in the window yet, by any instance
+func (f *Flood) Report(userID int64, window time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ok, err := f.client.SetNX(ctx, f.prefix+"flood-reported:"+strconv.FormatInt(userID, 10), 1, window).Result()
+	if err != nil {
+		return false, fmt.Errorf("can't mark user %d reported, %w", userID, err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlood_Count(t *testing.T) {
+	client := testClient(t)
+	f1, f2 := NewFlood(client, "test:"), NewFlood(client, "test:")
+	now := time.Now()
+
+	n, err := f1.Count(1, now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = f2.Count(1, now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "commands of other instance at the same time counted")
+	n, err = f2.Count(2, now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "other user")
+
+	n, err = f1.Count(1, now.Add(time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "window includes its start")
+	n, err = f2.Count(1, now.Add(90*time.Second), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "old commands dropped")
+
+	ttl := client.PTTL(context.Background(), "test:flood:1").Val()
+	assert.True(t, ttl > 0 && ttl <= time.Minute, "expires with the window, %v", ttl)
+}
+
+func TestFlood_Report(t *testing.T) {
+	client := testClient(t)
+	f1, f2 := NewFlood(client, "test:"), NewFlood(client, "test:")
+
+	ok, err := f1.Report(1, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = f2.Report(1, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "reported by other instance")
+	ok, err = f2.Report(2, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
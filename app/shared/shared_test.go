@@ -0,0 +1,27 @@
+package shared
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClient(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client, err := NewClient(context.Background(), "redis://"+srv.Addr()+"/0")
+	require.NoError(t, err)
+	assert.NoError(t, client.Close())
+
+	_, err = NewClient(context.Background(), "http://example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid redis url")
+
+	addr := srv.Addr()
+	srv.Close()
+	_, err = NewClient(context.Background(), "redis://"+addr)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't connect to redis")
+}
@@ -0,0 +1,188 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// Users is a storage of approved users of the group in redis, shared by instances. It is set as lib.UserStorage of
+// the detector: changes are written to the local storage, i.e. the database, if set, and queued to redis, flushed by
+// Run in batches, as the detector writes the user on each message. Users unknown to the detector are loaded from redis
+// with Load, so users approved by one instance are approved by others on their next message. Removals are published
+// to other instances of the group, and removed from their detectors. Users are kept in redis for ttl since their last
+// write, and stay approved in the local storage of instances which have seen them.
+type Users struct {
+	client redis.UniversalClient
+	prefix string
+	gid    string          // group of the instance, users of groups sharing the prefix are kept apart
+	ttl    time.Duration   // time to keep the user since the last write, forever if 0
+	local  lib.UserStorage // optional
+	id     string          // id of the instance, own removals are not applied again
+
+	lock    sync.Mutex
+	pending map[string]*lib.ApprovedUser // users to write, nil for removed ones
+}
+
+// NewUsers makes storage of approved users of the group in redis with keys prefixed by the prefix, kept for ttl
+// since the last write. Changes are written to the local storage too, if set.
+func NewUsers(client redis.UniversalClient, prefix, gid string, ttl time.Duration, local lib.UserStorage) *Users {
+	return &Users{client: client, prefix: prefix, gid: gid, ttl: ttl, local: local, id: instanceID(),
+		pending: map[string]*lib.ApprovedUser{}}
+}
+
+// Write writes the user to the local storage and queues it to redis
+func (u *Users) Write(user lib.ApprovedUser) error {
+	if u.local != nil {
+		if err := u.local.Write(user); err != nil {
+			return err
+		}
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.pending[user.UserID] = &user
+	return nil
+}
+
+// Delete deletes the user from the local storage and queues the removal to redis
+func (u *Users) Delete(userID string) error {
+	if u.local != nil {
+		if err := u.local.Delete(userID); err != nil {
+			return err
+		}
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.pending[userID] = nil
+	return nil
+}
+
+// Load loads the user from redis, ok is false if the user is not approved by any instance.
+// The user queued by this instance is returned as is.
+func (u *Users) Load(userID string) (user lib.ApprovedUser, ok bool, err error) {
+	u.lock.Lock()
+	pending, queued := u.pending[userID]
+	u.lock.Unlock()
+	if queued {
+		if pending == nil {
+			return lib.ApprovedUser{}, false, nil
+		}
+		return *pending, true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	data, err := u.client.Get(ctx, u.key(userID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return lib.ApprovedUser{}, false, nil
+	}
+	if err != nil {
+		return lib.ApprovedUser{}, false, fmt.Errorf("can't get user %s, %w", userID, err)
+	}
+	if err = json.Unmarshal(data, &user); err != nil {
+		return lib.ApprovedUser{}, false, fmt.Errorf("can't unmarshal user %s, %w", userID, err)
+	}
+	return user, true, nil
+}
+
+// Run flushes queued changes to redis every interval, and removes users removed by other instances with the remove
+// function, i.e. Detector.RemoveApprovedUsers, till the context is canceled. Queued changes are flushed on exit.
+func (u *Users) Run(ctx context.Context, interval time.Duration, remove func(ids ...string)) {
+	sub := u.client.Subscribe(ctx, u.channel())
+	defer sub.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			if err := u.Flush(flushCtx); err != nil {
+				log.Printf("[WARN] can't flush approved users to redis, %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := u.Flush(ctx); err != nil {
+				log.Printf("[WARN] can't flush approved users to redis, %v", err)
+			}
+		case msg, ok := <-sub.Channel():
+			if !ok {
+				return
+			}
+			id, userID, found := strings.Cut(msg.Payload, ":")
+			if !found || id == u.id {
+				continue
+			}
+			log.Printf("[DEBUG] approved user %s removed by other instance", userID)
+			remove(userID)
+		}
+	}
+}
+
+// Flush writes queued changes to redis in one pipeline. Removals are published to other instances, only if the user
+// was stored, so removals applied by other instances are not published again. Failed changes are queued again,
+// unless changed since.
+func (u *Users) Flush(ctx context.Context) error {
+	u.lock.Lock()
+	pending := u.pending
+	u.pending = map[string]*lib.ApprovedUser{}
+	u.lock.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	removed := map[string]*redis.IntCmd{}
+	_, err := u.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for id, user := range pending {
+			if user == nil {
+				removed[id] = pipe.Del(ctx, u.key(id))
+				continue
+			}
+			data, err := json.Marshal(user)
+			if err != nil {
+				return fmt.Errorf("can't marshal user %s, %w", id, err)
+			}
+			pipe.Set(ctx, u.key(id), data, u.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		u.lock.Lock()
+		for id, user := range pending {
+			if _, changed := u.pending[id]; !changed {
+				u.pending[id] = user
+			}
+		}
+		u.lock.Unlock()
+		return fmt.Errorf("can't write %d users, %w", len(pending), err)
+	}
+
+	for id, cmd := range removed {
+		if cmd.Val() == 0 {
+			continue
+		}
+		if err := u.client.Publish(ctx, u.channel(), u.id+":"+id).Err(); err != nil {
+			log.Printf("[WARN] can't publish removal of user %s, %v", id, err)
+		}
+	}
+	return nil
+}
+
+// key returns redis key of the user of the group
+func (u *Users) key(userID string) string {
+	return u.prefix + "user:" + u.gid + ":" + userID
+}
+
+// channel returns redis channel of removals of users of the group
+func (u *Users) channel() string {
+	return u.prefix + "users-removed:" + u.gid
+}
@@ -0,0 +1,219 @@
+package shared
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestUsers_WriteLoad(t *testing.T) {
+	client := testClient(t)
+	local := &localUsers{}
+	u1 := NewUsers(client, "test:", "group", time.Hour, local)
+	u2 := NewUsers(client, "test:", "group", time.Hour, nil)
+
+	ts := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, u1.Write(lib.ApprovedUser{UserID: "123", UserName: "john", Count: 3, FirstSeen: ts, LastSeen: ts}))
+	assert.Len(t, local.written, 1, "written to local storage")
+
+	user, ok, err := u1.Load("123")
+	require.NoError(t, err)
+	assert.True(t, ok, "queued user loaded by the same instance")
+	assert.Equal(t, "john", user.UserName)
+
+	_, ok, err = u2.Load("123")
+	require.NoError(t, err)
+	assert.False(t, ok, "not flushed yet")
+
+	require.NoError(t, u1.Flush(context.Background()))
+	user, ok, err = u2.Load("123")
+	require.NoError(t, err)
+	assert.True(t, ok, "loaded by other instance")
+	assert.Equal(t, lib.ApprovedUser{UserID: "123", UserName: "john", Count: 3, FirstSeen: ts, LastSeen: ts}, user)
+	assert.Equal(t, time.Hour, client.TTL(context.Background(), "test:user:group:123").Val(), "kept for ttl")
+
+	require.NoError(t, u1.Delete("123"))
+	assert.Equal(t, []string{"123"}, local.deleted)
+	_, ok, err = u1.Load("123")
+	require.NoError(t, err)
+	assert.False(t, ok, "queued removal")
+	require.NoError(t, u1.Flush(context.Background()))
+	_, ok, err = u2.Load("123")
+	require.NoError(t, err)
+	assert.False(t, ok, "removed")
+}
+
+func TestUsers_TTL(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+	u1 := NewUsers(client, "test:", "group", time.Hour, nil)
+	u2 := NewUsers(client, "test:", "group", time.Hour, nil)
+
+	require.NoError(t, u1.Write(lib.ApprovedUser{UserID: "1"}))
+	require.NoError(t, u1.Flush(context.Background()))
+	srv.FastForward(50 * time.Minute)
+	require.NoError(t, u1.Write(lib.ApprovedUser{UserID: "1", Count: 2}))
+	require.NoError(t, u1.Flush(context.Background()))
+	assert.Equal(t, time.Hour, srv.TTL("test:user:group:1"), "refreshed on write")
+
+	srv.FastForward(50 * time.Minute)
+	_, ok, err := u2.Load("1")
+	require.NoError(t, err)
+	assert.True(t, ok, "kept after the write")
+	srv.FastForward(20 * time.Minute)
+	_, ok, err = u2.Load("1")
+	require.NoError(t, err)
+	assert.False(t, ok, "expired")
+
+	forever := NewUsers(client, "test:", "group", 0, nil)
+	require.NoError(t, forever.Write(lib.ApprovedUser{UserID: "2"}))
+	require.NoError(t, forever.Flush(context.Background()))
+	assert.Zero(t, srv.TTL("test:user:group:2"), "kept forever without ttl")
+}
+
+func TestUsers_Groups(t *testing.T) {
+	client := testClient(t)
+	chess := NewUsers(client, "test:", "chess", time.Hour, nil)
+	golang := NewUsers(client, "test:", "golang", time.Hour, nil)
+
+	require.NoError(t, chess.Write(lib.ApprovedUser{UserID: "1", UserName: "john"}))
+	require.NoError(t, chess.Flush(context.Background()))
+	_, ok, err := golang.Load("1")
+	require.NoError(t, err)
+	assert.False(t, ok, "approved in other group")
+	user, ok, err := NewUsers(client, "test:", "chess", time.Hour, nil).Load("1")
+	require.NoError(t, err)
+	assert.True(t, ok, "approved in the same group")
+	assert.Equal(t, "john", user.UserName)
+
+	var lock sync.Mutex
+	var removed []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		golang.Run(ctx, 10*time.Millisecond, func(ids ...string) {
+			lock.Lock()
+			defer lock.Unlock()
+			removed = append(removed, ids...)
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, golang.Write(lib.ApprovedUser{UserID: "1", UserName: "john"}))
+	require.NoError(t, golang.Flush(context.Background()))
+	require.NoError(t, chess.Delete("1"))
+	require.NoError(t, chess.Flush(context.Background()))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Empty(t, removed, "removal in other group not applied")
+	_, ok, err = golang.Load("1")
+	require.NoError(t, err)
+	assert.True(t, ok, "kept in other group")
+}
+
+func TestUsers_FlushFailed(t *testing.T) {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+	u := NewUsers(client, "test:", "group", time.Hour, nil)
+
+	require.NoError(t, u.Write(lib.ApprovedUser{UserID: "1"}))
+	srv.SetError("failed")
+	require.Error(t, u.Flush(context.Background()))
+	srv.SetError("")
+
+	require.NoError(t, u.Flush(context.Background()), "queued again")
+	assert.True(t, srv.Exists("test:user:group:1"))
+}
+
+func TestUsers_Run(t *testing.T) {
+	client := testClient(t)
+	u1 := NewUsers(client, "test:", "group", time.Hour, nil)
+	u2 := NewUsers(client, "test:", "group", time.Hour, nil)
+
+	var lock sync.Mutex
+	var removed1, removed2 []string
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		u1.Run(ctx, 10*time.Millisecond, func(ids ...string) {
+			lock.Lock()
+			defer lock.Unlock()
+			removed1 = append(removed1, ids...)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		u2.Run(ctx, 10*time.Millisecond, func(ids ...string) {
+			lock.Lock()
+			defer lock.Unlock()
+			removed2 = append(removed2, ids...)
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, u1.Write(lib.ApprovedUser{UserID: "1"}))
+	require.NoError(t, u1.Write(lib.ApprovedUser{UserID: "2"}))
+	assert.Eventually(t, func() bool {
+		_, ok, err := u2.Load("2")
+		return err == nil && ok
+	}, time.Second, 10*time.Millisecond, "flushed in background")
+
+	require.NoError(t, u1.Delete("1"))
+	require.NoError(t, u1.Delete("3")) // not stored, not published
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(removed2) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, u1.Write(lib.ApprovedUser{UserID: "4"}))
+	cancel()
+	wg.Wait()
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"1"}, removed2, "removed by other instance")
+	assert.Empty(t, removed1, "own removals skipped")
+	_, ok, err := u2.Load("4")
+	require.NoError(t, err)
+	assert.True(t, ok, "flushed on exit")
+}
+
+// testClient makes client of in-memory redis, closed with the test
+func testClient(t *testing.T) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// localUsers records changes of local storage of approved users
+type localUsers struct {
+	written []lib.ApprovedUser
+	deleted []string
+}
+
+func (l *localUsers) Write(au lib.ApprovedUser) error {
+	l.written = append(l.written, au)
+	return nil
+}
+
+func (l *localUsers) Delete(id string) error {
+	l.deleted = append(l.deleted, id)
+	return nil
+}
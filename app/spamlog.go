@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogPriority is the priority of spam log messages, notice severity of user facility
+const syslogPriority = 1<<3 | 5
+
+// syslogWriter sends each written line to syslog as a separate message. Local syslog is used if the address is empty,
+// otherwise it is set as network://host:port, i.e. udp://localhost:514 or tcp://localhost:514.
+// The connection is made on the first write and made again if a write failed.
+type syslogWriter struct {
+	network  string
+	addr     string
+	tag      string
+	hostname string
+
+	lock sync.Mutex
+	conn net.Conn
+}
+
+// newSyslogWriter makes syslog writer, the connection is not checked till the first write
+func newSyslogWriter(addr, tag string) (*syslogWriter, error) {
+	network, address, err := parseSyslogAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	return &syslogWriter{network: network, addr: address, tag: tag, hostname: hostname}, nil
+}
+
+// parseSyslogAddr parses syslog address set as network://host:port, empty address means local syslog
+func parseSyslogAddr(addr string) (network, address string, err error) {
+	if addr == "" {
+		return "", "", nil
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %q, %w", addr, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q, no host", addr)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix", "unixgram":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q, no socket path", addr)
+		}
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog address %q, network should be udp, tcp, unix or unixgram", addr)
+	}
+}
+
+// Write sends the line to syslog, the trailing new line is not a part of the message
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	msg := w.format(strings.TrimRight(string(p), "\n"))
+	if w.conn != nil {
+		if _, err := w.conn.Write(msg); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close() // try once more with a new connection, i.e. syslog restarted
+		w.conn = nil
+	}
+	conn, err := w.connect()
+	if err != nil {
+		return 0, err
+	}
+	w.conn = conn
+	if _, err = w.conn.Write(msg); err != nil {
+		return 0, fmt.Errorf("can't write to syslog, %w", err)
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to syslog
+func (w *syslogWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// format makes syslog message, in the format of local syslog daemons (RFC 3164) for local syslog,
+// and with RFC3339 timestamp and hostname for remote one
+func (w *syslogWriter) format(msg string) []byte {
+	if w.network == "" {
+		return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s\n", syslogPriority, time.Now().Format(time.Stamp), w.tag, os.Getpid(), msg))
+	}
+	return []byte(fmt.Sprintf("<%d>%s %s %s[%d]: %s\n", syslogPriority, time.Now().Format(time.RFC3339), w.hostname,
+		w.tag, os.Getpid(), msg))
+}
+
+// connect makes connection to syslog, local syslog is looked up in the usual socket paths
+func (w *syslogWriter) connect() (net.Conn, error) {
+	if w.network != "" {
+		conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("can't connect to syslog %s://%s, %w", w.network, w.addr, err)
+		}
+		return conn, nil
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("can't connect to local syslog")
+}
+
+// httpShipper sends written lines to the url in batches, with POST request of json lines. Batches are sent every
+// flush interval, or once batch size of lines is written. Lines failed to send are sent again with the next batch,
+// up to maxPending lines, older lines are dropped. Lines not sent yet are sent on close.
+type httpShipper struct {
+	url        string
+	client     *http.Client
+	batchSize  int
+	maxPending int
+
+	lock    sync.Mutex
+	pending [][]byte
+
+	flushCh chan struct{}
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// newHTTPShipper makes http shipper and starts sending batches every interval, till closed
+func newHTTPShipper(shipURL string, batchSize int, interval time.Duration, client *http.Client) *httpShipper {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &httpShipper{url: shipURL, client: client, batchSize: batchSize, maxPending: 100 * batchSize,
+		flushCh: make(chan struct{}, 1), cancel: cancel, stopped: make(chan struct{})}
+	go s.run(ctx, interval)
+	return s
+}
+
+// Write adds the line to the next batch, it doesn't wait for the batch to be sent
+func (s *httpShipper) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	s.lock.Lock()
+	s.pending = append(s.pending, append(append(make([]byte, 0, len(line)+1), line...), '\n'))
+	if dropped := len(s.pending) - s.maxPending; dropped > 0 {
+		s.pending = s.pending[dropped:]
+		log.Printf("[WARN] spam log shipping is behind, %d entries dropped", dropped)
+	}
+	full := len(s.pending) >= s.batchSize
+	s.lock.Unlock()
+	if full {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Close stops sending by interval, and sends lines not sent yet
+func (s *httpShipper) Close() error {
+	s.cancel()
+	<-s.stopped
+	return nil
+}
+
+func (s *httpShipper) run(ctx context.Context, interval time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				sent, err := s.flush()
+				if err != nil {
+					log.Printf("[WARN] can't ship spam log on exit, %v", err)
+					return
+				}
+				if sent == 0 {
+					return
+				}
+			}
+		case <-ticker.C:
+		case <-s.flushCh:
+		}
+		if _, err := s.flush(); err != nil {
+			log.Printf("[WARN] can't ship spam log, %v", err)
+		}
+	}
+}
+
+// flush sends a batch of pending lines, returns the number of sent lines. Lines failed to send are kept pending.
+func (s *httpShipper) flush() (int, error) {
+	s.lock.Lock()
+	batch := s.pending[:min(len(s.pending), s.batchSize)]
+	s.pending = s.pending[len(batch):]
+	s.lock.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := s.send(batch); err != nil {
+		s.lock.Lock()
+		s.pending = append(batch[:len(batch):len(batch)], s.pending...)
+		s.lock.Unlock()
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+func (s *httpShipper) send(batch [][]byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(bytes.Join(batch, nil)))
+	if err != nil {
+		return fmt.Errorf("can't make request, %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't send %d entries, %w", len(batch), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("can't send %d entries, status %s", len(batch), resp.Status)
+	}
+	return nil
+}
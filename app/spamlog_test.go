@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSyslogAddr(t *testing.T) {
+	tests := []struct {
+		addr, network, address, err string
+	}{
+		{addr: "", network: "", address: ""},
+		{addr: "udp://localhost:514", network: "udp", address: "localhost:514"},
+		{addr: "tcp://10.0.0.1:601", network: "tcp", address: "10.0.0.1:601"},
+		{addr: "unix:///dev/log", network: "unix", address: "/dev/log"},
+		{addr: "udp://", err: "no host"},
+		{addr: "unixgram://", err: "no socket path"},
+		{addr: "localhost:514", err: "network should be udp, tcp, unix or unixgram"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			network, address, err := parseSyslogAddr(tt.addr)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.network, network)
+			assert.Equal(t, tt.address, address)
+		})
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		wr, err := newSyslogWriter("udp://"+conn.LocalAddr().String(), "tg-spam-test")
+		require.NoError(t, err)
+		defer wr.Close()
+		n, err := wr.Write([]byte(`{"text":"spam"}` + "\n"))
+		require.NoError(t, err)
+		assert.Equal(t, 16, n)
+
+		buf := make([]byte, 1024)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err = conn.ReadFrom(buf)
+		require.NoError(t, err)
+		msg := string(buf[:n])
+		t.Log(msg)
+		assert.True(t, strings.HasPrefix(msg, "<13>"), msg)
+		assert.Contains(t, msg, " tg-spam-test[")
+		assert.True(t, strings.HasSuffix(msg, `]: {"text":"spam"}`+"\n"), msg)
+	})
+
+	t.Run("tcp reconnect", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer ln.Close()
+		lines := make(chan string, 10)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					rd := bufio.NewReader(conn)
+					for {
+						line, err := rd.ReadString('\n')
+						if err != nil {
+							return
+						}
+						lines <- line
+					}
+				}()
+			}
+		}()
+
+		wr, err := newSyslogWriter("tcp://"+ln.Addr().String(), "tg-spam")
+		require.NoError(t, err)
+		defer wr.Close()
+		for _, text := range []string{"first", "second"} {
+			_, err = wr.Write([]byte(text + "\n"))
+			require.NoError(t, err)
+			select {
+			case line := <-lines:
+				assert.True(t, strings.HasSuffix(line, "]: "+text+"\n"), line)
+			case <-time.After(time.Second):
+				t.Fatalf("%s not received", text)
+			}
+			wr.conn.Close() // broken connection, writer should reconnect for the next message
+		}
+	})
+
+	t.Run("connection failed", func(t *testing.T) {
+		wr, err := newSyslogWriter("unix:///not-existing/socket", "tg-spam")
+		require.NoError(t, err)
+		_, err = wr.Write([]byte("text\n"))
+		assert.ErrorContains(t, err, "can't connect to syslog unix:///not-existing/socket")
+	})
+}
+
+func TestHTTPShipper(t *testing.T) {
+	var lock sync.Mutex
+	var batches []string
+	fail := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		batches = append(batches, string(body))
+	}))
+	defer ts.Close()
+	received := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), batches...)
+	}
+
+	shipper := newHTTPShipper(ts.URL, 2, time.Hour, ts.Client())
+	_, err := shipper.Write([]byte("line1\n"))
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, received(), "not sent till the batch is full")
+
+	_, err = shipper.Write([]byte("line2\n"))
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, received(), "first attempt failed")
+
+	_, err = shipper.Write([]byte("line3"))
+	require.NoError(t, err)
+	_, err = shipper.Write([]byte("line4\n"))
+	require.NoError(t, err)
+	_, err = shipper.Write([]byte("line5\n"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(received()) > 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "line1\nline2\n", received()[0], "failed batch sent again")
+
+	require.NoError(t, shipper.Close())
+	assert.Equal(t, "line3\nline4\nline5\n", strings.Join(received()[1:], ""), "pending lines sent on close")
+}
+
+func TestHTTPShipper_Interval(t *testing.T) {
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received <- string(body)
+	}))
+	defer ts.Close()
+
+	shipper := newHTTPShipper(ts.URL, 100, 50*time.Millisecond, ts.Client())
+	defer shipper.Close()
+	_, err := shipper.Write([]byte("line1\n"))
+	require.NoError(t, err)
+	select {
+	case body := <-received:
+		assert.Equal(t, "line1\n", body)
+	case <-time.After(time.Second):
+		t.Fatal("batch not sent by interval")
+	}
+}
+
+func TestHTTPShipper_MaxPending(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	shipper := newHTTPShipper(ts.URL, 1, time.Hour, ts.Client())
+	shipper.maxPending = 3
+	for i := 0; i < 5; i++ {
+		_, err := shipper.Write([]byte("line\n"))
+		require.NoError(t, err)
+	}
+	shipper.lock.Lock()
+	assert.LessOrEqual(t, len(shipper.pending), 4, "older lines dropped")
+	shipper.lock.Unlock()
+	require.NoError(t, shipper.Close())
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AllowedChannelsConfig is the author of channels allowed by options, they are replaced on start
+const AllowedChannelsConfig = "config"
+
+// AllowedChannels is a storage of channels and other chats allowed to post in the group on their behalf,
+// i.e. the linked channel of the group or a partner channel. Messages sent on behalf of them are not checked.
+type AllowedChannels struct {
+	db *sqlx.DB
+}
+
+// AllowedChannel is a channel allowed to post in the group on its behalf
+type AllowedChannel struct {
+	ChatID    int64     `db:"chat_id" json:"chat_id"`
+	Name      string    `db:"name" json:"name"`         // optional name or note, i.e. "linked channel"
+	AddedBy   string    `db:"added_by" json:"added_by"` // AllowedChannelsConfig or admin allowed the channel, i.e. "admin:bob"
+	Timestamp time.Time `db:"timestamp" json:"timestamp"`
+}
+
+// NewAllowedChannels creates a new AllowedChannels storage
+func NewAllowedChannels(db *sqlx.DB) (*AllowedChannels, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate allowed channels: %w", err)
+	}
+	return &AllowedChannels{db: db}, nil
+}
+
+// Add allows the channel, the name and the author of already allowed channel are replaced.
+// Timestamp is set to the current time if not set.
+func (a *AllowedChannels) Add(ch AllowedChannel) error {
+	if ch.ChatID == 0 {
+		return errors.New("empty id of allowed channel")
+	}
+	if ch.Timestamp.IsZero() {
+		ch.Timestamp = time.Now()
+	}
+	_, err := a.db.NamedExec(`INSERT OR REPLACE INTO allowed_channels (chat_id, name, added_by, timestamp)
+		VALUES (:chat_id, :name, :added_by, :timestamp)`, ch)
+	if err != nil {
+		return fmt.Errorf("failed to allow channel %d: %w", ch.ChatID, err)
+	}
+	return nil
+}
+
+// Remove removes the channel from allowed ones, returns error if the channel is not allowed or allowed by config
+func (a *AllowedChannels) Remove(chatID int64) error {
+	ch, ok, err := a.Get(chatID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("channel %d is not allowed", chatID)
+	}
+	if ch.AddedBy == AllowedChannelsConfig {
+		return fmt.Errorf("channel %d is allowed by options, remove it from config", chatID)
+	}
+	if _, err = a.db.Exec("DELETE FROM allowed_channels WHERE chat_id = ?", chatID); err != nil {
+		return fmt.Errorf("failed to remove allowed channel %d: %w", chatID, err)
+	}
+	return nil
+}
+
+// Get returns the allowed channel, false if the channel is not allowed
+func (a *AllowedChannels) Get(chatID int64) (AllowedChannel, bool, error) {
+	var res AllowedChannel
+	err := a.db.Get(&res, "SELECT chat_id, name, added_by, timestamp FROM allowed_channels WHERE chat_id = ?", chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AllowedChannel{}, false, nil
+	}
+	if err != nil {
+		return AllowedChannel{}, false, fmt.Errorf("failed to get allowed channel %d: %w", chatID, err)
+	}
+	return res, true, nil
+}
+
+// List returns all allowed channels, sorted by id
+func (a *AllowedChannels) List() ([]AllowedChannel, error) {
+	res := []AllowedChannel{}
+	if err := a.db.Select(&res, "SELECT chat_id, name, added_by, timestamp FROM allowed_channels ORDER BY chat_id"); err != nil {
+		return nil, fmt.Errorf("failed to list allowed channels: %w", err)
+	}
+	return res, nil
+}
+
+// SetConfigured replaces channels allowed by config with the given ones, channels allowed by admins are kept,
+// unless allowed by config too.
+func (a *AllowedChannels) SetConfigured(channels []AllowedChannel) error {
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start update of allowed channels: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	if _, err = tx.Exec("DELETE FROM allowed_channels WHERE added_by = ?", AllowedChannelsConfig); err != nil {
+		return fmt.Errorf("failed to remove allowed channels of config: %w", err)
+	}
+	now := time.Now()
+	for _, ch := range channels {
+		ch.AddedBy, ch.Timestamp = AllowedChannelsConfig, now
+		_, err = tx.NamedExec(`INSERT OR REPLACE INTO allowed_channels (chat_id, name, added_by, timestamp)
+			VALUES (:chat_id, :name, :added_by, :timestamp)`, ch)
+		if err != nil {
+			return fmt.Errorf("failed to allow channel %d of config: %w", ch.ChatID, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit allowed channels of config: %w", err)
+	}
+	return nil
+}
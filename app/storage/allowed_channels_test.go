@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedChannels(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "channels.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	a, err := NewAllowedChannels(db)
+	require.NoError(t, err)
+
+	_, ok, err := a.Get(-1001)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, a.Add(AllowedChannel{ChatID: -1002, Name: "partner news", AddedBy: "admin:bob", Timestamp: ts}))
+	require.NoError(t, a.Add(AllowedChannel{ChatID: -1003, AddedBy: "admin:bob"}))
+	require.Error(t, a.Add(AllowedChannel{Name: "no id"}))
+	ch, ok, err := a.Get(-1002)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, AllowedChannel{ChatID: -1002, Name: "partner news", AddedBy: "admin:bob", Timestamp: ts}, ch)
+
+	require.NoError(t, a.SetConfigured([]AllowedChannel{{ChatID: -1001, Name: "linked"}, {ChatID: -1003}}))
+	channels, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, channels, 3)
+	assert.Equal(t, []int64{-1003, -1002, -1001}, []int64{channels[0].ChatID, channels[1].ChatID, channels[2].ChatID})
+	assert.Equal(t, AllowedChannelsConfig, channels[0].AddedBy, "channel of admin allowed by config too")
+	assert.Equal(t, AllowedChannelsConfig, channels[2].AddedBy)
+	assert.Equal(t, "linked", channels[2].Name)
+
+	assert.ErrorContains(t, a.Remove(-1001), "allowed by options")
+	assert.ErrorContains(t, a.Remove(-1004), "not allowed")
+	require.NoError(t, a.Remove(-1002))
+
+	// channels of config replaced
+	require.NoError(t, a.SetConfigured([]AllowedChannel{{ChatID: -1005}}))
+	channels, err = a.List()
+	require.NoError(t, err)
+	require.Len(t, channels, 1)
+	assert.Equal(t, int64(-1005), channels[0].ChatID)
+}
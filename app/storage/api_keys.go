@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // sqlite driver loaded here
+)
+
+// APIKeys is a storage of web server api keys with their scopes and usage audit.
+// Keys are not stored, only their sha256 hashes, so a key is shown once, when it is added.
+type APIKeys struct {
+	db *sqlx.DB
+}
+
+// APIKeyScope is a scope of the api key, i.e. a set of allowed endpoints
+type APIKeyScope string
+
+// enum of api key scopes
+const (
+	APIKeyScopeCheck    APIKeyScope = "check"    // spam checks only
+	APIKeyScopeManage   APIKeyScope = "manage"   // all endpoints, including samples, users and keys management
+	APIKeyScopeDenylist APIKeyScope = "denylist" // denylist feed only, for peer instances
+)
+
+// apiKeyPrefix is a prefix of generated keys, to make them recognizable, i.e. by secret scanners
+const apiKeyPrefix = "tgs_"
+
+// APIKey is a stored api key, without the key itself
+type APIKey struct {
+	ID       int64       `db:"id" json:"id"`
+	Name     string      `db:"name" json:"name"`
+	Scope    APIKeyScope `db:"scope" json:"scope"`
+	Created  time.Time   `db:"created" json:"created"`
+	LastUsed *time.Time  `db:"last_used" json:"last_used,omitempty"`
+	Uses     int         `db:"uses" json:"uses"` // number of requests made with the key
+}
+
+// APIKeyUsage is an audit record of a request made with the api key
+type APIKeyUsage struct {
+	KeyID     int64     `db:"key_id" json:"key_id"`
+	Timestamp time.Time `db:"timestamp" json:"timestamp"`
+	Method    string    `db:"method" json:"method"`
+	Path      string    `db:"path" json:"path"`
+	Status    int       `db:"status" json:"status"`
+}
+
+// NewAPIKeys creates a new APIKeys storage
+func NewAPIKeys(db *sqlx.DB) (*APIKeys, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate api keys: %w", err)
+	}
+	return &APIKeys{db: db}, nil
+}
+
+// Add generates a new key with the given name and scope. The key is returned and can't be retrieved later.
+func (k *APIKeys) Add(name string, scope APIKeyScope) (key string, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("empty api key name")
+	}
+	if scope != APIKeyScopeCheck && scope != APIKeyScopeManage && scope != APIKeyScopeDenylist {
+		return "", fmt.Errorf("invalid api key scope %q", scope)
+	}
+	b := make([]byte, 24)
+	if _, err = rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	_, err = k.db.Exec("INSERT INTO api_keys (name, hash, scope, created) VALUES (?, ?, ?, ?)",
+		name, hashAPIKey(key), scope, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("failed to add api key %q: %w", name, err)
+	}
+	return key, nil
+}
+
+// Find returns the api key by the key itself, sql.ErrNoRows is wrapped if the key is unknown
+func (k *APIKeys) Find(key string) (APIKey, error) {
+	res := APIKey{}
+	err := k.db.Get(&res, "SELECT id, name, scope, created, last_used, uses FROM api_keys WHERE hash = ?", hashAPIKey(key))
+	if err != nil {
+		return APIKey{}, fmt.Errorf("failed to find api key: %w", err)
+	}
+	return res, nil
+}
+
+// List returns all api keys, ordered by id
+func (k *APIKeys) List() ([]APIKey, error) {
+	res := []APIKey{}
+	if err := k.db.Select(&res, "SELECT id, name, scope, created, last_used, uses FROM api_keys ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return res, nil
+}
+
+// Delete removes the api key by its id, usage audit of the key is kept
+func (k *APIKeys) Delete(id int64) error {
+	res, err := k.db.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key %d: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("api key %d not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// Used records the request made with the api key to the usage audit and updates the key's last use
+func (k *APIKeys) Used(id int64, method, path string, status int) error {
+	now := time.Now()
+	tx, err := k.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	var committed bool
+	defer func() {
+		// rollback if not committed due to error
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("[WARN] failed to rollback transaction: %v", err)
+			}
+		}
+	}()
+
+	_, err = tx.Exec("INSERT INTO api_key_usage (key_id, timestamp, method, path, status) VALUES (?, ?, ?, ?, ?)",
+		id, now, method, path, status)
+	if err != nil {
+		return fmt.Errorf("failed to add api key usage: %w", err)
+	}
+	if _, err = tx.Exec("UPDATE api_keys SET last_used = ?, uses = uses + 1 WHERE id = ?", now, id); err != nil {
+		return fmt.Errorf("failed to update api key %d: %w", id, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// Usage returns the latest usage audit records of the api key, up to the limit, newest first
+func (k *APIKeys) Usage(id int64, limit int) ([]APIKeyUsage, error) {
+	res := []APIKeyUsage{}
+	err := k.db.Select(&res, `SELECT key_id, timestamp, method, path, status FROM api_key_usage
+		WHERE key_id = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api key %d usage: %w", id, err)
+	}
+	return res, nil
+}
+
+// hashAPIKey returns hex sha256 of the key. Keys are random, so no salt is needed.
+func hashAPIKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
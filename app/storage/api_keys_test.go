@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "keys.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	keys, err := NewAPIKeys(db)
+	require.NoError(t, err)
+
+	checkKey, err := keys.Add("ci", APIKeyScopeCheck)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(checkKey, "tgs_"))
+	assert.Len(t, checkKey, 4+48)
+	manageKey, err := keys.Add(" admin ", APIKeyScopeManage)
+	require.NoError(t, err)
+	assert.NotEqual(t, checkKey, manageKey)
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := keys.Add("", APIKeyScopeCheck)
+		assert.EqualError(t, err, "empty api key name")
+		_, err = keys.Add("other", "root")
+		assert.EqualError(t, err, `invalid api key scope "root"`)
+		_, err = keys.Add("ci", APIKeyScopeManage)
+		assert.Error(t, err, "duplicate name")
+	})
+
+	t.Run("find", func(t *testing.T) {
+		key, err := keys.Find(manageKey)
+		require.NoError(t, err)
+		assert.Equal(t, "admin", key.Name)
+		assert.Equal(t, APIKeyScopeManage, key.Scope)
+		assert.Nil(t, key.LastUsed)
+
+		_, err = keys.Find("tgs_unknown")
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		var count int
+		require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM api_keys WHERE hash = ?", checkKey))
+		assert.Equal(t, 0, count, "key itself not stored")
+	})
+
+	t.Run("used and usage", func(t *testing.T) {
+		key, err := keys.Find(checkKey)
+		require.NoError(t, err)
+		require.NoError(t, keys.Used(key.ID, "POST", "/check", 200))
+		require.NoError(t, keys.Used(key.ID, "GET", "/users", 403))
+
+		key, err = keys.Find(checkKey)
+		require.NoError(t, err)
+		assert.Equal(t, 2, key.Uses)
+		require.NotNil(t, key.LastUsed)
+
+		usage, err := keys.Usage(key.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, usage, 2)
+		assert.Equal(t, "/users", usage[0].Path, "newest first")
+		assert.Equal(t, 403, usage[0].Status)
+		assert.Equal(t, "POST", usage[1].Method)
+
+		usage, err = keys.Usage(key.ID, 1)
+		require.NoError(t, err)
+		assert.Len(t, usage, 1)
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		list, err := keys.List()
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, "ci", list[0].Name)
+		assert.Equal(t, "admin", list[1].Name)
+
+		require.NoError(t, keys.Delete(list[0].ID))
+		err = keys.Delete(list[0].ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = keys.Find(checkKey)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+
+		usage, err := keys.Usage(list[0].ID, 10)
+		require.NoError(t, err)
+		assert.Len(t, usage, 2, "usage audit kept")
+	})
+}
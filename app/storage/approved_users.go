@@ -1,76 +1,207 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite" // sqlite driver loaded here
+
+	"github.com/umputun/tg-spam/lib"
 )
 
-// ApprovedUsers is a storage for approved users ids
+// ApprovedUsers is a storage for approved users with their metadata.
+// Users are scoped by group id, so approval in one group doesn't affect another group sharing the database.
+// Write and Delete are write-through, changes are queued and written in batches by Run or Flush.
 // Read is not thread-safe
 type ApprovedUsers struct {
 	db         *sqlx.DB
-	lastReadID int64 // last id for read. Note: this is not a thread-safe part, don't call parallel reads!
+	gid        string // group id, all records are scoped by it
+	lastReadID int64  // last id for read. Note: this is not a thread-safe part, don't call parallel reads!
+
+	pendingLock sync.Mutex
+	pending     map[string]pendingUser // queued changes by user id, the last change wins
+	flushCh     chan struct{}          // signals to flush the full batch
+	flushLock   sync.Mutex             // serializes flushes
 }
 
-// NewApprovedUsers creates a new ApprovedUsers storage
-func NewApprovedUsers(db *sqlx.DB) (*ApprovedUsers, error) {
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS approved_users " +
-		"(id INTEGER PRIMARY KEY, timestamp DATETIME DEFAULT CURRENT_TIMESTAMP)")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create approved_users table: %w", err)
+// pendingUser is a queued change of approved user, either write or delete
+type pendingUser struct {
+	user    lib.ApprovedUser
+	deleted bool
+}
+
+// maxPendingUsers is the size of batch triggering flush without waiting for the next Run tick
+const maxPendingUsers = 100
+
+// NewApprovedUsers creates a new ApprovedUsers storage for the group.
+// Users stored before scoping was added (with empty group id) are claimed by the first non-empty group.
+func NewApprovedUsers(db *sqlx.DB, gid string) (*ApprovedUsers, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate approved_users: %w", err)
 	}
-	return &ApprovedUsers{db: db}, nil
+	if gid != "" {
+		res, err := db.Exec("UPDATE OR IGNORE approved_users SET gid = ? WHERE gid = ''", gid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim approved users for %s: %w", gid, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			log.Printf("[INFO] %d approved users claimed by group %s", n, gid)
+		}
+	}
+	return &ApprovedUsers{db: db, gid: gid, pending: map[string]pendingUser{}, flushCh: make(chan struct{}, 1)}, nil
 }
 
-// Store saves ids to the storage, overwriting the existing content
-func (au *ApprovedUsers) Store(ids []string) error {
-	log.Printf("[DEBUG] storing %d ids", len(ids))
+// Write queues the user to be written to the storage, implements lib.UserStorage
+func (au *ApprovedUsers) Write(user lib.ApprovedUser) error {
+	if _, err := strconv.ParseInt(user.UserID, 10, 64); err != nil {
+		return fmt.Errorf("failed to parse id %s: %w", user.UserID, err)
+	}
+	au.enqueue(user.UserID, pendingUser{user: user})
+	return nil
+}
 
-	tx, err := au.db.Beginx()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %w", err)
+// Delete queues the user to be deleted from the storage, implements lib.UserStorage
+func (au *ApprovedUsers) Delete(userID string) error {
+	if _, err := strconv.ParseInt(userID, 10, 64); err != nil {
+		return fmt.Errorf("failed to parse id %s: %w", userID, err)
 	}
+	au.enqueue(userID, pendingUser{user: lib.ApprovedUser{UserID: userID}, deleted: true})
+	return nil
+}
 
-	var committed bool
-	defer func() {
-		// rollback if not committed due to error
-		if !committed {
-			if err := tx.Rollback(); err != nil {
-				log.Printf("[WARN] failed to rollback transaction: %v", err)
+// Run flushes queued changes every interval, till context is canceled. Remaining changes are flushed on exit.
+func (au *ApprovedUsers) Run(ctx context.Context, interval time.Duration) {
+	log.Printf("[DEBUG] flush approved users every %v", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := au.Flush(); err != nil {
+				log.Printf("[WARN] can't flush approved users, %v", err)
 			}
+			log.Printf("[DEBUG] flush approved users stopped")
+			return
+		case <-ticker.C:
+		case <-au.flushCh:
 		}
-	}()
+		if err := au.Flush(); err != nil {
+			log.Printf("[WARN] can't flush approved users, %v", err)
+		}
+	}
+}
 
-	for _, id := range ids {
-		idVal, err := strconv.ParseInt(id, 10, 64)
-		if err != nil {
-			return fmt.Errorf("failed to parse id %s: %w", id, err)
+// Flush writes all queued changes to the storage in a single transaction.
+// On failure changes are re-queued, unless newer changes of the same users queued meanwhile.
+func (au *ApprovedUsers) Flush() error {
+	au.flushLock.Lock()
+	defer au.flushLock.Unlock()
+
+	au.pendingLock.Lock()
+	batch := au.pending
+	au.pending = map[string]pendingUser{}
+	au.pendingLock.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := au.inTx(func(tx *sqlx.Tx) error {
+		for _, p := range batch {
+			if !p.deleted {
+				if err := au.storeUser(tx, p.user); err != nil {
+					return err
+				}
+				continue
+			}
+			idVal, err := strconv.ParseInt(p.user.UserID, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse id %s: %w", p.user.UserID, err)
+			}
+			if _, err := tx.Exec("DELETE FROM approved_users WHERE gid = ? AND id = ?", au.gid, idVal); err != nil {
+				return fmt.Errorf("failed to delete id %s: %w", p.user.UserID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		au.pendingLock.Lock()
+		for id, p := range batch {
+			if _, ok := au.pending[id]; !ok {
+				au.pending[id] = p
+			}
 		}
+		au.pendingLock.Unlock()
+		return err
+	}
+	log.Printf("[DEBUG] flushed %d approved users changes", len(batch))
+	return nil
+}
 
-		_, err = tx.Exec("INSERT OR REPLACE INTO approved_users (id, timestamp) VALUES (?, ?)", idVal, time.Now())
-		if err != nil {
-			return fmt.Errorf("failed to insert id %s: %w", id, err)
+func (au *ApprovedUsers) enqueue(userID string, p pendingUser) {
+	au.pendingLock.Lock()
+	defer au.pendingLock.Unlock()
+	au.pending[userID] = p
+	if len(au.pending) >= maxPendingUsers {
+		select {
+		case au.flushCh <- struct{}{}:
+		default: // flush already signaled
 		}
 	}
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+}
+
+// Store saves users to the storage, overwriting the existing records of the same users
+func (au *ApprovedUsers) Store(users []lib.ApprovedUser) error {
+	log.Printf("[DEBUG] storing %d approved users", len(users))
+	return au.inTx(func(tx *sqlx.Tx) error {
+		for _, user := range users {
+			if err := au.storeUser(tx, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Users returns all stored users of the group with their metadata, ordered by id.
+// For records stored before metadata was added, first seen is the time of storing.
+func (au *ApprovedUsers) Users() ([]lib.ApprovedUser, error) {
+	var records []struct {
+		ID        int64        `db:"id"`
+		Name      string       `db:"name"`
+		Count     int          `db:"count"`
+		FirstSeen sql.NullTime `db:"first_seen"`
+		LastSeen  sql.NullTime `db:"last_seen"`
+		Timestamp sql.NullTime `db:"timestamp"`
 	}
-	committed = true
-	return nil
+	query := "SELECT id, name, count, first_seen, last_seen, timestamp FROM approved_users WHERE gid = ? ORDER BY id"
+	if err := au.db.Select(&records, query, au.gid); err != nil {
+		return nil, fmt.Errorf("failed to read approved users: %w", err)
+	}
+
+	res := make([]lib.ApprovedUser, 0, len(records))
+	for _, r := range records {
+		user := lib.ApprovedUser{UserID: strconv.FormatInt(r.ID, 10), UserName: r.Name, Count: r.Count,
+			FirstSeen: r.FirstSeen.Time, LastSeen: r.LastSeen.Time}
+		if !r.FirstSeen.Valid {
+			user.FirstSeen = r.Timestamp.Time
+		}
+		res = append(res, user)
+	}
+	return res, nil
 }
 
-// Read reads ids from the storage
+// Read reads ids of the group from the storage
 // Each read returns one id, followed by a newline
 func (au *ApprovedUsers) Read(p []byte) (n int, err error) {
-	row := au.db.QueryRow("SELECT id FROM approved_users WHERE id > ? ORDER BY id LIMIT 1", au.lastReadID)
+	row := au.db.QueryRow("SELECT id FROM approved_users WHERE gid = ? AND id > ? ORDER BY id LIMIT 1", au.gid, au.lastReadID)
 	var id int64
 	if err := row.Scan(&id); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -83,3 +214,50 @@ func (au *ApprovedUsers) Read(p []byte) (n int, err error) {
 	n = copy(p, idBytes)
 	return n, nil
 }
+
+// inTx runs fn in a transaction, committed if fn succeeded
+func (au *ApprovedUsers) inTx(fn func(tx *sqlx.Tx) error) error {
+	tx, err := au.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	var committed bool
+	defer func() {
+		// rollback if not committed due to error
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("[WARN] failed to rollback transaction: %v", err)
+			}
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// storeUser inserts or replaces the user record of the group
+func (au *ApprovedUsers) storeUser(tx *sqlx.Tx, user lib.ApprovedUser) error {
+	idVal, err := strconv.ParseInt(user.UserID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse id %s: %w", user.UserID, err)
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO approved_users (gid, id, name, count, first_seen, last_seen, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, au.gid, idVal, user.UserName, user.Count, nullTime(user.FirstSeen),
+		nullTime(user.LastSeen), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to insert id %s: %w", user.UserID, err)
+	}
+	return nil
+}
+
+// nullTime converts zero time to NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// UsersFormat is a format of exported approved users
+type UsersFormat string
+
+// enum of users formats
+const (
+	UsersFormatCSV  UsersFormat = "csv"  // csv with header, user_id column is required, others are optional
+	UsersFormatJSON UsersFormat = "json" // json array of users, or object with "users" array, as returned by GET /users
+	UsersFormatIDs  UsersFormat = "txt"  // list of user ids, without metadata, i.e. exported from another anti-spam bot
+)
+
+// usersCSVHeader is the header of users in csv format
+var usersCSVHeader = []string{"user_id", "user_name", "count", "first_seen", "last_seen"}
+
+// ParseUsersFormat returns users format by its name, or by extension of the file name
+func ParseUsersFormat(name string) (UsersFormat, error) {
+	name = strings.ToLower(name)
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	switch UsersFormat(name) {
+	case UsersFormatCSV, UsersFormatJSON, UsersFormatIDs:
+		return UsersFormat(name), nil
+	}
+	return "", fmt.Errorf("unknown users format %q, expected csv, json or txt", name)
+}
+
+// WriteUsers writes approved users to w in the format, with metadata for csv and json, one id per line for txt
+func WriteUsers(w io.Writer, format UsersFormat, users []lib.ApprovedUser) error {
+	switch format {
+	case UsersFormatIDs:
+		for _, u := range users {
+			if _, err := fmt.Fprintln(w, u.UserID); err != nil {
+				return fmt.Errorf("failed to write user %s: %w", u.UserID, err)
+			}
+		}
+		return nil
+	case UsersFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if users == nil {
+			users = []lib.ApprovedUser{}
+		}
+		return enc.Encode(users)
+	case UsersFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(usersCSVHeader); err != nil {
+			return fmt.Errorf("failed to write csv header: %w", err)
+		}
+		for _, u := range users {
+			rec := []string{u.UserID, u.UserName, strconv.Itoa(u.Count), formatUserTime(u.FirstSeen), formatUserTime(u.LastSeen)}
+			if err := cw.Write(rec); err != nil {
+				return fmt.Errorf("failed to write user %s: %w", u.UserID, err)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown users format %q", format)
+}
+
+// ReadUsers reads approved users from r in the format. Users with invalid ids, i.e. usernames in lists of ids,
+// are skipped and counted, the last entry of duplicated users wins. Ids list is separated by new lines,
+// spaces, commas or semicolons.
+func ReadUsers(r io.Reader, format UsersFormat) (users []lib.ApprovedUser, skipped int, err error) {
+	var res []lib.ApprovedUser
+	switch format {
+	case UsersFormatIDs:
+		res, err = readUsersIDs(r)
+	case UsersFormatCSV:
+		res, err = readUsersCSV(r)
+	case UsersFormatJSON:
+		res, err = readUsersJSON(r)
+	default:
+		err = fmt.Errorf("unknown users format %q", format)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users = make([]lib.ApprovedUser, 0, len(res))
+	idx := map[string]int{}
+	for _, u := range res {
+		u.UserID = strings.TrimSpace(u.UserID)
+		if id, err := strconv.ParseInt(u.UserID, 10, 64); err != nil || id <= 0 {
+			skipped++
+			continue
+		}
+		if i, ok := idx[u.UserID]; ok {
+			users[i] = u
+			continue
+		}
+		idx[u.UserID] = len(users)
+		users = append(users, u)
+	}
+	return users, skipped, nil
+}
+
+func readUsersIDs(r io.Reader) ([]lib.ApprovedUser, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	var res []lib.ApprovedUser
+	for scanner.Scan() {
+		for _, id := range strings.FieldsFunc(scanner.Text(), func(r rune) bool { return r == ',' || r == ';' }) {
+			res = append(res, lib.ApprovedUser{UserID: id})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ids: %w", err)
+	}
+	return res, nil
+}
+
+func readUsersCSV(r io.Reader) ([]lib.ApprovedUser, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := cols["user_id"]; !ok {
+		return nil, errors.New("no user_id column in csv header")
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var res []lib.ApprovedUser
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return res, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+		u := lib.ApprovedUser{UserID: field(rec, "user_id"), UserName: field(rec, "user_name")}
+		if v := field(rec, "count"); v != "" {
+			if u.Count, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid count %q in line %d", v, line)
+			}
+		}
+		if u.FirstSeen, err = parseUserTime(field(rec, "first_seen")); err != nil {
+			return nil, fmt.Errorf("invalid first_seen in line %d: %w", line, err)
+		}
+		if u.LastSeen, err = parseUserTime(field(rec, "last_seen")); err != nil {
+			return nil, fmt.Errorf("invalid last_seen in line %d: %w", line, err)
+		}
+		res = append(res, u)
+	}
+}
+
+func readUsersJSON(r io.Reader) ([]lib.ApprovedUser, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read json: %w", err)
+	}
+	var res []lib.ApprovedUser
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var obj struct {
+			Users []lib.ApprovedUser `json:"users"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, fmt.Errorf("failed to decode json: %w", err)
+		}
+		return obj.Users, nil
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode json: %w", err)
+	}
+	return res, nil
+}
+
+// formatUserTime formats time of user as RFC3339, zero time as empty string
+func formatUserTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseUserTime parses RFC3339 time of user, empty string as zero time
+func parseUserTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
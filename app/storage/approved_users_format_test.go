@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestParseUsersFormat(t *testing.T) {
+	tbl := []struct {
+		name string
+		exp  UsersFormat
+		err  bool
+	}{
+		{name: "csv", exp: UsersFormatCSV},
+		{name: "JSON", exp: UsersFormatJSON},
+		{name: "/tmp/users.txt", exp: UsersFormatIDs},
+		{name: ".csv", exp: UsersFormatCSV},
+		{name: "users.xml", err: true},
+		{name: "", err: true},
+	}
+	for _, tt := range tbl {
+		res, err := ParseUsersFormat(tt.name)
+		if tt.err {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.exp, res, tt.name)
+	}
+}
+
+func TestWriteReadUsers(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	users := []lib.ApprovedUser{
+		{UserID: "123", UserName: "user1", Count: 5, FirstSeen: ts, LastSeen: ts.Add(time.Hour)},
+		{UserID: "456", UserName: "user, with comma", Count: 1, FirstSeen: ts},
+	}
+
+	for _, format := range []UsersFormat{UsersFormatCSV, UsersFormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			buf := bytes.Buffer{}
+			require.NoError(t, WriteUsers(&buf, format, users))
+			res, skipped, err := ReadUsers(&buf, format)
+			require.NoError(t, err)
+			assert.Zero(t, skipped)
+			assert.Equal(t, users, res)
+		})
+	}
+
+	t.Run("txt", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		require.NoError(t, WriteUsers(&buf, UsersFormatIDs, users))
+		assert.Equal(t, "123\n456\n", buf.String())
+		res, skipped, err := ReadUsers(&buf, UsersFormatIDs)
+		require.NoError(t, err)
+		assert.Zero(t, skipped)
+		assert.Equal(t, []lib.ApprovedUser{{UserID: "123"}, {UserID: "456"}}, res)
+	})
+
+	t.Run("empty json", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		require.NoError(t, WriteUsers(&buf, UsersFormatJSON, nil))
+		assert.Equal(t, "[]\n", buf.String())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert.Error(t, WriteUsers(&bytes.Buffer{}, "xml", users))
+		_, _, err := ReadUsers(strings.NewReader(""), "xml")
+		assert.Error(t, err)
+	})
+}
+
+func TestReadUsers(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		name    string
+		format  UsersFormat
+		inp     string
+		exp     []lib.ApprovedUser
+		skipped int
+		err     bool
+	}{
+		{name: "ids list of another bot", format: UsersFormatIDs, inp: "123\n456, 789;@spammer\n\n  123 -5 abc\n",
+			exp: []lib.ApprovedUser{{UserID: "123"}, {UserID: "456"}, {UserID: "789"}}, skipped: 3},
+		{name: "csv with user_id only", format: UsersFormatCSV, inp: "USER_ID\n123\nabc\n456\n",
+			exp: []lib.ApprovedUser{{UserID: "123"}, {UserID: "456"}}, skipped: 1},
+		{name: "csv with reordered columns", format: UsersFormatCSV,
+			inp: "last_seen,user_name,user_id\n2024-05-01T10:00:00Z,user1,123\n",
+			exp: []lib.ApprovedUser{{UserID: "123", UserName: "user1", LastSeen: ts}}},
+		{name: "csv duplicates, the last wins", format: UsersFormatCSV, inp: "user_id,user_name\n123,old\n123,new\n",
+			exp: []lib.ApprovedUser{{UserID: "123", UserName: "new"}}},
+		{name: "csv without user_id", format: UsersFormatCSV, inp: "id,name\n123,user1\n", err: true},
+		{name: "csv with invalid count", format: UsersFormatCSV, inp: "user_id,count\n123,many\n", err: true},
+		{name: "csv with invalid time", format: UsersFormatCSV, inp: "user_id,first_seen\n123,yesterday\n", err: true},
+		{name: "json of GET /users", format: UsersFormatJSON,
+			inp: `{"user_ids": ["123"], "users": [{"user_id": "123", "user_name": "user1", "count": 2}]}`,
+			exp: []lib.ApprovedUser{{UserID: "123", UserName: "user1", Count: 2}}},
+		{name: "invalid json", format: UsersFormatJSON, inp: `[{"user_id": 123}]`, err: true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, skipped, err := ReadUsers(strings.NewReader(tt.inp), tt.format)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, res)
+			assert.Equal(t, tt.skipped, skipped)
+		})
+	}
+}
@@ -2,13 +2,19 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
 )
 
 func TestApprovedUsers_StoreAndRead(t *testing.T) {
@@ -43,10 +49,14 @@ func TestApprovedUsers_StoreAndRead(t *testing.T) {
 			filePath := tmpDir + "/testfile.bin"
 			db, err := NewSqliteDB(filePath)
 			require.NoError(t, err)
-			au, err := NewApprovedUsers(db)
+			au, err := NewApprovedUsers(db, "")
 			require.NoError(t, err)
 
-			err = au.Store(tt.ids)
+			users := make([]lib.ApprovedUser, len(tt.ids))
+			for i, id := range tt.ids {
+				users[i] = lib.ApprovedUser{UserID: id}
+			}
+			err = au.Store(users)
 			require.NoError(t, err)
 
 			var readBuffer bytes.Buffer
@@ -80,3 +90,124 @@ func TestApprovedUsers_StoreAndRead(t *testing.T) {
 		})
 	}
 }
+
+func TestApprovedUsers_Users(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "approved.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	au, err := NewApprovedUsers(db, "")
+	require.NoError(t, err)
+
+	// record made before metadata was added
+	_, err = db.Exec("INSERT INTO approved_users (id, timestamp) VALUES (111, ?)", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	firstSeen, lastSeen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	err = au.Store([]lib.ApprovedUser{{UserID: "222", UserName: "user2", Count: 5, FirstSeen: firstSeen, LastSeen: lastSeen}})
+	require.NoError(t, err)
+	assert.Error(t, au.Store([]lib.ApprovedUser{{UserID: "bad"}}))
+
+	users, err := au.Users()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "111", users[0].UserID)
+	assert.True(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Equal(users[0].FirstSeen), "timestamp used as first seen")
+	assert.True(t, users[0].LastSeen.IsZero())
+	assert.Equal(t, "222", users[1].UserID)
+	assert.Equal(t, "user2", users[1].UserName)
+	assert.Equal(t, 5, users[1].Count)
+	assert.True(t, firstSeen.Equal(users[1].FirstSeen))
+	assert.True(t, lastSeen.Equal(users[1].LastSeen))
+}
+
+func TestApprovedUsers_WriteDelete(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "approved.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	au, err := NewApprovedUsers(db, "")
+	require.NoError(t, err)
+	require.NoError(t, au.Store([]lib.ApprovedUser{{UserID: "111", Count: 1}}))
+
+	require.NoError(t, au.Write(lib.ApprovedUser{UserID: "222", Count: 1}))
+	require.NoError(t, au.Write(lib.ApprovedUser{UserID: "222", UserName: "user2", Count: 2}))
+	require.NoError(t, au.Write(lib.ApprovedUser{UserID: "333", Count: 1}))
+	require.NoError(t, au.Delete("111"))
+	require.NoError(t, au.Delete("333"))
+	assert.Error(t, au.Write(lib.ApprovedUser{UserID: "bad"}))
+	assert.Error(t, au.Delete("bad"))
+
+	users, err := au.Users()
+	require.NoError(t, err)
+	require.Len(t, users, 1, "nothing written before flush")
+	assert.Equal(t, "111", users[0].UserID)
+
+	require.NoError(t, au.Flush())
+	users, err = au.Users()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "222", users[0].UserID)
+	assert.Equal(t, "user2", users[0].UserName, "last change wins")
+	assert.Equal(t, 2, users[0].Count)
+
+	require.NoError(t, au.Flush(), "nothing to flush")
+}
+
+func TestApprovedUsers_Run(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "approved.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	au, err := NewApprovedUsers(db, "")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		au.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	for i := 0; i < maxPendingUsers; i++ {
+		require.NoError(t, au.Write(lib.ApprovedUser{UserID: strconv.Itoa(i + 1)}))
+	}
+	require.Eventually(t, func() bool {
+		users, err := au.Users()
+		return err == nil && len(users) == maxPendingUsers
+	}, time.Second, time.Millisecond*10, "full batch flushed without waiting for tick")
+
+	require.NoError(t, au.Write(lib.ApprovedUser{UserID: "1000"}))
+	cancel()
+	<-done
+	users, err := au.Users()
+	require.NoError(t, err)
+	assert.Len(t, users, maxPendingUsers+1, "flushed on exit")
+}
+
+func TestApprovedUsers_GroupScope(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "approved.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	au1, err := NewApprovedUsers(db, "gr1")
+	require.NoError(t, err)
+	au2, err := NewApprovedUsers(db, "gr2")
+	require.NoError(t, err)
+
+	require.NoError(t, au1.Store([]lib.ApprovedUser{{UserID: "1", UserName: "user1"}, {UserID: "2", UserName: "user2"}}))
+	require.NoError(t, au2.Store([]lib.ApprovedUser{{UserID: "2", UserName: "user2 in gr2"}, {UserID: "3"}}))
+
+	users, err := au1.Users()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "user2", users[1].UserName, "not replaced by another group")
+
+	require.NoError(t, au2.Delete("2"))
+	require.NoError(t, au2.Flush())
+	users, err = au2.Users()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "3", users[0].UserID)
+
+	ids, err := io.ReadAll(au1)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n", string(ids), "user deleted in another group is kept")
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// backupManifestName is the name of manifest entry in the backup archive, it is always the last entry
+const backupManifestName = "manifest.json"
+
+// Backup makes a portable archive (tar.gz) with the database snapshot and dynamic files.
+// The archive has a manifest with checksums of all entries, verified on restore.
+type Backup struct {
+	DB     *sqlx.DB // database to backup, consistent snapshot made with VACUUM INTO
+	DBName string   // name of database file in the archive, i.e. tg-spam.db
+	Files  []string // dynamic files to backup, stored by base name. Missing files are skipped
+}
+
+// BackupManifest describes the content of the backup archive
+type BackupManifest struct {
+	CreatedAt     time.Time         `json:"created_at"`
+	SchemaVersion int               `json:"schema_version"`
+	Files         map[string]string `json:"files"` // file name -> sha256 of content
+}
+
+// Write makes the archive and writes it to w
+func (b Backup) Write(w io.Writer) (err error) {
+	tmpDir, err := os.MkdirTemp("", "tg-spam-backup")
+	if err != nil {
+		return fmt.Errorf("failed to make temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// snapshot db to temp file, it is safe to do with db in use
+	dbSnapshot := filepath.Join(tmpDir, b.DBName)
+	if _, err = b.DB.Exec("VACUUM INTO ?", dbSnapshot); err != nil {
+		return fmt.Errorf("failed to snapshot db: %w", err)
+	}
+	manifest := BackupManifest{CreatedAt: time.Now(), Files: map[string]string{}}
+	if manifest.SchemaVersion, err = SchemaVersion(b.DB); err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	files := append([]string{dbSnapshot}, b.Files...)
+	for _, file := range files {
+		name := filepath.Base(file)
+		if _, dup := manifest.Files[name]; dup {
+			return fmt.Errorf("duplicate file name %q in backup", name)
+		}
+		sum, werr := addToArchive(tw, file, name)
+		if errors.Is(werr, os.ErrNotExist) {
+			log.Printf("[DEBUG] skip missing backup file %s", file)
+			continue
+		}
+		if werr != nil {
+			return werr
+		}
+		manifest.Files[name] = sum
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	hdr := &tar.Header{Name: backupManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write manifest header: %w", err)
+	}
+	if _, err = tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("failed to close tar: %w", err)
+	}
+	if err = gzw.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip: %w", err)
+	}
+	log.Printf("[INFO] backup made, %d files, schema version %d", len(manifest.Files), manifest.SchemaVersion)
+	return nil
+}
+
+// RestoreBackup extracts the archive made by Backup.Write to the dir, overwriting existing files.
+// All entries are verified against the manifest before any file in the dir is touched.
+// Must not be used while the database is open by the bot.
+func RestoreBackup(r io.Reader, dir string) (manifest BackupManifest, err error) {
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return manifest, fmt.Errorf("failed to make dir %s: %w", dir, err)
+	}
+	// extract to temp dir inside the target dir first, so the final rename is atomic per file
+	tmpDir, err := os.MkdirTemp(dir, ".restore")
+	if err != nil {
+		return manifest, fmt.Errorf("failed to make temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to open gzip: %w", err)
+	}
+	defer gzr.Close()
+
+	sums := map[string]string{}
+	var manifestFound bool
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, terr := tr.Next()
+		if errors.Is(terr, io.EOF) {
+			break
+		}
+		if terr != nil {
+			return manifest, fmt.Errorf("failed to read archive: %w", terr)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != filepath.Base(hdr.Name) || hdr.Name == "." || hdr.Name == ".." {
+			return manifest, fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+		if hdr.Name == backupManifestName {
+			if err = json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return manifest, fmt.Errorf("failed to decode manifest: %w", err)
+			}
+			manifestFound = true
+			continue
+		}
+		if sums[hdr.Name], err = extractFile(tr, filepath.Join(tmpDir, hdr.Name)); err != nil {
+			return manifest, err
+		}
+	}
+
+	// integrity check, all files from the manifest must be present with the same checksums
+	if !manifestFound {
+		return manifest, errors.New("backup manifest not found")
+	}
+	if len(sums) != len(manifest.Files) {
+		return manifest, fmt.Errorf("backup has %d files, manifest lists %d", len(sums), len(manifest.Files))
+	}
+	for name, sum := range manifest.Files {
+		if sums[name] != sum {
+			return manifest, fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+
+	for name := range manifest.Files {
+		// remove stale wal files of the replaced database, sqlite would apply them to the restored one
+		for _, sfx := range []string{"-wal", "-shm"} {
+			if err = os.Remove(filepath.Join(dir, name+sfx)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return manifest, fmt.Errorf("failed to remove %s%s: %w", name, sfx, err)
+			}
+		}
+		if err = os.Rename(filepath.Join(tmpDir, name), filepath.Join(dir, name)); err != nil {
+			return manifest, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+	}
+	log.Printf("[INFO] backup from %s restored, %d files, schema version %d",
+		manifest.CreatedAt.Format(time.RFC3339), len(manifest.Files), manifest.SchemaVersion)
+	return manifest, nil
+}
+
+// addToArchive writes the file to the archive under the given name and returns sha256 of its content
+func addToArchive(tw *tar.Writer, file, name string) (string, error) {
+	fh, err := os.Open(file) //nolint:gosec // file names are from config
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer fh.Close()
+	fi, err := fh.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", file, err)
+	}
+
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: fi.Size(), ModTime: fi.ModTime()}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return "", fmt.Errorf("failed to write header for %s: %w", name, err)
+	}
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tw, h), fh); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractFile writes the current archive entry to the file and returns sha256 of its content
+func extractFile(r io.Reader, file string) (string, error) {
+	fh, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec // name is validated
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", file, err)
+	}
+	h := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(fh, h), r); err != nil { //nolint:gosec // archive is made by trusted backup
+		_ = fh.Close()
+		return "", fmt.Errorf("failed to extract %s: %w", file, err)
+	}
+	if err = fh.Close(); err != nil {
+		return "", fmt.Errorf("failed to close %s: %w", file, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
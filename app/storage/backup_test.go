@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestBackup_WriteRestore(t *testing.T) {
+	srcDir := t.TempDir()
+	db, err := NewSqliteDB(filepath.Join(srcDir, "tg-spam.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	au, err := NewApprovedUsers(db, "")
+	require.NoError(t, err)
+	require.NoError(t, au.Store([]lib.ApprovedUser{{UserID: "123", UserName: "user1", Count: 2}}))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "spam-dynamic.txt"), []byte("spam 1\nspam 2\n"), 0o600))
+
+	buf := bytes.Buffer{}
+	b := Backup{DB: db, DBName: "tg-spam.db",
+		Files: []string{filepath.Join(srcDir, "spam-dynamic.txt"), filepath.Join(srcDir, "ham-dynamic.txt")}}
+	require.NoError(t, b.Write(&buf))
+
+	t.Run("restore", func(t *testing.T) {
+		dstDir := filepath.Join(t.TempDir(), "data")
+		manifest, err := RestoreBackup(bytes.NewReader(buf.Bytes()), dstDir)
+		require.NoError(t, err)
+		assert.Len(t, manifest.Files, 2, "missing ham file skipped")
+		assert.False(t, manifest.CreatedAt.IsZero())
+		ver, err := SchemaVersion(db)
+		require.NoError(t, err)
+		assert.Equal(t, ver, manifest.SchemaVersion)
+
+		entries, err := os.ReadDir(dstDir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "no temp files left")
+
+		data, err := os.ReadFile(filepath.Join(dstDir, "spam-dynamic.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "spam 1\nspam 2\n", string(data))
+
+		restoredDB, err := NewSqliteDB(filepath.Join(dstDir, "tg-spam.db"))
+		require.NoError(t, err)
+		defer restoredDB.Close()
+		restored, err := NewApprovedUsers(restoredDB, "")
+		require.NoError(t, err)
+		users, err := restored.Users()
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, "user1", users[0].UserName)
+	})
+
+	t.Run("stale wal files removed", func(t *testing.T) {
+		dstDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dstDir, "tg-spam.db-wal"), []byte("stale"), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dstDir, "tg-spam.db-shm"), []byte("stale"), 0o600))
+		_, err := RestoreBackup(bytes.NewReader(buf.Bytes()), dstDir)
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dstDir, "tg-spam.db-wal"))
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(dstDir, "tg-spam.db-shm"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("corrupted archive", func(t *testing.T) {
+		dstDir := t.TempDir()
+		_, err := RestoreBackup(bytes.NewReader(buf.Bytes()[:buf.Len()/2]), dstDir)
+		assert.Error(t, err)
+		entries, err := os.ReadDir(dstDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries, "nothing restored")
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		arch := makeArchive(t, map[string]string{"spam-dynamic.txt": "changed",
+			"manifest.json": `{"files":{"spam-dynamic.txt":"bad"}}`})
+		_, err := RestoreBackup(arch, t.TempDir())
+		assert.EqualError(t, err, "checksum mismatch for spam-dynamic.txt")
+	})
+
+	t.Run("no manifest", func(t *testing.T) {
+		_, err := RestoreBackup(makeArchive(t, map[string]string{"spam-dynamic.txt": "spam"}), t.TempDir())
+		assert.EqualError(t, err, "backup manifest not found")
+	})
+
+	t.Run("path traversal", func(t *testing.T) {
+		_, err := RestoreBackup(makeArchive(t, map[string]string{"../evil.txt": "spam"}), t.TempDir())
+		assert.EqualError(t, err, `unexpected archive entry "../evil.txt"`)
+	})
+}
+
+func makeArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzw.Close())
+	return buf
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BanFingerprints is a storage of fingerprints of banned users: username, display name and the spam message.
+// New users matching a fingerprint of a recent ban are likely the banned spammer re-joining with a new account.
+type BanFingerprints struct {
+	db     *sqlx.DB
+	cipher *Cipher // optional, encrypts messages at rest
+}
+
+// BanFingerprint is a fingerprint of the banned user
+type BanFingerprint struct {
+	UserID      int64     `db:"user_id"`
+	UserName    string    `db:"user_name"`
+	DisplayName string    `db:"display_name"`
+	Message     string    `db:"message"` // spam message the user was banned for, empty if unknown
+	Timestamp   time.Time `db:"timestamp"`
+}
+
+// NewBanFingerprints creates a new BanFingerprints storage
+func NewBanFingerprints(db *sqlx.DB) (*BanFingerprints, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate ban_fingerprints: %w", err)
+	}
+	return &BanFingerprints{db: db}, nil
+}
+
+// WithCipher enables encryption of stored messages. Messages stored before remain readable.
+func (f *BanFingerprints) WithCipher(c *Cipher) { f.cipher = c }
+
+// Add adds or replaces the fingerprint of the banned user. Zero timestamp is set to the current time.
+func (f *BanFingerprints) Add(fp BanFingerprint) (err error) {
+	if fp.Timestamp.IsZero() {
+		fp.Timestamp = time.Now()
+	}
+	fp.Timestamp = fp.Timestamp.UTC()
+	if f.cipher != nil {
+		if fp.Message, err = f.cipher.Encrypt(fp.Message); err != nil {
+			return fmt.Errorf("failed to encrypt message: %w", err)
+		}
+	}
+	_, err = f.db.NamedExec(`INSERT OR REPLACE INTO ban_fingerprints (user_id, user_name, display_name, message, timestamp)
+		VALUES (:user_id, :user_name, :display_name, :message, :timestamp)`, fp)
+	if err != nil {
+		return fmt.Errorf("failed to add ban fingerprint of user %d: %w", fp.UserID, err)
+	}
+	return nil
+}
+
+// Remove removes the fingerprint of the user, i.e. on unban
+func (f *BanFingerprints) Remove(userID int64) error {
+	if _, err := f.db.Exec("DELETE FROM ban_fingerprints WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to remove ban fingerprint of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// Recent returns fingerprints of users banned since the time, up to the limit, newest first
+func (f *BanFingerprints) Recent(since time.Time, limit int) ([]BanFingerprint, error) {
+	res := []BanFingerprint{}
+	err := f.db.Select(&res, `SELECT user_id, user_name, display_name, message, timestamp FROM ban_fingerprints
+		WHERE timestamp >= ? ORDER BY timestamp DESC LIMIT ?`, since.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ban fingerprints since %v: %w", since, err)
+	}
+	if f.cipher == nil {
+		return res, nil
+	}
+	for i := range res {
+		if res[i].Message, err = f.cipher.Decrypt(res[i].Message); err != nil {
+			return nil, fmt.Errorf("failed to decrypt message of user %d: %w", res[i].UserID, err)
+		}
+	}
+	return res, nil
+}
+
+// Expire removes fingerprints older than ttl, returns the number of removed fingerprints
+func (f *BanFingerprints) Expire(ttl time.Duration) (int64, error) {
+	res, err := f.db.Exec("DELETE FROM ban_fingerprints WHERE timestamp < ?", time.Now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire ban fingerprints: %w", err)
+	}
+	return res.RowsAffected()
+}
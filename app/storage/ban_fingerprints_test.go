@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBanFingerprints(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "fingerprints.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	fps, err := NewBanFingerprints(db)
+	require.NoError(t, err)
+	c, err := NewCipher("secret")
+	require.NoError(t, err)
+	fps.WithCipher(c)
+
+	ts := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, fps.Add(BanFingerprint{UserID: 1, UserName: "spammer", DisplayName: "Crypto Bob",
+		Message: "earn 1000$ a day", Timestamp: ts}))
+	require.NoError(t, fps.Add(BanFingerprint{UserID: 2, UserName: "old", Timestamp: ts.Add(-48 * time.Hour)}))
+	require.NoError(t, fps.Add(BanFingerprint{UserID: 3, DisplayName: "Alice"}))
+
+	var stored string
+	require.NoError(t, db.Get(&stored, "SELECT message FROM ban_fingerprints WHERE user_id = 1"))
+	assert.NotContains(t, stored, "earn", "message encrypted")
+
+	res, err := fps.Recent(ts.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, int64(3), res[0].UserID, "newest first")
+	assert.Equal(t, BanFingerprint{UserID: 1, UserName: "spammer", DisplayName: "Crypto Bob", Message: "earn 1000$ a day",
+		Timestamp: ts}, res[1])
+	res, err = fps.Recent(time.Time{}, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	require.NoError(t, fps.Remove(3))
+	res, err = fps.Recent(time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+
+	n, err := fps.Expire(24 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	res, err = fps.Recent(time.Time{}, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, int64(1), res[0].UserID)
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks encrypted values, values without it are treated as plain text, i.e. stored before encryption enabled
+const encryptedPrefix = "enc:v1:"
+
+// Cipher encrypts and decrypts stored message texts with AES-GCM.
+// The key is derived from the secret with sha256, so any non-empty secret can be used.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher makes a new Cipher for the given secret
+func NewCipher(secret string) (*Cipher, error) {
+	if secret == "" {
+		return nil, errors.New("empty encryption key")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to make aes cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make gcm: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt encrypts the text, nonce is random for each call. Empty text is kept empty.
+func (c *Cipher) Encrypt(text string) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to make nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(text), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the text made by Encrypt. Text without encryption prefix is returned as is.
+func (c *Cipher) Decrypt(text string) (string, error) {
+	encoded, ok := strings.CutPrefix(text, encryptedPrefix)
+	if !ok {
+		return text, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted text: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("encrypted text is too short")
+	}
+	nonce, data := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	res, err := c.aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt text: %w", err)
+	}
+	return string(res), nil
+}
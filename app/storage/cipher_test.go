@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher(t *testing.T) {
+	_, err := NewCipher("")
+	assert.Error(t, err)
+
+	c, err := NewCipher("secret")
+	require.NoError(t, err)
+
+	enc1, err := c.Encrypt("buy now")
+	require.NoError(t, err)
+	enc2, err := c.Encrypt("buy now")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enc1, encryptedPrefix))
+	assert.NotContains(t, enc1, "buy now")
+	assert.NotEqual(t, enc1, enc2, "random nonce")
+
+	dec, err := c.Decrypt(enc1)
+	require.NoError(t, err)
+	assert.Equal(t, "buy now", dec)
+
+	enc, err := c.Encrypt("")
+	require.NoError(t, err)
+	assert.Equal(t, "", enc, "empty text kept")
+
+	dec, err = c.Decrypt("plain text")
+	require.NoError(t, err)
+	assert.Equal(t, "plain text", dec, "not encrypted text returned as is")
+
+	other, err := NewCipher("other secret")
+	require.NoError(t, err)
+	_, err = other.Decrypt(enc1)
+	assert.Error(t, err, "wrong key")
+	_, err = c.Decrypt(encryptedPrefix + "!!!")
+	assert.Error(t, err, "bad encoding")
+	_, err = c.Decrypt(encryptedPrefix + "AAAA")
+	assert.Error(t, err, "too short")
+}
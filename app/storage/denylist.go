@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Denylist is a storage of confirmed spammers and hashes of their messages, shared between tg-spam instances.
+// Local entries are added on bans and exported to peers, imported entries come from peers and expire.
+// Removed entries are kept as tombstones, so unbans are propagated to peers as well.
+type Denylist struct {
+	db *sqlx.DB
+}
+
+// DenylistKind is a kind of denylist entry
+type DenylistKind string
+
+// enum of denylist entry kinds
+const (
+	DenylistUser DenylistKind = "user" // id of the user
+	DenylistHash DenylistKind = "hash" // sha256 hash of spam message, as Locator.MsgHash
+	DenylistNorm DenylistKind = "norm" // sha256 hash of normalized spam message, see normalizeMsg
+)
+
+// DenylistMinMsgLen is the min length of messages, in runes, listed by hash.
+// Short messages like "hi" are not listed, as they are posted by everyone.
+const DenylistMinMsgLen = 20
+
+// DenylistEntry is an entry of the denylist
+type DenylistEntry struct {
+	Kind      DenylistKind `db:"kind" json:"kind"`
+	Value     string       `db:"value" json:"value"` // user id or message hash
+	UserID    int64        `db:"user_id" json:"user_id"`
+	Source    string       `db:"source" json:"-"` // empty for local entries, url of the peer for imported ones
+	Timestamp time.Time    `db:"timestamp" json:"timestamp"`
+	Removed   bool         `db:"removed" json:"removed,omitempty"` // true if the user was unbanned
+}
+
+// NewDenylist creates a new Denylist storage
+func NewDenylist(db *sqlx.DB) (*Denylist, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate denylist: %w", err)
+	}
+	return &Denylist{db: db}, nil
+}
+
+// Add lists the banned user, the hash of the spam message and the hash of the normalized message,
+// empty or short message is not listed. Entries already imported from peers are kept as is,
+// so they are not exported back.
+func (d *Denylist) Add(userID int64, msg string) error {
+	for _, e := range DenylistEntries(userID, msg, time.Now().UTC()) {
+		// removed entry is listed again as local, i.e. the user unbanned by mistake and banned again
+		_, err := d.db.NamedExec(`INSERT INTO denylist (kind, value, user_id, source, timestamp, removed)
+			VALUES (:kind, :value, :user_id, '', :timestamp, 0)
+			ON CONFLICT(kind, value) DO UPDATE SET source = '', timestamp = excluded.timestamp, removed = 0
+			WHERE denylist.removed`, e)
+		if err != nil {
+			return fmt.Errorf("failed to add %s of user %d to denylist: %w", e.Kind, userID, err)
+		}
+	}
+	return nil
+}
+
+// DenylistEntries returns entries listing the banned user and the spam message, as added by Add: the user, the hash
+// of the message and the hash of the normalized message, empty or short message is not listed.
+func DenylistEntries(userID int64, msg string, ts time.Time) []DenylistEntry {
+	res := []DenylistEntry{{Kind: DenylistUser, Value: strconv.FormatInt(userID, 10), UserID: userID, Timestamp: ts}}
+	if utf8.RuneCountInString(msg) >= DenylistMinMsgLen {
+		res = append(res, DenylistEntry{Kind: DenylistHash, Value: msgHash(msg), UserID: userID, Timestamp: ts})
+	}
+	if norm, ok := normMsgHash(msg); ok {
+		res = append(res, DenylistEntry{Kind: DenylistNorm, Value: norm, UserID: userID, Timestamp: ts})
+	}
+	return res
+}
+
+// Remove marks all entries of the user as removed, i.e. on unban. Removal of local entries is exported to peers.
+// Imported entries keep timestamps of the peer, as they are used to continue the sync.
+func (d *Denylist) Remove(userID int64) error {
+	_, err := d.db.Exec(`UPDATE denylist SET removed = 1, timestamp = CASE WHEN source = '' THEN ? ELSE timestamp END
+		WHERE user_id = ? AND NOT removed`, time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove user %d from denylist: %w", userID, err)
+	}
+	return nil
+}
+
+// Check returns the entry listing the user or the message, false if neither is listed. The message is matched
+// exactly, or normalized, so trivially mutated repeats of listed spam, i.e. with other numbers or links, are matched too.
+func (d *Denylist) Check(userID int64, msg string) (DenylistEntry, bool) {
+	norm, _ := normMsgHash(msg) // hash of too short normalized message is never listed, so it can be checked anyway
+	// user entry is preferred over the message ones, and exact match of the message over the normalized one
+	var entry DenylistEntry
+	err := d.db.Get(&entry, `SELECT kind, value, user_id, source, timestamp, removed FROM denylist
+		WHERE ((kind = ? AND value = ?) OR (kind = ? AND value = ?) OR (kind = ? AND value = ?)) AND NOT removed
+		ORDER BY kind = ? DESC, kind LIMIT 1`,
+		DenylistUser, strconv.FormatInt(userID, 10), DenylistHash, msgHash(msg), DenylistNorm, norm, DenylistUser)
+	if err != nil {
+		return DenylistEntry{}, false
+	}
+	return entry, true
+}
+
+// Local returns local entries changed since the time, including removed ones, up to the limit, oldest first
+func (d *Denylist) Local(since time.Time, limit int) ([]DenylistEntry, error) {
+	res := []DenylistEntry{}
+	err := d.db.Select(&res, `SELECT kind, value, user_id, source, timestamp, removed FROM denylist
+		WHERE source = '' AND timestamp >= ? ORDER BY timestamp LIMIT ?`, since.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read denylist since %v: %w", since, err)
+	}
+	return res, nil
+}
+
+// Import adds entries of the peer, removed entries remove the ones imported from the same peer.
+// Local entries and entries of other peers are not changed. Returns the number of added and removed entries.
+func (d *Denylist) Import(source string, entries []DenylistEntry) (count int, err error) {
+	if source == "" {
+		return 0, errors.New("empty denylist source")
+	}
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start denylist import: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	for _, e := range entries {
+		if e.Kind != DenylistUser && e.Kind != DenylistHash && e.Kind != DenylistNorm {
+			continue // unknown kind of newer version of the peer
+		}
+		e.Source, e.Timestamp = source, e.Timestamp.UTC()
+		query := `INSERT INTO denylist (kind, value, user_id, source, timestamp, removed)
+			VALUES (:kind, :value, :user_id, :source, :timestamp, 0)
+			ON CONFLICT(kind, value) DO UPDATE SET timestamp = excluded.timestamp, removed = 0
+			WHERE denylist.source = excluded.source AND denylist.timestamp < excluded.timestamp`
+		if e.Removed {
+			query = `UPDATE denylist SET removed = 1, timestamp = :timestamp
+				WHERE kind = :kind AND value = :value AND source = :source AND NOT removed`
+		}
+		res, err := tx.NamedExec(query, e)
+		if err != nil {
+			return 0, fmt.Errorf("failed to import denylist %s %s of %s: %w", e.Kind, e.Value, source, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			count += int(n)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit denylist import: %w", err)
+	}
+	return count, nil
+}
+
+// Synced returns the time of the latest entry imported from the peer, zero time if nothing imported yet
+func (d *Denylist) Synced(source string) (time.Time, error) {
+	var res DenylistEntry
+	err := d.db.Get(&res, `SELECT kind, value, user_id, source, timestamp, removed FROM denylist
+		WHERE source = ? ORDER BY timestamp DESC LIMIT 1`, source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get denylist sync time of %s: %w", source, err)
+	}
+	return res.Timestamp, nil
+}
+
+// Expire removes imported entries and removed local entries older than ttl. Returns the number of removed entries.
+func (d *Denylist) Expire(ttl time.Duration) (int64, error) {
+	res, err := d.db.Exec("DELETE FROM denylist WHERE (source != '' OR removed) AND timestamp < ?", time.Now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire denylist: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// urlRe matches links in messages, replaced by placeholder on normalization
+var urlRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.|t\.me/)\S+`)
+
+// normalizeMsg returns the message with trivial mutations of spam repeats removed: links are replaced by "<url>",
+// numbers, punctuation, emoji and other symbols are removed, letters are lower-cased and whitespace is collapsed.
+// I.e. "Earn $501 today!! https://t.me/x" and "earn $502 today 🔥 https://t.me/y" are both "earn today <url>".
+func normalizeMsg(msg string) string {
+	words := []string{}
+	addWords := func(s string) {
+		words = append(words, strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsMark(r) // marks are parts of letters in some scripts
+		})...)
+	}
+	last := 0
+	for _, loc := range urlRe.FindAllStringIndex(msg, -1) {
+		addWords(msg[last:loc[0]])
+		words = append(words, "<url>")
+		last = loc[1]
+	}
+	addWords(msg[last:])
+	return strings.Join(words, " ")
+}
+
+// normMsgHash returns sha256 hash of the normalized message, false if the normalized message is shorter than
+// DenylistMinMsgLen, as such messages are too generic to be matched after normalization
+func normMsgHash(msg string) (string, bool) {
+	norm := normalizeMsg(msg)
+	return msgHash(norm), utf8.RuneCountInString(norm) >= DenylistMinMsgLen
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenylist(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "denylist.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	dl, err := NewDenylist(db)
+	require.NoError(t, err)
+
+	spam := "buy crypto signals now, join our channel"
+	require.NoError(t, dl.Add(1, spam))
+	require.NoError(t, dl.Add(2, "short spam"))
+
+	entry, ok := dl.Check(1, "hello")
+	require.True(t, ok)
+	assert.Equal(t, DenylistUser, entry.Kind)
+	assert.Equal(t, "1", entry.Value)
+	assert.Empty(t, entry.Source)
+
+	entry, ok = dl.Check(3, spam)
+	require.True(t, ok, "listed by hash of the message")
+	assert.Equal(t, DenylistHash, entry.Kind)
+	assert.Equal(t, int64(1), entry.UserID)
+
+	entry, ok = dl.Check(3, "Buy crypto SIGNALS now!!! 🚀 join our channel")
+	require.True(t, ok, "listed by hash of the normalized message")
+	assert.Equal(t, DenylistNorm, entry.Kind)
+	assert.Equal(t, int64(1), entry.UserID)
+
+	_, ok = dl.Check(3, "short spam")
+	assert.False(t, ok, "short message not listed by hash")
+	_, ok = dl.Check(2, "")
+	assert.True(t, ok)
+
+	local, err := dl.Local(time.Time{}, 10)
+	require.NoError(t, err)
+	assert.Len(t, local, 4)
+	local, err = dl.Local(time.Time{}, 1)
+	require.NoError(t, err)
+	assert.Len(t, local, 1)
+	local, err = dl.Local(time.Now().Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Empty(t, local)
+
+	t.Run("remove", func(t *testing.T) {
+		since := time.Now()
+		require.NoError(t, dl.Remove(2))
+		_, ok := dl.Check(2, "")
+		assert.False(t, ok)
+		local, err := dl.Local(since, 10)
+		require.NoError(t, err)
+		require.Len(t, local, 1, "removal exported")
+		assert.True(t, local[0].Removed)
+		assert.Equal(t, int64(2), local[0].UserID)
+
+		require.NoError(t, dl.Add(2, ""))
+		_, ok = dl.Check(2, "")
+		assert.True(t, ok, "listed again")
+	})
+
+	t.Run("import", func(t *testing.T) {
+		ts := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+		synced, err := dl.Synced("https://peer")
+		require.NoError(t, err)
+		assert.True(t, synced.IsZero())
+
+		count, err := dl.Import("https://peer", []DenylistEntry{
+			{Kind: DenylistUser, Value: "10", UserID: 10, Timestamp: ts},
+			{Kind: DenylistUser, Value: "11", UserID: 11, Timestamp: ts.Add(time.Minute)},
+			{Kind: DenylistUser, Value: "1", UserID: 1, Timestamp: ts}, // listed locally
+			{Kind: "ip", Value: "127.0.0.1", Timestamp: ts},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		entry, ok := dl.Check(10, "")
+		require.True(t, ok)
+		assert.Equal(t, "https://peer", entry.Source)
+		entry, ok = dl.Check(1, "")
+		require.True(t, ok)
+		assert.Empty(t, entry.Source, "local entry kept")
+
+		synced, err = dl.Synced("https://peer")
+		require.NoError(t, err)
+		assert.Equal(t, ts.Add(time.Minute), synced)
+
+		local, err := dl.Local(time.Time{}, 10)
+		require.NoError(t, err)
+		assert.Len(t, local, 4, "imported entries not exported")
+
+		count, err = dl.Import("https://peer", []DenylistEntry{{Kind: DenylistUser, Value: "10", UserID: 10,
+			Timestamp: ts.Add(2 * time.Minute), Removed: true}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		_, ok = dl.Check(10, "")
+		assert.False(t, ok, "removed by peer")
+
+		count, err = dl.Import("https://other", []DenylistEntry{{Kind: DenylistUser, Value: "11", UserID: 11,
+			Timestamp: ts, Removed: true}})
+		require.NoError(t, err)
+		assert.Zero(t, count, "entry of another peer not removed")
+
+		require.NoError(t, dl.Remove(11))
+		_, ok = dl.Check(11, "")
+		assert.False(t, ok, "imported entry removed on unban")
+		synced, err = dl.Synced("https://peer")
+		require.NoError(t, err)
+		assert.Equal(t, ts.Add(2*time.Minute), synced, "timestamps of peer kept")
+
+		_, err = dl.Import("", nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		n, err := dl.Expire(30 * time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n, "imported entries of the peer expired")
+		_, ok := dl.Check(1, "")
+		assert.True(t, ok, "local entry kept")
+		synced, err := dl.Synced("https://peer")
+		require.NoError(t, err)
+		assert.True(t, synced.IsZero())
+	})
+}
+
+func TestDenylistEntries(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	res := DenylistEntries(1, "buy crypto signals now, join our channel", ts)
+	require.Len(t, res, 3)
+	assert.Equal(t, DenylistEntry{Kind: DenylistUser, Value: "1", UserID: 1, Timestamp: ts}, res[0])
+	assert.Equal(t, DenylistHash, res[1].Kind)
+	assert.Equal(t, msgHash("buy crypto signals now, join our channel"), res[1].Value)
+	assert.Equal(t, DenylistNorm, res[2].Kind)
+
+	res = DenylistEntries(2, "hi", ts)
+	assert.Equal(t, []DenylistEntry{{Kind: DenylistUser, Value: "2", UserID: 2, Timestamp: ts}}, res, "short message not listed")
+}
+
+func TestDenylist_normalizeMsg(t *testing.T) {
+	tbl := []struct {
+		in, exp string
+	}{
+		{"earn $501 today!!", "earn today"},
+		{"Earn $502   TODAY 🔥🔥", "earn today"},
+		{"join https://t.me/xyz123 and www.example.com/a?b=1 now", "join <url> and <url> now"},
+		{"join t.me/abc, now", "join <url> now"},
+		{"привет, 100% бонус!", "привет бонус"},
+		{"café naïve", "café naïve"},
+		{"123 456 !!!", ""},
+		{"", ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.exp, normalizeMsg(tt.in))
+		})
+	}
+
+	h1, ok := normMsgHash("earn $501 today, details in my profile!!")
+	assert.True(t, ok)
+	h2, ok := normMsgHash("EARN $502 today 💰 details in my profile")
+	assert.True(t, ok)
+	assert.Equal(t, h1, h2)
+	_, ok = normMsgHash("earn $501 today!!!!!!!!!!!!!")
+	assert.False(t, ok, "normalized message too short")
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // sqlite driver loaded here
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// DetectedSpam is a storage for detected spam messages with all check results and the action taken.
+// It is an audit trail of detections, used for stats, false-positive analysis and re-training.
+type DetectedSpam struct {
+	db     *sqlx.DB
+	cipher *Cipher // optional, encrypts message texts at rest
+}
+
+// DetectedSpamInfo represents a single detection
+type DetectedSpamInfo struct {
+	ID         int64             `db:"id"`
+	Timestamp  time.Time         `db:"timestamp"`
+	ChatID     int64             `db:"chat_id"`
+	UserID     int64             `db:"user_id"`
+	UserName   string            `db:"user_name"`
+	Text       string            `db:"text"`
+	Action     string            `db:"action"` // action taken, i.e. ban, dry or training
+	ChecksJSON string            `db:"checks"` // checks as json, internal field to store checks in the db
+	Checks     []lib.CheckResult `db:"-"`
+	Reversed   sql.NullTime      `db:"reversed"` // time of reversal by admin, i.e. false positive
+}
+
+// NewDetectedSpam creates a new DetectedSpam storage
+func NewDetectedSpam(db *sqlx.DB) (*DetectedSpam, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate detected_spam: %w", err)
+	}
+	return &DetectedSpam{db: db}, nil
+}
+
+// WithCipher enables encryption of stored message texts. Texts stored before remain readable.
+func (ds *DetectedSpam) WithCipher(c *Cipher) { ds.cipher = c }
+
+// Write adds a detection to the storage. Zero timestamp is set to the current time.
+func (ds *DetectedSpam) Write(entry DetectedSpamInfo) error {
+	checks, err := json.Marshal(entry.Checks)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checks: %w", err)
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	entry.ChecksJSON = string(checks)
+	if ds.cipher != nil {
+		if entry.Text, err = ds.cipher.Encrypt(entry.Text); err != nil {
+			return fmt.Errorf("failed to encrypt text: %w", err)
+		}
+	}
+	_, err = ds.db.NamedExec(`INSERT INTO detected_spam (timestamp, chat_id, user_id, user_name, text, action, checks)
+		VALUES (:timestamp, :chat_id, :user_id, :user_name, :text, :action, :checks)`, entry)
+	if err != nil {
+		return fmt.Errorf("failed to insert detected spam: %w", err)
+	}
+	return nil
+}
+
+// Read returns the latest detections, up to the limit, newest first
+func (ds *DetectedSpam) Read(limit int) ([]DetectedSpamInfo, error) {
+	res := []DetectedSpamInfo{}
+	err := ds.db.Select(&res, `SELECT id, timestamp, chat_id, user_id, user_name, text, action, checks, reversed
+		FROM detected_spam ORDER BY timestamp DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read detected spam: %w", err)
+	}
+	for i := range res {
+		if err := ds.decode(&res[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// ReadByUser returns the latest detections of the user in all chats, up to the limit, newest first
+func (ds *DetectedSpam) ReadByUser(userID int64, limit int) ([]DetectedSpamInfo, error) {
+	res := []DetectedSpamInfo{}
+	err := ds.db.Select(&res, `SELECT id, timestamp, chat_id, user_id, user_name, text, action, checks, reversed
+		FROM detected_spam WHERE user_id = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read detected spam of user %d: %w", userID, err)
+	}
+	for i := range res {
+		if err := ds.decode(&res[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// BansQuery is a query of detections banned by the bot, i.e. to unban false positives of a bad check
+type BansQuery struct {
+	From  time.Time // start of time range, inclusive, not limited if zero
+	To    time.Time // end of time range, exclusive, not limited if zero
+	Check string    // name of spam check detected the message, i.e. stopword, any check if empty
+}
+
+// Bans returns detections banned by the bot and not reversed yet, matching the query, oldest first
+func (ds *DetectedSpam) Bans(q BansQuery) ([]DetectedSpamInfo, error) {
+	query := `SELECT id, timestamp, chat_id, user_id, user_name, text, action, checks, reversed
+		FROM detected_spam WHERE action = 'ban' AND reversed IS NULL`
+	args := []any{}
+	if !q.From.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		query += " AND timestamp < ?"
+		args = append(args, q.To)
+	}
+	entries := []DetectedSpamInfo{}
+	if err := ds.db.Select(&entries, query+" ORDER BY timestamp, id", args...); err != nil {
+		return nil, fmt.Errorf("failed to read banned detections: %w", err)
+	}
+	res := make([]DetectedSpamInfo, 0, len(entries))
+	for i := range entries {
+		if err := ds.decode(&entries[i]); err != nil {
+			return nil, err
+		}
+		if q.Check == "" || slices.ContainsFunc(entries[i].Checks, func(cr lib.CheckResult) bool {
+			return cr.Spam && cr.Name == q.Check
+		}) {
+			res = append(res, entries[i])
+		}
+	}
+	return res, nil
+}
+
+// DetectionsQuery is a filter of detections with cursor pagination, fields not set are not filtered
+type DetectionsQuery struct {
+	From    time.Time // start of time range, inclusive
+	To      time.Time // end of time range, exclusive
+	UserID  int64
+	Check   string // name of spam check detected the message, i.e. stopword
+	Verdict string // "spam" for detections not reversed, "ham" for reversed by admin as false positive
+	Action  string // action taken, i.e. ban, dry or training
+	Search  string // words the message text contains, case-insensitive, all words should match
+	Before  int64  // cursor, id of the last detection of the previous page
+	Limit   int
+}
+
+// findBatchSize is the number of detections read at once to match search words, texts can be encrypted
+const findBatchSize = 500
+
+// Find returns detections matching the query, up to the limit, newest first, and true if more detections match.
+// Search words are matched after decryption, so detections are scanned in batches until the page is filled.
+func (ds *DetectedSpam) Find(q DetectionsQuery) (res []DetectedSpamInfo, more bool, err error) {
+	where, args := []string{}, []any{}
+	if !q.From.IsZero() {
+		where, args = append(where, "timestamp >= ?"), append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where, args = append(where, "timestamp < ?"), append(args, q.To)
+	}
+	if q.UserID != 0 {
+		where, args = append(where, "user_id = ?"), append(args, q.UserID)
+	}
+	if q.Action != "" {
+		where, args = append(where, "action = ?"), append(args, q.Action)
+	}
+	switch q.Verdict {
+	case "":
+	case "spam":
+		where = append(where, "reversed IS NULL")
+	case "ham":
+		where = append(where, "reversed IS NOT NULL")
+	default:
+		return nil, false, fmt.Errorf("invalid verdict %q, expected spam or ham", q.Verdict)
+	}
+	if q.Check != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM json_each(detected_spam.checks) AS c
+			WHERE json_extract(c.value, '$.name') = ? AND json_extract(c.value, '$.spam') = 1)`)
+		args = append(args, q.Check)
+	}
+	words := strings.Fields(strings.ToLower(q.Search))
+	batch := q.Limit + 1 // one more to know if there are more detections
+	if len(words) > 0 {
+		batch = max(batch, findBatchSize)
+	}
+
+	res = []DetectedSpamInfo{}
+	for cursor := q.Before; ; {
+		query := `SELECT id, timestamp, chat_id, user_id, user_name, text, action, checks, reversed FROM detected_spam`
+		cond, condArgs := where, args
+		if cursor != 0 {
+			cond = append(slices.Clip(cond), "(timestamp, id) < (SELECT timestamp, id FROM detected_spam WHERE id = ?)")
+			condArgs = append(slices.Clip(condArgs), cursor)
+		}
+		if len(cond) > 0 {
+			query += " WHERE " + strings.Join(cond, " AND ")
+		}
+		entries := []DetectedSpamInfo{}
+		if err = ds.db.Select(&entries, query+" ORDER BY timestamp DESC, id DESC LIMIT ?", append(condArgs, batch)...); err != nil {
+			return nil, false, fmt.Errorf("failed to find detections: %w", err)
+		}
+		for i := range entries {
+			if err = ds.decode(&entries[i]); err != nil {
+				return nil, false, err
+			}
+			if !containsWords(entries[i].Text, words) {
+				continue
+			}
+			if len(res) == q.Limit {
+				return res, true, nil
+			}
+			res = append(res, entries[i])
+		}
+		if len(entries) < batch {
+			return res, false, nil
+		}
+		cursor = entries[len(entries)-1].ID
+	}
+}
+
+// containsWords checks if the text contains all lower-cased words, case-insensitive
+func containsWords(text string, words []string) bool {
+	text = strings.ToLower(text)
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the detection by id
+func (ds *DetectedSpam) Get(id int64) (DetectedSpamInfo, error) {
+	var res DetectedSpamInfo
+	err := ds.db.Get(&res, `SELECT id, timestamp, chat_id, user_id, user_name, text, action, checks, reversed
+		FROM detected_spam WHERE id = ?`, id)
+	if err != nil {
+		return res, fmt.Errorf("failed to get detected spam %d: %w", id, err)
+	}
+	return res, ds.decode(&res)
+}
+
+// decode unmarshals checks and decrypts text of the detection read from the db
+func (ds *DetectedSpam) decode(entry *DetectedSpamInfo) error {
+	if err := json.Unmarshal([]byte(entry.ChecksJSON), &entry.Checks); err != nil {
+		return fmt.Errorf("failed to unmarshal checks for %d: %w", entry.ID, err)
+	}
+	if ds.cipher != nil {
+		text, err := ds.cipher.Decrypt(entry.Text)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt text for %d: %w", entry.ID, err)
+		}
+		entry.Text = text
+	}
+	return nil
+}
+
+// SetReversed marks the latest not reversed detection of the user in the chat as reversed by admin, i.e. false positive.
+// Returns false if no such detection found.
+func (ds *DetectedSpam) SetReversed(chatID, userID int64) (bool, error) {
+	res, err := ds.db.Exec(`UPDATE detected_spam SET reversed = ? WHERE id = (SELECT id FROM detected_spam
+		WHERE chat_id = ? AND user_id = ? AND reversed IS NULL ORDER BY timestamp DESC, id DESC LIMIT 1)`,
+		time.Now(), chatID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to set reversed for %d: %w", userID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get updated count for %d: %w", userID, err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestDetectedSpam_WriteRead(t *testing.T) {
+	file, err := os.CreateTemp("", "test_detected_spam")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	db, err := NewSqliteDB(file.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	ds, err := NewDetectedSpam(db)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	checks := []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"}, {Name: "emoji", Spam: false, Details: "0/2"}}
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts, ChatID: 123, UserID: 1, UserName: "user1",
+		Text: "buy now", Action: "ban", Checks: checks}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{ChatID: 123, UserID: 2, UserName: "user2", Text: "spam 2", Action: "dry"}))
+
+	res, err := ds.Read(10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+
+	assert.Equal(t, int64(2), res[0].UserID, "newest first")
+	assert.Equal(t, "dry", res[0].Action)
+	assert.Empty(t, res[0].Checks)
+	assert.True(t, res[0].Timestamp.After(ts), "zero timestamp set to now")
+
+	assert.Equal(t, int64(1), res[1].UserID)
+	assert.Equal(t, "user1", res[1].UserName)
+	assert.Equal(t, int64(123), res[1].ChatID)
+	assert.Equal(t, "buy now", res[1].Text)
+	assert.Equal(t, "ban", res[1].Action)
+	assert.Equal(t, checks, res[1].Checks)
+	assert.True(t, ts.Equal(res[1].Timestamp))
+
+	res, err = ds.Read(1)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, int64(2), res[0].UserID)
+	assert.False(t, res[0].Reversed.Valid)
+
+	_, err = ds.SetReversed(123, 1)
+	require.NoError(t, err)
+	entry, err := ds.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, "buy now", entry.Text)
+	assert.Equal(t, checks, entry.Checks)
+	assert.True(t, entry.Reversed.Valid)
+
+	_, err = ds.Get(100)
+	assert.Error(t, err)
+}
+
+func TestDetectedSpam_ReadByUser(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "detected.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ds, err := NewDetectedSpam(db)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts, ChatID: 100, UserID: 1, Text: "spam 1", Action: "ban",
+		Checks: []lib.CheckResult{{Name: "stopword", Spam: true}}}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts.Add(time.Hour), ChatID: 200, UserID: 1, Text: "spam 2",
+		Action: "dry"}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts, ChatID: 100, UserID: 2, Text: "other", Action: "ban"}))
+
+	res, err := ds.ReadByUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "spam 2", res[0].Text, "newest first, all chats")
+	assert.Equal(t, "spam 1", res[1].Text)
+	assert.Equal(t, []lib.CheckResult{{Name: "stopword", Spam: true}}, res[1].Checks)
+
+	res, err = ds.ReadByUser(1, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	res, err = ds.ReadByUser(3, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestDetectedSpam_Bans(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "detected.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ds, err := NewDetectedSpam(db)
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stopword := []lib.CheckResult{{Name: "stopword", Spam: true}, {Name: "similarity", Spam: false}}
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts, ChatID: 100, UserID: 1, Text: "spam 1", Action: "ban",
+		Checks: stopword}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts.Add(time.Hour), ChatID: 100, UserID: 2, Text: "spam 2",
+		Action: "ban", Checks: []lib.CheckResult{{Name: "similarity", Spam: true}}}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts.Add(2 * time.Hour), ChatID: 100, UserID: 3, Text: "spam 3",
+		Action: "ban", Checks: stopword}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts.Add(time.Hour), ChatID: 100, UserID: 4, Text: "dry",
+		Action: "dry", Checks: stopword}))
+	_, err = ds.SetReversed(100, 3)
+	require.NoError(t, err)
+
+	tbl := []struct {
+		name  string
+		q     BansQuery
+		users []int64
+	}{
+		{name: "all", q: BansQuery{}, users: []int64{1, 2}},
+		{name: "by check", q: BansQuery{Check: "stopword"}, users: []int64{1}},
+		{name: "not spam check", q: BansQuery{Check: "similarity", To: ts.Add(time.Hour)}, users: []int64{}},
+		{name: "from", q: BansQuery{From: ts.Add(time.Minute)}, users: []int64{2}},
+		{name: "to", q: BansQuery{To: ts.Add(time.Hour)}, users: []int64{1}},
+		{name: "unknown check", q: BansQuery{Check: "openai"}, users: []int64{}},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ds.Bans(tt.q)
+			require.NoError(t, err)
+			users := []int64{}
+			for _, r := range res {
+				users = append(users, r.UserID)
+			}
+			assert.Equal(t, tt.users, users)
+		})
+	}
+}
+
+func TestDetectedSpam_Find(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "detected.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ds, err := NewDetectedSpam(db)
+	require.NoError(t, err)
+	c, err := NewCipher("secret")
+	require.NoError(t, err)
+	ds.WithCipher(c)
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stopword := []lib.CheckResult{{Name: "stopword", Spam: true}, {Name: "similarity", Spam: false}}
+	similarity := []lib.CheckResult{{Name: "similarity", Spam: true}}
+	for i, d := range []DetectedSpamInfo{
+		{UserID: 1, Text: "Buy Crypto now", Action: "ban", Checks: stopword},
+		{UserID: 2, Text: "easy money", Action: "ban", Checks: similarity},
+		{UserID: 1, Text: "crypto signals, buy", Action: "dry", Checks: stopword},
+		{UserID: 3, Text: "Крипта и заработок", Action: "ban", Checks: similarity},
+		{UserID: 4, Text: "buy crypto here", Action: "ban", Checks: similarity},
+	} {
+		d.Timestamp, d.ChatID = ts.Add(time.Duration(i)*time.Hour), 100
+		require.NoError(t, ds.Write(d))
+	}
+	_, err = ds.SetReversed(100, 2)
+	require.NoError(t, err)
+
+	tbl := []struct {
+		name  string
+		q     DetectionsQuery
+		ids   []int64
+		more  bool
+		error string
+	}{
+		{name: "all", q: DetectionsQuery{Limit: 10}, ids: []int64{5, 4, 3, 2, 1}},
+		{name: "first page", q: DetectionsQuery{Limit: 2}, ids: []int64{5, 4}, more: true},
+		{name: "next page", q: DetectionsQuery{Limit: 2, Before: 4}, ids: []int64{3, 2}, more: true},
+		{name: "last page", q: DetectionsQuery{Limit: 2, Before: 2}, ids: []int64{1}},
+		{name: "time range", q: DetectionsQuery{From: ts.Add(time.Hour), To: ts.Add(3 * time.Hour), Limit: 10}, ids: []int64{3, 2}},
+		{name: "user", q: DetectionsQuery{UserID: 1, Limit: 10}, ids: []int64{3, 1}},
+		{name: "check", q: DetectionsQuery{Check: "stopword", Limit: 10}, ids: []int64{3, 1}},
+		{name: "not spam check", q: DetectionsQuery{Check: "similarity", To: ts.Add(time.Hour), Limit: 10}, ids: []int64{}},
+		{name: "spam verdict", q: DetectionsQuery{Verdict: "spam", Action: "ban", Limit: 10}, ids: []int64{5, 4, 1}},
+		{name: "ham verdict", q: DetectionsQuery{Verdict: "ham", Limit: 10}, ids: []int64{2}},
+		{name: "search", q: DetectionsQuery{Search: "CRYPTO buy", Limit: 10}, ids: []int64{5, 3, 1}},
+		{name: "search page", q: DetectionsQuery{Search: "crypto buy", Limit: 1, Before: 5}, ids: []int64{3}, more: true},
+		{name: "search unicode", q: DetectionsQuery{Search: "крипта", Limit: 10}, ids: []int64{4}},
+		{name: "invalid verdict", q: DetectionsQuery{Verdict: "maybe", Limit: 10}, error: `invalid verdict "maybe"`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, more, err := ds.Find(tt.q)
+			if tt.error != "" {
+				assert.ErrorContains(t, err, tt.error)
+				return
+			}
+			require.NoError(t, err)
+			ids := []int64{}
+			for _, r := range res {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tt.ids, ids)
+			assert.Equal(t, tt.more, more)
+		})
+	}
+
+	t.Run("search in batches", func(t *testing.T) {
+		for i := 0; i < findBatchSize+10; i++ { // newer than all detections found
+			require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: ts.Add(5*time.Hour + time.Duration(i)*time.Minute), ChatID: 100,
+				UserID: 10, Text: "filler", Action: "ban"}))
+		}
+		res, more, err := ds.Find(DetectionsQuery{Search: "crypto", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, int64(5), res[0].ID)
+		assert.True(t, more)
+	})
+}
+
+func TestDetectedSpam_Encrypted(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "detected.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	ds, err := NewDetectedSpam(db)
+	require.NoError(t, err)
+
+	require.NoError(t, ds.Write(DetectedSpamInfo{UserID: 1, Text: "plain spam", Action: "ban"}))
+	c, err := NewCipher("secret")
+	require.NoError(t, err)
+	ds.WithCipher(c)
+	require.NoError(t, ds.Write(DetectedSpamInfo{UserID: 2, Text: "secret spam", Action: "ban"}))
+
+	var stored string
+	require.NoError(t, db.Get(&stored, "SELECT text FROM detected_spam WHERE user_id = 2"))
+	assert.NotContains(t, stored, "secret spam", "text encrypted at rest")
+
+	res, err := ds.Read(10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "secret spam", res[0].Text)
+	assert.Equal(t, "plain spam", res[1].Text, "text stored before encryption readable")
+}
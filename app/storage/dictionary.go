@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // sqlite driver loaded here
+)
+
+// Dictionary is a storage for stop-phrases and ignored (excluded) words.
+// Each entry is kept as is, i.e. a line of the stop-words file.
+type Dictionary struct {
+	db   *sqlx.DB
+	lock sync.RWMutex
+}
+
+// DictionaryType is a type of the dictionary entry
+type DictionaryType string
+
+// enum of dictionary types
+const (
+	DictionaryTypeStopPhrase  DictionaryType = "stop_phrase"
+	DictionaryTypeIgnoredWord DictionaryType = "ignored_word"
+)
+
+// DictionaryEntry is a single dictionary entry with its metadata
+type DictionaryEntry struct {
+	ID        int64          `db:"id" json:"id"`
+	Timestamp time.Time      `db:"timestamp" json:"timestamp"`
+	Type      DictionaryType `db:"type" json:"type"`
+	Data      string         `db:"data" json:"data"`
+}
+
+// NewDictionary creates a new Dictionary storage
+func NewDictionary(db *sqlx.DB) (*Dictionary, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate dictionary: %w", err)
+	}
+	return &Dictionary{db: db}, nil
+}
+
+// Add adds an entry to the dictionary, duplicates are ignored
+func (d *Dictionary) Add(t DictionaryType, data string) error {
+	if err := validateDictionaryType(t); err != nil {
+		return err
+	}
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return fmt.Errorf("empty %s entry", t)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	_, err := d.db.Exec("INSERT OR IGNORE INTO dictionary (type, data, timestamp) VALUES (?, ?, ?)", t, data, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to add %s entry: %w", t, err)
+	}
+	return nil
+}
+
+// Delete removes an entry by its id
+func (d *Dictionary) Delete(id int64) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, err := d.db.Exec("DELETE FROM dictionary WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete dictionary entry %d: %w", id, err)
+	}
+	return nil
+}
+
+// Read returns all entries of the given type, ordered by id
+func (d *Dictionary) Read(t DictionaryType) ([]DictionaryEntry, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	res := []DictionaryEntry{}
+	err := d.db.Select(&res, "SELECT id, timestamp, type, data FROM dictionary WHERE type = ? ORDER BY id", t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s entries: %w", t, err)
+	}
+	return res, nil
+}
+
+// Reader returns a reader for entries of the given type, one entry per line.
+// This is the format used by stop-words and excluded tokens files, so it can be used to export entries as well.
+func (d *Dictionary) Reader(t DictionaryType) (io.ReadCloser, error) {
+	entries, err := d.Read(t)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(entry.Data + "\n")
+	}
+	return io.NopCloser(strings.NewReader(sb.String())), nil
+}
+
+// Import reads entries from the reader, one entry per line, and adds them to the dictionary.
+// If withCleanup is true, all existing entries of the given type are removed first.
+// Returns number of imported entries.
+func (d *Dictionary) Import(t DictionaryType, r io.Reader, withCleanup bool) (count int, err error) {
+	if err = validateDictionaryType(t); err != nil {
+		return 0, err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	tx, err := d.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	var committed bool
+	defer func() {
+		// rollback if not committed due to error
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("[WARN] failed to rollback transaction: %v", err)
+			}
+		}
+	}()
+
+	if withCleanup {
+		if _, err = tx.Exec("DELETE FROM dictionary WHERE type = ?", t); err != nil {
+			return 0, fmt.Errorf("failed to cleanup %s entries: %w", t, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+		if _, err = tx.Exec("INSERT OR IGNORE INTO dictionary (type, data, timestamp) VALUES (?, ?, ?)", t, data, time.Now()); err != nil {
+			return 0, fmt.Errorf("failed to import %s entry: %w", t, err)
+		}
+		count++
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s entries: %w", t, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return count, nil
+}
+
+func validateDictionaryType(t DictionaryType) error {
+	if t != DictionaryTypeStopPhrase && t != DictionaryTypeIgnoredWord {
+		return fmt.Errorf("invalid dictionary type %q", t)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDictionary(t *testing.T) {
+	file, err := os.CreateTemp("", "test_dictionary")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	db, err := NewSqliteDB(file.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	d, err := NewDictionary(db)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Add(DictionaryTypeStopPhrase, "phrase 1"))
+	require.NoError(t, d.Add(DictionaryTypeStopPhrase, "phrase 1"), "duplicates ignored")
+	require.NoError(t, d.Add(DictionaryTypeIgnoredWord, "the"))
+	assert.Error(t, d.Add("bad", "word"))
+	assert.Error(t, d.Add(DictionaryTypeIgnoredWord, " "))
+
+	res, err := d.Read(DictionaryTypeStopPhrase)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "phrase 1", res[0].Data)
+
+	count, err := d.Import(DictionaryTypeStopPhrase, strings.NewReader("phrase 2\n\"phrase 3\", \"phrase 4\"\n"), true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	r, err := d.Reader(DictionaryTypeStopPhrase)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "phrase 2\n\"phrase 3\", \"phrase 4\"\n", string(data), "lines kept as is, old entries removed")
+
+	res, err = d.Read(DictionaryTypeIgnoredWord)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.NoError(t, d.Delete(res[0].ID))
+	res, err = d.Read(DictionaryTypeIgnoredWord)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqlite result codes for locked database, see https://www.sqlite.org/rescode.html
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// QueryInfo describes a single executed query, passed to the query hook
+type QueryInfo struct {
+	Query    string
+	Duration time.Duration
+	Err      error
+	Busy     bool // query failed because the database is locked
+}
+
+// QueryStats is a summary of all queries executed by sqlite databases made with NewSqliteDB
+type QueryStats struct {
+	Queries  int64         // number of queries
+	Errors   int64         // number of failed queries, including busy ones
+	Busy     int64         // number of queries failed because the database is locked
+	Slow     int64         // number of queries slower than the slow query threshold
+	Duration time.Duration // total duration of all queries
+}
+
+var queryMetrics struct {
+	queries, errors, busy, slow, duration atomic.Int64
+	slowThreshold                         atomic.Int64 // in nanoseconds, 0 disables slow queries logging
+
+	hookLock sync.RWMutex
+	hook     func(QueryInfo)
+}
+
+// SetQueryHook sets a hook called after each query, i.e. to export metrics. nil removes the hook.
+// The hook is called synchronously, so it should be fast.
+func SetQueryHook(fn func(QueryInfo)) {
+	queryMetrics.hookLock.Lock()
+	defer queryMetrics.hookLock.Unlock()
+	queryMetrics.hook = fn
+}
+
+// SetSlowQueryThreshold sets the duration above which queries are logged as slow, 0 disables logging
+func SetSlowQueryThreshold(threshold time.Duration) {
+	queryMetrics.slowThreshold.Store(int64(threshold))
+}
+
+// CurrentQueryStats returns a summary of all queries executed so far
+func CurrentQueryStats() QueryStats {
+	return QueryStats{
+		Queries:  queryMetrics.queries.Load(),
+		Errors:   queryMetrics.errors.Load(),
+		Busy:     queryMetrics.busy.Load(),
+		Slow:     queryMetrics.slow.Load(),
+		Duration: time.Duration(queryMetrics.duration.Load()),
+	}
+}
+
+// trackQuery records query metrics, logs slow and busy queries and calls the query hook
+func trackQuery(query string, start time.Time, err error) {
+	info := QueryInfo{Query: query, Duration: time.Since(start), Err: err, Busy: isBusy(err)}
+	queryMetrics.queries.Add(1)
+	queryMetrics.duration.Add(int64(info.Duration))
+	if err != nil {
+		queryMetrics.errors.Add(1)
+	}
+	if info.Busy {
+		queryMetrics.busy.Add(1)
+		log.Printf("[WARN] database is locked, query %q failed after %v", compactQuery(query), info.Duration)
+	}
+	if threshold := time.Duration(queryMetrics.slowThreshold.Load()); threshold > 0 && info.Duration > threshold {
+		queryMetrics.slow.Add(1)
+		log.Printf("[WARN] slow query %q took %v", compactQuery(query), info.Duration)
+	}
+
+	queryMetrics.hookLock.RLock()
+	hook := queryMetrics.hook
+	queryMetrics.hookLock.RUnlock()
+	if hook != nil {
+		hook(info)
+	}
+}
+
+// isBusy checks if the error is caused by locked database
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff // primary result code, without extended part
+	return code == sqliteBusy || code == sqliteLocked
+}
+
+// compactQuery collapses whitespace of multi-line queries for logging
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// connector makes instrumented connections to sqlite database
+type connector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+// Connect opens a new instrumented connection
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+// Driver returns the underlying driver
+func (c *connector) Driver() driver.Driver { return c.driver }
+
+// instrumentedConn tracks queries executed directly on connection or in transaction.
+// It expects the underlying connection to support context methods, as sqlite connection does.
+type instrumentedConn struct {
+	driver.Conn
+}
+
+// ExecContext executes and tracks the query
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	trackQuery(query, start, err)
+	return res, err
+}
+
+// QueryContext executes and tracks the query, reading of the rows is not included in the duration
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	trackQuery(query, start, err)
+	return rows, err
+}
+
+// PrepareContext prepares the statement, statements are not tracked
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+// BeginTx starts and tracks the transaction, begin and commit are tracked as separate queries
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	trackQuery("BEGIN", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx}, nil
+}
+
+// Ping checks the connection
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+// instrumentedTx tracks commit of the transaction
+type instrumentedTx struct {
+	driver.Tx
+}
+
+// Commit commits and tracks the transaction
+func (t *instrumentedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	trackQuery("COMMIT", start, err)
+	return err
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSqliteDB_Instrumented(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	var mode string
+	require.NoError(t, db.Get(&mode, "PRAGMA journal_mode"))
+	assert.Equal(t, "wal", mode)
+	var timeout int
+	require.NoError(t, db.Get(&timeout, "PRAGMA busy_timeout"))
+	assert.Equal(t, 5000, timeout)
+
+	var queries []QueryInfo
+	var lock sync.Mutex
+	SetQueryHook(func(q QueryInfo) {
+		lock.Lock()
+		queries = append(queries, q)
+		lock.Unlock()
+	})
+	defer SetQueryHook(nil)
+	SetSlowQueryThreshold(time.Nanosecond)
+	defer SetSlowQueryThreshold(0)
+
+	before := CurrentQueryStats()
+	_, err = db.Exec("CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+	tx, err := db.Beginx()
+	require.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO t (id) VALUES (?)", 1)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	_, err = db.Exec("INSERT INTO bad (id) VALUES (1)")
+	require.Error(t, err)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, queries, 5)
+	assert.Equal(t, "CREATE TABLE t (id INTEGER)", queries[0].Query)
+	assert.Equal(t, "BEGIN", queries[1].Query)
+	assert.Equal(t, "COMMIT", queries[3].Query)
+	assert.Error(t, queries[4].Err)
+	assert.False(t, queries[4].Busy)
+
+	after := CurrentQueryStats()
+	assert.Equal(t, int64(5), after.Queries-before.Queries)
+	assert.Equal(t, int64(1), after.Errors-before.Errors)
+	assert.Equal(t, int64(5), after.Slow-before.Slow)
+	assert.True(t, after.Duration > before.Duration)
+}
+
+func TestNewSqliteDB_LowMemory(t *testing.T) {
+	SetLowMemory(true)
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "test.db"))
+	SetLowMemory(false)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var cacheSize, tempStore int
+	require.NoError(t, db.Get(&cacheSize, "PRAGMA cache_size"))
+	assert.Equal(t, -256, cacheSize)
+	require.NoError(t, db.Get(&tempStore, "PRAGMA temp_store"))
+	assert.Equal(t, 1, tempStore, "file")
+	var mode string
+	require.NoError(t, db.Get(&mode, "PRAGMA journal_mode"))
+	assert.Equal(t, "wal", mode, "default params kept")
+
+	db2, err := NewSqliteDB(filepath.Join(t.TempDir(), "test2.db"))
+	require.NoError(t, err)
+	defer db2.Close()
+	require.NoError(t, db2.Get(&cacheSize, "PRAGMA cache_size"))
+	assert.Equal(t, -2000, cacheSize, "default cache size")
+}
+
+func TestNewSqliteDB_Busy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.db")
+	db1, err := NewSqliteDB(file)
+	require.NoError(t, err)
+	defer db1.Close()
+	db2, err := NewSqliteDB(file)
+	require.NoError(t, err)
+	defer db2.Close()
+	_, err = db1.Exec("CREATE TABLE t (id INTEGER)")
+	require.NoError(t, err)
+	_, err = db2.Exec("PRAGMA busy_timeout = 10")
+	require.NoError(t, err)
+
+	tx, err := db1.Beginx() // immediate transaction, takes write lock
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	db2.SetMaxOpenConns(1) // to keep busy_timeout set above
+	before := CurrentQueryStats()
+	_, err = db2.Exec("INSERT INTO t (id) VALUES (1)")
+	require.Error(t, err)
+	assert.True(t, isBusy(err))
+	assert.Equal(t, int64(1), CurrentQueryStats().Busy-before.Busy)
+}
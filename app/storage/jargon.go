@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Jargon is a storage of counts of tokens in ham messages of the group. Tokens used in a large share
+// of messages are group jargon, i.e. names of the project or local slang, adding noise to the classifier.
+// They are suggested as excluded tokens, and admins apply or dismiss suggestions.
+type Jargon struct {
+	db        *sqlx.DB
+	maxTokens int // max number of counted tokens not reviewed yet, the rarest ones are removed on add
+}
+
+// JargonStatus is a status of review of the suggested token
+type JargonStatus string
+
+// enum of jargon statuses
+const (
+	JargonStatusNew       JargonStatus = ""          // not reviewed yet
+	JargonStatusApplied   JargonStatus = "applied"   // added to excluded tokens
+	JargonStatusDismissed JargonStatus = "dismissed" // not jargon, not suggested anymore
+)
+
+// JargonToken is a token counted in ham messages
+type JargonToken struct {
+	Token     string       `db:"token" json:"token"`
+	Messages  int          `db:"messages" json:"messages"` // number of messages with the token
+	Share     float64      `db:"-" json:"share"`           // share of messages with the token, 0-1
+	Status    JargonStatus `db:"status" json:"status"`
+	UpdatedAt time.Time    `db:"updated_at" json:"updated_at"`
+}
+
+// defaultJargonMaxTokens is the max number of counted tokens, if not set
+const defaultJargonMaxTokens = 10000
+
+// NewJargon creates a new Jargon storage, keeping up to maxTokens counted tokens, 10000 if not set
+func NewJargon(db *sqlx.DB, maxTokens int) (*Jargon, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate jargon: %w", err)
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultJargonMaxTokens
+	}
+	return &Jargon{db: db, maxTokens: maxTokens}, nil
+}
+
+// Add adds counts of tokens in the number of messages. tokens is a number of messages with the token.
+// The rarest tokens not reviewed yet are removed if there are more than maxTokens.
+func (j *Jargon) Add(tokens map[string]int, messages int) error {
+	tx, err := j.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // rollback after commit is no-op
+
+	now := time.Now().UTC()
+	for token, count := range tokens {
+		_, err = tx.Exec(`INSERT INTO jargon (token, messages, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(token) DO UPDATE SET messages = messages + excluded.messages, updated_at = excluded.updated_at`,
+			token, count, now)
+		if err != nil {
+			return fmt.Errorf("failed to add jargon token %q: %w", token, err)
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO jargon_total (id, messages) VALUES (1, ?)
+		ON CONFLICT(id) DO UPDATE SET messages = messages + excluded.messages`, messages)
+	if err != nil {
+		return fmt.Errorf("failed to add jargon messages: %w", err)
+	}
+	_, err = tx.Exec(`DELETE FROM jargon WHERE status = '' AND token NOT IN
+		(SELECT token FROM jargon WHERE status = '' ORDER BY messages DESC LIMIT ?)`, j.maxTokens)
+	if err != nil {
+		return fmt.Errorf("failed to remove rare jargon tokens: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit jargon: %w", err)
+	}
+	return nil
+}
+
+// Suggestions returns tokens not reviewed yet, used in minShare of messages or more, up to the limit,
+// the most frequent first. Nothing is suggested till minMessages are counted. Returns the number of counted messages.
+func (j *Jargon) Suggestions(minShare float64, minMessages, limit int) (total int, res []JargonToken, err error) {
+	if err = j.db.Get(&total, "SELECT messages FROM jargon_total WHERE id = 1"); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, nil, fmt.Errorf("failed to read jargon messages: %w", err)
+	}
+	res = []JargonToken{}
+	if total == 0 || total < minMessages {
+		return total, res, nil
+	}
+	err = j.db.Select(&res, `SELECT token, messages, status, updated_at FROM jargon
+		WHERE status = '' AND messages >= ? ORDER BY messages DESC, token LIMIT ?`, minShare*float64(total), limit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read jargon suggestions: %w", err)
+	}
+	for i := range res {
+		res[i].Share = float64(res[i].Messages) / float64(total)
+	}
+	return total, res, nil
+}
+
+// SetStatus sets the status of review of the token, i.e. applied or dismissed
+func (j *Jargon) SetStatus(token string, status JargonStatus) error {
+	res, err := j.db.Exec("UPDATE jargon SET status = ?, updated_at = ? WHERE token = ?", status, time.Now().UTC(), token)
+	if err != nil {
+		return fmt.Errorf("failed to set status of jargon token %q: %w", token, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("jargon token %q not found", token)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJargon(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "jargon.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	j, err := NewJargon(db, 3)
+	require.NoError(t, err)
+
+	total, res, err := j.Suggestions(0.1, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, res, "nothing counted")
+
+	require.NoError(t, j.Add(map[string]int{"tgspam": 5, "detector": 3, "hello": 1, "rare": 1}, 10))
+	require.NoError(t, j.Add(map[string]int{"tgspam": 4, "hello": 2}, 10))
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM jargon"))
+	assert.Equal(t, 3, count, "the rarest token removed")
+
+	total, res, err = j.Suggestions(0.1, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 20, total)
+	require.Len(t, res, 3)
+	assert.Equal(t, "tgspam", res[0].Token)
+	assert.Equal(t, 9, res[0].Messages)
+	assert.InDelta(t, 0.45, res[0].Share, 0.001)
+	assert.Equal(t, JargonStatusNew, res[0].Status)
+	assert.Equal(t, []string{"detector", "hello"}, []string{res[1].Token, res[2].Token}, "same count sorted by token")
+
+	_, res, err = j.Suggestions(0.2, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, res, 1, "share of detector and hello is 15%")
+	_, res, err = j.Suggestions(0.1, 0, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1, "limited")
+	total, res, err = j.Suggestions(0.1, 100, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 20, total)
+	assert.Empty(t, res, "not enough messages")
+
+	require.NoError(t, j.SetStatus("tgspam", JargonStatusApplied))
+	require.NoError(t, j.SetStatus("hello", JargonStatusDismissed))
+	require.Error(t, j.SetStatus("unknown", JargonStatusDismissed))
+	_, res, err = j.Suggestions(0.1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 1, "reviewed tokens not suggested")
+	assert.Equal(t, "detector", res[0].Token)
+
+	require.NoError(t, j.Add(map[string]int{"new1": 1, "new2": 1, "new3": 1}, 3))
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM jargon WHERE status != ''"))
+	assert.Equal(t, 2, count, "reviewed tokens kept")
+}
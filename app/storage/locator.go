@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -15,11 +16,14 @@ import (
 
 // Locator stores messages metadata and spam results for a given ttl period.
 // It is used to locate the message in the chat by its hash and to retrieve spam check results by userID.
+// All records are scoped by chat, so the same message or user in different chats don't match each other.
 // Useful to match messages from admin chat (only text available) to the original message and to get spam results using UserID.
+// Texts of messages are kept for the same period, to train spam samples with messages of purged spammers.
 type Locator struct {
 	ttl     time.Duration
 	minSize int
 	db      *sqlx.DB
+	cipher  *Cipher // optional, encrypts message texts at rest
 }
 
 // MsgMeta stores message metadata
@@ -29,6 +33,8 @@ type MsgMeta struct {
 	UserID   int64     `db:"user_id"`
 	UserName string    `db:"user_name"`
 	MsgID    int       `db:"msg_id"`
+	Text     string    `db:"text"`     // text of the message, set by ChatMessages, RecentMessages and Original only
+	Entities string    `db:"entities"` // formatting of the text, json of telegram entities, set by Original only
 }
 
 // SpamData stores spam data for a given user
@@ -39,25 +45,8 @@ type SpamData struct {
 
 // NewLocator creates new Locator. ttl defines how long to keep messages in db, minSize defines the minimum number of messages to keep
 func NewLocator(ttl time.Duration, minSize int, db *sqlx.DB) (*Locator, error) {
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS messages (
-		hash TEXT PRIMARY KEY,
-		time TIMESTAMP,
-		chat_id INTEGER,
-		user_id INTEGER,
-		user_name TEXT,
-		msg_id INTEGER
-	)`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create messages table: %w", err)
-	}
-
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS spam (
-		user_id INTEGER PRIMARY KEY,
-		time TIMESTAMP,
-		checks TEXT
-	)`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create spam table: %w", err)
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate locator: %w", err)
 	}
 
 	return &Locator{
@@ -67,6 +56,9 @@ func NewLocator(ttl time.Duration, minSize int, db *sqlx.DB) (*Locator, error) {
 	}, nil
 }
 
+// WithCipher enables encryption of stored message texts. Texts stored before remain readable.
+func (l *Locator) WithCipher(c *Cipher) { l.cipher = c }
+
 // Close closes the database
 func (l *Locator) Close() error {
 	return l.db.Close()
@@ -77,8 +69,15 @@ func (l *Locator) AddMessage(msg string, chatID, userID int64, userName string,
 	hash := l.MsgHash(msg)
 	log.Printf("[DEBUG] add message to locator: %q, hash:%s, userID:%d, user name:%q, chatID:%d, msgID:%d",
 		msg, hash, userID, userName, chatID, msgID)
-	_, err := l.db.NamedExec(`INSERT OR REPLACE INTO messages (hash, time, chat_id, user_id, user_name, msg_id) 
-        VALUES (:hash, :time, :chat_id, :user_id, :user_name, :msg_id)`,
+	text := msg
+	if l.cipher != nil {
+		var err error
+		if text, err = l.cipher.Encrypt(msg); err != nil {
+			return fmt.Errorf("failed to encrypt message: %w", err)
+		}
+	}
+	_, err := l.db.NamedExec(`INSERT OR REPLACE INTO messages (hash, time, chat_id, user_id, user_name, msg_id, text) 
+        VALUES (:hash, :time, :chat_id, :user_id, :user_name, :msg_id, :text)`,
 		struct {
 			MsgMeta
 			Hash string `db:"hash"`
@@ -89,6 +88,7 @@ func (l *Locator) AddMessage(msg string, chatID, userID int64, userName string,
 				UserID:   userID,
 				UserName: userName,
 				MsgID:    msgID,
+				Text:     text,
 			},
 			Hash: hash,
 		})
@@ -98,15 +98,16 @@ func (l *Locator) AddMessage(msg string, chatID, userID int64, userName string,
 	return l.cleanupMessages()
 }
 
-// AddSpam adds spam data to the locator and also cleans up old spam data.
-func (l *Locator) AddSpam(userID int64, checks []lib.CheckResult) error {
+// AddSpam adds spam data of the user in the chat to the locator and also cleans up old spam data.
+func (l *Locator) AddSpam(chatID, userID int64, checks []lib.CheckResult) error {
 	checksStr, err := json.Marshal(checks)
 	if err != nil {
 		return fmt.Errorf("failed to marshal checks: %w", err)
 	}
-	_, err = l.db.NamedExec(`INSERT OR REPLACE INTO spam (user_id, time, checks) 
-        VALUES (:user_id, :time, :checks)`,
+	_, err = l.db.NamedExec(`INSERT OR REPLACE INTO spam (chat_id, user_id, time, checks) 
+        VALUES (:chat_id, :user_id, :time, :checks)`,
 		map[string]interface{}{
+			"chat_id": chatID,
 			"user_id": userID,
 			"time":    time.Now(),
 			"checks":  string(checksStr),
@@ -117,12 +118,13 @@ func (l *Locator) AddSpam(userID int64, checks []lib.CheckResult) error {
 	return l.cleanupSpam()
 }
 
-// Message returns message MsgMeta for given msg
+// Message returns message MsgMeta for given msg in the chat
 // this allows to match messages from admin chat (only text available) to the original message
-func (l *Locator) Message(msg string) (MsgMeta, bool) {
+func (l *Locator) Message(chatID int64, msg string) (MsgMeta, bool) {
 	var meta MsgMeta
 	hash := l.MsgHash(msg)
-	err := l.db.Get(&meta, `SELECT time, chat_id, user_id, user_name, msg_id FROM messages WHERE hash = ?`, hash)
+	err := l.db.Get(&meta, `SELECT time, chat_id, user_id, user_name, msg_id FROM messages WHERE chat_id = ? AND hash = ?`,
+		chatID, hash)
 	if err != nil {
 		log.Printf("[DEBUG] failed to find message by hash %q: %v", hash, err)
 		return MsgMeta{}, false
@@ -130,11 +132,49 @@ func (l *Locator) Message(msg string) (MsgMeta, bool) {
 	return meta, true
 }
 
-// Spam returns message SpamData for given msg
-func (l *Locator) Spam(userID int64) (SpamData, bool) {
+// AddEntities sets formatting of the text of the message added before, json of telegram entities,
+// i.e. bold text and links hidden behind text. Entities are encrypted as texts, if the cipher is set.
+func (l *Locator) AddEntities(chatID int64, msgID int, entities string) error {
+	if l.cipher != nil {
+		var err error
+		if entities, err = l.cipher.Encrypt(entities); err != nil {
+			return fmt.Errorf("failed to encrypt entities: %w", err)
+		}
+	}
+	if _, err := l.db.Exec(`UPDATE messages SET entities = ? WHERE chat_id = ? AND msg_id = ?`, entities, chatID, msgID); err != nil {
+		return fmt.Errorf("failed to set entities of message %d: %w", msgID, err)
+	}
+	return nil
+}
+
+// Original returns the message by its id in the chat, with text and formatting, false if the message is not kept
+func (l *Locator) Original(chatID int64, msgID int) (MsgMeta, bool) {
+	res := []MsgMeta{}
+	err := l.db.Select(&res, `SELECT time, chat_id, user_id, user_name, msg_id, text, entities FROM messages
+		WHERE chat_id = ? AND msg_id = ? ORDER BY time DESC LIMIT 1`, chatID, msgID)
+	if err != nil || len(res) == 0 {
+		return MsgMeta{}, false
+	}
+	if l.cipher == nil {
+		return res[0], true
+	}
+	if res[0].Text, err = l.cipher.Decrypt(res[0].Text); err != nil {
+		log.Printf("[WARN] failed to decrypt message %d: %v", msgID, err)
+		return MsgMeta{}, false
+	}
+	if res[0].Entities, err = l.cipher.Decrypt(res[0].Entities); err != nil {
+		log.Printf("[WARN] failed to decrypt entities of message %d: %v", msgID, err)
+		return MsgMeta{}, false
+	}
+	return res[0], true
+}
+
+// Spam returns SpamData for given user in the chat
+func (l *Locator) Spam(chatID, userID int64) (SpamData, bool) {
 	var data SpamData
 	var checksStr string
-	err := l.db.QueryRow(`SELECT time, checks FROM spam WHERE user_id = ?`, userID).Scan(&data.Time, &checksStr)
+	err := l.db.QueryRow(`SELECT time, checks FROM spam WHERE chat_id = ? AND user_id = ?`, chatID, userID).
+		Scan(&data.Time, &checksStr)
 	if err != nil {
 		return SpamData{}, false
 	}
@@ -145,9 +185,64 @@ func (l *Locator) Spam(userID int64) (SpamData, bool) {
 	return data, true
 }
 
-// MsgHash returns sha256 hash of a message
-// we use hash to avoid storing potentially long messages and all we need is just match
+// UserMessages returns metadata of the latest messages of the user in all chats, up to the limit, newest first.
+// Only metadata is stored, texts of messages are not available.
+func (l *Locator) UserMessages(userID int64, limit int) ([]MsgMeta, error) {
+	res := []MsgMeta{}
+	err := l.db.Select(&res, `SELECT time, chat_id, user_id, user_name, msg_id FROM messages
+		WHERE user_id = ? ORDER BY time DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages of user %d: %w", userID, err)
+	}
+	return res, nil
+}
+
+// ChatMessages returns all stored messages of the user in the chat, with texts, oldest first.
+// Texts of messages stored before texts were kept are empty.
+func (l *Locator) ChatMessages(chatID, userID int64) ([]MsgMeta, error) {
+	res := []MsgMeta{}
+	err := l.db.Select(&res, `SELECT time, chat_id, user_id, user_name, msg_id, text FROM messages
+		WHERE chat_id = ? AND user_id = ? ORDER BY time`, chatID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read messages of user %d in chat %d: %w", userID, chatID, err)
+	}
+	return l.decryptTexts(res)
+}
+
+// RecentMessages returns up to limit last messages of all users in the chat, with texts, oldest first.
+// Messages of the chat kept in the locator only are returned, i.e. the last ones within the ttl.
+func (l *Locator) RecentMessages(chatID int64, limit int) ([]MsgMeta, error) {
+	res := []MsgMeta{}
+	err := l.db.Select(&res, `SELECT time, chat_id, user_id, user_name, msg_id, text FROM messages
+		WHERE chat_id = ? ORDER BY time DESC, msg_id DESC LIMIT ?`, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recent messages in chat %d: %w", chatID, err)
+	}
+	slices.Reverse(res)
+	return l.decryptTexts(res)
+}
+
+// decryptTexts decrypts texts of the messages in place, if the cipher is set
+func (l *Locator) decryptTexts(res []MsgMeta) ([]MsgMeta, error) {
+	if l.cipher == nil {
+		return res, nil
+	}
+	var err error
+	for i := range res {
+		if res[i].Text, err = l.cipher.Decrypt(res[i].Text); err != nil {
+			return nil, fmt.Errorf("failed to decrypt message %d: %w", res[i].MsgID, err)
+		}
+	}
+	return res, nil
+}
+
+// MsgHash returns sha256 hash of a message, messages are matched by hash
 func (l *Locator) MsgHash(msg string) string {
+	return msgHash(msg)
+}
+
+// msgHash returns sha256 hash of a message, shared by locator and denylist
+func msgHash(msg string) string {
 	return fmt.Sprintf("%x", sha256.Sum256([]byte(msg)))
 }
 
@@ -43,7 +43,7 @@ func TestLocator_AddAndRetrieveMessage(t *testing.T) {
 
 	require.NoError(t, locator.AddMessage(msg, chatID, userID, userName, msgID))
 
-	retrievedMsg, found := locator.Message(msg)
+	retrievedMsg, found := locator.Message(chatID, msg)
 	require.True(t, found)
 	assert.Equal(t, MsgMeta{Time: retrievedMsg.Time, ChatID: chatID, UserID: userID, UserName: userName, MsgID: msgID}, retrievedMsg)
 }
@@ -58,7 +58,7 @@ func TestLocator_AddAndRetrieveManyMessage(t *testing.T) {
 	}
 
 	for i := 0; i < 100; i++ {
-		retrievedMsg, found := locator.Message(fmt.Sprintf("test message %d", i))
+		retrievedMsg, found := locator.Message(1234, fmt.Sprintf("test message %d", i))
 		require.True(t, found)
 		assert.Equal(t, MsgMeta{Time: retrievedMsg.Time, ChatID: int64(1234), UserID: int64(i%10 + 1), UserName: "name" + strconv.Itoa(i%10+1), MsgID: i}, retrievedMsg)
 	}
@@ -70,11 +70,166 @@ func TestLocator_AddAndRetrieveSpam(t *testing.T) {
 	userID := int64(456)
 	checks := []lib.CheckResult{{Name: "test", Spam: true, Details: "test spam"}}
 
-	require.NoError(t, locator.AddSpam(userID, checks))
+	require.NoError(t, locator.AddSpam(100, userID, checks))
 
-	retrievedSpam, found := locator.Spam(userID)
+	retrievedSpam, found := locator.Spam(100, userID)
 	require.True(t, found)
 	assert.Equal(t, checks, retrievedSpam.Checks)
+
+	_, found = locator.Spam(200, userID)
+	assert.False(t, found, "spam results of another chat")
+}
+
+func TestLocator_ChatScope(t *testing.T) {
+	locator := newTestLocator(t)
+
+	require.NoError(t, locator.AddMessage("same message", 100, 1, "user1", 10))
+	require.NoError(t, locator.AddMessage("same message", 200, 2, "user2", 20))
+
+	meta, found := locator.Message(100, "same message")
+	require.True(t, found)
+	assert.Equal(t, int64(1), meta.UserID)
+	meta, found = locator.Message(200, "same message")
+	require.True(t, found)
+	assert.Equal(t, int64(2), meta.UserID, "not replaced by the same message in another chat")
+	_, found = locator.Message(300, "same message")
+	assert.False(t, found)
+}
+
+func TestLocator_UserMessages(t *testing.T) {
+	locator := newTestLocator(t)
+
+	require.NoError(t, locator.AddMessage("msg 1", 100, 1, "user1", 1))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, locator.AddMessage("msg 2", 200, 1, "user1", 2))
+	require.NoError(t, locator.AddMessage("msg 3", 100, 2, "user2", 3))
+
+	res, err := locator.UserMessages(1, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, MsgMeta{Time: res[0].Time, ChatID: 200, UserID: 1, UserName: "user1", MsgID: 2}, res[0], "newest first")
+	assert.Equal(t, 1, res[1].MsgID)
+
+	res, err = locator.UserMessages(1, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	res, err = locator.UserMessages(3, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func TestLocator_ChatMessages(t *testing.T) {
+	locator := newTestLocator(t)
+
+	require.NoError(t, locator.AddMessage("msg 1", 100, 1, "user1", 1))
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, locator.AddMessage("msg 2", 100, 1, "user1", 2))
+	require.NoError(t, locator.AddMessage("msg 3", 200, 1, "user1", 3))
+	require.NoError(t, locator.AddMessage("msg 4", 100, 2, "user2", 4))
+
+	res, err := locator.ChatMessages(100, 1)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, MsgMeta{Time: res[0].Time, ChatID: 100, UserID: 1, UserName: "user1", MsgID: 1, Text: "msg 1"}, res[0],
+		"oldest first")
+	assert.Equal(t, "msg 2", res[1].Text)
+
+	res, err = locator.ChatMessages(200, 2)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	t.Run("encrypted", func(t *testing.T) {
+		c, err := NewCipher("secret")
+		require.NoError(t, err)
+		locator.WithCipher(c)
+		require.NoError(t, locator.AddMessage("secret msg", 300, 5, "user5", 5))
+		var stored string
+		require.NoError(t, locator.db.Get(&stored, "SELECT text FROM messages WHERE msg_id = 5"))
+		assert.NotContains(t, stored, "secret msg")
+
+		res, err := locator.ChatMessages(300, 5)
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, "secret msg", res[0].Text)
+
+		res, err = locator.ChatMessages(100, 1)
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, "msg 1", res[0].Text, "stored before encryption")
+	})
+}
+
+func TestLocator_RecentMessages(t *testing.T) {
+	locator := newTestLocator(t)
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, locator.AddMessage(fmt.Sprintf("msg %d", i), 100, int64(i), fmt.Sprintf("user%d", i), i))
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, locator.AddMessage("other chat", 200, 1, "user1", 5))
+
+	res, err := locator.RecentMessages(100, 2)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, MsgMeta{Time: res[0].Time, ChatID: 100, UserID: 3, UserName: "user3", MsgID: 3, Text: "msg 3"}, res[0],
+		"oldest first")
+	assert.Equal(t, "msg 4", res[1].Text)
+
+	res, err = locator.RecentMessages(100, 10)
+	require.NoError(t, err)
+	assert.Len(t, res, 4)
+
+	res, err = locator.RecentMessages(300, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	c, err := NewCipher("secret")
+	require.NoError(t, err)
+	locator.WithCipher(c)
+	require.NoError(t, locator.AddMessage("secret msg", 100, 6, "user6", 6))
+	res, err = locator.RecentMessages(100, 2)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "msg 4", res[0].Text, "stored before encryption")
+	assert.Equal(t, "secret msg", res[1].Text)
+}
+
+func TestLocator_Original(t *testing.T) {
+	locator := newTestLocator(t)
+
+	require.NoError(t, locator.AddMessage("buy now", 100, 1, "user1", 10))
+	require.NoError(t, locator.AddEntities(100, 10, `[{"type":"text_link","offset":0,"length":3,"url":"https://spam.example.com"}]`))
+	require.NoError(t, locator.AddMessage("plain", 100, 1, "user1", 11))
+
+	res, ok := locator.Original(100, 10)
+	require.True(t, ok)
+	assert.Equal(t, MsgMeta{Time: res.Time, ChatID: 100, UserID: 1, UserName: "user1", MsgID: 10, Text: "buy now",
+		Entities: `[{"type":"text_link","offset":0,"length":3,"url":"https://spam.example.com"}]`}, res)
+	res, ok = locator.Original(100, 11)
+	require.True(t, ok)
+	assert.Equal(t, "plain", res.Text)
+	assert.Empty(t, res.Entities)
+	_, ok = locator.Original(200, 10)
+	assert.False(t, ok, "scoped by chat")
+	_, ok = locator.Original(100, 12)
+	assert.False(t, ok)
+
+	c, err := NewCipher("secret")
+	require.NoError(t, err)
+	locator.WithCipher(c)
+	require.NoError(t, locator.AddMessage("secret msg", 100, 2, "user2", 12))
+	require.NoError(t, locator.AddEntities(100, 12, `[{"type":"bold","offset":0,"length":6}]`))
+	var stored string
+	require.NoError(t, locator.db.Get(&stored, "SELECT entities FROM messages WHERE msg_id = 12"))
+	assert.NotContains(t, stored, "bold", "encrypted")
+	res, ok = locator.Original(100, 12)
+	require.True(t, ok)
+	assert.Equal(t, "secret msg", res.Text)
+	assert.Equal(t, `[{"type":"bold","offset":0,"length":6}]`, res.Entities)
+	res, ok = locator.Original(100, 10)
+	require.True(t, ok, "stored before encryption")
+	assert.Equal(t, "buy now", res.Text)
 }
 
 func TestLocator_CleanupLogic(t *testing.T) {
@@ -113,10 +268,10 @@ func TestLocator_RetrieveNonExistentMessage(t *testing.T) {
 	locator := newTestLocator(t)
 
 	msg := "non_existent_message"
-	_, found := locator.Message(msg)
+	_, found := locator.Message(1, msg)
 	assert.False(t, found, "expected to not find a non-existent message")
 
-	_, found = locator.Spam(1234)
+	_, found = locator.Spam(1, 1234)
 	assert.False(t, found, "expected to not find a non-existent spam")
 }
 
@@ -130,7 +285,7 @@ func TestLocator_SpamUnmarshalFailure(t *testing.T) {
 	require.NoError(t, err)
 
 	// Attempt to retrieve the spam data, which should fail during unmarshalling
-	_, found := locator.Spam(userID)
+	_, found := locator.Spam(0, userID)
 	assert.False(t, found, "expected to not find valid data due to unmarshalling failure")
 }
 
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrateLock prevents concurrent migrations of the same process, i.e. from multiple stores created in parallel
+var migrateLock sync.Mutex
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration is a single versioned schema change with up and down sql
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// Migrate applies all pending migrations to the database, in order of versions.
+// Applied versions are recorded in schema_version table, each migration runs in its own transaction.
+// It is safe to call it multiple times, all stores call it on creation.
+func Migrate(db *sqlx.DB) error {
+	migrateLock.Lock()
+	defer migrateLock.Unlock()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m.version, m.up, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, time.Now())
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", m.version, m.name, err)
+		}
+		log.Printf("[INFO] applied db migration %d_%s", m.version, m.name)
+	}
+	return nil
+}
+
+// Rollback reverts applied migrations down to the given version, i.e. 0 reverts all of them.
+func Rollback(db *sqlx.DB, version int) error {
+	migrateLock.Lock()
+	defer migrateLock.Unlock()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version <= version || m.version > current {
+			continue
+		}
+		if err := applyMigration(db, m.version, m.down, func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("DELETE FROM schema_version WHERE version = ?", m.version)
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to rollback migration %d_%s: %w", m.version, m.name, err)
+		}
+		log.Printf("[INFO] rolled back db migration %d_%s", m.version, m.name)
+	}
+	return nil
+}
+
+// SchemaVersion returns the current schema version of the database, 0 if no migrations applied
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	migrateLock.Lock()
+	defer migrateLock.Unlock()
+	return schemaVersion(db)
+}
+
+func schemaVersion(db *sqlx.DB) (version int, err error) {
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT,
+		applied_at TIMESTAMP
+	)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	if err = db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_version"); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// applyMigration runs migration sql and records the version change in a single transaction
+func applyMigration(db *sqlx.DB, version int, query string, recordFn func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	var committed bool
+	defer func() {
+		// rollback if not committed due to error
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("[WARN] failed to rollback transaction: %v", err)
+			}
+		}
+	}()
+
+	if _, err = tx.Exec(query); err != nil {
+		return fmt.Errorf("failed to exec migration %d: %w", version, err)
+	}
+	if err = recordFn(tx); err != nil {
+		return fmt.Errorf("failed to record schema version %d: %w", version, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// loadMigrations reads embedded migrations, each version must have both up and down sql
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		matches := migrationFileRe.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", entry.Name(), err)
+		}
+		data, err := migrationsFS.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", entry.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: matches[2]}
+			byVersion[version] = m
+		}
+		if matches[3] == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	res := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down sql", m.version, m.name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].version < res[j].version })
+	return res, nil
+}
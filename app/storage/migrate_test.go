@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+
+	ver, err := SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ver)
+
+	require.NoError(t, Migrate(db))
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].version
+	ver, err = SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, latest, ver)
+	for _, table := range []string{"approved_users", "messages", "spam", "samples", "dictionary", "detected_spam"} {
+		assert.True(t, tableExists(t, db, table), table)
+	}
+
+	require.NoError(t, Migrate(db), "second call is no-op")
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM schema_version"))
+	assert.Equal(t, len(migrations), count)
+
+	require.NoError(t, Rollback(db, 2))
+	ver, err = SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ver)
+	assert.True(t, tableExists(t, db, "messages"))
+	assert.False(t, tableExists(t, db, "samples"))
+	assert.False(t, tableExists(t, db, "detected_spam"))
+
+	require.NoError(t, Migrate(db))
+	assert.True(t, tableExists(t, db, "detected_spam"))
+
+	require.NoError(t, Rollback(db, 0))
+	ver, err = SchemaVersion(db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ver)
+	assert.False(t, tableExists(t, db, "approved_users"))
+}
+
+func TestMigrate_ExistingDB(t *testing.T) {
+	db := newTestDB(t)
+
+	// db made by the version without migrations
+	_, err := db.Exec("CREATE TABLE approved_users (id INTEGER PRIMARY KEY, timestamp DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO approved_users (id) VALUES (123)")
+	require.NoError(t, err)
+
+	au, err := NewApprovedUsers(db, "gr1")
+	require.NoError(t, err)
+	assert.NotNil(t, au)
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM approved_users"))
+	assert.Equal(t, 1, count, "existing data kept")
+	assert.True(t, tableExists(t, db, "samples"))
+
+	users, err := au.Users()
+	require.NoError(t, err)
+	require.Len(t, users, 1, "existing users claimed by the group")
+	assert.Equal(t, "123", users[0].UserID)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "versions are sequential")
+		assert.NotEmpty(t, m.name)
+		assert.NotEmpty(t, m.up)
+		assert.NotEmpty(t, m.down)
+	}
+}
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	file, err := os.CreateTemp("", "test_migrate")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(file.Name()) })
+	db, err := NewSqliteDB(file.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sqlx.DB, name string) bool {
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", name))
+	return count > 0
+}
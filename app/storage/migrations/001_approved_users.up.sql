@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS approved_users (
+    id INTEGER PRIMARY KEY,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS messages (
+    hash TEXT PRIMARY KEY,
+    time TIMESTAMP,
+    chat_id INTEGER,
+    user_id INTEGER,
+    user_name TEXT,
+    msg_id INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS spam (
+    user_id INTEGER PRIMARY KEY,
+    time TIMESTAMP,
+    checks TEXT
+);
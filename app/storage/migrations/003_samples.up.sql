@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS samples (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    type TEXT CHECK (type IN ('ham', 'spam')),
+    origin TEXT CHECK (origin IN ('preset', 'user')),
+    message TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS dictionary (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    type TEXT CHECK (type IN ('stop_phrase', 'ignored_word')),
+    data TEXT NOT NULL,
+    UNIQUE (type, data)
+);
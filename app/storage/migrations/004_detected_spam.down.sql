@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_detected_spam_timestamp;
+DROP TABLE IF EXISTS detected_spam;
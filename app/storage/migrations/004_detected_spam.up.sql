@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS detected_spam (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp TIMESTAMP,
+    chat_id INTEGER,
+    user_id INTEGER,
+    user_name TEXT,
+    text TEXT,
+    action TEXT,
+    checks TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_detected_spam_timestamp ON detected_spam(timestamp);
@@ -0,0 +1,4 @@
+ALTER TABLE approved_users DROP COLUMN name;
+ALTER TABLE approved_users DROP COLUMN count;
+ALTER TABLE approved_users DROP COLUMN first_seen;
+ALTER TABLE approved_users DROP COLUMN last_seen;
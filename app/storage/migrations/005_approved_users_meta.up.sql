@@ -0,0 +1,4 @@
+ALTER TABLE approved_users ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE approved_users ADD COLUMN count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE approved_users ADD COLUMN first_seen TIMESTAMP;
+ALTER TABLE approved_users ADD COLUMN last_seen TIMESTAMP;
@@ -0,0 +1,34 @@
+CREATE TABLE messages_global (
+    hash TEXT PRIMARY KEY,
+    time TIMESTAMP,
+    chat_id INTEGER,
+    user_id INTEGER,
+    user_name TEXT,
+    msg_id INTEGER
+);
+INSERT OR REPLACE INTO messages_global (hash, time, chat_id, user_id, user_name, msg_id)
+    SELECT hash, time, chat_id, user_id, user_name, msg_id FROM messages ORDER BY time;
+DROP TABLE messages;
+ALTER TABLE messages_global RENAME TO messages;
+
+CREATE TABLE spam_global (
+    user_id INTEGER PRIMARY KEY,
+    time TIMESTAMP,
+    checks TEXT
+);
+INSERT OR REPLACE INTO spam_global (user_id, time, checks) SELECT user_id, time, checks FROM spam ORDER BY time;
+DROP TABLE spam;
+ALTER TABLE spam_global RENAME TO spam;
+
+CREATE TABLE approved_users_global (
+    id INTEGER PRIMARY KEY,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL DEFAULT '',
+    count INTEGER NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP
+);
+INSERT OR REPLACE INTO approved_users_global (id, timestamp, name, count, first_seen, last_seen)
+    SELECT id, timestamp, name, count, first_seen, last_seen FROM approved_users ORDER BY timestamp;
+DROP TABLE approved_users;
+ALTER TABLE approved_users_global RENAME TO approved_users;
@@ -0,0 +1,41 @@
+CREATE TABLE messages_scoped (
+    hash TEXT,
+    time TIMESTAMP,
+    chat_id INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER,
+    user_name TEXT,
+    msg_id INTEGER,
+    PRIMARY KEY (chat_id, hash)
+);
+INSERT INTO messages_scoped (hash, time, chat_id, user_id, user_name, msg_id)
+    SELECT hash, time, COALESCE(chat_id, 0), user_id, user_name, msg_id FROM messages;
+DROP TABLE messages;
+ALTER TABLE messages_scoped RENAME TO messages;
+
+-- spam results stored before are not linked to any chat, they are kept with chat_id 0 till pruned
+CREATE TABLE spam_scoped (
+    chat_id INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER,
+    time TIMESTAMP,
+    checks TEXT,
+    PRIMARY KEY (chat_id, user_id)
+);
+INSERT INTO spam_scoped (chat_id, user_id, time, checks) SELECT 0, user_id, time, checks FROM spam;
+DROP TABLE spam;
+ALTER TABLE spam_scoped RENAME TO spam;
+
+-- approved users stored before have empty gid, they are claimed by the group on the first start
+CREATE TABLE approved_users_scoped (
+    gid TEXT NOT NULL DEFAULT '',
+    id INTEGER,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL DEFAULT '',
+    count INTEGER NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP,
+    PRIMARY KEY (gid, id)
+);
+INSERT INTO approved_users_scoped (gid, id, timestamp, name, count, first_seen, last_seen)
+    SELECT '', id, timestamp, name, count, first_seen, last_seen FROM approved_users;
+DROP TABLE approved_users;
+ALTER TABLE approved_users_scoped RENAME TO approved_users;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS message_stats;
+ALTER TABLE detected_spam DROP COLUMN reversed;
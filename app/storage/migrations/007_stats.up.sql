@@ -0,0 +1,11 @@
+-- time of admin's reversal of the detection, i.e. unban of false positive. NULL if not reversed
+ALTER TABLE detected_spam ADD COLUMN reversed TIMESTAMP;
+
+-- number of checked messages per hour and chat, spam is counted by detections
+CREATE TABLE IF NOT EXISTS message_stats (
+    hour TIMESTAMP,
+    chat_id INTEGER,
+    checked INTEGER NOT NULL DEFAULT 0,
+    spam INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (hour, chat_id)
+);
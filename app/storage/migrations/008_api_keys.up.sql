@@ -0,0 +1,21 @@
+-- api keys of the web server, only sha256 hash of the key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    hash TEXT NOT NULL UNIQUE,
+    scope TEXT NOT NULL,
+    created TIMESTAMP,
+    last_used TIMESTAMP,
+    uses INTEGER NOT NULL DEFAULT 0
+);
+
+-- audit of api key usage, a record per request
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key_id INTEGER NOT NULL,
+    timestamp TIMESTAMP,
+    method TEXT,
+    path TEXT,
+    status INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_api_key_usage_key_id ON api_key_usage(key_id, timestamp);
@@ -0,0 +1,11 @@
+-- audit of moderation actions made with webapi, with the acting credential
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp TIMESTAMP,
+    action TEXT NOT NULL,
+    chat_id INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER NOT NULL,
+    actor TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_timestamp ON moderation_actions(timestamp);
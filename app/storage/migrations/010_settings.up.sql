@@ -0,0 +1,6 @@
+-- settings changed at runtime, i.e. with webapi, kept to survive restarts
+CREATE TABLE IF NOT EXISTS settings (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
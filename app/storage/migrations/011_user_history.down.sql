@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_detected_spam_user_id;
+DROP INDEX IF EXISTS idx_moderation_actions_user_id;
+DROP INDEX IF EXISTS idx_messages_user_id;
@@ -0,0 +1,4 @@
+-- indexes to look up the history of a user, i.e. by GET /users/{id}
+CREATE INDEX IF NOT EXISTS idx_detected_spam_user_id ON detected_spam(user_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_user_id ON moderation_actions(user_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_user_id ON messages(user_id, time);
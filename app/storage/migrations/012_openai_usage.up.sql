@@ -0,0 +1,8 @@
+-- usage of openai per hour, number of requests, tokens and estimated cost
+CREATE TABLE IF NOT EXISTS openai_usage (
+    hour TIMESTAMP PRIMARY KEY,
+    requests INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_samples_source;
+ALTER TABLE samples DROP COLUMN source;
@@ -0,0 +1,4 @@
+-- provenance of samples, i.e. "base", "admin:<name>" or "api:<credential>", empty for user samples stored before
+ALTER TABLE samples ADD COLUMN source TEXT NOT NULL DEFAULT '';
+UPDATE samples SET source = 'base' WHERE origin = 'preset';
+CREATE INDEX IF NOT EXISTS idx_samples_source ON samples(source, timestamp);
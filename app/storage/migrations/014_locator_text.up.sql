@@ -0,0 +1,2 @@
+-- texts of located messages, to train spam samples with messages of purged spammers, empty for messages stored before
+ALTER TABLE messages ADD COLUMN text TEXT NOT NULL DEFAULT '';
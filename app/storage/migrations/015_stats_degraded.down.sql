@@ -0,0 +1 @@
+ALTER TABLE message_stats DROP COLUMN degraded;
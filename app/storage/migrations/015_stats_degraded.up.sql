@@ -0,0 +1,2 @@
+-- number of messages checked with skipped or interrupted checks, by check budget
+ALTER TABLE message_stats ADD COLUMN degraded INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- denylist of confirmed spammers and hashes of their messages, shared with peer instances.
+-- local entries have empty source, imported ones have url of the peer. removed entries are kept to propagate unbans.
+CREATE TABLE IF NOT EXISTS denylist (
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    source TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP,
+    removed BOOLEAN NOT NULL DEFAULT 0,
+    PRIMARY KEY (kind, value)
+);
+CREATE INDEX IF NOT EXISTS idx_denylist_source ON denylist(source, timestamp);
+CREATE INDEX IF NOT EXISTS idx_denylist_user_id ON denylist(user_id);
@@ -0,0 +1,10 @@
+-- fingerprints of banned users, to detect new accounts of them re-joining the group.
+-- message is the spam message the user was banned for, encrypted if encryption of stored texts is enabled.
+CREATE TABLE IF NOT EXISTS ban_fingerprints (
+    user_id INTEGER PRIMARY KEY,
+    user_name TEXT NOT NULL DEFAULT '',
+    display_name TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_ban_fingerprints_timestamp ON ban_fingerprints(timestamp);
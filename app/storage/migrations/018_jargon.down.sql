@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS jargon_total;
+DROP TABLE IF EXISTS jargon;
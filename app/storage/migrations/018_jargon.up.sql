@@ -0,0 +1,15 @@
+-- counts of tokens in ham messages of the group, to suggest frequent ones (group jargon) as excluded tokens.
+-- messages is the number of messages with the token, status is empty for suggestions not reviewed yet,
+-- "applied" or "dismissed" for reviewed ones.
+CREATE TABLE IF NOT EXISTS jargon (
+    token TEXT PRIMARY KEY,
+    messages INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_jargon_messages ON jargon(messages);
+-- the number of counted ham messages, a single row
+CREATE TABLE IF NOT EXISTS jargon_total (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    messages INTEGER NOT NULL DEFAULT 0
+);
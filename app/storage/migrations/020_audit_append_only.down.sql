@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_moderation_actions_action;
+DROP TRIGGER IF EXISTS moderation_actions_append_only;
@@ -0,0 +1,6 @@
+-- moderation audit is append-only, recorded actions can't be changed, old ones are removed by retention only
+CREATE TRIGGER IF NOT EXISTS moderation_actions_append_only BEFORE UPDATE ON moderation_actions
+BEGIN
+    SELECT RAISE(ABORT, 'moderation audit is append-only');
+END;
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_action ON moderation_actions(action, timestamp);
@@ -0,0 +1,8 @@
+-- users never banned by the bot, spam verdicts of them are reported to admins instead.
+-- added_by is "config" for users of options and file, replaced on start, or the admin added the user.
+CREATE TABLE IF NOT EXISTS protected_users (
+    user_id INTEGER PRIMARY KEY,
+    note TEXT NOT NULL DEFAULT '',
+    added_by TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP
+);
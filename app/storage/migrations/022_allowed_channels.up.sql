@@ -0,0 +1,8 @@
+-- channels and other chats allowed to post in the group on their behalf, i.e. the linked channel, messages are not checked.
+-- added_by is "config" for channels of options, replaced on start, or the admin allowed the channel.
+CREATE TABLE IF NOT EXISTS allowed_channels (
+    chat_id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    added_by TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP
+);
@@ -0,0 +1,2 @@
+-- formatting of texts of located messages, json of telegram entities, to show the original message to admins
+ALTER TABLE messages ADD COLUMN entities TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ModerationAudit is an append-only storage of moderation actions, i.e. bans and unbans by the bot, admins and webapi,
+// training and settings changes, with the actor of the action. Recorded actions can't be changed.
+type ModerationAudit struct {
+	db *sqlx.DB
+}
+
+// ModerationAction is an audit record of moderation action
+type ModerationAction struct {
+	ID        int64     `db:"id" json:"id"`
+	Timestamp time.Time `db:"timestamp" json:"timestamp"`
+	Action    string    `db:"action" json:"action"` // i.e. ban, unban, train or settings
+	ChatID    int64     `db:"chat_id" json:"chat_id"`
+	UserID    int64     `db:"user_id" json:"user_id"`           // 0 for actions not related to a user, i.e. settings change
+	Actor     string    `db:"actor" json:"actor"`               // "bot", admin, i.e. "admin:bob", or credential of webapi, i.e. "key:ci"
+	Details   string    `db:"details" json:"details,omitempty"` // reason or details, i.e. checks of the detection or duration of the ban
+}
+
+// AuditQuery is a filter of moderation actions, fields not set are not filtered
+type AuditQuery struct {
+	Action string
+	Actor  string
+	UserID int64
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	Limit  int
+}
+
+// NewModerationAudit creates a new ModerationAudit storage
+func NewModerationAudit(db *sqlx.DB) (*ModerationAudit, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate moderation audit: %w", err)
+	}
+	return &ModerationAudit{db: db}, nil
+}
+
+// Add records the action, timestamp is set to the current time if not set
+func (a *ModerationAudit) Add(action ModerationAction) error {
+	if action.Timestamp.IsZero() {
+		action.Timestamp = time.Now()
+	}
+	_, err := a.db.NamedExec(`INSERT INTO moderation_actions (timestamp, action, chat_id, user_id, actor, details)
+		VALUES (:timestamp, :action, :chat_id, :user_id, :actor, :details)`, action)
+	if err != nil {
+		return fmt.Errorf("failed to add moderation action %s of user %d: %w", action.Action, action.UserID, err)
+	}
+	return nil
+}
+
+// Read returns the latest actions matching the query, up to the limit, newest first
+func (a *ModerationAudit) Read(q AuditQuery) ([]ModerationAction, error) {
+	where, args := []string{}, []any{}
+	if q.Action != "" {
+		where, args = append(where, "action = ?"), append(args, q.Action)
+	}
+	if q.Actor != "" {
+		where, args = append(where, "actor = ?"), append(args, q.Actor)
+	}
+	if q.UserID != 0 {
+		where, args = append(where, "user_id = ?"), append(args, q.UserID)
+	}
+	if !q.From.IsZero() {
+		where, args = append(where, "timestamp >= ?"), append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where, args = append(where, "timestamp < ?"), append(args, q.To)
+	}
+	query := "SELECT id, timestamp, action, chat_id, user_id, actor, details FROM moderation_actions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	res := []ModerationAction{}
+	if err := a.db.Select(&res, query+" ORDER BY timestamp DESC, id DESC LIMIT ?", append(args, q.Limit)...); err != nil {
+		return nil, fmt.Errorf("failed to read moderation actions: %w", err)
+	}
+	return res, nil
+}
+
+// ReadByUser returns the latest actions on the user in all chats, up to the limit, newest first
+func (a *ModerationAudit) ReadByUser(userID int64, limit int) ([]ModerationAction, error) {
+	res := []ModerationAction{}
+	err := a.db.Select(&res, `SELECT id, timestamp, action, chat_id, user_id, actor, details FROM moderation_actions
+		WHERE user_id = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation actions of user %d: %w", userID, err)
+	}
+	return res, nil
+}
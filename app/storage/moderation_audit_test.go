@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerationAudit(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "audit.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	audit, err := NewModerationAudit(db)
+	require.NoError(t, err)
+
+	res, err := audit.Read(AuditQuery{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, audit.Add(ModerationAction{Timestamp: ts, Action: "ban", ChatID: 100, UserID: 1, Actor: "key:ci",
+		Details: "permanent"}))
+	require.NoError(t, audit.Add(ModerationAction{Timestamp: ts.Add(time.Minute), Action: "unban", ChatID: 100, UserID: 1,
+		Actor: "jwt:admin"}))
+	require.NoError(t, audit.Add(ModerationAction{Action: "ban", UserID: 2, Actor: "basic"}))
+
+	res, err = audit.Read(AuditQuery{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, int64(2), res[0].UserID, "newest first")
+	assert.WithinDuration(t, time.Now(), res[0].Timestamp, time.Minute, "timestamp set")
+	assert.Equal(t, "unban", res[1].Action)
+	assert.Equal(t, "jwt:admin", res[1].Actor)
+	assert.Equal(t, ModerationAction{ID: 1, Timestamp: ts, Action: "ban", ChatID: 100, UserID: 1, Actor: "key:ci",
+		Details: "permanent"}, res[2])
+
+	res, err = audit.Read(AuditQuery{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	t.Run("filtered", func(t *testing.T) {
+		res, err := audit.Read(AuditQuery{Action: "ban", Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, int64(2), res[0].UserID)
+
+		res, err = audit.Read(AuditQuery{Actor: "jwt:admin", Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, "unban", res[0].Action)
+
+		res, err = audit.Read(AuditQuery{UserID: 1, From: ts, To: ts.Add(time.Minute), Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, int64(1), res[0].ID, "to is exclusive")
+
+		res, err = audit.Read(AuditQuery{Action: "train", Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("append-only", func(t *testing.T) {
+		_, err := db.Exec("UPDATE moderation_actions SET actor = 'someone' WHERE id = 1")
+		require.ErrorContains(t, err, "moderation audit is append-only")
+		res, err := audit.ReadByUser(1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, "key:ci", res[1].Actor, "not changed")
+	})
+
+	t.Run("by user", func(t *testing.T) {
+		res, err := audit.ReadByUser(1, 10)
+		require.NoError(t, err)
+		require.Len(t, res, 2)
+		assert.Equal(t, "unban", res[0].Action, "newest first")
+		assert.Equal(t, "ban", res[1].Action)
+
+		res, err = audit.ReadByUser(1, 1)
+		require.NoError(t, err)
+		assert.Len(t, res, 1)
+
+		res, err = audit.ReadByUser(3, 10)
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+}
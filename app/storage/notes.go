@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UserNotes is a storage of notes of moderators about users, i.e. "warned twice for self-promo #promo",
+// informing future manual decisions. Words of the text starting with # are tags of the note.
+type UserNotes struct {
+	db *sqlx.DB
+}
+
+// UserNote is a note of moderator about the user
+type UserNote struct {
+	ID        int64     `db:"id" json:"id"`
+	Timestamp time.Time `db:"timestamp" json:"timestamp"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Text      string    `db:"text" json:"text"`
+	Tags      []string  `db:"-" json:"tags"`
+	Author    string    `db:"author" json:"author"` // i.e. "admin:bob" of /note command or "api:jwt:admin" of webapi
+}
+
+// userNoteRow is a row of user_notes, tags are kept space separated
+type userNoteRow struct {
+	UserNote
+	TagsList string `db:"tags"`
+}
+
+// NewUserNotes creates a new UserNotes storage
+func NewUserNotes(db *sqlx.DB) (*UserNotes, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate user notes: %w", err)
+	}
+	return &UserNotes{db: db}, nil
+}
+
+// Add adds the note and returns it with id and tags set. Timestamp is set to the current time if not set.
+func (n *UserNotes) Add(note UserNote) (UserNote, error) {
+	note.Text = strings.TrimSpace(note.Text)
+	if note.Text == "" {
+		return UserNote{}, fmt.Errorf("empty note of user %d", note.UserID)
+	}
+	if note.Timestamp.IsZero() {
+		note.Timestamp = time.Now()
+	}
+	note.Tags = NoteTags(note.Text)
+	res, err := n.db.NamedExec(`INSERT INTO user_notes (timestamp, user_id, text, tags, author)
+		VALUES (:timestamp, :user_id, :text, :tags, :author)`, userNoteRow{UserNote: note, TagsList: strings.Join(note.Tags, " ")})
+	if err != nil {
+		return UserNote{}, fmt.Errorf("failed to add note of user %d: %w", note.UserID, err)
+	}
+	if note.ID, err = res.LastInsertId(); err != nil {
+		return UserNote{}, fmt.Errorf("failed to get id of note of user %d: %w", note.UserID, err)
+	}
+	return note, nil
+}
+
+// ByUser returns the latest notes of the user, up to the limit, newest first
+func (n *UserNotes) ByUser(userID int64, limit int) ([]UserNote, error) {
+	rows := []userNoteRow{}
+	err := n.db.Select(&rows, `SELECT id, timestamp, user_id, text, tags, author FROM user_notes
+		WHERE user_id = ? ORDER BY timestamp DESC, id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes of user %d: %w", userID, err)
+	}
+	res := make([]UserNote, 0, len(rows))
+	for _, r := range rows {
+		r.Tags = strings.Fields(r.TagsList)
+		if r.Tags == nil {
+			r.Tags = []string{}
+		}
+		res = append(res, r.UserNote)
+	}
+	return res, nil
+}
+
+// Delete removes the note of the user, returns error if not found
+func (n *UserNotes) Delete(userID, id int64) error {
+	res, err := n.db.Exec("DELETE FROM user_notes WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete note %d of user %d: %w", id, userID, err)
+	}
+	if cnt, err := res.RowsAffected(); err == nil && cnt == 0 {
+		return fmt.Errorf("note %d of user %d not found", id, userID)
+	}
+	return nil
+}
+
+// NoteTags returns unique tags of the note text, words starting with #, lowercased and without the #
+func NoteTags(text string) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, w := range strings.Fields(text) {
+		if !strings.HasPrefix(w, "#") {
+			continue
+		}
+		tag := strings.ToLower(strings.TrimRight(strings.TrimPrefix(w, "#"), ".,!?:;)"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		res = append(res, tag)
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserNotes(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "notes.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	notes, err := NewUserNotes(db)
+	require.NoError(t, err)
+
+	res, err := notes.ByUser(1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	note, err := notes.Add(UserNote{Timestamp: ts, UserID: 1, Text: " warned twice for #self-promo, #Promo ", Author: "admin:bob"})
+	require.NoError(t, err)
+	assert.Equal(t, UserNote{ID: 1, Timestamp: ts, UserID: 1, Text: "warned twice for #self-promo, #Promo",
+		Tags: []string{"self-promo", "promo"}, Author: "admin:bob"}, note)
+	_, err = notes.Add(UserNote{UserID: 1, Text: "long time member", Author: "web:basic"})
+	require.NoError(t, err)
+	_, err = notes.Add(UserNote{UserID: 2, Text: "other user"})
+	require.NoError(t, err)
+	_, err = notes.Add(UserNote{UserID: 2, Text: "  "})
+	require.Error(t, err)
+
+	res, err = notes.ByUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "long time member", res[0].Text, "newest first")
+	assert.Equal(t, []string{}, res[0].Tags)
+	assert.Equal(t, note, res[1])
+
+	res, err = notes.ByUser(1, 1)
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	require.Error(t, notes.Delete(2, 1), "note of another user")
+	require.NoError(t, notes.Delete(1, 1))
+	require.Error(t, notes.Delete(1, 1))
+	res, err = notes.ByUser(1, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "long time member", res[0].Text)
+}
+
+func TestNoteTags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"no tags here", []string{}},
+		{"#spam and #Spam again #", []string{"spam"}},
+		{"self-promo (#promo) twice, #warned.", []string{"warned"}},
+		{"#promo, #warned!", []string{"promo", "warned"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, NoteTags(tt.text))
+		})
+	}
+}
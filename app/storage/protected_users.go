@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ProtectedConfig is the author of protected users set by options and file, they are replaced on start
+const ProtectedConfig = "config"
+
+// ProtectedUsers is a storage of users never banned by the bot, i.e. alt accounts of group founders or partner bots.
+// Spam verdicts of protected users are reported to admins instead of any action.
+type ProtectedUsers struct {
+	db *sqlx.DB
+}
+
+// ProtectedUser is a user never banned by the bot
+type ProtectedUser struct {
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Note      string    `db:"note" json:"note"`         // why the user is protected, i.e. "partner bot"
+	AddedBy   string    `db:"added_by" json:"added_by"` // ProtectedConfig or admin added the user, i.e. "admin:bob"
+	Timestamp time.Time `db:"timestamp" json:"timestamp"`
+}
+
+// NewProtectedUsers creates a new ProtectedUsers storage
+func NewProtectedUsers(db *sqlx.DB) (*ProtectedUsers, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate protected users: %w", err)
+	}
+	return &ProtectedUsers{db: db}, nil
+}
+
+// Add protects the user, the note and the author of already protected user are replaced.
+// Timestamp is set to the current time if not set.
+func (p *ProtectedUsers) Add(user ProtectedUser) error {
+	if user.UserID == 0 {
+		return errors.New("empty id of protected user")
+	}
+	if user.Timestamp.IsZero() {
+		user.Timestamp = time.Now()
+	}
+	_, err := p.db.NamedExec(`INSERT OR REPLACE INTO protected_users (user_id, note, added_by, timestamp)
+		VALUES (:user_id, :note, :added_by, :timestamp)`, user)
+	if err != nil {
+		return fmt.Errorf("failed to protect user %d: %w", user.UserID, err)
+	}
+	return nil
+}
+
+// Remove removes the protection of the user, returns error if the user is not protected or set by config
+func (p *ProtectedUsers) Remove(userID int64) error {
+	user, ok, err := p.Get(userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("user %d is not protected", userID)
+	}
+	if user.AddedBy == ProtectedConfig {
+		return fmt.Errorf("user %d is protected by options, remove it from config", userID)
+	}
+	if _, err = p.db.Exec("DELETE FROM protected_users WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to remove protection of user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// Get returns the protected user, false if the user is not protected
+func (p *ProtectedUsers) Get(userID int64) (ProtectedUser, bool, error) {
+	var res ProtectedUser
+	err := p.db.Get(&res, "SELECT user_id, note, added_by, timestamp FROM protected_users WHERE user_id = ?", userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ProtectedUser{}, false, nil
+	}
+	if err != nil {
+		return ProtectedUser{}, false, fmt.Errorf("failed to get protected user %d: %w", userID, err)
+	}
+	return res, true, nil
+}
+
+// List returns all protected users, sorted by id
+func (p *ProtectedUsers) List() ([]ProtectedUser, error) {
+	res := []ProtectedUser{}
+	if err := p.db.Select(&res, "SELECT user_id, note, added_by, timestamp FROM protected_users ORDER BY user_id"); err != nil {
+		return nil, fmt.Errorf("failed to list protected users: %w", err)
+	}
+	return res, nil
+}
+
+// SetConfigured replaces users protected by config with the given ones, users added by admins are kept,
+// unless protected by config too.
+func (p *ProtectedUsers) SetConfigured(users []ProtectedUser) error {
+	tx, err := p.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start update of protected users: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	if _, err = tx.Exec("DELETE FROM protected_users WHERE added_by = ?", ProtectedConfig); err != nil {
+		return fmt.Errorf("failed to remove protected users of config: %w", err)
+	}
+	now := time.Now()
+	for _, u := range users {
+		u.AddedBy, u.Timestamp = ProtectedConfig, now
+		_, err = tx.NamedExec(`INSERT OR REPLACE INTO protected_users (user_id, note, added_by, timestamp)
+			VALUES (:user_id, :note, :added_by, :timestamp)`, u)
+		if err != nil {
+			return fmt.Errorf("failed to protect user %d of config: %w", u.UserID, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit protected users of config: %w", err)
+	}
+	return nil
+}
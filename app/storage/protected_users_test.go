@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtectedUsers(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "protected.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	p, err := NewProtectedUsers(db)
+	require.NoError(t, err)
+
+	_, ok, err := p.Get(1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, p.Add(ProtectedUser{UserID: 2, Note: "partner bot", AddedBy: "admin:bob", Timestamp: ts}))
+	require.NoError(t, p.Add(ProtectedUser{UserID: 1, AddedBy: "admin:bob"}))
+	require.Error(t, p.Add(ProtectedUser{Note: "no id"}))
+	user, ok, err := p.Get(2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, ProtectedUser{UserID: 2, Note: "partner bot", AddedBy: "admin:bob", Timestamp: ts}, user)
+
+	require.NoError(t, p.SetConfigured([]ProtectedUser{{UserID: 3, Note: "founder alt"}, {UserID: 1}}))
+	users, err := p.List()
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{users[0].UserID, users[1].UserID, users[2].UserID})
+	assert.Equal(t, ProtectedConfig, users[0].AddedBy, "user of admin protected by config too")
+	assert.Equal(t, ProtectedConfig, users[2].AddedBy)
+	assert.Equal(t, "founder alt", users[2].Note)
+
+	err = p.Remove(3)
+	assert.ErrorContains(t, err, "protected by options")
+	assert.ErrorContains(t, p.Remove(4), "not protected")
+	require.NoError(t, p.Remove(2))
+
+	// users of config replaced
+	require.NoError(t, p.SetConfigured([]ProtectedUser{{UserID: 5}}))
+	users, err = p.List()
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, int64(5), users[0].UserID)
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Retention prunes stored data older than the retention period and vacuums the database,
+// so the database of a long-running bot doesn't grow unbounded.
+// It covers locator's messages and per-user spam results, the detected spam audit, message stats, api key usage audit,
+// the audit of moderation actions and fingerprints of banned users.
+// Approved users, samples and api keys are never pruned.
+type Retention struct {
+	DB     *sqlx.DB
+	Period time.Duration // max age of the data, 0 keeps the data forever and only vacuums the database
+}
+
+// PruneResult is a number of pruned records per table
+type PruneResult map[string]int64
+
+// SizeInfo is a size report of the database
+type SizeInfo struct {
+	Bytes   int64            // size of the database, in bytes
+	Records map[string]int64 // number of records per table
+}
+
+// retentionTables is a list of pruned tables with their time column
+var retentionTables = []struct{ table, timeColumn string }{
+	{"messages", "time"},
+	{"spam", "time"},
+	{"detected_spam", "timestamp"},
+	{"message_stats", "hour"},
+	{"api_key_usage", "timestamp"},
+	{"moderation_actions", "timestamp"},
+	{"openai_usage", "hour"},
+	{"ban_fingerprints", "timestamp"},
+}
+
+// Run prunes and vacuums the database on start and every interval, till context is canceled.
+// Size of the database and query stats are reported after each run.
+func (r Retention) Run(ctx context.Context, interval time.Duration) {
+	log.Printf("[INFO] db retention %v, vacuum every %v", r.Period, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.cleanup(); err != nil {
+			log.Printf("[WARN] db cleanup failed, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("[DEBUG] db retention stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune removes the data older than retention period, does nothing if the period is 0
+func (r Retention) Prune() (PruneResult, error) {
+	res := PruneResult{}
+	if r.Period <= 0 {
+		return res, nil
+	}
+	threshold := time.Now().Add(-r.Period)
+	for _, t := range retentionTables {
+		// table and column names are constants, not user input
+		qr, err := r.DB.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s < ?", t.table, t.timeColumn), threshold) //nolint:gosec
+		if err != nil {
+			return res, fmt.Errorf("failed to prune %s: %w", t.table, err)
+		}
+		if res[t.table], err = qr.RowsAffected(); err != nil {
+			return res, fmt.Errorf("failed to get pruned count for %s: %w", t.table, err)
+		}
+	}
+	return res, nil
+}
+
+// Vacuum rebuilds the database file to reclaim space of removed records
+func (r Retention) Vacuum() error {
+	if _, err := r.DB.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to vacuum: %w", err)
+	}
+	return nil
+}
+
+// Size returns size of the database and number of records in all tables with retention
+func (r Retention) Size() (SizeInfo, error) {
+	res := SizeInfo{Records: map[string]int64{}}
+	var pageCount, pageSize int64
+	if err := r.DB.Get(&pageCount, "PRAGMA page_count"); err != nil {
+		return res, fmt.Errorf("failed to get page count: %w", err)
+	}
+	if err := r.DB.Get(&pageSize, "PRAGMA page_size"); err != nil {
+		return res, fmt.Errorf("failed to get page size: %w", err)
+	}
+	res.Bytes = pageCount * pageSize
+
+	for _, t := range retentionTables {
+		var count int64
+		if err := r.DB.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM %s", t.table)); err != nil { //nolint:gosec // constant
+			return res, fmt.Errorf("failed to count %s: %w", t.table, err)
+		}
+		res.Records[t.table] = count
+	}
+	return res, nil
+}
+
+// cleanup prunes, vacuums and reports the size of the database
+func (r Retention) cleanup() error {
+	pruned, err := r.Prune()
+	if err != nil {
+		return err
+	}
+	if err = r.Vacuum(); err != nil {
+		return err
+	}
+	size, err := r.Size()
+	if err != nil {
+		return err
+	}
+	stats := CurrentQueryStats()
+	log.Printf("[INFO] db size %d bytes, records: %v, pruned: %v, queries: %d, errors: %d, busy: %d, slow: %d",
+		size.Bytes, size.Records, pruned, stats.Queries, stats.Errors, stats.Busy, stats.Slow)
+	return nil
+}
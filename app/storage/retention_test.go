@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention_Prune(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "retention.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, Migrate(db))
+
+	old, recent := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+	for i, ts := range []time.Time{old, old, recent} {
+		_, err = db.Exec("INSERT INTO messages (hash, time) VALUES (?, ?)", i, ts)
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO spam (user_id, time) VALUES (?, ?)", i, ts)
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO detected_spam (timestamp, text) VALUES (?, ?)", ts, "spam")
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO message_stats (hour, chat_id, checked) VALUES (?, ?, ?)", ts, i, 10)
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO api_key_usage (key_id, timestamp) VALUES (?, ?)", 1, ts)
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO openai_usage (hour, requests) VALUES (?, ?)", ts.Add(time.Duration(i)*time.Minute), 1)
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO moderation_actions (timestamp, action, user_id, actor) VALUES (?, ?, ?, ?)",
+			ts, "ban", i, "basic")
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO ban_fingerprints (user_id, timestamp) VALUES (?, ?)", i, ts)
+		require.NoError(t, err)
+	}
+
+	t.Run("no retention", func(t *testing.T) {
+		res, err := Retention{DB: db}.Prune()
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("prune and size", func(t *testing.T) {
+		r := Retention{DB: db, Period: 24 * time.Hour}
+		res, err := r.Prune()
+		require.NoError(t, err)
+		assert.Equal(t, PruneResult{"messages": 2, "spam": 2, "detected_spam": 2, "message_stats": 2,
+			"api_key_usage": 2, "moderation_actions": 2, "openai_usage": 2, "ban_fingerprints": 2}, res)
+
+		require.NoError(t, r.Vacuum())
+		size, err := r.Size()
+		require.NoError(t, err)
+		assert.True(t, size.Bytes > 0)
+		assert.Equal(t, map[string]int64{"messages": 1, "spam": 1, "detected_spam": 1, "message_stats": 1,
+			"api_key_usage": 1, "moderation_actions": 1, "openai_usage": 1, "ban_fingerprints": 1}, size.Records)
+	})
+}
+
+func TestRetention_Run(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "retention.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, Migrate(db))
+	_, err = db.Exec("INSERT INTO detected_spam (timestamp, text) VALUES (?, ?)", time.Now().Add(-48*time.Hour), "spam")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	Retention{DB: db, Period: 24 * time.Hour}.Run(ctx, 10*time.Millisecond)
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM detected_spam"))
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // sqlite driver loaded here
+)
+
+// Samples is a storage for spam and ham samples. It keeps both preset (base) samples and user-provided (dynamic) ones.
+// Each sample is a single line of text, the same message can't be spam and ham at the same time.
+// User samples take precedence: a user sample replaces the stored one with the same message, while a preset sample
+// never replaces a stored one, so user samples are kept when preset files are re-imported.
+type Samples struct {
+	db   *sqlx.DB
+	lock sync.RWMutex
+}
+
+// SampleType is a type of the sample, spam or ham
+type SampleType string
+
+// SampleOrigin is an origin of the sample, preset or user
+type SampleOrigin string
+
+// enum of sample types and origins
+const (
+	SampleTypeHam  SampleType = "ham"
+	SampleTypeSpam SampleType = "spam"
+
+	SampleOriginPreset SampleOrigin = "preset" // base samples, i.e. imported from samples files
+	SampleOriginUser   SampleOrigin = "user"   // dynamic samples, i.e. added by admins
+	SampleOriginAny    SampleOrigin = "any"    // used for reading only, means both preset and user samples
+)
+
+// sources of samples, recorded as provenance of each sample. Samples added by admins and api clients
+// have sources with the name of the actor, "admin:<name>" and "api:<credential>".
+const (
+	SampleSourceBase   = "base"   // base samples set, imported from preset samples files
+	SampleSourceImport = "import" // user samples imported from files, i.e. "import:telegram" for telegram desktop export
+	SampleSourceAuto   = "auto"   // learned by detector without source set
+)
+
+// Sample is a single spam or ham sample with its metadata
+type Sample struct {
+	ID        int64        `db:"id" json:"id"`
+	Timestamp time.Time    `db:"timestamp" json:"timestamp"`
+	Type      SampleType   `db:"type" json:"type"`
+	Origin    SampleOrigin `db:"origin" json:"origin"`
+	Source    string       `db:"source" json:"source"` // who or what added the sample, empty for samples stored before
+	Message   string       `db:"message" json:"message"`
+}
+
+// NewSamples creates a new Samples storage
+func NewSamples(db *sqlx.DB) (*Samples, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate samples: %w", err)
+	}
+	return &Samples{db: db}, nil
+}
+
+// Add adds a sample added by the source to the storage. If the same message already stored, user sample replaces it,
+// i.e. ham can become spam, and preset sample is skipped.
+func (s *Samples) Add(t SampleType, origin SampleOrigin, source, msg string) error {
+	if err := validateSample(t, origin); err != nil {
+		return err
+	}
+	msg = strings.TrimSpace(strings.ReplaceAll(msg, "\n", " "))
+	if msg == "" {
+		return fmt.Errorf("empty %s sample", t)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := s.db.Exec(insertSampleQuery(origin), t, origin, source, msg, time.Now()); err != nil {
+		return fmt.Errorf("failed to add %s sample: %w", t, err)
+	}
+	return nil
+}
+
+// Delete removes a sample by its id
+func (s *Samples) Delete(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := s.db.Exec("DELETE FROM samples WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete sample %d: %w", id, err)
+	}
+	return nil
+}
+
+// Read returns all samples of the given type and origin, ordered by id
+func (s *Samples) Read(t SampleType, origin SampleOrigin) ([]Sample, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	res := []Sample{}
+	query := "SELECT id, timestamp, type, origin, source, message FROM samples WHERE type = ? ORDER BY id"
+	args := []interface{}{t}
+	if origin != SampleOriginAny {
+		query = "SELECT id, timestamp, type, origin, source, message FROM samples WHERE type = ? AND origin = ? ORDER BY id"
+		args = append(args, origin)
+	}
+	if err := s.db.Select(&res, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to read %s samples: %w", t, err)
+	}
+	return res, nil
+}
+
+// ReadBySource returns samples of both types added by the source since the time, ordered by id.
+// The source matches itself and its actors, i.e. "admin" matches "admin:bob", zero since means any time.
+func (s *Samples) ReadBySource(source string, since time.Time) ([]Sample, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	res := []Sample{}
+	query := "SELECT id, timestamp, type, origin, source, message FROM samples WHERE " + sourceCond + " ORDER BY id"
+	if err := s.db.Select(&res, query, sourceArgs(source, since)...); err != nil {
+		return nil, fmt.Errorf("failed to read samples of %s: %w", source, err)
+	}
+	return res, nil
+}
+
+// DeleteBySource removes samples of both types added by the source since the time, i.e. to revert a bad training
+// session. The source is matched the same way as by ReadBySource. Returns number of removed samples.
+func (s *Samples) DeleteBySource(source string, since time.Time) (int, error) {
+	if source == "" {
+		return 0, errors.New("empty source")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res, err := s.db.Exec("DELETE FROM samples WHERE "+sourceCond, sourceArgs(source, since)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete samples of %s: %w", source, err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get number of deleted samples: %w", err)
+	}
+	return int(count), nil
+}
+
+// sourceCond is a condition of samples added by the source or its actors since the time, with sourceArgs
+const sourceCond = "(source = ? OR source LIKE ? ESCAPE '\\') AND timestamp >= ?"
+
+// likeEscaper escapes wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// sourceArgs returns arguments of sourceCond
+func sourceArgs(source string, since time.Time) []interface{} {
+	return []interface{}{source, likeEscaper.Replace(source) + ":%", since}
+}
+
+// Count returns number of samples of the given type and origin
+func (s *Samples) Count(t SampleType, origin SampleOrigin) (count int, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if origin == SampleOriginAny {
+		err = s.db.Get(&count, "SELECT COUNT(*) FROM samples WHERE type = ?", t)
+	} else {
+		err = s.db.Get(&count, "SELECT COUNT(*) FROM samples WHERE type = ? AND origin = ?", t, origin)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s samples: %w", t, err)
+	}
+	return count, nil
+}
+
+// Reader returns a reader for samples of the given type and origin, one sample per line.
+// This is the format used by samples files, so it can be used to export samples as well.
+func (s *Samples) Reader(t SampleType, origin SampleOrigin) (io.ReadCloser, error) {
+	samples, err := s.Read(t, origin)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, sample := range samples {
+		sb.WriteString(sample.Message + "\n")
+	}
+	return io.NopCloser(strings.NewReader(sb.String())), nil
+}
+
+// Import reads samples from the reader, one sample per line, and adds them to the storage with the source.
+// If withCleanup is true, all existing samples of the given type and origin are removed first.
+// Preset samples with messages stored as user samples are skipped, see Add. Returns number of imported samples.
+func (s *Samples) Import(t SampleType, origin SampleOrigin, source string, r io.Reader, withCleanup bool) (count int, err error) {
+	if err = validateSample(t, origin); err != nil {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	var committed bool
+	defer func() {
+		// rollback if not committed due to error
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("[WARN] failed to rollback transaction: %v", err)
+			}
+		}
+	}()
+
+	if withCleanup {
+		if _, err = tx.Exec("DELETE FROM samples WHERE type = ? AND origin = ?", t, origin); err != nil {
+			return 0, fmt.Errorf("failed to cleanup %s samples: %w", t, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		msg := strings.TrimSpace(scanner.Text())
+		if msg == "" {
+			continue
+		}
+		res, err := tx.Exec(insertSampleQuery(origin), t, origin, source, msg, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("failed to import %s sample: %w", t, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			count++
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s samples: %w", t, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	return count, nil
+}
+
+// insertSampleQuery returns the query to insert a sample of the origin. User sample replaces the stored one
+// with the same message, preset sample is skipped if the message is stored already.
+func insertSampleQuery(origin SampleOrigin) string {
+	if origin == SampleOriginPreset {
+		return "INSERT OR IGNORE INTO samples (type, origin, source, message, timestamp) VALUES (?, ?, ?, ?, ?)"
+	}
+	return "INSERT OR REPLACE INTO samples (type, origin, source, message, timestamp) VALUES (?, ?, ?, ?, ?)"
+}
+
+func validateSample(t SampleType, origin SampleOrigin) error {
+	if t != SampleTypeHam && t != SampleTypeSpam {
+		return fmt.Errorf("invalid sample type %q", t)
+	}
+	if origin != SampleOriginPreset && origin != SampleOriginUser {
+		return fmt.Errorf("invalid sample origin %q", origin)
+	}
+	return nil
+}
+
+// SampleUpdater adapts Samples storage to lib.SampleUpdater for the given sample type.
+// It appends and reads user (dynamic) samples only.
+type SampleUpdater struct {
+	samples    *Samples
+	sampleType SampleType
+}
+
+// NewSampleUpdater creates a new SampleUpdater for the given samples storage and type
+func NewSampleUpdater(samples *Samples, sampleType SampleType) *SampleUpdater {
+	return &SampleUpdater{samples: samples, sampleType: sampleType}
+}
+
+// Append adds a user sample to the storage, learned without source
+func (u *SampleUpdater) Append(msg string) error {
+	return u.samples.Add(u.sampleType, SampleOriginUser, SampleSourceAuto, msg)
+}
+
+// AppendFrom adds a user sample added by the source to the storage, SampleSourceAuto if source is empty
+func (u *SampleUpdater) AppendFrom(msg, source string) error {
+	if source == "" {
+		source = SampleSourceAuto
+	}
+	return u.samples.Add(u.sampleType, SampleOriginUser, source, msg)
+}
+
+// Reader returns a reader for user samples, caller must close it
+func (u *SampleUpdater) Reader() (io.ReadCloser, error) {
+	return u.samples.Reader(u.sampleType, SampleOriginUser)
+}
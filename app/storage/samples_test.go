@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamples_AddReadDelete(t *testing.T) {
+	s := newTestSamples(t)
+
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, "spam 1"))
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "admin:bob", "spam\n2"))
+	require.NoError(t, s.Add(SampleTypeHam, SampleOriginUser, "admin:bob", "ham 1"))
+	assert.Error(t, s.Add(SampleTypeHam, SampleOriginUser, "admin:bob", "  "), "empty sample")
+	assert.Error(t, s.Add("bad", SampleOriginUser, "admin:bob", "msg"), "invalid type")
+	assert.Error(t, s.Add(SampleTypeHam, SampleOriginAny, "admin:bob", "msg"), "any origin is for reading only")
+
+	res, err := s.Read(SampleTypeSpam, SampleOriginAny)
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "spam 1", res[0].Message)
+	assert.Equal(t, SampleOriginPreset, res[0].Origin)
+	assert.Equal(t, SampleSourceBase, res[0].Source)
+	assert.Equal(t, "spam 2", res[1].Message, "new lines replaced")
+	assert.False(t, res[1].Timestamp.IsZero())
+
+	res, err = s.Read(SampleTypeSpam, SampleOriginUser)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "spam 2", res[0].Message)
+
+	// the same message re-added as ham
+	require.NoError(t, s.Add(SampleTypeHam, SampleOriginUser, "admin:bob", "spam 1"))
+	count, err := s.Count(SampleTypeSpam, SampleOriginAny)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = s.Count(SampleTypeHam, SampleOriginUser)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	require.NoError(t, s.Delete(res[0].ID))
+	count, err = s.Count(SampleTypeSpam, SampleOriginAny)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestSamples_ImportAndReader(t *testing.T) {
+	s := newTestSamples(t)
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, "old preset"))
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "admin:bob", "user spam"))
+
+	count, err := s.Import(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, strings.NewReader("spam 1\n\nspam 2\n spam 3 \n"), true)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	r, err := s.Reader(SampleTypeSpam, SampleOriginPreset)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "spam 1\nspam 2\nspam 3\n", string(data), "old preset removed")
+
+	count, err = s.Import(SampleTypeSpam, SampleOriginUser, SampleSourceImport, strings.NewReader("spam 4\n"), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	upd := NewSampleUpdater(s, SampleTypeSpam)
+	require.NoError(t, upd.Append("spam 5"))
+	r, err = upd.Reader()
+	require.NoError(t, err)
+	data, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "user spam\nspam 4\nspam 5\n", string(data), "user samples only")
+
+	_, err = s.Import(SampleTypeSpam, SampleOriginAny, SampleSourceImport, strings.NewReader("spam 6\n"), false)
+	assert.Error(t, err)
+}
+
+func TestSamples_ImportPresetKeepsUserSamples(t *testing.T) {
+	s := newTestSamples(t)
+	presets := "spam 1\nspam 2\n"
+	count, err := s.Import(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, strings.NewReader(presets), true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// admin reverses the preset spam as ham, and adds a user spam matching a preset ham line
+	require.NoError(t, s.Add(SampleTypeHam, SampleOriginUser, "admin:bob", "spam 1"))
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "admin:bob", "ham 1"))
+
+	// preset files are re-imported on restart
+	for i := 0; i < 2; i++ {
+		count, err = s.Import(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, strings.NewReader(presets), true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "conflicting preset skipped")
+		count, err = s.Import(SampleTypeHam, SampleOriginPreset, SampleSourceBase, strings.NewReader("ham 1\nham 2\n"), true)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "conflicting preset skipped")
+	}
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, "spam 1"))
+
+	ham, err := s.Read(SampleTypeHam, SampleOriginAny)
+	require.NoError(t, err)
+	require.Len(t, ham, 2)
+	assert.Equal(t, Sample{ID: ham[0].ID, Timestamp: ham[0].Timestamp, Type: SampleTypeHam, Origin: SampleOriginUser,
+		Source: "admin:bob", Message: "spam 1"}, ham[0], "user ham kept")
+	assert.Equal(t, "ham 2", ham[1].Message)
+	spam, err := s.Read(SampleTypeSpam, SampleOriginAny)
+	require.NoError(t, err)
+	require.Len(t, spam, 2)
+	assert.Equal(t, "ham 1", spam[0].Message)
+	assert.Equal(t, SampleOriginUser, spam[0].Origin, "user spam kept")
+	assert.Equal(t, "spam 2", spam[1].Message)
+	assert.Equal(t, SampleOriginPreset, spam[1].Origin)
+}
+
+func TestSamples_BySource(t *testing.T) {
+	s := newTestSamples(t)
+	_, err := s.Import(SampleTypeSpam, SampleOriginPreset, SampleSourceBase, strings.NewReader("base 1\nbase 2\n"), false)
+	require.NoError(t, err)
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "admin:bob", "bob spam"))
+	require.NoError(t, s.Add(SampleTypeHam, SampleOriginUser, "admin:bob", "bob ham"))
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "admin:alice", "alice spam"))
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "administrator", "not admin"))
+	require.NoError(t, s.Add(SampleTypeSpam, SampleOriginUser, "api:key:a_b", "key spam"))
+	upd := NewSampleUpdater(s, SampleTypeHam)
+	require.NoError(t, upd.AppendFrom("api ham", "api:basic"))
+	require.NoError(t, upd.AppendFrom("auto ham", ""))
+
+	messages := func(samples []Sample) (res []string) {
+		for _, sample := range samples {
+			res = append(res, sample.Message)
+		}
+		return res
+	}
+	res, err := s.ReadBySource("admin", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob spam", "bob ham", "alice spam"}, messages(res), "all admins")
+	res, err = s.ReadBySource("admin:bob", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob spam", "bob ham"}, messages(res))
+	assert.Equal(t, SampleTypeHam, res[1].Type)
+	res, err = s.ReadBySource("api:key:a%", time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, res, "wildcards are escaped")
+	res, err = s.ReadBySource(SampleSourceAuto, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"auto ham"}, messages(res))
+	res, err = s.ReadBySource("admin", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, res, "nothing added since")
+
+	count, err := s.DeleteBySource("admin:bob", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = s.DeleteBySource("api", time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	_, err = s.DeleteBySource("", time.Time{})
+	assert.Error(t, err)
+
+	spam, err := s.Read(SampleTypeSpam, SampleOriginAny)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"base 1", "base 2", "alice spam", "not admin"}, messages(spam))
+	ham, err := s.Read(SampleTypeHam, SampleOriginAny)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"auto ham"}, messages(ham))
+}
+
+func newTestSamples(t *testing.T) *Samples {
+	file, err := os.CreateTemp("", "test_samples")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(file.Name()) })
+
+	db, err := NewSqliteDB(file.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s, err := NewSamples(db)
+	require.NoError(t, err)
+	return s
+}
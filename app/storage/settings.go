@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Settings is a storage of settings changed at runtime, i.e. with webapi, to apply them on the next start.
+// Values are kept as is, usually json, by name.
+type Settings struct {
+	db *sqlx.DB
+}
+
+// NewSettings creates a new Settings storage
+func NewSettings(db *sqlx.DB) (*Settings, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate settings: %w", err)
+	}
+	return &Settings{db: db}, nil
+}
+
+// Get returns the value of the setting, empty string if not set
+func (s *Settings) Get(name string) (string, error) {
+	var value string
+	err := s.db.Get(&value, "SELECT value FROM settings WHERE name = ?", name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %q: %w", name, err)
+	}
+	return value, nil
+}
+
+// Set sets the value of the setting, replacing the previous one
+func (s *Settings) Set(name, value string) error {
+	_, err := s.db.Exec(`INSERT INTO settings (name, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`, name, value, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to set setting %q: %w", name, err)
+	}
+	return nil
+}
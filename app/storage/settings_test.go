@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "settings.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	settings, err := NewSettings(db)
+	require.NoError(t, err)
+
+	res, err := settings.Get("runtime")
+	require.NoError(t, err)
+	assert.Empty(t, res, "not set")
+
+	require.NoError(t, settings.Set("runtime", `{"dry":true}`))
+	require.NoError(t, settings.Set("other", "value"))
+	res, err = settings.Get("runtime")
+	require.NoError(t, err)
+	assert.Equal(t, `{"dry":true}`, res)
+
+	require.NoError(t, settings.Set("runtime", `{"dry":false}`))
+	res, err = settings.Get("runtime")
+	require.NoError(t, err)
+	assert.Equal(t, `{"dry":false}`, res, "replaced")
+	res, err = settings.Get("other")
+	require.NoError(t, err)
+	assert.Equal(t, "value", res)
+
+	require.NoError(t, db.Close())
+	_, err = settings.Get("runtime")
+	assert.Error(t, err)
+	assert.Error(t, settings.Set("runtime", "{}"))
+}
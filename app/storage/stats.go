@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// Stats keeps hourly counters of checked messages and usage of openai, and reports stats of checks and detections.
+// Counters are collected in memory and written by Run or Flush, detections are taken from the detected spam audit.
+type Stats struct {
+	db *sqlx.DB
+
+	lock          sync.Mutex
+	pending       map[statsKey]*statsCounter    // counters not written yet, by hour and chat
+	pendingOpenAI map[time.Time]lib.OpenAIUsage // openai usage not written yet, by hour
+}
+
+type statsKey struct {
+	hour   time.Time
+	chatID int64
+}
+
+type statsCounter struct {
+	checked, spam, degraded int
+}
+
+// StatsReport is a summary of checks and detections for a time range
+type StatsReport struct {
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Checked   int             `json:"checked"`   // number of checked messages
+	Spam      int             `json:"spam"`      // number of detected spam messages
+	Degraded  int             `json:"degraded"`  // number of messages checked with skipped or interrupted checks, by check budget
+	Bans      int             `json:"bans"`      // number of detections with ban, i.e. not in dry or training mode
+	Reversals int             `json:"reversals"` // number of detections reversed by admins, i.e. false positives
+	ByAction  map[string]int  `json:"by_action"` // number of detections by action taken
+	ByCheck   map[string]int  `json:"by_check"`  // number of detections by check reported spam, one detection can have many
+	OpenAI    lib.OpenAIUsage `json:"openai"`    // usage of openai, requests, tokens and estimated cost
+}
+
+// NewStats creates a new Stats storage
+func NewStats(db *sqlx.DB) (*Stats, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate stats: %w", err)
+	}
+	return &Stats{db: db, pending: map[statsKey]*statsCounter{}, pendingOpenAI: map[time.Time]lib.OpenAIUsage{}}, nil
+}
+
+// Inc counts checked message in the chat, it is not written to the storage till the next flush.
+// Degraded is set if some checks of the message were skipped or interrupted by the check budget.
+func (s *Stats) Inc(chatID int64, spam, degraded bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := statsKey{hour: time.Now().Truncate(time.Hour), chatID: chatID}
+	c, ok := s.pending[key]
+	if !ok {
+		c = &statsCounter{}
+		s.pending[key] = c
+	}
+	c.checked++
+	if spam {
+		c.spam++
+	}
+	if degraded {
+		c.degraded++
+	}
+}
+
+// AddOpenAIUsage adds usage of openai request, it is not written to the storage till the next flush
+func (s *Stats) AddOpenAIUsage(usage lib.OpenAIUsage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	hour := time.Now().Truncate(time.Hour)
+	s.pendingOpenAI[hour] = s.pendingOpenAI[hour].Add(usage)
+}
+
+// OpenAIUsage returns usage of openai for the time range [from, to), counted by hours as Report does
+func (s *Stats) OpenAIUsage(from, to time.Time) (lib.OpenAIUsage, error) {
+	if err := s.Flush(); err != nil {
+		return lib.OpenAIUsage{}, err
+	}
+	return s.openAIUsage(from.Local(), to.Local())
+}
+
+// openAIUsage returns usage of openai written for the time range, times should be in local time zone
+func (s *Stats) openAIUsage(from, to time.Time) (lib.OpenAIUsage, error) {
+	var res lib.OpenAIUsage
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens), 0),
+		COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0) FROM openai_usage WHERE hour >= ? AND hour < ?`,
+		from.Truncate(time.Hour), to).Scan(&res.Requests, &res.PromptTokens, &res.CompletionTokens, &res.Cost)
+	if err != nil {
+		return res, fmt.Errorf("failed to get openai usage: %w", err)
+	}
+	return res, nil
+}
+
+// Run flushes counters every interval, till context is canceled. Remaining counters are flushed on exit.
+func (s *Stats) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				log.Printf("[WARN] can't flush stats, %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				log.Printf("[WARN] can't flush stats, %v", err)
+			}
+		}
+	}
+}
+
+// Flush adds collected counters to the stored ones. On failure counters are kept for the next flush.
+func (s *Stats) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.pending) == 0 && len(s.pendingOpenAI) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	var committed bool
+	defer func() {
+		// rollback if not committed due to error
+		if !committed {
+			if err := tx.Rollback(); err != nil {
+				log.Printf("[WARN] failed to rollback transaction: %v", err)
+			}
+		}
+	}()
+
+	for key, c := range s.pending {
+		_, err := tx.Exec(`INSERT INTO message_stats (hour, chat_id, checked, spam, degraded) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(hour, chat_id) DO UPDATE SET checked = checked + excluded.checked, spam = spam + excluded.spam,
+			degraded = degraded + excluded.degraded`,
+			key.hour, key.chatID, c.checked, c.spam, c.degraded)
+		if err != nil {
+			return fmt.Errorf("failed to write stats: %w", err)
+		}
+	}
+	for hour, u := range s.pendingOpenAI {
+		_, err := tx.Exec(`INSERT INTO openai_usage (hour, requests, prompt_tokens, completion_tokens, cost)
+			VALUES (?, ?, ?, ?, ?) ON CONFLICT(hour) DO UPDATE SET requests = requests + excluded.requests,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = completion_tokens + excluded.completion_tokens, cost = cost + excluded.cost`,
+			hour, u.Requests, u.PromptTokens, u.CompletionTokens, u.Cost)
+		if err != nil {
+			return fmt.Errorf("failed to write openai usage: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+	s.pending, s.pendingOpenAI = map[statsKey]*statsCounter{}, map[time.Time]lib.OpenAIUsage{}
+	return nil
+}
+
+// Report returns stats for the time range [from, to).
+// Checked messages are counted by hours, so the hour of from is counted in full.
+func (s *Stats) Report(from, to time.Time) (StatsReport, error) {
+	if err := s.Flush(); err != nil {
+		return StatsReport{}, err
+	}
+	res := StatsReport{From: from, To: to, ByAction: map[string]int{}, ByCheck: map[string]int{}}
+	// times are stored in local time zone, and compared as strings
+	from, to = from.Local(), to.Local()
+
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(checked), 0), COALESCE(SUM(degraded), 0) FROM message_stats
+		WHERE hour >= ? AND hour < ?`, from.Truncate(time.Hour), to).Scan(&res.Checked, &res.Degraded)
+	if err != nil {
+		return res, fmt.Errorf("failed to count checked messages: %w", err)
+	}
+
+	var actions []struct {
+		Action    string `db:"action"`
+		Count     int    `db:"count"`
+		Reversals int    `db:"reversals"`
+	}
+	err = s.db.Select(&actions, `SELECT action, COUNT(*) AS count, COUNT(reversed) AS reversals FROM detected_spam
+		WHERE timestamp >= ? AND timestamp < ? GROUP BY action`, from, to)
+	if err != nil {
+		return res, fmt.Errorf("failed to count detections: %w", err)
+	}
+	for _, a := range actions {
+		res.ByAction[a.Action] = a.Count
+		res.Spam += a.Count
+		res.Reversals += a.Reversals
+	}
+	res.Bans = res.ByAction["ban"]
+
+	var checks []struct {
+		Name  string `db:"name"`
+		Count int    `db:"count"`
+	}
+	err = s.db.Select(&checks, `SELECT json_extract(c.value, '$.name') AS name, COUNT(*) AS count
+		FROM detected_spam, json_each(detected_spam.checks) AS c
+		WHERE timestamp >= ? AND timestamp < ? AND json_extract(c.value, '$.spam') = 1 GROUP BY name`, from, to)
+	if err != nil {
+		return res, fmt.Errorf("failed to count detections by check: %w", err)
+	}
+	for _, c := range checks {
+		res.ByCheck[c.Name] = c.Count
+	}
+
+	if res.OpenAI, err = s.openAIUsage(from, to); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// Daily returns stats for each day of the time range [from, to), days start at midnight of from's location
+func (s *Stats) Daily(from, to time.Time) ([]StatsReport, error) {
+	res := []StatsReport{}
+	dayStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	for day := dayStart; day.Before(to); day = day.AddDate(0, 0, 1) {
+		report, err := s.Report(day, day.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to make report for %s: %w", day.Format("2006-01-02"), err)
+		}
+		res = append(res, report)
+	}
+	return res, nil
+}
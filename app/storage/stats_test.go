@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestStats_Report(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "stats.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	stats, err := NewStats(db)
+	require.NoError(t, err)
+	ds, err := NewDetectedSpam(db)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		stats.Inc(100, i == 0, i == 1)
+	}
+	stats.Inc(200, true, false)
+
+	now := time.Now()
+	stopWord := lib.CheckResult{Name: "stopword", Spam: true}
+	similarity := lib.CheckResult{Name: "similarity", Spam: true}
+	emoji := lib.CheckResult{Name: "emoji", Spam: false}
+	require.NoError(t, ds.Write(DetectedSpamInfo{ChatID: 100, UserID: 1, Action: "ban",
+		Checks: []lib.CheckResult{stopWord, similarity, emoji}}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{ChatID: 200, UserID: 2, Action: "ban", Checks: []lib.CheckResult{stopWord}}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{ChatID: 100, UserID: 3, Action: "dry", Checks: []lib.CheckResult{similarity}}))
+	require.NoError(t, ds.Write(DetectedSpamInfo{Timestamp: now.Add(-48 * time.Hour), ChatID: 100, UserID: 4, Action: "ban",
+		Checks: []lib.CheckResult{stopWord}}))
+
+	ok, err := ds.SetReversed(200, 2)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = ds.SetReversed(200, 2)
+	require.NoError(t, err)
+	assert.False(t, ok, "already reversed")
+	ok, err = ds.SetReversed(100, 2)
+	require.NoError(t, err)
+	assert.False(t, ok, "no detection in another chat")
+
+	t.Run("last day", func(t *testing.T) {
+		res, err := stats.Report(now.Add(-24*time.Hour), now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 6, res.Checked)
+		assert.Equal(t, 3, res.Spam)
+		assert.Equal(t, 1, res.Degraded)
+		assert.Equal(t, 2, res.Bans)
+		assert.Equal(t, 1, res.Reversals)
+		assert.Equal(t, map[string]int{"ban": 2, "dry": 1}, res.ByAction)
+		assert.Equal(t, map[string]int{"stopword": 2, "similarity": 2}, res.ByCheck)
+	})
+
+	t.Run("last week", func(t *testing.T) {
+		res, err := stats.Report(now.Add(-7*24*time.Hour), now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 6, res.Checked)
+		assert.Equal(t, 4, res.Spam)
+		assert.Equal(t, 3, res.Bans)
+		assert.Equal(t, map[string]int{"stopword": 3, "similarity": 2}, res.ByCheck)
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		res, err := stats.Report(now.Add(-24*30*time.Hour), now.Add(-24*7*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, StatsReport{From: now.Add(-24 * 30 * time.Hour), To: now.Add(-24 * 7 * time.Hour),
+			ByAction: map[string]int{}, ByCheck: map[string]int{}}, res)
+	})
+
+	t.Run("counters added on flush", func(t *testing.T) {
+		stats.Inc(100, false, false)
+		res, err := stats.Report(now.Add(-24*time.Hour), now.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, 7, res.Checked)
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		res, err := stats.Daily(now.Add(-2*24*time.Hour), now)
+		require.NoError(t, err)
+		require.Len(t, res, 3)
+		assert.Equal(t, 1, res[0].Spam, "detection 48h ago")
+		assert.Equal(t, 0, res[1].Spam)
+		assert.Equal(t, 3, res[2].Spam)
+		assert.Equal(t, 7, res[2].Checked)
+	})
+}
+
+func TestStats_OpenAIUsage(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "stats.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	stats, err := NewStats(db)
+	require.NoError(t, err)
+
+	now := time.Now()
+	stats.AddOpenAIUsage(lib.OpenAIUsage{Requests: 1, PromptTokens: 1000, CompletionTokens: 100, Cost: 0.036})
+	stats.AddOpenAIUsage(lib.OpenAIUsage{Requests: 1, PromptTokens: 500, CompletionTokens: 50, Cost: 0.018})
+	_, err = db.Exec("INSERT INTO openai_usage (hour, requests, prompt_tokens, cost) VALUES (?, ?, ?, ?)",
+		now.Add(-48*time.Hour).Truncate(time.Hour), 10, 10000, 0.3)
+	require.NoError(t, err)
+
+	res, err := stats.OpenAIUsage(now.Add(-time.Hour), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Requests)
+	assert.Equal(t, 1500, res.PromptTokens)
+	assert.Equal(t, 150, res.CompletionTokens)
+	assert.InDelta(t, 0.054, res.Cost, 1e-9)
+
+	// added to the written usage of the same hour
+	stats.AddOpenAIUsage(lib.OpenAIUsage{Requests: 1, PromptTokens: 100, Cost: 0.003})
+	report, err := stats.Report(now.Add(-72*time.Hour), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 13, report.OpenAI.Requests)
+	assert.Equal(t, 11600, report.OpenAI.PromptTokens)
+	assert.InDelta(t, 0.357, report.OpenAI.Cost, 1e-9)
+}
+
+func TestStats_Run(t *testing.T) {
+	db, err := NewSqliteDB(filepath.Join(t.TempDir(), "stats.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	stats, err := NewStats(db)
+	require.NoError(t, err)
+
+	stats.Inc(100, false, false)
+	stats.Inc(100, true, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats.Run(ctx, time.Hour)
+
+	var checked, spam int
+	require.NoError(t, db.QueryRow("SELECT checked, spam FROM message_stats WHERE chat_id = 100").Scan(&checked, &spam))
+	assert.Equal(t, 2, checked, "flushed on exit")
+	assert.Equal(t, 1, spam)
+}
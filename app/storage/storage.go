@@ -1,11 +1,44 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
 	"github.com/jmoiron/sqlx"
-	_ "modernc.org/sqlite" // sqlite driver loaded here
+	"modernc.org/sqlite"
 )
 
-// NewSqliteDB creates a new sqlite database
+// sqliteParams are connection parameters for sqlite database. WAL mode allows reads concurrent with a write,
+// busy_timeout makes sqlite wait for the lock instead of failing with "database is locked" right away,
+// and immediate transactions take the write lock on begin, so they don't fail on upgrade from read to write lock.
+const sqliteParams = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// sqliteLowMemParams limit page cache of each connection to 256KiB, instead of 2MiB by default,
+// and keep temporary tables and indices in files, not in memory
+const sqliteLowMemParams = "&_pragma=cache_size(-256)&_pragma=temp_store(file)"
+
+var lowMemory atomic.Bool
+
+// SetLowMemory enables low memory mode of databases made with NewSqliteDB after the call, for small devices.
+// Connections have smaller page cache, and only one idle connection is kept open.
+func SetLowMemory(on bool) { lowMemory.Store(on) }
+
+// NewSqliteDB creates a new sqlite database. All queries are instrumented, see SetQueryHook and QueryStats.
+// The driver is pure Go, so it doesn't need cgo and runs on any platform supported by Go, i.e. on arm boards.
 func NewSqliteDB(file string) (*sqlx.DB, error) {
-	return sqlx.Connect("sqlite", file)
+	dsn := file + "?" + sqliteParams
+	if lowMemory.Load() {
+		dsn += sqliteLowMemParams
+	}
+	db := sqlx.NewDb(sql.OpenDB(&connector{dsn: dsn, driver: &sqlite.Driver{}}), "sqlite")
+	if lowMemory.Load() {
+		db.SetMaxIdleConns(1)
+	}
+	if err := db.PingContext(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open sqlite db %s: %w", file, err)
+	}
+	return db, nil
 }
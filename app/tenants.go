@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/umputun/tg-spam/app/webapi"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// tenantNameRe is a valid name of tenant, used in paths of its data and web server
+var tenantNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// tenant is a bot of multi-tenant mode, with its own token, group and data, set by its config file
+type tenant struct {
+	name string
+	file string // yaml config file with options of the tenant, the same as --config
+}
+
+// tenantEnv is the part of the process shared by bots of tenants in multi-tenant mode
+type tenantEnv struct {
+	tenant
+	server *webapi.Tenants // shared web server, servers of tenants are mounted to it, nil if disabled
+	scams  *sharedScams    // scam patterns of the shared feed, loaded to detectors of all tenants
+}
+
+// parseTenants parses tenants set by options as name:file, i.e. "chess:/srv/tg-spam/chess.yml"
+func parseTenants(inp []string) ([]tenant, error) {
+	res := make([]tenant, 0, len(inp))
+	names := map[string]bool{}
+	for _, v := range inp {
+		name, file, ok := strings.Cut(v, ":")
+		if !ok || file == "" {
+			return nil, fmt.Errorf("invalid tenant %q, expected name:config-file", v)
+		}
+		if !tenantNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid name of tenant %q, expected lower-case letters, digits, - and _", name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate tenant %q", name)
+		}
+		names[name] = true
+		res = append(res, tenant{name: name, file: file})
+	}
+	return res, nil
+}
+
+// loadTenantOptions loads options of the tenant. Options of its config file override ones of the common config file,
+// and options set by env and flags override both, so they should be common for all tenants. Dynamic data, spam log
+// and access log are kept in tenants/{name} of the common dynamic data path, unless the tenant sets its own paths,
+// so tenants don't write the same files. Redis keys are prefixed with the name of the tenant, unless the tenant sets
+// its own prefix, so tenants don't share the state. Options of the process, i.e. pid file, debug listener and check api
+// listener, are not used by tenants. Storage settings of the process, slow query threshold and low memory mode,
+// can't be changed by the tenant file.
+func loadTenantOptions(args []string, t tenant) (options, error) {
+	common, _, err := loadOptions(args)
+	if err != nil {
+		return options{}, err
+	}
+	var opts options
+	p := newParser(&opts)
+	if common.ConfigFile != "" {
+		if err = loadConfigFile(p, common.ConfigFile); err != nil {
+			return options{}, err
+		}
+	}
+	if err = loadConfigFile(p, t.file); err != nil {
+		return options{}, err
+	}
+	if _, err = p.ParseArgs(args); err != nil {
+		return options{}, err
+	}
+	if opts.Storage.SlowQuery != common.Storage.SlowQuery || opts.LowMemory != common.LowMemory {
+		return options{}, errors.New("storage.slow-query and low-memory can't be set by tenant, they are common for all tenants")
+	}
+	tenantDir := filepath.Join(common.Files.DynamicDataPath, "tenants", t.name)
+	if opts.Files.DynamicDataPath == common.Files.DynamicDataPath {
+		opts.Files.DynamicDataPath = tenantDir
+	}
+	if opts.Logger.FileName == common.Logger.FileName {
+		opts.Logger.FileName = filepath.Join(tenantDir, filepath.Base(common.Logger.FileName))
+	}
+	if opts.Server.AccessLog != "" && opts.Server.AccessLog == common.Server.AccessLog {
+		opts.Server.AccessLog = filepath.Join(tenantDir, filepath.Base(common.Server.AccessLog))
+	}
+	if opts.Redis.Prefix == common.Redis.Prefix {
+		opts.Redis.Prefix += t.name + ":"
+	}
+	opts.Files.DynamicDataPath = expandPath(opts.Files.DynamicDataPath)
+	opts.Files.SamplesDataPath = expandPath(opts.Files.SamplesDataPath)
+	opts.Tenants, opts.PidFile, opts.DbgListen, opts.Server.Check.ListenAddr = nil, "", "", ""
+	opts.Server.Enabled = common.Server.Enabled // servers of tenants are mounted to the shared one
+	return opts, nil
+}
+
+// tenantFiles returns the dynamic data path and log files written by the tenant, as absolute paths
+func tenantFiles(opts options) []string {
+	paths := []string{opts.Files.DynamicDataPath}
+	if opts.Logger.Enabled {
+		paths = append(paths, opts.Logger.FileName)
+	}
+	if opts.Server.Enabled && opts.Server.AccessLog != "" {
+		paths = append(paths, opts.Server.AccessLog)
+	}
+	res := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		res = append(res, filepath.Clean(p))
+	}
+	return res
+}
+
+// executeTenants runs bots of all tenants in one process, till the context is canceled. The web server is shared,
+// with the server of each tenant under /tenants/{name} path, and the feed of scam patterns is fetched once.
+// A failure of a tenant is logged and doesn't stop others, all failures are returned when all tenants are stopped.
+func executeTenants(ctx context.Context, opts options, args []string) error {
+	tenants, err := parseTenants(opts.Tenants)
+	if err != nil {
+		return err
+	}
+	// options of all tenants are loaded first, so an invalid tenant fails the start
+	tenantOpts := make([]options, len(tenants))
+	tokens := map[string]string{} // telegram tokens of tenants, to reject bots shared by tenants
+	files := map[string]string{}  // data path and log files of tenants, to reject files written by several tenants
+	secrets := logSecrets(opts)
+	for i, t := range tenants {
+		if tenantOpts[i], err = loadTenantOptions(args, t); err != nil {
+			return fmt.Errorf("can't load options of tenant %s, %w", t.name, err)
+		}
+		tg := tenantOpts[i].Telegram
+		if tg.Token == "" || tg.Group == "" {
+			return fmt.Errorf("telegram token and group are required for tenant %s", t.name)
+		}
+		if other, ok := tokens[tg.Token]; ok {
+			return fmt.Errorf("tenants %s and %s have the same telegram token", other, t.name)
+		}
+		tokens[tg.Token] = t.name
+		for _, f := range tenantFiles(tenantOpts[i]) {
+			if other, ok := files[f]; ok {
+				return fmt.Errorf("tenants %s and %s have the same data path or log file %s", other, t.name, f)
+			}
+			files[f] = t.name
+		}
+		secrets = append(secrets, logSecrets(tenantOpts[i])...)
+	}
+	setupLog(opts.Dbg, os.Stdout, secrets...)
+	log.Printf("[INFO] multi-tenant mode, %d tenants", len(tenants))
+	setupStorage(opts)
+
+	if opts.PidFile != "" {
+		removePidFile, err := writePidFile(opts.PidFile)
+		if err != nil {
+			return fmt.Errorf("can't write pid file, %w", err)
+		}
+		defer removePidFile()
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	var workers sync.WaitGroup
+	defer func() {
+		notifySystemd("STOPPING=1")
+		stop()
+		if !waitDone(&workers, opts.ShutdownTimeout) {
+			log.Printf("[WARN] shutdown not completed in %v", opts.ShutdownTimeout)
+		}
+	}()
+	background := func(fn func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			fn()
+		}()
+	}
+
+	if opts.Dbg && opts.DbgListen != "" {
+		background(func() {
+			if err := runDebugServer(ctx, opts.DbgListen); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		})
+	}
+
+	var server *webapi.Tenants
+	if opts.Server.Enabled {
+		tlsConfig, err := makeTLSConfig(opts)
+		if err != nil {
+			return err
+		}
+		server = &webapi.Tenants{ListenAddr: opts.Server.ListenAddr, ShutdownWait: opts.ShutdownTimeout, TLS: tlsConfig}
+		background(func() {
+			if err := server.Run(ctx); err != nil {
+				log.Printf("[ERROR] web server failed, %v", err)
+			}
+		})
+	}
+
+	scams := &sharedScams{}
+	if opts.Checks.BuiltinScams {
+		feed, err := makeScamsFeed(opts)
+		if err != nil {
+			return fmt.Errorf("can't make scams feed, %w", err)
+		}
+		if feed != nil {
+			background(func() { feed.Run(ctx, opts.Checks.ScamsInterval, scams) })
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(tenants))
+	for i, t := range tenants {
+		wg.Add(1)
+		go func(i int, t tenant) {
+			defer wg.Done()
+			log.Printf("[INFO] start tenant %s, group %s, data %s", t.name, tenantOpts[i].Telegram.Group,
+				tenantOpts[i].Files.DynamicDataPath)
+			if err := executeInstance(ctx, tenantOpts[i], &tenantEnv{tenant: t, server: server, scams: scams}); err != nil {
+				errs[i] = fmt.Errorf("tenant %s failed, %w", t.name, err)
+				log.Printf("[ERROR] %v", errs[i])
+			}
+		}(i, t)
+	}
+	notifySystemd("READY=1")
+	go sdWatchdog(ctx, nil)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sharedScams keeps scam patterns of the feed shared by tenants, and loads them to detectors of all tenants.
+// Detectors added after the update get the kept patterns right away.
+type sharedScams struct {
+	lock      sync.Mutex
+	detectors []scamsDetector
+	patterns  *lib.ScamPatterns
+}
+
+// add adds the detector of the tenant, and loads the patterns of the feed to it, if newer than loaded ones
+func (s *sharedScams) add(d scamsDetector) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.detectors = append(s.detectors, d)
+	if s.patterns != nil && s.patterns.Version > d.ScamPatternsVersion() {
+		if err := d.LoadScamPatterns(*s.patterns); err != nil {
+			log.Printf("[WARN] can't load scam patterns of feed, %v", err)
+		}
+	}
+}
+
+// LoadScamPatterns keeps the patterns and loads them to all detectors with older ones
+func (s *sharedScams) LoadScamPatterns(p lib.ScamPatterns) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.patterns = &p
+	var errs []error
+	for _, d := range s.detectors {
+		if p.Version <= d.ScamPatternsVersion() {
+			continue
+		}
+		if err := d.LoadScamPatterns(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ScamPatternsVersion returns the version of the kept patterns, the lowest version of detectors if nothing is kept yet
+func (s *sharedScams) ScamPatternsVersion() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.patterns != nil {
+		return s.patterns.Version
+	}
+	res := 0
+	for i, d := range s.detectors {
+		if v := d.ScamPatternsVersion(); i == 0 || v < res {
+			res = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func Test_parseTenants(t *testing.T) {
+	res, err := parseTenants([]string{"chess:/srv/chess.yml", "go-lang_2:go.yml"})
+	require.NoError(t, err)
+	assert.Equal(t, []tenant{{name: "chess", file: "/srv/chess.yml"}, {name: "go-lang_2", file: "go.yml"}}, res)
+
+	tbl := []struct {
+		inp []string
+		err string
+	}{
+		{inp: []string{"chess"}, err: "expected name:config-file"},
+		{inp: []string{"chess:"}, err: "expected name:config-file"},
+		{inp: []string{"Chess:c.yml"}, err: "invalid name of tenant"},
+		{inp: []string{"../x:c.yml"}, err: "invalid name of tenant"},
+		{inp: []string{"chess:c.yml", "chess:d.yml"}, err: `duplicate tenant "chess"`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.err, func(t *testing.T) {
+			_, err := parseTenants(tt.inp)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func Test_loadTenantOptions(t *testing.T) {
+	dir := t.TempDir()
+	common := filepath.Join(dir, "common.yml")
+	require.NoError(t, os.WriteFile(common, []byte("min-msg-len: 20\nparanoid: true\n"+
+		"server: {enabled: true, access-log: access.log}\nlogger: {enabled: true}\nfiles: {dynamic: "+dir+"}\n"), 0o600))
+	chess := filepath.Join(dir, "chess.yml")
+	require.NoError(t, os.WriteFile(chess, []byte("telegram: {token: chess-token, group: chess}\nmin-msg-len: 30\n"+
+		"pidfile: /tmp/chess.pid\n"), 0o600))
+	own := filepath.Join(dir, "own.yml")
+	require.NoError(t, os.WriteFile(own, []byte("telegram: {token: own-token, group: own}\nfiles: {dynamic: "+
+		filepath.Join(dir, "own")+"}\nlogger: {file: "+filepath.Join(dir, "own.log")+"}\nredis: {prefix: \"own:\"}\n"), 0o600))
+
+	args := []string{"--config=" + common, "--tenant=chess:" + chess, "--tenant=own:" + own, "--pidfile=/tmp/tg-spam.pid", "--similarity-threshold=0.7"}
+
+	opts, err := loadTenantOptions(args, tenant{name: "chess", file: chess})
+	require.NoError(t, err)
+	assert.Equal(t, "chess-token", opts.Telegram.Token)
+	assert.Equal(t, "chess", opts.Telegram.Group)
+	assert.Equal(t, 30, opts.MinMsgLen, "tenant file wins over common file")
+	assert.True(t, opts.ParanoidMode, "common file")
+	assert.Equal(t, 0.7, opts.SimilarityThreshold, "flag")
+	assert.True(t, opts.Server.Enabled)
+	assert.Equal(t, filepath.Join(dir, "tenants", "chess"), opts.Files.DynamicDataPath)
+	assert.Equal(t, filepath.Join(dir, "tenants", "chess", "tg-spam.log"), opts.Logger.FileName, "spam log of tenant")
+	assert.Equal(t, filepath.Join(dir, "tenants", "chess", "access.log"), opts.Server.AccessLog, "access log of tenant")
+	assert.Equal(t, "tg-spam:chess:", opts.Redis.Prefix, "redis keys of tenant")
+	chessFiles := tenantFiles(opts)
+	assert.Empty(t, opts.Tenants)
+	assert.Empty(t, opts.PidFile)
+
+	opts, err = loadTenantOptions(args, tenant{name: "own", file: own})
+	require.NoError(t, err)
+	assert.Equal(t, "own-token", opts.Telegram.Token)
+	assert.Equal(t, 20, opts.MinMsgLen)
+	assert.Equal(t, filepath.Join(dir, "own"), opts.Files.DynamicDataPath, "own path of tenant")
+	assert.Equal(t, filepath.Join(dir, "own.log"), opts.Logger.FileName, "own spam log of tenant")
+	assert.Equal(t, filepath.Join(dir, "tenants", "own", "access.log"), opts.Server.AccessLog)
+	assert.Equal(t, "own:", opts.Redis.Prefix, "own prefix of tenant")
+	assert.Equal(t, []string{filepath.Join(dir, "own"), filepath.Join(dir, "own.log"),
+		filepath.Join(dir, "tenants", "own", "access.log")}, tenantFiles(opts))
+	for _, f := range chessFiles {
+		assert.NotContains(t, tenantFiles(opts), f, "no files shared by tenants")
+	}
+
+	_, err = loadTenantOptions(args, tenant{name: "bad", file: filepath.Join(dir, "bad.yml")})
+	require.Error(t, err)
+
+	for _, opt := range []string{"low-memory: true\n", "storage: {slow-query: 1s}\n"} {
+		f := filepath.Join(dir, "process.yml")
+		require.NoError(t, os.WriteFile(f, []byte("telegram: {token: t, group: g}\n"+opt), 0o600))
+		_, err = loadTenantOptions(args, tenant{name: "process", file: f})
+		require.EqualError(t, err, "storage.slow-query and low-memory can't be set by tenant, they are common for all tenants")
+	}
+	opts, err = loadTenantOptions(append(args, "--low-memory"), tenant{name: "chess", file: chess})
+	require.NoError(t, err, "common option")
+	assert.True(t, opts.LowMemory)
+}
+
+func Test_sharedScams(t *testing.T) {
+	d1 := lib.NewDetector(lib.Config{})
+	s := &sharedScams{}
+	s.add(d1)
+	assert.Equal(t, d1.ScamPatternsVersion(), s.ScamPatternsVersion(), "version of detectors before the feed")
+
+	p := lib.ScamPatterns{Version: 100, Patterns: []lib.ScamPattern{{Name: "test", Patterns: []string{"buy now"}}}}
+	require.NoError(t, s.LoadScamPatterns(p))
+	assert.Equal(t, 100, s.ScamPatternsVersion())
+	assert.Equal(t, 100, d1.ScamPatternsVersion())
+
+	d2 := lib.NewDetector(lib.Config{})
+	s.add(d2)
+	assert.Equal(t, 100, d2.ScamPatternsVersion(), "kept patterns loaded to added detector")
+
+	err := s.LoadScamPatterns(lib.ScamPatterns{Version: 101, Patterns: []lib.ScamPattern{{Name: "bad", Patterns: []string{"("}}}})
+	require.Error(t, err)
+	assert.Equal(t, 100, d1.ScamPatternsVersion(), "invalid patterns not loaded")
+}
@@ -0,0 +1,101 @@
+package tgtest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Int returns the param as int64, 0 if not set or not a number
+func (r Request) Int(name string) int64 {
+	res, _ := strconv.ParseInt(r.Params.Get(name), 10, 64)
+	return res
+}
+
+// ChatID returns chat_id param of the request
+func (r Request) ChatID() int64 { return r.Int("chat_id") }
+
+// Text returns text param of the request, i.e. of sent message
+func (r Request) Text() string { return r.Params.Get("text") }
+
+// String returns the method with the params, for failure messages
+func (r Request) String() string { return fmt.Sprintf("%s %s", r.Method, r.Params.Encode()) }
+
+// WaitRequest waits for the request of the method matched by the function, up to WaitTimeout.
+// Requests recorded before are matched as well. Returns false if no such request made.
+func (s *Server) WaitRequest(method string, match func(r Request) bool) (Request, bool) {
+	return s.wait(func(r Request) bool { return r.Method == method && (match == nil || match(r)) })
+}
+
+// wait waits for the request matched by the function, up to WaitTimeout
+func (s *Server) wait(match func(r Request) bool) (Request, bool) {
+	deadline := time.NewTimer(s.WaitTimeout)
+	defer deadline.Stop()
+	for {
+		s.lock.Lock()
+		for _, r := range s.requests {
+			if match(r) {
+				s.lock.Unlock()
+				return r, true
+			}
+		}
+		changed := s.changed
+		s.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return Request{}, false
+		case <-s.done:
+			return Request{}, false
+		}
+	}
+}
+
+// AssertSent waits for the message with the text sent by the bot to the chat, and returns the request.
+// The text is matched as a substring.
+func (s *Server) AssertSent(t testing.TB, chatID int64, text string) Request {
+	t.Helper()
+	r, ok := s.WaitRequest("sendMessage", func(r Request) bool {
+		return r.ChatID() == chatID && strings.Contains(r.Text(), text)
+	})
+	if !ok {
+		t.Errorf("no message with %q sent to chat %d, sent: %v", text, chatID, s.Requests("sendMessage"))
+	}
+	return r
+}
+
+// AssertDeleted waits for deletion of the message in the chat by the bot
+func (s *Server) AssertDeleted(t testing.TB, chatID int64, msgID int) {
+	t.Helper()
+	_, ok := s.WaitRequest("deleteMessage", func(r Request) bool {
+		return r.ChatID() == chatID && r.Int("message_id") == int64(msgID)
+	})
+	if !ok {
+		t.Errorf("message %d not deleted in chat %d, deleted: %v", msgID, chatID, s.Requests("deleteMessage"))
+	}
+}
+
+// AssertBanned waits for ban or restriction of the user in the chat by the bot
+func (s *Server) AssertBanned(t testing.TB, chatID, userID int64) {
+	t.Helper()
+	_, ok := s.wait(func(r Request) bool {
+		return (r.Method == "banChatMember" || r.Method == "restrictChatMember") &&
+			r.ChatID() == chatID && r.Int("user_id") == userID
+	})
+	if ok {
+		return
+	}
+	t.Errorf("user %d not banned in chat %d, requests: %v", userID, chatID, s.Requests("banChatMember", "restrictChatMember"))
+}
+
+// AssertNoRequest checks there are no requests of the method made within the duration, i.e. the user is not banned
+func (s *Server) AssertNoRequest(t testing.TB, method string, within time.Duration) {
+	t.Helper()
+	time.Sleep(within)
+	if reqs := s.Requests(method); len(reqs) > 0 {
+		t.Errorf("unexpected %s requests: %v", method, reqs)
+	}
+}
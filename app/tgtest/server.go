@@ -0,0 +1,349 @@
+// Package tgtest provides a fake Telegram Bot API server, generators of updates and assertion helpers,
+// to run end-to-end tests of the listener and custom checks without real bot tokens. Updates pushed to the server
+// are served to getUpdates of the bot, and requests of the bot are recorded and replied as telegram does.
+package tgtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultToken is a token of the bot, accepted by the server if Server.Token is not changed
+const DefaultToken = "123456:test-token"
+
+// Server is a fake Telegram Bot API server. Updates pushed with Push are served to getUpdates of the bot, with long
+// polling. All other requests are recorded and replied with sent messages for send and edit methods, chats and members
+// for get methods, and with true for other actions, i.e. deleteMessage or banChatMember.
+type Server struct {
+	URL         string        // base url of the server
+	Token       string        // token of the bot, requests with other tokens are unauthorized
+	Bot         tbapi.User    // user of the bot, returned by getMe
+	WaitTimeout time.Duration // max time assertion helpers wait for the expected request
+
+	srv       *httptest.Server
+	done      chan struct{} // closed on Close, to stop long polling
+	closeOnce sync.Once
+
+	lock     sync.Mutex
+	updates  []tbapi.Update
+	requests []Request
+	chats    map[int64]tbapi.Chat
+	admins   map[int64][]tbapi.ChatMember
+	failures map[string]string // descriptions of errors by method
+	bots     []*tbapi.BotAPI
+	changed  chan struct{} // closed and replaced on each pushed update and recorded request
+	updateID int
+	msgID    int
+}
+
+// Request is a request of the bot, recorded by the server
+type Request struct {
+	Method  string
+	Params  url.Values
+	Message *tbapi.Message // message replied to send and edit methods, nil for others
+}
+
+// NewServer starts a fake server, closed on cleanup of the test
+func NewServer(t testing.TB) *Server {
+	res := &Server{
+		Token:       DefaultToken,
+		Bot:         tbapi.User{ID: 123456, IsBot: true, FirstName: "tg-spam", UserName: "tg_spam_bot"},
+		WaitTimeout: 5 * time.Second,
+		done:        make(chan struct{}),
+		chats:       map[int64]tbapi.Chat{},
+		admins:      map[int64][]tbapi.ChatMember{},
+		failures:    map[string]string{},
+		changed:     make(chan struct{}),
+	}
+	res.srv = httptest.NewServer(http.HandlerFunc(res.handle))
+	res.URL = res.srv.URL
+	t.Cleanup(res.Close)
+	return res
+}
+
+// BotAPI makes telegram bot api client connected to the server. Receiving of updates is stopped on Close.
+func (s *Server) BotAPI() (*tbapi.BotAPI, error) {
+	api, err := tbapi.NewBotAPIWithAPIEndpoint(s.Token, s.URL+"/bot%s/%s")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make bot api: %w", err)
+	}
+	s.lock.Lock()
+	s.bots = append(s.bots, api)
+	s.lock.Unlock()
+	return api, nil
+}
+
+// Close stops receiving of updates by bot api clients and shuts down the server
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		s.lock.Lock()
+		for _, api := range s.bots {
+			api.StopReceivingUpdates()
+		}
+		s.lock.Unlock()
+		close(s.done)
+		s.srv.Close()
+	})
+}
+
+// AddChat adds the chat, returned by getChat by id or by username, and used in sent messages
+func (s *Server) AddChat(chat tbapi.Chat) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.chats[chat.ID] = chat
+}
+
+// SetAdmins sets administrators of the chat, returned by getChatAdministrators and getChatMember
+func (s *Server) SetAdmins(chatID int64, users ...*tbapi.User) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	admins := make([]tbapi.ChatMember, 0, len(users))
+	for _, u := range users {
+		admins = append(admins, tbapi.ChatMember{User: u, Status: "administrator"})
+	}
+	s.admins[chatID] = admins
+}
+
+// Fail makes the method fail with the description, i.e. "Bad Request: message to delete not found".
+// Empty description makes the method succeed again. Failed requests are recorded as well.
+func (s *Server) Fail(method, description string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if description == "" {
+		delete(s.failures, method)
+		return
+	}
+	s.failures[method] = description
+}
+
+// Push adds the update to be received by the bot, and returns it with update id set. Ids of messages
+// and callback queries are set as well if empty, and date of messages if zero.
+func (s *Server) Push(update tbapi.Update) tbapi.Update {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.updateID++
+	update.UpdateID = s.updateID
+	for _, msg := range []*tbapi.Message{update.Message, update.EditedMessage} {
+		if msg == nil {
+			continue
+		}
+		if msg.MessageID == 0 {
+			s.msgID++
+			msg.MessageID = s.msgID
+		}
+		if msg.Date == 0 {
+			msg.Date = int(time.Now().Unix())
+		}
+	}
+	if update.CallbackQuery != nil && update.CallbackQuery.ID == "" {
+		update.CallbackQuery.ID = "callback-" + strconv.Itoa(update.UpdateID)
+	}
+	s.updates = append(s.updates, update)
+	s.notify()
+	return update
+}
+
+// Requests returns recorded requests of the methods, or all requests if no methods set, except getUpdates
+func (s *Server) Requests(methods ...string) []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := []Request{}
+	for _, r := range s.requests {
+		if len(methods) == 0 || slices.Contains(methods, r.Method) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// ResetRequests removes recorded requests
+func (s *Server) ResetRequests() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.requests = nil
+}
+
+// notify wakes up long polling and waiting helpers, should be called under lock
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || token != s.Token {
+		writeResponse(w, http.StatusUnauthorized, false, nil, "Unauthorized")
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		writeResponse(w, http.StatusBadRequest, false, nil, "Bad Request: "+err.Error())
+		return
+	}
+
+	if method == "getUpdates" {
+		s.getUpdates(w, r)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	req := Request{Method: method, Params: r.Form}
+	defer func() {
+		s.requests = append(s.requests, req)
+		s.notify()
+	}()
+	if description, failed := s.failures[method]; failed {
+		writeResponse(w, http.StatusBadRequest, false, nil, description)
+		return
+	}
+
+	switch {
+	case method == "getMe":
+		writeResponse(w, http.StatusOK, true, s.Bot, "")
+	case method == "getChat":
+		chat, found := s.chat(r.Form.Get("chat_id"))
+		if !found {
+			writeResponse(w, http.StatusBadRequest, false, nil, "Bad Request: chat not found")
+			return
+		}
+		writeResponse(w, http.StatusOK, true, chat, "")
+	case method == "getChatAdministrators":
+		chat, _ := s.chat(r.Form.Get("chat_id"))
+		admins := s.admins[chat.ID]
+		if admins == nil {
+			admins = []tbapi.ChatMember{}
+		}
+		writeResponse(w, http.StatusOK, true, admins, "")
+	case method == "getChatMember":
+		chat, _ := s.chat(r.Form.Get("chat_id"))
+		userID, _ := strconv.ParseInt(r.Form.Get("user_id"), 10, 64)
+		writeResponse(w, http.StatusOK, true, s.member(chat.ID, userID), "")
+	case strings.HasPrefix(method, "send"), strings.HasPrefix(method, "edit"):
+		req.Message = s.message(method, r.Form)
+		writeResponse(w, http.StatusOK, true, req.Message, "")
+	default:
+		writeResponse(w, http.StatusOK, true, true, "")
+	}
+}
+
+// getUpdates replies with updates starting from the offset, waiting for them up to the timeout if there are none yet
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.Form.Get("offset"))
+	timeout, _ := strconv.Atoi(r.Form.Get("timeout"))
+	deadline := time.NewTimer(time.Duration(timeout) * time.Second)
+	defer deadline.Stop()
+	for {
+		s.lock.Lock()
+		res := []tbapi.Update{}
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				res = append(res, u)
+			}
+		}
+		changed := s.changed
+		s.lock.Unlock()
+		if len(res) > 0 || timeout <= 0 {
+			writeResponse(w, http.StatusOK, true, res, "")
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			writeResponse(w, http.StatusOK, true, res, "")
+			return
+		case <-s.done:
+			writeResponse(w, http.StatusOK, true, res, "")
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// chat returns the chat by id or by @username, chats not added are supergroups with the id. Should be called under lock.
+func (s *Server) chat(chatID string) (tbapi.Chat, bool) {
+	if strings.HasPrefix(chatID, "@") {
+		for _, c := range s.chats {
+			if strings.EqualFold(c.UserName, chatID[1:]) {
+				return c, true
+			}
+		}
+		return tbapi.Chat{}, false
+	}
+	id, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return tbapi.Chat{}, false
+	}
+	if c, ok := s.chats[id]; ok {
+		return c, true
+	}
+	return tbapi.Chat{ID: id, Type: "supergroup"}, true
+}
+
+// member returns the user as member of the chat. The bot is an administrator with rights to delete messages
+// and ban users, other users are members unless set as admins. Should be called under lock.
+func (s *Server) member(chatID, userID int64) tbapi.ChatMember {
+	if userID == s.Bot.ID {
+		bot := s.Bot
+		return tbapi.ChatMember{User: &bot, Status: "administrator", CanDeleteMessages: true, CanRestrictMembers: true}
+	}
+	for _, m := range s.admins[chatID] {
+		if m.User != nil && m.User.ID == userID {
+			return m
+		}
+	}
+	return tbapi.ChatMember{User: &tbapi.User{ID: userID}, Status: "member"}
+}
+
+// message makes the message sent or edited by the bot with the params. Should be called under lock.
+func (s *Server) message(method string, params url.Values) *tbapi.Message {
+	chat, _ := s.chat(params.Get("chat_id"))
+	bot := s.Bot
+	res := &tbapi.Message{From: &bot, Chat: &chat, Date: int(time.Now().Unix()), Text: params.Get("text"),
+		Caption: params.Get("caption")}
+	if strings.HasPrefix(method, "edit") {
+		res.MessageID, _ = strconv.Atoi(params.Get("message_id"))
+		res.EditDate = res.Date
+	} else {
+		s.msgID++
+		res.MessageID = s.msgID
+	}
+	if replyTo, _ := strconv.Atoi(params.Get("reply_to_message_id")); replyTo > 0 {
+		res.ReplyToMessage = &tbapi.Message{MessageID: replyTo, Chat: &chat}
+	}
+	if markup := params.Get("reply_markup"); markup != "" {
+		keyboard := tbapi.InlineKeyboardMarkup{}
+		if err := json.Unmarshal([]byte(markup), &keyboard); err == nil && len(keyboard.InlineKeyboard) > 0 {
+			res.ReplyMarkup = &keyboard
+		}
+	}
+	return res
+}
+
+// writeResponse writes response of bot api, with the result if ok, or with the description of error
+func writeResponse(w http.ResponseWriter, status int, ok bool, result any, description string) {
+	resp := struct {
+		Ok          bool   `json:"ok"`
+		Result      any    `json:"result"`
+		ErrorCode   int    `json:"error_code,omitempty"`
+		Description string `json:"description,omitempty"`
+	}{Ok: ok, Result: result, Description: description}
+	if !ok {
+		resp.ErrorCode = status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,138 @@
+package tgtest
+
+import (
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Updates(t *testing.T) {
+	srv := NewServer(t)
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+	assert.Equal(t, "tg_spam_bot", api.Self.UserName)
+
+	first := srv.Push(Message(100, User(1, "user1"), "hello"))
+	assert.Equal(t, 1, first.UpdateID)
+	assert.Equal(t, 1, first.Message.MessageID)
+
+	u := tbapi.NewUpdate(0)
+	u.Timeout = 60
+	updates := api.GetUpdatesChan(u)
+	recv := func() tbapi.Update {
+		select {
+		case upd := <-updates:
+			return upd
+		case <-time.After(time.Second):
+			t.Fatal("no update received")
+		}
+		return tbapi.Update{}
+	}
+
+	upd := recv()
+	assert.Equal(t, "hello", upd.Message.Text)
+	assert.Equal(t, int64(100), upd.Message.Chat.ID)
+	assert.Equal(t, int64(1), upd.Message.From.ID)
+
+	// pushed while bot is waiting with long polling
+	srv.Push(Command(200, User(2, "admin"), "/ban 1"))
+	upd = recv()
+	assert.Equal(t, 2, upd.UpdateID)
+	assert.True(t, upd.Message.IsCommand())
+	assert.Equal(t, "ban", upd.Message.Command())
+	assert.Equal(t, "1", upd.Message.CommandArguments())
+
+	srv.Push(Join(100, User(3, "newbie")))
+	upd = recv()
+	require.NotNil(t, upd.ChatMember)
+	assert.Equal(t, "member", upd.ChatMember.NewChatMember.Status)
+	assert.Equal(t, int64(3), upd.ChatMember.NewChatMember.User.ID)
+
+	assert.Len(t, srv.Requests(), 1, "only getMe recorded, getUpdates is not")
+}
+
+func TestServer_Requests(t *testing.T) {
+	srv := NewServer(t)
+	srv.AddChat(tbapi.Chat{ID: 100, Type: "supergroup", UserName: "group"})
+	srv.SetAdmins(100, User(10, "admin"))
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	chat, err := api.GetChat(tbapi.ChatInfoConfig{ChatConfig: tbapi.ChatConfig{SuperGroupUsername: "@group"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), chat.ID)
+	_, err = api.GetChat(tbapi.ChatInfoConfig{ChatConfig: tbapi.ChatConfig{SuperGroupUsername: "@unknown"}})
+	assert.ErrorContains(t, err, "chat not found")
+
+	admins, err := api.GetChatAdministrators(tbapi.ChatAdministratorsConfig{ChatConfig: tbapi.ChatConfig{ChatID: 100}})
+	require.NoError(t, err)
+	require.Len(t, admins, 1)
+	assert.Equal(t, "admin", admins[0].User.UserName)
+
+	member, err := api.GetChatMember(tbapi.GetChatMemberConfig{ChatConfigWithUser: tbapi.ChatConfigWithUser{ChatID: 100,
+		UserID: srv.Bot.ID}})
+	require.NoError(t, err)
+	assert.True(t, member.CanDeleteMessages)
+	assert.True(t, member.CanRestrictMembers)
+
+	msg := tbapi.NewMessage(100, "spam detected")
+	msg.ReplyToMessageID = 5
+	msg.ReplyMarkup = tbapi.NewInlineKeyboardMarkup(tbapi.NewInlineKeyboardRow(tbapi.NewInlineKeyboardButtonData("unban", "1")))
+	sent, err := api.Send(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "spam detected", sent.Text)
+	assert.Equal(t, 5, sent.ReplyToMessage.MessageID)
+	assert.Equal(t, "group", sent.Chat.UserName)
+
+	_, err = api.Request(tbapi.DeleteMessageConfig{ChatID: 100, MessageID: 5})
+	require.NoError(t, err)
+	_, err = api.Request(tbapi.BanChatMemberConfig{ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: 100, UserID: 1}})
+	require.NoError(t, err)
+
+	req := srv.AssertSent(t, 100, "spam")
+	require.NotNil(t, req.Message)
+	require.NotNil(t, req.Message.ReplyMarkup)
+	assert.Equal(t, "1", *req.Message.ReplyMarkup.InlineKeyboard[0][0].CallbackData)
+	srv.AssertDeleted(t, 100, 5)
+	srv.AssertBanned(t, 100, 1)
+	assert.Len(t, srv.Requests("sendMessage", "deleteMessage"), 2)
+
+	srv.Fail("deleteMessage", "Bad Request: message to delete not found")
+	_, err = api.Request(tbapi.DeleteMessageConfig{ChatID: 100, MessageID: 6})
+	assert.ErrorContains(t, err, "message to delete not found")
+	srv.Fail("deleteMessage", "")
+	_, err = api.Request(tbapi.DeleteMessageConfig{ChatID: 100, MessageID: 6})
+	assert.NoError(t, err)
+
+	srv.ResetRequests()
+	assert.Empty(t, srv.Requests())
+	srv.AssertNoRequest(t, "banChatMember", 10*time.Millisecond)
+}
+
+func TestServer_WaitRequest(t *testing.T) {
+	srv := NewServer(t)
+	srv.WaitTimeout = 50 * time.Millisecond
+	api, err := srv.BotAPI()
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_, _ = api.Send(tbapi.NewMessage(100, "later"))
+	}()
+	req, ok := srv.WaitRequest("sendMessage", nil)
+	require.True(t, ok)
+	assert.Equal(t, "later", req.Text())
+	assert.Equal(t, int64(100), req.ChatID())
+
+	_, ok = srv.WaitRequest("deleteMessage", nil)
+	assert.False(t, ok)
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	srv := NewServer(t)
+	_, err := tbapi.NewBotAPIWithAPIEndpoint("123:bad", srv.URL+"/bot%s/%s")
+	assert.ErrorContains(t, err, "Unauthorized")
+}
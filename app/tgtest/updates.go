@@ -0,0 +1,52 @@
+package tgtest
+
+import (
+	"strings"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// User makes a user with the id and username, also used as the first name
+func User(id int64, userName string) *tbapi.User {
+	return &tbapi.User{ID: id, UserName: userName, FirstName: userName}
+}
+
+// Message makes an update with the message of the user in the chat. Id of the message is set by Server.Push.
+func Message(chatID int64, from *tbapi.User, text string) tbapi.Update {
+	return tbapi.Update{Message: &tbapi.Message{From: from, Chat: &tbapi.Chat{ID: chatID, Type: "supergroup"}, Text: text}}
+}
+
+// Reply makes an update with the message of the user in the chat, replying to another message, i.e. to spam
+// message forwarded to admin chat
+func Reply(chatID int64, from *tbapi.User, text string, replyTo *tbapi.Message) tbapi.Update {
+	res := Message(chatID, from, text)
+	res.Message.ReplyToMessage = replyTo
+	return res
+}
+
+// Command makes an update with the command of the user in the chat, i.e. "/ban 123".
+// The first word of the text is marked as bot command.
+func Command(chatID int64, from *tbapi.User, text string) tbapi.Update {
+	res := Message(chatID, from, text)
+	cmd, _, _ := strings.Cut(text, " ")
+	res.Message.Entities = []tbapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(cmd)}}
+	return res
+}
+
+// Callback makes an update with the press of inline button with the data by the user, on the message sent by the bot,
+// i.e. on the report of spam in admin chat, recorded as Request.Message
+func Callback(from *tbapi.User, msg *tbapi.Message, data string) tbapi.Update {
+	return tbapi.Update{CallbackQuery: &tbapi.CallbackQuery{From: from, Message: msg, Data: data}}
+}
+
+// Join makes chat_member update with the user joined the chat
+func Join(chatID int64, user *tbapi.User) tbapi.Update {
+	return tbapi.Update{ChatMember: &tbapi.ChatMemberUpdated{
+		Chat:          tbapi.Chat{ID: chatID, Type: "supergroup"},
+		From:          *user,
+		Date:          int(time.Now().Unix()),
+		OldChatMember: tbapi.ChatMember{User: user, Status: "left"},
+		NewChatMember: tbapi.ChatMember{User: user, Status: "member"},
+	}}
+}
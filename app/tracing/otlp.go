@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxQueued  = 2048 // max number of finished spans waiting for export, new ones are dropped
+	exportSize = 512  // max number of spans in a single export request
+)
+
+// Exporter collects finished spans and exports them with OTLP over http/json to Endpoint + "/v1/traces".
+// Spans are exported periodically by Run, and the remaining ones on its shutdown.
+type Exporter struct {
+	Endpoint   string            // base url of OTLP http receiver, i.e. http://localhost:4318
+	Service    string            // service.name of exported spans, "tg-spam" if not set
+	Headers    map[string]string // headers of export requests, i.e. authorization of hosted backends
+	Ratio      float64           // ratio of sampled traces, all traces sampled if not in (0, 1)
+	Interval   time.Duration     // export interval, 5s if not set
+	HTTPClient *http.Client      // client to export spans, default client with timeout is used if nil
+
+	once    sync.Once
+	lock    sync.Mutex
+	spans   []*Span
+	dropped int // number of spans dropped since the last export, as the queue was full
+}
+
+func (e *Exporter) init() {
+	e.once.Do(func() {
+		if e.Service == "" {
+			e.Service = "tg-spam"
+		}
+		if e.Interval == 0 {
+			e.Interval = 5 * time.Second
+		}
+		if e.HTTPClient == nil {
+			e.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+		}
+	})
+}
+
+// sample returns true if a new trace should be sampled
+func (e *Exporter) sample() bool {
+	if e.Ratio <= 0 || e.Ratio >= 1 {
+		return true
+	}
+	return rand.Float64() < e.Ratio //nolint:gosec // no need for crypto random in sampling
+}
+
+// record queues the finished span for export
+func (e *Exporter) record(s *Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.spans) >= maxQueued {
+		e.dropped++
+		return
+	}
+	e.spans = append(e.spans, s)
+}
+
+// Run exports spans every interval till the context is canceled, and the remaining ones on exit, blocked call
+func (e *Exporter) Run(ctx context.Context) {
+	e.init()
+	log.Printf("[INFO] tracing activated, export to %s every %v", e.Endpoint, e.Interval)
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := e.Flush(flushCtx); err != nil {
+				log.Printf("[WARN] failed to export spans on shutdown, %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := e.Flush(ctx); err != nil {
+				log.Printf("[WARN] failed to export spans, %v", err)
+			}
+		}
+	}
+}
+
+// Flush exports all queued spans. Spans which failed to export are dropped, to not grow the queue on outages.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.init()
+	e.lock.Lock()
+	spans, dropped := e.spans, e.dropped
+	e.spans, e.dropped = nil, 0
+	e.lock.Unlock()
+	if dropped > 0 {
+		log.Printf("[WARN] %d spans dropped, export queue is full", dropped)
+	}
+
+	for len(spans) > 0 {
+		batch := spans[:min(exportSize, len(spans))]
+		spans = spans[len(batch):]
+		if err := e.export(ctx, batch); err != nil {
+			return fmt.Errorf("failed to export %d spans: %w", len(batch)+len(spans), err)
+		}
+	}
+	return nil
+}
+
+// export posts spans to OTLP receiver
+func (e *Exporter) export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+"/v1/traces",
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // drain to reuse connection
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// otlp json types, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding.
+// Ids are hex encoded and 64-bit integers are strings, as required by OTLP/JSON.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         SpanKind   `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+	Status       struct {
+		Code    int    `json:"code,omitempty"` // 0 - unset, 2 - error
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// request makes OTLP export request for spans
+func (e *Exporter) request(spans []*Span) otlpRequest {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(spans))}
+	scope.Scope.Name = "github.com/umputun/tg-spam"
+	for _, s := range spans {
+		span := otlpSpan{TraceID: hex.EncodeToString(s.TraceID[:]), SpanID: hex.EncodeToString(s.SpanID[:]),
+			Name: s.Name, Kind: s.Kind, Attributes: otlpAttrs(s.Attrs...),
+			Start: strconv.FormatInt(s.Start.UnixNano(), 10), End: strconv.FormatInt(s.End.UnixNano(), 10)}
+		if s.ParentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		if s.Err != nil {
+			span.Status.Code, span.Status.Message = 2, s.Err.Error()
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = otlpAttrs(String("service.name", e.Service))
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+// otlpAttrs converts attributes to OTLP any values, unsupported values are converted to strings
+func otlpAttrs(attrs ...Attr) []otlpAttr {
+	res := make([]otlpAttr, 0, len(attrs))
+	for _, a := range attrs {
+		var val map[string]any
+		switch v := a.Value.(type) {
+		case string:
+			val = map[string]any{"stringValue": v}
+		case bool:
+			val = map[string]any{"boolValue": v}
+		case int64:
+			val = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		default:
+			val = map[string]any{"stringValue": fmt.Sprintf("%v", v)}
+		}
+		res = append(res, otlpAttr{Key: a.Key, Value: val})
+	}
+	return res
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter_Flush(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		lock.Lock()
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	e := &Exporter{Endpoint: ts.URL + "/", Headers: map[string]string{"Authorization": "Bearer secret"}}
+	ctx, root := Start(WithExporter(context.Background(), e), "telegram update", Int64("chat.id", -100123))
+	_, child := Start(ctx, "detector check", Bool("spam", true), String("spam.checks", "stopword"))
+	child.SetError(errors.New("cas failed"))
+	child.Finish()
+	root.Finish()
+
+	require.NoError(t, e.Flush(context.Background()))
+	require.Len(t, bodies, 1)
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttr `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []map[string]any `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(bodies[0]), &req))
+	require.Len(t, req.ResourceSpans, 1)
+	assert.Equal(t, []otlpAttr{{Key: "service.name", Value: map[string]any{"stringValue": "tg-spam"}}},
+		req.ResourceSpans[0].Resource.Attributes)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "detector check", spans[0]["name"])
+	assert.Equal(t, hex.EncodeToString(root.TraceID[:]), spans[0]["traceId"])
+	assert.Equal(t, hex.EncodeToString(child.SpanID[:]), spans[0]["spanId"])
+	assert.Equal(t, hex.EncodeToString(root.SpanID[:]), spans[0]["parentSpanId"])
+	assert.Equal(t, map[string]any{"code": float64(2), "message": "cas failed"}, spans[0]["status"])
+	assert.Equal(t, []any{
+		map[string]any{"key": "spam", "value": map[string]any{"boolValue": true}},
+		map[string]any{"key": "spam.checks", "value": map[string]any{"stringValue": "stopword"}},
+	}, spans[0]["attributes"])
+
+	assert.Equal(t, "telegram update", spans[1]["name"])
+	assert.NotContains(t, spans[1], "parentSpanId")
+	assert.Equal(t, float64(KindInternal), spans[1]["kind"])
+	assert.Equal(t, map[string]any{}, spans[1]["status"])
+	assert.Equal(t, []any{map[string]any{"key": "chat.id", "value": map[string]any{"intValue": "-100123"}}},
+		spans[1]["attributes"])
+	assert.IsType(t, "", spans[1]["startTimeUnixNano"], "64-bit integers are strings")
+
+	require.NoError(t, e.Flush(context.Background()))
+	assert.Len(t, bodies, 1, "nothing to export")
+}
+
+func TestExporter_FlushFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	e := &Exporter{Endpoint: ts.URL}
+	_, span := Start(WithExporter(context.Background(), e), "op")
+	span.Finish()
+	err := e.Flush(context.Background())
+	assert.EqualError(t, err, "failed to export 1 spans: unexpected status 503")
+	assert.Empty(t, e.spans, "failed spans dropped")
+}
+
+func TestExporter_QueueLimit(t *testing.T) {
+	e := &Exporter{}
+	ctx := WithExporter(context.Background(), e)
+	for i := 0; i < maxQueued+10; i++ {
+		_, span := Start(ctx, "op")
+		span.Finish()
+	}
+	assert.Len(t, e.spans, maxQueued)
+	assert.Equal(t, 10, e.dropped)
+}
+
+func TestExporter_Run(t *testing.T) {
+	var lock sync.Mutex
+	exported := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		lock.Lock()
+		exported += len(req.ResourceSpans[0].ScopeSpans[0].Spans)
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	e := &Exporter{Endpoint: ts.URL, Interval: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+
+	_, span := Start(WithExporter(ctx, e), "first")
+	span.Finish()
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return exported == 1
+	}, time.Second, 10*time.Millisecond, "exported on interval")
+
+	_, span = Start(WithExporter(context.Background(), e), "last")
+	span.Finish()
+	cancel()
+	<-done
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 2, exported, "remaining spans exported on shutdown")
+}
@@ -0,0 +1,205 @@
+// Package tracing traces processing of telegram updates, from the update to detector checks and telegram actions,
+// to show where latency is spent. It implements a lightweight subset of OpenTelemetry tracing: spans have W3C trace
+// context ids, the context is propagated to outgoing http requests with the traceparent header, and spans are
+// exported by Exporter with OTLP over http/json, so they can be collected by any OpenTelemetry collector or
+// compatible backend, i.e. Jaeger or Grafana Tempo.
+//
+// Tracing is enabled by adding the exporter to the context with WithExporter. Without it Start returns nil span,
+// and all methods of nil span are no-op, so the code can be instrumented unconditionally.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SpanKind is a kind of span, values are the same as in OpenTelemetry
+type SpanKind int
+
+// span kinds
+const (
+	KindInternal SpanKind = 1 // internal operation
+	KindServer   SpanKind = 2 // handling of incoming request
+	KindClient   SpanKind = 3 // outgoing request, i.e. to CAS or OpenAI
+)
+
+// TraceparentHeader is the W3C trace context header propagated to outgoing requests
+const TraceparentHeader = "traceparent"
+
+// Attr is an attribute of span, value is string, bool or int64
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// String makes string attribute
+func String(key, val string) Attr { return Attr{Key: key, Value: val} }
+
+// Int64 makes integer attribute
+func Int64(key string, val int64) Attr { return Attr{Key: key, Value: val} }
+
+// Bool makes boolean attribute
+func Bool(key string, val bool) Attr { return Attr{Key: key, Value: val} }
+
+// Span is a timed operation of a trace. Fields are set by Start and End, and should not be changed directly.
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte // zero for root span
+	Name     string
+	Kind     SpanKind
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Err      error // error of the operation, span status is error if set
+
+	sampled  bool // span is exported, set for the whole trace by its root span
+	exporter *Exporter
+	lock     sync.Mutex
+	ended    bool
+}
+
+type exporterKey struct{}
+type spanKey struct{}
+
+// WithExporter returns the context with exporter, spans started with this context and its children are traced
+func WithExporter(ctx context.Context, e *Exporter) context.Context {
+	return context.WithValue(ctx, exporterKey{}, e)
+}
+
+// FromContext returns the current span of the context, nil if not traced
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start starts internal span as a child of the current span of the context, or as a root span of a new trace.
+// Returns the context with the started span, and nil span if tracing is not enabled for the context.
+// The span should be finished with Finish.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, KindInternal, attrs...)
+}
+
+func start(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	e, _ := ctx.Value(exporterKey{}).(*Exporter)
+	if e == nil {
+		return ctx, nil
+	}
+	s := &Span{Name: name, Kind: kind, Start: time.Now(), Attrs: attrs, exporter: e}
+	if parent := FromContext(ctx); parent != nil {
+		s.TraceID, s.ParentID, s.sampled = parent.TraceID, parent.SpanID, parent.sampled
+	} else {
+		randomID(s.TraceID[:])
+		s.sampled = e.sample()
+	}
+	randomID(s.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.Attrs = append(s.Attrs, attrs...)
+	}
+}
+
+// SetError marks the span as failed, nil error is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.Err = err
+	}
+}
+
+// Finish ends the span and queues it for export, if the trace is sampled. Repeated calls are ignored.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended, s.End = true, time.Now()
+	s.lock.Unlock()
+	if s.sampled {
+		s.exporter.record(s)
+	}
+}
+
+// Traceparent returns W3C traceparent header value of the span, empty for nil span
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", s.TraceID, s.SpanID, flags)
+}
+
+// Inject sets traceparent header to propagate the current span of the context, no-op if not traced
+func Inject(ctx context.Context, h http.Header) {
+	if s := FromContext(ctx); s != nil {
+		h.Set(TraceparentHeader, s.Traceparent())
+	}
+}
+
+// Transport is http.RoundTripper making a client span for each request with traced context,
+// and propagating the trace with traceparent header. Requests without traced context are passed as is.
+type Transport struct {
+	Base http.RoundTripper // transport making requests, http.DefaultTransport if nil
+}
+
+// RoundTrip makes the request with client span. Only method and host of the request are recorded,
+// as the url can contain secrets, i.e. the token of telegram api.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := start(req.Context(), fmt.Sprintf("HTTP %s %s", req.Method, req.URL.Host), KindClient,
+		String("http.request.method", req.Method), String("server.address", req.URL.Host))
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.Finish()
+
+	req = req.Clone(ctx) // round tripper should not modify the request
+	Inject(ctx, req.Header)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttributes(Int64("http.response.status_code", int64(resp.StatusCode)))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(fmt.Errorf("unexpected status %d", resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// randomID fills the id with random bytes, ids of spans and traces should not be zero
+func randomID(id []byte) {
+	if _, err := rand.Read(id); err != nil {
+		ts := time.Now().UnixNano()
+		for i := range id {
+			id[i] = byte(ts >> (8 * (i % 8)))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart(t *testing.T) {
+	t.Run("not traced", func(t *testing.T) {
+		ctx, span := Start(context.Background(), "op")
+		assert.Nil(t, span)
+		assert.Nil(t, FromContext(ctx))
+		// methods of nil span are no-op
+		span.SetAttributes(String("k", "v"))
+		span.SetError(errors.New("failed"))
+		span.Finish()
+		assert.Equal(t, "", span.Traceparent())
+	})
+
+	t.Run("traced", func(t *testing.T) {
+		e := &Exporter{}
+		ctx, root := Start(WithExporter(context.Background(), e), "root", Int64("id", 1))
+		require.NotNil(t, root)
+		assert.Equal(t, root, FromContext(ctx))
+		assert.NotEqual(t, [16]byte{}, root.TraceID)
+		assert.Equal(t, [8]byte{}, root.ParentID)
+
+		childCtx, child := Start(ctx, "child")
+		assert.Equal(t, child, FromContext(childCtx))
+		assert.Equal(t, root.TraceID, child.TraceID)
+		assert.Equal(t, root.SpanID, child.ParentID)
+		assert.NotEqual(t, root.SpanID, child.SpanID)
+		child.SetAttributes(Bool("spam", true))
+		child.SetError(errors.New("failed"))
+		child.Finish()
+		child.Finish()
+		child.SetAttributes(String("ignored", "after finish"))
+		root.Finish()
+
+		require.Len(t, e.spans, 2, "finished spans recorded once")
+		assert.Equal(t, "child", e.spans[0].Name)
+		assert.Equal(t, []Attr{Bool("spam", true)}, e.spans[0].Attrs)
+		assert.EqualError(t, e.spans[0].Err, "failed")
+		assert.False(t, e.spans[0].End.Before(e.spans[0].Start))
+		assert.Equal(t, "root", e.spans[1].Name)
+		assert.Equal(t, []Attr{Int64("id", 1)}, e.spans[1].Attrs)
+		assert.Equal(t, KindInternal, e.spans[1].Kind)
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		e := &Exporter{Ratio: 0.000001}
+		ctx, root := Start(WithExporter(context.Background(), e), "root")
+		_, child := Start(ctx, "child")
+		child.Finish()
+		root.Finish()
+		assert.Empty(t, e.spans, "not sampled spans are not recorded")
+		assert.Regexp(t, "^00-[0-9a-f]{32}-[0-9a-f]{16}-00$", root.Traceparent())
+	})
+}
+
+func TestInject(t *testing.T) {
+	h := http.Header{}
+	Inject(context.Background(), h)
+	assert.Empty(t, h.Get(TraceparentHeader))
+
+	ctx, span := Start(WithExporter(context.Background(), &Exporter{}), "op")
+	Inject(ctx, h)
+	assert.Equal(t, fmt.Sprintf("00-%x-%x-01", span.TraceID, span.SpanID), h.Get(TraceparentHeader))
+}
+
+func TestTransport(t *testing.T) {
+	var traceparent string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(TraceparentHeader)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+	client := &http.Client{Transport: &Transport{}}
+
+	t.Run("not traced", func(t *testing.T) {
+		resp, err := client.Get(ts.URL + "/check")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Empty(t, traceparent)
+	})
+
+	t.Run("traced", func(t *testing.T) {
+		e := &Exporter{}
+		ctx, parent := Start(WithExporter(context.Background(), e), "parent")
+		for _, path := range []string{"/check", "/fail"} {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, http.NoBody)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Empty(t, req.Header.Get(TraceparentHeader), "original request not modified")
+		}
+		require.Len(t, e.spans, 2)
+		span := e.spans[0]
+		assert.Equal(t, KindClient, span.Kind)
+		assert.Equal(t, parent.SpanID, span.ParentID)
+		assert.Regexp(t, regexp.MustCompile(`^HTTP GET 127\.0\.0\.1:\d+$`), span.Name)
+		assert.Contains(t, span.Attrs, Int64("http.response.status_code", 200))
+		assert.NoError(t, span.Err)
+		assert.EqualError(t, e.spans[1].Err, "unexpected status 502")
+		assert.Equal(t, e.spans[1].Traceparent(), traceparent, "span propagated to the server")
+	})
+}
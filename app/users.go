@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/lib"
+)
+
+// processUsers runs users export or import command. Approved users of the group are exported with metadata
+// to csv or json file, or imported from csv, json or txt list of ids, i.e. exported from another anti-spam bot.
+// Imported users are added to the stored ones, metadata of known users is updated with non-empty imported values.
+// The bot loads approved users on start, so users imported while it runs are used after restart.
+func processUsers(cmd string, opts options) error {
+	file := opts.Users.Export.Out
+	if cmd == "import" {
+		file = opts.Users.Import.In
+	}
+	formatName := opts.Users.Format
+	if formatName == "" {
+		formatName = filepath.Ext(file)
+	}
+	format, err := storage.ParseUsersFormat(formatName)
+	if err != nil {
+		return fmt.Errorf("can't get users format of %s, %w", file, err)
+	}
+
+	dataDB, err := storage.NewSqliteDB(filepath.Join(opts.Files.DynamicDataPath, dataFile))
+	if err != nil {
+		return fmt.Errorf("can't make data db, %w", err)
+	}
+	defer dataDB.Close()
+	store, err := storage.NewApprovedUsers(dataDB, opts.Telegram.Group)
+	if err != nil {
+		return fmt.Errorf("can't make approved users store, %w", err)
+	}
+	users, err := store.Users()
+	if err != nil {
+		return fmt.Errorf("can't read approved users, %w", err)
+	}
+
+	switch cmd {
+	case "export":
+		return exportUsers(file, format, users)
+	case "import":
+		fh, err := os.Open(file) //nolint:gosec // file set by user
+		if err != nil {
+			return fmt.Errorf("can't open %s, %w", file, err)
+		}
+		defer fh.Close()
+		imported, skipped, err := storage.ReadUsers(fh, format)
+		if err != nil {
+			return fmt.Errorf("can't read approved users from %s, %w", file, err)
+		}
+		if err = store.Store(mergeUsers(users, imported)); err != nil {
+			return fmt.Errorf("can't store approved users, %w", err)
+		}
+		log.Printf("[INFO] %d approved users imported from %s, skipped invalid: %d", len(imported), file, skipped)
+		return nil
+	}
+	return fmt.Errorf("unknown users command %q", cmd)
+}
+
+// exportUsers writes users to the file, the existing file is replaced only if all users are written
+func exportUsers(file string, format storage.UsersFormat, users []lib.ApprovedUser) error {
+	tmpFile := file + ".tmp"
+	fh, err := os.Create(tmpFile) //nolint:gosec // file set by user
+	if err != nil {
+		return fmt.Errorf("can't create %s, %w", tmpFile, err)
+	}
+	defer os.Remove(tmpFile) // no-op after rename
+	if err = storage.WriteUsers(fh, format, users); err != nil {
+		fh.Close()
+		return fmt.Errorf("can't write approved users, %w", err)
+	}
+	if err = fh.Close(); err != nil {
+		return fmt.Errorf("can't close %s, %w", tmpFile, err)
+	}
+	if err = os.Rename(tmpFile, file); err != nil {
+		return fmt.Errorf("can't rename %s, %w", tmpFile, err)
+	}
+	log.Printf("[INFO] %d approved users exported to %s", len(users), file)
+	return nil
+}
+
+// mergeUsers returns imported users merged with the existing ones, the same way as detector approves known users:
+// the max of counts, and non-empty name and later last seen of the imported user. Users without first seen time
+// are approved now.
+func mergeUsers(existing, imported []lib.ApprovedUser) []lib.ApprovedUser {
+	known := make(map[string]lib.ApprovedUser, len(existing))
+	for _, u := range existing {
+		known[u.UserID] = u
+	}
+	now := time.Now()
+	res := make([]lib.ApprovedUser, 0, len(imported))
+	for _, u := range imported {
+		e, ok := known[u.UserID]
+		if !ok {
+			if u.FirstSeen.IsZero() {
+				u.FirstSeen = now
+			}
+			res = append(res, u)
+			continue
+		}
+		e.Count = max(e.Count, u.Count)
+		if u.UserName != "" {
+			e.UserName = u.UserName
+		}
+		if u.LastSeen.After(e.LastSeen) {
+			e.LastSeen = u.LastSeen
+		}
+		res = append(res, e)
+	}
+	return res
+}
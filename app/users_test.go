@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func Test_processUsers(t *testing.T) {
+	var opts options
+	opts.Files.DynamicDataPath = t.TempDir()
+	opts.Telegram.Group = "gr1"
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	db, err := storage.NewSqliteDB(filepath.Join(opts.Files.DynamicDataPath, dataFile))
+	require.NoError(t, err)
+	store, err := storage.NewApprovedUsers(db, "gr1")
+	require.NoError(t, err)
+	require.NoError(t, store.Store([]lib.ApprovedUser{{UserID: "123", UserName: "user1", Count: 5, FirstSeen: ts}}))
+	require.NoError(t, db.Close())
+
+	// ids exported from another bot, the known user keeps its metadata
+	idsFile := filepath.Join(t.TempDir(), "shieldy.txt")
+	require.NoError(t, os.WriteFile(idsFile, []byte("123\n456\n@name\n"), 0o600))
+	opts.Users.Import.In = idsFile
+	require.NoError(t, processUsers("import", opts))
+
+	// csv import updates metadata of the known user
+	csvFile := filepath.Join(t.TempDir(), "users")
+	require.NoError(t, os.WriteFile(csvFile, []byte("user_id,user_name,count\n123,user1-new,2\n"), 0o600))
+	opts.Users.Import.In, opts.Users.Format = csvFile, "csv"
+	require.NoError(t, processUsers("import", opts))
+
+	opts.Users.Format = ""
+	opts.Users.Export.Out = filepath.Join(t.TempDir(), "users.csv")
+	require.NoError(t, processUsers("export", opts))
+	data, err := os.ReadFile(opts.Users.Export.Out)
+	require.NoError(t, err)
+	lines := []string{"user_id,user_name,count,first_seen,last_seen", "123,user1-new,5,2024-05-01T10:00:00Z,"}
+	assert.Contains(t, string(data), lines[0]+"\n"+lines[1]+"\n")
+	assert.Contains(t, string(data), "\n456,,0,")
+
+	opts.Users.Export.Out = filepath.Join(t.TempDir(), "users.xml")
+	assert.Error(t, processUsers("export", opts), "unknown format")
+	opts.Users.Import.In = filepath.Join(t.TempDir(), "not-found.txt")
+	assert.Error(t, processUsers("import", opts))
+
+	opts.Telegram.Group = "gr2"
+	opts.Users.Export.Out = filepath.Join(t.TempDir(), "users.txt")
+	require.NoError(t, processUsers("export", opts))
+	data, err = os.ReadFile(opts.Users.Export.Out)
+	require.NoError(t, err)
+	assert.Empty(t, string(data), "users of another group are not exported")
+}
@@ -0,0 +1,66 @@
+package webapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// accessRecord is a record of access log, written as a json line per request
+type accessRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	LatencyMS float64   `json:"latency_ms"`
+	Actor     string    `json:"actor"` // "basic", "key:<name>", "jwt:<subject>", "anonymous" or empty if not authenticated
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// accessRecordKey is a context key of the access record of the request, to set the actor after auth
+type accessRecordKey struct{}
+
+// accessLog writes a json line per request to the access log, separate from the app log, if enabled.
+// The actor is set by auth middleware, so requests rejected by auth are logged with empty actor.
+func (s *Server) accessLog(next http.Handler) http.Handler {
+	if s.AccessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &accessRecord{Time: start, Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery,
+			IP: s.clientIP(r), UserAgent: r.UserAgent()}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), accessRecordKey{}, rec)))
+
+		rec.Status, rec.Bytes = ww.Status(), ww.BytesWritten()
+		if rec.Status == 0 {
+			rec.Status = http.StatusOK // nothing written by handler
+		}
+		rec.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		data, err := json.Marshal(rec)
+		if err != nil {
+			log.Printf("[WARN] can't marshal access record, %v", err)
+			return
+		}
+		s.accessLock.Lock()
+		defer s.accessLock.Unlock()
+		if _, err = s.AccessLog.Write(append(data, '\n')); err != nil {
+			log.Printf("[WARN] can't write access log, %v", err)
+		}
+	})
+}
+
+// setAccessActor sets the actor of the request's access record, if access log enabled
+func setAccessActor(ctx context.Context, actor string) {
+	if rec, ok := ctx.Value(accessRecordKey{}).(*accessRecord); ok {
+		rec.Actor = actor
+	}
+}
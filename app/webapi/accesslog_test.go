@@ -0,0 +1,73 @@
+package webapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_accessLog(t *testing.T) {
+	var buf bytes.Buffer
+	spamFilter := &mocks.DetectorMock{ApprovedUsersFunc: func() []lib.ApprovedUser { return nil }}
+	server := NewServer(Config{SpamFilter: spamFilter, AuthPasswd: "passwd", AccessLog: &buf})
+	router := chi.NewRouter()
+	router.Use(server.accessLog, server.auth)
+	ts := httptest.NewServer(server.routes(router))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/users?limit=10", http.NoBody)
+	require.NoError(t, err)
+	req.SetBasicAuth("tg-spam", "passwd")
+	req.Header.Set("User-Agent", "test-agent")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(ts.URL+"/check", "application/json", strings.NewReader(`{"msg": "spam"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2, "json line per request")
+
+	var rec accessRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &rec))
+	assert.Equal(t, http.MethodGet, rec.Method)
+	assert.Equal(t, "/users", rec.Path)
+	assert.Equal(t, "limit=10", rec.Query)
+	assert.Equal(t, http.StatusOK, rec.Status)
+	assert.Positive(t, rec.Bytes)
+	assert.GreaterOrEqual(t, rec.LatencyMS, 0.0)
+	assert.Equal(t, "basic", rec.Actor)
+	assert.Equal(t, "127.0.0.1", rec.IP)
+	assert.Equal(t, "test-agent", rec.UserAgent)
+	assert.False(t, rec.Time.IsZero())
+
+	rec = accessRecord{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &rec))
+	assert.Equal(t, http.MethodPost, rec.Method)
+	assert.Equal(t, "/check", rec.Path)
+	assert.Equal(t, http.StatusUnauthorized, rec.Status)
+	assert.Empty(t, rec.Actor, "not authenticated")
+
+	t.Run("disabled", func(t *testing.T) {
+		server := NewServer(Config{})
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		h := server.accessLog(next)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", http.NoBody))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -0,0 +1,248 @@
+package webapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// maxKeyUsage is the max number of usage audit records returned by GET /keys/{id}/usage
+const maxKeyUsage = 1000
+
+// actorKey is a context key of the actor, i.e. the credential the request authenticated with
+type actorKey struct{}
+
+// withActor returns the request with the actor in its context
+func withActor(r *http.Request, actor string) *http.Request {
+	setAccessActor(r.Context(), actor)
+	return r.WithContext(context.WithValue(r.Context(), actorKey{}, actor))
+}
+
+// actorFrom returns the actor of the request, "basic", "key:<name>" or "jwt:<subject>",
+// and "anonymous" if auth is disabled
+func actorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok {
+		return actor
+	}
+	return "anonymous"
+}
+
+// apiSource returns source of samples added with the request, "api:<actor>"
+func apiSource(r *http.Request) string {
+	return "api:" + actorFrom(r.Context())
+}
+
+// auth authenticates requests with basic auth password, api key or jwt, whichever is enabled.
+// Basic auth gives full access, api keys and tokens are limited by their scope.
+// Requests are not authenticated at all if none of the methods is enabled.
+func (s *Server) auth(next http.Handler) http.Handler {
+	return s.authWithPasswd(s.AuthPasswd, next)
+}
+
+// authWithPasswd authenticates requests the same way as auth, but with the given basic auth password.
+// The check api has its own password, while api keys and tokens are shared by both apis.
+func (s *Server) authWithPasswd(authPasswd string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authPasswd == "" && s.APIKeys == nil && s.JWT == nil {
+			next.ServeHTTP(w, withActor(r, "anonymous"))
+			return
+		}
+		if s.lockedOut(w, r) {
+			return
+		}
+
+		if user, passwd, ok := r.BasicAuth(); ok && authPasswd != "" {
+			if subtle.ConstantTimeCompare([]byte(user), []byte("tg-spam")) != 1 ||
+				subtle.ConstantTimeCompare([]byte(passwd), []byte(authPasswd)) != 1 {
+				s.authFailed(r)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			s.authSucceeded(r)
+			next.ServeHTTP(w, withActor(r, "basic"))
+			return
+		}
+
+		token := authToken(r)
+		switch {
+		case token != "" && s.APIKeys != nil && strings.Count(token, ".") != 2: // keys never have dots, tokens have two
+			s.authAPIKey(w, r, next, token)
+		case token != "" && s.JWT != nil:
+			s.authJWT(w, r, next, token)
+		default:
+			if authPasswd != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="tg-spam", charset="UTF-8"`) // prompt for web ui
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+}
+
+// authAPIKey authenticates the request with api key and records it to the key's usage audit
+func (s *Server) authAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	key, err := s.APIKeys.Find(token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.authFailed(r)
+		} else {
+			log.Printf("[WARN] can't check api key, %v", err)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid api key"})
+		return
+	}
+	s.authSucceeded(r)
+
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	if allowedScope(key.Scope, r) {
+		next.ServeHTTP(ww, withActor(r, "key:"+key.Name))
+	} else {
+		ww.WriteHeader(http.StatusForbidden)
+		rest.RenderJSON(ww, rest.JSON{"error": "not allowed for api key scope", "scope": key.Scope})
+	}
+	status := ww.Status()
+	if status == 0 {
+		status = http.StatusOK // nothing written by handler
+	}
+	if err := s.APIKeys.Used(key.ID, r.Method, r.URL.Path, status); err != nil {
+		log.Printf("[WARN] can't record usage of api key %q, %v", key.Name, err)
+	}
+}
+
+// authJWT authenticates the request with jwt issued by external identity provider
+func (s *Server) authJWT(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	claims, err := s.JWT.Validate(r.Context(), token)
+	if err != nil {
+		log.Printf("[INFO] jwt rejected for %s %s, %v", r.Method, r.URL.Path, err)
+		s.authFailed(r)
+		w.WriteHeader(http.StatusUnauthorized)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid token", "details": err.Error()})
+		return
+	}
+	scope, err := claims.APIScope()
+	if err != nil || !allowedScope(scope, r) {
+		log.Printf("[INFO] jwt of %q not allowed for %s %s, scope %q", claims.Subject, r.Method, r.URL.Path, claims.Scope)
+		w.WriteHeader(http.StatusForbidden)
+		rest.RenderJSON(w, rest.JSON{"error": "not allowed for token scope", "scope": claims.Scope})
+		return
+	}
+	s.authSucceeded(r)
+	log.Printf("[DEBUG] jwt of %q accepted for %s %s", claims.Subject, r.Method, r.URL.Path)
+	next.ServeHTTP(w, withActor(r, "jwt:"+claims.Subject))
+}
+
+// allowedScope returns true if the scope allows the request. Check scope allows spam checks only,
+// denylist scope allows the denylist feed of peer instances only.
+func allowedScope(scope storage.APIKeyScope, r *http.Request) bool {
+	switch scope {
+	case storage.APIKeyScopeManage:
+		return true
+	case storage.APIKeyScopeCheck:
+		return r.Method == http.MethodPost && (r.URL.Path == "/check" || r.URL.Path == "/check/batch")
+	case storage.APIKeyScopeDenylist:
+		return r.Method == http.MethodGet && r.URL.Path == "/denylist"
+	}
+	return false
+}
+
+// authToken returns api key or jwt from X-API-Key or Authorization: Bearer headers
+func authToken(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// getKeysHandler handles GET /keys request. It returns all api keys, without keys themselves.
+func (s *Server) getKeysHandler(w http.ResponseWriter, _ *http.Request) {
+	keys, err := s.APIKeys.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't list api keys", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"keys": keys, "count": len(keys)})
+}
+
+// addKeyHandler handles POST /keys request. It generates a new api key with the given name and scope.
+// The key is returned once, it can't be retrieved later.
+func (s *Server) addKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string              `json:"name"`
+		Scope storage.APIKeyScope `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		return
+	}
+	key, err := s.APIKeys.Add(req.Name, req.Scope)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't add api key", "details": err.Error()})
+		return
+	}
+	log.Printf("[INFO] api key %q with scope %q added", req.Name, req.Scope)
+	rest.RenderJSON(w, rest.JSON{"name": req.Name, "scope": req.Scope, "key": key})
+}
+
+// deleteKeyHandler handles DELETE /keys/{id} request. It removes the api key, the key's usage audit is kept.
+func (s *Server) deleteKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid id", "details": err.Error()})
+		return
+	}
+	if err = s.APIKeys.Delete(id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, sql.ErrNoRows) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		rest.RenderJSON(w, rest.JSON{"error": "can't delete", "details": err.Error()})
+		return
+	}
+	log.Printf("[INFO] api key %d deleted", id)
+	rest.RenderJSON(w, rest.JSON{"deleted": true, "id": id})
+}
+
+// keyUsageHandler handles GET /keys/{id}/usage?limit=N request. It returns the latest requests made with the key.
+func (s *Server) keyUsageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid id", "details": err.Error()})
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxKeyUsage {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid limit", "details": "expected 1-" + strconv.Itoa(maxKeyUsage)})
+			return
+		}
+	}
+	usage, err := s.APIKeys.Usage(id, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't get api key usage", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"usage": usage, "count": len(usage)})
+}
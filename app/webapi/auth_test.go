@@ -0,0 +1,277 @@
+package webapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_auth(t *testing.T) {
+	keys := &mocks.APIKeysStoreMock{
+		FindFunc: func(key string) (storage.APIKey, error) {
+			switch key {
+			case "tgs_check":
+				return storage.APIKey{ID: 1, Name: "ci", Scope: storage.APIKeyScopeCheck}, nil
+			case "tgs_manage":
+				return storage.APIKey{ID: 2, Name: "admin", Scope: storage.APIKeyScopeManage}, nil
+			case "tgs_denylist":
+				return storage.APIKey{ID: 3, Name: "peer", Scope: storage.APIKeyScopeDenylist}, nil
+			}
+			return storage.APIKey{}, fmt.Errorf("not found: %w", sql.ErrNoRows)
+		},
+		UsedFunc: func(id int64, method, path string, status int) error { return nil },
+	}
+	spamFilter := &mocks.DetectorMock{
+		CheckFunc:         func(msg string, userID string) (bool, []lib.CheckResult) { return false, nil },
+		ApprovedUsersFunc: func() []lib.ApprovedUser { return nil },
+	}
+	denylist := &mocks.DenylistStoreMock{LocalFunc: func(since time.Time, limit int) ([]storage.DenylistEntry, error) {
+		return nil, nil
+	}}
+	server := NewServer(Config{SpamFilter: spamFilter, AuthPasswd: "passwd", APIKeys: keys, JWT: &JWT{Secret: "secret"},
+		Denylist: denylist})
+	router := chi.NewRouter()
+	router.Use(server.auth)
+	ts := httptest.NewServer(server.routes(router))
+	defer ts.Close()
+
+	token := func(scope string) string {
+		return makeHS256Token(t, "secret", map[string]any{"sub": "ci", "exp": time.Now().Add(time.Hour).Unix(), "scope": scope})
+	}
+
+	tbl := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		basic   string
+		status  int
+	}{
+		{name: "no auth", method: "POST", path: "/check", status: http.StatusUnauthorized},
+		{name: "basic auth", method: "GET", path: "/users", basic: "passwd", status: http.StatusOK},
+		{name: "wrong basic auth", method: "GET", path: "/users", basic: "bad", status: http.StatusForbidden},
+		{name: "check key, check", method: "POST", path: "/check", status: http.StatusOK,
+			headers: map[string]string{"X-API-Key": "tgs_check"}},
+		{name: "check key as bearer, check", method: "POST", path: "/check", status: http.StatusOK,
+			headers: map[string]string{"Authorization": "Bearer tgs_check"}},
+		{name: "check key, users", method: "GET", path: "/users", status: http.StatusForbidden,
+			headers: map[string]string{"X-API-Key": "tgs_check"}},
+		{name: "manage key, users", method: "GET", path: "/users", status: http.StatusOK,
+			headers: map[string]string{"X-API-Key": "tgs_manage"}},
+		{name: "denylist key, denylist", method: "GET", path: "/denylist", status: http.StatusOK,
+			headers: map[string]string{"Authorization": "Bearer tgs_denylist"}},
+		{name: "denylist key, check", method: "POST", path: "/check", status: http.StatusForbidden,
+			headers: map[string]string{"X-API-Key": "tgs_denylist"}},
+		{name: "check key, denylist", method: "GET", path: "/denylist", status: http.StatusForbidden,
+			headers: map[string]string{"X-API-Key": "tgs_check"}},
+		{name: "unknown key", method: "POST", path: "/check", status: http.StatusUnauthorized,
+			headers: map[string]string{"X-API-Key": "tgs_unknown"}},
+		{name: "check jwt, check", method: "POST", path: "/check", status: http.StatusOK,
+			headers: map[string]string{"Authorization": "Bearer " + token("tg-spam:check")}},
+		{name: "check jwt, users", method: "GET", path: "/users", status: http.StatusForbidden,
+			headers: map[string]string{"Authorization": "Bearer " + token("tg-spam:check")}},
+		{name: "manage jwt, users", method: "GET", path: "/users", status: http.StatusOK,
+			headers: map[string]string{"Authorization": "Bearer " + token("tg-spam:manage")}},
+		{name: "jwt without scope", method: "POST", path: "/check", status: http.StatusForbidden,
+			headers: map[string]string{"Authorization": "Bearer " + token("openid")}},
+		{name: "invalid jwt", method: "POST", path: "/check", status: http.StatusUnauthorized,
+			headers: map[string]string{"Authorization": "Bearer " + token("tg-spam:check") + "x"}},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(`{"msg": "test"}`))
+			require.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if tt.basic != "" {
+				req.SetBasicAuth("tg-spam", tt.basic)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("usage recorded", func(t *testing.T) {
+		keys.ResetCalls()
+		for _, path := range []string{"/check", "/users"} {
+			req, err := http.NewRequest("POST", ts.URL+path, strings.NewReader(`{"msg": "test"}`))
+			require.NoError(t, err)
+			req.Header.Set("X-API-Key", "tgs_check")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		calls := keys.UsedCalls()
+		require.Len(t, calls, 2)
+		assert.Equal(t, int64(1), calls[0].ID)
+		assert.Equal(t, "/check", calls[0].Path)
+		assert.Equal(t, http.StatusOK, calls[0].Status)
+		assert.Equal(t, "/users", calls[1].Path)
+		assert.Equal(t, http.StatusForbidden, calls[1].Status, "rejected requests recorded as well")
+	})
+
+	t.Run("prompt for basic auth", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/ui/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, `Basic realm="tg-spam", charset="UTF-8"`, resp.Header.Get("WWW-Authenticate"))
+	})
+}
+
+func TestServer_authActor(t *testing.T) {
+	keys := &mocks.APIKeysStoreMock{
+		FindFunc: func(key string) (storage.APIKey, error) {
+			return storage.APIKey{ID: 1, Name: "admin", Scope: storage.APIKeyScopeManage}, nil
+		},
+		UsedFunc: func(id int64, method, path string, status int) error { return nil },
+	}
+	var actor string
+	handler := func(w http.ResponseWriter, r *http.Request) { actor = actorFrom(r.Context()) }
+
+	server := NewServer(Config{AuthPasswd: "passwd", APIKeys: keys, JWT: &JWT{Secret: "secret"}})
+	token := makeHS256Token(t, "secret", map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(),
+		"scope": "tg-spam:manage"})
+
+	req := httptest.NewRequest(http.MethodGet, "/users", http.NoBody)
+	req.SetBasicAuth("tg-spam", "passwd")
+	server.auth(http.HandlerFunc(handler)).ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "basic", actor)
+
+	req = httptest.NewRequest(http.MethodGet, "/users", http.NoBody)
+	req.Header.Set("X-API-Key", "tgs_manage")
+	server.auth(http.HandlerFunc(handler)).ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "key:admin", actor)
+
+	req = httptest.NewRequest(http.MethodGet, "/users", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+token)
+	server.auth(http.HandlerFunc(handler)).ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "jwt:alice", actor)
+
+	req = httptest.NewRequest(http.MethodGet, "/users", http.NoBody)
+	NewServer(Config{}).auth(http.HandlerFunc(handler)).ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "anonymous", actor, "auth disabled")
+}
+
+func TestServer_authDisabled(t *testing.T) {
+	spamFilter := &mocks.DetectorMock{ApprovedUsersFunc: func() []lib.ApprovedUser { return nil }}
+	server := NewServer(Config{SpamFilter: spamFilter})
+	router := chi.NewRouter()
+	router.Use(server.auth)
+	ts := httptest.NewServer(server.routes(router))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/users")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/keys")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "no keys endpoints without keys store")
+}
+
+func TestServer_keysHandlers(t *testing.T) {
+	lastUsed := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	keys := &mocks.APIKeysStoreMock{
+		ListFunc: func() ([]storage.APIKey, error) {
+			return []storage.APIKey{{ID: 1, Name: "ci", Scope: storage.APIKeyScopeCheck, LastUsed: &lastUsed, Uses: 5}}, nil
+		},
+		AddFunc: func(name string, scope storage.APIKeyScope) (string, error) {
+			if scope != storage.APIKeyScopeCheck && scope != storage.APIKeyScopeManage {
+				return "", fmt.Errorf("invalid api key scope %q", scope)
+			}
+			return "tgs_newkey", nil
+		},
+		DeleteFunc: func(id int64) error {
+			if id != 1 {
+				return fmt.Errorf("api key %d not found: %w", id, sql.ErrNoRows)
+			}
+			return nil
+		},
+		UsageFunc: func(id int64, limit int) ([]storage.APIKeyUsage, error) {
+			return []storage.APIKeyUsage{{KeyID: id, Method: "POST", Path: "/check", Status: 200}}, nil
+		},
+	}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, APIKeys: keys})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	do := func(t *testing.T, method, path, body string) (int, map[string]any) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		res := map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp.StatusCode, res
+	}
+
+	t.Run("list", func(t *testing.T) {
+		status, res := do(t, "GET", "/keys", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 1.0, res["count"])
+		assert.Equal(t, []any{map[string]any{"id": 1.0, "name": "ci", "scope": "check", "created": "0001-01-01T00:00:00Z",
+			"last_used": "2024-05-01T10:00:00Z", "uses": 5.0}}, res["keys"])
+	})
+
+	t.Run("add", func(t *testing.T) {
+		status, res := do(t, "POST", "/keys", `{"name": "ci2", "scope": "check"}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, map[string]any{"name": "ci2", "scope": "check", "key": "tgs_newkey"}, res)
+		require.Len(t, keys.AddCalls(), 1)
+		assert.Equal(t, "ci2", keys.AddCalls()[0].Name)
+
+		status, res = do(t, "POST", "/keys", `{"name": "ci2", "scope": "root"}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, `invalid api key scope "root"`, res["details"])
+
+		status, _ = do(t, "POST", "/keys", `bad`)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		status, res := do(t, "DELETE", "/keys/1", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, true, res["deleted"])
+
+		status, _ = do(t, "DELETE", "/keys/2", "")
+		assert.Equal(t, http.StatusNotFound, status)
+		status, _ = do(t, "DELETE", "/keys/abc", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		status, res := do(t, "GET", "/keys/1/usage?limit=10", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 1.0, res["count"])
+		require.Len(t, keys.UsageCalls(), 1)
+		assert.Equal(t, 10, keys.UsageCalls()[0].Limit)
+
+		status, _ = do(t, "GET", "/keys/1/usage", "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 100, keys.UsageCalls()[1].Limit, "default limit")
+
+		status, _ = do(t, "GET", "/keys/1/usage?limit=100000", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
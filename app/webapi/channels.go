@@ -0,0 +1,63 @@
+package webapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// getChannelsHandler handles GET /channels request. It returns channels allowed to post in the group on their behalf.
+func (s *Server) getChannelsHandler(w http.ResponseWriter, _ *http.Request) {
+	channels, err := s.Channels.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read allowed channels", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"channels": channels, "count": len(channels)})
+}
+
+// allowChannelHandler handles POST /channels request with {"chat_id": -1001234567890, "name": "linked channel"} body.
+// It allows the channel to post in the group on its behalf, messages of allowed channels are not checked.
+func (s *Server) allowChannelHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChatID int64  `json:"chat_id"`
+		Name   string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		return
+	}
+	ch := storage.AllowedChannel{ChatID: req.ChatID, Name: req.Name, AddedBy: apiSource(r)}
+	if err := s.Channels.Add(ch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't allow channel", "details": err.Error()})
+		return
+	}
+	s.audit(r, "allowchannel", 0, req.ChatID, req.Name)
+	rest.RenderJSON(w, rest.JSON{"allowed": true, "chat_id": req.ChatID, "name": req.Name})
+}
+
+// blockChannelHandler handles DELETE /channels/{id} request. It removes the channel from allowed ones,
+// messages on behalf of it are checked as any other. Channels allowed by options can't be removed.
+func (s *Server) blockChannelHandler(w http.ResponseWriter, r *http.Request) {
+	chatID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || chatID == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid channel id", "details": chi.URLParam(r, "id")})
+		return
+	}
+	if err = s.Channels.Remove(chatID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't block channel", "details": err.Error()})
+		return
+	}
+	s.audit(r, "blockchannel", 0, chatID, "")
+	rest.RenderJSON(w, rest.JSON{"blocked": true, "chat_id": chatID})
+}
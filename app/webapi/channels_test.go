@@ -0,0 +1,101 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_channelsHandlers(t *testing.T) {
+	channels := &mocks.AllowedChannelsStoreMock{
+		AddFunc: func(ch storage.AllowedChannel) error {
+			if ch.ChatID == 0 {
+				return errors.New("empty id of allowed channel")
+			}
+			return nil
+		},
+		RemoveFunc: func(chatID int64) error {
+			if chatID == -1003 {
+				return errors.New("channel -1003 is allowed by options")
+			}
+			return nil
+		},
+		ListFunc: func() ([]storage.AllowedChannel, error) {
+			return []storage.AllowedChannel{{ChatID: -1001, Name: "linked", AddedBy: "config"}}, nil
+		},
+	}
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Channels: channels, Audit: audit}).
+		routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("list", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/channels")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res struct {
+			Channels []storage.AllowedChannel `json:"channels"`
+			Count    int                      `json:"count"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 1, res.Count)
+		assert.Equal(t, "linked", res.Channels[0].Name)
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/channels", "application/json",
+			strings.NewReader(`{"chat_id": -1002, "name": "partner news"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, channels.AddCalls(), 1)
+		assert.Equal(t, storage.AllowedChannel{ChatID: -1002, Name: "partner news", AddedBy: "api:anonymous"},
+			channels.AddCalls()[0].Ch)
+		require.Len(t, audit.AddCalls(), 1)
+		assert.Equal(t, storage.ModerationAction{Action: "allowchannel", UserID: -1002, Actor: "anonymous",
+			Details: "partner news"}, audit.AddCalls()[0].Action)
+
+		for _, body := range []string{`{"name": "no id"}`, `bad json`} {
+			resp, err := http.Post(ts.URL+"/channels", "application/json", strings.NewReader(body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		audit.ResetCalls()
+		for path, status := range map[string]int{"/channels/-1002": http.StatusOK, "/channels/-1003": http.StatusBadRequest,
+			"/channels/abc": http.StatusBadRequest} {
+			req, err := http.NewRequest(http.MethodDelete, ts.URL+path, http.NoBody)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, status, resp.StatusCode, path)
+		}
+		require.Len(t, audit.AddCalls(), 1)
+		assert.Equal(t, storage.ModerationAction{Action: "blockchannel", UserID: -1002, Actor: "anonymous"},
+			audit.AddCalls()[0].Action)
+	})
+
+	t.Run("channels disabled", func(t *testing.T) {
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + "/channels")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
@@ -0,0 +1,25 @@
+package webapi
+
+import (
+	"github.com/go-chi/chi"
+)
+
+// CheckAPI is a separate public api serving spam checks only, with its own listen address and basic auth password.
+// It lets other services check messages for spam without access to samples, users and settings management.
+// Api keys and tokens are accepted by both apis, limited by their scope.
+type CheckAPI struct {
+	ListenAddr string // listen address, check api disabled if empty
+	AuthPasswd string // basic auth password for user "tg-spam", empty disables basic auth
+}
+
+// Enabled returns true if check api should be started
+func (c CheckAPI) Enabled() bool {
+	return c.ListenAddr != ""
+}
+
+// checkRoutes sets up routes of the check api
+func (s *Server) checkRoutes(router *chi.Mux) *chi.Mux {
+	router.Post("/check", s.checkHandler)            // check a message for spam
+	router.Post("/check/batch", s.checkBatchHandler) // check a list of messages for spam
+	return router
+}
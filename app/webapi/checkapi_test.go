@@ -0,0 +1,81 @@
+package webapi
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_RunCheckAPI(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockDetector := &mocks.DetectorMock{
+		CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+			return false, []lib.CheckResult{{Details: "not spam"}}
+		},
+		ApprovedUsersFunc: func() []lib.ApprovedUser { return nil },
+	}
+
+	srv := NewServer(Config{ListenAddr: ":9881", Version: "dev", SpamFilter: mockDetector, AuthPasswd: "admin",
+		CheckAPI: CheckAPI{ListenAddr: ":9882", AuthPasswd: "check"}})
+	done := make(chan struct{})
+	go func() {
+		err := srv.Run(ctx)
+		assert.NoError(t, err)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	send := func(method, url, passwd string) int {
+		req, err := http.NewRequest(method, url, strings.NewReader(`{"msg": "hello", "user_id": "1"}`))
+		require.NoError(t, err)
+		req.SetBasicAuth("tg-spam", passwd)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tbl := []struct {
+		method, url, passwd string
+		status              int
+	}{
+		{http.MethodPost, "http://localhost:9882/check", "check", http.StatusOK},
+		{http.MethodPost, "http://localhost:9882/check", "admin", http.StatusForbidden},
+		{http.MethodGet, "http://localhost:9882/ping", "", http.StatusOK},
+		{http.MethodGet, "http://localhost:9882/users", "check", http.StatusNotFound},
+		{http.MethodGet, "http://localhost:9882/settings", "check", http.StatusNotFound},
+		{http.MethodPost, "http://localhost:9881/check", "admin", http.StatusOK},
+		{http.MethodPost, "http://localhost:9881/check", "check", http.StatusForbidden},
+		{http.MethodGet, "http://localhost:9881/users", "admin", http.StatusOK},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.status, send(tt.method, tt.url, tt.passwd), "%s %s", tt.method, tt.url)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestServer_RunCheckAPIFailed(t *testing.T) {
+	srv := NewServer(Config{ListenAddr: ":9883", SpamFilter: &mocks.DetectorMock{},
+		CheckAPI: CheckAPI{ListenAddr: "bad-addr"}})
+	done := make(chan error)
+	go func() { done <- srv.Run(context.Background()) }()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to run server on bad-addr")
+	case <-time.After(5 * time.Second):
+		t.Fatal("server not stopped on failure of check api")
+	}
+}
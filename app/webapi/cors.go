@@ -0,0 +1,57 @@
+package webapi
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// corsMaxAge is the max age of preflight responses cached by browsers, in seconds
+const corsMaxAge = "600"
+
+// cors allows cross-origin requests from browser frontends of allowed origins. Preflight requests are
+// answered before auth, as browsers send them without credentials. Credentials are passed in Authorization
+// or X-API-Key headers, so cookies are not allowed.
+func (s *Server) cors(next http.Handler) http.Handler {
+	if len(s.CORSOrigins) == 0 {
+		return next
+	}
+	anyOrigin := slices.Contains(s.CORSOrigins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r) // not a cross-origin request
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := anyOrigin || slices.ContainsFunc(s.CORSOrigins, func(o string) bool {
+			return strings.EqualFold(strings.TrimSuffix(o, "/"), origin)
+		})
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !allowed {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r) // browser blocks the response without allow headers
+			return
+		}
+
+		if anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, Retry-After")
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
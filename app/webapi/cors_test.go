@@ -0,0 +1,60 @@
+package webapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_cors(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	send := func(server *Server, method, origin string, preflight bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/check", http.NoBody)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		rec := httptest.NewRecorder()
+		server.cors(next).ServeHTTP(rec, req)
+		return rec
+	}
+
+	server := NewServer(Config{CORSOrigins: []string{"https://dash.example.com/"}})
+
+	rec := send(server, http.MethodOptions, "https://dash.example.com", true)
+	assert.Equal(t, http.StatusNoContent, rec.Code, "preflight answered without auth")
+	assert.Equal(t, "https://dash.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, PUT, DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type, X-API-Key", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	rec = send(server, http.MethodPost, "https://dash.example.com", false)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Equal(t, "https://dash.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Content-Disposition, Retry-After", rec.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+
+	rec = send(server, http.MethodOptions, "https://evil.com", true)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "preflight of not allowed origin")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = send(server, http.MethodPost, "https://evil.com", false)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = send(server, http.MethodPost, "", false)
+	assert.Equal(t, http.StatusTeapot, rec.Code, "same-origin request")
+	assert.Empty(t, rec.Header().Get("Vary"))
+
+	rec = send(NewServer(Config{CORSOrigins: []string{"*"}}), http.MethodOptions, "https://any.example.com", true)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = send(NewServer(Config{}), http.MethodOptions, "https://dash.example.com", true)
+	assert.Equal(t, http.StatusTeapot, rec.Code, "disabled")
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,181 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-pkgz/rest"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultAlertOpenAICost is the default daily cost of openai requests, in USD, alerted by generated rules
+const defaultAlertOpenAICost = 5.0
+
+// alertRules is a prometheus rules file
+type alertRules struct {
+	Groups []alertGroup `yaml:"groups"`
+}
+
+type alertGroup struct {
+	Name  string      `yaml:"name"`
+	Rules []alertRule `yaml:"rules"`
+}
+
+type alertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// dashboardHandler handles GET /metrics/dashboard request. It returns grafana dashboard of GET /metrics,
+// ready to import, with panels of enabled checks only. Prometheus datasource is selected on import.
+func (s *Server) dashboardHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Disposition", "attachment; filename=tg-spam-dashboard.json")
+	rest.RenderJSON(w, s.grafanaDashboard())
+}
+
+// alertsHandler handles GET /metrics/alerts?openai_cost=5 request. It returns example prometheus alerting rules
+// of GET /metrics in yaml, with rules of enabled checks only. The daily cost of openai requests alerted
+// is set by openai_cost param, in USD.
+func (s *Server) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	openAICost := defaultAlertOpenAICost
+	if v := r.URL.Query().Get("openai_cost"); v != "" {
+		cost, err := strconv.ParseFloat(v, 64)
+		if err != nil || cost <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid openai_cost", "details": "expected positive number"})
+			return
+		}
+		openAICost = cost
+	}
+	data, err := yaml.Marshal(s.alertRules(openAICost))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't make alert rules", "details": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=tg-spam-alerts.yml")
+	_, _ = w.Write(data)
+}
+
+// enabledChecks returns names of checks reporting detections with the current settings
+func (s *Server) enabledChecks() []string {
+	settings := s.settings()
+	res := []string{"stopword"}
+	if settings.SimilarityThreshold > 0 {
+		res = append(res, "similarity")
+	}
+	res = append(res, "classifier")
+	if settings.MaxEmoji >= 0 {
+		res = append(res, "emoji")
+	}
+	if settings.CasEnabled {
+		res = append(res, "cas")
+	}
+	if settings.LolsEnabled {
+		res = append(res, "lols")
+	}
+	if settings.OpenAIEnabled {
+		res = append(res, "openai")
+	}
+	return res
+}
+
+// networkChecks returns true if checks with external services are enabled, they can be skipped on timeouts
+func (s *Server) networkChecks() bool {
+	settings := s.settings()
+	return settings.CasEnabled || settings.LolsEnabled || settings.OpenAIEnabled
+}
+
+// grafanaDashboard makes grafana dashboard with panels of stats, detections of enabled checks,
+// false positives, and degraded checks and openai usage if enabled
+func (s *Server) grafanaDashboard() rest.JSON {
+	datasource := rest.JSON{"type": "prometheus", "uid": "${DS_PROMETHEUS}"}
+	target := func(expr, legend string) rest.JSON {
+		return rest.JSON{"datasource": datasource, "expr": expr, "legendFormat": legend}
+	}
+	panels := []rest.JSON{}
+	addPanel := func(kind, title string, x, y, w, h int, targets ...rest.JSON) {
+		for i := range targets {
+			targets[i]["refId"] = string(rune('A' + i))
+		}
+		panels = append(panels, rest.JSON{"id": len(panels) + 1, "type": kind, "title": title, "datasource": datasource,
+			"gridPos": rest.JSON{"x": x, "y": y, "w": w, "h": h}, "targets": targets})
+	}
+
+	addPanel("stat", "Healthy", 0, 0, 4, 4, target("tgspam_healthy", "healthy"))
+	addPanel("stat", "Checked, 24h", 4, 0, 4, 4, target(`tgspam_checked_messages{window="24h"}`, "checked"))
+	addPanel("stat", "Spam, 24h", 8, 0, 4, 4, target(`tgspam_spam_messages{window="24h"}`, "spam"))
+	addPanel("stat", "Bans, 24h", 12, 0, 4, 4, target(`tgspam_bans{window="24h"}`, "bans"))
+	addPanel("stat", "Reversals, 24h", 16, 0, 4, 4, target(`tgspam_reversals{window="24h"}`, "reversals"))
+	addPanel("stat", "Approved users", 20, 0, 4, 4, target("tgspam_approved_users", "approved"))
+
+	addPanel("timeseries", "Messages per hour", 0, 4, 12, 8,
+		target(`tgspam_checked_messages{window="1h"}`, "checked"), target(`tgspam_spam_messages{window="1h"}`, "spam"))
+	checks := []rest.JSON{}
+	for _, name := range s.enabledChecks() {
+		checks = append(checks, target(fmt.Sprintf(`tgspam_detections_by_check{window="1h",check=%q}`, name), name))
+	}
+	addPanel("timeseries", "Detections by check per hour", 12, 4, 12, 8, checks...)
+
+	addPanel("timeseries", "Reversed bans, share of the last day", 0, 12, 12, 8,
+		target(`tgspam_reversals{window="24h"} / clamp_min(tgspam_bans{window="24h"}, 1)`, "reversed"))
+	if s.networkChecks() {
+		addPanel("timeseries", "Degraded checks, share per hour", 12, 12, 12, 8,
+			target(`tgspam_degraded_messages{window="1h"} / clamp_min(tgspam_checked_messages{window="1h"}, 1)`, "degraded"))
+	}
+	if s.settings().OpenAIEnabled {
+		addPanel("timeseries", "OpenAI usage of the last day", 0, 20, 24, 8,
+			target(`tgspam_openai_cost_usd{window="24h"}`, "cost, USD"), target(`tgspam_openai_requests{window="24h"}`, "requests"))
+	}
+
+	return rest.JSON{
+		"__inputs": []rest.JSON{{"name": "DS_PROMETHEUS", "label": "Prometheus", "type": "datasource",
+			"pluginId": "prometheus", "pluginName": "Prometheus"}},
+		"title":         "tg-spam",
+		"uid":           "tg-spam",
+		"tags":          []string{"tg-spam"},
+		"editable":      true,
+		"schemaVersion": 39,
+		"refresh":       "1m",
+		"time":          rest.JSON{"from": "now-7d", "to": "now"},
+		"panels":        panels,
+	}
+}
+
+// alertRules makes example alerting rules: unhealthy bot, modes left on, false positives, spam waves,
+// and degraded checks and openai cost if enabled
+func (s *Server) alertRules(openAICost float64) alertRules {
+	rule := func(name, expr, forDuration, severity, summary string) alertRule {
+		return alertRule{Alert: name, Expr: expr, For: forDuration, Labels: map[string]string{"severity": severity},
+			Annotations: map[string]string{"summary": summary}}
+	}
+	rules := []alertRule{
+		rule("TgSpamUnhealthy", "tgspam_healthy == 0", "5m", "critical",
+			"tg-spam is unhealthy, messages of the group are not checked"),
+		rule("TgSpamNoMessages", `tgspam_checked_messages{window="1h"} == 0`, "2h", "warning",
+			"no messages checked for hours, the bot may be removed from the group or lost its rights"),
+		rule("TgSpamNotBanning", "tgspam_dry_mode == 1 or tgspam_training_mode == 1", "24h", "warning",
+			"tg-spam runs in dry or training mode for a day, spammers are not banned"),
+		rule("TgSpamFalsePositives", `tgspam_reversals{window="24h"} / clamp_min(tgspam_bans{window="24h"}, 1) > 0.1`+
+			` and tgspam_reversals{window="24h"} >= 3`, "30m", "warning",
+			"more than 10% of bans of the last day are reversed by admins, samples or thresholds need review"),
+		rule("TgSpamSpamWave", `tgspam_spam_messages{window="1h"} > 5 * tgspam_spam_messages{window="24h"} / 24`+
+			` and tgspam_spam_messages{window="1h"} >= 10`, "", "info",
+			"spam of the last hour is 5 times above the daily average, the group may be raided"),
+	}
+	if s.networkChecks() {
+		rules = append(rules, rule("TgSpamDegradedChecks",
+			`tgspam_degraded_messages{window="1h"} / clamp_min(tgspam_checked_messages{window="1h"}, 1) > 0.05`, "30m", "warning",
+			"more than 5% of messages checked with skipped or interrupted checks, external services are slow or down"))
+	}
+	if s.settings().OpenAIEnabled {
+		rules = append(rules, rule("TgSpamOpenAICost", fmt.Sprintf(`tgspam_openai_cost_usd{window="24h"} > %g`, openAICost),
+			"", "warning", fmt.Sprintf("openai cost of the last day is above %g USD", openAICost)))
+	}
+	return alertRules{Groups: []alertGroup{{Name: "tg-spam", Rules: rules}}}
+}
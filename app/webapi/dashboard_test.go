@@ -0,0 +1,108 @@
+package webapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_dashboardHandler(t *testing.T) {
+	tbl := []struct {
+		name     string
+		settings Settings
+		checks   []string
+		panels   int
+	}{
+		{"local checks", Settings{SimilarityThreshold: 0.5, MaxEmoji: -1}, []string{"stopword", "similarity", "classifier"}, 9},
+		{"network checks", Settings{MaxEmoji: 2, CasEnabled: true, OpenAIEnabled: true},
+			[]string{"stopword", "classifier", "emoji", "cas", "openai"}, 11},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Stats: &mocks.StatsReporterMock{}, Settings: tt.settings})
+			ts := httptest.NewServer(server.routes(chi.NewRouter()))
+			defer ts.Close()
+
+			resp, err := http.Get(ts.URL + "/metrics/dashboard")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var dashboard struct {
+				Inputs []struct {
+					Name string `json:"name"`
+				} `json:"__inputs"`
+				Title  string `json:"title"`
+				Panels []struct {
+					ID      int    `json:"id"`
+					Title   string `json:"title"`
+					Targets []struct {
+						Expr   string `json:"expr"`
+						Legend string `json:"legendFormat"`
+						RefID  string `json:"refId"`
+					} `json:"targets"`
+				} `json:"panels"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&dashboard))
+			assert.Equal(t, "tg-spam", dashboard.Title)
+			require.Len(t, dashboard.Inputs, 1)
+			assert.Equal(t, "DS_PROMETHEUS", dashboard.Inputs[0].Name)
+			require.Len(t, dashboard.Panels, tt.panels)
+			checks := []string{}
+			for _, p := range dashboard.Panels {
+				if p.Title == "Detections by check per hour" {
+					for i, tg := range p.Targets {
+						checks = append(checks, tg.Legend)
+						assert.Equal(t, string(rune('A'+i)), tg.RefID)
+					}
+				}
+			}
+			assert.Equal(t, tt.checks, checks)
+			assert.Equal(t, tt.panels, dashboard.Panels[len(dashboard.Panels)-1].ID, "ids sequential")
+		})
+	}
+}
+
+func TestServer_alertsHandler(t *testing.T) {
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Stats: &mocks.StatsReporterMock{},
+		Settings: Settings{OpenAIEnabled: true}})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/metrics/alerts?openai_cost=2.5")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/yaml; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	var rules alertRules
+	require.NoError(t, yaml.Unmarshal(body, &rules))
+	require.Len(t, rules.Groups, 1)
+	names := []string{}
+	for _, r := range rules.Groups[0].Rules {
+		names = append(names, r.Alert)
+		assert.NotEmpty(t, r.Labels["severity"])
+		assert.NotEmpty(t, r.Annotations["summary"])
+	}
+	assert.Equal(t, []string{"TgSpamUnhealthy", "TgSpamNoMessages", "TgSpamNotBanning", "TgSpamFalsePositives",
+		"TgSpamSpamWave", "TgSpamDegradedChecks", "TgSpamOpenAICost"}, names)
+	assert.Equal(t, `tgspam_openai_cost_usd{window="24h"} > 2.5`, rules.Groups[0].Rules[6].Expr)
+
+	resp, err = http.Get(ts.URL + "/metrics/alerts?openai_cost=bad")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// local checks only
+	rules = NewServer(Config{Settings: Settings{}}).alertRules(defaultAlertOpenAICost)
+	assert.Len(t, rules.Groups[0].Rules, 5)
+}
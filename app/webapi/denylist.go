@@ -0,0 +1,39 @@
+package webapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-pkgz/rest"
+)
+
+// maxDenylistEntries is the max number of entries returned by GET /denylist
+const maxDenylistEntries = 1000
+
+// denylistHandler handles GET /denylist request, the feed of local denylist entries for peer instances.
+// Entries changed since the time set by "since" param are returned, oldest first, up to the limit.
+// Peers request the next page with since set to the timestamp of the last entry, so the boundary entry is repeated.
+func (s *Server) denylistHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := sinceParam(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid since", "details": err.Error()})
+		return
+	}
+	limit := maxDenylistEntries
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxDenylistEntries {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid limit", "details": "expected 1-" + strconv.Itoa(maxDenylistEntries)})
+			return
+		}
+	}
+	entries, err := s.Denylist.Local(since, limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read denylist", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"entries": entries, "count": len(entries)})
+}
@@ -0,0 +1,69 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_denylistHandler(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	dl := &mocks.DenylistStoreMock{
+		LocalFunc: func(since time.Time, limit int) ([]storage.DenylistEntry, error) {
+			if limit == 13 {
+				return nil, errors.New("db error")
+			}
+			return []storage.DenylistEntry{
+				{Kind: storage.DenylistUser, Value: "123", UserID: 123, Timestamp: ts0},
+				{Kind: storage.DenylistHash, Value: "abc", UserID: 123, Timestamp: ts0, Removed: true},
+			}, nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Denylist: dl}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/denylist?since=2024-05-01T09:00:00.5Z&limit=10")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var res struct {
+		Entries []storage.DenylistEntry `json:"entries"`
+		Count   int                     `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 2, res.Count)
+	assert.Equal(t, storage.DenylistEntry{Kind: storage.DenylistUser, Value: "123", UserID: 123, Timestamp: ts0}, res.Entries[0])
+	assert.True(t, res.Entries[1].Removed)
+	require.Len(t, dl.LocalCalls(), 1)
+	assert.Equal(t, ts0.Add(-time.Hour+500*time.Millisecond), dl.LocalCalls()[0].Since)
+	assert.Equal(t, 10, dl.LocalCalls()[0].Limit)
+
+	tbl := []struct {
+		query  string
+		status int
+	}{
+		{query: "", status: http.StatusOK},
+		{query: "?since=yesterday", status: http.StatusBadRequest},
+		{query: "?limit=0", status: http.StatusBadRequest},
+		{query: "?limit=1001", status: http.StatusBadRequest},
+		{query: "?limit=13", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tbl {
+		resp, err := http.Get(ts.URL + "/denylist" + tt.query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tt.status, resp.StatusCode, tt.query)
+	}
+	assert.Equal(t, maxDenylistEntries, dl.LocalCalls()[1].Limit, "default limit")
+	assert.True(t, dl.LocalCalls()[1].Since.IsZero())
+}
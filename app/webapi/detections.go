@@ -0,0 +1,100 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/lib"
+)
+
+const (
+	defaultDetectionsLimit = 100  // number of detections returned by GET /detections if limit is not set
+	maxDetectionsLimit     = 1000 // max number of detections returned by GET /detections
+)
+
+// detection is a spam detection reported by GET /detections
+type detection struct {
+	ID        int64             `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	ChatID    int64             `json:"chat_id"`
+	UserID    int64             `json:"user_id"`
+	UserName  string            `json:"user_name"`
+	Text      string            `json:"text"`
+	Action    string            `json:"action"`
+	Checks    []lib.CheckResult `json:"checks"`
+	Reversed  *time.Time        `json:"reversed,omitempty"` // time of reversal by admin, i.e. false positive
+}
+
+// detectionsHandler handles GET /detections request. It returns detections matching the query params, newest first,
+// a page of limit detections at once. The next page is requested with the cursor param set to next_cursor
+// of the response, next_cursor is omitted on the last page.
+func (s *Server) detectionsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := detectionsQuery(r, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	entries, more, err := s.Detections.Find(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read detections", "details": err.Error()})
+		return
+	}
+	res := make([]detection, 0, len(entries))
+	for _, d := range entries {
+		item := detection{ID: d.ID, Timestamp: d.Timestamp, ChatID: d.ChatID, UserID: d.UserID, UserName: d.UserName,
+			Text: d.Text, Action: d.Action, Checks: d.Checks}
+		if d.Reversed.Valid {
+			item.Reversed = &d.Reversed.Time
+		}
+		res = append(res, item)
+	}
+	resp := rest.JSON{"detections": res, "count": len(res)}
+	if more && len(res) > 0 {
+		resp["next_cursor"] = strconv.FormatInt(res[len(res)-1].ID, 10)
+	}
+	rest.RenderJSON(w, resp)
+}
+
+// detectionsQuery returns the query of detections from request params, the latest 100 detections by default.
+// The from param is RFC3339 time or period, i.e. 24h or 7d, the to param is RFC3339 time.
+func detectionsQuery(r *http.Request, now time.Time) (res storage.DetectionsQuery, err error) {
+	params := r.URL.Query()
+	res = storage.DetectionsQuery{Check: params.Get("check"), Action: params.Get("action"), Search: params.Get("q"),
+		Limit: defaultDetectionsLimit}
+	if v := params.Get("limit"); v != "" {
+		if res.Limit, err = strconv.Atoi(v); err != nil || res.Limit <= 0 || res.Limit > maxDetectionsLimit {
+			return res, fmt.Errorf("invalid limit %q, expected 1-%d", v, maxDetectionsLimit)
+		}
+	}
+	if v := params.Get("user_id"); v != "" {
+		if res.UserID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return res, fmt.Errorf("invalid user_id %q", v)
+		}
+	}
+	if v := params.Get("cursor"); v != "" {
+		if res.Before, err = strconv.ParseInt(v, 10, 64); err != nil || res.Before <= 0 {
+			return res, fmt.Errorf("invalid cursor %q", v)
+		}
+	}
+	switch res.Verdict = params.Get("verdict"); res.Verdict {
+	case "", "spam", "ham":
+	default:
+		return res, fmt.Errorf("invalid verdict %q, expected spam or ham", res.Verdict)
+	}
+	if res.From, err = sinceParam(params.Get("from"), now); err != nil {
+		return res, fmt.Errorf("invalid from: %w", err)
+	}
+	if v := params.Get("to"); v != "" {
+		if res.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return res, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,99 @@
+package webapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_detectionsHandler(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ds := &mocks.DetectionsStoreMock{
+		FindFunc: func(q storage.DetectionsQuery) ([]storage.DetectedSpamInfo, bool, error) {
+			if q.Check == "broken" {
+				return nil, false, errors.New("db error")
+			}
+			return []storage.DetectedSpamInfo{
+				{ID: 12, Timestamp: ts0, ChatID: 100, UserID: 1, UserName: "spammer", Text: "buy crypto", Action: "ban",
+					Checks: []lib.CheckResult{{Name: "stopword", Spam: true}}},
+				{ID: 10, Timestamp: ts0.Add(-time.Hour), ChatID: 100, UserID: 2, Text: "crypto talk", Action: "ban",
+					Reversed: sql.NullTime{Time: ts0, Valid: true}},
+			}, q.Limit == 2, nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Detections: ds}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("page", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/detections?from=2024-04-01T00:00:00Z&to=2024-05-02T00:00:00Z&user_id=1" +
+			"&check=stopword&verdict=spam&action=ban&q=buy+crypto&cursor=15&limit=2")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res struct {
+			Detections []detection `json:"detections"`
+			Count      int         `json:"count"`
+			NextCursor string      `json:"next_cursor"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 2, res.Count)
+		assert.Equal(t, "10", res.NextCursor)
+		assert.Equal(t, "spammer", res.Detections[0].UserName)
+		assert.Nil(t, res.Detections[0].Reversed)
+		require.NotNil(t, res.Detections[1].Reversed)
+		assert.True(t, ts0.Equal(*res.Detections[1].Reversed))
+
+		require.Len(t, ds.FindCalls(), 1)
+		assert.Equal(t, storage.DetectionsQuery{From: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+			To: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), UserID: 1, Check: "stopword", Verdict: "spam", Action: "ban",
+			Search: "buy crypto", Before: 15, Limit: 2}, ds.FindCalls()[0].Q)
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		ds.ResetCalls()
+		resp, err := http.Get(ts.URL + "/detections?from=7d")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.NotContains(t, res, "next_cursor")
+		require.Len(t, ds.FindCalls(), 1)
+		assert.Equal(t, defaultDetectionsLimit, ds.FindCalls()[0].Q.Limit)
+		assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), ds.FindCalls()[0].Q.From, time.Minute)
+	})
+
+	tbl := []struct {
+		query  string
+		status int
+	}{
+		{query: "?limit=0", status: http.StatusBadRequest},
+		{query: "?limit=1001", status: http.StatusBadRequest},
+		{query: "?user_id=abc", status: http.StatusBadRequest},
+		{query: "?cursor=abc", status: http.StatusBadRequest},
+		{query: "?verdict=maybe", status: http.StatusBadRequest},
+		{query: "?from=yesterday", status: http.StatusBadRequest},
+		{query: "?to=24h", status: http.StatusBadRequest},
+		{query: "?check=broken", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/detections" + tt.query)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
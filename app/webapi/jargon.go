@@ -0,0 +1,112 @@
+package webapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// JargonParams are thresholds of tokens of ham messages suggested as excluded tokens
+type JargonParams struct {
+	MinShare    float64 // min share of messages with the token, 0.05 if not set
+	MinMessages int     // min number of counted messages to make suggestions
+}
+
+const (
+	defaultJargonMinShare = 0.05 // default min share of messages with the suggested token
+	maxJargonSuggestions  = 100  // max number of suggested tokens
+)
+
+// jargonHandler handles GET /jargon request. It returns tokens used in many ham messages, not reviewed yet
+// and not excluded already, the most frequent first, with the number of counted messages.
+func (s *Server) jargonHandler(w http.ResponseWriter, _ *http.Request) {
+	total, tokens, err := s.jargonSuggestions()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't get jargon suggestions", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"messages": total, "tokens": tokens, "count": len(tokens),
+		"min_share": s.jargonMinShare(), "min_messages": s.JargonParams.MinMessages})
+}
+
+// applyJargonHandler handles POST /jargon/{token}/apply request. It adds the token to excluded tokens and reloads samples.
+func (s *Server) applyJargonHandler(w http.ResponseWriter, r *http.Request) {
+	token := jargonToken(r)
+	if err := s.applyJargon(token); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't apply jargon token", "details": err.Error()})
+		return
+	}
+	if !s.reload(w) {
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"updated": true, "token": token})
+}
+
+// dismissJargonHandler handles POST /jargon/{token}/dismiss request. The token is not suggested anymore.
+func (s *Server) dismissJargonHandler(w http.ResponseWriter, r *http.Request) {
+	token := jargonToken(r)
+	if err := s.Jargon.SetStatus(token, storage.JargonStatusDismissed); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't dismiss jargon token", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"updated": true, "token": token})
+}
+
+// jargonSuggestions returns suggested tokens, without tokens excluded already, i.e. added by the excluded tokens file
+func (s *Server) jargonSuggestions() (total int, res []storage.JargonToken, err error) {
+	total, tokens, err := s.Jargon.Suggestions(s.jargonMinShare(), s.JargonParams.MinMessages, maxJargonSuggestions)
+	if err != nil {
+		return 0, nil, fmt.Errorf("can't read suggestions, %w", err)
+	}
+	excluded, err := s.Dictionary.Read(storage.DictionaryTypeIgnoredWord)
+	if err != nil {
+		return 0, nil, fmt.Errorf("can't read excluded tokens, %w", err)
+	}
+	known := make(map[string]bool, len(excluded))
+	for _, e := range excluded {
+		known[strings.ToLower(e.Data)] = true
+	}
+	res = make([]storage.JargonToken, 0, len(tokens))
+	for _, t := range tokens {
+		if !known[t.Token] {
+			res = append(res, t)
+		}
+	}
+	return total, res, nil
+}
+
+// applyJargon adds the token to excluded tokens and marks it applied, samples should be reloaded by caller
+func (s *Server) applyJargon(token string) error {
+	if err := s.Dictionary.Add(storage.DictionaryTypeIgnoredWord, token); err != nil {
+		return fmt.Errorf("can't add excluded token, %w", err)
+	}
+	if err := s.Jargon.SetStatus(token, storage.JargonStatusApplied); err != nil {
+		return fmt.Errorf("excluded token added, but can't set status, %w", err)
+	}
+	return nil
+}
+
+func (s *Server) jargonMinShare() float64 {
+	if s.JargonParams.MinShare <= 0 {
+		return defaultJargonMinShare
+	}
+	return s.JargonParams.MinShare
+}
+
+// jargonToken returns the token from the url, chi keeps non-ascii url params escaped
+func jargonToken(r *http.Request) string {
+	token := chi.URLParam(r, "token")
+	if v, err := url.PathUnescape(token); err == nil {
+		return v
+	}
+	return token
+}
@@ -0,0 +1,115 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_jargon(t *testing.T) {
+	jargon := &mocks.JargonStoreMock{
+		SuggestionsFunc: func(minShare float64, minMessages, limit int) (int, []storage.JargonToken, error) {
+			return 1000, []storage.JargonToken{{Token: "tgspam", Messages: 300, Share: 0.3},
+				{Token: "бот", Messages: 120, Share: 0.12}, {Token: "golang", Messages: 100, Share: 0.1}}, nil
+		},
+		SetStatusFunc: func(token string, status storage.JargonStatus) error {
+			if token == "unknown" {
+				return errors.New("not found")
+			}
+			return nil
+		},
+	}
+	dict := &mocks.DictionaryStoreMock{
+		ReadFunc: func(t storage.DictionaryType) ([]storage.DictionaryEntry, error) {
+			return []storage.DictionaryEntry{{ID: 1, Type: t, Data: "GoLang"}}, nil
+		},
+		AddFunc: func(t storage.DictionaryType, data string) error { return nil },
+	}
+	var reloads int
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Jargon: jargon, Dictionary: dict,
+		JargonParams: JargonParams{MinMessages: 500}, ReloadSamples: func() error { reloads++; return nil }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("suggestions", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/jargon")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res struct {
+			Messages int                   `json:"messages"`
+			Tokens   []storage.JargonToken `json:"tokens"`
+			Count    int                   `json:"count"`
+			MinShare float64               `json:"min_share"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 1000, res.Messages)
+		assert.Equal(t, 2, res.Count, "excluded token skipped")
+		assert.Equal(t, "tgspam", res.Tokens[0].Token)
+		assert.InDelta(t, 0.05, res.MinShare, 0.0001, "default share")
+		require.Len(t, jargon.SuggestionsCalls(), 1)
+		assert.Equal(t, 500, jargon.SuggestionsCalls()[0].MinMessages)
+	})
+
+	t.Run("apply and dismiss", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/jargon/tgspam/apply", "application/json", http.NoBody)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, dict.AddCalls(), 1)
+		assert.Equal(t, storage.DictionaryTypeIgnoredWord, dict.AddCalls()[0].T)
+		assert.Equal(t, "tgspam", dict.AddCalls()[0].Data)
+		assert.Equal(t, 1, reloads)
+
+		resp, err = http.Post(ts.URL+"/jargon/"+url.PathEscape("бот")+"/dismiss", "application/json", http.NoBody)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, jargon.SetStatusCalls(), 2)
+		assert.Equal(t, storage.JargonStatusApplied, jargon.SetStatusCalls()[0].Status)
+		assert.Equal(t, "бот", jargon.SetStatusCalls()[1].Token, "unescaped")
+		assert.Equal(t, storage.JargonStatusDismissed, jargon.SetStatusCalls()[1].Status)
+
+		resp, err = http.Post(ts.URL+"/jargon/unknown/dismiss", "application/json", http.NoBody)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("ui", func(t *testing.T) {
+		body := uiGet(t, ts.URL+"/ui/jargon")
+		assert.Contains(t, body, "1000 messages counted")
+		assert.Contains(t, body, "<td>tgspam</td>")
+		assert.Contains(t, body, "<td>30.0%</td>")
+		assert.NotContains(t, body, "golang")
+		assert.Contains(t, body, `action="/ui/jargon/%d0%b1%d0%be%d1%82/apply"`)
+
+		resp := uiPost(t, ts.URL+"/ui/jargon/tgspam/apply", url.Values{}, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui/jargon?msg=%22tgspam%22+added+to+excluded+tokens", resp.Header.Get("Location"))
+		assert.Equal(t, 2, reloads)
+
+		resp = uiPost(t, ts.URL+"/ui/jargon/unknown/dismiss", url.Values{}, nil)
+		assert.Contains(t, resp.Header.Get("Location"), "err=can%27t+dismiss+token%2C+not+found")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Jargon: jargon}).routes(chi.NewRouter()))
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + "/jargon")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "no dictionary")
+		assert.Contains(t, uiGet(t, srv.URL+"/ui/jargon"), "jargon suggestions are disabled")
+	})
+}
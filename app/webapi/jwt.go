@@ -0,0 +1,258 @@
+package webapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// JWT validates json web tokens issued by an external identity provider.
+// Tokens signed with HS256 are verified with the shared secret, tokens signed with RS256 with the issuer's keys
+// fetched from JWKS url. The scope of the token is taken from the space-separated "scope" claim,
+// "tg-spam:check" allows spam checks only and "tg-spam:manage" allows all endpoints.
+type JWT struct {
+	Secret     string       // shared secret for HS256 tokens, empty disables them
+	JWKSURL    string       // url of the issuer's json web key set for RS256 tokens, empty disables them
+	Issuer     string       // expected "iss" claim, not checked if empty
+	Audience   string       // expected "aud" claim, not checked if empty
+	HTTPClient *http.Client // client to fetch keys, default client with timeout is used if nil
+
+	lock    sync.Mutex
+	keys    map[string]*rsa.PublicKey // keys by kid, from the last fetch
+	fetched time.Time                 // time of the last fetch, keys are not re-fetched more often than jwksRefreshInterval
+}
+
+const (
+	jwtLeeway           = 30 * time.Second // allowed clock skew for exp and nbf claims
+	jwksRefreshInterval = time.Minute      // min interval between fetches of keys, to re-fetch on unknown kid
+	jwtScopePrefix      = "tg-spam:"       // prefix of tg-spam scopes in the "scope" claim
+)
+
+// JWTClaims is a set of token claims used by the server
+type JWTClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt int64       `json:"exp"`
+	NotBefore int64       `json:"nbf"`
+	Scope     string      `json:"scope"`
+}
+
+// jwtAudience is "aud" claim, it can be a string or an array of strings
+type jwtAudience []string
+
+// UnmarshalJSON implements json.Unmarshaler, accepting both a string and an array of strings
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return fmt.Errorf("invalid aud claim: %w", err)
+	}
+	*a = multi
+	return nil
+}
+
+// Validate verifies the token signature and claims, and returns the claims of a valid token
+func (j *JWT) Validate(ctx context.Context, token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return JWTClaims{}, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return JWTClaims{}, fmt.Errorf("invalid header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return JWTClaims{}, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if err = j.verify(ctx, header.Alg, header.Kid, parts[0]+"."+parts[1], sig); err != nil {
+		return JWTClaims{}, err
+	}
+
+	var claims JWTClaims
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return JWTClaims{}, fmt.Errorf("invalid claims: %w", err)
+	}
+	now := time.Now()
+	if claims.ExpiresAt == 0 {
+		return JWTClaims{}, errors.New("no exp claim")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return JWTClaims{}, errors.New("token expired")
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return JWTClaims{}, errors.New("token not valid yet")
+	}
+	if j.Issuer != "" && claims.Issuer != j.Issuer {
+		return JWTClaims{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if j.Audience != "" && !slices.Contains(claims.Audience, j.Audience) {
+		return JWTClaims{}, fmt.Errorf("unexpected audience %v", claims.Audience)
+	}
+	return claims, nil
+}
+
+// APIScope returns the widest tg-spam scope of the token, or an error if the token has no tg-spam scopes
+func (c JWTClaims) APIScope() (storage.APIKeyScope, error) {
+	var res storage.APIKeyScope
+	for _, s := range strings.Fields(c.Scope) {
+		switch s {
+		case jwtScopePrefix + string(storage.APIKeyScopeManage):
+			return storage.APIKeyScopeManage, nil
+		case jwtScopePrefix + string(storage.APIKeyScopeCheck):
+			res = storage.APIKeyScopeCheck
+		case jwtScopePrefix + string(storage.APIKeyScopeDenylist):
+			if res == "" {
+				res = storage.APIKeyScopeDenylist
+			}
+		}
+	}
+	if res == "" {
+		return "", fmt.Errorf("no %s scope in token", strings.TrimSuffix(jwtScopePrefix, ":"))
+	}
+	return res, nil
+}
+
+// verify checks the signature of the signed part with the key for the algorithm
+func (j *JWT) verify(ctx context.Context, alg, kid, signed string, sig []byte) error {
+	switch alg {
+	case "HS256":
+		if j.Secret == "" {
+			return errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, []byte(j.Secret))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case "RS256":
+		if j.JWKSURL == "" {
+			return errors.New("RS256 tokens are not accepted")
+		}
+		key, err := j.publicKey(ctx, kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported signing algorithm %q", alg)
+}
+
+// publicKey returns the issuer's key by kid. Keys are re-fetched on unknown kid, i.e. after keys rotation.
+// Empty kid is accepted if the issuer has a single key.
+func (j *JWT) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	find := func() *rsa.PublicKey {
+		if kid == "" && len(j.keys) == 1 {
+			for _, k := range j.keys {
+				return k
+			}
+		}
+		return j.keys[kid]
+	}
+
+	if key := find(); key != nil {
+		return key, nil
+	}
+	if time.Since(j.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	keys, err := j.fetchKeys(ctx)
+	j.fetched = time.Now() // failed fetch is not retried till the next interval as well
+	if err != nil {
+		return nil, err
+	}
+	j.keys = keys
+	if key := find(); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// fetchKeys fetches RSA signing keys from JWKS url
+func (j *JWT) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	client := j.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.JWKSURL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make jwks request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks, status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	res := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue // not a signing rsa key
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %q: %w", k.Kid, err)
+		}
+		res[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return res, nil
+}
+
+// decodeJWTPart decodes base64url encoded json part of the token
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("invalid encoding: %w", err)
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,166 @@
+package webapi
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+func TestJWT_ValidateHS256(t *testing.T) {
+	j := &JWT{Secret: "secret", Issuer: "https://idp.example.com", Audience: "tg-spam"}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tbl := []struct {
+		name   string
+		token  string
+		errMsg string
+	}{
+		{name: "valid", token: makeHS256Token(t, "secret", map[string]any{"sub": "ci", "exp": exp,
+			"iss": "https://idp.example.com", "aud": "tg-spam", "scope": "tg-spam:check"})},
+		{name: "valid, aud list", token: makeHS256Token(t, "secret", map[string]any{"sub": "ci", "exp": exp,
+			"iss": "https://idp.example.com", "aud": []string{"other", "tg-spam"}})},
+		{name: "wrong secret", token: makeHS256Token(t, "bad", map[string]any{"exp": exp}), errMsg: "invalid signature"},
+		{name: "expired", token: makeHS256Token(t, "secret", map[string]any{"exp": time.Now().Add(-time.Minute).Unix()}),
+			errMsg: "token expired"},
+		{name: "no exp", token: makeHS256Token(t, "secret", map[string]any{"sub": "ci"}), errMsg: "no exp claim"},
+		{name: "not valid yet", token: makeHS256Token(t, "secret", map[string]any{"exp": exp,
+			"nbf": time.Now().Add(time.Minute).Unix()}), errMsg: "token not valid yet"},
+		{name: "wrong issuer", token: makeHS256Token(t, "secret", map[string]any{"exp": exp, "iss": "other", "aud": "tg-spam"}),
+			errMsg: `unexpected issuer "other"`},
+		{name: "wrong audience", token: makeHS256Token(t, "secret", map[string]any{"exp": exp,
+			"iss": "https://idp.example.com", "aud": "other"}), errMsg: "unexpected audience [other]"},
+		{name: "alg none", token: makeJWT(t, map[string]any{"alg": "none"}, map[string]any{"exp": exp}, nil),
+			errMsg: `unsupported signing algorithm "none"`},
+		{name: "rs256 not enabled", token: makeJWT(t, map[string]any{"alg": "RS256"}, map[string]any{"exp": exp}, []byte("sig")),
+			errMsg: "RS256 tokens are not accepted"},
+		{name: "malformed", token: "abc.def", errMsg: "malformed token"},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := j.Validate(context.Background(), tt.token)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "ci", claims.Subject)
+		})
+	}
+}
+
+func TestJWT_ValidateRS256(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches int32
+	keys := []*rsa.PrivateKey{key1}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		jwks := []map[string]string{{"kty": "EC", "kid": "ec"}} // not rsa, ignored
+		for i, k := range keys {
+			jwks = append(jwks, map[string]string{"kty": "RSA", "use": "sig", "kid": []string{"k1", "k2"}[i],
+				"n": base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"keys": jwks}))
+	}))
+	defer ts.Close()
+
+	j := &JWT{JWKSURL: ts.URL}
+	claims := map[string]any{"sub": "admin", "exp": time.Now().Add(time.Hour).Unix(), "scope": "openid tg-spam:manage"}
+
+	res, err := j.Validate(context.Background(), makeRS256Token(t, key1, "k1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, "admin", res.Subject)
+	_, err = j.Validate(context.Background(), makeRS256Token(t, key1, "k1", claims))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "keys cached")
+
+	_, err = j.Validate(context.Background(), makeRS256Token(t, key1, "", claims))
+	require.NoError(t, err, "empty kid with single key")
+
+	_, err = j.Validate(context.Background(), makeRS256Token(t, key2, "k1", claims))
+	assert.EqualError(t, err, "invalid signature")
+
+	// rotated key is not fetched till refresh interval passed
+	keys = []*rsa.PrivateKey{key1, key2}
+	_, err = j.Validate(context.Background(), makeRS256Token(t, key2, "k2", claims))
+	assert.EqualError(t, err, `unknown key "k2"`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	j.fetched = time.Now().Add(-jwksRefreshInterval)
+	_, err = j.Validate(context.Background(), makeRS256Token(t, key2, "k2", claims))
+	require.NoError(t, err, "keys re-fetched on unknown kid")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
+
+func TestJWTClaims_APIScope(t *testing.T) {
+	tbl := []struct {
+		scope string
+		exp   storage.APIKeyScope
+		err   bool
+	}{
+		{scope: "tg-spam:check", exp: storage.APIKeyScopeCheck},
+		{scope: "openid tg-spam:check tg-spam:manage", exp: storage.APIKeyScopeManage},
+		{scope: "tg-spam:manage tg-spam:check", exp: storage.APIKeyScopeManage},
+		{scope: "tg-spam:denylist", exp: storage.APIKeyScopeDenylist},
+		{scope: "tg-spam:denylist tg-spam:check", exp: storage.APIKeyScopeCheck},
+		{scope: "openid manage check", err: true},
+		{scope: "", err: true},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.scope, func(t *testing.T) {
+			scope, err := JWTClaims{Scope: tt.scope}.APIScope()
+			if tt.err {
+				assert.EqualError(t, err, "no tg-spam scope in token")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, scope)
+		})
+	}
+}
+
+func makeHS256Token(t *testing.T, secret string, claims map[string]any) string {
+	unsigned := makeJWT(t, map[string]any{"alg": "HS256", "typ": "JWT"}, claims, nil)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned[:len(unsigned)-1])) // without trailing dot of empty signature
+	return unsigned + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func makeRS256Token(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	unsigned := makeJWT(t, map[string]any{"alg": "RS256", "typ": "JWT", "kid": kid}, claims, nil)
+	digest := sha256.Sum256([]byte(unsigned[:len(unsigned)-1]))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return unsigned + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func makeJWT(t *testing.T, header, claims map[string]any, sig []byte) string {
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c) + "." +
+		base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -0,0 +1,209 @@
+package webapi
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/didip/tollbooth/v7"
+	"github.com/didip/tollbooth/v7/errors"
+	"github.com/didip/tollbooth/v7/limiter"
+	"github.com/go-pkgz/rest"
+)
+
+// Limits are rate and size limits of requests, protecting the api exposed publicly
+type Limits struct {
+	RatePerIP     float64       // max requests per second from ip, 50 if not set
+	RatePerKey    float64       // max requests per second with api key or jwt, across all ips, unlimited if 0
+	Burst         int           // max burst of requests over the rates, the rate (at least 1) if not set
+	MaxBodySize   int64         // max size of request body, 1M if not set
+	AuthFailures  int           // failed auth attempts from ip to lock it out, lockout disabled if 0
+	LockoutPeriod time.Duration // lockout of ip after failed auth attempts, also the period failures are counted in, 15m if not set
+}
+
+const (
+	defaultRatePerIP     = 50
+	defaultMaxBodySize   = 1024 * 1024
+	defaultLockoutPeriod = 15 * time.Minute
+	maxLockoutIPs        = 10000 // number of ips with failed attempts triggering cleanup of expired ones
+)
+
+// ipLimiter makes the limiter of requests per ip
+func (l Limits) ipLimiter() *limiter.Limiter {
+	rate := l.RatePerIP
+	if rate <= 0 {
+		rate = defaultRatePerIP
+	}
+	return l.withBurst(tollbooth.NewLimiter(rate, nil))
+}
+
+// keyLimiter makes the limiter of requests per api key or jwt subject, nil if unlimited
+func (l Limits) keyLimiter() *limiter.Limiter {
+	if l.RatePerKey <= 0 {
+		return nil
+	}
+	return l.withBurst(tollbooth.NewLimiter(l.RatePerKey, nil))
+}
+
+func (l Limits) withBurst(lmt *limiter.Limiter) *limiter.Limiter {
+	if l.Burst > 0 {
+		lmt.SetBurst(l.Burst)
+	}
+	return lmt.SetMessage(`{"error": "rate limit exceeded"}`).SetMessageContentType("application/json")
+}
+
+// maxBodySize returns the max size of request body
+func (l Limits) maxBodySize() int64 {
+	if l.MaxBodySize <= 0 {
+		return defaultMaxBodySize
+	}
+	return l.MaxBodySize
+}
+
+// limitByIP limits requests per client ip, see clientIP
+func (s *Server) limitByIP(next http.Handler) http.Handler {
+	lmt := s.Limits.ipLimiter()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.clientIP(r)
+		if httpErr := tollbooth.LimitByKeys(lmt, []string{ip}); httpErr != nil {
+			log.Printf("[DEBUG] rate limit of %s exceeded for %s %s", ip, r.Method, r.URL.Path)
+			rejectLimited(w, lmt, httpErr)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitByKey limits requests made with api keys and jwt, per key or token subject. Requests with basic auth
+// or without auth are limited per ip only.
+func (s *Server) limitByKey(next http.Handler) http.Handler {
+	if s.keyLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := actorFrom(r.Context())
+		if strings.HasPrefix(actor, "key:") || strings.HasPrefix(actor, "jwt:") {
+			if httpErr := tollbooth.LimitByKeys(s.keyLimiter, []string{actor}); httpErr != nil {
+				log.Printf("[DEBUG] rate limit of %s exceeded for %s %s", actor, r.Method, r.URL.Path)
+				rejectLimited(w, s.keyLimiter, httpErr)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectLimited responds with the error of the limiter
+func rejectLimited(w http.ResponseWriter, lmt *limiter.Limiter, httpErr *errors.HTTPError) {
+	w.Header().Set("Content-Type", lmt.GetMessageContentType())
+	w.WriteHeader(httpErr.StatusCode)
+	_, _ = w.Write([]byte(httpErr.Message))
+}
+
+// authLockout locks out ips after repeated auth failures, to prevent brute force of passwords and keys
+type authLockout struct {
+	maxFailures int
+	period      time.Duration
+
+	lock sync.Mutex
+	ips  map[string]*authFailures
+}
+
+// authFailures are failed auth attempts from ip
+type authFailures struct {
+	count       int
+	first       time.Time // time of the first failure counted, failures are counted in lockout period from it
+	lockedUntil time.Time
+}
+
+// newAuthLockout makes lockout with the limits, nil if lockout disabled
+func newAuthLockout(l Limits) *authLockout {
+	if l.AuthFailures <= 0 {
+		return nil
+	}
+	period := l.LockoutPeriod
+	if period <= 0 {
+		period = defaultLockoutPeriod
+	}
+	return &authLockout{maxFailures: l.AuthFailures, period: period, ips: map[string]*authFailures{}}
+}
+
+// locked returns the time till the ip is locked out, zero if not locked
+func (a *authLockout) locked(ip string) time.Duration {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	f, ok := a.ips[ip]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(f.lockedUntil), 0)
+}
+
+// failed counts failed auth attempt from ip, and locks it out if too many attempts made in lockout period
+func (a *authLockout) failed(ip string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	if len(a.ips) >= maxLockoutIPs {
+		a.cleanup(now)
+	}
+	f, ok := a.ips[ip]
+	if !ok || now.Sub(f.first) > a.period {
+		f = &authFailures{first: now}
+		a.ips[ip] = f
+	}
+	f.count++
+	if f.count >= a.maxFailures {
+		f.lockedUntil = now.Add(a.period)
+		log.Printf("[WARN] %s locked out for %v after %d failed auth attempts", ip, a.period, f.count)
+	}
+}
+
+// succeeded resets failed auth attempts of ip
+func (a *authLockout) succeeded(ip string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.ips, ip)
+}
+
+// cleanup removes ips with failures out of lockout period and not locked out
+func (a *authLockout) cleanup(now time.Time) {
+	for ip, f := range a.ips {
+		if now.Sub(f.first) > a.period && now.After(f.lockedUntil) {
+			delete(a.ips, ip)
+		}
+	}
+}
+
+// lockedOut responds with 429 and returns true if the ip of the request is locked out after auth failures
+func (s *Server) lockedOut(w http.ResponseWriter, r *http.Request) bool {
+	if s.lockout == nil {
+		return false
+	}
+	d := s.lockout.locked(s.clientIP(r))
+	if d == 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(d.Round(time.Second).Seconds())))
+	w.WriteHeader(http.StatusTooManyRequests)
+	rest.RenderJSON(w, rest.JSON{"error": "too many failed auth attempts", "details": fmt.Sprintf("retry in %v", d.Round(time.Second))})
+	return true
+}
+
+// authFailed counts failed auth attempt of the request, if lockout enabled
+func (s *Server) authFailed(r *http.Request) {
+	if s.lockout != nil {
+		s.lockout.failed(s.clientIP(r))
+	}
+}
+
+// authSucceeded resets failed auth attempts of the request's ip, if lockout enabled
+func (s *Server) authSucceeded(r *http.Request) {
+	if s.lockout != nil {
+		s.lockout.succeeded(s.clientIP(r))
+	}
+}
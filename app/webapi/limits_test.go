@@ -0,0 +1,190 @@
+package webapi
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-pkgz/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_authLockout(t *testing.T) {
+	keys := &mocks.APIKeysStoreMock{
+		FindFunc: func(key string) (storage.APIKey, error) {
+			if key == "tgs_good" {
+				return storage.APIKey{ID: 1, Name: "admin", Scope: storage.APIKeyScopeManage}, nil
+			}
+			return storage.APIKey{}, fmt.Errorf("not found: %w", sql.ErrNoRows)
+		},
+		UsedFunc: func(id int64, method, path string, status int) error { return nil },
+	}
+	server := NewServer(Config{AuthPasswd: "passwd", APIKeys: keys, Limits: Limits{AuthFailures: 3, LockoutPeriod: time.Minute}})
+	handler := server.auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(ip string, setAuth func(r *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users", http.NoBody)
+		req.RemoteAddr = ip + ":12345"
+		setAuth(req)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	badPasswd := func(r *http.Request) { r.SetBasicAuth("tg-spam", "bad") }
+	badKey := func(r *http.Request) { r.Header.Set("X-API-Key", "tgs_bad") }
+	goodPasswd := func(r *http.Request) { r.SetBasicAuth("tg-spam", "passwd") }
+	noAuth := func(r *http.Request) {}
+
+	assert.Equal(t, http.StatusForbidden, send("10.0.0.1", badPasswd).Code)
+	assert.Equal(t, http.StatusOK, send("10.0.0.1", goodPasswd).Code)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1", noAuth).Code, "missing credentials not counted")
+	}
+
+	// success resets failures, so the ip is locked out after 3 failures in a row only
+	assert.Equal(t, http.StatusForbidden, send("10.0.0.1", badPasswd).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("10.0.0.1", badKey).Code)
+	assert.Equal(t, http.StatusForbidden, send("10.0.0.1", badPasswd).Code)
+
+	rec := send("10.0.0.1", goodPasswd)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "locked out, even with valid credentials")
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), "too many failed auth attempts")
+	assert.Equal(t, http.StatusOK, send("10.0.0.2", goodPasswd).Code, "other ip not locked out")
+
+	t.Run("lockout expired", func(t *testing.T) {
+		server.lockout.lock.Lock()
+		server.lockout.ips["10.0.0.1"].lockedUntil = time.Now().Add(-time.Second)
+		server.lockout.lock.Unlock()
+		assert.Equal(t, http.StatusOK, send("10.0.0.1", goodPasswd).Code)
+	})
+
+	t.Run("lockout disabled", func(t *testing.T) {
+		server := NewServer(Config{AuthPasswd: "passwd"})
+		assert.Nil(t, server.lockout)
+		h := server.auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for i := 0; i < 20; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/users", http.NoBody)
+			req.SetBasicAuth("tg-spam", "bad")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+}
+
+func TestAuthLockout_cleanup(t *testing.T) {
+	lockout := newAuthLockout(Limits{AuthFailures: 2})
+	require.NotNil(t, lockout)
+	assert.Equal(t, defaultLockoutPeriod, lockout.period)
+
+	lockout.failed("10.0.0.1")
+	lockout.failed("10.0.0.2")
+	lockout.failed("10.0.0.2")
+	assert.Zero(t, lockout.locked("10.0.0.1"))
+	assert.InDelta(t, defaultLockoutPeriod.Seconds(), lockout.locked("10.0.0.2").Seconds(), 1)
+
+	lockout.cleanup(time.Now().Add(defaultLockoutPeriod + time.Second))
+	assert.Empty(t, lockout.ips, "expired failures and lockouts removed")
+}
+
+func TestServer_limitByKey(t *testing.T) {
+	server := NewServer(Config{Limits: Limits{RatePerKey: 1, Burst: 2}})
+	handler := server.limitByKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(actor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/check", http.NoBody)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, withActor(req, actor))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, send("key:ci").Code)
+	assert.Equal(t, http.StatusOK, send("key:ci").Code)
+	rec := send("key:ci")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "burst exceeded")
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error": "rate limit exceeded"}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusOK, send("key:other").Code, "limited per key")
+	assert.Equal(t, http.StatusOK, send("jwt:alice").Code)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, send("basic").Code, "basic auth not limited per key")
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		server := NewServer(Config{})
+		assert.Nil(t, server.keyLimiter)
+		h := server.limitByKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		for i := 0; i < 100; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/check", http.NoBody)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, withActor(req, "key:ci"))
+			require.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func TestServer_limitByIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	require.NoError(t, err)
+	server := NewServer(Config{TrustedProxies: proxies, Limits: Limits{RatePerIP: 1, Burst: 2}})
+	handler := server.limitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(remote, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/check", http.NoBody)
+		req.RemoteAddr = remote
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("1.2.3.4:1234", ""))
+	assert.Equal(t, http.StatusOK, send("1.2.3.4:1234", "5.5.5.5"))
+	assert.Equal(t, http.StatusTooManyRequests, send("1.2.3.4:1234", "6.6.6.6"), "spoofed header ignored")
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "7.7.7.7"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "7.7.7.7"))
+	assert.Equal(t, http.StatusTooManyRequests, send("10.0.0.1:1234", "7.7.7.7"), "limited per client behind proxy")
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1234", "8.8.8.8"), "other client behind proxy")
+}
+
+func TestLimits(t *testing.T) {
+	assert.Equal(t, float64(defaultRatePerIP), Limits{}.ipLimiter().GetMax())
+	assert.Equal(t, defaultRatePerIP, Limits{}.ipLimiter().GetBurst())
+	assert.Equal(t, 5.0, Limits{RatePerIP: 5, Burst: 20}.ipLimiter().GetMax())
+	assert.Equal(t, 20, Limits{RatePerIP: 5, Burst: 20}.ipLimiter().GetBurst())
+	assert.Nil(t, Limits{RatePerIP: 5}.keyLimiter())
+	assert.Equal(t, int64(defaultMaxBodySize), Limits{}.maxBodySize())
+	assert.Equal(t, int64(1024), Limits{MaxBodySize: 1024}.maxBodySize())
+
+	t.Run("body size", func(t *testing.T) {
+		router := chi.NewRouter()
+		router.Use(rest.SizeLimit(Limits{MaxBodySize: 16}.maxBodySize()))
+		router.Post("/check", func(w http.ResponseWriter, r *http.Request) {})
+		ts := httptest.NewServer(router)
+		defer ts.Close()
+
+		resp, err := http.Post(ts.URL+"/check", "application/json", strings.NewReader(`{"msg": "hi"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp, err = http.Post(ts.URL+"/check", "application/json", strings.NewReader(`{"msg": "too long message"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+}
@@ -0,0 +1,107 @@
+package webapi
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metricsWindows are time windows of stats reported by GET /metrics, as window label
+var metricsWindows = []struct {
+	label    string
+	duration time.Duration
+}{{"1h", time.Hour}, {"24h", 24 * time.Hour}}
+
+// metricsSeries are gauges of stats reported for each time window, in order of output
+var metricsSeries = []struct{ name, help string }{
+	{"tgspam_checked_messages", "number of checked messages in the time window"},
+	{"tgspam_spam_messages", "number of detected spam messages in the time window"},
+	{"tgspam_degraded_messages", "number of messages checked with skipped or interrupted checks in the time window"},
+	{"tgspam_bans", "number of detections with ban in the time window"},
+	{"tgspam_reversals", "number of detections reversed by admins in the time window"},
+	{"tgspam_detections_by_check", "number of detections by check reported spam in the time window"},
+	{"tgspam_openai_requests", "number of openai requests in the time window"},
+	{"tgspam_openai_cost_usd", "estimated cost of openai requests in the time window, in USD"},
+}
+
+// metricsHandler handles GET /metrics request. It reports stats of the last hour and the last day in prometheus
+// text format, as gauges with window label, and the state of the bot. Stats are written every minute, so the values
+// lag up to a minute. Gauges of time windows, unlike counters, are not reset on restart and can be alerted on as is.
+func (s *Server) metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	lines := map[string][]string{} // lines of each series of stats, grouped to follow their help
+	for _, win := range metricsWindows {
+		report, err := s.Stats.Report(now.Add(-win.duration), now)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(w, "can't get stats, %v\n", err)
+			return
+		}
+		add := func(name string, v float64, labels ...string) {
+			lines[name] = append(lines[name], metricLine(name, v, append([]string{"window", win.label}, labels...)...))
+		}
+		add("tgspam_checked_messages", float64(report.Checked))
+		add("tgspam_spam_messages", float64(report.Spam))
+		add("tgspam_degraded_messages", float64(report.Degraded))
+		add("tgspam_bans", float64(report.Bans))
+		add("tgspam_reversals", float64(report.Reversals))
+		checks := make([]string, 0, len(report.ByCheck))
+		for name := range report.ByCheck {
+			checks = append(checks, name)
+		}
+		sort.Strings(checks)
+		for _, name := range checks {
+			add("tgspam_detections_by_check", float64(report.ByCheck[name]), "check", name)
+		}
+		add("tgspam_openai_requests", float64(report.OpenAI.Requests))
+		add("tgspam_openai_cost_usd", report.OpenAI.Cost)
+	}
+
+	healthy := true
+	if s.HealthCheck != nil {
+		if err := s.HealthCheck(); err != nil {
+			log.Printf("[DEBUG] unhealthy for metrics, %v", err)
+			healthy = false
+		}
+	}
+	settings := s.settings()
+	buf := bytes.Buffer{}
+	writeGauge := func(name, help string, values ...string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s", name, help, name, strings.Join(values, ""))
+	}
+	writeGauge("tgspam_healthy", "1 if the bot is healthy, 0 otherwise", metricLine("tgspam_healthy", metricBool(healthy)))
+	writeGauge("tgspam_dry_mode", "1 if the bot runs in dry mode", metricLine("tgspam_dry_mode", metricBool(settings.Dry)))
+	writeGauge("tgspam_training_mode", "1 if the bot runs in training mode",
+		metricLine("tgspam_training_mode", metricBool(settings.Training)))
+	writeGauge("tgspam_approved_users", "number of approved users",
+		metricLine("tgspam_approved_users", float64(len(s.SpamFilter.ApprovedUsers()))))
+	for _, sr := range metricsSeries {
+		writeGauge(sr.name, sr.help, lines[sr.name]...)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+// metricLine makes a line of the metric with labels, given as name and value pairs
+func metricLine(name string, v float64, labels ...string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	return fmt.Sprintf("%s %g\n", name, v)
+}
+
+func metricBool(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package webapi
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_metricsHandler(t *testing.T) {
+	stats := &mocks.StatsReporterMock{
+		ReportFunc: func(from, to time.Time) (storage.StatsReport, error) {
+			if to.Sub(from) == time.Hour {
+				return storage.StatsReport{Checked: 10, Spam: 1, Bans: 1, ByCheck: map[string]int{"stopword": 1}}, nil
+			}
+			return storage.StatsReport{Checked: 200, Spam: 20, Degraded: 2, Bans: 18, Reversals: 1,
+				ByCheck: map[string]int{"stopword": 5, "cas": 15}, OpenAI: lib.OpenAIUsage{Requests: 7, Cost: 0.25}}, nil
+		},
+	}
+	spamFilter := &mocks.DetectorMock{ApprovedUsersFunc: func() []lib.ApprovedUser { return []lib.ApprovedUser{{UserID: "1"}} }}
+	server := NewServer(Config{SpamFilter: spamFilter, Stats: stats, Settings: Settings{Dry: true},
+		HealthCheck: func() error { return errors.New("listener stopped") }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "# TYPE tgspam_healthy gauge\ntgspam_healthy 0\n")
+	assert.Contains(t, string(body), "tgspam_dry_mode 1\n")
+	assert.Contains(t, string(body), "tgspam_training_mode 0\n")
+	assert.Contains(t, string(body), "tgspam_approved_users 1\n")
+	assert.Contains(t, string(body), "# HELP tgspam_checked_messages number of checked messages in the time window\n"+
+		"# TYPE tgspam_checked_messages gauge\n"+
+		"tgspam_checked_messages{window=\"1h\"} 10\ntgspam_checked_messages{window=\"24h\"} 200\n")
+	assert.Contains(t, string(body), "tgspam_detections_by_check{window=\"1h\",check=\"stopword\"} 1\n"+
+		"tgspam_detections_by_check{window=\"24h\",check=\"cas\"} 15\n"+
+		"tgspam_detections_by_check{window=\"24h\",check=\"stopword\"} 5\n")
+	assert.Contains(t, string(body), "tgspam_openai_cost_usd{window=\"24h\"} 0.25\n")
+	assert.Len(t, stats.ReportCalls(), 2)
+
+	t.Run("stats error", func(t *testing.T) {
+		stats := &mocks.StatsReporterMock{ReportFunc: func(from, to time.Time) (storage.StatsReport, error) {
+			return storage.StatsReport{}, errors.New("db error")
+		}}
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: spamFilter, Stats: stats}).routes(chi.NewRouter()))
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + "/metrics")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	})
+}
+
+func TestMetricLine(t *testing.T) {
+	assert.Equal(t, "m 1.5\n", metricLine("m", 1.5))
+	assert.Equal(t, "m{a=\"1\",b=\"x\\\"y\"} 2\n", metricLine("m", 2, "a", "1", "b", `x"y`))
+}
@@ -10,55 +10,72 @@ import (
 
 // DetectorMock is a mock implementation of webapi.SpamFilter.
 //
-//	func TestSomethingThatUsesDetector(t *testing.T) {
+//	func TestSomethingThatUsesSpamFilter(t *testing.T) {
 //
 //		// make and configure a mocked webapi.SpamFilter
-//		mockedDetector := &DetectorMock{
+//		mockedSpamFilter := &DetectorMock{
+//			AddApprovedUserFunc: func(user lib.ApprovedUser)  {
+//				panic("mock out the AddApprovedUser method")
+//			},
 //			AddApprovedUsersFunc: func(ids ...string)  {
 //				panic("mock out the AddApprovedUsers method")
 //			},
-//			ApprovedUsersFunc: func() []string {
+//			ApprovedUsersFunc: func() []lib.ApprovedUser {
 //				panic("mock out the ApprovedUsers method")
 //			},
 //			CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
 //				panic("mock out the Check method")
 //			},
+//			CheckLocalFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
+//				panic("mock out the CheckLocal method")
+//			},
 //			RemoveApprovedUsersFunc: func(ids ...string)  {
 //				panic("mock out the RemoveApprovedUsers method")
 //			},
-//			UpdateHamFunc: func(msg string) error {
-//				panic("mock out the UpdateHam method")
+//			UpdateHamFromFunc: func(msg string, source string) error {
+//				panic("mock out the UpdateHamFrom method")
 //			},
-//			UpdateSpamFunc: func(msg string) error {
-//				panic("mock out the UpdateSpam method")
+//			UpdateSpamFromFunc: func(msg string, source string) error {
+//				panic("mock out the UpdateSpamFrom method")
 //			},
 //		}
 //
-//		// use mockedDetector in code that requires webapi.SpamFilter
+//		// use mockedSpamFilter in code that requires webapi.SpamFilter
 //		// and then make assertions.
 //
 //	}
 type DetectorMock struct {
+	// AddApprovedUserFunc mocks the AddApprovedUser method.
+	AddApprovedUserFunc func(user lib.ApprovedUser)
+
 	// AddApprovedUsersFunc mocks the AddApprovedUsers method.
 	AddApprovedUsersFunc func(ids ...string)
 
 	// ApprovedUsersFunc mocks the ApprovedUsers method.
-	ApprovedUsersFunc func() []string
+	ApprovedUsersFunc func() []lib.ApprovedUser
 
 	// CheckFunc mocks the Check method.
 	CheckFunc func(msg string, userID string) (bool, []lib.CheckResult)
 
+	// CheckLocalFunc mocks the CheckLocal method.
+	CheckLocalFunc func(msg string, userID string) (bool, []lib.CheckResult)
+
 	// RemoveApprovedUsersFunc mocks the RemoveApprovedUsers method.
 	RemoveApprovedUsersFunc func(ids ...string)
 
-	// UpdateHamFunc mocks the UpdateHam method.
-	UpdateHamFunc func(msg string) error
+	// UpdateHamFromFunc mocks the UpdateHamFrom method.
+	UpdateHamFromFunc func(msg string, source string) error
 
-	// UpdateSpamFunc mocks the UpdateSpam method.
-	UpdateSpamFunc func(msg string) error
+	// UpdateSpamFromFunc mocks the UpdateSpamFrom method.
+	UpdateSpamFromFunc func(msg string, source string) error
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// AddApprovedUser holds details about calls to the AddApprovedUser method.
+		AddApprovedUser []struct {
+			// User is the user argument value.
+			User lib.ApprovedUser
+		}
 		// AddApprovedUsers holds details about calls to the AddApprovedUsers method.
 		AddApprovedUsers []struct {
 			// Ids is the ids argument value.
@@ -74,28 +91,80 @@ type DetectorMock struct {
 			// UserID is the userID argument value.
 			UserID string
 		}
+		// CheckLocal holds details about calls to the CheckLocal method.
+		CheckLocal []struct {
+			// Msg is the msg argument value.
+			Msg string
+			// UserID is the userID argument value.
+			UserID string
+		}
 		// RemoveApprovedUsers holds details about calls to the RemoveApprovedUsers method.
 		RemoveApprovedUsers []struct {
 			// Ids is the ids argument value.
 			Ids []string
 		}
-		// UpdateHam holds details about calls to the UpdateHam method.
-		UpdateHam []struct {
+		// UpdateHamFrom holds details about calls to the UpdateHamFrom method.
+		UpdateHamFrom []struct {
 			// Msg is the msg argument value.
 			Msg string
+			// Source is the source argument value.
+			Source string
 		}
-		// UpdateSpam holds details about calls to the UpdateSpam method.
-		UpdateSpam []struct {
+		// UpdateSpamFrom holds details about calls to the UpdateSpamFrom method.
+		UpdateSpamFrom []struct {
 			// Msg is the msg argument value.
 			Msg string
+			// Source is the source argument value.
+			Source string
 		}
 	}
+	lockAddApprovedUser     sync.RWMutex
 	lockAddApprovedUsers    sync.RWMutex
 	lockApprovedUsers       sync.RWMutex
 	lockCheck               sync.RWMutex
+	lockCheckLocal          sync.RWMutex
 	lockRemoveApprovedUsers sync.RWMutex
-	lockUpdateHam           sync.RWMutex
-	lockUpdateSpam          sync.RWMutex
+	lockUpdateHamFrom       sync.RWMutex
+	lockUpdateSpamFrom      sync.RWMutex
+}
+
+// AddApprovedUser calls AddApprovedUserFunc.
+func (mock *DetectorMock) AddApprovedUser(user lib.ApprovedUser) {
+	if mock.AddApprovedUserFunc == nil {
+		panic("DetectorMock.AddApprovedUserFunc: method is nil but SpamFilter.AddApprovedUser was just called")
+	}
+	callInfo := struct {
+		User lib.ApprovedUser
+	}{
+		User: user,
+	}
+	mock.lockAddApprovedUser.Lock()
+	mock.calls.AddApprovedUser = append(mock.calls.AddApprovedUser, callInfo)
+	mock.lockAddApprovedUser.Unlock()
+	mock.AddApprovedUserFunc(user)
+}
+
+// AddApprovedUserCalls gets all the calls that were made to AddApprovedUser.
+// check the length with:
+//
+//	len(mockedSpamFilter.AddApprovedUserCalls())
+func (mock *DetectorMock) AddApprovedUserCalls() []struct {
+	User lib.ApprovedUser
+} {
+	var calls []struct {
+		User lib.ApprovedUser
+	}
+	mock.lockAddApprovedUser.RLock()
+	calls = mock.calls.AddApprovedUser
+	mock.lockAddApprovedUser.RUnlock()
+	return calls
+}
+
+// ResetAddApprovedUserCalls reset all the calls that were made to AddApprovedUser.
+func (mock *DetectorMock) ResetAddApprovedUserCalls() {
+	mock.lockAddApprovedUser.Lock()
+	mock.calls.AddApprovedUser = nil
+	mock.lockAddApprovedUser.Unlock()
 }
 
 // AddApprovedUsers calls AddApprovedUsersFunc.
@@ -115,9 +184,9 @@ func (mock *DetectorMock) AddApprovedUsers(ids ...string) {
 }
 
 // AddApprovedUsersCalls gets all the calls that were made to AddApprovedUsers.
-// Check the length with:
+// check the length with:
 //
-//	len(mockedDetector.AddApprovedUsersCalls())
+//	len(mockedSpamFilter.AddApprovedUsersCalls())
 func (mock *DetectorMock) AddApprovedUsersCalls() []struct {
 	Ids []string
 } {
@@ -138,7 +207,7 @@ func (mock *DetectorMock) ResetAddApprovedUsersCalls() {
 }
 
 // ApprovedUsers calls ApprovedUsersFunc.
-func (mock *DetectorMock) ApprovedUsers() []string {
+func (mock *DetectorMock) ApprovedUsers() []lib.ApprovedUser {
 	if mock.ApprovedUsersFunc == nil {
 		panic("DetectorMock.ApprovedUsersFunc: method is nil but SpamFilter.ApprovedUsers was just called")
 	}
@@ -151,9 +220,9 @@ func (mock *DetectorMock) ApprovedUsers() []string {
 }
 
 // ApprovedUsersCalls gets all the calls that were made to ApprovedUsers.
-// Check the length with:
+// check the length with:
 //
-//	len(mockedDetector.ApprovedUsersCalls())
+//	len(mockedSpamFilter.ApprovedUsersCalls())
 func (mock *DetectorMock) ApprovedUsersCalls() []struct {
 } {
 	var calls []struct {
@@ -190,9 +259,9 @@ func (mock *DetectorMock) Check(msg string, userID string) (bool, []lib.CheckRes
 }
 
 // CheckCalls gets all the calls that were made to Check.
-// Check the length with:
+// check the length with:
 //
-//	len(mockedDetector.CheckCalls())
+//	len(mockedSpamFilter.CheckCalls())
 func (mock *DetectorMock) CheckCalls() []struct {
 	Msg    string
 	UserID string
@@ -214,6 +283,49 @@ func (mock *DetectorMock) ResetCheckCalls() {
 	mock.lockCheck.Unlock()
 }
 
+// CheckLocal calls CheckLocalFunc.
+func (mock *DetectorMock) CheckLocal(msg string, userID string) (bool, []lib.CheckResult) {
+	if mock.CheckLocalFunc == nil {
+		panic("DetectorMock.CheckLocalFunc: method is nil but SpamFilter.CheckLocal was just called")
+	}
+	callInfo := struct {
+		Msg    string
+		UserID string
+	}{
+		Msg:    msg,
+		UserID: userID,
+	}
+	mock.lockCheckLocal.Lock()
+	mock.calls.CheckLocal = append(mock.calls.CheckLocal, callInfo)
+	mock.lockCheckLocal.Unlock()
+	return mock.CheckLocalFunc(msg, userID)
+}
+
+// CheckLocalCalls gets all the calls that were made to CheckLocal.
+// check the length with:
+//
+//	len(mockedSpamFilter.CheckLocalCalls())
+func (mock *DetectorMock) CheckLocalCalls() []struct {
+	Msg    string
+	UserID string
+} {
+	var calls []struct {
+		Msg    string
+		UserID string
+	}
+	mock.lockCheckLocal.RLock()
+	calls = mock.calls.CheckLocal
+	mock.lockCheckLocal.RUnlock()
+	return calls
+}
+
+// ResetCheckLocalCalls reset all the calls that were made to CheckLocal.
+func (mock *DetectorMock) ResetCheckLocalCalls() {
+	mock.lockCheckLocal.Lock()
+	mock.calls.CheckLocal = nil
+	mock.lockCheckLocal.Unlock()
+}
+
 // RemoveApprovedUsers calls RemoveApprovedUsersFunc.
 func (mock *DetectorMock) RemoveApprovedUsers(ids ...string) {
 	if mock.RemoveApprovedUsersFunc == nil {
@@ -231,9 +343,9 @@ func (mock *DetectorMock) RemoveApprovedUsers(ids ...string) {
 }
 
 // RemoveApprovedUsersCalls gets all the calls that were made to RemoveApprovedUsers.
-// Check the length with:
+// check the length with:
 //
-//	len(mockedDetector.RemoveApprovedUsersCalls())
+//	len(mockedSpamFilter.RemoveApprovedUsersCalls())
 func (mock *DetectorMock) RemoveApprovedUsersCalls() []struct {
 	Ids []string
 } {
@@ -253,86 +365,98 @@ func (mock *DetectorMock) ResetRemoveApprovedUsersCalls() {
 	mock.lockRemoveApprovedUsers.Unlock()
 }
 
-// UpdateHam calls UpdateHamFunc.
-func (mock *DetectorMock) UpdateHam(msg string) error {
-	if mock.UpdateHamFunc == nil {
-		panic("DetectorMock.UpdateHamFunc: method is nil but SpamFilter.UpdateHam was just called")
+// UpdateHamFrom calls UpdateHamFromFunc.
+func (mock *DetectorMock) UpdateHamFrom(msg string, source string) error {
+	if mock.UpdateHamFromFunc == nil {
+		panic("DetectorMock.UpdateHamFromFunc: method is nil but SpamFilter.UpdateHamFrom was just called")
 	}
 	callInfo := struct {
-		Msg string
+		Msg    string
+		Source string
 	}{
-		Msg: msg,
+		Msg:    msg,
+		Source: source,
 	}
-	mock.lockUpdateHam.Lock()
-	mock.calls.UpdateHam = append(mock.calls.UpdateHam, callInfo)
-	mock.lockUpdateHam.Unlock()
-	return mock.UpdateHamFunc(msg)
+	mock.lockUpdateHamFrom.Lock()
+	mock.calls.UpdateHamFrom = append(mock.calls.UpdateHamFrom, callInfo)
+	mock.lockUpdateHamFrom.Unlock()
+	return mock.UpdateHamFromFunc(msg, source)
 }
 
-// UpdateHamCalls gets all the calls that were made to UpdateHam.
-// Check the length with:
+// UpdateHamFromCalls gets all the calls that were made to UpdateHamFrom.
+// check the length with:
 //
-//	len(mockedDetector.UpdateHamCalls())
-func (mock *DetectorMock) UpdateHamCalls() []struct {
-	Msg string
+//	len(mockedSpamFilter.UpdateHamFromCalls())
+func (mock *DetectorMock) UpdateHamFromCalls() []struct {
+	Msg    string
+	Source string
 } {
 	var calls []struct {
-		Msg string
+		Msg    string
+		Source string
 	}
-	mock.lockUpdateHam.RLock()
-	calls = mock.calls.UpdateHam
-	mock.lockUpdateHam.RUnlock()
+	mock.lockUpdateHamFrom.RLock()
+	calls = mock.calls.UpdateHamFrom
+	mock.lockUpdateHamFrom.RUnlock()
 	return calls
 }
 
-// ResetUpdateHamCalls reset all the calls that were made to UpdateHam.
-func (mock *DetectorMock) ResetUpdateHamCalls() {
-	mock.lockUpdateHam.Lock()
-	mock.calls.UpdateHam = nil
-	mock.lockUpdateHam.Unlock()
+// ResetUpdateHamFromCalls reset all the calls that were made to UpdateHamFrom.
+func (mock *DetectorMock) ResetUpdateHamFromCalls() {
+	mock.lockUpdateHamFrom.Lock()
+	mock.calls.UpdateHamFrom = nil
+	mock.lockUpdateHamFrom.Unlock()
 }
 
-// UpdateSpam calls UpdateSpamFunc.
-func (mock *DetectorMock) UpdateSpam(msg string) error {
-	if mock.UpdateSpamFunc == nil {
-		panic("DetectorMock.UpdateSpamFunc: method is nil but SpamFilter.UpdateSpam was just called")
+// UpdateSpamFrom calls UpdateSpamFromFunc.
+func (mock *DetectorMock) UpdateSpamFrom(msg string, source string) error {
+	if mock.UpdateSpamFromFunc == nil {
+		panic("DetectorMock.UpdateSpamFromFunc: method is nil but SpamFilter.UpdateSpamFrom was just called")
 	}
 	callInfo := struct {
-		Msg string
+		Msg    string
+		Source string
 	}{
-		Msg: msg,
+		Msg:    msg,
+		Source: source,
 	}
-	mock.lockUpdateSpam.Lock()
-	mock.calls.UpdateSpam = append(mock.calls.UpdateSpam, callInfo)
-	mock.lockUpdateSpam.Unlock()
-	return mock.UpdateSpamFunc(msg)
+	mock.lockUpdateSpamFrom.Lock()
+	mock.calls.UpdateSpamFrom = append(mock.calls.UpdateSpamFrom, callInfo)
+	mock.lockUpdateSpamFrom.Unlock()
+	return mock.UpdateSpamFromFunc(msg, source)
 }
 
-// UpdateSpamCalls gets all the calls that were made to UpdateSpam.
-// Check the length with:
+// UpdateSpamFromCalls gets all the calls that were made to UpdateSpamFrom.
+// check the length with:
 //
-//	len(mockedDetector.UpdateSpamCalls())
-func (mock *DetectorMock) UpdateSpamCalls() []struct {
-	Msg string
+//	len(mockedSpamFilter.UpdateSpamFromCalls())
+func (mock *DetectorMock) UpdateSpamFromCalls() []struct {
+	Msg    string
+	Source string
 } {
 	var calls []struct {
-		Msg string
+		Msg    string
+		Source string
 	}
-	mock.lockUpdateSpam.RLock()
-	calls = mock.calls.UpdateSpam
-	mock.lockUpdateSpam.RUnlock()
+	mock.lockUpdateSpamFrom.RLock()
+	calls = mock.calls.UpdateSpamFrom
+	mock.lockUpdateSpamFrom.RUnlock()
 	return calls
 }
 
-// ResetUpdateSpamCalls reset all the calls that were made to UpdateSpam.
-func (mock *DetectorMock) ResetUpdateSpamCalls() {
-	mock.lockUpdateSpam.Lock()
-	mock.calls.UpdateSpam = nil
-	mock.lockUpdateSpam.Unlock()
+// ResetUpdateSpamFromCalls reset all the calls that were made to UpdateSpamFrom.
+func (mock *DetectorMock) ResetUpdateSpamFromCalls() {
+	mock.lockUpdateSpamFrom.Lock()
+	mock.calls.UpdateSpamFrom = nil
+	mock.lockUpdateSpamFrom.Unlock()
 }
 
 // ResetCalls reset all the calls that were made to all mocked methods.
 func (mock *DetectorMock) ResetCalls() {
+	mock.lockAddApprovedUser.Lock()
+	mock.calls.AddApprovedUser = nil
+	mock.lockAddApprovedUser.Unlock()
+
 	mock.lockAddApprovedUsers.Lock()
 	mock.calls.AddApprovedUsers = nil
 	mock.lockAddApprovedUsers.Unlock()
@@ -345,15 +469,19 @@ func (mock *DetectorMock) ResetCalls() {
 	mock.calls.Check = nil
 	mock.lockCheck.Unlock()
 
+	mock.lockCheckLocal.Lock()
+	mock.calls.CheckLocal = nil
+	mock.lockCheckLocal.Unlock()
+
 	mock.lockRemoveApprovedUsers.Lock()
 	mock.calls.RemoveApprovedUsers = nil
 	mock.lockRemoveApprovedUsers.Unlock()
 
-	mock.lockUpdateHam.Lock()
-	mock.calls.UpdateHam = nil
-	mock.lockUpdateHam.Unlock()
+	mock.lockUpdateHamFrom.Lock()
+	mock.calls.UpdateHamFrom = nil
+	mock.lockUpdateHamFrom.Unlock()
 
-	mock.lockUpdateSpam.Lock()
-	mock.calls.UpdateSpam = nil
-	mock.lockUpdateSpam.Unlock()
+	mock.lockUpdateSpamFrom.Lock()
+	mock.calls.UpdateSpamFrom = nil
+	mock.lockUpdateSpamFrom.Unlock()
 }
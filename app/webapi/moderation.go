@@ -0,0 +1,463 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/lib"
+)
+
+const (
+	maxAuditRecords  = 1000 // max number of moderation audit records returned by GET /audit
+	userHistoryLimit = 100  // max number of detections, actions and messages of each kind returned by GET /users/{id}
+)
+
+// moderationRequest is an optional body of ban and unban requests
+type moderationRequest struct {
+	ChatID   int64  `json:"chat_id"`  // chat to ban or unban in, primary group if 0
+	Duration string `json:"duration"` // duration of the ban, i.e. "1h" or "24h", permanent if empty
+	Train    bool   `json:"train"`    // add purged messages to spam samples, for purge only
+}
+
+// PurgeResult is a result of purging messages of the user
+type PurgeResult struct {
+	Found   int `json:"found"`   // number of stored messages of the user
+	Deleted int `json:"deleted"` // number of deleted messages, 0 in dry mode
+	Trained int `json:"trained"` // number of messages added to spam samples
+}
+
+// banUserHandler handles POST /users/{id}/ban request. It bans the user in telegram, for the duration if set,
+// and records the action with the acting credential to the audit. The ban confirms the latest detection of the user,
+// not reversed yet, and its message is added to spam samples.
+func (s *Server) banUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, req, err := moderationParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	var duration time.Duration
+	if req.Duration != "" {
+		if duration, err = time.ParseDuration(req.Duration); err != nil || duration <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid duration", "details": "expected positive duration, i.e. 1h"})
+			return
+		}
+	}
+	if err = s.Ban(req.ChatID, userID, duration); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't ban user", "details": err.Error()})
+		return
+	}
+	details := "permanent"
+	if duration > 0 {
+		details = "duration " + duration.String()
+	}
+	s.audit(r, "ban", req.ChatID, userID, details)
+	resp := rest.JSON{"banned": true, "user_id": userID, "chat_id": req.ChatID, "duration": req.Duration}
+	if entry, ok := s.latestDetection(req.ChatID, userID); ok {
+		if err = s.SpamFilter.UpdateSpamFrom(entry.Text, apiSource(r)); err != nil {
+			log.Printf("[WARN] failed to add confirmed detection %d to spam samples, %v", entry.ID, err)
+		} else {
+			resp["confirmed"] = entry.ID
+		}
+	}
+	if s.Unban != nil {
+		resp["unban_url"] = fmt.Sprintf("%s/users/%d/unban", s.baseURL(r), userID) // to undo the ban with POST
+	}
+	rest.RenderJSON(w, resp)
+}
+
+// unbanUserHandler handles POST /users/{id}/unban request. It unbans the user in telegram
+// and records the action with the acting credential to the audit. The unban reverses the latest detection of the user,
+// not reversed yet, as false positive, the same way as reversal in web ui. Without such detection the user is not approved.
+func (s *Server) unbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, req, err := moderationParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	if err = s.Unban(req.ChatID, userID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't unban user", "details": err.Error()})
+		return
+	}
+	resp := rest.JSON{"unbanned": true, "user_id": userID, "chat_id": req.ChatID}
+	details := ""
+	if entry, ok := s.latestDetection(req.ChatID, userID); ok {
+		if err = s.reverseDetection(entry, apiSource(r)); err != nil {
+			log.Printf("[WARN] failed to reverse detection %d, %v", entry.ID, err)
+		} else {
+			resp["reversed"], details = entry.ID, fmt.Sprintf("detection %d reversed", entry.ID)
+		}
+	}
+	s.audit(r, "unban", req.ChatID, userID, details)
+	rest.RenderJSON(w, resp)
+}
+
+// bulkUnbanRequest is a body of bulk unban request, from or check is required
+type bulkUnbanRequest struct {
+	From   string `json:"from"`    // start of time range of bans, RFC3339 or period, i.e. 24h or 7d
+	To     string `json:"to"`      // end of time range of bans, RFC3339, now if empty
+	Check  string `json:"check"`   // name of spam check banned the users, i.e. stopword, any check if empty
+	DryRun bool   `json:"dry_run"` // report affected bans only, without changes
+}
+
+// bulkUnbanEntry is a ban reported by POST /users/unban
+type bulkUnbanEntry struct {
+	ID        int64             `json:"id"` // id of the detection
+	Timestamp time.Time         `json:"timestamp"`
+	ChatID    int64             `json:"chat_id"`
+	UserID    int64             `json:"user_id"`
+	UserName  string            `json:"user_name"`
+	Text      string            `json:"text"`
+	Checks    []lib.CheckResult `json:"checks"`
+	Error     string            `json:"error,omitempty"` // failure of unban or reversal
+}
+
+// bulkUnbanHandler handles POST /users/unban request. It unbans all users banned by the bot in the time range
+// and by the spam check, i.e. after a bad stop-word caused mass false positives. Each ban is reversed the same way
+// as unban of the single user, and the banned messages added to spam samples are removed from the stored samples.
+// With dry_run set only the affected bans are reported. Each unban is recorded to the audit.
+func (s *Server) bulkUnbanHandler(w http.ResponseWriter, r *http.Request) {
+	req := bulkUnbanRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	q, err := bulkUnbanQuery(req, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	bans, err := s.Detections.Bans(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read bans", "details": err.Error()})
+		return
+	}
+	res := make([]bulkUnbanEntry, 0, len(bans))
+	for _, b := range bans {
+		res = append(res, bulkUnbanEntry{ID: b.ID, Timestamp: b.Timestamp, ChatID: b.ChatID, UserID: b.UserID,
+			UserName: b.UserName, Text: b.Text, Checks: b.Checks})
+	}
+	if req.DryRun {
+		rest.RenderJSON(w, rest.JSON{"dry_run": true, "found": len(res), "bans": res})
+		return
+	}
+
+	unbanned, texts := 0, map[string]bool{}
+	done := map[[2]int64]bool{} // chat and user unbanned already, the user can be banned more than once
+	for i, b := range bans {
+		key := [2]int64{b.ChatID, b.UserID}
+		if !done[key] {
+			if err = s.Unban(b.ChatID, b.UserID); err != nil {
+				res[i].Error = fmt.Sprintf("can't unban user: %v", err)
+				continue
+			}
+			done[key] = true
+			unbanned++
+		}
+		if err = s.reverseDetection(b, apiSource(r)); err != nil {
+			res[i].Error = fmt.Sprintf("can't reverse detection: %v", err)
+		}
+		texts[b.Text] = true
+		s.audit(r, "unban", b.ChatID, b.UserID, fmt.Sprintf("bulk unban, %s, detection %d reversed", bulkUnbanDetails(req), b.ID))
+	}
+	removed := s.removeSpamSamples(texts)
+	if removed > 0 && !s.reload(w) {
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"dry_run": false, "found": len(res), "unbanned": unbanned, "samples_removed": removed,
+		"bans": res})
+}
+
+// bulkUnbanQuery returns the query of bans from bulk unban request. Time range or check is required,
+// so all bans are not reversed by mistake.
+func bulkUnbanQuery(req bulkUnbanRequest, now time.Time) (res storage.BansQuery, err error) {
+	if req.From == "" && req.Check == "" {
+		return res, errors.New("from or check is required")
+	}
+	if res.From, err = sinceParam(req.From, now); err != nil {
+		return res, fmt.Errorf("invalid from: %w", err)
+	}
+	if req.To != "" {
+		if res.To, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return res, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	res.Check = req.Check
+	return res, nil
+}
+
+// bulkUnbanDetails returns the query of bulk unban request for the audit, i.e. "check stopword, from 24h"
+func bulkUnbanDetails(req bulkUnbanRequest) string {
+	parts := []string{}
+	if req.Check != "" {
+		parts = append(parts, "check "+req.Check)
+	}
+	if req.From != "" {
+		parts = append(parts, "from "+req.From)
+	}
+	if req.To != "" {
+		parts = append(parts, "to "+req.To)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// removeSpamSamples removes stored spam samples added by users with the texts, i.e. messages of bans trained as spam.
+// Returns the number of removed samples, failures are logged only. Does nothing without samples store.
+func (s *Server) removeSpamSamples(texts map[string]bool) (count int) {
+	if s.Samples == nil || len(texts) == 0 {
+		return 0
+	}
+	samples, err := s.Samples.Read(storage.SampleTypeSpam, storage.SampleOriginUser)
+	if err != nil {
+		log.Printf("[WARN] can't read spam samples, %v", err)
+		return 0
+	}
+	for _, sample := range samples {
+		if !texts[sample.Message] {
+			continue
+		}
+		if err = s.Samples.Delete(sample.ID); err != nil {
+			log.Printf("[WARN] can't remove spam sample %d, %v", sample.ID, err)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// purgeUserHandler handles POST /users/{id}/purge request. It deletes all recent messages of the user stored
+// within the history window, i.e. earlier messages of confirmed spammer, and adds them to spam samples if train set.
+// The action is recorded with the acting credential to the audit.
+func (s *Server) purgeUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, req, err := moderationParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	res, err := s.Purge(req.ChatID, userID, req.Train, apiSource(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't purge messages", "details": err.Error()})
+		return
+	}
+	s.audit(r, "purge", req.ChatID, userID, fmt.Sprintf("deleted %d of %d messages, trained %d", res.Deleted, res.Found, res.Trained))
+	rest.RenderJSON(w, rest.JSON{"user_id": userID, "chat_id": req.ChatID, "found": res.Found, "deleted": res.Deleted,
+		"trained": res.Trained})
+}
+
+// latestDetection returns the latest detection of the user in the chat, or in any chat if chat id is 0,
+// if it is not reversed yet. Returns false if detections are not stored.
+func (s *Server) latestDetection(chatID, userID int64) (storage.DetectedSpamInfo, bool) {
+	if s.Detections == nil {
+		return storage.DetectedSpamInfo{}, false
+	}
+	detections, err := s.Detections.ReadByUser(userID, userHistoryLimit)
+	if err != nil {
+		log.Printf("[WARN] can't read detections of user %d, %v", userID, err)
+		return storage.DetectedSpamInfo{}, false
+	}
+	for _, d := range detections {
+		if chatID == 0 || d.ChatID == chatID {
+			return d, !d.Reversed.Valid
+		}
+	}
+	return storage.DetectedSpamInfo{}, false
+}
+
+// reverseDetection reverses the detection as false positive: adds the message to ham samples with the source,
+// approves the user and marks the detection as reversed, so it is not counted as a strike of the user anymore
+func (s *Server) reverseDetection(entry storage.DetectedSpamInfo, source string) error {
+	if err := s.SpamFilter.UpdateHamFrom(entry.Text, source); err != nil {
+		return fmt.Errorf("can't update ham samples, %w", err)
+	}
+	s.SpamFilter.AddApprovedUsers(strconv.FormatInt(entry.UserID, 10))
+	if _, err := s.Detections.SetReversed(entry.ChatID, entry.UserID); err != nil {
+		log.Printf("[WARN] failed to mark detection %d as reversed, %v", entry.ID, err)
+	}
+	return nil
+}
+
+// auditHandler handles GET /audit?limit=N request. It returns the latest moderation actions, newest first.
+// Actions can be filtered by action, actor and user_id params, and by time with from and to params in RFC3339 format.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := auditQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	actions, err := s.Audit.Read(q)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read audit", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"actions": actions, "count": len(actions)})
+}
+
+// auditQuery returns the query of moderation actions from request params, the latest 100 actions by default
+func auditQuery(r *http.Request) (res storage.AuditQuery, err error) {
+	params := r.URL.Query()
+	res = storage.AuditQuery{Action: params.Get("action"), Actor: params.Get("actor"), Limit: 100}
+	if v := params.Get("limit"); v != "" {
+		if res.Limit, err = strconv.Atoi(v); err != nil || res.Limit <= 0 || res.Limit > maxAuditRecords {
+			return res, fmt.Errorf("invalid limit %q, expected 1-%d", v, maxAuditRecords)
+		}
+	}
+	if v := params.Get("user_id"); v != "" {
+		if res.UserID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return res, fmt.Errorf("invalid user_id %q", v)
+		}
+	}
+	if v := params.Get("from"); v != "" {
+		if res.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return res, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if res.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return res, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// userDetection is a spam detection of the user reported by GET /users/{id}
+type userDetection struct {
+	ID        int64             `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	ChatID    int64             `json:"chat_id"`
+	Text      string            `json:"text"`
+	Action    string            `json:"action"`
+	Checks    []lib.CheckResult `json:"checks"`
+	Reversed  *time.Time        `json:"reversed,omitempty"` // time of reversal by admin, i.e. false positive
+}
+
+// userMessage is a recent message of the user reported by GET /users/{id}, texts of messages are not stored
+type userMessage struct {
+	Time     time.Time `json:"time"`
+	ChatID   int64     `json:"chat_id"`
+	MsgID    int       `json:"msg_id"`
+	UserName string    `json:"user_name"`
+}
+
+// userHistoryHandler handles GET /users/{id} request. It returns the moderation history of the user: approval status,
+// spam detections, bans and unbans made with api, notes of moderators and recent messages, each up to userHistoryLimit,
+// newest first. Strikes are detections not reversed by admin. Sections of disabled stores are omitted.
+func (s *Server) userHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || userID == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid user id", "details": chi.URLParam(r, "id")})
+		return
+	}
+	resp := rest.JSON{"user_id": userID, "approved": false}
+	approved := s.SpamFilter.ApprovedUsers()
+	if idx := slices.IndexFunc(approved, func(u lib.ApprovedUser) bool { return u.UserID == strconv.FormatInt(userID, 10) }); idx >= 0 {
+		resp["approved"], resp["approved_user"] = true, approved[idx]
+	}
+
+	if s.Detections != nil {
+		detections, dErr := s.Detections.ReadByUser(userID, userHistoryLimit)
+		if dErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't read detections", "details": dErr.Error()})
+			return
+		}
+		res, strikes := make([]userDetection, 0, len(detections)), 0
+		for _, d := range detections {
+			ud := userDetection{ID: d.ID, Timestamp: d.Timestamp, ChatID: d.ChatID, Text: d.Text, Action: d.Action, Checks: d.Checks}
+			if d.Reversed.Valid {
+				ud.Reversed = &d.Reversed.Time
+			} else {
+				strikes++
+			}
+			res = append(res, ud)
+		}
+		resp["detections"], resp["strikes"] = res, strikes
+	}
+
+	if s.Audit != nil {
+		actions, aErr := s.Audit.ReadByUser(userID, userHistoryLimit)
+		if aErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't read audit", "details": aErr.Error()})
+			return
+		}
+		resp["actions"] = actions
+	}
+
+	if s.Notes != nil {
+		notes, nErr := s.Notes.ByUser(userID, userHistoryLimit)
+		if nErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't read notes", "details": nErr.Error()})
+			return
+		}
+		resp["notes"] = notes
+	}
+
+	if s.Locator != nil {
+		messages, mErr := s.Locator.UserMessages(userID, userHistoryLimit)
+		if mErr != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't read messages", "details": mErr.Error()})
+			return
+		}
+		res := make([]userMessage, 0, len(messages))
+		for _, m := range messages {
+			res = append(res, userMessage{Time: m.Time, ChatID: m.ChatID, MsgID: m.MsgID, UserName: m.UserName})
+		}
+		resp["messages"] = res
+	}
+	rest.RenderJSON(w, resp)
+}
+
+// audit records the moderation action made with the request, if audit is enabled.
+// The action is already done, so failure to record it is only logged.
+func (s *Server) audit(r *http.Request, action string, chatID, userID int64, details string) {
+	actor := actorFrom(r.Context())
+	if userID == 0 {
+		log.Printf("[INFO] %s by %s, %s", action, actor, details)
+	} else {
+		log.Printf("[INFO] %s of user %d in chat %d by %s, %s", action, userID, chatID, actor, details)
+	}
+	if s.Audit == nil {
+		return
+	}
+	rec := storage.ModerationAction{Action: action, ChatID: chatID, UserID: userID, Actor: actor, Details: details}
+	if err := s.Audit.Add(rec); err != nil {
+		log.Printf("[WARN] can't record %s of user %d to audit, %v", action, userID, err)
+	}
+}
+
+// moderationParams returns user id from the url and the optional request body
+func moderationParams(r *http.Request) (userID int64, req moderationRequest, err error) {
+	if userID, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 64); err != nil || userID == 0 {
+		return 0, req, fmt.Errorf("invalid user id %q", chi.URLParam(r, "id"))
+	}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return 0, req, fmt.Errorf("can't decode request: %w", err)
+	}
+	return userID, req, nil
+}
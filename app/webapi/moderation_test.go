@@ -0,0 +1,558 @@
+package webapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_moderationHandlers(t *testing.T) {
+	type call struct {
+		chatID, userID int64
+		d              time.Duration
+	}
+	var bans, unbans []call
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Audit: audit, AuthPasswd: "passwd",
+		Ban: func(chatID, userID int64, d time.Duration) error {
+			if userID == 13 {
+				return errors.New("telegram error")
+			}
+			bans = append(bans, call{chatID: chatID, userID: userID, d: d})
+			return nil
+		},
+		Unban: func(chatID, userID int64) error {
+			unbans = append(unbans, call{chatID: chatID, userID: userID})
+			return nil
+		},
+	})
+	router := chi.NewRouter()
+	router.Use(server.auth)
+	ts := httptest.NewServer(server.routes(router))
+	defer ts.Close()
+
+	tbl := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		ban    *call
+		unban  *call
+		action storage.ModerationAction
+	}{
+		{name: "permanent ban", path: "/users/123/ban", status: http.StatusOK, ban: &call{userID: 123},
+			action: storage.ModerationAction{Action: "ban", UserID: 123, Actor: "basic", Details: "permanent"}},
+		{name: "ban for duration in chat", path: "/users/123/ban", body: `{"chat_id": 456, "duration": "1h"}`,
+			status: http.StatusOK, ban: &call{chatID: 456, userID: 123, d: time.Hour},
+			action: storage.ModerationAction{Action: "ban", ChatID: 456, UserID: 123, Actor: "basic", Details: "duration 1h0m0s"}},
+		{name: "unban", path: "/users/123/unban", status: http.StatusOK, unban: &call{userID: 123},
+			action: storage.ModerationAction{Action: "unban", UserID: 123, Actor: "basic"}},
+		{name: "unban in chat", path: "/users/123/unban", body: `{"chat_id": 456}`, status: http.StatusOK,
+			unban:  &call{chatID: 456, userID: 123},
+			action: storage.ModerationAction{Action: "unban", ChatID: 456, UserID: 123, Actor: "basic"}},
+		{name: "invalid user id", path: "/users/abc/ban", status: http.StatusBadRequest},
+		{name: "invalid body", path: "/users/123/unban", body: `{"chat_id": "abc"}`, status: http.StatusBadRequest},
+		{name: "invalid duration", path: "/users/123/ban", body: `{"duration": "1y"}`, status: http.StatusBadRequest},
+		{name: "negative duration", path: "/users/123/ban", body: `{"duration": "-1h"}`, status: http.StatusBadRequest},
+		{name: "ban failed", path: "/users/13/ban", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			bans, unbans = nil, nil
+			audit.ResetCalls()
+			req, err := http.NewRequest(http.MethodPost, ts.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.SetBasicAuth("tg-spam", "passwd")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+
+			if tt.ban != nil {
+				assert.Equal(t, []call{*tt.ban}, bans)
+			} else {
+				assert.Empty(t, bans)
+			}
+			if tt.unban != nil {
+				assert.Equal(t, []call{*tt.unban}, unbans)
+			} else {
+				assert.Empty(t, unbans)
+			}
+			if tt.status != http.StatusOK {
+				assert.Empty(t, audit.AddCalls(), "failed actions not recorded")
+				return
+			}
+			require.Len(t, audit.AddCalls(), 1)
+			assert.Equal(t, tt.action, audit.AddCalls()[0].Action)
+			if tt.ban != nil {
+				var res struct {
+					UnbanURL string `json:"unban_url"`
+				}
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+				assert.Equal(t, fmt.Sprintf("%s/users/%d/unban", ts.URL, tt.ban.userID), res.UnbanURL)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer ts.Close()
+		for _, path := range []string{"/users/123/ban", "/users/123/unban", "/users/123/purge"} {
+			resp, err := http.Post(ts.URL+path, "application/json", http.NoBody)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+		}
+	})
+}
+
+func TestServer_purgeUserHandler(t *testing.T) {
+	type call struct {
+		chatID, userID int64
+		train          bool
+		source         string
+	}
+	var purges []call
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Audit: audit, AuthPasswd: "passwd",
+		Purge: func(chatID, userID int64, train bool, source string) (PurgeResult, error) {
+			if userID == 13 {
+				return PurgeResult{}, errors.New("locator error")
+			}
+			purges = append(purges, call{chatID: chatID, userID: userID, train: train, source: source})
+			res := PurgeResult{Found: 3, Deleted: 2}
+			if train {
+				res.Trained = 3
+			}
+			return res, nil
+		},
+	})
+	router := chi.NewRouter()
+	router.Use(server.auth)
+	ts := httptest.NewServer(server.routes(router))
+	defer ts.Close()
+
+	post := func(t *testing.T, path, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.SetBasicAuth("tg-spam", "passwd")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("purge and train", func(t *testing.T) {
+		resp := post(t, "/users/123/purge", `{"chat_id": 456, "train": true}`)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res struct {
+			UserID  int64 `json:"user_id"`
+			Found   int   `json:"found"`
+			Deleted int   `json:"deleted"`
+			Trained int   `json:"trained"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, int64(123), res.UserID)
+		assert.Equal(t, 3, res.Found)
+		assert.Equal(t, 2, res.Deleted)
+		assert.Equal(t, 3, res.Trained)
+		assert.Equal(t, []call{{chatID: 456, userID: 123, train: true, source: "api:basic"}}, purges)
+		require.Len(t, audit.AddCalls(), 1)
+		assert.Equal(t, storage.ModerationAction{Action: "purge", ChatID: 456, UserID: 123, Actor: "basic",
+			Details: "deleted 2 of 3 messages, trained 3"}, audit.AddCalls()[0].Action)
+	})
+
+	t.Run("purge failed", func(t *testing.T) {
+		audit.ResetCalls()
+		resp := post(t, "/users/13/purge", "")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Empty(t, audit.AddCalls())
+	})
+
+	t.Run("invalid user id", func(t *testing.T) {
+		resp := post(t, "/users/abc/purge", "")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestServer_moderationFeedback(t *testing.T) {
+	detections := &mocks.DetectionsStoreMock{
+		ReadByUserFunc: func(userID int64, limit int) ([]storage.DetectedSpamInfo, error) {
+			switch userID {
+			case 123:
+				return []storage.DetectedSpamInfo{
+					{ID: 2, ChatID: 456, UserID: 123, Text: "buy crypto"},
+					{ID: 1, ChatID: 789, UserID: 123, Text: "old spam", Reversed: sql.NullTime{Valid: true, Time: time.Now()}},
+				}, nil
+			case 13:
+				return nil, errors.New("db error")
+			}
+			return []storage.DetectedSpamInfo{}, nil
+		},
+		SetReversedFunc: func(chatID, userID int64) (bool, error) { return true, nil },
+	}
+	detector := &mocks.DetectorMock{
+		UpdateSpamFromFunc:   func(msg, source string) error { return nil },
+		UpdateHamFromFunc:    func(msg, source string) error { return nil },
+		AddApprovedUsersFunc: func(ids ...string) {},
+	}
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	server := NewServer(Config{SpamFilter: detector, Detections: detections, Audit: audit,
+		Ban:   func(chatID, userID int64, d time.Duration) error { return nil },
+		Unban: func(chatID, userID int64) error { return nil },
+	})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	post := func(t *testing.T, path, body string) map[string]any {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		res := map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+	reset := func() {
+		detector.ResetCalls()
+		detections.ResetCalls()
+		audit.ResetCalls()
+	}
+
+	t.Run("ban confirms the latest detection", func(t *testing.T) {
+		reset()
+		res := post(t, "/users/123/ban", "")
+		assert.Equal(t, float64(2), res["confirmed"])
+		require.Len(t, detector.UpdateSpamFromCalls(), 1)
+		assert.Equal(t, "buy crypto", detector.UpdateSpamFromCalls()[0].Msg)
+	})
+
+	t.Run("unban reverses the latest detection in the chat", func(t *testing.T) {
+		reset()
+		res := post(t, "/users/123/unban", `{"chat_id": 456}`)
+		assert.Equal(t, float64(2), res["reversed"])
+		require.Len(t, detector.UpdateHamFromCalls(), 1)
+		assert.Equal(t, "buy crypto", detector.UpdateHamFromCalls()[0].Msg)
+		require.Len(t, detector.AddApprovedUsersCalls(), 1)
+		assert.Equal(t, []string{"123"}, detector.AddApprovedUsersCalls()[0].Ids)
+		require.Len(t, detections.SetReversedCalls(), 1)
+		assert.Equal(t, int64(456), detections.SetReversedCalls()[0].ChatID)
+		require.Len(t, audit.AddCalls(), 1)
+		assert.Equal(t, "detection 2 reversed", audit.AddCalls()[0].Action.Details)
+	})
+
+	t.Run("reversed detection is not reversed again", func(t *testing.T) {
+		reset()
+		res := post(t, "/users/123/unban", `{"chat_id": 789}`)
+		assert.NotContains(t, res, "reversed")
+		assert.Empty(t, detector.UpdateHamFromCalls())
+		assert.Empty(t, detector.AddApprovedUsersCalls())
+		assert.Empty(t, detections.SetReversedCalls())
+	})
+
+	t.Run("no detections", func(t *testing.T) {
+		reset()
+		res := post(t, "/users/124/ban", "")
+		assert.NotContains(t, res, "confirmed")
+		res = post(t, "/users/13/unban", "")
+		assert.NotContains(t, res, "reversed")
+		assert.Empty(t, detector.UpdateSpamFromCalls())
+		assert.Empty(t, detector.UpdateHamFromCalls())
+	})
+}
+
+func TestServer_bulkUnbanHandler(t *testing.T) {
+	stopword := []lib.CheckResult{{Name: "stopword", Spam: true, Details: "crypto"}}
+	detections := &mocks.DetectionsStoreMock{
+		BansFunc: func(q storage.BansQuery) ([]storage.DetectedSpamInfo, error) {
+			if q.Check == "fail" {
+				return nil, errors.New("db error")
+			}
+			return []storage.DetectedSpamInfo{
+				{ID: 1, ChatID: 456, UserID: 123, Text: "about crypto", Action: "ban", Checks: stopword},
+				{ID: 2, ChatID: 456, UserID: 124, Text: "crypto meetup", Action: "ban", Checks: stopword},
+				{ID: 3, ChatID: 456, UserID: 123, Text: "crypto again", Action: "ban", Checks: stopword},
+				{ID: 4, ChatID: 456, UserID: 13, Text: "crypto fail", Action: "ban", Checks: stopword},
+			}, nil
+		},
+		SetReversedFunc: func(chatID, userID int64) (bool, error) { return true, nil },
+	}
+	detector := &mocks.DetectorMock{
+		UpdateHamFromFunc:    func(msg, source string) error { return nil },
+		AddApprovedUsersFunc: func(ids ...string) {},
+	}
+	samples := &mocks.SamplesStoreMock{
+		ReadFunc: func(t storage.SampleType, origin storage.SampleOrigin) ([]storage.Sample, error) {
+			return []storage.Sample{{ID: 10, Message: "about crypto"}, {ID: 11, Message: "real spam"}}, nil
+		},
+		DeleteFunc: func(id int64) error { return nil },
+	}
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	unbanned := []int64{}
+	reloaded := 0
+	server := NewServer(Config{SpamFilter: detector, Detections: detections, Audit: audit, Samples: samples,
+		ReloadSamples: func() error { reloaded++; return nil },
+		Unban: func(chatID, userID int64) error {
+			if userID == 13 {
+				return errors.New("telegram error")
+			}
+			unbanned = append(unbanned, userID)
+			return nil
+		},
+	})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	type response struct {
+		DryRun         bool             `json:"dry_run"`
+		Found          int              `json:"found"`
+		Unbanned       int              `json:"unbanned"`
+		SamplesRemoved int              `json:"samples_removed"`
+		Bans           []bulkUnbanEntry `json:"bans"`
+	}
+	post := func(t *testing.T, body string, status int) response {
+		resp, err := http.Post(ts.URL+"/users/unban", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode)
+		res := response{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		res := post(t, `{"check": "stopword", "from": "24h", "dry_run": true}`, http.StatusOK)
+		assert.True(t, res.DryRun)
+		assert.Equal(t, 4, res.Found)
+		require.Len(t, res.Bans, 4)
+		assert.Equal(t, int64(124), res.Bans[1].UserID)
+		assert.Equal(t, stopword, res.Bans[1].Checks)
+		assert.Empty(t, unbanned)
+		assert.Empty(t, detections.SetReversedCalls())
+		assert.Empty(t, audit.AddCalls())
+		require.Len(t, detections.BansCalls(), 1)
+		q := detections.BansCalls()[0].Q
+		assert.Equal(t, "stopword", q.Check)
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), q.From, time.Minute)
+		assert.True(t, q.To.IsZero())
+	})
+
+	t.Run("unban", func(t *testing.T) {
+		res := post(t, `{"check": "stopword", "to": "2024-05-10T00:00:00Z"}`, http.StatusOK)
+		assert.False(t, res.DryRun)
+		assert.Equal(t, 4, res.Found)
+		assert.Equal(t, 2, res.Unbanned, "user banned twice unbanned once")
+		assert.Equal(t, []int64{123, 124}, unbanned)
+		assert.Equal(t, "can't unban user: telegram error", res.Bans[3].Error)
+		assert.Len(t, detections.SetReversedCalls(), 3, "each ban reversed")
+		require.Len(t, detector.UpdateHamFromCalls(), 3)
+		assert.Equal(t, "crypto again", detector.UpdateHamFromCalls()[2].Msg)
+		assert.Equal(t, 1, res.SamplesRemoved)
+		require.Len(t, samples.DeleteCalls(), 1)
+		assert.Equal(t, int64(10), samples.DeleteCalls()[0].ID)
+		assert.Equal(t, 1, reloaded)
+		require.Len(t, audit.AddCalls(), 3)
+		assert.Equal(t, storage.ModerationAction{Action: "unban", ChatID: 456, UserID: 124, Actor: "anonymous",
+			Details: "bulk unban, check stopword, to 2024-05-10T00:00:00Z, detection 2 reversed"}, audit.AddCalls()[1].Action)
+	})
+
+	tbl := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "not json", body: `abc`, status: http.StatusBadRequest},
+		{name: "no from and check", body: `{"to": "2024-05-10T00:00:00Z"}`, status: http.StatusBadRequest},
+		{name: "invalid from", body: `{"from": "yesterday"}`, status: http.StatusBadRequest},
+		{name: "invalid to", body: `{"check": "stopword", "to": "today"}`, status: http.StatusBadRequest},
+		{name: "read failed", body: `{"check": "fail"}`, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/users/unban", "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestServer_auditHandler(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	audit := &mocks.ModerationAuditStoreMock{
+		ReadFunc: func(q storage.AuditQuery) ([]storage.ModerationAction, error) {
+			if q.Limit == 13 {
+				return nil, errors.New("db error")
+			}
+			return []storage.ModerationAction{
+				{ID: 2, Timestamp: ts0.Add(time.Minute), Action: "unban", UserID: 123, Actor: "key:admin"},
+				{ID: 1, Timestamp: ts0, Action: "ban", UserID: 123, Actor: "basic", Details: "permanent"},
+			}, nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Audit: audit}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/audit?limit=10")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var res struct {
+		Actions []storage.ModerationAction `json:"actions"`
+		Count   int                        `json:"count"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, 2, res.Count)
+	assert.Equal(t, "key:admin", res.Actions[0].Actor)
+	assert.Equal(t, "permanent", res.Actions[1].Details)
+	require.Len(t, audit.ReadCalls(), 1)
+	assert.Equal(t, storage.AuditQuery{Limit: 10}, audit.ReadCalls()[0].Q)
+
+	tbl := []struct {
+		query  string
+		status int
+	}{
+		{query: "", status: http.StatusOK},
+		{query: "?limit=0", status: http.StatusBadRequest},
+		{query: "?limit=1001", status: http.StatusBadRequest},
+		{query: "?limit=abc", status: http.StatusBadRequest},
+		{query: "?limit=13", status: http.StatusInternalServerError},
+		{query: "?user_id=abc", status: http.StatusBadRequest},
+		{query: "?from=yesterday", status: http.StatusBadRequest},
+		{query: "?to=2024-05-01", status: http.StatusBadRequest},
+	}
+	for _, tt := range tbl {
+		resp, err := http.Get(ts.URL + "/audit" + tt.query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, tt.status, resp.StatusCode, tt.query)
+	}
+	assert.Equal(t, 100, audit.ReadCalls()[1].Q.Limit, "default limit")
+
+	audit.ResetReadCalls()
+	resp, err = http.Get(ts.URL + "/audit?action=ban&actor=admin:bob&user_id=123&from=2024-05-01T00:00:00Z&to=2024-05-02T00:00:00Z")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, audit.ReadCalls(), 1)
+	assert.Equal(t, storage.AuditQuery{Action: "ban", Actor: "admin:bob", UserID: 123, From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		To: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), Limit: 100}, audit.ReadCalls()[0].Q)
+}
+
+func TestServer_userHistoryHandler(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	detector := &mocks.DetectorMock{ApprovedUsersFunc: func() []lib.ApprovedUser {
+		return []lib.ApprovedUser{{UserID: "456", UserName: "good", Count: 5, FirstSeen: ts0}}
+	}}
+	detections := &mocks.DetectionsStoreMock{
+		ReadByUserFunc: func(userID int64, limit int) ([]storage.DetectedSpamInfo, error) {
+			if userID == 13 {
+				return nil, errors.New("db error")
+			}
+			return []storage.DetectedSpamInfo{
+				{ID: 2, Timestamp: ts0.Add(time.Hour), ChatID: 100, UserID: userID, Text: "spam 2", Action: "ban",
+					Checks: []lib.CheckResult{{Name: "stopword", Spam: true}}},
+				{ID: 1, Timestamp: ts0, ChatID: 100, UserID: userID, Text: "spam 1", Action: "ban",
+					Reversed: sql.NullTime{Time: ts0.Add(time.Minute), Valid: true}},
+			}, nil
+		},
+	}
+	audit := &mocks.ModerationAuditStoreMock{
+		ReadByUserFunc: func(userID int64, limit int) ([]storage.ModerationAction, error) {
+			return []storage.ModerationAction{{ID: 1, Timestamp: ts0, Action: "unban", UserID: userID, Actor: "basic"}}, nil
+		},
+	}
+	locator := &mocks.MessagesLocatorMock{
+		UserMessagesFunc: func(userID int64, limit int) ([]storage.MsgMeta, error) {
+			return []storage.MsgMeta{{Time: ts0, ChatID: 100, UserID: userID, UserName: "spammer", MsgID: 42}}, nil
+		},
+	}
+	notes := &mocks.NotesStoreMock{
+		ByUserFunc: func(userID int64, limit int) ([]storage.UserNote, error) {
+			return []storage.UserNote{{ID: 3, Timestamp: ts0, UserID: userID, Text: "warned #promo", Tags: []string{"promo"},
+				Author: "admin:bob"}}, nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: detector, Detections: detections, Audit: audit,
+		Locator: locator, Notes: notes}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/users/123")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var res struct {
+		UserID     int64                      `json:"user_id"`
+		Approved   bool                       `json:"approved"`
+		Strikes    int                        `json:"strikes"`
+		Detections []userDetection            `json:"detections"`
+		Actions    []storage.ModerationAction `json:"actions"`
+		Notes      []storage.UserNote         `json:"notes"`
+		Messages   []userMessage              `json:"messages"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, int64(123), res.UserID)
+	assert.False(t, res.Approved)
+	assert.Equal(t, 1, res.Strikes, "reversed detection is not a strike")
+	require.Len(t, res.Detections, 2)
+	assert.Equal(t, "spam 2", res.Detections[0].Text)
+	assert.Nil(t, res.Detections[0].Reversed)
+	require.NotNil(t, res.Detections[1].Reversed)
+	assert.Equal(t, ts0.Add(time.Minute), *res.Detections[1].Reversed)
+	assert.Equal(t, []storage.ModerationAction{{ID: 1, Timestamp: ts0, Action: "unban", UserID: 123, Actor: "basic"}}, res.Actions)
+	assert.Equal(t, []storage.UserNote{{ID: 3, Timestamp: ts0, UserID: 123, Text: "warned #promo", Tags: []string{"promo"},
+		Author: "admin:bob"}}, res.Notes)
+	assert.Equal(t, []userMessage{{Time: ts0, ChatID: 100, MsgID: 42, UserName: "spammer"}}, res.Messages)
+	assert.Equal(t, userHistoryLimit, detections.ReadByUserCalls()[0].Limit)
+
+	t.Run("approved user", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/users/456")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var res struct {
+			Approved     bool             `json:"approved"`
+			ApprovedUser lib.ApprovedUser `json:"approved_user"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.True(t, res.Approved)
+		assert.Equal(t, lib.ApprovedUser{UserID: "456", UserName: "good", Count: 5, FirstSeen: ts0}, res.ApprovedUser)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for path, status := range map[string]int{"/users/abc": http.StatusBadRequest, "/users/0": http.StatusBadRequest,
+			"/users/13": http.StatusInternalServerError} {
+			resp, err := http.Get(ts.URL + path)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, status, resp.StatusCode, path)
+		}
+	})
+
+	t.Run("stores disabled", func(t *testing.T) {
+		ts := httptest.NewServer(NewServer(Config{SpamFilter: detector}).routes(chi.NewRouter()))
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/users/123")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var res map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, map[string]any{"user_id": float64(123), "approved": false}, res)
+	})
+}
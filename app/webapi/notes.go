@@ -0,0 +1,78 @@
+package webapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// addNoteHandler handles POST /users/{id}/notes request with {"text": "warned twice for self-promo #promo"} body.
+// It adds a note of moderator about the user, words of the text starting with # are tags of the note.
+func (s *Server) addNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || userID == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid user id", "details": chi.URLParam(r, "id")})
+		return
+	}
+	req := struct {
+		Text string `json:"text"`
+	}{}
+	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		return
+	}
+	note, err := s.addNote(r, userID, req.Text)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't add note", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, note)
+}
+
+// deleteNoteHandler handles DELETE /users/{id}/notes/{note} request. It removes the note of the user.
+func (s *Server) deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, noteID, err := noteParams(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid request", "details": err.Error()})
+		return
+	}
+	if err = s.Notes.Delete(userID, noteID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		rest.RenderJSON(w, rest.JSON{"error": "can't delete note", "details": err.Error()})
+		return
+	}
+	log.Printf("[INFO] note %d of user %d deleted by %s", noteID, userID, actorFrom(r.Context()))
+	rest.RenderJSON(w, rest.JSON{"deleted": true, "id": noteID, "user_id": userID})
+}
+
+// addNote adds the note about the user by the actor of the request
+func (s *Server) addNote(r *http.Request, userID int64, text string) (storage.UserNote, error) {
+	note, err := s.Notes.Add(storage.UserNote{UserID: userID, Text: text, Author: apiSource(r)})
+	if err != nil {
+		return storage.UserNote{}, err
+	}
+	log.Printf("[INFO] note %d of user %d added by %s", note.ID, userID, note.Author)
+	return note, nil
+}
+
+// noteParams returns user id and note id from the url
+func noteParams(r *http.Request) (userID, noteID int64, err error) {
+	if userID, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 64); err != nil || userID == 0 {
+		return 0, 0, fmt.Errorf("invalid user id %q", chi.URLParam(r, "id"))
+	}
+	if noteID, err = strconv.ParseInt(chi.URLParam(r, "note"), 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid note id %q", chi.URLParam(r, "note"))
+	}
+	return userID, noteID, nil
+}
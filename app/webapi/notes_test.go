@@ -0,0 +1,145 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_notesHandlers(t *testing.T) {
+	notes := &mocks.NotesStoreMock{
+		AddFunc: func(note storage.UserNote) (storage.UserNote, error) {
+			if strings.TrimSpace(note.Text) == "" {
+				return storage.UserNote{}, errors.New("empty note")
+			}
+			note.ID, note.Tags = 7, storage.NoteTags(note.Text)
+			return note, nil
+		},
+		DeleteFunc: func(userID, id int64) error {
+			if id != 7 {
+				return errors.New("not found")
+			}
+			return nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Notes: notes}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("add", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/users/123/notes", "application/json",
+			strings.NewReader(`{"text": "warned twice for #promo"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res storage.UserNote
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, storage.UserNote{ID: 7, UserID: 123, Text: "warned twice for #promo", Tags: []string{"promo"},
+			Author: "api:anonymous"}, res)
+	})
+
+	t.Run("add errors", func(t *testing.T) {
+		for path, body := range map[string]string{"/users/abc/notes": `{"text": "note"}`, "/users/123/notes": `{"text": " "}`,
+			"/users/12/notes": `bad json`} {
+			resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for path, status := range map[string]int{"/users/123/notes/7": http.StatusOK, "/users/123/notes/8": http.StatusNotFound,
+			"/users/123/notes/abc": http.StatusBadRequest} {
+			req, err := http.NewRequest(http.MethodDelete, ts.URL+path, http.NoBody)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, status, resp.StatusCode, path)
+		}
+		assert.Equal(t, int64(123), notes.DeleteCalls()[0].UserID)
+	})
+
+	t.Run("notes disabled", func(t *testing.T) {
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer srv.Close()
+		resp, err := http.Post(srv.URL+"/users/123/notes", "application/json", strings.NewReader(`{"text": "note"}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestServer_uiUser(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	notes := &mocks.NotesStoreMock{
+		ByUserFunc: func(userID int64, limit int) ([]storage.UserNote, error) {
+			return []storage.UserNote{{ID: 7, Timestamp: ts0, UserID: userID, Text: "warned twice", Tags: []string{"promo"},
+				Author: "admin:bob"}}, nil
+		},
+		AddFunc: func(note storage.UserNote) (storage.UserNote, error) {
+			if note.Text == "" {
+				return storage.UserNote{}, errors.New("empty note")
+			}
+			return note, nil
+		},
+		DeleteFunc: func(userID, id int64) error { return nil },
+	}
+	detections := &mocks.DetectionsStoreMock{
+		ReadByUserFunc: func(userID int64, limit int) ([]storage.DetectedSpamInfo, error) {
+			return []storage.DetectedSpamInfo{{ID: 1, Timestamp: ts0, UserID: userID, Text: "buy crypto", Action: "ban"}}, nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Notes: notes,
+		Detections: detections}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("page", func(t *testing.T) {
+		body := uiGet(t, ts.URL+"/ui/users/123")
+		assert.Contains(t, body, "User 123")
+		assert.Contains(t, body, "warned twice")
+		assert.Contains(t, body, "#promo")
+		assert.Contains(t, body, "admin:bob")
+		assert.Contains(t, body, `action="/ui/users/123/notes/7/delete"`)
+		assert.Contains(t, body, "buy crypto")
+	})
+
+	t.Run("add", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/users/123/notes", url.Values{"text": {"second warning"}}, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui/users/123?msg=note+added", resp.Header.Get("Location"))
+		require.Len(t, notes.AddCalls(), 1)
+		assert.Equal(t, storage.UserNote{UserID: 123, Text: "second warning", Author: "api:anonymous"}, notes.AddCalls()[0].Note)
+
+		resp = uiPost(t, ts.URL+"/ui/users/123/notes", url.Values{"text": {""}}, nil)
+		assert.Contains(t, resp.Header.Get("Location"), "err=can%27t+add+note")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/users/123/notes/7/delete", url.Values{}, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui/users/123?msg=note+deleted", resp.Header.Get("Location"))
+		require.Len(t, notes.DeleteCalls(), 1)
+		assert.Equal(t, int64(7), notes.DeleteCalls()[0].ID)
+	})
+
+	t.Run("notes disabled", func(t *testing.T) {
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer srv.Close()
+		body := uiGet(t, srv.URL+"/ui/users/123")
+		assert.Contains(t, body, "notes are not available")
+		assert.Contains(t, body, "detections are not available")
+	})
+}
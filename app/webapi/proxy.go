@@ -0,0 +1,113 @@
+package webapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies are networks of reverse proxies, i.e. nginx or traefik, trusted to set X-Forwarded-For,
+// X-Real-IP, X-Forwarded-Proto and X-Forwarded-Host headers. Headers of other clients are ignored.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses the list of ips and networks in cidr notation, i.e. 10.0.0.0/8
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	res := make(TrustedProxies, 0, len(list))
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			prefix, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy network %q: %w", v, err)
+			}
+			res = append(res, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy ip %q: %w", v, err)
+		}
+		res = append(res, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return res, nil
+}
+
+// contains checks if the ip belongs to any of trusted proxies
+func (t TrustedProxies) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns ip of the client made the request. If the request came from a trusted proxy,
+// the ip is taken from X-Forwarded-For, the last address not of trusted proxies, or from X-Real-IP.
+// Otherwise, the headers can be spoofed by the client, and the remote address is used.
+func (s *Server) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !s.TrustedProxies.contains(ip) {
+		return ip
+	}
+
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		addrs := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if _, err := netip.ParseAddr(addr); err != nil {
+				break // malformed header, the last valid address is used
+			}
+			ip = addr
+			if !s.TrustedProxies.contains(addr) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return ip
+}
+
+// baseURL returns the external url of the server with its path prefix, i.e. https://example.com, to make links in responses.
+// X-Forwarded-Proto and X-Forwarded-Host headers are respected if the request came from a trusted proxy.
+func (s *Server) baseURL(r *http.Request) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if s.TrustedProxies.contains(remoteIP(r)) {
+		// proxies can append values, the first one is set by the proxy facing the client
+		if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); proto != "" {
+			if proto = strings.ToLower(strings.TrimSpace(proto)); proto == "http" || proto == "https" {
+				scheme = proto
+			}
+		}
+		if fwdHost, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); strings.TrimSpace(fwdHost) != "" {
+			host = strings.TrimSpace(fwdHost)
+		}
+	}
+	return scheme + "://" + host + s.BasePath
+}
+
+// remoteIP returns ip of the remote address of the request, i.e. of the proxy if the request came through it
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,107 @@
+package webapi
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.10 ", "", "::1", "172.16.5.1/12"})
+	require.NoError(t, err)
+	require.Len(t, proxies, 4)
+	assert.Equal(t, "192.168.1.10/32", proxies[1].String())
+	assert.Equal(t, "::1/128", proxies[2].String())
+	assert.Equal(t, "172.16.0.0/12", proxies[3].String(), "masked")
+
+	assert.True(t, proxies.contains("10.1.2.3"))
+	assert.True(t, proxies.contains("::ffff:10.1.2.3"), "ipv4-mapped ipv6")
+	assert.True(t, proxies.contains("::1"))
+	assert.False(t, proxies.contains("192.168.1.11"))
+	assert.False(t, proxies.contains("bad"))
+
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0"})
+	assert.Error(t, err)
+}
+
+func TestServer_clientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	server := NewServer(Config{TrustedProxies: proxies})
+
+	tbl := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		{name: "direct", remote: "1.2.3.4:1234", ip: "1.2.3.4"},
+		{name: "spoofed by untrusted client", remote: "1.2.3.4:1234",
+			headers: map[string]string{"X-Forwarded-For": "5.6.7.8", "X-Real-IP": "5.6.7.8"}, ip: "1.2.3.4"},
+		{name: "trusted proxy", remote: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-For": "5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "chain of trusted proxies", remote: "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "5.6.7.8, 10.0.0.2"}, ip: "5.6.7.8"},
+		{name: "spoofed through trusted proxy", remote: "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "9.9.9.9, 5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "malformed forwarded for", remote: "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "bad, 5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "real ip", remote: "10.0.0.1:1234", headers: map[string]string{"X-Real-IP": "5.6.7.8"}, ip: "5.6.7.8"},
+		{name: "proxy without headers", remote: "10.0.0.1:1234", ip: "10.0.0.1"},
+		{name: "ipv6", remote: "[2001:db8::1]:1234", ip: "2001:db8::1"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.ip, server.clientIP(req))
+		})
+	}
+}
+
+func TestServer_baseURL(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	server := NewServer(Config{TrustedProxies: proxies})
+
+	tbl := []struct {
+		name    string
+		remote  string
+		tls     bool
+		headers map[string]string
+		url     string
+	}{
+		{name: "direct", remote: "1.2.3.4:1234", url: "http://example.com"},
+		{name: "direct tls", remote: "1.2.3.4:1234", tls: true, url: "https://example.com"},
+		{name: "untrusted forwarded", remote: "1.2.3.4:1234",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"}, url: "http://example.com"},
+		{name: "trusted proxy", remote: "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "spam.example.com"},
+			url:     "https://spam.example.com"},
+		{name: "trusted proxy chain", remote: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-Proto": "HTTPS, http"},
+			url: "https://example.com"},
+		{name: "bad proto", remote: "10.0.0.1:1234", headers: map[string]string{"X-Forwarded-Proto": "ftp"},
+			url: "http://example.com"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/users/1/ban", http.NoBody)
+			req.RemoteAddr = tt.remote
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.url, server.baseURL(req))
+		})
+	}
+}
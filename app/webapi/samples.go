@@ -0,0 +1,342 @@
+package webapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+// samplesFormat is a format of samples download and upload
+type samplesFormat string
+
+// enum of samples formats
+const (
+	samplesFormatTxt  samplesFormat = "txt"  // one sample per line, the format of samples files
+	samplesFormatJSON samplesFormat = "json" // array of samples, with "message" field in each
+	samplesFormatCSV  samplesFormat = "csv"  // csv with header, "message" column is required
+)
+
+// mediaTypeFormats maps media types of Accept and Content-Type headers to samples formats
+var mediaTypeFormats = map[string]samplesFormat{
+	"text/plain":       samplesFormatTxt,
+	"application/json": samplesFormatJSON,
+	"text/csv":         samplesFormatCSV,
+}
+
+// contentType returns the content type of the format
+func (f samplesFormat) contentType() string {
+	switch f {
+	case samplesFormatJSON:
+		return "application/json"
+	case samplesFormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// maxSampleLen is the max length of uploaded sample, in runes
+const maxSampleLen = 4096
+
+// newlines replaces line breaks of multiline samples, as each sample is stored as a single line
+var newlines = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// downloadSamplesHandler makes handler of GET /samples/{spam|ham}?origin=preset|user&format=txt|json|csv request.
+// It streams stored samples of the type in the format set by the param or negotiated with Accept header,
+// txt by default. Origin is optional and means all samples if not set.
+func (s *Server) downloadSamplesHandler(sampleType storage.SampleType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin, err := samplesOrigin(r, storage.SampleOriginAny)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid sample origin", "details": err.Error()})
+			return
+		}
+		format, err := samplesFormatOf(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid format", "details": err.Error()})
+			return
+		}
+
+		samples, err := s.Samples.Read(sampleType, origin)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't read samples", "details": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", format.contentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-samples.%s", sampleType, format)))
+		if err = writeSamples(w, format, samples); err != nil {
+			// headers are sent already, so the error can't be reported to the client
+			log.Printf("[WARN] can't write %s samples, %v", sampleType, err)
+		}
+	}
+}
+
+// uploadSamplesHandler makes handler of PUT /samples/{spam|ham}?origin=preset|user&mode=append|replace request.
+// The format of the body is taken from Content-Type header, txt if not set. Samples are validated and deduplicated,
+// replace mode removes all stored samples of the type and origin first. Origin is user by default.
+// Samples are reloaded after the update, so the classifier uses them right away.
+func (s *Server) uploadSamplesHandler(sampleType storage.SampleType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin, err := samplesOrigin(r, storage.SampleOriginUser)
+		if err != nil || origin == storage.SampleOriginAny {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid sample origin", "details": "expected preset or user"})
+			return
+		}
+		mode := r.URL.Query().Get("mode")
+		switch mode {
+		case "":
+			mode = "append"
+		case "append", "replace":
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid mode", "details": "expected append or replace"})
+			return
+		}
+		format, err := samplesFormatOfContentType(r.Header.Get("Content-Type"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			rest.RenderJSON(w, rest.JSON{"error": "unsupported content type", "details": err.Error()})
+			return
+		}
+
+		messages, err := readSamples(r.Body, format)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid samples", "details": err.Error()})
+			return
+		}
+		uploaded := len(messages)
+		if messages = dedupSamples(messages); len(messages) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid samples", "details": "no samples"})
+			return
+		}
+
+		source := apiSource(r)
+		if origin == storage.SampleOriginPreset {
+			source = storage.SampleSourceBase
+		}
+		count, err := s.Samples.Import(sampleType, origin, source, strings.NewReader(strings.Join(messages, "\n")), mode == "replace")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't import samples", "details": err.Error()})
+			return
+		}
+		log.Printf("[INFO] %d %s %s samples uploaded by %s, mode %s", count, origin, sampleType, actorFrom(r.Context()), mode)
+		if !s.reload(w) {
+			return
+		}
+		rest.RenderJSON(w, rest.JSON{"updated": true, "type": sampleType, "origin": origin, "mode": mode,
+			"count": count, "duplicates": uploaded - len(messages)})
+	}
+}
+
+// samplesOrigin returns the origin param of the request, or the default one if not set
+func samplesOrigin(r *http.Request, def storage.SampleOrigin) (storage.SampleOrigin, error) {
+	origin := storage.SampleOrigin(r.URL.Query().Get("origin"))
+	switch origin {
+	case "":
+		return def, nil
+	case storage.SampleOriginPreset, storage.SampleOriginUser, storage.SampleOriginAny:
+		return origin, nil
+	}
+	return "", fmt.Errorf("unknown origin %q", origin)
+}
+
+// sinceParam parses since param, RFC3339 time or duration back from now, i.e. "2h" or "7d". Zero time if empty.
+func sinceParam(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	var period time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid since %q, expected RFC3339 time or duration", v)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if period, err = time.ParseDuration(v); err != nil {
+			return time.Time{}, fmt.Errorf("invalid since %q, expected RFC3339 time or duration", v)
+		}
+	}
+	if period <= 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q, duration should be positive", v)
+	}
+	return now.Add(-period), nil
+}
+
+// samplesFormatOf returns the format set by the param, or negotiated with the Accept header if param is empty
+func samplesFormatOf(param, accept string) (samplesFormat, error) {
+	switch samplesFormat(param) {
+	case samplesFormatTxt, samplesFormatJSON, samplesFormatCSV:
+		return samplesFormat(param), nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format %q, expected txt, json or csv", param)
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if format, ok := mediaTypeFormats[mediaType]; ok {
+			return format, nil
+		}
+	}
+	return samplesFormatTxt, nil
+}
+
+// samplesFormatOfContentType returns the format of uploaded samples by the content type, txt if not set
+func samplesFormatOfContentType(contentType string) (samplesFormat, error) {
+	if contentType == "" {
+		return samplesFormatTxt, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("can't parse content type %q: %w", contentType, err)
+	}
+	if format, ok := mediaTypeFormats[mediaType]; ok {
+		return format, nil
+	}
+	return "", fmt.Errorf("expected text/plain, application/json or text/csv, got %q", mediaType)
+}
+
+// writeSamples writes samples in the format. Json and csv have sample's metadata along with the message.
+func writeSamples(w io.Writer, format samplesFormat, samples []storage.Sample) error {
+	switch format {
+	case samplesFormatJSON:
+		return json.NewEncoder(w).Encode(samples)
+	case samplesFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"id", "timestamp", "type", "origin", "message"}); err != nil {
+			return fmt.Errorf("can't write csv header: %w", err)
+		}
+		for _, sample := range samples {
+			rec := []string{strconv.FormatInt(sample.ID, 10), sample.Timestamp.Format(time.RFC3339),
+				string(sample.Type), string(sample.Origin), sample.Message}
+			if err := cw.Write(rec); err != nil {
+				return fmt.Errorf("can't write csv record: %w", err)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		bw := bufio.NewWriter(w)
+		for _, sample := range samples {
+			if _, err := bw.WriteString(sample.Message + "\n"); err != nil {
+				return fmt.Errorf("can't write sample: %w", err)
+			}
+		}
+		return bw.Flush()
+	}
+}
+
+// readSamples reads messages of samples in the format, and validates them.
+// Empty messages are skipped, multiline messages are joined into a single line.
+func readSamples(r io.Reader, format samplesFormat) ([]string, error) {
+	var messages []string
+	switch format {
+	case samplesFormatJSON:
+		var samples []struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r).Decode(&samples); err != nil {
+			return nil, fmt.Errorf("can't decode json samples: %w", err)
+		}
+		for _, sample := range samples {
+			messages = append(messages, sample.Message)
+		}
+	case samplesFormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("can't read csv header: %w", err)
+		}
+		msgIdx := -1
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), "message") {
+				msgIdx = i
+			}
+		}
+		if msgIdx < 0 {
+			return nil, errors.New("no message column in csv header")
+		}
+		for {
+			rec, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("can't read csv record: %w", err)
+			}
+			if msgIdx >= len(rec) {
+				return nil, fmt.Errorf("no message in csv record %q", strings.Join(rec, ","))
+			}
+			messages = append(messages, rec[msgIdx])
+		}
+	default:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			messages = append(messages, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("can't read samples: %w", err)
+		}
+	}
+
+	res := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		msg = strings.TrimSpace(newlines.Replace(msg))
+		if msg == "" {
+			continue
+		}
+		if !utf8.ValidString(msg) {
+			return nil, fmt.Errorf("sample %q is not valid utf-8", msg)
+		}
+		if utf8.RuneCountInString(msg) > maxSampleLen {
+			return nil, fmt.Errorf("sample %q... is longer than %d characters", string([]rune(msg)[:32]), maxSampleLen)
+		}
+		res = append(res, msg)
+	}
+	return res, nil
+}
+
+// dedupSamples removes duplicated messages, keeping the order of the first ones
+func dedupSamples(messages []string) []string {
+	seen := make(map[string]bool, len(messages))
+	res := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if seen[msg] {
+			continue
+		}
+		seen[msg] = true
+		res = append(res, msg)
+	}
+	return res
+}
@@ -0,0 +1,233 @@
+package webapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_downloadSamplesHandler(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	samplesStore := &mocks.SamplesStoreMock{
+		ReadFunc: func(t storage.SampleType, origin storage.SampleOrigin) ([]storage.Sample, error) {
+			if origin == storage.SampleOriginPreset {
+				return nil, errors.New("db error")
+			}
+			return []storage.Sample{
+				{ID: 1, Timestamp: ts0, Type: t, Origin: storage.SampleOriginUser, Message: "buy now"},
+				{ID: 2, Timestamp: ts0, Type: t, Origin: storage.SampleOriginUser, Message: `free "crypto", today`},
+			}, nil
+		},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Samples: samplesStore}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	get := func(path, accept string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, http.NoBody)
+		require.NoError(t, err)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	t.Run("txt by default", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		resp, body := get("/samples/spam", "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="spam-samples.txt"`, resp.Header.Get("Content-Disposition"))
+		assert.Equal(t, "buy now\nfree \"crypto\", today\n", body)
+		require.Len(t, samplesStore.ReadCalls(), 1)
+		assert.Equal(t, storage.SampleTypeSpam, samplesStore.ReadCalls()[0].T)
+		assert.Equal(t, storage.SampleOriginAny, samplesStore.ReadCalls()[0].Origin)
+	})
+
+	t.Run("json by accept header", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		resp, body := get("/samples/ham?origin=user", "application/json, text/plain;q=0.5")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var samples []storage.Sample
+		require.NoError(t, json.Unmarshal([]byte(body), &samples))
+		require.Len(t, samples, 2)
+		assert.Equal(t, storage.SampleTypeHam, samples[0].Type)
+		assert.Equal(t, `free "crypto", today`, samples[1].Message)
+		assert.Equal(t, storage.SampleOriginUser, samplesStore.ReadCalls()[0].Origin)
+	})
+
+	t.Run("csv by param", func(t *testing.T) {
+		resp, body := get("/samples/spam?format=csv", "application/json")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+		recs, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"id", "timestamp", "type", "origin", "message"},
+			{"1", "2024-05-01T10:00:00Z", "spam", "user", "buy now"},
+			{"2", "2024-05-01T10:00:00Z", "spam", "user", `free "crypto", today`},
+		}, recs)
+	})
+
+	tbl := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "bad format", path: "/samples/spam?format=xml", status: http.StatusBadRequest},
+		{name: "bad origin", path: "/samples/spam?origin=blah", status: http.StatusBadRequest},
+		{name: "read failed", path: "/samples/spam?origin=preset", status: http.StatusInternalServerError},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := get(tt.path, "")
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestServer_uploadSamplesHandler(t *testing.T) {
+	var imported []string
+	samplesStore := &mocks.SamplesStoreMock{
+		ImportFunc: func(t storage.SampleType, origin storage.SampleOrigin, source string, r io.Reader, withCleanup bool) (int, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return 0, err
+			}
+			if strings.Contains(string(data), "fail") {
+				return 0, errors.New("db error")
+			}
+			imported = strings.Split(string(data), "\n")
+			return len(imported), nil
+		},
+	}
+	var reloads int
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Samples: samplesStore,
+		ReloadSamples: func() error { reloads++; return nil }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	tbl := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		imported    []string
+		origin      storage.SampleOrigin
+		cleanup     bool
+	}{
+		{name: "txt append", path: "/samples/spam", body: "buy now\n\n  free crypto  \nbuy now\n", status: http.StatusOK,
+			imported: []string{"buy now", "free crypto"}, origin: storage.SampleOriginUser},
+		{name: "json replace", path: "/samples/ham?mode=replace&origin=preset", contentType: "application/json",
+			body: `[{"id": 1, "message": "hello\nall"}, {"message": "how are you"}, {"message": ""}]`, status: http.StatusOK,
+			imported: []string{"hello all", "how are you"}, origin: storage.SampleOriginPreset, cleanup: true},
+		{name: "csv", path: "/samples/spam", contentType: "text/csv; charset=utf-8",
+			body: "id,message\n1,\"buy, now\"\n2,free crypto\n", status: http.StatusOK,
+			imported: []string{"buy, now", "free crypto"}, origin: storage.SampleOriginUser},
+		{name: "csv without message column", path: "/samples/spam", contentType: "text/csv", body: "id,text\n1,buy now\n",
+			status: http.StatusBadRequest},
+		{name: "bad json", path: "/samples/spam", contentType: "application/json", body: `{"message": "buy"}`,
+			status: http.StatusBadRequest},
+		{name: "no samples", path: "/samples/spam", body: "\n  \n", status: http.StatusBadRequest},
+		{name: "too long sample", path: "/samples/spam", body: strings.Repeat("a", maxSampleLen+1), status: http.StatusBadRequest},
+		{name: "not utf-8", path: "/samples/spam", body: "buy \xff now", status: http.StatusBadRequest},
+		{name: "bad mode", path: "/samples/spam?mode=merge", body: "buy now", status: http.StatusBadRequest},
+		{name: "bad origin", path: "/samples/spam?origin=any", body: "buy now", status: http.StatusBadRequest},
+		{name: "unsupported content type", path: "/samples/spam", contentType: "application/xml", body: "<a/>",
+			status: http.StatusUnsupportedMediaType},
+		{name: "import failed", path: "/samples/spam", body: "fail", status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			samplesStore.ResetCalls()
+			imported, reloads = nil, 0
+			req, err := http.NewRequest(http.MethodPut, ts.URL+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.status != http.StatusOK {
+				assert.Equal(t, 0, reloads, "not reloaded")
+				return
+			}
+
+			assert.Equal(t, tt.imported, imported)
+			require.Len(t, samplesStore.ImportCalls(), 1)
+			assert.Equal(t, tt.origin, samplesStore.ImportCalls()[0].Origin)
+			assert.Equal(t, tt.cleanup, samplesStore.ImportCalls()[0].WithCleanup)
+			assert.Equal(t, 1, reloads, "samples reloaded")
+
+			var res struct {
+				Count      int `json:"count"`
+				Duplicates int `json:"duplicates"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			assert.Equal(t, len(tt.imported), res.Count)
+		})
+	}
+}
+
+func TestSamples_roundTrip(t *testing.T) {
+	samples := []storage.Sample{{ID: 1, Message: "buy now"}, {ID: 2, Message: `free "crypto", today`}}
+	for _, format := range []samplesFormat{samplesFormatTxt, samplesFormatJSON, samplesFormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var sb strings.Builder
+			require.NoError(t, writeSamples(&sb, format, samples))
+			messages, err := readSamples(strings.NewReader(sb.String()), format)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"buy now", `free "crypto", today`}, messages)
+		})
+	}
+}
+
+func TestSinceParam(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		inp     string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-10-15T10:00:00Z", time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC), false},
+		{"2h", now.Add(-2 * time.Hour), false},
+		{"7d", now.Add(-7 * 24 * time.Hour), false},
+		{"xd", time.Time{}, true},
+		{"-1h", time.Time{}, true},
+		{"blah", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.inp, func(t *testing.T) {
+			got, err := sinceParam(tt.inp, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/cron"
+)
+
+// ScheduleRule is a rule of scheduled settings, applied over the runtime settings while its cron expression
+// matches the current minute, i.e. stricter thresholds at night or during an announced event
+type ScheduleRule struct {
+	Name     string          `json:"name"`
+	Cron     string          `json:"cron"`             // cron expression of minutes the rule is active, i.e. "* 0-6 * * *"
+	Settings RuntimeSettings `json:"settings"`         // settings applied while the rule is active
+	Source   string          `json:"source,omitempty"` // "config" for rules set by options, read-only, "api" otherwise
+}
+
+// Validate checks the name, cron expression and settings of the rule
+func (r ScheduleRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("no name of schedule rule")
+	}
+	if _, err := cron.Parse(r.Cron); err != nil {
+		return fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	if err := r.Settings.Validate(); err != nil {
+		return fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	return nil
+}
+
+// Schedule gets and sets rules of scheduled settings, set by options and with api
+type Schedule struct {
+	Rules    func() (rules []ScheduleRule, active []string) // rules of options and api, with names of active ones
+	SetRules func(rules []ScheduleRule) error               // replaces and persists rules set with api
+}
+
+// scheduleHandler handles GET /settings/schedule request. It returns rules of scheduled settings, set by options
+// and with api, and names of rules active now.
+func (s *Server) scheduleHandler(w http.ResponseWriter, _ *http.Request) {
+	rules, active := s.Schedule.Rules()
+	rest.RenderJSON(w, rest.JSON{"rules": rules, "active": active})
+}
+
+// updateScheduleHandler handles PUT /settings/schedule request. It replaces rules set with api by the rules
+// of the body, {"rules": [{"name": "night", "cron": "* 0-6 * * *", "settings": {"min_spam_probability": 40}}]}.
+// Rules set by options are not changed. Rules are persisted and applied on the next check of the schedule.
+func (s *Server) updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rules []ScheduleRule `json:"rules"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		return
+	}
+	names := map[string]bool{}
+	current, _ := s.Schedule.Rules()
+	for _, rule := range current {
+		if rule.Source == "config" {
+			names[rule.Name] = true // rules of options can't be redefined
+		}
+	}
+	for i, rule := range req.Rules {
+		err := rule.Validate()
+		if err == nil && names[rule.Name] {
+			err = fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid schedule rule", "details": err.Error()})
+			return
+		}
+		names[rule.Name] = true
+		req.Rules[i].Source = ""
+	}
+	if err := s.Schedule.SetRules(req.Rules); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't update schedule", "details": err.Error()})
+		return
+	}
+	ruleNames := make([]string, 0, len(req.Rules))
+	for _, rule := range req.Rules {
+		ruleNames = append(ruleNames, rule.Name)
+	}
+	details := "no rules"
+	if len(ruleNames) > 0 {
+		details = "rules: " + strings.Join(ruleNames, ", ")
+	}
+	s.audit(r, "schedule", 0, 0, details)
+	rules, active := s.Schedule.Rules()
+	rest.RenderJSON(w, rest.JSON{"rules": rules, "active": active})
+}
@@ -0,0 +1,109 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_scheduleHandlers(t *testing.T) {
+	probability := 40.0
+	rules := []ScheduleRule{{Name: "night", Cron: "* 0-6 * * *", Settings: RuntimeSettings{MinSpamProbability: &probability},
+		Source: "config"}}
+	schedule := &Schedule{
+		Rules: func() ([]ScheduleRule, []string) { return rules, []string{"night"} },
+		SetRules: func(upd []ScheduleRule) error {
+			if len(upd) > 0 && upd[0].Name == "fail" {
+				return errors.New("db error")
+			}
+			rules = append(rules[:1], upd...)
+			return nil
+		},
+	}
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Schedule: schedule, Audit: audit})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	type response struct {
+		Rules  []ScheduleRule `json:"rules"`
+		Active []string       `json:"active"`
+	}
+
+	resp, err := http.Get(ts.URL + "/settings/schedule")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var res response
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, response{Rules: rules, Active: []string{"night"}}, res)
+
+	put := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/settings/schedule", strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	putResp := put(`{"rules": [{"name": "event", "cron": "0-59 18-20 * * 5", "settings": {"max_emoji": 0}, "source": "config"}]}`)
+	defer putResp.Body.Close()
+	require.Equal(t, http.StatusOK, putResp.StatusCode)
+	res = response{}
+	require.NoError(t, json.NewDecoder(putResp.Body).Decode(&res))
+	require.Len(t, res.Rules, 2)
+	assert.Equal(t, "event", res.Rules[1].Name)
+	assert.Equal(t, 0, *res.Rules[1].Settings.MaxEmoji)
+	assert.Empty(t, res.Rules[1].Source, "source set by the schedule, not by request")
+	require.Len(t, audit.AddCalls(), 1)
+	assert.Equal(t, storage.ModerationAction{Action: "schedule", Actor: "anonymous", Details: "rules: event"},
+		audit.AddCalls()[0].Action)
+
+	tbl := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "not json", body: `abc`, status: http.StatusBadRequest},
+		{name: "unknown field", body: `{"rules": [], "extra": 1}`, status: http.StatusBadRequest},
+		{name: "no name", body: `{"rules": [{"cron": "* * * * *", "settings": {"max_emoji": 0}}]}`, status: http.StatusBadRequest},
+		{name: "invalid cron", body: `{"rules": [{"name": "a", "cron": "* 24 * * *", "settings": {"max_emoji": 0}}]}`,
+			status: http.StatusBadRequest},
+		{name: "invalid settings", body: `{"rules": [{"name": "a", "cron": "* * * * *", "settings": {"min_spam_probability": 101}}]}`,
+			status: http.StatusBadRequest},
+		{name: "duplicate", body: `{"rules": [{"name": "a", "cron": "* * * * *", "settings": {"max_emoji": 0}},` +
+			`{"name": "a", "cron": "* 1 * * *", "settings": {"max_emoji": 1}}]}`, status: http.StatusBadRequest},
+		{name: "rule of options", body: `{"rules": [{"name": "night", "cron": "* * * * *", "settings": {"max_emoji": 0}}]}`,
+			status: http.StatusBadRequest},
+		{name: "update failed", body: `{"rules": [{"name": "fail", "cron": "* * * * *", "settings": {"max_emoji": 0}}]}`,
+			status: http.StatusInternalServerError},
+		{name: "all removed", body: `{"rules": []}`, status: http.StatusOK},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := put(tt.body)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+	assert.Len(t, rules, 1, "rules set with api removed, rules of options kept")
+
+	t.Run("no schedule", func(t *testing.T) {
+		ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/settings/schedule")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
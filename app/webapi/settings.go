@@ -0,0 +1,160 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-pkgz/rest"
+)
+
+// RuntimeSettings is a subset of settings which can be changed without restart with PUT /settings.
+// Fields which are not set, i.e. nil, are not changed.
+type RuntimeSettings struct {
+	SimilarityThreshold *float64 `json:"similarity_threshold,omitempty"`
+	MinMsgLen           *int     `json:"min_msg_len,omitempty"`
+	MaxEmoji            *int     `json:"max_emoji,omitempty"`
+	MinSpamProbability  *float64 `json:"min_spam_probability,omitempty"`
+	SpamMsg             *string  `json:"spam_msg,omitempty"`
+	SpamDryMsg          *string  `json:"spam_dry_msg,omitempty"`
+	Training            *bool    `json:"training,omitempty"`
+	Dry                 *bool    `json:"dry,omitempty"`
+}
+
+// Validate checks the values of the set fields, returns error if nothing set
+func (rs RuntimeSettings) Validate() error {
+	if rs == (RuntimeSettings{}) {
+		return errors.New("no settings to change")
+	}
+	var errs []error
+	if rs.SimilarityThreshold != nil && (*rs.SimilarityThreshold < 0 || *rs.SimilarityThreshold > 1) {
+		errs = append(errs, fmt.Errorf("similarity_threshold %v is out of range 0-1", *rs.SimilarityThreshold))
+	}
+	if rs.MinMsgLen != nil && *rs.MinMsgLen < 0 {
+		errs = append(errs, fmt.Errorf("min_msg_len %d is negative", *rs.MinMsgLen))
+	}
+	if rs.MaxEmoji != nil && *rs.MaxEmoji < -1 {
+		errs = append(errs, fmt.Errorf("max_emoji %d is less than -1", *rs.MaxEmoji))
+	}
+	if rs.MinSpamProbability != nil && (*rs.MinSpamProbability < 0 || *rs.MinSpamProbability > 100) {
+		errs = append(errs, fmt.Errorf("min_spam_probability %v is out of range 0-100", *rs.MinSpamProbability))
+	}
+	if rs.SpamMsg != nil && *rs.SpamMsg == "" {
+		errs = append(errs, errors.New("spam_msg is empty"))
+	}
+	if rs.SpamDryMsg != nil && *rs.SpamDryMsg == "" {
+		errs = append(errs, errors.New("spam_dry_msg is empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// Merge returns the settings with the set fields of upd replacing the current ones
+func (rs RuntimeSettings) Merge(upd RuntimeSettings) RuntimeSettings {
+	if upd.SimilarityThreshold != nil {
+		rs.SimilarityThreshold = upd.SimilarityThreshold
+	}
+	if upd.MinMsgLen != nil {
+		rs.MinMsgLen = upd.MinMsgLen
+	}
+	if upd.MaxEmoji != nil {
+		rs.MaxEmoji = upd.MaxEmoji
+	}
+	if upd.MinSpamProbability != nil {
+		rs.MinSpamProbability = upd.MinSpamProbability
+	}
+	if upd.SpamMsg != nil {
+		rs.SpamMsg = upd.SpamMsg
+	}
+	if upd.SpamDryMsg != nil {
+		rs.SpamDryMsg = upd.SpamDryMsg
+	}
+	if upd.Training != nil {
+		rs.Training = upd.Training
+	}
+	if upd.Dry != nil {
+		rs.Dry = upd.Dry
+	}
+	return rs
+}
+
+// Apply returns the settings with the set fields of rs replacing the current ones
+func (rs RuntimeSettings) Apply(s Settings) Settings {
+	if rs.SimilarityThreshold != nil {
+		s.SimilarityThreshold = *rs.SimilarityThreshold
+	}
+	if rs.MinMsgLen != nil {
+		s.MinMsgLen = *rs.MinMsgLen
+	}
+	if rs.MaxEmoji != nil {
+		s.MaxEmoji = *rs.MaxEmoji
+	}
+	if rs.MinSpamProbability != nil {
+		s.MinSpamProbability = *rs.MinSpamProbability
+	}
+	if rs.SpamMsg != nil {
+		s.SpamMsg = *rs.SpamMsg
+	}
+	if rs.SpamDryMsg != nil {
+		s.SpamDryMsg = *rs.SpamDryMsg
+	}
+	if rs.Training != nil {
+		s.Training = *rs.Training
+	}
+	if rs.Dry != nil {
+		s.Dry = *rs.Dry
+	}
+	return s
+}
+
+// settingsHandler handles GET /settings request. It returns detector settings.
+func (s *Server) settingsHandler(w http.ResponseWriter, _ *http.Request) {
+	rest.RenderJSON(w, s.settings())
+}
+
+// updateSettingsHandler handles PUT /settings request. It validates and applies runtime settings passed in the body,
+// other settings can't be changed without restart. Changed settings are persisted and reported by GET /settings,
+// settings of active schedule rules override them till the rules end.
+func (s *Server) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var req RuntimeSettings
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields() // reject settings which can't be changed at runtime
+	if err := dec.Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid settings", "details": err.Error()})
+		return
+	}
+
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+	applied, err := s.UpdateSettings(req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't update settings", "details": err.Error()})
+		return
+	}
+	s.Settings = applied.Apply(s.Settings)
+	changed, _ := json.Marshal(req) // marshaling of decoded settings can't fail
+	s.audit(r, "settings", 0, 0, string(changed))
+	rest.RenderJSON(w, s.Settings)
+}
+
+// ApplySettings updates the settings reported by GET /settings with the ones changed outside of webapi,
+// i.e. by reload of configuration. Thread-safe.
+func (s *Server) ApplySettings(rs RuntimeSettings) {
+	s.settingsLock.Lock()
+	defer s.settingsLock.Unlock()
+	s.Settings = rs.Apply(s.Settings)
+}
+
+// settings returns the current settings, thread-safe
+func (s *Server) settings() Settings {
+	s.settingsLock.RLock()
+	defer s.settingsLock.RUnlock()
+	return s.Settings
+}
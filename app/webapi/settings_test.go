@@ -0,0 +1,119 @@
+package webapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_updateSettingsHandler(t *testing.T) {
+	var updates []RuntimeSettings
+	settings := Settings{SimilarityThreshold: 0.5, MinMsgLen: 50, MaxEmoji: 2, MinSpamProbability: 50, SamplesStorage: "db",
+		SpamMsg: "this is spam", SpamDryMsg: "this is spam (dry mode)"}
+	audit := &mocks.ModerationAuditStoreMock{AddFunc: func(action storage.ModerationAction) error { return nil }}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Settings: settings, Audit: audit,
+		UpdateSettings: func(rs RuntimeSettings) (RuntimeSettings, error) {
+			if rs.SpamMsg != nil && *rs.SpamMsg == "fail" {
+				return RuntimeSettings{}, errors.New("db error")
+			}
+			updates = append(updates, rs)
+			return rs, nil
+		}})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	put := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/settings", strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := put(`{"similarity_threshold": 0.7, "max_emoji": -1, "spam_msg": "spam!", "training": true}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var res Settings
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	expected := settings
+	expected.SimilarityThreshold, expected.MaxEmoji, expected.SpamMsg, expected.Training = 0.7, -1, "spam!", true
+	assert.Equal(t, expected, res)
+
+	require.Len(t, updates, 1)
+	assert.Equal(t, 0.7, *updates[0].SimilarityThreshold)
+	assert.Equal(t, -1, *updates[0].MaxEmoji)
+	assert.Equal(t, "spam!", *updates[0].SpamMsg)
+	assert.True(t, *updates[0].Training)
+	assert.Nil(t, updates[0].MinMsgLen, "not set fields not changed")
+	assert.Nil(t, updates[0].Dry)
+	require.Len(t, audit.AddCalls(), 1)
+	assert.Equal(t, "settings", audit.AddCalls()[0].Action.Action)
+	assert.Equal(t, "anonymous", audit.AddCalls()[0].Action.Actor)
+	assert.JSONEq(t, `{"similarity_threshold": 0.7, "max_emoji": -1, "spam_msg": "spam!", "training": true}`,
+		audit.AddCalls()[0].Action.Details, "changed settings recorded")
+
+	getResp, err := http.Get(ts.URL + "/settings")
+	require.NoError(t, err)
+	defer getResp.Body.Close()
+	res = Settings{}
+	require.NoError(t, json.NewDecoder(getResp.Body).Decode(&res))
+	assert.Equal(t, expected, res, "changed settings reported")
+
+	tbl := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "empty", body: `{}`, status: http.StatusBadRequest},
+		{name: "not json", body: `abc`, status: http.StatusBadRequest},
+		{name: "not runtime setting", body: `{"first_message_only": true}`, status: http.StatusBadRequest},
+		{name: "similarity out of range", body: `{"similarity_threshold": 1.5}`, status: http.StatusBadRequest},
+		{name: "negative min length", body: `{"min_msg_len": -1}`, status: http.StatusBadRequest},
+		{name: "max emoji below -1", body: `{"max_emoji": -2}`, status: http.StatusBadRequest},
+		{name: "probability out of range", body: `{"min_spam_probability": 101}`, status: http.StatusBadRequest},
+		{name: "empty message", body: `{"spam_dry_msg": ""}`, status: http.StatusBadRequest},
+		{name: "update failed", body: `{"spam_msg": "fail"}`, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := put(tt.body)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+	assert.Len(t, updates, 1, "failed updates not applied")
+	assert.Equal(t, expected, server.settings(), "failed updates not reported")
+
+	t.Run("disabled", func(t *testing.T) {
+		ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer ts.Close()
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/settings", strings.NewReader(`{"dry": true}`))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
+
+func TestRuntimeSettings_Merge(t *testing.T) {
+	threshold, minLen, dry, msg := 0.7, 10, true, "spam"
+	stored := RuntimeSettings{SimilarityThreshold: &threshold, Dry: &dry}
+	upd := RuntimeSettings{MinMsgLen: &minLen, SpamMsg: &msg}
+	assert.Equal(t, RuntimeSettings{SimilarityThreshold: &threshold, MinMsgLen: &minLen, SpamMsg: &msg, Dry: &dry},
+		stored.Merge(upd))
+
+	notDry := false
+	assert.Equal(t, RuntimeSettings{SimilarityThreshold: &threshold, Dry: &notDry}, stored.Merge(RuntimeSettings{Dry: &notDry}))
+	assert.Equal(t, stored, stored.Merge(RuntimeSettings{}))
+}
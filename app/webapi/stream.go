@@ -0,0 +1,185 @@
+package webapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-pkgz/rest"
+
+	"github.com/umputun/tg-spam/app/webhook"
+)
+
+const (
+	maxStreamClients  = 100              // max number of concurrent /stream connections
+	streamBufferSize  = 64               // max number of events waiting to be sent to a stream client
+	streamPingPeriod  = 15 * time.Second // interval of keep-alive comments, also detects gone clients
+	streamPath        = "/stream"
+	maxRequestTimeout = 60 * time.Second // max processing time of requests, except streams
+)
+
+// EventStream is a live feed of moderation events, i.e. spam detections, bans, unbans and training.
+// Events are received with Notify and sent to all connected /stream clients as server-sent events.
+type EventStream struct {
+	lock    sync.Mutex
+	clients map[*streamClient]struct{}
+	lastID  int64
+}
+
+// streamClient is a connected /stream client with its filter and queue of events
+type streamClient struct {
+	events  chan streamEvent
+	types   []webhook.EventType // event types sent to the client, all if empty
+	chatID  int64               // chat of events sent to the client, all if 0
+	dropped atomic.Int64        // number of events dropped since the last report, the client is too slow
+}
+
+// streamEvent is an event with its sequential id in the stream
+type streamEvent struct {
+	id    int64
+	event webhook.Event
+}
+
+// NewEventStream makes an event stream with no clients
+func NewEventStream() *EventStream {
+	return &EventStream{clients: map[*streamClient]struct{}{}}
+}
+
+// Notify sends the event to all clients accepting it. It never blocks, the event is dropped for clients
+// which don't keep up, and they get "dropped" event with the number of missed events.
+func (s *EventStream) Notify(event webhook.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastID++
+	for c := range s.clients {
+		if !c.accepts(event) {
+			continue
+		}
+		select {
+		case c.events <- streamEvent{id: s.lastID, event: event}:
+		default:
+			c.dropped.Add(1)
+		}
+	}
+}
+
+// subscribe adds a client, returns false if too many clients connected
+func (s *EventStream) subscribe(c *streamClient) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.clients) >= maxStreamClients {
+		return false
+	}
+	s.clients[c] = struct{}{}
+	return true
+}
+
+func (s *EventStream) unsubscribe(c *streamClient) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.clients, c)
+}
+
+func (c *streamClient) accepts(event webhook.Event) bool {
+	if len(c.types) > 0 && !slices.Contains(c.types, event.Type) {
+		return false
+	}
+	return c.chatID == 0 || c.chatID == event.ChatID
+}
+
+// streamHandler handles GET /stream?type=spam,ban&chat=123 request. It sends moderation events as server-sent events,
+// optionally filtered by event types and chat. The connection is kept open till the client disconnects.
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	client := &streamClient{events: make(chan streamEvent, streamBufferSize)}
+	if v := r.URL.Query().Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !slices.Contains(webhook.EventTypes, webhook.EventType(t)) {
+				w.WriteHeader(http.StatusBadRequest)
+				rest.RenderJSON(w, rest.JSON{"error": "invalid event type", "details": fmt.Sprintf("expected one of %v", webhook.EventTypes)})
+				return
+			}
+			client.types = append(client.types, webhook.EventType(t))
+		}
+	}
+	if v := r.URL.Query().Get("chat"); v != "" {
+		chatID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			rest.RenderJSON(w, rest.JSON{"error": "invalid chat", "details": err.Error()})
+			return
+		}
+		client.chatID = chatID
+	}
+
+	if !s.Events.subscribe(client) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		rest.RenderJSON(w, rest.JSON{"error": "too many stream clients"})
+		return
+	}
+	defer s.Events.unsubscribe(client)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{}) // no write timeout for long-lived connection, not supported by test recorder
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable buffering by nginx
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("[WARN] can't stream events, %v", err)
+		return
+	}
+	log.Printf("[DEBUG] stream client connected from %s, types: %v, chat: %d", r.RemoteAddr, client.types, client.chatID)
+
+	ping := time.NewTicker(streamPingPeriod)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			log.Printf("[DEBUG] stream client %s disconnected", r.RemoteAddr)
+			return
+		case e := <-client.events:
+			if dropped := client.dropped.Swap(0); dropped > 0 {
+				if _, err = fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped); err != nil {
+					break
+				}
+			}
+			var data []byte
+			if data, err = json.Marshal(e.event); err == nil {
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.event.Type, data)
+			}
+		case <-ping.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Printf("[DEBUG] stream client %s gone, %v", r.RemoteAddr, err)
+			return
+		}
+	}
+}
+
+// requestTimeout limits processing time of requests, except for long-lived event streams
+func requestTimeout(next http.Handler) http.Handler {
+	limited := middleware.Timeout(maxRequestTimeout)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == streamPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,174 @@
+package webapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/app/webhook"
+)
+
+func TestServer_streamHandler(t *testing.T) {
+	stream := NewEventStream()
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Events: stream})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?type=spam,ban&chat=123", http.NoBody)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool { return streamClients(stream) == 1 }, time.Second, 10*time.Millisecond)
+
+	stream.Notify(webhook.Event{Type: webhook.EventSpam, ChatID: 123, UserID: 1, UserName: "spammer", Text: "buy now"})
+	stream.Notify(webhook.Event{Type: webhook.EventBan, ChatID: 456, UserID: 2})   // other chat
+	stream.Notify(webhook.Event{Type: webhook.EventUnban, ChatID: 123, UserID: 3}) // other type
+	stream.Notify(webhook.Event{Type: webhook.EventBan, ChatID: 123, UserID: 1})
+
+	scanner := bufio.NewScanner(resp.Body)
+	readEvent := func() (id, name string, event webhook.Event) {
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				return id, name, event
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			}
+		}
+		require.NoError(t, scanner.Err())
+		return id, name, event
+	}
+
+	id, name, event := readEvent()
+	assert.Equal(t, "1", id)
+	assert.Equal(t, "spam", name)
+	assert.Equal(t, webhook.EventSpam, event.Type)
+	assert.Equal(t, "spammer", event.UserName)
+	assert.Equal(t, "buy now", event.Text)
+	assert.False(t, event.Time.IsZero())
+
+	id, name, event = readEvent()
+	assert.Equal(t, "4", id, "filtered events skipped")
+	assert.Equal(t, "ban", name)
+	assert.Equal(t, int64(1), event.UserID)
+
+	cancel()
+	assert.Eventually(t, func() bool { return streamClients(stream) == 0 }, time.Second, 10*time.Millisecond,
+		"client unsubscribed on disconnect")
+}
+
+func TestServer_streamHandlerErrors(t *testing.T) {
+	stream := NewEventStream()
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Events: stream})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	tbl := []struct {
+		query  string
+		status int
+	}{
+		{query: "type=kick", status: http.StatusBadRequest},
+		{query: "type=spam,", status: http.StatusBadRequest},
+		{query: "chat=abc", status: http.StatusBadRequest},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/stream?" + tt.query)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("too many clients", func(t *testing.T) {
+		for i := 0; i < maxStreamClients; i++ {
+			require.True(t, stream.subscribe(&streamClient{}))
+		}
+		resp, err := http.Get(ts.URL + "/stream")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ts := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/stream")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestEventStream_NotifySlowClient(t *testing.T) {
+	stream := NewEventStream()
+	slow := &streamClient{events: make(chan streamEvent, 2)}
+	require.True(t, stream.subscribe(slow))
+	for i := 0; i < 5; i++ {
+		stream.Notify(webhook.Event{Type: webhook.EventSpam})
+	}
+	assert.Len(t, slow.events, 2)
+	assert.Equal(t, int64(3), slow.dropped.Load(), "events dropped, not blocked")
+
+	e := <-slow.events
+	assert.Equal(t, int64(1), e.id)
+	stream.unsubscribe(slow)
+	stream.Notify(webhook.Event{Type: webhook.EventSpam})
+	assert.Len(t, slow.events, 1, "no events after unsubscribe")
+}
+
+func TestEventStream_handlerDropped(t *testing.T) {
+	stream := NewEventStream()
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Events: stream})
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/stream", http.NoBody).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		server.streamHandler(rec, req)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return streamClients(stream) == 1 }, time.Second, 10*time.Millisecond)
+
+	// mark events as dropped as if the client was slow
+	stream.lock.Lock()
+	for c := range stream.clients {
+		c.dropped.Store(7)
+	}
+	stream.lock.Unlock()
+	stream.Notify(webhook.Event{Type: webhook.EventBan, UserID: 1})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "event: dropped\ndata: {\"dropped\":7}\n\n")
+	assert.Contains(t, body, "event: ban\n")
+	assert.Less(t, strings.Index(body, "event: dropped"), strings.Index(body, "event: ban"), "dropped reported first")
+}
+
+func streamClients(s *EventStream) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.clients)
+}
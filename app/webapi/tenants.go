@@ -0,0 +1,66 @@
+package webapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lgr"
+	"github.com/go-pkgz/rest"
+)
+
+// tenantsPath is the path prefix of servers of tenants, followed by the name of the tenant
+const tenantsPath = "/tenants/"
+
+// Tenants serves web servers of tenants of multi-tenant mode on one listen address, each one under /tenants/{name}
+// path, with its own auth, stores and settings. Servers are mounted as tenants start, requests of unknown tenants
+// are rejected with 404.
+type Tenants struct {
+	ListenAddr   string        // listen address
+	TLS          TLSConfig     // optional tls with certificate files or autocert, plain http if not set
+	ShutdownWait time.Duration // max time to finish in-flight requests on shutdown, 10s if not set
+
+	lock     sync.RWMutex
+	handlers map[string]http.Handler
+}
+
+// Mount serves the server of the tenant under /tenants/{name} path, the server mounted before is replaced
+func (t *Tenants) Mount(name string, s *Server) {
+	s.BasePath = tenantsPath + name
+	if s.AuthPasswd == "" && s.APIKeys == nil && s.JWT == nil {
+		log.Printf("[WARN] auth disabled, access to webapi of tenant %s is not protected", name)
+	}
+	handler := http.StripPrefix(s.BasePath, s.routes(s.middlewares(s.AuthPasswd)))
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.handlers == nil {
+		t.handlers = map[string]http.Handler{}
+	}
+	t.handlers[name] = handler
+	log.Printf("[INFO] webapi of tenant %s served at %s", name, s.BasePath)
+}
+
+// Run serves requests of tenants till the context is canceled, and waits for in-flight requests on shutdown
+func (t *Tenants) Run(ctx context.Context) error {
+	srv := &Server{Config: Config{TLS: t.TLS, ShutdownWait: t.ShutdownWait}}
+	handler := rest.Recoverer(lgr.Default())(rest.Ping(http.HandlerFunc(t.serveTenant)))
+	return srv.listen(ctx, srv.httpServer(ctx, t.ListenAddr, handler))
+}
+
+// serveTenant passes the request to the server of the tenant set by the path
+func (t *Tenants) serveTenant(w http.ResponseWriter, r *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, tenantsPath), "/")
+	t.lock.RLock()
+	handler, ok := t.handlers[name]
+	t.lock.RUnlock()
+	if !ok || !strings.HasPrefix(r.URL.Path, tenantsPath) {
+		w.WriteHeader(http.StatusNotFound)
+		rest.RenderJSON(w, rest.JSON{"error": "unknown tenant"})
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
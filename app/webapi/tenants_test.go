@@ -0,0 +1,77 @@
+package webapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestTenants_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := func(id string) *mocks.DetectorMock {
+		return &mocks.DetectorMock{ApprovedUsersFunc: func() []lib.ApprovedUser { return []lib.ApprovedUser{{UserID: id}} }}
+	}
+	tenants := &Tenants{ListenAddr: ":9884"}
+	tenants.Mount("one", NewServer(Config{SpamFilter: users("111"), AuthPasswd: "one-secret"}))
+	tenants.Mount("two", NewServer(Config{SpamFilter: users("222"), AuthPasswd: "two-secret",
+		Detections: &mocks.DetectionsStoreMock{
+			FindFunc: func(q storage.DetectionsQuery) ([]storage.DetectedSpamInfo, bool, error) {
+				return []storage.DetectedSpamInfo{{ID: 1, UserID: 10, Text: "spam"}}, true, nil
+			},
+		}}))
+	done := make(chan struct{})
+	go func() {
+		err := tenants.Run(ctx)
+		assert.NoError(t, err)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	get := func(path, passwd string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:9884"+path, http.NoBody)
+		require.NoError(t, err)
+		req.SetBasicAuth("tg-spam", passwd)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/tenants/one/users", "one-secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"111"`)
+	status, body = get("/tenants/two/users", "two-secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"222"`)
+
+	status, _ = get("/tenants/one/users", "two-secret")
+	assert.Equal(t, http.StatusForbidden, status, "password of another tenant")
+	status, _ = get("/tenants/three/users", "one-secret")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/users", "one-secret")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = get("/ping", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body = get("/tenants/two/ui/", "two-secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `<a href="/tenants/two/ui/samples"`, "links with path prefix")
+	assert.Contains(t, body, `<a href="/tenants/two/ui/users/10">`)
+	assert.Contains(t, body, `<a href="/tenants/two/ui/?cursor=1">older detections`)
+
+	cancel()
+	<-done
+}
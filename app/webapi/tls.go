@@ -0,0 +1,150 @@
+package webapi
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig defines tls of the server with certificate files, or with certificates issued by let's encrypt.
+// The server is plain http if not set.
+type TLSConfig struct {
+	CertFile string    // certificate file, with the full chain
+	KeyFile  string    // private key file
+	Autocert *Autocert // optional certificates issued and renewed by let's encrypt, used instead of files
+}
+
+// Autocert defines certificates issued and renewed automatically with acme, i.e. by let's encrypt.
+// Challenges are answered with tls-alpn-01 on the server itself, so it should be reachable on port 443,
+// and with http-01 if HTTPListen is set, reachable on port 80.
+type Autocert struct {
+	Domains      []string // domains certificates are issued for, requests for other names are rejected
+	Email        string   // optional contact email of acme account, for notifications about certificates
+	CacheDir     string   // directory to keep issued certificates and the account key
+	HTTPListen   string   // optional listen address of http-01 challenges, other requests redirected to https
+	DirectoryURL string   // optional url of acme directory, let's encrypt production if not set
+}
+
+// Enabled returns true if tls is set
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.Autocert != nil
+}
+
+// certCheckInterval is the min interval between checks of certificate files for changes
+const certCheckInterval = time.Minute
+
+// serve runs the server with tls if set, or with plain http otherwise
+func (s *Server) serve(ctx context.Context, srv *http.Server) error {
+	if !s.TLS.Enabled() {
+		log.Printf("[INFO] start webapi server on %s", srv.Addr)
+		return srv.ListenAndServe()
+	}
+	if s.TLS.Autocert != nil {
+		m := s.certManager(ctx)
+		srv.TLSConfig = m.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		log.Printf("[INFO] start webapi server on %s, tls with let's encrypt certificates for %v", srv.Addr, s.TLS.Autocert.Domains)
+		return srv.ListenAndServeTLS("", "")
+	}
+	certs := &certReloader{certFile: s.TLS.CertFile, keyFile: s.TLS.KeyFile}
+	if err := certs.load(); err != nil {
+		return err
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}
+	log.Printf("[INFO] start webapi server on %s, tls with certificate %s", srv.Addr, s.TLS.CertFile)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// certManager returns the manager of autocert certificates, made once for all apis of the server.
+// The listener of http-01 challenges is started with the manager, and stopped when the context is canceled.
+func (s *Server) certManager(ctx context.Context) *autocert.Manager {
+	s.acmeOnce.Do(func() {
+		ac := s.TLS.Autocert
+		s.acme = &autocert.Manager{Prompt: autocert.AcceptTOS, HostPolicy: autocert.HostWhitelist(ac.Domains...),
+			Cache: autocert.DirCache(ac.CacheDir), Email: ac.Email}
+		if ac.DirectoryURL != "" {
+			s.acme.Client = &acme.Client{DirectoryURL: ac.DirectoryURL}
+		}
+		if ac.HTTPListen == "" {
+			return
+		}
+		srv := &http.Server{Addr: ac.HTTPListen, Handler: s.acme.HTTPHandler(nil), ReadTimeout: 5 * time.Second,
+			WriteTimeout: 5 * time.Second}
+		go func() {
+			<-ctx.Done()
+			if err := srv.Close(); err != nil {
+				log.Printf("[WARN] failed to stop acme challenge server on %s: %v", srv.Addr, err)
+			}
+		}()
+		go func() {
+			log.Printf("[INFO] start acme challenge server on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("[WARN] acme challenge server on %s failed: %v", srv.Addr, err)
+			}
+		}()
+	})
+	return s.acme
+}
+
+// certReloader keeps the certificate loaded from files, and reloads it if files changed,
+// so certificates renewed by external tools, i.e. certbot, are picked up without restart
+type certReloader struct {
+	certFile, keyFile string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // modification time of the loaded certificate file
+	checked time.Time // time of the last check of files
+}
+
+// getCertificate returns the certificate for tls handshake, reloaded if files changed since the last check.
+// The loaded certificate is kept if reload failed, i.e. files are in the middle of update.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if time.Since(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+	fi, err := os.Stat(c.certFile)
+	if err != nil || fi.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+	if err = c.loadLocked(fi.ModTime()); err != nil {
+		log.Printf("[WARN] can't reload tls certificate, previous one is used, %v", err)
+		return c.cert, nil
+	}
+	log.Printf("[INFO] tls certificate %s reloaded", c.certFile)
+	return c.cert, nil
+}
+
+// load loads the certificate from files
+func (c *certReloader) load() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	fi, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	c.checked = time.Now()
+	return c.loadLocked(fi.ModTime())
+}
+
+// loadLocked loads the certificate from files, the lock must be held by the caller
+func (c *certReloader) loadLocked(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	c.cert, c.modTime = &cert, modTime
+	return nil
+}
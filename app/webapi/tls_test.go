@@ -0,0 +1,198 @@
+package webapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+)
+
+func TestServer_RunTLS(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM := writeTestCert(t, certFile, keyFile, "first")
+
+	srv := NewServer(Config{ListenAddr: ":9879", Version: "dev", SpamFilter: &mocks.DetectorMock{},
+		TLS: TLSConfig{CertFile: certFile, KeyFile: keyFile}})
+	done := make(chan struct{})
+	go func() {
+		err := srv.Run(ctx)
+		assert.NoError(t, err)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certPEM))
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}}
+	resp, err := client.Get("https://localhost:9879/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(body))
+
+	resp, err = http.Get("http://localhost:9879/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "plain http rejected")
+
+	cancel()
+	<-done
+}
+
+func TestServer_RunTLSNoCert(t *testing.T) {
+	srv := NewServer(Config{ListenAddr: ":9880", SpamFilter: &mocks.DetectorMock{},
+		TLS: TLSConfig{CertFile: "/no/such/cert.pem", KeyFile: "/no/such/key.pem"}})
+	err := srv.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load tls certificate")
+}
+
+func TestServer_RunAutocert(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// certificate issued before is kept in the cache dir, so it is served without requests to acme directory
+	cacheDir := t.TempDir()
+	certFile, keyFile := filepath.Join(t.TempDir(), "cert.pem"), filepath.Join(t.TempDir(), "key.pem")
+	certPEM := writeTestCert(t, certFile, keyFile, "issued", "spam.example.com")
+	keyPEM, err := os.ReadFile(keyFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "spam.example.com"), append(keyPEM, certPEM...), 0o600))
+
+	srv := NewServer(Config{ListenAddr: ":9881", Version: "dev", SpamFilter: &mocks.DetectorMock{},
+		TLS: TLSConfig{Autocert: &Autocert{Domains: []string{"spam.example.com"}, CacheDir: cacheDir,
+			HTTPListen: ":9882", DirectoryURL: "http://127.0.0.1:1/directory"}}})
+	done := make(chan struct{})
+	go func() {
+		err := srv.Run(ctx)
+		assert.NoError(t, err)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(certPEM))
+	dialer := &net.Dialer{}
+	client := http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, _ := net.SplitHostPort(addr)
+				return dialer.DialContext(ctx, network, "127.0.0.1:"+port) // domain resolved to the local server
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get("https://spam.example.com:9881/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(body))
+
+	_, err = client.Get("https://other.example.com:9881/ping")
+	require.Error(t, err, "no certificate for other domain")
+
+	resp, err = client.Get("http://spam.example.com:9882/ping")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode, "plain http redirected by challenge server")
+	assert.Equal(t, "https://spam.example.com:443/ping", resp.Header.Get("Location"))
+
+	cancel()
+	<-done
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	require.NoError(t, c.load())
+	cert, err := c.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", certSubject(t, cert))
+
+	// renewed certificate is not picked up till the next check
+	writeTestCert(t, certFile, keyFile, "second")
+	require.NoError(t, os.Chtimes(certFile, time.Now().Add(time.Hour), time.Now().Add(time.Hour)))
+	cert, err = c.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", certSubject(t, cert))
+
+	c.checked = time.Now().Add(-certCheckInterval)
+	cert, err = c.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", certSubject(t, cert), "reloaded")
+
+	// broken files are not loaded, the previous certificate is kept
+	require.NoError(t, os.WriteFile(keyFile, []byte("bad key"), 0o600))
+	require.NoError(t, os.Chtimes(certFile, time.Now().Add(2*time.Hour), time.Now().Add(2*time.Hour)))
+	c.checked = time.Now().Add(-certCheckInterval)
+	cert, err = c.getCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", certSubject(t, cert))
+}
+
+// writeTestCert writes self-signed certificate for the given hosts, localhost by default, with the given common name.
+// Returns certificate pem.
+func writeTestCert(t *testing.T, certFile, keyFile, name string, hosts ...string) []byte {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour), // not renewed by autocert
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPEM
+}
+
+func certSubject(t *testing.T, cert *tls.Certificate) string {
+	require.NotNil(t, cert)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
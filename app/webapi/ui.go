@@ -0,0 +1,461 @@
+package webapi
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/umputun/tg-spam/app/storage"
+)
+
+//go:embed assets/*.html
+var uiAssets embed.FS
+
+// uiTemplates are parsed page templates, each page is rendered with the common layout
+var uiTemplates = func() map[string]*template.Template {
+	res := map[string]*template.Template{}
+	for _, page := range []string{"dashboard", "samples", "jargon", "settings", "user"} {
+		res[page] = template.Must(template.ParseFS(uiAssets, "assets/layout.html", "assets/"+page+".html"))
+	}
+	return res
+}()
+
+const (
+	uiDetectionsLimit = 50 // number of recent detections on dashboard
+	uiStatsDays       = 14 // number of days in daily stats on dashboard
+	uiLiveEventsLimit = 50 // number of live events kept on dashboard
+)
+
+// uiPage is a data of web ui page, page specific fields are set by the page handler
+type uiPage struct {
+	Title   string
+	Version string
+	Base    string // path prefix of the server, i.e. /tenants/name in multi-tenant mode
+	Msg     string // flash message of the last action
+	Err     string // flash error of the last action
+
+	// dashboard
+	Report            *storage.StatsReport
+	Days              []uiDay
+	Detections        []storage.DetectedSpamInfo
+	DetectionsEnabled bool
+	DetectionsFilter  url.Values // query params of detections search, i.e. q and check
+	OlderDetections   string     // url of the next page of detections, empty on the last page
+	UnbanEnabled      bool
+	StreamEnabled     bool
+	LiveEventsLimit   int
+
+	// samples
+	Samples        []storage.Sample
+	SampleType     storage.SampleType
+	Origin         storage.SampleOrigin
+	SamplesEnabled bool
+
+	// jargon
+	Jargon         []uiJargonToken
+	JargonMessages int
+	JargonEnabled  bool
+
+	// settings
+	Settings      Settings
+	ApprovedUsers int
+
+	// user
+	UserID         int64
+	UserNotes      []storage.UserNote
+	UserDetections []storage.DetectedSpamInfo
+	NotesEnabled   bool
+}
+
+// uiDay is a day of daily stats with bar sizes in percents of the busiest day
+type uiDay struct {
+	Date                string
+	Checked, Spam       int
+	CheckedPct, SpamPct int
+}
+
+// uiJargonToken is a token suggested as excluded token, with the share of messages in percents
+type uiJargonToken struct {
+	Token    string
+	Messages int
+	Pct      string
+}
+
+// uiRoutes sets web ui routes. Actions are html form posts redirecting back to the page, no js needed.
+// The only script is the optional feed of live events on dashboard.
+func (s *Server) uiRoutes(r chi.Router) {
+	r.Use(sameOrigin)
+	r.Get("/", s.uiDashboardHandler)
+	r.Get("/samples", s.uiSamplesHandler)
+	r.Post("/samples", s.uiAddSampleHandler)
+	r.Get("/jargon", s.uiJargonHandler)
+	r.Get("/settings", s.uiSettingsHandler)
+	r.Get("/users/{id}", s.uiUserHandler)
+	if s.Notes != nil {
+		r.Post("/users/{id}/notes", s.uiAddNoteHandler)
+		r.Post("/users/{id}/notes/{note}/delete", s.uiDeleteNoteHandler)
+	}
+	if s.Jargon != nil && s.Dictionary != nil {
+		r.Post("/jargon/{token}/apply", s.uiApplyJargonHandler)
+		r.Post("/jargon/{token}/dismiss", s.uiDismissJargonHandler)
+	}
+	if s.Samples != nil {
+		r.Post("/samples/{id}/delete", s.uiDeleteSampleHandler)
+	}
+	if s.Detections != nil {
+		r.Post("/detections/{id}/ham", s.uiDetectionHamHandler)
+		r.Post("/detections/{id}/spam", s.uiDetectionSpamHandler)
+	}
+}
+
+// uiDashboardHandler handles GET /ui/ request. It shows stats and recent detections.
+func (s *Server) uiDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	page := s.newUIPage(r, "Dashboard")
+	if s.Stats != nil {
+		now := time.Now()
+		report, err := s.Stats.Report(now.Add(-24*time.Hour), now)
+		if err != nil {
+			page.Err = fmt.Sprintf("can't get stats, %v", err)
+		} else {
+			page.Report = &report
+		}
+		days, err := s.Stats.Daily(now.AddDate(0, 0, -uiStatsDays+1), now)
+		if err != nil {
+			page.Err = fmt.Sprintf("can't get daily stats, %v", err)
+		}
+		page.Days = makeUIDays(days)
+	}
+	if s.Detections != nil {
+		page.DetectionsEnabled, page.UnbanEnabled = true, s.Unban != nil
+		page.DetectionsFilter = r.URL.Query()
+		if err := s.uiDetections(r, &page); err != nil {
+			page.Err = err.Error()
+		}
+	}
+	page.StreamEnabled, page.LiveEventsLimit = s.Events != nil, uiLiveEventsLimit
+	s.renderUIPage(w, "dashboard", page)
+}
+
+// uiDetections sets the page of detections matching the search params of the dashboard, the same as GET /detections,
+// and the url of the next page
+func (s *Server) uiDetections(r *http.Request, page *uiPage) error {
+	q, err := detectionsQuery(r, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid search of detections, %w", err)
+	}
+	if r.URL.Query().Get("limit") == "" {
+		q.Limit = uiDetectionsLimit
+	}
+	detections, more, err := s.Detections.Find(q)
+	if err != nil {
+		return fmt.Errorf("can't read detections, %w", err)
+	}
+	page.Detections = detections
+	if more && len(detections) > 0 {
+		params := r.URL.Query()
+		params.Del("msg")
+		params.Del("err")
+		params.Set("cursor", strconv.FormatInt(detections[len(detections)-1].ID, 10))
+		page.OlderDetections = s.BasePath + "/ui/?" + params.Encode()
+	}
+	return nil
+}
+
+// uiDetectionHamHandler handles POST /ui/detections/{id}/ham request. It reverses the detection as false positive:
+// adds the message to ham samples, approves and unbans the user.
+func (s *Server) uiDetectionHamHandler(w http.ResponseWriter, r *http.Request) {
+	entry, err := s.uiDetection(r)
+	if err != nil {
+		s.uiRedirect(w, r, "/ui/", "", err)
+		return
+	}
+	if err = s.reverseDetection(entry, apiSource(r)); err != nil {
+		s.uiRedirect(w, r, "/ui/", "", err)
+		return
+	}
+	if s.Unban != nil {
+		if err = s.Unban(entry.ChatID, entry.UserID); err != nil {
+			s.uiRedirect(w, r, "/ui/", "", fmt.Errorf("user approved, but can't unban, %w", err))
+			return
+		}
+		s.audit(r, "unban", entry.ChatID, entry.UserID, fmt.Sprintf("detection %d reversed", entry.ID))
+	}
+	s.uiRedirect(w, r, "/ui/", fmt.Sprintf("user %d approved, message added to ham samples", entry.UserID), nil)
+}
+
+// uiDetectionSpamHandler handles POST /ui/detections/{id}/spam request. It adds the message to spam samples.
+func (s *Server) uiDetectionSpamHandler(w http.ResponseWriter, r *http.Request) {
+	entry, err := s.uiDetection(r)
+	if err != nil {
+		s.uiRedirect(w, r, "/ui/", "", err)
+		return
+	}
+	if err = s.SpamFilter.UpdateSpamFrom(entry.Text, apiSource(r)); err != nil {
+		s.uiRedirect(w, r, "/ui/", "", fmt.Errorf("can't update spam samples, %w", err))
+		return
+	}
+	s.uiRedirect(w, r, "/ui/", "message added to spam samples", nil)
+}
+
+// uiDetection returns the detection by id from the url
+func (s *Server) uiDetection(r *http.Request) (storage.DetectedSpamInfo, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return storage.DetectedSpamInfo{}, fmt.Errorf("invalid detection id, %w", err)
+	}
+	entry, err := s.Detections.Get(id)
+	if err != nil {
+		return storage.DetectedSpamInfo{}, fmt.Errorf("can't get detection, %w", err)
+	}
+	return entry, nil
+}
+
+// uiSamplesHandler handles GET /ui/samples?type=spam|ham&origin=user|preset|any request.
+// It shows the form to add samples and stored samples, if samples kept in the database.
+func (s *Server) uiSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	page := s.newUIPage(r, "Samples")
+	page.SampleType, page.Origin = uiSampleType(r.URL.Query().Get("type")), storage.SampleOrigin(r.URL.Query().Get("origin"))
+	if page.Origin != storage.SampleOriginPreset && page.Origin != storage.SampleOriginAny {
+		page.Origin = storage.SampleOriginUser
+	}
+	if s.Samples != nil {
+		page.SamplesEnabled = true
+		samples, err := s.Samples.Read(page.SampleType, page.Origin)
+		if err != nil {
+			page.Err = fmt.Sprintf("can't read samples, %v", err)
+		}
+		page.Samples = samples
+	}
+	s.renderUIPage(w, "samples", page)
+}
+
+// uiAddSampleHandler handles POST /ui/samples request. It adds the sample with the detector, as POST /update does.
+func (s *Server) uiAddSampleHandler(w http.ResponseWriter, r *http.Request) {
+	sampleType := uiSampleType(r.FormValue("type"))
+	backURL := "/ui/samples?type=" + string(sampleType)
+	updFn := s.SpamFilter.UpdateSpamFrom
+	if sampleType == storage.SampleTypeHam {
+		updFn = s.SpamFilter.UpdateHamFrom
+	}
+	if err := updFn(r.FormValue("msg"), apiSource(r)); err != nil {
+		s.uiRedirect(w, r, backURL, "", fmt.Errorf("can't add %s sample, %w", sampleType, err))
+		return
+	}
+	s.uiRedirect(w, r, backURL, fmt.Sprintf("%s sample added", sampleType), nil)
+}
+
+// uiDeleteSampleHandler handles POST /ui/samples/{id}/delete request. It removes the sample and reloads samples.
+func (s *Server) uiDeleteSampleHandler(w http.ResponseWriter, r *http.Request) {
+	backURL := "/ui/samples?" + url.Values{"type": {r.FormValue("type")}, "origin": {r.FormValue("origin")}}.Encode()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.uiRedirect(w, r, backURL, "", fmt.Errorf("invalid sample id, %w", err))
+		return
+	}
+	if err = s.Samples.Delete(id); err != nil {
+		s.uiRedirect(w, r, backURL, "", fmt.Errorf("can't delete sample, %w", err))
+		return
+	}
+	if err = s.reloadSamples(); err != nil {
+		s.uiRedirect(w, r, backURL, "", fmt.Errorf("sample deleted, but can't reload samples, %w", err))
+		return
+	}
+	s.uiRedirect(w, r, backURL, "sample deleted", nil)
+}
+
+// uiJargonHandler handles GET /ui/jargon request. It shows tokens used in many ham messages,
+// suggested as excluded tokens, to be applied or dismissed by admin.
+func (s *Server) uiJargonHandler(w http.ResponseWriter, r *http.Request) {
+	page := s.newUIPage(r, "Jargon")
+	if s.Jargon != nil && s.Dictionary != nil {
+		page.JargonEnabled = true
+		total, tokens, err := s.jargonSuggestions()
+		if err != nil {
+			page.Err = fmt.Sprintf("can't get suggestions, %v", err)
+		}
+		page.JargonMessages = total
+		for _, t := range tokens {
+			page.Jargon = append(page.Jargon, uiJargonToken{Token: t.Token, Messages: t.Messages,
+				Pct: fmt.Sprintf("%.1f%%", t.Share*100)})
+		}
+	}
+	s.renderUIPage(w, "jargon", page)
+}
+
+// uiApplyJargonHandler handles POST /ui/jargon/{token}/apply request. It adds the token to excluded tokens
+// and reloads samples.
+func (s *Server) uiApplyJargonHandler(w http.ResponseWriter, r *http.Request) {
+	token := jargonToken(r)
+	if err := s.applyJargon(token); err != nil {
+		s.uiRedirect(w, r, "/ui/jargon", "", err)
+		return
+	}
+	if err := s.reloadSamples(); err != nil {
+		s.uiRedirect(w, r, "/ui/jargon", "", fmt.Errorf("token excluded, but can't reload samples, %w", err))
+		return
+	}
+	s.uiRedirect(w, r, "/ui/jargon", fmt.Sprintf("%q added to excluded tokens", token), nil)
+}
+
+// uiDismissJargonHandler handles POST /ui/jargon/{token}/dismiss request. The token is not suggested anymore.
+func (s *Server) uiDismissJargonHandler(w http.ResponseWriter, r *http.Request) {
+	token := jargonToken(r)
+	if err := s.Jargon.SetStatus(token, storage.JargonStatusDismissed); err != nil {
+		s.uiRedirect(w, r, "/ui/jargon", "", fmt.Errorf("can't dismiss token, %w", err))
+		return
+	}
+	s.uiRedirect(w, r, "/ui/jargon", fmt.Sprintf("%q dismissed", token), nil)
+}
+
+// uiUserHandler handles GET /ui/users/{id} request. It shows notes of moderators about the user and detections
+// of the user, notes can be added and deleted.
+func (s *Server) uiUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || userID == 0 {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	page := s.newUIPage(r, fmt.Sprintf("User %d", userID))
+	page.UserID = userID
+	if s.Notes != nil {
+		page.NotesEnabled = true
+		if page.UserNotes, err = s.Notes.ByUser(userID, userHistoryLimit); err != nil {
+			page.Err = fmt.Sprintf("can't read notes, %v", err)
+		}
+	}
+	if s.Detections != nil {
+		page.DetectionsEnabled = true
+		if page.UserDetections, err = s.Detections.ReadByUser(userID, userHistoryLimit); err != nil {
+			page.Err = fmt.Sprintf("can't read detections, %v", err)
+		}
+	}
+	s.renderUIPage(w, "user", page)
+}
+
+// uiAddNoteHandler handles POST /ui/users/{id}/notes request. It adds a note about the user.
+func (s *Server) uiAddNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || userID == 0 {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+	backURL := fmt.Sprintf("/ui/users/%d", userID)
+	if _, err = s.addNote(r, userID, r.FormValue("text")); err != nil {
+		s.uiRedirect(w, r, backURL, "", fmt.Errorf("can't add note, %w", err))
+		return
+	}
+	s.uiRedirect(w, r, backURL, "note added", nil)
+}
+
+// uiDeleteNoteHandler handles POST /ui/users/{id}/notes/{note}/delete request. It removes the note about the user.
+func (s *Server) uiDeleteNoteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, noteID, err := noteParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	backURL := fmt.Sprintf("/ui/users/%d", userID)
+	if err = s.Notes.Delete(userID, noteID); err != nil {
+		s.uiRedirect(w, r, backURL, "", fmt.Errorf("can't delete note, %w", err))
+		return
+	}
+	log.Printf("[INFO] note %d of user %d deleted by %s", noteID, userID, actorFrom(r.Context()))
+	s.uiRedirect(w, r, backURL, "note deleted", nil)
+}
+
+// uiSettingsHandler handles GET /ui/settings request. It shows detector settings.
+func (s *Server) uiSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	page := s.newUIPage(r, "Settings")
+	page.Settings, page.ApprovedUsers = s.settings(), len(s.SpamFilter.ApprovedUsers())
+	s.renderUIPage(w, "settings", page)
+}
+
+// newUIPage makes page data with common fields, flash message and error are passed by redirect
+func (s *Server) newUIPage(r *http.Request, title string) uiPage {
+	return uiPage{Title: title, Version: s.Version, Base: s.BasePath, Msg: r.URL.Query().Get("msg"), Err: r.URL.Query().Get("err")}
+}
+
+// renderUIPage renders the page to buffer first, so rendering errors are reported with the proper status
+func (s *Server) renderUIPage(w http.ResponseWriter, name string, page uiPage) {
+	buf := bytes.Buffer{}
+	if err := uiTemplates[name].ExecuteTemplate(&buf, "layout", page); err != nil {
+		log.Printf("[WARN] failed to render %s page, %v", name, err)
+		http.Error(w, "can't render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+// uiRedirect redirects to the page of the server after the action, with the result shown as flash message
+func (s *Server) uiRedirect(w http.ResponseWriter, r *http.Request, path, msg string, err error) {
+	params := url.Values{}
+	if msg != "" {
+		params.Set("msg", msg)
+	}
+	if err != nil {
+		log.Printf("[WARN] web ui action %s failed, %v", r.URL.Path, err)
+		params.Set("err", err.Error())
+	}
+	sep := "?"
+	if u, perr := url.Parse(path); perr == nil && u.RawQuery != "" {
+		sep = "&"
+	}
+	if len(params) > 0 {
+		path += sep + params.Encode()
+	}
+	http.Redirect(w, r, s.BasePath+path, http.StatusSeeOther)
+}
+
+// uiSampleType returns sample type from the param, spam by default
+func uiSampleType(v string) storage.SampleType {
+	if storage.SampleType(v) == storage.SampleTypeHam {
+		return storage.SampleTypeHam
+	}
+	return storage.SampleTypeSpam
+}
+
+// makeUIDays makes daily stats with bar sizes relative to the busiest day
+func makeUIDays(reports []storage.StatsReport) []uiDay {
+	maxChecked := 0
+	for _, r := range reports {
+		maxChecked = max(maxChecked, r.Checked, r.Spam)
+	}
+	res := make([]uiDay, 0, len(reports))
+	for _, r := range reports {
+		day := uiDay{Date: r.From.Format("2006-01-02"), Checked: r.Checked, Spam: r.Spam}
+		if maxChecked > 0 {
+			day.CheckedPct, day.SpamPct = r.Checked*100/maxChecked, r.Spam*100/maxChecked
+		}
+		res = append(res, day)
+	}
+	return res
+}
+
+// sameOrigin rejects cross-site form posts. Browsers send cached basic auth credentials with them,
+// so a page from another site could act on behalf of the logged-in admin otherwise.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+				http.Error(w, "cross-site request rejected", http.StatusForbidden)
+				return
+			}
+			if origin := r.Header.Get("Origin"); origin != "" {
+				if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+					http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,284 @@
+package webapi
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/app/storage"
+	"github.com/umputun/tg-spam/app/webapi/mocks"
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestServer_uiDashboard(t *testing.T) {
+	detections := &mocks.DetectionsStoreMock{
+		FindFunc: func(q storage.DetectionsQuery) ([]storage.DetectedSpamInfo, bool, error) {
+			return []storage.DetectedSpamInfo{
+				{ID: 1, Timestamp: time.Now(), UserID: 10, UserName: "spammer", Text: "buy <b>crypto</b>", Action: "ban",
+					Checks: []lib.CheckResult{{Name: "stopword", Spam: true}, {Name: "emoji", Spam: false}}},
+				{ID: 2, Timestamp: time.Now(), UserID: 20, Text: "reversed one", Action: "ban",
+					Reversed: sql.NullTime{Time: time.Now(), Valid: true}},
+			}, q.Limit == 2, nil
+		},
+	}
+	stats := &mocks.StatsReporterMock{
+		ReportFunc: func(from, to time.Time) (storage.StatsReport, error) {
+			return storage.StatsReport{Checked: 1234, Spam: 56, ByCheck: map[string]int{"similarity": 7}}, nil
+		},
+		DailyFunc: func(from, to time.Time) ([]storage.StatsReport, error) {
+			return []storage.StatsReport{{From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Checked: 100, Spam: 10}}, nil
+		},
+	}
+
+	t.Run("full", func(t *testing.T) {
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Detections: detections, Stats: stats, Version: "v1.2.3",
+			Unban: func(chatID, userID int64) error { return nil }, Events: NewEventStream()})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+
+		body := uiGet(t, ts.URL+"/ui/?msg=done")
+		assert.Contains(t, body, "v1.2.3")
+		assert.Contains(t, body, `<div class="flash ok">done</div>`)
+		assert.Contains(t, body, "1234")
+		assert.Contains(t, body, "similarity: 7")
+		assert.Contains(t, body, "2024-05-01")
+		assert.Contains(t, body, "buy &lt;b&gt;crypto&lt;/b&gt;", "text escaped")
+		assert.Contains(t, body, "stopword<br>")
+		assert.NotContains(t, body, "emoji<br>", "not spam checks hidden")
+		assert.Contains(t, body, `action="/ui/detections/1/ham"`)
+		assert.NotContains(t, body, `action="/ui/detections/2/ham"`, "already reversed")
+		assert.Contains(t, body, "unban, not spam")
+		assert.Contains(t, body, "Live events")
+		assert.Contains(t, body, `new EventSource("/stream")`)
+		assert.Contains(t, body, `<form method="get" action="/ui/">`)
+		assert.NotContains(t, body, "older detections")
+		require.Len(t, detections.FindCalls(), 1)
+		assert.Equal(t, storage.DetectionsQuery{Limit: uiDetectionsLimit}, detections.FindCalls()[0].Q)
+		require.Len(t, stats.DailyCalls(), 1)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		detections.ResetCalls()
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Detections: detections})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+
+		body := uiGet(t, ts.URL+"/ui/?q=crypto&verdict=ham&limit=2")
+		assert.Contains(t, body, `name="q" value="crypto"`)
+		assert.Contains(t, body, `<option value="ham" selected>`)
+		assert.Contains(t, body, `<a href="/ui/?cursor=2&amp;limit=2&amp;q=crypto&amp;verdict=ham">older detections`)
+		require.Len(t, detections.FindCalls(), 1)
+		assert.Equal(t, storage.DetectionsQuery{Verdict: "ham", Search: "crypto", Limit: 2}, detections.FindCalls()[0].Q)
+
+		body = uiGet(t, ts.URL+"/ui/?verdict=maybe")
+		assert.Contains(t, body, "invalid search of detections, invalid verdict")
+	})
+
+	t.Run("no stores", func(t *testing.T) {
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+
+		body := uiGet(t, ts.URL+"/ui")
+		assert.Contains(t, body, "detections are not available")
+		assert.NotContains(t, body, "Last 24 hours")
+		assert.NotContains(t, body, "Live events")
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Detections: &mocks.DetectionsStoreMock{
+			FindFunc: func(q storage.DetectionsQuery) ([]storage.DetectedSpamInfo, bool, error) {
+				return nil, false, errors.New("db error")
+			},
+		}})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+
+		body := uiGet(t, ts.URL+"/ui/")
+		assert.Contains(t, body, "can&#39;t read detections, db error")
+	})
+}
+
+func TestServer_uiDetectionActions(t *testing.T) {
+	spamFilter := &mocks.DetectorMock{
+		UpdateHamFromFunc:    func(msg, source string) error { return nil },
+		UpdateSpamFromFunc:   func(msg, source string) error { return nil },
+		AddApprovedUsersFunc: func(ids ...string) {},
+	}
+	detections := &mocks.DetectionsStoreMock{
+		GetFunc: func(id int64) (storage.DetectedSpamInfo, error) {
+			if id != 1 {
+				return storage.DetectedSpamInfo{}, sql.ErrNoRows
+			}
+			return storage.DetectedSpamInfo{ID: 1, ChatID: 100, UserID: 10, Text: "not a spam"}, nil
+		},
+		SetReversedFunc: func(chatID, userID int64) (bool, error) { return true, nil },
+	}
+	var unbanned []int64
+	server := NewServer(Config{SpamFilter: spamFilter, Detections: detections,
+		Unban: func(chatID, userID int64) error { unbanned = append(unbanned, chatID, userID); return nil }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("ham", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/detections/1/ham", nil, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui/?msg=user+10+approved%2C+message+added+to+ham+samples", resp.Header.Get("Location"))
+		require.Len(t, spamFilter.UpdateHamFromCalls(), 1)
+		assert.Equal(t, "not a spam", spamFilter.UpdateHamFromCalls()[0].Msg)
+		require.Len(t, spamFilter.AddApprovedUsersCalls(), 1)
+		assert.Equal(t, []string{"10"}, spamFilter.AddApprovedUsersCalls()[0].Ids)
+		require.Len(t, detections.SetReversedCalls(), 1)
+		assert.Equal(t, int64(100), detections.SetReversedCalls()[0].ChatID)
+		assert.Equal(t, []int64{100, 10}, unbanned)
+	})
+
+	t.Run("spam", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/detections/1/spam", nil, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Location"), "msg=")
+		require.Len(t, spamFilter.UpdateSpamFromCalls(), 1)
+		assert.Equal(t, "not a spam", spamFilter.UpdateSpamFromCalls()[0].Msg)
+	})
+
+	t.Run("unknown detection", func(t *testing.T) {
+		spamFilter.ResetCalls()
+		resp := uiPost(t, ts.URL+"/ui/detections/2/ham", nil, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Location"), "err=can%27t+get+detection")
+		assert.Empty(t, spamFilter.UpdateHamFromCalls())
+	})
+
+	t.Run("cross-site post rejected", func(t *testing.T) {
+		spamFilter.ResetCalls()
+		resp := uiPost(t, ts.URL+"/ui/detections/1/spam", nil, map[string]string{"Origin": "https://evil.example.com"})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		resp = uiPost(t, ts.URL+"/ui/detections/1/spam", nil, map[string]string{"Sec-Fetch-Site": "cross-site"})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Empty(t, spamFilter.UpdateSpamFromCalls())
+
+		resp = uiPost(t, ts.URL+"/ui/detections/1/spam", nil, map[string]string{"Origin": ts.URL})
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode, "same origin allowed")
+	})
+}
+
+func TestServer_uiSamples(t *testing.T) {
+	spamFilter := &mocks.DetectorMock{
+		UpdateHamFromFunc:  func(msg, source string) error { return nil },
+		UpdateSpamFromFunc: func(msg, source string) error { return errors.New("spam error") },
+	}
+	samples := &mocks.SamplesStoreMock{
+		ReadFunc: func(t storage.SampleType, origin storage.SampleOrigin) ([]storage.Sample, error) {
+			return []storage.Sample{{ID: 5, Type: t, Origin: origin, Message: "sample message"}}, nil
+		},
+		DeleteFunc: func(id int64) error { return nil },
+	}
+	var reloads int
+	server := NewServer(Config{SpamFilter: spamFilter, Samples: samples, ReloadSamples: func() error { reloads++; return nil }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("list", func(t *testing.T) {
+		body := uiGet(t, ts.URL+"/ui/samples?type=ham")
+		assert.Contains(t, body, "sample message")
+		assert.Contains(t, body, `action="/ui/samples/5/delete"`)
+		require.Len(t, samples.ReadCalls(), 1)
+		assert.Equal(t, storage.SampleTypeHam, samples.ReadCalls()[0].T)
+		assert.Equal(t, storage.SampleOriginUser, samples.ReadCalls()[0].Origin, "user samples by default")
+	})
+
+	t.Run("add", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/samples", url.Values{"type": {"ham"}, "msg": {"good message"}}, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui/samples?type=ham&msg=ham+sample+added", resp.Header.Get("Location"))
+		require.Len(t, spamFilter.UpdateHamFromCalls(), 1)
+		assert.Equal(t, "good message", spamFilter.UpdateHamFromCalls()[0].Msg)
+	})
+
+	t.Run("add failed", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/samples", url.Values{"type": {"spam"}, "msg": {"bad message"}}, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Location"), "err=can%27t+add+spam+sample%2C+spam+error")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp := uiPost(t, ts.URL+"/ui/samples/5/delete", url.Values{"type": {"ham"}, "origin": {"any"}}, nil)
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui/samples?origin=any&type=ham&msg=sample+deleted", resp.Header.Get("Location"))
+		require.Len(t, samples.DeleteCalls(), 1)
+		assert.Equal(t, int64(5), samples.DeleteCalls()[0].ID)
+		assert.Equal(t, 1, reloads)
+	})
+
+	t.Run("files storage", func(t *testing.T) {
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: spamFilter}).routes(chi.NewRouter()))
+		defer srv.Close()
+		body := uiGet(t, srv.URL+"/ui/samples")
+		assert.Contains(t, body, "samples are kept in files")
+		assert.Contains(t, body, "add spam sample")
+	})
+}
+
+func TestServer_uiSettings(t *testing.T) {
+	spamFilter := &mocks.DetectorMock{
+		ApprovedUsersFunc: func() []lib.ApprovedUser { return []lib.ApprovedUser{{UserID: "1"}, {UserID: "2"}} },
+	}
+	server := NewServer(Config{SpamFilter: spamFilter, Settings: Settings{SimilarityThreshold: 0.75, SamplesStorage: "db"}})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	body := uiGet(t, ts.URL+"/ui/settings")
+	assert.Contains(t, body, "<td>0.75</td>")
+	assert.Contains(t, body, "<td>db</td>")
+	assert.Contains(t, body, "<td>approved users</td><td>2</td>")
+}
+
+func TestMakeUIDays(t *testing.T) {
+	days := makeUIDays([]storage.StatsReport{
+		{From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Checked: 50, Spam: 5},
+		{From: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), Checked: 200, Spam: 20},
+		{From: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	})
+	assert.Equal(t, []uiDay{
+		{Date: "2024-05-01", Checked: 50, Spam: 5, CheckedPct: 25, SpamPct: 2},
+		{Date: "2024-05-02", Checked: 200, Spam: 20, CheckedPct: 100, SpamPct: 10},
+		{Date: "2024-05-03"},
+	}, days)
+	assert.Empty(t, makeUIDays(nil))
+}
+
+func uiGet(t *testing.T, u string) string {
+	resp, err := http.Get(u)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+// uiPost posts the form without following redirect
+func uiPost(t *testing.T, u string, form url.Values, headers map[string]string) *http.Response {
+	req, err := http.NewRequest("POST", u, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
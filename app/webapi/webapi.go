@@ -4,132 +4,454 @@ package webapi
 import (
 	"context"
 	"crypto/rand"
-	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/didip/tollbooth/v7"
-	"github.com/didip/tollbooth_chi"
+	"github.com/didip/tollbooth/v7/limiter"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-pkgz/lgr"
 	"github.com/go-pkgz/rest"
+	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/lib"
+	"github.com/umputun/tg-spam/lib/server"
 )
 
 //go:generate moq --out mocks/spam_filter.go --pkg mocks --with-resets --skip-ensure . SpamFilter
+//go:generate moq --out mocks/samples_store.go --pkg mocks --with-resets --skip-ensure . SamplesStore
+//go:generate moq --out mocks/dictionary_store.go --pkg mocks --with-resets --skip-ensure . DictionaryStore
+//go:generate moq --out mocks/stats_reporter.go --pkg mocks --with-resets --skip-ensure . StatsReporter
+//go:generate moq --out mocks/detections_store.go --pkg mocks --with-resets --skip-ensure . DetectionsStore
+//go:generate moq --out mocks/api_keys_store.go --pkg mocks --with-resets --skip-ensure . APIKeysStore
+//go:generate moq --out mocks/moderation_audit_store.go --pkg mocks --with-resets --skip-ensure . ModerationAuditStore
+//go:generate moq --out mocks/messages_locator.go --pkg mocks --with-resets --skip-ensure . MessagesLocator
+//go:generate moq --out mocks/denylist_store.go --pkg mocks --with-resets --skip-ensure . DenylistStore
+//go:generate moq --out mocks/jargon_store.go --pkg mocks --with-resets --skip-ensure . JargonStore
+//go:generate moq --out mocks/notes_store.go --pkg mocks --with-resets --skip-ensure . NotesStore
+//go:generate moq --out mocks/allowed_channels_store.go --pkg mocks --with-resets --skip-ensure . AllowedChannelsStore
 
 // Server is a web API server.
 type Server struct {
 	Config
+	settingsLock sync.RWMutex     // guards Settings, changed by PUT /settings
+	keyLimiter   *limiter.Limiter // rate limiter of requests with api keys and jwt, nil if unlimited
+	lockout      *authLockout     // lockout of ips after auth failures, nil if disabled
+	accessLock   sync.Mutex       // guards writes to access log shared by all apis, so lines are not interleaved
+	acmeOnce     sync.Once        // makes acme manager of autocert once for all apis
+	acme         *autocert.Manager
 }
 
 // Config defines  server parameters
 type Config struct {
-	Version    string     // version to show in /ping
-	ListenAddr string     // listen address
-	SpamFilter SpamFilter // spam detector
-	AuthPasswd string     // basic auth password for user "tg-spam"
-	Dbg        bool       // debug mode
+	Version        string                                                                     // version to show in /ping and /version
+	BuildDate      string                                                                     // optional build date to show in /version
+	ListenAddr     string                                                                     // listen address
+	BasePath       string                                                                     // path prefix the server is served under, i.e. /tenants/name, set by Tenants.Mount
+	CheckAPI       CheckAPI                                                                   // optional separate check api with its own listen address and password
+	TLS            TLSConfig                                                                  // optional tls with certificate files or autocert, plain http if not set
+	SpamFilter     SpamFilter                                                                 // spam detector
+	AuthPasswd     string                                                                     // basic auth password for user "tg-spam", empty disables basic auth
+	APIKeys        APIKeysStore                                                               // optional api keys for auth and /keys endpoints, nil disables them
+	JWT            *JWT                                                                       // optional jwt auth with tokens of external issuer, nil disables it
+	HealthCheck    func() error                                                               // optional health check reported by GET /health, nil means always healthy
+	ReadyChecks    map[string]func(ctx context.Context) error                                 // optional named readiness checks reported by GET /readyz
+	Backup         func(w io.Writer) error                                                    // optional backup archive writer for GET /backup, nil disables the endpoint
+	Samples        SamplesStore                                                               // optional samples store for /samples endpoints, nil disables them
+	Dictionary     DictionaryStore                                                            // optional dictionary store for /stopwords endpoints, nil disables them
+	ReloadSamples  func() error                                                               // optional reload of samples for POST /reload, also called on changes of stores
+	Reload         func() error                                                               // optional full reload of configuration for POST /reload, replaces reload of samples
+	Settings       Settings                                                                   // detector settings reported by GET /settings
+	UpdateSettings func(RuntimeSettings) (RuntimeSettings, error)                             // optional apply and persist of settings changed by PUT /settings, returns applied ones, nil disables it
+	Schedule       *Schedule                                                                  // optional rules of scheduled settings for /settings/schedule endpoints, nil disables them
+	Stats          StatsReporter                                                              // optional stats for /stats endpoints, nil disables them
+	Detections     DetectionsStore                                                            // optional detections audit for web ui, nil hides detections
+	Locator        MessagesLocator                                                            // optional locator of recent messages of users, nil if no telegram
+	Unban          func(chatID, userID int64) error                                           // optional unban of the user by web ui and api, nil if no telegram
+	Ban            func(chatID, userID int64, d time.Duration) error                          // optional ban of the user by api, nil if no telegram
+	Purge          func(chatID, userID int64, train bool, source string) (PurgeResult, error) // optional purge of recent messages of the user, nil if no telegram
+	Audit          ModerationAuditStore                                                       // optional audit of moderation actions and settings changes, nil disables it
+	Notes          NotesStore                                                                 // optional notes of moderators about users, nil disables them
+	Channels       AllowedChannelsStore                                                       // optional channels allowed to post without checks for /channels endpoints, nil disables them
+	Events         *EventStream                                                               // optional live feed of moderation events for GET /stream, nil disables it
+	Denylist       DenylistStore                                                              // optional denylist shared with peer instances by GET /denylist, nil disables it
+	Jargon         JargonStore                                                                // optional counts of tokens of ham messages for /jargon endpoints, needs Dictionary
+	JargonParams   JargonParams                                                               // thresholds of tokens suggested as excluded tokens
+	BatchWorkers   int                                                                        // max number of concurrent checks of POST /check/batch, 4 if not set
+	Limits         Limits                                                                     // rate and size limits of requests, defaults used if not set
+	AccessLog      io.Writer                                                                  // optional access log, json line per request, nil disables it
+	TrustedProxies TrustedProxies                                                             // reverse proxies trusted to set forwarded headers, none if not set
+	CORSOrigins    []string                                                                   // origins allowed for cross-origin requests, "*" for any, disabled if not set
+	ShutdownWait   time.Duration                                                              // max time to finish in-flight requests on shutdown, 10s if not set
+	Dbg            bool                                                                       // debug mode
+}
+
+// Settings is a set of detector settings reported by GET /settings
+type Settings struct {
+	SimilarityThreshold float64 `json:"similarity_threshold"`
+	MinMsgLen           int     `json:"min_msg_len"`
+	MaxEmoji            int     `json:"max_emoji"`
+	MinSpamProbability  float64 `json:"min_spam_probability"`
+	FirstMessageOnly    bool    `json:"first_message_only"`
+	FirstMessagesCount  int     `json:"first_messages_count"`
+	CasEnabled          bool    `json:"cas_enabled"`
+	LolsEnabled         bool    `json:"lols_enabled"`
+	OpenAIEnabled       bool    `json:"openai_enabled"`
+	OpenAIVeto          bool    `json:"openai_veto"`
+	OpenAIPolicy        string  `json:"openai_policy"`
+	SamplesStorage      string  `json:"samples_storage"`
+	ShadowEnabled       bool    `json:"shadow_enabled"`
+	Dry                 bool    `json:"dry"`
+	Training            bool    `json:"training"`
+	SpamMsg             string  `json:"spam_msg"`
+	SpamDryMsg          string  `json:"spam_dry_msg"`
 }
 
 // SpamFilter is a spam detector interface.
 type SpamFilter interface {
 	Check(msg string, userID string) (spam bool, cr []lib.CheckResult)
-	UpdateSpam(msg string) error
-	UpdateHam(msg string) error
+	CheckLocal(msg string, userID string) (spam bool, cr []lib.CheckResult)
+	UpdateSpamFrom(msg, source string) error
+	UpdateHamFrom(msg, source string) error
 	AddApprovedUsers(ids ...string)
+	AddApprovedUser(user lib.ApprovedUser)
 	RemoveApprovedUsers(ids ...string)
-	ApprovedUsers() (res []string)
+	ApprovedUsers() (res []lib.ApprovedUser)
+}
+
+// SamplesStore is a storage of spam and ham samples
+type SamplesStore interface {
+	Read(t storage.SampleType, origin storage.SampleOrigin) ([]storage.Sample, error)
+	Delete(id int64) error
+	Import(t storage.SampleType, origin storage.SampleOrigin, source string, r io.Reader, withCleanup bool) (count int, err error)
+	ReadBySource(source string, since time.Time) ([]storage.Sample, error)
+	DeleteBySource(source string, since time.Time) (int, error)
+}
+
+// DictionaryStore is a storage of stop-words
+type DictionaryStore interface {
+	Add(t storage.DictionaryType, data string) error
+	Delete(id int64) error
+	Read(t storage.DictionaryType) ([]storage.DictionaryEntry, error)
+}
+
+// StatsReporter reports stats of checks and detections for a time range
+type StatsReporter interface {
+	Report(from, to time.Time) (storage.StatsReport, error)
+	Daily(from, to time.Time) ([]storage.StatsReport, error)
+}
+
+// APIKeysStore is a storage of api keys with usage audit
+type APIKeysStore interface {
+	Add(name string, scope storage.APIKeyScope) (key string, err error)
+	Find(key string) (storage.APIKey, error)
+	List() ([]storage.APIKey, error)
+	Delete(id int64) error
+	Used(id int64, method, path string, status int) error
+	Usage(id int64, limit int) ([]storage.APIKeyUsage, error)
+}
+
+// ModerationAuditStore is a storage of moderation actions made with webapi, the bot and admins
+type ModerationAuditStore interface {
+	Add(action storage.ModerationAction) error
+	Read(q storage.AuditQuery) ([]storage.ModerationAction, error)
+	ReadByUser(userID int64, limit int) ([]storage.ModerationAction, error)
+}
+
+// NotesStore is a storage of notes of moderators about users
+type NotesStore interface {
+	Add(note storage.UserNote) (storage.UserNote, error)
+	ByUser(userID int64, limit int) ([]storage.UserNote, error)
+	Delete(userID, id int64) error
+}
+
+// AllowedChannelsStore is a storage of channels allowed to post in the group on their behalf, without checks
+type AllowedChannelsStore interface {
+	Add(ch storage.AllowedChannel) error
+	Remove(chatID int64) error
+	List() ([]storage.AllowedChannel, error)
 }
 
+// DetectionsStore is a storage of detected spam
+type DetectionsStore interface {
+	ReadByUser(userID int64, limit int) ([]storage.DetectedSpamInfo, error)
+	Get(id int64) (storage.DetectedSpamInfo, error)
+	SetReversed(chatID, userID int64) (bool, error)
+	Bans(q storage.BansQuery) ([]storage.DetectedSpamInfo, error)
+	Find(q storage.DetectionsQuery) (res []storage.DetectedSpamInfo, more bool, err error)
+}
+
+// MessagesLocator locates recent messages of users, only metadata of messages is stored
+type MessagesLocator interface {
+	UserMessages(userID int64, limit int) ([]storage.MsgMeta, error)
+}
+
+// JargonStore keeps counts of tokens of ham messages, frequent tokens are suggested as excluded tokens
+type JargonStore interface {
+	Suggestions(minShare float64, minMessages, limit int) (total int, res []storage.JargonToken, err error)
+	SetStatus(token string, status storage.JargonStatus) error
+}
+
+// DenylistStore is a denylist of confirmed spammers, local entries are exported to peer instances
+type DenylistStore interface {
+	Local(since time.Time, limit int) ([]storage.DenylistEntry, error)
+}
+
+const (
+	maxStatsDays = 366 // max time range of daily stats
+
+	readyCheckTimeout   = 5 * time.Second  // timeout of all readiness checks of GET /readyz
+	defaultShutdownWait = 10 * time.Second // default max time to finish in-flight requests on shutdown
+)
+
 // NewServer creates a new web API server.
 func NewServer(config Config) *Server {
-	return &Server{Config: config}
+	return &Server{Config: config, keyLimiter: config.Limits.keyLimiter(), lockout: newAuthLockout(config.Limits)}
 }
 
 // Run starts server and accepts requests checking for spam messages.
+// If the check api is enabled, it is started on its own listen address as well, and Run returns
+// when both servers are stopped. A failure of either server stops the other one.
 func (s *Server) Run(ctx context.Context) error {
-	router := chi.NewRouter()
-	router.Use(rest.Recoverer(lgr.Default()))
-	router.Use(middleware.Throttle(1000), middleware.Timeout(60*time.Second))
-	router.Use(rest.AppInfo("tg-spam", "umputun", s.Version), rest.Ping)
-	router.Use(tollbooth_chi.LimitHandler(tollbooth.NewLimiter(50, nil)))
-	router.Use(rest.SizeLimit(1024 * 1024)) // 1M max request size
-
-	if s.AuthPasswd != "" {
-		log.Printf("[INFO] basic auth enabled for webapi server")
-		router.Use(rest.BasicAuth(func(user, passwd string) bool {
-			return subtle.ConstantTimeCompare([]byte(user), []byte("tg-spam")) == 1 &&
-				subtle.ConstantTimeCompare([]byte(passwd), []byte(s.AuthPasswd)) == 1
-		}))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if s.AuthPasswd != "" || s.APIKeys != nil || s.JWT != nil {
+		log.Printf("[INFO] auth enabled for webapi server, basic auth: %v, api keys: %v, jwt: %v",
+			s.AuthPasswd != "", s.APIKeys != nil, s.JWT != nil)
 	} else {
-		log.Printf("[WARN] basic auth disabled, access to webapi is not protected")
+		log.Printf("[WARN] auth disabled, access to webapi is not protected")
 	}
+	router := s.middlewares(s.AuthPasswd)
+	servers := []*http.Server{s.httpServer(ctx, s.ListenAddr, s.routes(router))}
 
-	router = s.routes(router) // setup routes
+	if s.CheckAPI.Enabled() {
+		if s.CheckAPI.AuthPasswd == "" && s.APIKeys == nil && s.JWT == nil {
+			log.Printf("[WARN] auth disabled, access to check api is not protected")
+		}
+		servers = append(servers, s.httpServer(ctx, s.CheckAPI.ListenAddr, s.checkRoutes(s.middlewares(s.CheckAPI.AuthPasswd))))
+	}
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) { errs <- s.listen(ctx, srv) }(srv)
+	}
+	var err error
+	for range servers {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+			cancel() // stop other servers
+		}
+	}
+	return err
+}
 
-	srv := &http.Server{Addr: s.ListenAddr, Handler: router, ReadTimeout: 5 * time.Second, WriteTimeout: 5 * time.Second}
+// middlewares makes a router with middlewares common for all apis, with auth by the given basic auth password
+func (s *Server) middlewares(authPasswd string) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(rest.Recoverer(lgr.Default()))
+	router.Use(middleware.Throttle(1000), requestTimeout)
+	router.Use(rest.AppInfo("tg-spam", "umputun", s.Version), rest.Ping, s.health) // no auth on ping and health
+	router.Use(s.accessLog)                                                        // probes and version not logged
+	router.Use(s.cors, s.limitByIP)
+	router.Use(rest.SizeLimit(s.Limits.maxBodySize()))
+	router.Use(func(next http.Handler) http.Handler { return s.authWithPasswd(authPasswd, next) }, s.limitByKey)
+	return router
+}
+
+// httpServer makes http server for the given address and handler
+func (s *Server) httpServer(ctx context.Context, addr string, handler http.Handler) *http.Server {
+	return &http.Server{Addr: addr, Handler: handler, ReadTimeout: 5 * time.Second, WriteTimeout: 60 * time.Second,
+		BaseContext: func(net.Listener) context.Context { return ctx }} // requests, i.e. streams, canceled on shutdown
+}
+
+// listen runs the server till the context is canceled, and waits for in-flight requests on shutdown
+func (s *Server) listen(ctx context.Context, srv *http.Server) error {
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-ctx.Done()
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("[WARN] failed to shutdown webapi server: %v", err)
+		// in-flight requests are finished, up to ShutdownWait, as ctx is already canceled
+		wait := s.ShutdownWait
+		if wait == 0 {
+			wait = defaultShutdownWait
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), wait)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("[WARN] failed to shutdown webapi server on %s: %v", srv.Addr, err)
 		} else {
-			log.Printf("[INFO] webapi server stopped")
+			log.Printf("[INFO] webapi server on %s stopped", srv.Addr)
 		}
 	}()
 
-	log.Printf("[INFO] start webapi server on %s", s.ListenAddr)
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return fmt.Errorf("failed to run server: %w", err)
+	if err := s.serve(ctx, srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to run server on %s: %w", srv.Addr, err)
 	}
+	<-stopped // serve returns on start of shutdown, before in-flight requests are finished
 	return nil
 }
 
 func (s *Server) routes(router *chi.Mux) *chi.Mux {
-	router.Post("/check", s.checkHandler) // check a message for spam
+	router.Post("/check", s.checkHandler)            // check a message for spam
+	router.Post("/check/batch", s.checkBatchHandler) // check a list of messages for spam
 
 	router.Route("/update", func(r chi.Router) { // update spam/ham samples
-		r.Post("/spam", s.updateSampleHandler(s.SpamFilter.UpdateSpam)) // update spam samples
-		r.Post("/ham", s.updateSampleHandler(s.SpamFilter.UpdateHam))   // update ham samples
+		r.Post("/spam", s.updateSampleHandler(s.SpamFilter.UpdateSpamFrom)) // update spam samples
+		r.Post("/ham", s.updateSampleHandler(s.SpamFilter.UpdateHamFrom))   // update ham samples
 	})
 
 	router.Route("/users", func(r chi.Router) { // manage approved users
 		r.Post("/", s.updateApprovedUsersHandler(s.SpamFilter.AddApprovedUsers))      // add user to the approved list
 		r.Delete("/", s.updateApprovedUsersHandler(s.SpamFilter.RemoveApprovedUsers)) // remove user from approved list
 		r.Get("/", s.getApprovedUsersHandler)                                         // get approved users
+		r.Get("/export", s.exportApprovedUsersHandler)                                // export approved users to a file
+		r.Post("/import", s.importApprovedUsersHandler)                               // import approved users from a file
+		r.Get("/{id}", s.userHistoryHandler)                                          // get moderation history of user
+		if s.Ban != nil {
+			r.Post("/{id}/ban", s.banUserHandler) // ban user in telegram
+		}
+		if s.Unban != nil {
+			r.Post("/{id}/unban", s.unbanUserHandler) // unban user in telegram
+			if s.Detections != nil {
+				r.Post("/unban", s.bulkUnbanHandler) // unban all users banned in time range or by check
+			}
+		}
+		if s.Purge != nil {
+			r.Post("/{id}/purge", s.purgeUserHandler) // delete recent messages of user in telegram
+		}
+		if s.Notes != nil {
+			r.Post("/{id}/notes", s.addNoteHandler)             // add note about user
+			r.Delete("/{id}/notes/{note}", s.deleteNoteHandler) // remove note about user
+		}
 	})
+
+	if s.Detections != nil {
+		router.Get("/detections", s.detectionsHandler) // search detections with cursor pagination
+	}
+
+	if s.Audit != nil {
+		router.Get("/audit", s.auditHandler) // get audit of moderation actions
+	}
+
+	if s.Channels != nil {
+		router.Route("/channels", func(r chi.Router) { // manage channels allowed to post without checks
+			r.Get("/", s.getChannelsHandler)         // get allowed channels
+			r.Post("/", s.allowChannelHandler)       // allow channel
+			r.Delete("/{id}", s.blockChannelHandler) // remove channel from allowed ones
+		})
+	}
+
+	if s.Samples != nil {
+		router.Route("/samples", func(r chi.Router) { // manage stored samples
+			r.Get("/", s.getSamplesHandler)                                  // get samples of the given type
+			r.Delete("/", s.revertSamplesHandler)                            // remove samples added by the source
+			r.Delete("/{id}", s.deleteSampleHandler)                         // remove sample by id
+			r.Get("/spam", s.downloadSamplesHandler(storage.SampleTypeSpam)) // download spam samples
+			r.Get("/ham", s.downloadSamplesHandler(storage.SampleTypeHam))   // download ham samples
+			r.Put("/spam", s.uploadSamplesHandler(storage.SampleTypeSpam))   // replace or append spam samples
+			r.Put("/ham", s.uploadSamplesHandler(storage.SampleTypeHam))     // replace or append ham samples
+		})
+	}
+
+	if s.Dictionary != nil {
+		router.Route("/stopwords", func(r chi.Router) { // manage stop-words
+			r.Get("/", s.getStopWordsHandler)          // get stop-words
+			r.Post("/", s.addStopWordHandler)          // add stop-word
+			r.Delete("/{id}", s.deleteStopWordHandler) // remove stop-word by id
+		})
+	}
+
+	if s.Jargon != nil && s.Dictionary != nil {
+		router.Route("/jargon", func(r chi.Router) { // review tokens suggested as excluded tokens
+			r.Get("/", s.jargonHandler)                        // get suggested tokens
+			r.Post("/{token}/apply", s.applyJargonHandler)     // add token to excluded tokens
+			r.Post("/{token}/dismiss", s.dismissJargonHandler) // don't suggest token anymore
+		})
+	}
+
+	if s.ReloadSamples != nil || s.Reload != nil {
+		router.Post("/reload", s.reloadHandler) // reload configuration, or samples and stop-words only
+	}
+
+	router.Get("/settings", s.settingsHandler) // get detector settings
+	if s.UpdateSettings != nil {
+		router.Put("/settings", s.updateSettingsHandler) // change runtime settings
+	}
+	if s.Schedule != nil {
+		router.Get("/settings/schedule", s.scheduleHandler)       // get rules of scheduled settings
+		router.Put("/settings/schedule", s.updateScheduleHandler) // replace rules of scheduled settings set with api
+	}
+
+	if s.Stats != nil {
+		router.Route("/stats", func(r chi.Router) { // stats of checks and detections
+			r.Get("/", s.statsHandler)           // get stats summary for the time range
+			r.Get("/daily", s.dailyStatsHandler) // get stats for each day of the time range
+		})
+	}
+
+	if s.Stats != nil {
+		router.Route("/metrics", func(r chi.Router) { // prometheus metrics of stats
+			r.Get("/", s.metricsHandler)            // get stats of the last hour and day in prometheus format
+			r.Get("/dashboard", s.dashboardHandler) // get grafana dashboard of metrics
+			r.Get("/alerts", s.alertsHandler)       // get example prometheus alerting rules of metrics
+		})
+	}
+
+	if s.APIKeys != nil {
+		router.Route("/keys", func(r chi.Router) { // manage api keys
+			r.Get("/", s.getKeysHandler)            // get api keys
+			r.Post("/", s.addKeyHandler)            // add api key, returns the key
+			r.Delete("/{id}", s.deleteKeyHandler)   // remove api key by id
+			r.Get("/{id}/usage", s.keyUsageHandler) // get usage audit of api key
+		})
+	}
+
+	if s.Events != nil {
+		router.Get(streamPath, s.streamHandler) // live feed of moderation events
+	}
+
+	if s.Backup != nil {
+		router.Get("/backup", s.backupHandler) // download backup archive of dynamic data
+	}
+
+	if s.Denylist != nil {
+		router.Get("/denylist", s.denylistHandler) // feed of local denylist entries for peer instances
+	}
+
+	router.Route("/ui", s.uiRoutes) // web ui
 	return router
 }
 
-// checkHandler handles POST /check request.
+// checkHandler handles POST /check request, served by the check api of the library.
 // it gets message text and user id from request body and returns spam status and check results.
 func (s *Server) checkHandler(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Msg    string `json:"msg"`
-		UserID string `json:"user_id"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
-		return
-	}
+	server.New(s.SpamFilter, server.Config{BatchWorkers: s.BatchWorkers}).CheckHandler(w, r)
+}
 
-	spam, cr := s.SpamFilter.Check(req.Msg, req.UserID)
-	rest.RenderJSON(w, rest.JSON{"spam": spam, "checks": cr})
+// checkBatchHandler handles POST /check/batch request, served by the check api of the library.
+// it gets a list of messages with user ids and returns spam status and check results for each message, in the same order.
+// Messages are checked concurrently, up to BatchWorkers at a time. With skip_network set, CAS and OpenAI checks are skipped,
+// which makes re-scanning of large histories fast and free.
+func (s *Server) checkBatchHandler(w http.ResponseWriter, r *http.Request) {
+	server.New(s.SpamFilter, server.Config{BatchWorkers: s.BatchWorkers}).CheckBatchHandler(w, r)
 }
 
 // updateSampleHandler handles POST /update/spam and /update/ham requests.
 // it gets message text from request body and updates spam or ham dynamic samples.
-func (s *Server) updateSampleHandler(updFn func(msg string) error) func(w http.ResponseWriter, r *http.Request) {
+func (s *Server) updateSampleHandler(updFn func(msg, source string) error) func(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Msg string `json:"msg"`
 	}
@@ -141,7 +463,7 @@ func (s *Server) updateSampleHandler(updFn func(msg string) error) func(w http.R
 			return
 		}
 
-		err := updFn(req.Msg)
+		err := updFn(req.Msg, apiSource(r))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			rest.RenderJSON(w, rest.JSON{"error": "can't update samples", "details": err.Error()})
@@ -169,9 +491,428 @@ func (s *Server) updateApprovedUsersHandler(updFn func(ids ...string)) func(w ht
 	}
 }
 
-// getApprovedUsersHandler handles GET /users request. It returns list of approved users.
+// health middleware responds to GET /health, /healthz, /readyz and /version requests before auth middleware,
+// so probes don't need credentials.
+func (s *Server) health(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch strings.ToLower(r.URL.Path) {
+		case "/health":
+			s.healthHandler(w, r)
+		case "/healthz":
+			rest.RenderJSON(w, rest.JSON{"status": "ok"}) // liveness, the server is up and serving
+		case "/readyz":
+			s.readyHandler(w, r)
+		case "/version":
+			s.versionHandler(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// healthHandler handles GET /health request. It returns 503 if the health check failed, i.e. bot lost its permissions.
+func (s *Server) healthHandler(w http.ResponseWriter, _ *http.Request) {
+	if s.HealthCheck != nil {
+		if err := s.HealthCheck(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			rest.RenderJSON(w, rest.JSON{"status": "failed", "error": err.Error()})
+			return
+		}
+	}
+	rest.RenderJSON(w, rest.JSON{"status": "ok"})
+}
+
+// readyHandler handles GET /readyz request. It runs all readiness checks, i.e. telegram, database and samples,
+// and returns 503 if any of them failed. The response has the result of each check.
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+	status, checks := "ok", make(map[string]string, len(s.ReadyChecks))
+	for name, check := range s.ReadyChecks {
+		checks[name] = "ok"
+		if err := check(ctx); err != nil {
+			status, checks[name] = "failed", err.Error()
+		}
+	}
+	if status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	rest.RenderJSON(w, rest.JSON{"status": status, "checks": checks})
+}
+
+// versionHandler handles GET /version request. It returns build info.
+func (s *Server) versionHandler(w http.ResponseWriter, _ *http.Request) {
+	rest.RenderJSON(w, rest.JSON{"version": s.Version, "build_date": s.BuildDate, "go_version": runtime.Version()})
+}
+
+// backupHandler handles GET /backup request. It streams backup archive (tar.gz) of all dynamic data.
+func (s *Server) backupHandler(w http.ResponseWriter, _ *http.Request) {
+	// backup can take longer than server's write timeout for a large database
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+		log.Printf("[DEBUG] can't extend write deadline for backup, %v", err)
+	}
+	fileName := fmt.Sprintf("tg-spam-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	cw := &countingWriter{w: w}
+	if err := s.Backup(cw); err != nil {
+		log.Printf("[WARN] failed to make backup, %v", err)
+		if cw.n == 0 { // nothing sent yet, so the error can be reported to the client
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Header().Del("Content-Disposition")
+			w.WriteHeader(http.StatusInternalServerError)
+			rest.RenderJSON(w, rest.JSON{"error": "can't make backup", "details": err.Error()})
+		}
+	}
+}
+
+// countingWriter counts bytes written to the underlying writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// getApprovedUsersHandler handles GET /users request. It returns list of approved users ids and users with metadata.
 func (s *Server) getApprovedUsersHandler(w http.ResponseWriter, _ *http.Request) {
-	rest.RenderJSON(w, rest.JSON{"user_ids": s.SpamFilter.ApprovedUsers()})
+	users := s.SpamFilter.ApprovedUsers()
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.UserID
+	}
+	rest.RenderJSON(w, rest.JSON{"user_ids": ids, "users": users})
+}
+
+// exportApprovedUsersHandler handles GET /users/export?format=csv|json|txt request. It returns approved users
+// with metadata as a file, json by default, txt is a list of ids.
+func (s *Server) exportApprovedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := usersFormat(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid format", "details": err.Error()})
+		return
+	}
+	contentType := map[storage.UsersFormat]string{storage.UsersFormatCSV: "text/csv; charset=utf-8",
+		storage.UsersFormatJSON: "application/json; charset=utf-8", storage.UsersFormatIDs: "text/plain; charset=utf-8"}
+	w.Header().Set("Content-Type", contentType[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "approved-users."+string(format)))
+	if err = storage.WriteUsers(w, format, s.SpamFilter.ApprovedUsers()); err != nil {
+		// headers are sent already, so the error can't be reported to the client
+		log.Printf("[WARN] can't write approved users, %v", err)
+	}
+}
+
+// importApprovedUsersHandler handles POST /users/import?format=csv|json|txt request. The body is a file of approved
+// users, as exported by GET /users/export, json by default, or txt list of ids, i.e. exported from another
+// anti-spam bot. Users are approved, metadata of known users is updated with non-empty imported values.
+// Entries with invalid ids are skipped and counted.
+func (s *Server) importApprovedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	format, err := usersFormat(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid format", "details": err.Error()})
+		return
+	}
+	users, skipped, err := storage.ReadUsers(r.Body, format)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid users", "details": err.Error()})
+		return
+	}
+	for _, u := range users {
+		s.SpamFilter.AddApprovedUser(u)
+	}
+	log.Printf("[INFO] %d approved users imported by %s, skipped: %d", len(users), actorFrom(r.Context()), skipped)
+	rest.RenderJSON(w, rest.JSON{"imported": len(users), "skipped": skipped})
+}
+
+// usersFormat returns format of approved users file set by format query parameter, json if not set
+func usersFormat(r *http.Request) (storage.UsersFormat, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return storage.ParseUsersFormat(f)
+	}
+	return storage.UsersFormatJSON, nil
+}
+
+// getSamplesHandler handles GET /samples?type=spam|ham&origin=preset|user&source=admin&since=24h request.
+// It returns stored samples of the given type, origin is optional and means all samples if not set.
+// Source and since filter samples by provenance, the source matches its actors, i.e. "admin" matches "admin:bob".
+func (s *Server) getSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	sampleType := storage.SampleType(r.URL.Query().Get("type"))
+	if sampleType != storage.SampleTypeSpam && sampleType != storage.SampleTypeHam {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid sample type", "details": string(sampleType)})
+		return
+	}
+	origin := storage.SampleOrigin(r.URL.Query().Get("origin"))
+	switch origin {
+	case "":
+		origin = storage.SampleOriginAny
+	case storage.SampleOriginPreset, storage.SampleOriginUser, storage.SampleOriginAny:
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid sample origin", "details": string(origin)})
+		return
+	}
+
+	source := r.URL.Query().Get("source")
+	since, err := sinceParam(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid since", "details": err.Error()})
+		return
+	}
+
+	var samples []storage.Sample
+	if source == "" && since.IsZero() {
+		samples, err = s.Samples.Read(sampleType, origin)
+	} else {
+		samples, err = s.samplesBySource(sampleType, origin, source, since)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read samples", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"samples": samples, "count": len(samples)})
+}
+
+// samplesBySource returns samples of the type and origin added by the source since the time, any source if empty
+func (s *Server) samplesBySource(t storage.SampleType, origin storage.SampleOrigin, source string,
+	since time.Time) ([]storage.Sample, error) {
+	var all []storage.Sample
+	var err error
+	if source == "" {
+		all, err = s.Samples.Read(t, origin)
+	} else {
+		all, err = s.Samples.ReadBySource(source, since)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := []storage.Sample{}
+	for _, sample := range all {
+		if sample.Type == t && (origin == storage.SampleOriginAny || sample.Origin == origin) && !sample.Timestamp.Before(since) {
+			res = append(res, sample)
+		}
+	}
+	return res, nil
+}
+
+// revertSamplesHandler handles DELETE /samples?source=admin:bob&since=2h request. It removes samples of both types
+// added by the source, or its actors, since the time, i.e. after a bad training session, and reloads samples.
+// Since is RFC3339 time or duration back from now, any time if not set. The revert is recorded to the audit.
+func (s *Server) revertSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid source", "details": "source is required"})
+		return
+	}
+	since, err := sinceParam(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid since", "details": err.Error()})
+		return
+	}
+	count, err := s.Samples.DeleteBySource(source, since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't revert samples", "details": err.Error()})
+		return
+	}
+	details := fmt.Sprintf("%d samples of %s reverted", count, source)
+	if !since.IsZero() {
+		details += " since " + since.Format(time.RFC3339)
+	}
+	s.audit(r, "revert samples", 0, 0, details)
+	if count > 0 && !s.reload(w) {
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"reverted": count, "source": source})
+}
+
+// deleteSampleHandler handles DELETE /samples/{id} request. It removes the sample and reloads samples.
+func (s *Server) deleteSampleHandler(w http.ResponseWriter, r *http.Request) {
+	s.deleteByID(w, r, s.Samples.Delete)
+}
+
+// getStopWordsHandler handles GET /stopwords request. It returns all stored stop-words.
+func (s *Server) getStopWordsHandler(w http.ResponseWriter, _ *http.Request) {
+	entries, err := s.Dictionary.Read(storage.DictionaryTypeStopPhrase)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't read stop-words", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"stopwords": entries, "count": len(entries)})
+}
+
+// addStopWordHandler handles POST /stopwords request. It adds the stop-word and reloads samples.
+func (s *Server) addStopWordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		StopWord string `json:"stopword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't decode request", "details": err.Error()})
+		return
+	}
+	if err := s.Dictionary.Add(storage.DictionaryTypeStopPhrase, req.StopWord); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "can't add stop-word", "details": err.Error()})
+		return
+	}
+	if !s.reload(w) {
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"updated": true, "stopword": req.StopWord})
+}
+
+// deleteStopWordHandler handles DELETE /stopwords/{id} request. It removes the stop-word and reloads samples.
+func (s *Server) deleteStopWordHandler(w http.ResponseWriter, r *http.Request) {
+	s.deleteByID(w, r, s.Dictionary.Delete)
+}
+
+// deleteByID removes the record by id from the url and reloads samples
+func (s *Server) deleteByID(w http.ResponseWriter, r *http.Request, delFn func(id int64) error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid id", "details": err.Error()})
+		return
+	}
+	if err = delFn(id); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't delete", "details": err.Error()})
+		return
+	}
+	if !s.reload(w) {
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"deleted": true, "id": id})
+}
+
+// reloadHandler handles POST /reload request. It reloads the whole configuration if supported,
+// i.e. options, runtime settings, samples and stop-words, or samples and stop-words only otherwise.
+func (s *Server) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if s.Reload == nil {
+		if !s.reload(w) {
+			return
+		}
+		rest.RenderJSON(w, rest.JSON{"reloaded": true})
+		return
+	}
+	if err := s.Reload(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't reload configuration", "details": err.Error()})
+		return
+	}
+	s.audit(r, "reload", 0, 0, "configuration reloaded")
+	rest.RenderJSON(w, rest.JSON{"reloaded": true, "settings": s.settings()})
+}
+
+// reload reloads samples, see reloadSamples.
+// Returns false if reload failed, the error is already sent to the client.
+func (s *Server) reload(w http.ResponseWriter) bool {
+	if err := s.reloadSamples(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't reload samples", "details": err.Error()})
+		return false
+	}
+	return true
+}
+
+// reloadSamples reloads samples if reload function set, so changes of stores take effect
+func (s *Server) reloadSamples() error {
+	if s.ReloadSamples == nil {
+		return nil
+	}
+	return s.ReloadSamples()
+}
+
+// statsHandler handles GET /stats request. It returns stats summary for the time range, see statsRange for params.
+func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := statsRange(r, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid time range", "details": err.Error()})
+		return
+	}
+	report, err := s.Stats.Report(from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't get stats", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, report)
+}
+
+// dailyStatsHandler handles GET /stats/daily request. It returns stats for each day of the time range.
+func (s *Server) dailyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := statsRange(r, time.Now())
+	if err == nil && to.Sub(from) > maxStatsDays*24*time.Hour {
+		err = fmt.Errorf("time range exceeds %d days", maxStatsDays)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		rest.RenderJSON(w, rest.JSON{"error": "invalid time range", "details": err.Error()})
+		return
+	}
+	reports, err := s.Stats.Daily(from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		rest.RenderJSON(w, rest.JSON{"error": "can't get stats", "details": err.Error()})
+		return
+	}
+	rest.RenderJSON(w, rest.JSON{"days": reports})
+}
+
+// statsRange gets time range from the request. The range is set by "from" and "to" params in RFC3339 format,
+// or by "period" param ending now, i.e. "12h" or "7d". Default is the last day.
+func statsRange(r *http.Request, now time.Time) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	if q.Get("from") == "" && q.Get("to") == "" {
+		period := 24 * time.Hour
+		if p := q.Get("period"); p != "" {
+			if days, ok := strings.CutSuffix(p, "d"); ok {
+				n, perr := strconv.Atoi(days)
+				if perr != nil {
+					return from, to, fmt.Errorf("invalid period %q: %w", p, perr)
+				}
+				period = time.Duration(n) * 24 * time.Hour
+			} else if period, err = time.ParseDuration(p); err != nil {
+				return from, to, fmt.Errorf("invalid period %q: %w", p, err)
+			}
+		}
+		if period <= 0 {
+			return from, to, fmt.Errorf("invalid period %q", q.Get("period"))
+		}
+		return now.Add(-period), now, nil
+	}
+
+	to = now
+	if from, err = time.Parse(time.RFC3339, q.Get("from")); err != nil {
+		return from, to, fmt.Errorf("invalid from: %w", err)
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, errors.New("from should be before to")
+	}
+	return from, to, nil
 }
 
 // GenerateRandomPassword generates a random password of a given length
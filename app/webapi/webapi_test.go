@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,8 +19,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/umputun/tg-spam/app/storage"
 	"github.com/umputun/tg-spam/app/webapi/mocks"
 	"github.com/umputun/tg-spam/lib"
+	"github.com/umputun/tg-spam/lib/server"
+	"github.com/umputun/tg-spam/lib/spamcheck"
 )
 
 func TestServer_Run(t *testing.T) {
@@ -47,6 +55,43 @@ func TestServer_Run(t *testing.T) {
 	<-done
 }
 
+func TestServer_RunShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	var finished atomic.Bool
+	srv := NewServer(Config{ListenAddr: ":9877", Version: "dev", SpamFilter: &mocks.DetectorMock{},
+		ShutdownWait: time.Second, HealthCheck: func() error {
+			close(started)
+			time.Sleep(200 * time.Millisecond) // in-flight request
+			finished.Store(true)
+			return nil
+		}})
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, srv.Run(ctx))
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	respCh := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://localhost:9877/health")
+		if !assert.NoError(t, err) {
+			respCh <- 0
+			return
+		}
+		resp.Body.Close()
+		respCh <- resp.StatusCode
+	}()
+	<-started
+	cancel()
+	<-done
+	assert.True(t, finished.Load(), "server stopped after in-flight request finished")
+	assert.Equal(t, http.StatusOK, <-respCh)
+}
+
 func TestServer_RunAuth(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -73,6 +118,22 @@ func TestServer_RunAuth(t *testing.T) {
 		assert.Equal(t, http.StatusOK, resp.StatusCode) // no auth on ping
 	})
 
+	t.Run("health, no auth", func(t *testing.T) {
+		resp, err := http.Get("http://localhost:9877/health")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("probes and version, no auth", func(t *testing.T) {
+		for _, path := range []string{"/healthz", "/readyz", "/version"} {
+			resp, err := http.Get("http://localhost:9877" + path)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		}
+	})
+
 	t.Run("check unauthorized, no basic auth", func(t *testing.T) {
 		resp, err := http.Get("http://localhost:9877/check")
 		assert.NoError(t, err)
@@ -121,8 +182,8 @@ func TestServer_routes(t *testing.T) {
 		CheckFunc: func(msg string, userID string) (bool, []lib.CheckResult) {
 			return false, []lib.CheckResult{{Details: "not spam"}}
 		},
-		UpdateSpamFunc: func(msg string) error { return nil },
-		UpdateHamFunc:  func(msg string) error { return nil },
+		UpdateSpamFromFunc: func(msg, source string) error { return nil },
+		UpdateHamFromFunc:  func(msg, source string) error { return nil },
 		AddApprovedUsersFunc: func(ids ...string) {
 			if len(ids) == 0 {
 				panic("no ids")
@@ -133,8 +194,8 @@ func TestServer_routes(t *testing.T) {
 				panic("no ids")
 			}
 		},
-		ApprovedUsersFunc: func() []string {
-			return []string{"user1", "user2"}
+		ApprovedUsersFunc: func() []lib.ApprovedUser {
+			return []lib.ApprovedUser{{UserID: "user1", UserName: "name1", Count: 3}, {UserID: "user2", Count: 1}}
 		},
 	}
 	server := NewServer(Config{SpamFilter: mockDetector})
@@ -167,8 +228,8 @@ func TestServer_routes(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
-		assert.Equal(t, 1, len(mockDetector.UpdateSpamCalls()))
-		assert.Equal(t, "test message", mockDetector.UpdateSpamCalls()[0].Msg)
+		assert.Equal(t, 1, len(mockDetector.UpdateSpamFromCalls()))
+		assert.Equal(t, "test message", mockDetector.UpdateSpamFromCalls()[0].Msg)
 	})
 
 	t.Run("update ham", func(t *testing.T) {
@@ -181,8 +242,9 @@ func TestServer_routes(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
-		assert.Equal(t, 1, len(mockDetector.UpdateHamCalls()))
-		assert.Equal(t, "test message", mockDetector.UpdateHamCalls()[0].Msg)
+		assert.Equal(t, 1, len(mockDetector.UpdateHamFromCalls()))
+		assert.Equal(t, "test message", mockDetector.UpdateHamFromCalls()[0].Msg)
+		assert.Equal(t, "api:anonymous", mockDetector.UpdateHamFromCalls()[0].Source)
 	})
 
 	t.Run("add user", func(t *testing.T) {
@@ -228,7 +290,13 @@ func TestServer_routes(t *testing.T) {
 		assert.Equal(t, 1, len(mockDetector.ApprovedUsersCalls()))
 		respBody, err := io.ReadAll(resp.Body)
 		assert.NoError(t, err)
-		assert.Equal(t, `{"user_ids":["user1","user2"]}`+"\n", string(respBody))
+		res := struct {
+			UserIDs []string           `json:"user_ids"`
+			Users   []lib.ApprovedUser `json:"users"`
+		}{}
+		require.NoError(t, json.Unmarshal(respBody, &res))
+		assert.Equal(t, []string{"user1", "user2"}, res.UserIDs)
+		assert.Equal(t, []lib.ApprovedUser{{UserID: "user1", UserName: "name1", Count: 3}, {UserID: "user2", Count: 1}}, res.Users)
 	})
 }
 
@@ -313,15 +381,85 @@ func TestServer_checkHandler(t *testing.T) {
 
 }
 
+func TestServer_checkBatchHandler(t *testing.T) {
+	var active, maxActive int32
+	checkFn := func(msg string, userID string) (bool, []lib.CheckResult) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if strings.HasPrefix(msg, "spam") {
+			return true, []lib.CheckResult{{Spam: true, Name: "test", Details: "spam " + userID}}
+		}
+		return false, []lib.CheckResult{{Details: "not spam " + userID}}
+	}
+	mockDetector := &mocks.DetectorMock{CheckFunc: checkFn, CheckLocalFunc: checkFn}
+	srv := NewServer(Config{SpamFilter: mockDetector, BatchWorkers: 2})
+
+	check := func(t *testing.T, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/check/batch", strings.NewReader(body))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(srv.checkBatchHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("batch", func(t *testing.T) {
+		rr := check(t, `{"messages": [{"msg": "spam 1", "user_id": "1"}, {"msg": "ham 2", "user_id": "2"},
+			{"msg": "spam 3", "user_id": "3"}, {"msg": "ham 4", "user_id": "4"}, {"msg": "ham 5", "user_id": "5"}]}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Results []spamcheck.Response `json:"results"`
+			Count   int                  `json:"count"`
+			Spam    int                  `json:"spam"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, 5, response.Count)
+		assert.Equal(t, 2, response.Spam)
+		require.Len(t, response.Results, 5)
+		for i, res := range response.Results {
+			assert.Equal(t, i%2 == 0 && i != 4, res.Spam, "result %d", i)
+			assert.Contains(t, res.Checks[0].Details, strconv.Itoa(i+1), "results in order of messages")
+		}
+		assert.Len(t, mockDetector.CheckCalls(), 5)
+		assert.Empty(t, mockDetector.CheckLocalCalls())
+		assert.Equal(t, int32(2), atomic.LoadInt32(&maxActive), "limited by workers")
+	})
+
+	t.Run("skip network", func(t *testing.T) {
+		mockDetector.ResetCalls()
+		rr := check(t, `{"skip_network": true, "messages": [{"msg": "spam 1", "user_id": "1"}]}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, mockDetector.CheckCalls())
+		require.Len(t, mockDetector.CheckLocalCalls(), 1)
+		assert.Equal(t, "spam 1", mockDetector.CheckLocalCalls()[0].Msg)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		tooMany := make([]spamcheck.Request, server.DefaultMaxBatchSize+1)
+		tooManyBody, err := json.Marshal(map[string]any{"messages": tooMany})
+		require.NoError(t, err)
+		for _, body := range []string{"bad request", `{"messages": []}`, string(tooManyBody)} {
+			rr := check(t, body)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+	})
+}
+
 func TestServer_updateHandler(t *testing.T) {
 	mockDetector := &mocks.DetectorMock{
-		UpdateHamFunc: func(msg string) error {
+		UpdateHamFromFunc: func(msg, source string) error {
 			if msg == "error" {
 				return assert.AnError
 			}
 			return nil
 		},
-		UpdateSpamFunc: func(msg string) error {
+		UpdateSpamFromFunc: func(msg, source string) error {
 			if msg == "error" {
 				return assert.AnError
 			}
@@ -340,7 +478,7 @@ func TestServer_updateHandler(t *testing.T) {
 		require.NoError(t, err)
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(server.updateSampleHandler(mockDetector.UpdateHam))
+		handler := http.HandlerFunc(server.updateSampleHandler(mockDetector.UpdateHamFrom))
 		handler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code, "handler returned wrong status code")
@@ -352,8 +490,8 @@ func TestServer_updateHandler(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, response.Updated)
 		assert.Equal(t, "test message", response.Msg)
-		assert.Equal(t, 1, len(mockDetector.UpdateHamCalls()))
-		assert.Equal(t, "test message", mockDetector.UpdateHamCalls()[0].Msg)
+		assert.Equal(t, 1, len(mockDetector.UpdateHamFromCalls()))
+		assert.Equal(t, "test message", mockDetector.UpdateHamFromCalls()[0].Msg)
 	})
 
 	t.Run("update ham with error", func(t *testing.T) {
@@ -366,7 +504,7 @@ func TestServer_updateHandler(t *testing.T) {
 		require.NoError(t, err)
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(server.updateSampleHandler(mockDetector.UpdateHam))
+		handler := http.HandlerFunc(server.updateSampleHandler(mockDetector.UpdateHamFrom))
 		handler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusInternalServerError, rr.Code, "handler returned wrong status code")
@@ -378,8 +516,8 @@ func TestServer_updateHandler(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "can't update samples", response.Err)
 		assert.Equal(t, "assert.AnError general error for testing", response.Details)
-		assert.Equal(t, 1, len(mockDetector.UpdateHamCalls()))
-		assert.Equal(t, "error", mockDetector.UpdateHamCalls()[0].Msg)
+		assert.Equal(t, 1, len(mockDetector.UpdateHamFromCalls()))
+		assert.Equal(t, "error", mockDetector.UpdateHamFromCalls()[0].Msg)
 	})
 
 	t.Run("bad request", func(t *testing.T) {
@@ -389,7 +527,7 @@ func TestServer_updateHandler(t *testing.T) {
 		require.NoError(t, err)
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(server.updateSampleHandler(mockDetector.UpdateHam))
+		handler := http.HandlerFunc(server.updateSampleHandler(mockDetector.UpdateHamFrom))
 		handler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusBadRequest, rr.Code, "handler returned wrong status code")
@@ -446,6 +584,157 @@ func TestServer_updateApprovedUsersHandler(t *testing.T) {
 	})
 }
 
+func TestServer_exportImportApprovedUsers(t *testing.T) {
+	ts0 := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mockDetector := &mocks.DetectorMock{
+		ApprovedUsersFunc: func() []lib.ApprovedUser {
+			return []lib.ApprovedUser{{UserID: "123", UserName: "user1", Count: 3, FirstSeen: ts0}}
+		},
+		AddApprovedUserFunc: func(user lib.ApprovedUser) {},
+	}
+	ts := httptest.NewServer(NewServer(Config{SpamFilter: mockDetector}).routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("export", func(t *testing.T) {
+		tbl := []struct {
+			query, contentType, body string
+			status                   int
+		}{
+			{query: "?format=csv", contentType: "text/csv; charset=utf-8", status: http.StatusOK,
+				body: "user_id,user_name,count,first_seen,last_seen\n123,user1,3,2024-05-01T10:00:00Z,\n"},
+			{query: "?format=txt", contentType: "text/plain; charset=utf-8", body: "123\n", status: http.StatusOK},
+			{query: "", contentType: "application/json; charset=utf-8", status: http.StatusOK},
+			{query: "?format=xml", status: http.StatusBadRequest},
+		}
+		for _, tt := range tbl {
+			resp, err := http.Get(ts.URL + "/users/export" + tt.query)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode, tt.query)
+			if tt.status != http.StatusOK {
+				continue
+			}
+			assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"), tt.query)
+			assert.Contains(t, resp.Header.Get("Content-Disposition"), "approved-users.", tt.query)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, string(body), tt.query)
+				continue
+			}
+			var users []lib.ApprovedUser
+			require.NoError(t, json.Unmarshal(body, &users))
+			assert.Equal(t, mockDetector.ApprovedUsers(), users)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		tbl := []struct {
+			query, body string
+			status      int
+			imported    []lib.ApprovedUser
+			skipped     int
+		}{
+			{query: "?format=txt", body: "123, 456\n@spammer", status: http.StatusOK,
+				imported: []lib.ApprovedUser{{UserID: "123"}, {UserID: "456"}}, skipped: 1},
+			{query: "", body: `[{"user_id": "789", "user_name": "user3", "count": 10}]`, status: http.StatusOK,
+				imported: []lib.ApprovedUser{{UserID: "789", UserName: "user3", Count: 10}}},
+			{query: "?format=csv", body: "id\n123\n", status: http.StatusBadRequest},
+			{query: "?format=xml", body: "123", status: http.StatusBadRequest},
+		}
+		for _, tt := range tbl {
+			mockDetector.ResetCalls()
+			resp, err := http.Post(ts.URL+"/users/import"+tt.query, "text/plain", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			var res struct {
+				Imported int `json:"imported"`
+				Skipped  int `json:"skipped"`
+			}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode, tt.query)
+			require.Len(t, mockDetector.AddApprovedUserCalls(), len(tt.imported), tt.query)
+			for i, u := range tt.imported {
+				assert.Equal(t, u, mockDetector.AddApprovedUserCalls()[i].User)
+			}
+			assert.Equal(t, len(tt.imported), res.Imported)
+			assert.Equal(t, tt.skipped, res.Skipped)
+		}
+	})
+}
+
+func TestServer_healthHandler(t *testing.T) {
+	t.Run("no health check", func(t *testing.T) {
+		server := NewServer(Config{})
+		rr := httptest.NewRecorder()
+		server.healthHandler(rr, httptest.NewRequest("GET", "/health", http.NoBody))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `{"status":"ok"}`+"\n", rr.Body.String())
+	})
+
+	t.Run("health check passed", func(t *testing.T) {
+		server := NewServer(Config{HealthCheck: func() error { return nil }})
+		rr := httptest.NewRecorder()
+		server.healthHandler(rr, httptest.NewRequest("GET", "/health", http.NoBody))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("health check failed", func(t *testing.T) {
+		server := NewServer(Config{HealthCheck: func() error { return errors.New("bot has no rights to ban users") }})
+		rr := httptest.NewRecorder()
+		server.healthHandler(rr, httptest.NewRequest("GET", "/health", http.NoBody))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Equal(t, `{"error":"bot has no rights to ban users","status":"failed"}`+"\n", rr.Body.String())
+	})
+}
+
+func TestServer_probes(t *testing.T) {
+	var dbErr error
+	server := NewServer(Config{Version: "master-abc123", BuildDate: "2024-05-01T10:00:00Z",
+		ReadyChecks: map[string]func(ctx context.Context) error{
+			"database": func(context.Context) error { return dbErr },
+			"samples":  func(context.Context) error { return nil },
+		}})
+	handler := server.health(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, http.NoBody))
+		return rr
+	}
+
+	rr := get("/healthz")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"status":"ok"}`+"\n", rr.Body.String())
+
+	rr = get("/readyz")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"checks":{"database":"ok","samples":"ok"},"status":"ok"}`+"\n", rr.Body.String())
+
+	dbErr = errors.New("database is locked")
+	rr = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, `{"checks":{"database":"database is locked","samples":"ok"},"status":"failed"}`+"\n", rr.Body.String())
+
+	rr = get("/version")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var ver struct {
+		Version   string `json:"version"`
+		BuildDate string `json:"build_date"`
+		GoVersion string `json:"go_version"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&ver))
+	assert.Equal(t, "master-abc123", ver.Version)
+	assert.Equal(t, "2024-05-01T10:00:00Z", ver.BuildDate)
+	assert.Equal(t, runtime.Version(), ver.GoVersion)
+
+	assert.Equal(t, http.StatusTeapot, get("/users").Code, "other requests passed through")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/readyz", http.NoBody))
+	assert.Equal(t, http.StatusTeapot, rr.Code, "only GET requests handled")
+}
+
 func TestGenerateRandomPassword(t *testing.T) {
 	res1, err := GenerateRandomPassword(32)
 	require.NoError(t, err)
@@ -459,3 +748,439 @@ func TestGenerateRandomPassword(t *testing.T) {
 
 	assert.NotEqual(t, res1, res2)
 }
+
+func TestServer_backupHandler(t *testing.T) {
+	t.Run("backup", func(t *testing.T) {
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Backup: func(w io.Writer) error {
+			_, err := w.Write([]byte("archive"))
+			return err
+		}})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/backup")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), "attachment; filename=\"tg-spam-backup-")
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "archive", string(body))
+	})
+
+	t.Run("backup failed", func(t *testing.T) {
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Backup: func(w io.Writer) error {
+			return errors.New("db error")
+		}})
+		rr := httptest.NewRecorder()
+		server.backupHandler(rr, httptest.NewRequest("GET", "/backup", http.NoBody))
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "db error")
+	})
+
+	t.Run("no backup endpoint", func(t *testing.T) {
+		server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/backup")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestServer_samplesHandlers(t *testing.T) {
+	samplesStore := &mocks.SamplesStoreMock{
+		ReadFunc: func(t storage.SampleType, origin storage.SampleOrigin) ([]storage.Sample, error) {
+			return []storage.Sample{{ID: 1, Type: t, Origin: storage.SampleOriginUser, Message: "sample 1"}}, nil
+		},
+		DeleteFunc: func(id int64) error {
+			if id == 13 {
+				return errors.New("db error")
+			}
+			return nil
+		},
+		ReadBySourceFunc: func(source string, since time.Time) ([]storage.Sample, error) {
+			return []storage.Sample{
+				{ID: 1, Type: storage.SampleTypeSpam, Origin: storage.SampleOriginUser, Source: "admin:bob", Message: "spam 1",
+					Timestamp: time.Now()},
+				{ID: 2, Type: storage.SampleTypeHam, Origin: storage.SampleOriginUser, Source: "admin:bob", Message: "ham 1"},
+			}, nil
+		},
+		DeleteBySourceFunc: func(source string, since time.Time) (int, error) {
+			if source == "bad" {
+				return 0, errors.New("db error")
+			}
+			return 2, nil
+		},
+	}
+	var reloads int
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Samples: samplesStore,
+		ReloadSamples: func() error { reloads++; return nil }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("get samples", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		resp, err := http.Get(ts.URL + "/samples?type=spam&origin=user")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		res := struct {
+			Samples []storage.Sample `json:"samples"`
+			Count   int              `json:"count"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 1, res.Count)
+		assert.Equal(t, "sample 1", res.Samples[0].Message)
+		require.Len(t, samplesStore.ReadCalls(), 1)
+		assert.Equal(t, storage.SampleTypeSpam, samplesStore.ReadCalls()[0].T)
+		assert.Equal(t, storage.SampleOriginUser, samplesStore.ReadCalls()[0].Origin)
+	})
+
+	t.Run("get samples, default origin", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		resp, err := http.Get(ts.URL + "/samples?type=ham")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, samplesStore.ReadCalls(), 1)
+		assert.Equal(t, storage.SampleOriginAny, samplesStore.ReadCalls()[0].Origin)
+	})
+
+	t.Run("get samples by source", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		resp, err := http.Get(ts.URL + "/samples?type=spam&source=admin:bob&since=2h")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		res := struct {
+			Samples []storage.Sample `json:"samples"`
+			Count   int              `json:"count"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		require.Equal(t, 1, res.Count, "spam samples only")
+		assert.Equal(t, "admin:bob", res.Samples[0].Source)
+		require.Len(t, samplesStore.ReadBySourceCalls(), 1)
+		assert.Equal(t, "admin:bob", samplesStore.ReadBySourceCalls()[0].Source)
+		assert.WithinDuration(t, time.Now().Add(-2*time.Hour), samplesStore.ReadBySourceCalls()[0].Since, time.Minute)
+		assert.Empty(t, samplesStore.ReadCalls())
+	})
+
+	t.Run("get samples, bad params", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		for _, q := range []string{"", "?type=blah", "?type=spam&origin=blah", "?type=spam&since=blah"} {
+			resp, err := http.Get(ts.URL + "/samples" + q)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, q)
+		}
+		assert.Empty(t, samplesStore.ReadCalls())
+	})
+
+	t.Run("delete sample", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		reloads = 0
+		req, err := http.NewRequest("DELETE", ts.URL+"/samples/12", http.NoBody)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, samplesStore.DeleteCalls(), 1)
+		assert.Equal(t, int64(12), samplesStore.DeleteCalls()[0].ID)
+		assert.Equal(t, 1, reloads, "samples reloaded")
+	})
+
+	t.Run("delete sample failed", func(t *testing.T) {
+		reloads = 0
+		for id, code := range map[string]int{"13": http.StatusInternalServerError, "bad": http.StatusBadRequest} {
+			req, err := http.NewRequest("DELETE", ts.URL+"/samples/"+id, http.NoBody)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, code, resp.StatusCode, id)
+		}
+		assert.Equal(t, 0, reloads, "not reloaded")
+	})
+
+	t.Run("revert samples of source", func(t *testing.T) {
+		samplesStore.ResetCalls()
+		reloads = 0
+		req, err := http.NewRequest("DELETE", ts.URL+"/samples?source=admin:bob&since=2026-10-01T10:00:00Z", http.NoBody)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		res := struct {
+			Reverted int    `json:"reverted"`
+			Source   string `json:"source"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 2, res.Reverted)
+		assert.Equal(t, "admin:bob", res.Source)
+		require.Len(t, samplesStore.DeleteBySourceCalls(), 1)
+		assert.Equal(t, time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), samplesStore.DeleteBySourceCalls()[0].Since)
+		assert.Equal(t, 1, reloads, "samples reloaded")
+	})
+
+	t.Run("revert samples failed", func(t *testing.T) {
+		reloads = 0
+		for q, code := range map[string]int{"": http.StatusBadRequest, "?source=admin&since=blah": http.StatusBadRequest,
+			"?source=bad": http.StatusInternalServerError} {
+			req, err := http.NewRequest("DELETE", ts.URL+"/samples"+q, http.NoBody)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, code, resp.StatusCode, q)
+		}
+		assert.Equal(t, 0, reloads, "not reloaded")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		srv := httptest.NewServer(NewServer(Config{SpamFilter: &mocks.DetectorMock{}}).routes(chi.NewRouter()))
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + "/samples?type=spam")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestServer_stopWordsHandlers(t *testing.T) {
+	dictStore := &mocks.DictionaryStoreMock{
+		ReadFunc: func(t storage.DictionaryType) ([]storage.DictionaryEntry, error) {
+			return []storage.DictionaryEntry{{ID: 1, Type: t, Data: "buy now"}}, nil
+		},
+		AddFunc: func(t storage.DictionaryType, data string) error {
+			if data == "" {
+				return errors.New("empty entry")
+			}
+			return nil
+		},
+		DeleteFunc: func(id int64) error { return nil },
+	}
+	reloadErr := error(nil)
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Dictionary: dictStore,
+		ReloadSamples: func() error { return reloadErr }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("get stop-words", func(t *testing.T) {
+		dictStore.ResetCalls()
+		resp, err := http.Get(ts.URL + "/stopwords")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		res := struct {
+			StopWords []storage.DictionaryEntry `json:"stopwords"`
+			Count     int                       `json:"count"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 1, res.Count)
+		assert.Equal(t, "buy now", res.StopWords[0].Data)
+		require.Len(t, dictStore.ReadCalls(), 1)
+		assert.Equal(t, storage.DictionaryTypeStopPhrase, dictStore.ReadCalls()[0].T)
+	})
+
+	t.Run("add stop-word", func(t *testing.T) {
+		dictStore.ResetCalls()
+		resp, err := http.Post(ts.URL+"/stopwords", "application/json", bytes.NewBufferString(`{"stopword":"free money"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, dictStore.AddCalls(), 1)
+		assert.Equal(t, storage.DictionaryTypeStopPhrase, dictStore.AddCalls()[0].T)
+		assert.Equal(t, "free money", dictStore.AddCalls()[0].Data)
+	})
+
+	t.Run("add empty stop-word", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/stopwords", "application/json", bytes.NewBufferString(`{"stopword":""}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("delete stop-word, reload failed", func(t *testing.T) {
+		dictStore.ResetCalls()
+		reloadErr = errors.New("reload error")
+		defer func() { reloadErr = nil }()
+		req, err := http.NewRequest("DELETE", ts.URL+"/stopwords/1", http.NoBody)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "reload error")
+		require.Len(t, dictStore.DeleteCalls(), 1)
+		assert.Equal(t, int64(1), dictStore.DeleteCalls()[0].ID)
+	})
+}
+
+func TestServer_reloadHandler(t *testing.T) {
+	var reloads int
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, ReloadSamples: func() error { reloads++; return nil }})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/reload", "application/json", http.NoBody)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, reloads)
+
+	t.Run("full reload", func(t *testing.T) {
+		var server *Server
+		var reloadErr error
+		server = NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Settings: Settings{MinMsgLen: 50, Dry: true},
+			ReloadSamples: func() error { t.Fatal("samples reloaded with configuration"); return nil },
+			Reload: func() error {
+				if reloadErr != nil {
+					return reloadErr
+				}
+				minLen, dry := 10, false
+				server.ApplySettings(RuntimeSettings{MinMsgLen: &minLen, Dry: &dry})
+				return nil
+			}})
+		ts := httptest.NewServer(server.routes(chi.NewRouter()))
+		defer ts.Close()
+
+		resp, err := http.Post(ts.URL+"/reload", "application/json", http.NoBody)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res struct {
+			Reloaded bool     `json:"reloaded"`
+			Settings Settings `json:"settings"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.True(t, res.Reloaded)
+		assert.Equal(t, Settings{MinMsgLen: 10, Dry: false}, res.Settings, "reloaded settings reported")
+		assert.Equal(t, res.Settings, server.settings())
+
+		reloadErr = errors.New("bad config")
+		resp, err = http.Post(ts.URL+"/reload", "application/json", http.NoBody)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "can't reload configuration")
+		assert.Contains(t, string(body), "bad config")
+	})
+}
+
+func TestServer_settingsHandler(t *testing.T) {
+	settings := Settings{SimilarityThreshold: 0.5, MinMsgLen: 50, MaxEmoji: 2, FirstMessageOnly: true, CasEnabled: true,
+		SamplesStorage: "db"}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Settings: settings})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/settings")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var res Settings
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.Equal(t, settings, res)
+}
+
+func TestServer_statsHandlers(t *testing.T) {
+	statsReporter := &mocks.StatsReporterMock{
+		ReportFunc: func(from, to time.Time) (storage.StatsReport, error) {
+			return storage.StatsReport{From: from, To: to, Checked: 100, Spam: 5, Bans: 4, Reversals: 1,
+				ByAction: map[string]int{"ban": 4, "dry": 1}, ByCheck: map[string]int{"stopword": 3}}, nil
+		},
+		DailyFunc: func(from, to time.Time) ([]storage.StatsReport, error) {
+			return []storage.StatsReport{{From: from, Checked: 10}, {From: from.AddDate(0, 0, 1), Checked: 20}}, nil
+		},
+	}
+	server := NewServer(Config{SpamFilter: &mocks.DetectorMock{}, Stats: statsReporter})
+	ts := httptest.NewServer(server.routes(chi.NewRouter()))
+	defer ts.Close()
+
+	t.Run("summary", func(t *testing.T) {
+		statsReporter.ResetCalls()
+		resp, err := http.Get(ts.URL + "/stats?period=7d")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res storage.StatsReport
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 100, res.Checked)
+		assert.Equal(t, 1, res.Reversals)
+		assert.Equal(t, map[string]int{"stopword": 3}, res.ByCheck)
+		require.Len(t, statsReporter.ReportCalls(), 1)
+		call := statsReporter.ReportCalls()[0]
+		assert.Equal(t, 7*24*time.Hour, call.To.Sub(call.From))
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		statsReporter.ResetCalls()
+		resp, err := http.Get(ts.URL + "/stats/daily?from=2024-01-01T00:00:00Z&to=2024-01-03T00:00:00Z")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		res := struct {
+			Days []storage.StatsReport `json:"days"`
+		}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		require.Len(t, res.Days, 2)
+		assert.Equal(t, 20, res.Days[1].Checked)
+		require.Len(t, statsReporter.DailyCalls(), 1)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), statsReporter.DailyCalls()[0].From)
+		assert.Equal(t, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), statsReporter.DailyCalls()[0].To)
+	})
+
+	t.Run("bad range", func(t *testing.T) {
+		statsReporter.ResetCalls()
+		for _, path := range []string{"/stats?period=blah", "/stats?from=2024-01-01", "/stats/daily?period=400d"} {
+			resp, err := http.Get(ts.URL + path)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+		}
+		assert.Empty(t, statsReporter.ReportCalls())
+		assert.Empty(t, statsReporter.DailyCalls())
+	})
+}
+
+func TestStatsRange(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		query    string
+		from, to time.Time
+		err      bool
+	}{
+		{name: "default", query: "", from: now.Add(-24 * time.Hour), to: now},
+		{name: "hours", query: "period=12h", from: now.Add(-12 * time.Hour), to: now},
+		{name: "days", query: "period=30d", from: now.AddDate(0, 0, -30), to: now},
+		{name: "from only", query: "from=2024-05-01T00:00:00Z", from: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), to: now},
+		{name: "from and to", query: "from=2024-05-01T00:00:00Z&to=2024-05-02T00:00:00Z",
+			from: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "bad period", query: "period=xd", err: true},
+		{name: "negative period", query: "period=-1h", err: true},
+		{name: "bad from", query: "from=yesterday", err: true},
+		{name: "to only", query: "to=2024-05-02T00:00:00Z", err: true},
+		{name: "from after to", query: "from=2024-05-03T00:00:00Z&to=2024-05-02T00:00:00Z", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := statsRange(httptest.NewRequest("GET", "/stats?"+tt.query, http.NoBody), now)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.from, from)
+			assert.Equal(t, tt.to, to)
+		})
+	}
+}
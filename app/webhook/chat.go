@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// Format is a format of webhook payload
+type Format string
+
+// payload formats
+const (
+	FormatJSON       Format = ""           // event as json, the default
+	FormatSlack      Format = "slack"      // slack incoming webhook, {"text": "..."}
+	FormatDiscord    Format = "discord"    // discord webhook, {"content": "..."}
+	FormatMattermost Format = "mattermost" // mattermost incoming webhook, {"text": "..."}
+)
+
+// maxMessageLen is the max length of chat messages, in runes, the limit of discord which is the lowest one
+const maxMessageLen = 2000
+
+// DefaultTemplate is a template of chat messages, used if hook's template is not set.
+// The template is executed with Event, and has "trunc" function to shorten the text to the number of runes.
+const DefaultTemplate = `{{if eq .Type "spam"}}🚫 spam detected{{else if eq .Type "ban"}}⛔ user banned` +
+	`{{else if eq .Type "unban"}}✅ user unbanned{{else}}📝 {{.Sample}} sample added{{end}}` +
+	`{{with .UserName}} {{.}}{{end}}{{with .UserID}} ({{.}}){{end}}{{with .ChatID}} in chat {{.}}{{end}}` +
+	`{{with .Text}}: {{trunc 500 .}}{{end}}` +
+	`{{range .Checks}}{{if .Spam}}{{"\n"}}- {{.Name}}: {{.Details}}{{end}}{{end}}`
+
+// ParseTemplate parses template of chat messages, with the functions available in DefaultTemplate
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("message").Funcs(template.FuncMap{"trunc": trunc}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+var defaultTemplate = template.Must(ParseTemplate(DefaultTemplate))
+
+// payload makes body of the request for the hook, json of the event, or chat message made with hook's template
+func (h Hook) payload(event Event) ([]byte, error) {
+	if h.Format == FormatJSON {
+		return json.Marshal(event)
+	}
+	tmpl := h.Template
+	if tmpl == nil {
+		tmpl = defaultTemplate
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+	msg := trunc(maxMessageLen, strings.TrimSpace(buf.String()))
+	switch h.Format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": slackEscaper.Replace(msg)})
+	case FormatMattermost:
+		return json.Marshal(map[string]string{"text": msg})
+	case FormatDiscord:
+		return json.Marshal(map[string]any{"content": msg, "allowed_mentions": map[string][]string{"parse": {}}})
+	}
+	return nil, fmt.Errorf("unknown format %q", h.Format)
+}
+
+// slackEscaper escapes control characters of slack messages
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// trunc shortens the string to max runes, with ellipsis at the end if shortened
+func trunc(maxLen int, s string) string {
+	if utf8.RuneCountInString(s) <= maxLen {
+		return s
+	}
+	return string([]rune(s)[:maxLen-1]) + "…"
+}
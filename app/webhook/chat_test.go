@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestHook_payload(t *testing.T) {
+	spam := Event{Type: EventSpam, ChatID: 123, UserID: 1, UserName: "spammer", Text: "buy <now> & win",
+		Checks: []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"}, {Name: "cas", Details: "not found"}}}
+
+	tbl := []struct {
+		name  string
+		hook  Hook
+		event Event
+		exp   string
+	}{
+		{name: "slack spam", hook: Hook{Format: FormatSlack}, event: spam,
+			exp: `{"text":"🚫 spam detected spammer (1) in chat 123: buy \u0026lt;now\u0026gt; \u0026amp; win\n- stopword: buy now"}`},
+		{name: "mattermost ban", hook: Hook{Format: FormatMattermost}, event: Event{Type: EventBan, UserID: 1, UserName: "spammer"},
+			exp: `{"text":"⛔ user banned spammer (1)"}`},
+		{name: "discord unban", hook: Hook{Format: FormatDiscord}, event: Event{Type: EventUnban, ChatID: 123, UserID: 2},
+			exp: `{"allowed_mentions":{"parse":[]},"content":"✅ user unbanned (2) in chat 123"}`},
+		{name: "discord train", hook: Hook{Format: FormatDiscord}, event: Event{Type: EventTrain, Sample: "ham", Text: "hello"},
+			exp: `{"allowed_mentions":{"parse":[]},"content":"📝 ham sample added: hello"}`},
+		{name: "custom template", hook: Hook{Format: FormatSlack, Template: mustTemplate(t, `{{.Type}} {{trunc 4 .Text}}`)},
+			event: spam, exp: `{"text":"spam buy…"}`},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := tt.hook.payload(tt.event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.exp, string(body))
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		body, err := Hook{}.payload(spam)
+		require.NoError(t, err)
+		var event Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, spam, event)
+	})
+
+	t.Run("long message", func(t *testing.T) {
+		body, err := Hook{Format: FormatMattermost}.payload(Event{Type: EventSpam, Text: strings.Repeat("текст ", 1000)})
+		require.NoError(t, err)
+		var msg struct{ Text string }
+		require.NoError(t, json.Unmarshal(body, &msg))
+		assert.Equal(t, "🚫 spam detected: "+strings.Repeat("текст ", 83)+"т…", msg.Text, "text truncated by template")
+
+		body, err = Hook{Format: FormatMattermost, Template: mustTemplate(t, "{{.Text}}")}.payload(
+			Event{Type: EventSpam, Text: strings.Repeat("текст ", 1000)})
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &msg))
+		assert.Equal(t, maxMessageLen, len([]rune(msg.Text)), "message truncated to the limit")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Hook{Format: "teams"}.payload(spam)
+		assert.EqualError(t, err, `unknown format "teams"`)
+		_, err = Hook{Format: FormatSlack, Template: mustTemplate(t, "{{.Unknown}}")}.payload(spam)
+		assert.ErrorContains(t, err, "failed to execute template")
+		_, err = ParseTemplate("{{.Text")
+		assert.ErrorContains(t, err, "failed to parse template")
+	})
+}
+
+func TestNotifier_DeliverToChat(t *testing.T) {
+	var lock sync.Mutex
+	var received []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, string(body))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{Hooks: []Hook{{URL: ts.URL, Format: FormatSlack, Events: []EventType{EventBan}}}}
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+	n.Notify(Event{Type: EventSpam, UserID: 1, Text: "buy now"})
+	n.Notify(Event{Type: EventBan, UserID: 1, UserName: "spammer"})
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received) == 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, []string{`{"text":"⛔ user banned spammer (1)"}`}, received)
+}
+
+func mustTemplate(t *testing.T, text string) *template.Template {
+	tmpl, err := ParseTemplate(text)
+	require.NoError(t, err)
+	return tmpl
+}
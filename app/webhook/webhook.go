@@ -0,0 +1,259 @@
+// Package webhook sends moderation events, i.e. spam detections, bans, unbans and training, to external systems
+// with http webhooks. Each event is posted as json, optionally signed with hmac-sha256 of the shared secret,
+// or as a chat message made with template, for incoming webhooks of slack, discord and mattermost.
+// Failed deliveries are retried with backoff, and events which can't be delivered are logged as dead letters.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+// EventType is a type of moderation event
+type EventType string
+
+// event types
+const (
+	EventSpam  EventType = "spam"  // spam detected by the bot
+	EventBan   EventType = "ban"   // user or channel banned
+	EventUnban EventType = "unban" // user unbanned, i.e. detection reversed by admin
+	EventTrain EventType = "train" // spam or ham sample added
+)
+
+// EventTypes is a list of all event types
+var EventTypes = []EventType{EventSpam, EventBan, EventUnban, EventTrain}
+
+// Event is a moderation event sent to webhooks
+type Event struct {
+	ID       string            `json:"id"` // unique id of the event, the same for all delivery attempts
+	Type     EventType         `json:"type"`
+	Time     time.Time         `json:"time"`
+	ChatID   int64             `json:"chat_id,omitempty"`
+	UserID   int64             `json:"user_id,omitempty"`
+	UserName string            `json:"user_name,omitempty"`
+	Text     string            `json:"text,omitempty"`
+	Checks   []lib.CheckResult `json:"checks,omitempty"` // detection results, for spam events
+	Sample   string            `json:"sample,omitempty"` // spam or ham, for train events
+	Source   string            `json:"source,omitempty"` // who added the sample, i.e. admin:bob, for train events
+}
+
+// Hook is a webhook endpoint
+type Hook struct {
+	URL      string
+	Secret   string             // payload is signed with hmac-sha256 of the secret if set
+	Events   []EventType        // events sent to the hook, all if empty
+	Format   Format             // format of payload, json of the event if not set
+	Template *template.Template // template of chat messages, DefaultTemplate if not set
+}
+
+// accepts returns true if the event type should be sent to the hook
+func (h Hook) accepts(t EventType) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, t)
+}
+
+// headers of webhook requests
+const (
+	EventHeader     = "X-TG-Spam-Event"     // event type
+	SignatureHeader = "X-TG-Spam-Signature" // "sha256=" and hex of hmac-sha256 of the body, if secret set
+)
+
+const queueSize = 100 // max number of events waiting for delivery, per hook
+
+// Notifier delivers events to webhooks. Each hook has its own queue, so a slow or failing hook doesn't delay others,
+// and events are delivered to the hook in the order they happened. Notify doesn't block, delivery is done by Run.
+type Notifier struct {
+	Hooks        []Hook
+	Retries      int           // max number of retries of failed delivery, 0 - no retries
+	RetryDelay   time.Duration // delay before the first retry, doubled on each next one, 1s if not set
+	HTTPClient   *http.Client  // client to deliver events, default client with timeout is used if nil
+	DrainTimeout time.Duration // max time to deliver events queued when Run is stopped, dropped if not set
+
+	once   sync.Once
+	queues []chan Event // queues of hooks, in the order of Hooks
+}
+
+func (n *Notifier) init() {
+	n.once.Do(func() {
+		n.queues = make([]chan Event, len(n.Hooks))
+		for i := range n.queues {
+			n.queues[i] = make(chan Event, queueSize)
+		}
+		if n.RetryDelay == 0 {
+			n.RetryDelay = time.Second
+		}
+		if n.HTTPClient == nil {
+			n.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+		}
+	})
+}
+
+// Notify queues the event for delivery to all hooks accepting its type. Missing id and time are set.
+// The event is dropped, as a dead letter, if the hook's queue is full.
+func (n *Notifier) Notify(event Event) {
+	n.init()
+	if event.ID == "" {
+		event.ID = eventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for i, h := range n.Hooks {
+		if !h.accepts(event.Type) {
+			continue
+		}
+		select {
+		case n.queues[i] <- event:
+		default:
+			deadLetter(h, event, fmt.Errorf("queue is full"))
+		}
+	}
+}
+
+// Run delivers queued events till the context is canceled, blocked call.
+// On cancellation, events already queued are delivered, up to DrainTimeout.
+func (n *Notifier) Run(ctx context.Context) {
+	n.init()
+	log.Printf("[INFO] webhooks activated, %d hooks", len(n.Hooks))
+	var wg sync.WaitGroup
+	for i, h := range n.Hooks {
+		wg.Add(1)
+		go func(h Hook, queue chan Event) {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					n.drain(h, queue)
+					return
+				case event := <-queue:
+					if ctx.Err() != nil { // stopped, the event is delivered with the rest of the queue
+						n.drain(h, queue, event)
+						return
+					}
+					if err := n.deliver(ctx, h, event); err != nil {
+						deadLetter(h, event, err)
+					}
+				}
+			}
+		}(h, n.queues[i])
+	}
+	wg.Wait()
+}
+
+// drain delivers the pending events and ones remaining in the queue of the hook, up to DrainTimeout.
+// Undelivered events are dead letters.
+func (n *Notifier) drain(h Hook, queue chan Event, pending ...Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.DrainTimeout)
+	defer cancel()
+	deliver := func(event Event) {
+		if ctx.Err() != nil {
+			deadLetter(h, event, errors.New("not delivered on shutdown"))
+			return
+		}
+		if err := n.deliver(ctx, h, event); err != nil {
+			deadLetter(h, event, err)
+		}
+	}
+	for _, event := range pending {
+		deliver(event)
+	}
+	for {
+		select {
+		case event := <-queue:
+			deliver(event)
+		default:
+			return
+		}
+	}
+}
+
+// deliver posts the event to the hook, retrying on network errors, 5xx and 429 responses
+func (n *Notifier) deliver(ctx context.Context, h Hook, event Event) error {
+	body, err := h.payload(event)
+	if err != nil {
+		return fmt.Errorf("failed to make payload: %w", err)
+	}
+
+	delay := n.RetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, h, event.Type, body)
+		if err == nil {
+			log.Printf("[DEBUG] webhook %s, %s event %s delivered", h.URL, event.Type, event.ID)
+			return nil
+		}
+		if !retry || attempt >= n.Retries {
+			return fmt.Errorf("failed after %d attempts: %w", attempt+1, err)
+		}
+		log.Printf("[DEBUG] webhook %s, %s event %s, retry in %v: %v", h.URL, event.Type, event.ID, delay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("canceled after %d attempts: %w", attempt+1, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post makes a single delivery attempt, returns true with the error if the attempt can be retried
+func (n *Notifier) post(ctx context.Context, h Hook, t EventType, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to make request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tg-spam")
+	req.Header.Set(EventHeader, string(t))
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // drain to reuse connection
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// Sign returns the signature of the body, "sha256=" and hex of hmac-sha256 of the body with the secret.
+// Receivers should calculate it for the raw request body and compare with the X-TG-Spam-Signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetter logs the event which can't be delivered, with the full payload to re-send it manually
+func deadLetter(h Hook, event Event, err error) {
+	payload, _ := json.Marshal(event)
+	log.Printf("[WARN] webhook %s, dead letter, %s event %s not delivered, %v: %s", h.URL, event.Type, event.ID, err, payload)
+}
+
+func eventID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+)
+
+func TestNotifier_Deliver(t *testing.T) {
+	var lock sync.Mutex
+	received := map[string][]Event{} // by path
+	signatures := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var event Event
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, string(event.Type), r.Header.Get(EventHeader))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		lock.Lock()
+		defer lock.Unlock()
+		received[r.URL.Path] = append(received[r.URL.Path], event)
+		if sig := r.Header.Get(SignatureHeader); sig != "" {
+			assert.Equal(t, Sign("secret", body), sig)
+			signatures = append(signatures, sig)
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := &Notifier{Hooks: []Hook{
+		{URL: ts.URL + "/all", Secret: "secret"},
+		{URL: ts.URL + "/bans", Events: []EventType{EventBan, EventUnban}},
+	}}
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+
+	n.Notify(Event{Type: EventSpam, ChatID: 123, UserID: 1, UserName: "spammer", Text: "buy now",
+		Checks: []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"}}})
+	n.Notify(Event{Type: EventBan, ChatID: 123, UserID: 1, UserName: "spammer"})
+	n.Notify(Event{Type: EventTrain, Text: "buy now", Sample: "spam"})
+
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received["/all"]) == 3 && len(received["/bans"]) == 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	all := received["/all"]
+	assert.Equal(t, []EventType{EventSpam, EventBan, EventTrain}, []EventType{all[0].Type, all[1].Type, all[2].Type},
+		"delivered in order")
+	assert.Equal(t, "spammer", all[0].UserName)
+	assert.Equal(t, []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy now"}}, all[0].Checks)
+	assert.NotEmpty(t, all[0].ID)
+	assert.False(t, all[0].Time.IsZero())
+	assert.Equal(t, "spam", all[2].Sample)
+	assert.Len(t, signatures, 3)
+
+	assert.Equal(t, EventBan, received["/bans"][0].Type)
+	assert.Equal(t, all[1].ID, received["/bans"][0].ID, "the same event id for all hooks")
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	tbl := []struct {
+		name      string
+		statuses  []int // statuses of attempts, the last one repeated
+		retries   int
+		attempts  int32
+		delivered bool
+	}{
+		{name: "ok", statuses: []int{200}, retries: 3, attempts: 1, delivered: true},
+		{name: "retried on 500", statuses: []int{500, 502, 200}, retries: 3, attempts: 3, delivered: true},
+		{name: "retried on 429", statuses: []int{429, 204}, retries: 3, attempts: 2, delivered: true},
+		{name: "retries exhausted", statuses: []int{503}, retries: 2, attempts: 3},
+		{name: "not retried on 400", statuses: []int{400}, retries: 3, attempts: 1},
+		{name: "no retries", statuses: []int{500}, retries: 0, attempts: 1},
+	}
+
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&attempts, 1)) - 1
+				w.WriteHeader(tt.statuses[min(i, len(tt.statuses)-1)])
+			}))
+			defer ts.Close()
+
+			n := &Notifier{Hooks: []Hook{{URL: ts.URL}}, Retries: tt.retries, RetryDelay: time.Millisecond}
+			n.init()
+			err := n.deliver(context.Background(), n.Hooks[0], Event{ID: "1", Type: EventBan})
+			if tt.delivered {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+		})
+	}
+
+	t.Run("network error", func(t *testing.T) {
+		n := &Notifier{Hooks: []Hook{{URL: "http://127.0.0.1:1"}}, Retries: 1, RetryDelay: time.Millisecond}
+		n.init()
+		err := n.deliver(context.Background(), n.Hooks[0], Event{ID: "1", Type: EventBan})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed after 2 attempts")
+	})
+}
+
+func TestNotifier_QueueFull(t *testing.T) {
+	n := &Notifier{Hooks: []Hook{{URL: "http://localhost"}}}
+	for i := 0; i < queueSize+10; i++ { // not running, nothing delivered
+		n.Notify(Event{Type: EventSpam})
+	}
+	assert.Len(t, n.queues[0], queueSize, "extra events dropped")
+}
+
+func TestNotifier_Drain(t *testing.T) {
+	var received atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer ts.Close()
+
+	t.Run("queued events delivered on stop", func(t *testing.T) {
+		received.Store(0)
+		n := &Notifier{Hooks: []Hook{{URL: ts.URL}}, DrainTimeout: time.Second}
+		for i := 0; i < 5; i++ {
+			n.Notify(Event{Type: EventSpam}) // queued before run
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		n.Run(ctx) // canceled run returns after drain
+		assert.Equal(t, int32(5), received.Load())
+		assert.Empty(t, n.queues[0])
+	})
+
+	t.Run("dropped without drain timeout", func(t *testing.T) {
+		received.Store(0)
+		n := &Notifier{Hooks: []Hook{{URL: ts.URL}}}
+		n.Notify(Event{Type: EventSpam})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		n.Run(ctx)
+		assert.Equal(t, int32(0), received.Load())
+		assert.Empty(t, n.queues[0], "dropped as dead letters")
+	})
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// circuitBreaker stops calls of a failing service after a number of consecutive failures. While open, calls are
+// skipped, and after the cooldown a single probe call is allowed to check if the service recovered. The probe
+// closes the breaker on success, or keeps it open for another cooldown on failure.
+type circuitBreaker struct {
+	threshold int                        // consecutive failures opening the breaker
+	cooldown  time.Duration              // time the breaker stays open before a probe call
+	onChange  func(open bool, err error) // optional, called when the breaker opens, with the last error, and closes
+	now       func() time.Time
+
+	lock     sync.Mutex
+	failures int       // number of consecutive failures
+	openedAt time.Time // time the breaker opened or the last probe failed, zero if closed
+	probing  bool      // probe call is in progress
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, onChange func(open bool, err error)) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, onChange: onChange, now: time.Now}
+}
+
+// allow returns true if the call can be made, i.e. the breaker is closed, or it is a probe call of the open breaker
+func (b *circuitBreaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success records successful call, closing the open breaker
+func (b *circuitBreaker) success() {
+	b.lock.Lock()
+	wasOpen := !b.openedAt.IsZero()
+	b.failures, b.openedAt, b.probing = 0, time.Time{}, false
+	b.lock.Unlock()
+	if wasOpen && b.onChange != nil {
+		b.onChange(false, nil)
+	}
+}
+
+// failure records failed call, opening the breaker after threshold of consecutive failures
+func (b *circuitBreaker) failure(err error) {
+	b.lock.Lock()
+	b.failures++
+	if !b.openedAt.IsZero() { // probe failed, stays open for another cooldown
+		b.openedAt, b.probing = b.now(), false
+		b.lock.Unlock()
+		return
+	}
+	opened := b.failures >= b.threshold
+	if opened {
+		b.openedAt = b.now()
+	}
+	b.lock.Unlock()
+	if opened && b.onChange != nil {
+		b.onChange(true, err)
+	}
+}
+
+// cancel releases the probe of the call canceled by the caller, it is neither success nor failure of the service
+func (b *circuitBreaker) cancel() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+}
+
+// isOpen returns true if the breaker is open, calls are skipped till the probe call succeeds
+func (b *circuitBreaker) isOpen() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return !b.openedAt.IsZero()
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	type change struct {
+		open bool
+		err  error
+	}
+	var changes []change
+	b := newCircuitBreaker(3, time.Minute, func(open bool, err error) { changes = append(changes, change{open, err}) })
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	// failures below threshold, reset by success
+	for i := 0; i < 2; i++ {
+		require.True(t, b.allow())
+		b.failure(errors.New("failed"))
+	}
+	require.True(t, b.allow())
+	b.success()
+	assert.False(t, b.isOpen())
+	assert.Empty(t, changes, "not opened, no change")
+
+	// opened after threshold
+	for i := 0; i < 3; i++ {
+		require.True(t, b.allow())
+		b.failure(errors.New("timeout"))
+	}
+	assert.True(t, b.isOpen())
+	assert.Equal(t, []change{{open: true, err: errors.New("timeout")}}, changes)
+	assert.False(t, b.allow(), "skipped while open")
+
+	// failed probe after cooldown keeps it open for another cooldown
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(), "probe allowed")
+	assert.False(t, b.allow(), "single probe at a time")
+	b.failure(errors.New("timeout"))
+	assert.False(t, b.allow())
+	assert.Len(t, changes, 1, "still open, no change")
+
+	// probe canceled by the caller is released
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow())
+	b.cancel()
+	assert.True(t, b.allow(), "probe allowed again")
+
+	// successful probe closes it
+	b.success()
+	assert.False(t, b.isOpen())
+	assert.True(t, b.allow())
+	assert.Equal(t, change{open: false}, changes[1])
+}
@@ -73,14 +73,10 @@ func (c *classifier) reset() {
 	c.nAllDocument = 0
 }
 
-// classify executes the classifying process for tokens
-func (c *classifier) classify(tokens ...string) (spamClass, float64, bool) {
+// classify executes the classifying process for tokens, with priors of classes learned or balanced
+func (c *classifier) classify(priors ClassifierPriors, tokens ...string) (spamClass, float64, bool) {
 	nVocabulary := len(c.learningResults)
-	posteriorProbabilities := make(map[spamClass]float64)
-
-	for class, priorProb := range c.priorProbabilities {
-		posteriorProbabilities[class] = priorProb
-	}
+	posteriorProbabilities := c.priors(priors)
 	tokens = c.removeDuplicate(tokens...)
 
 	for class, freqByClass := range c.nFrequencyByClass {
@@ -110,6 +106,27 @@ func (c *classifier) classify(tokens ...string) (spamClass, float64, bool) {
 	return bestClass, highestProb, certain
 }
 
+// priors returns log prior probabilities of classes. Learned priors are shares of documents of classes,
+// with smoothing added to the number of documents of each class. Balanced priors are equal for all classes.
+func (c *classifier) priors(p ClassifierPriors) map[spamClass]float64 {
+	res := make(map[spamClass]float64, len(c.nDocumentByClass))
+	if !p.Balanced && p.Smoothing <= 0 {
+		for class, priorProb := range c.priorProbabilities {
+			res[class] = priorProb
+		}
+		return res
+	}
+	nClasses := float64(len(c.nDocumentByClass))
+	for class, nDocument := range c.nDocumentByClass {
+		if p.Balanced {
+			res[class] = math.Log(1 / nClasses)
+			continue
+		}
+		res[class] = math.Log((float64(nDocument) + p.Smoothing) / (float64(c.nAllDocument) + nClasses*p.Smoothing))
+	}
+	return res
+}
+
 func (c *classifier) removeDuplicate(tokens ...string) []string {
 	mapTokens := make(map[string]struct{})
 	newTokens := []string{}
@@ -63,7 +63,7 @@ func TestClassifier_Classify(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			class, p, certain := classifier.classify(tt.tokens...)
+			class, p, certain := classifier.classify(ClassifierPriors{}, tt.tokens...)
 			t.Logf("probability: %v", p)
 			assert.InDelta(t, tt.probability, p, 0.01, "probability")
 			if !tt.certain {
@@ -74,3 +74,40 @@ func TestClassifier_Classify(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifier_Priors(t *testing.T) {
+	classifier := newClassifier()
+	for i := 0; i < 9; i++ {
+		classifier.learn(newDocument(bad, "bald", "poor"))
+	}
+	classifier.learn(newDocument(good, "tall", "rich"))
+
+	tests := []struct {
+		name        string
+		priors      ClassifierPriors
+		tokens      []string
+		expected    spamClass
+		certain     bool
+		probability float64
+	}{
+		{name: "learned", priors: ClassifierPriors{}, expected: bad, certain: true, probability: 90},
+		{name: "smoothed", priors: ClassifierPriors{Smoothing: 10}, expected: bad, certain: true, probability: 63.33},
+		{name: "balanced", priors: ClassifierPriors{Balanced: true}, certain: false, probability: 50},
+		{name: "balanced, smoothing ignored", priors: ClassifierPriors{Balanced: true, Smoothing: 10}, certain: false,
+			probability: 50},
+		{name: "balanced, tokens decide", priors: ClassifierPriors{Balanced: true}, tokens: []string{"tall", "rich"},
+			expected: good, certain: true, probability: 98.17},
+		{name: "learned, lowered by priors", priors: ClassifierPriors{}, tokens: []string{"tall", "rich"},
+			expected: good, certain: true, probability: 85.66},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class, p, certain := classifier.classify(tt.priors, tt.tokens...)
+			assert.InDelta(t, tt.probability, p, 0.01, "probability")
+			assert.Equal(t, tt.certain, certain, "certainty")
+			if tt.certain {
+				assert.Equal(t, tt.expected, class, "class")
+			}
+		})
+	}
+}
@@ -3,35 +3,58 @@ package lib
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"math"
+	"math/rand"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
 )
 
 //go:generate moq --out mocks/sample_updater.go --pkg mocks --skip-ensure . SampleUpdater
+//go:generate moq --out mocks/sourced_sample_updater.go --pkg mocks --skip-ensure . SourcedSampleUpdater
 //go:generate moq --out mocks/http_client.go --pkg mocks --skip-ensure . HTTPClient
 
 // Detector is a spam detector, thread-safe.
 // It uses a set of checks to determine if a message is spam, and also keeps a list of approved users.
 type Detector struct {
 	Config
-	classifier     classifier
-	openaiChecker  *openAIChecker
-	tokenizedSpam  []map[string]int
-	approvedUsers  map[string]int
-	stopWords      []string
-	excludedTokens []string
+	samplesIndex
+	openaiChecker *openAIChecker
+	stopWords     []string
+	scams         []compiledScam // scam patterns, no scam check if empty
+	scamsVersion  int            // version of loaded scam patterns
 
 	spamSamplesUpd SampleUpdater
 	hamSamplesUpd  SampleUpdater
+	userStorage    UserStorage
 
 	lock sync.RWMutex
+
+	// samples are loaded without the lock, updates made during the load are replayed to the loaded index
+	loadLock sync.Mutex       // serializes loads of samples
+	loading  bool             // samples are being loaded, updates are recorded to pending
+	pending  []pendingSamples // samples updated during the load
+
+	// approved users are updated on each check, so they have their own lock
+	approvedUsers map[string]*ApprovedUser
+	usersLock     sync.Mutex
+
+	now    func() time.Time // current time, for activity hours
+	random func() float64   // random number in [0, 1), for sampling of re-checks
 }
 
 // Config is a set of parameters for Detector.
@@ -40,18 +63,104 @@ type Config struct {
 	MinMsgLen           int        // minimum message length to check
 	MaxAllowedEmoji     int        // maximum number of emojis allowed in a message
 	CasAPI              string     // CAS API URL
+	LolsAPI             string     // lols.bot API URL, disabled if empty
 	FirstMessageOnly    bool       // if true, only the first message from a user is checked
 	FirstMessagesCount  int        // number of first messages to check for spam
 	HTTPClient          HTTPClient // http client to use for requests
 	MinSpamProbability  float64    // minimum spam probability to consider a message spam with classifier, if 0 - ignored
 	OpenAIVeto          bool       // if true, openai will be used to veto spam messages, otherwise it will be used to veto ham messages
+
+	SimilarityCategories map[string]SimilarityCategory // thresholds and actions of tagged spam samples, by lowercase category
+	SimilarityMinTokens  int                           // min number of tokens shared with spam sample to compare it, 1 if not set, all similar samples compared
+	ActivityHours        ActivityHours                 // active hours of the group, disabled if Boost is 0
+	CheckBudget          time.Duration                 // total time of checks of a message, slow checks are skipped if exceeded, 0 - unlimited
+	MaxMsgLen            int                           // max length of checked message in runes, longer messages are truncated, 0 - unlimited
+	NoSimilarityCorpus   bool                          // spam samples are learned by classifier only and not kept for similarity check, to save memory
+	HamVetoMargin        float64                       // spam of similarity and classifier is vetoed if message is more similar to ham by the margin, 0 - disabled
+	OpenAIPolicy         OpenAIPolicy                  // verdicts checked and overridden by openai, derived from OpenAIVeto if nothing is checked
+	Recheck              Recheck                       // re-checks of messages of approved users, disabled if Rate and Every are 0
+	ClassifierPriors     ClassifierPriors              // priors of classes of classifier, learned from numbers of samples if not set
+}
+
+// CheckDegraded is a name of check result reported if network checks were skipped or interrupted by CheckBudget.
+// The result is never spam, the decision is made by completed checks.
+const CheckDegraded = "degraded"
+
+// CheckHamVeto is a name of check result reported if spam verdict of similarity and classifier is vetoed,
+// because the message is more similar to ham samples than to spam ones by HamVetoMargin. The result is never spam,
+// the message is suspicious and can be reported for review.
+const CheckHamVeto = "ham veto"
+
+// ActivityHours is a heuristic for messages of new users posted at dead hours of the group, when campaign bots
+// often post. Boost is added to the spam probability of the classifier for such messages, so the heuristic
+// doesn't make message spam on its own. Users are new if no messages of them were checked as ham yet,
+// so it requires FirstMessageOnly or FirstMessagesCount.
+type ActivityHours struct {
+	Location *time.Location // timezone of the group, UTC if nil
+	Start    int            // start hour of active period, 0-23
+	End      int            // end hour of active period, exclusive, 1-24, the period wraps midnight if less than Start
+	Boost    float64        // percents added to spam probability, 0 disables the heuristic
+}
+
+// ClassifierPriors are priors of spam and ham classes of the classifier. By default priors are learned from numbers
+// of samples, so heavily spam-skewed samples, i.e. 10k spam and 500 ham, inflate spam probability of every message.
+// Balanced priors are equal, and the verdict is made by tokens of the message only. Smoothing adds virtual samples
+// to each class, pulling learned priors towards balanced ones, i.e. 1000 makes 11k:1.5k of 10k:500. Smoothing is
+// ignored with balanced priors.
+type ClassifierPriors struct {
+	Balanced  bool    // equal priors of classes, regardless of numbers of samples
+	Smoothing float64 // number of virtual samples added to each class for learned priors, 0 - disabled
+}
+
+// Recheck is a sampling of messages of approved users, re-checked to catch compromised or sleeper accounts
+// turned spammy after approval. Re-checks are cheap, with local checks only, so no CAS, lols.bot and OpenAI
+// requests are made. A message is re-checked if it is sampled at random with Rate, or it is every Every'th
+// message of the user. Users are approved with FirstMessageOnly or FirstMessagesCount only.
+type Recheck struct {
+	Rate  float64 // share of messages of approved users re-checked at random, 0.0 - 1.0
+	Every int     // every Nth message of approved user is re-checked, 0 - disabled
+}
+
+// CheckRecheck is a name of check result reported if the message of approved user is re-checked.
+// The result is never spam, the decision is made by local checks following it.
+const CheckRecheck = "recheck"
+
+// SimilarityAction is an action on message similar to spam sample of a category
+type SimilarityAction string
+
+// enum of similarity actions
+const (
+	SimilarityActionSpam   SimilarityAction = "spam"   // message is spam, the default
+	SimilarityActionReport SimilarityAction = "report" // similarity is reported in check details and logged, message is not spam
+)
+
+// SimilarityCategory is a threshold and action of spam samples tagged with the category. Samples are tagged
+// with "[category] " prefix, i.e. "[crypto] earn 100$ a day", samples without tag or of unknown category
+// are matched with SimilarityThreshold and make message spam.
+type SimilarityCategory struct {
+	Threshold float64          // threshold for spam similarity, 0.0 - 1.0
+	Action    SimilarityAction // action on similar message, SimilarityActionSpam if empty
+}
+
+// Thresholds is a set of detector parameters which can be changed at runtime with SetThresholds.
+type Thresholds struct {
+	SimilarityThreshold float64 // threshold for spam similarity, 0.0 - 1.0
+	MinMsgLen           int     // minimum message length to check
+	MaxAllowedEmoji     int     // maximum number of emojis allowed in a message, -1 disables the check
+	MinSpamProbability  float64 // minimum spam probability to consider a message spam with classifier, if 0 - ignored
 }
 
-// CheckResult is a result of spam check.
-type CheckResult struct {
-	Name    string `json:"name"`    // name of the check
-	Spam    bool   `json:"spam"`    // true if spam
-	Details string `json:"details"` // details of the check
+// CheckResult is a result of spam check, defined in spamcheck package to be shared with clients of the check api.
+type CheckResult = spamcheck.Result
+
+// ApprovedUser is a user known to detector, with some metadata.
+// User is approved, i.e. not checked anymore, if Count exceeds Config.FirstMessagesCount.
+type ApprovedUser struct {
+	UserID    string    `json:"user_id"`
+	UserName  string    `json:"user_name,omitempty"`
+	Count     int       `json:"count"`      // number of ham messages, set to FirstMessagesCount+1 for users approved manually
+	FirstSeen time.Time `json:"first_seen"` // time of the first ham message or manual approval
+	LastSeen  time.Time `json:"last_seen"`  // time of the last message
 }
 
 // LoadResult is a result of loading samples.
@@ -68,6 +177,26 @@ type SampleUpdater interface {
 	Reader() (io.ReadCloser, error) // return a reader for the samples storage
 }
 
+// SourcedSampleUpdater is a SampleUpdater recording provenance of appended samples, i.e. who added them.
+// Detector appends samples with AppendFrom if the updater implements it.
+type SourcedSampleUpdater interface {
+	SampleUpdater
+	AppendFrom(msg, source string) error // append a message added by the source to the samples storage
+}
+
+// UserStorage is an interface for persisting approved users on each change.
+// Detector calls it on every update of the user, so implementations should be fast, i.e. batch writes.
+type UserStorage interface {
+	Write(user ApprovedUser) error // write (insert or replace) the user
+	Delete(userID string) error    // delete the user by id
+}
+
+// UserLoader is an optional interface of UserStorage shared by several instances, i.e. in redis. Users unknown to the
+// detector are loaded from it on their messages, so users approved by other instances are approved by this one too.
+type UserLoader interface {
+	Load(userID string) (user ApprovedUser, ok bool, err error) // load the user by id, ok is false if not found
+}
+
 // HTTPClient is an interface for http client, satisfied by http.Client.
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
@@ -77,9 +206,10 @@ type HTTPClient interface {
 func NewDetector(p Config) *Detector {
 	res := &Detector{
 		Config:        p,
-		classifier:    newClassifier(),
-		approvedUsers: make(map[string]int),
-		tokenizedSpam: []map[string]int{},
+		samplesIndex:  newSamplesIndex(),
+		approvedUsers: make(map[string]*ApprovedUser),
+		now:           time.Now,
+		random:        rand.Float64, //nolint:gosec // no need for crypto rand
 	}
 	// if FirstMessagesCount is set, FirstMessageOnly enforced to true.
 	// this is to avoid confusion when FirstMessagesCount is set but FirstMessageOnly is false.
@@ -95,8 +225,88 @@ func (d *Detector) WithOpenAIChecker(client openAIClient, config OpenAIConfig) {
 	d.openaiChecker = newOpenAIChecker(client, config)
 }
 
+// SetOpenAIPrompt changes the system prompt of OpenAI checker, i.e. re-rendered from the changed template file.
+// The default prompt is set if empty. No-op if OpenAI checker is not set.
+func (d *Detector) SetOpenAIPrompt(prompt string) {
+	if d.openaiChecker == nil {
+		return
+	}
+	d.openaiChecker.setPrompt(prompt)
+}
+
+// OpenAIUsage returns usage of OpenAI for the current day, zero if OpenAI checker is not set
+func (d *Detector) OpenAIUsage() OpenAIUsage {
+	if d.openaiChecker == nil {
+		return OpenAIUsage{}
+	}
+	return d.openaiChecker.usage.usage()
+}
+
+// AddOpenAIUsage adds usage of OpenAI to the current day, i.e. to restore it on restart to keep the daily budget.
+// It is not written to the usage storage, and the budget notification is not sent if the budget is exceeded by it.
+func (d *Detector) AddOpenAIUsage(usage OpenAIUsage) {
+	if d.openaiChecker == nil {
+		return
+	}
+	d.openaiChecker.usage.add(usage)
+}
+
+// SuspendOpenAI suspends or resumes OpenAI requests, i.e. if the quota of the tenant is exceeded.
+// Suspended requests are skipped, as with the exceeded daily budget. No-op if OpenAI checker is not set.
+func (d *Detector) SuspendOpenAI(suspend bool) {
+	if d.openaiChecker == nil {
+		return
+	}
+	d.openaiChecker.suspended.Store(suspend)
+}
+
+// WithOpenAIUsageStorage sets a storage of OpenAI usage, usage of each following request is added to it.
+// It should be called after WithOpenAIChecker, no-op if OpenAI checker is not set.
+func (d *Detector) WithOpenAIUsageStorage(s OpenAIUsageStorage) {
+	if d.openaiChecker == nil {
+		return
+	}
+	d.openaiChecker.usage.lock.Lock()
+	defer d.openaiChecker.usage.lock.Unlock()
+	d.openaiChecker.usage.storage = s
+}
+
 // Check checks if a given message is spam. Returns true if spam and also returns a list of check results.
 func (d *Detector) Check(msg, userID string) (spam bool, cr []CheckResult) {
+	return d.check(context.Background(), msg, userID, true)
+}
+
+// CheckContext checks if a given message is spam, as Check does. The context is passed to network-based checks,
+// i.e. CAS and OpenAI requests, so they can be canceled and traced with the caller's context.
+func (d *Detector) CheckContext(ctx context.Context, msg, userID string) (spam bool, cr []CheckResult) {
+	return d.check(ctx, msg, userID, true)
+}
+
+// CheckLocal checks if a given message is spam, as Check does, but skips network-based checks, i.e. CAS and OpenAI.
+// It is useful for re-scanning large amounts of messages, where remote calls are too slow or expensive.
+func (d *Detector) CheckLocal(msg, userID string) (spam bool, cr []CheckResult) {
+	return d.check(context.Background(), msg, userID, false)
+}
+
+// CheckUser checks if a given user is a known spammer with CAS and lols.bot, without a message, i.e. on join.
+// Returns false with no results if neither CAS nor lols.bot is set.
+func (d *Detector) CheckUser(ctx context.Context, userID string) (spam bool, cr []CheckResult) {
+	if d.CasAPI != "" {
+		cr = append(cr, d.isCasSpam(ctx, userID))
+	}
+	if d.LolsAPI != "" {
+		cr = append(cr, d.isLolsSpam(ctx, userID))
+	}
+	for _, r := range cr {
+		if r.Spam {
+			return true, cr
+		}
+	}
+	return false, cr
+}
+
+// check performs all the checks, network-based checks are performed only if network is true
+func (d *Detector) check(ctx context.Context, msg, userID string, network bool) (spam bool, cr []CheckResult) {
 
 	isSpamDetected := func(cr []CheckResult) bool {
 		for _, r := range cr {
@@ -107,12 +317,54 @@ func (d *Detector) Check(msg, userID string) (spam bool, cr []CheckResult) {
 		return false
 	}
 
+	// absurdly long messages are truncated before tokenization, so checks can't be made pathologically slow
+	if d.MaxMsgLen > 0 {
+		msg = truncateRunes(msg, d.MaxMsgLen)
+	}
+
 	d.lock.RLock()
 	defer d.lock.RUnlock()
 
-	// approved user don't need to be checked
-	if d.FirstMessageOnly && d.approvedUsers[userID] > d.FirstMessagesCount {
-		return false, []CheckResult{{Name: "pre-approved", Spam: false, Details: "user already approved"}}
+	// network checks are limited by check budget, counted from the start of the check. Checks started after
+	// the budget is exceeded are skipped, and the running one is interrupted, so latency of the group is bounded
+	// if CAS or OpenAI are slow. Skipped and interrupted checks are reported with degraded result.
+	var degraded []string
+	if network && d.CheckBudget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.CheckBudget)
+		defer cancel()
+	}
+	overBudget := func() bool { return d.CheckBudget > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) }
+	runNetwork := func(name string, check func() CheckResult) (completed bool) {
+		if overBudget() {
+			degraded = append(degraded, name+" skipped")
+			return false
+		}
+		cr = append(cr, check())
+		if overBudget() {
+			degraded = append(degraded, name+" interrupted")
+			return false
+		}
+		return true
+	}
+	defer func() {
+		if len(degraded) > 0 {
+			cr = append(cr, CheckResult{Name: CheckDegraded, Spam: false,
+				Details: fmt.Sprintf("check budget %v exceeded, %s", d.CheckBudget, strings.Join(degraded, ", "))})
+		}
+	}()
+
+	// approved user don't need to be checked, unless the message is sampled for re-check with local checks only
+	recheck := false
+	if d.FirstMessageOnly {
+		var approved bool
+		if approved, recheck = d.isApproved(userID); approved && !recheck {
+			return false, []CheckResult{{Name: "pre-approved", Spam: false, Details: "user already approved"}}
+		}
+	}
+	if recheck {
+		network = false
+		cr = append(cr, CheckResult{Name: CheckRecheck, Spam: false, Details: "approved user re-checked"})
 	}
 
 	// all the checks are performed sequentially, so we can collect all the results
@@ -122,6 +374,11 @@ func (d *Detector) Check(msg, userID string) (spam bool, cr []CheckResult) {
 		cr = append(cr, d.isStopWord(msg))
 	}
 
+	// check for common scam templates if scam patterns are loaded
+	if len(d.scams) > 0 {
+		cr = append(cr, d.isScam(msg))
+	}
+
 	// check for emojis if max allowed emojis is set
 	if d.MaxAllowedEmoji >= 0 {
 		cr = append(cr, d.isManyEmojis(msg))
@@ -129,7 +386,7 @@ func (d *Detector) Check(msg, userID string) (spam bool, cr []CheckResult) {
 
 	// check for message length exceed the minimum size, if min message length is set.
 	// the check is done after first simple checks, because stop words and emojis can be triggered by short messages as well.
-	if len([]rune(msg)) < d.MinMsgLen {
+	if utf8.RuneCountInString(msg) < d.MinMsgLen {
 		cr = append(cr, CheckResult{Name: "message length", Spam: false, Details: "too short"})
 		if isSpamDetected(cr) {
 			return true, cr // spam from checks above
@@ -137,32 +394,70 @@ func (d *Detector) Check(msg, userID string) (spam bool, cr []CheckResult) {
 		return false, cr
 	}
 
-	// check for spam similarity  if similarity threshold is set and spam samples are loaded
-	if d.SimilarityThreshold > 0 && len(d.tokenizedSpam) > 0 {
+	// check for spam similarity if similarity threshold or thresholds of categories are set and spam samples are loaded
+	if (d.SimilarityThreshold > 0 || len(d.SimilarityCategories) > 0) && d.spamSamples.len() > 0 {
 		cr = append(cr, d.isSpamSimilarityHigh(msg))
 	}
 
-	// check for spam with classifier if classifier is loaded
+	// check for spam with classifier if classifier is loaded. Spam probability is boosted for messages of new users
+	// posted outside of active hours, if set. Activity hours are reported without making message spam.
 	if d.classifier.nAllDocument > 0 {
-		cr = append(cr, d.isSpamClassified(msg))
+		var boost float64
+		if d.ActivityHours.Boost > 0 && d.IsNewUser(userID) {
+			if res, outside := d.isDeadHours(); outside {
+				boost = d.ActivityHours.Boost
+				cr = append(cr, res)
+			}
+		}
+		cr = append(cr, d.isSpamClassified(msg, boost))
+	}
+
+	// spam verdict of similarity and classifier is vetoed if the message is more similar to ham samples,
+	// so legitimate messages sharing many tokens with spam are downgraded to suspicious and not banned
+	if d.HamVetoMargin > 0 && d.hamSamples.len() > 0 {
+		if res, vetoed := d.hamVeto(msg, cr); vetoed {
+			cr = append(cr, res)
+		}
 	}
 
 	// check for spam with CAS API if CAS API URL is set
-	if d.CasAPI != "" {
-		cr = append(cr, d.isCasSpam(userID))
+	if network && d.CasAPI != "" {
+		runNetwork("cas", func() CheckResult { return d.isCasSpam(ctx, userID) })
+	}
+
+	// check for spam with lols.bot API if lols.bot API URL is set
+	if network && d.LolsAPI != "" {
+		runNetwork("lols", func() CheckResult { return d.isLolsSpam(ctx, userID) })
 	}
 
 	spamDetected := isSpamDetected(cr)
 
-	// we hit openai in two cases:
-	//  - all other checks passed (ham result) and OpenAIVeto is false. In this case, openai primary used to improve false negative rate
-	//  - one of the checks failed (spam result) and OpenAIVeto is true. In this case, openai primary used to improve false positive rate
+	// we hit openai if the verdict of other checks is one of verdicts checked by the policy:
+	//  - ham result, by default (OpenAIVeto is false). In this case, openai primary used to improve false negative rate
+	//  - spam result, with OpenAIVeto. In this case, openai primary used to improve false positive rate
 	// FirstMessageOnly or FirstMessagesCount has to be set to use openai, because it's slow and expensive to run on all messages
-	if d.openaiChecker != nil && (d.FirstMessageOnly || d.FirstMessagesCount > 0) {
-		if !spamDetected && !d.OpenAIVeto || spamDetected && d.OpenAIVeto {
-			spam, details := d.openaiChecker.check(msg)
-			cr = append(cr, details)
-			spamDetected = spam
+	policy := d.openAIPolicy()
+	if network && d.openaiChecker != nil && (d.FirstMessageOnly || d.FirstMessagesCount > 0) {
+		if !spamDetected && policy.OnHam || spamDetected && policy.OnSpam {
+			var resp openAIResponse
+			var err error
+			completed := runNetwork("openai", func() (details CheckResult) {
+				resp, details, err = d.openaiChecker.check(ctx, msg)
+				return details
+			})
+			// the verdict of other checks is kept if openai is skipped or interrupted by check budget
+			if completed {
+				var ignored string
+				spamDetected, ignored = policy.verdict(spamDetected, resp.IsSpam, resp.Confidence, err != nil,
+					d.openaiChecker.params.FailClosed)
+				if ignored != "" {
+					cr[len(cr)-1].Details += ", ignored, " + ignored
+				}
+				// warn and report categories are reported for ham verdict only, spam is banned anyway
+				if res, ok := d.openaiChecker.categoryResult(resp); ok && !spamDetected {
+					cr = append(cr, res)
+				}
+			}
 		}
 	}
 
@@ -170,22 +465,55 @@ func (d *Detector) Check(msg, userID string) (spam bool, cr []CheckResult) {
 		return true, cr
 	}
 
-	if d.FirstMessageOnly || d.FirstMessagesCount > 0 {
-		d.approvedUsers[userID]++
+	if (d.FirstMessageOnly || d.FirstMessagesCount > 0) && !recheck { // re-checked message is counted on approval check
+		d.countHam(userID)
 	}
 	return false, cr
 }
 
+// openAIPolicy returns OpenAIPolicy, or the policy of OpenAIVeto if it checks no verdicts
+func (c Config) openAIPolicy() OpenAIPolicy {
+	if c.OpenAIPolicy.OnHam || c.OpenAIPolicy.OnSpam {
+		return c.OpenAIPolicy
+	}
+	if c.OpenAIVeto {
+		return OpenAIPolicy{OnSpam: true, Rescue: true}
+	}
+	return OpenAIPolicy{OnHam: true, Ban: true}
+}
+
+// Thresholds returns the current thresholds of the checks.
+func (d *Detector) Thresholds() Thresholds {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return Thresholds{SimilarityThreshold: d.SimilarityThreshold, MinMsgLen: d.MinMsgLen,
+		MaxAllowedEmoji: d.MaxAllowedEmoji, MinSpamProbability: d.MinSpamProbability}
+}
+
+// SetThresholds changes thresholds of the checks without reloading samples, thread-safe.
+// Checks in progress are finished with the previous thresholds.
+func (d *Detector) SetThresholds(t Thresholds) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.SimilarityThreshold, d.MinMsgLen = t.SimilarityThreshold, t.MinMsgLen
+	d.MaxAllowedEmoji, d.MinSpamProbability = t.MaxAllowedEmoji, t.MinSpamProbability
+}
+
 // Reset resets spam samples/classifier, excluded tokens, stop words and approved users.
 func (d *Detector) Reset() {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	d.tokenizedSpam = []map[string]int{}
+	d.spamSamples.reset()
+	d.hamSamples.reset()
 	d.excludedTokens = []string{}
 	d.classifier.reset()
-	d.approvedUsers = make(map[string]int)
 	d.stopWords = []string{}
+	d.learned = make(map[uint64]struct{})
+
+	d.usersLock.Lock()
+	d.approvedUsers = make(map[string]*ApprovedUser)
+	d.usersLock.Unlock()
 }
 
 // WithSpamUpdater sets a SampleUpdater for spam samples.
@@ -194,111 +522,313 @@ func (d *Detector) WithSpamUpdater(s SampleUpdater) { d.spamSamplesUpd = s }
 // WithHamUpdater sets a SampleUpdater for ham samples.
 func (d *Detector) WithHamUpdater(s SampleUpdater) { d.hamSamplesUpd = s }
 
+// WithUserStorage sets a UserStorage for approved users. All the following changes of approved users are written to it.
+func (d *Detector) WithUserStorage(s UserStorage) {
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	d.userStorage = s
+}
+
 // AddApprovedUsers adds user IDs to the list of approved users.
 func (d *Detector) AddApprovedUsers(ids ...string) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
 	for _, id := range ids {
-		d.approvedUsers[id] = d.FirstMessagesCount + 1 // +1 to skip first message check if count is 0
+		d.AddApprovedUser(ApprovedUser{UserID: id})
+	}
+}
+
+// AddApprovedUser adds a user with metadata to the list of approved users.
+// If the user is already known, it is approved and its metadata updated with non-empty values of the given user.
+func (d *Detector) AddApprovedUser(user ApprovedUser) {
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	if d.approvedUsers == nil {
+		d.approvedUsers = make(map[string]*ApprovedUser)
+	}
+
+	minCount := d.FirstMessagesCount + 1 // +1 to skip first message check if count is 0
+	if user.Count < minCount {
+		user.Count = minCount
+	}
+	if user.FirstSeen.IsZero() {
+		user.FirstSeen = time.Now()
+	}
+
+	existing, ok := d.approvedUsers[user.UserID]
+	if !ok {
+		d.approvedUsers[user.UserID] = &user
+		d.writeUser(user)
+		return
+	}
+	existing.Count = max(existing.Count, user.Count)
+	if user.UserName != "" {
+		existing.UserName = user.UserName
+	}
+	if user.LastSeen.After(existing.LastSeen) {
+		existing.LastSeen = user.LastSeen
+	}
+	d.writeUser(*existing)
+}
+
+// SetApprovedUserName sets the name of already known user, does nothing for unknown users.
+func (d *Detector) SetApprovedUserName(userID, userName string) {
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	if user, ok := d.approvedUsers[userID]; ok && userName != "" && user.UserName != userName {
+		user.UserName = userName
+		d.writeUser(*user)
 	}
 }
 
 // RemoveApprovedUsers removes user IDs from the list of approved users.
 func (d *Detector) RemoveApprovedUsers(ids ...string) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
 	for _, id := range ids {
 		delete(d.approvedUsers, id)
+		if d.userStorage != nil {
+			if err := d.userStorage.Delete(id); err != nil {
+				log.Printf("[WARN] failed to delete approved user %s from storage: %v", id, err)
+			}
+		}
+	}
+}
+
+// IsNewUser returns true if no messages of the user were checked as ham yet, and the user is not approved manually.
+// Always false if users are not tracked, i.e. neither FirstMessageOnly nor FirstMessagesCount set.
+func (d *Detector) IsNewUser(userID string) bool {
+	if !d.FirstMessageOnly && d.FirstMessagesCount == 0 {
+		return false
+	}
+	d.loadUser(userID)
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	_, ok := d.approvedUsers[userID]
+	return !ok
+}
+
+// isApproved checks if user is approved and updates its last seen time and messages count.
+// recheck is true if the message of approved user is sampled for re-check by Config.Recheck.
+func (d *Detector) isApproved(userID string) (approved, recheck bool) {
+	d.loadUser(userID)
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	user, ok := d.approvedUsers[userID]
+	if !ok || user.Count <= d.FirstMessagesCount {
+		return false, false
+	}
+	user.Count++
+	user.LastSeen = time.Now()
+	d.writeUser(*user)
+	recheck = d.Recheck.Every > 0 && user.Count%d.Recheck.Every == 0 || d.Recheck.Rate > 0 && d.random() < d.Recheck.Rate
+	return true, recheck
+}
+
+// countHam counts ham message for the user, adds unknown user to the list
+func (d *Detector) countHam(userID string) {
+	d.loadUser(userID)
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	now := time.Now()
+	user, ok := d.approvedUsers[userID]
+	if !ok {
+		user = &ApprovedUser{UserID: userID, FirstSeen: now}
+		d.approvedUsers[userID] = user
+	}
+	user.Count++
+	user.LastSeen = now
+	d.writeUser(*user)
+}
+
+// loadUser loads the user unknown to the detector from the user storage, if it implements UserLoader.
+// The storage is called without the lock, so checks of other users are not blocked by it.
+func (d *Detector) loadUser(userID string) {
+	d.usersLock.Lock()
+	_, known := d.approvedUsers[userID]
+	loader, ok := d.userStorage.(UserLoader)
+	d.usersLock.Unlock()
+	if known || !ok || userID == "" {
+		return
+	}
+
+	user, found, err := loader.Load(userID)
+	if err != nil {
+		log.Printf("[WARN] failed to load approved user %s from storage: %v", userID, err)
+		return
+	}
+	if !found {
+		return
+	}
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	if d.approvedUsers == nil {
+		d.approvedUsers = make(map[string]*ApprovedUser)
+	}
+	if _, ok := d.approvedUsers[userID]; !ok { // not added while loaded
+		d.approvedUsers[userID] = &user
+	}
+}
+
+// writeUser writes the user to the user storage, if set. Must be called under usersLock.
+func (d *Detector) writeUser(user ApprovedUser) {
+	if d.userStorage == nil {
+		return
+	}
+	if err := d.userStorage.Write(user); err != nil {
+		log.Printf("[WARN] failed to write approved user %s to storage: %v", user.UserID, err)
 	}
 }
 
 // LoadSamples loads spam samples from a reader and updates the classifier.
-// Reset spam, ham samples/classifier, and excluded tokens.
+// Reset spam, ham samples/classifier, and excluded tokens. The new index is built aside and swapped in at once,
+// so checks are made with the previous samples during the load and not paused. Samples updated during the load
+// are learned by the loaded index too.
 func (d *Detector) LoadSamples(exclReader io.Reader, spamReaders, hamReaders []io.Reader) (LoadResult, error) {
+	d.loadLock.Lock()
+	defer d.loadLock.Unlock()
+
 	d.lock.Lock()
-	defer d.lock.Unlock()
+	d.loading, d.pending = true, nil
+	d.lock.Unlock()
 
-	d.tokenizedSpam = []map[string]int{}
-	d.excludedTokens = []string{}
-	d.classifier.reset()
+	idx := newSamplesIndex()
+	idx.spamSamples.reset()
+	idx.hamSamples.reset()
+	idx.excludedTokens = []string{}
 
 	// excluded tokens should be loaded before spam samples to exclude them from spam tokenization
 	for t := range d.tokenChan(exclReader) {
-		d.excludedTokens = append(d.excludedTokens, strings.ToLower(t))
+		idx.excludedTokens = append(idx.excludedTokens, strings.ToLower(t))
 	}
-	lr := LoadResult{ExcludedTokens: len(d.excludedTokens)}
+	lr := LoadResult{ExcludedTokens: len(idx.excludedTokens)}
 
 	// load spam samples and update the classifier with them
 	docs := []document{}
 	for token := range d.tokenChan(spamReaders...) {
-		tokenizedSpam := d.tokenize(token)
-		d.tokenizedSpam = append(d.tokenizedSpam, tokenizedSpam) // add to list of samples
+		category, sample := splitSampleCategory(token)
+		tokenizedSpam := idx.tokenize(sample)
+		if !d.NoSimilarityCorpus {
+			idx.spamSamples.add(tokenizedSpam, category) // add to list of samples
+		}
 		tokens := make([]string, 0, len(tokenizedSpam))
 		for token := range tokenizedSpam {
 			tokens = append(tokens, token)
 		}
 		docs = append(docs, document{spamClass: "spam", tokens: tokens})
+		idx.learned[sampleHash("spam", token)] = struct{}{}
 		lr.SpamSamples++
 	}
 
 	// load ham samples and update the classifier with them
 	for token := range d.tokenChan(hamReaders...) {
-		tokenizedSpam := d.tokenize(token)
+		tokenizedSpam := idx.tokenize(token)
+		if d.keepHamSamples() {
+			idx.hamSamples.add(tokenizedSpam, "") // ham samples are kept for ham veto only
+		}
 		tokens := make([]string, 0, len(tokenizedSpam))
 		for token := range tokenizedSpam {
 			tokens = append(tokens, token)
 		}
 		docs = append(docs, document{spamClass: "ham", tokens: tokens})
+		idx.learned[sampleHash("ham", token)] = struct{}{}
 		lr.HamSamples++
 	}
+	idx.classifier.learn(docs...)
 
-	d.classifier.learn(docs...)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, p := range d.pending {
+		d.learnSamples(&idx, p.class, p.samples) // samples read by the load already are skipped
+	}
+	d.samplesIndex = idx
+	d.loading, d.pending = false, nil
 	return lr, nil
 }
 
 // LoadStopWords loads stop words from a reader. Reset stop words list before loading.
 func (d *Detector) LoadStopWords(readers ...io.Reader) (LoadResult, error) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-
-	d.stopWords = []string{}
+	stopWords := []string{}
 	for t := range d.tokenChan(readers...) {
-		d.stopWords = append(d.stopWords, strings.ToLower(t))
+		stopWords = append(stopWords, strings.ToLower(t))
 	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.stopWords = stopWords
 	log.Printf("[INFO] loaded %d stop words", len(d.stopWords))
 	return LoadResult{StopWords: len(d.stopWords)}, nil
 }
 
+// LoadScamPatterns replaces scam patterns of the detector, i.e. with BuiltinScamPatterns or a newer version
+// of the feed. Patterns are kept on Reset, as they are not samples. Empty patterns disable the scam check.
+func (d *Detector) LoadScamPatterns(p ScamPatterns) error {
+	scams, err := compileScams(p)
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.scams, d.scamsVersion = scams, p.Version
+	log.Printf("[INFO] loaded %d scam patterns, version %d", len(scams), p.Version)
+	return nil
+}
+
+// ScamPatternsVersion returns the version of loaded scam patterns, 0 if not loaded
+func (d *Detector) ScamPatternsVersion() int {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if len(d.scams) == 0 {
+		return 0
+	}
+	return d.scamsVersion
+}
+
 // UpdateSpam appends a message to the spam samples file and updates the classifier
-func (d *Detector) UpdateSpam(msg string) error { return d.updateSample(msg, d.spamSamplesUpd, "spam") }
+func (d *Detector) UpdateSpam(msg string) error {
+	return d.updateSample(msg, "", d.spamSamplesUpd, "spam")
+}
 
 // UpdateHam appends a message to the ham samples file and updates the classifier
-func (d *Detector) UpdateHam(msg string) error { return d.updateSample(msg, d.hamSamplesUpd, "ham") }
+func (d *Detector) UpdateHam(msg string) error {
+	return d.updateSample(msg, "", d.hamSamplesUpd, "ham")
+}
 
-// ApprovedUsers returns a list of approved users.
-func (d *Detector) ApprovedUsers() (res []string) {
-	d.lock.RLock()
-	defer d.lock.RUnlock()
-	res = make([]string, 0, len(d.approvedUsers))
-	for userID := range d.approvedUsers {
-		res = append(res, userID)
+// UpdateSpamFrom is UpdateSpam of a message added by the source, i.e. admin or api client.
+// The source is recorded by updaters implementing SourcedSampleUpdater.
+func (d *Detector) UpdateSpamFrom(msg, source string) error {
+	return d.updateSample(msg, source, d.spamSamplesUpd, "spam")
+}
+
+// UpdateHamFrom is UpdateHam of a message added by the source, i.e. admin or api client.
+// The source is recorded by updaters implementing SourcedSampleUpdater.
+func (d *Detector) UpdateHamFrom(msg, source string) error {
+	return d.updateSample(msg, source, d.hamSamplesUpd, "ham")
+}
+
+// ApprovedUsers returns a list of approved users with their metadata, sorted by user ID.
+func (d *Detector) ApprovedUsers() (res []ApprovedUser) {
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	res = make([]ApprovedUser, 0, len(d.approvedUsers))
+	for _, user := range d.approvedUsers {
+		res = append(res, *user)
 	}
+	sort.Slice(res, func(i, j int) bool { return res[i].UserID < res[j].UserID })
 	return res
 }
 
 // LoadApprovedUsers loads a list of approved users from a reader.
 // reset approved users list before loading. It expects a list of user IDs (int64) from the reader, one per line.
 func (d *Detector) LoadApprovedUsers(r io.Reader) (count int, err error) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-	d.approvedUsers = make(map[string]int)
+	d.usersLock.Lock()
+	defer d.usersLock.Unlock()
+	d.approvedUsers = make(map[string]*ApprovedUser)
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		userID := scanner.Text()
 		if userID == "" {
 			continue
 		}
-		d.approvedUsers[userID] = d.FirstMessagesCount + 1
+		d.approvedUsers[userID] = &ApprovedUser{UserID: userID, Count: d.FirstMessagesCount + 1, FirstSeen: time.Now()}
 		count++
 	}
 
@@ -307,7 +837,7 @@ func (d *Detector) LoadApprovedUsers(r io.Reader) (count int, err error) {
 
 // updateSample appends a message to the samples file and updates the classifier
 // doesn't reset state, update append samples
-func (d *Detector) updateSample(msg string, upd SampleUpdater, sc spamClass) error {
+func (d *Detector) updateSample(msg, source string, upd SampleUpdater, sc spamClass) error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
@@ -315,23 +845,91 @@ func (d *Detector) updateSample(msg string, upd SampleUpdater, sc spamClass) err
 		return nil
 	}
 
-	// write to dynamic samples storage
-	if err := upd.Append(msg); err != nil {
+	// skip the message learned already, i.e. confirmed by admins more than once, so it doesn't skew the classifier
+	samples := []string{}
+	for token := range d.tokenChan(bytes.NewBufferString(msg)) {
+		if _, ok := d.learned[sampleHash(sc, token)]; !ok {
+			samples = append(samples, token)
+		}
+	}
+	if len(samples) == 0 {
+		log.Printf("[DEBUG] %s sample %q is known already, skipped", sc, msg)
+		return nil
+	}
+
+	// write to dynamic samples storage, with the source if the storage records it
+	appendFn := upd.Append
+	if su, ok := upd.(SourcedSampleUpdater); ok {
+		appendFn = func(msg string) error { return su.AppendFrom(msg, source) }
+	}
+	if err := appendFn(msg); err != nil {
 		return fmt.Errorf("can't update %s samples: %w", sc, err)
 	}
 
-	// load samples and update the classifier with them
+	// update the classifier with the new samples
+	d.learnSamples(&d.samplesIndex, sc, samples)
+	if d.loading {
+		// samples being loaded may miss the update, it's learned by the loaded index before the swap
+		d.pending = append(d.pending, pendingSamples{class: sc, samples: samples})
+	}
+	return nil
+}
+
+// learnSamples updates the index with new samples of the class, samples learned by the index already are skipped.
+// Spam samples are learned by the classifier only, ham samples are kept for ham veto too.
+func (d *Detector) learnSamples(idx *samplesIndex, sc spamClass, samples []string) {
 	docs := []document{}
-	for token := range d.tokenChan(bytes.NewBufferString(msg)) {
-		tokenizedSample := d.tokenize(token)
+	for _, sample := range samples {
+		if _, ok := idx.learned[sampleHash(sc, sample)]; ok {
+			continue
+		}
+		_, text := splitSampleCategory(sample)
+		tokenizedSample := idx.tokenize(text)
+		if sc == "ham" && d.keepHamSamples() {
+			idx.hamSamples.add(tokenizedSample, "")
+		}
 		tokens := make([]string, 0, len(tokenizedSample))
 		for token := range tokenizedSample {
 			tokens = append(tokens, token)
 		}
 		docs = append(docs, document{spamClass: sc, tokens: tokens})
+		idx.learned[sampleHash(sc, sample)] = struct{}{}
 	}
-	d.classifier.learn(docs...)
-	return nil
+	if len(docs) > 0 {
+		idx.classifier.learn(docs...)
+	}
+}
+
+// keepHamSamples returns true if ham samples are kept for ham veto
+func (d *Detector) keepHamSamples() bool {
+	return d.HamVetoMargin > 0 && !d.NoSimilarityCorpus
+}
+
+// samplesIndex is the state of the detector built from samples: the classifier, tokenized samples
+// and excluded tokens. LoadSamples builds a new index and swaps it in, checks use the current one.
+type samplesIndex struct {
+	classifier     classifier
+	spamSamples    corpus // tokenized spam samples with categories, for similarity check
+	hamSamples     corpus // tokenized ham samples, for ham veto of similarity and classifier
+	excludedTokens []string
+	learned        map[uint64]struct{} // hashes of samples learned by the classifier, to skip duplicates on update
+}
+
+// pendingSamples are samples of the class updated during the load of samples
+type pendingSamples struct {
+	class   spamClass
+	samples []string
+}
+
+func newSamplesIndex() samplesIndex {
+	return samplesIndex{classifier: newClassifier(), learned: make(map[uint64]struct{})}
+}
+
+// sampleHash returns hash of the sample of the class, to check if it's learned already
+func sampleHash(sc spamClass, sample string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(string(sc) + ":" + sample))
+	return h.Sum64()
 }
 
 // tokenChan parses readers and returns a channel of tokens.
@@ -376,9 +974,9 @@ func (d *Detector) tokenChan(readers ...io.Reader) <-chan string {
 // tokenize takes a string and returns a map where the keys are unique words (tokens)
 // and the values are the frequencies of those words in the string.
 // exclude tokens representing common words.
-func (d *Detector) tokenize(inp string) map[string]int {
+func (s *samplesIndex) tokenize(inp string) map[string]int {
 	isExcludedToken := func(token string) bool {
-		for _, w := range d.excludedTokens {
+		for _, w := range s.excludedTokens {
 			if strings.EqualFold(token, w) {
 				return true
 			}
@@ -395,64 +993,125 @@ func (d *Detector) tokenize(inp string) map[string]int {
 		token = cleanEmoji(token)
 		token = strings.Trim(token, ".,!?-:;()#")
 		token = strings.ToLower(token)
-		if len([]rune(token)) < 3 {
+		if utf8.RuneCountInString(token) < 3 {
 			continue
 		}
-		tokenFrequency[strings.ToLower(token)]++
+		tokenFrequency[token]++
 	}
 	return tokenFrequency
 }
 
-// isSpam checks if a given message is similar to any of the known bad messages
+// truncateRunes cuts the string to max runes, without splitting multibyte runes. Invalid bytes count as runes.
+func truncateRunes(s string, maxLen int) string {
+	count := 0
+	for i := range s {
+		if count == maxLen {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+// isSpamSimilarityHigh checks if a given message is similar to any of the known bad messages.
+// Samples tagged with category are matched with threshold and action of the category, if it is configured.
+// Similarity to samples of categories with report action doesn't make the message spam, it is reported in details only.
 func (d *Detector) isSpamSimilarityHigh(msg string) CheckResult {
 	// check for spam similarity
-	tokenizedMessage := d.tokenize(msg)
+	msgVector := d.spamSamples.vector(d.tokenize(msg))
 	maxSimilarity := 0.0
-	for _, spam := range d.tokenizedSpam {
-		similarity := d.cosineSimilarity(tokenizedMessage, spam)
+	reported := ""
+	for _, i := range d.spamSamples.candidates(msgVector, d.SimilarityMinTokens) {
+		spam := d.spamSamples.vectors[i]
+		threshold, action := d.SimilarityThreshold, SimilarityActionSpam
+		category := d.spamSamples.categories[i]
+		if c, ok := d.SimilarityCategories[category]; ok && category != "" {
+			threshold, action = c.Threshold, c.Action
+		}
+		if threshold <= 0 {
+			continue // similarity check is disabled for the sample
+		}
+		similarity := msgVector.cosine(spam)
 		if similarity > maxSimilarity {
 			maxSimilarity = similarity
 		}
-		if similarity >= d.SimilarityThreshold {
-			return CheckResult{Spam: true, Name: "similarity",
-				Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
+		if similarity < threshold {
+			continue
+		}
+		details := fmt.Sprintf("%0.2f/%0.2f", similarity, threshold)
+		if category != "" {
+			details += ", category " + category
 		}
+		if action == SimilarityActionReport {
+			if reported == "" {
+				reported = details + ", reported"
+			}
+			continue // look for samples of other categories making the message spam
+		}
+		return CheckResult{Spam: true, Name: "similarity", Details: details}
+	}
+	if reported != "" {
+		log.Printf("[INFO] message is similar to spam sample, %s: %q", reported, msg)
+		return CheckResult{Spam: false, Name: "similarity", Details: reported}
 	}
 	return CheckResult{Spam: false, Name: "similarity", Details: fmt.Sprintf("%0.2f/%0.2f", maxSimilarity, d.SimilarityThreshold)}
 }
 
-// cosineSimilarity calculates the cosine similarity between two token frequency maps.
-func (d *Detector) cosineSimilarity(a, b map[string]int) float64 {
-	if len(a) == 0 || len(b) == 0 {
-		return 0.0
+// hamVeto vetoes spam verdict of similarity and classifier if the message is more similar to ham samples
+// than to spam samples by HamVetoMargin. Results of vetoed checks are changed to ham in place, and the veto result
+// is returned. Nothing is vetoed if the message is spam by any other check, i.e. stop words or emojis.
+func (d *Detector) hamVeto(msg string, cr []CheckResult) (res CheckResult, vetoed bool) {
+	spamIdx := []int{}
+	for i, r := range cr {
+		if !r.Spam {
+			continue
+		}
+		if r.Name != "similarity" && r.Name != "classifier" {
+			return CheckResult{}, false
+		}
+		spamIdx = append(spamIdx, i)
+	}
+	if len(spamIdx) == 0 {
+		return CheckResult{}, false
 	}
 
-	dotProduct := 0      // sum of product of corresponding frequencies
-	normA, normB := 0, 0 // square root of sum of squares of frequencies
-
-	for key, val := range a {
-		dotProduct += val * b[key]
-		normA += val * val
+	tokens := d.tokenize(msg)
+	hamSimilarity, spamSimilarity := d.hamSamples.maxSimilarity(tokens), d.spamSamples.maxSimilarity(tokens)
+	if hamSimilarity-spamSimilarity < d.HamVetoMargin {
+		return CheckResult{}, false
 	}
-	for _, val := range b {
-		normB += val * val
+	names := make([]string, 0, len(spamIdx))
+	for _, i := range spamIdx {
+		cr[i].Spam = false
+		cr[i].Details += ", vetoed"
+		names = append(names, cr[i].Name)
 	}
+	details := fmt.Sprintf("suspicious, ham similarity %0.2f, spam similarity %0.2f, vetoed %s",
+		hamSimilarity, spamSimilarity, strings.Join(names, ", "))
+	log.Printf("[INFO] spam verdict vetoed, %s: %q", details, msg)
+	return CheckResult{Name: CheckHamVeto, Spam: false, Details: details}, true
+}
 
-	if normA == 0 || normB == 0 {
-		return 0.0
-	}
+// sampleCategoryRe matches "[category] " prefix of tagged spam sample
+var sampleCategoryRe = regexp.MustCompile(`^\[([\w-]+)\]\s+`)
 
-	// cosine similarity formula
-	return float64(dotProduct) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB)))
+// splitSampleCategory returns category of the sample, lowercase, and the sample without category tag.
+// Category is empty for untagged sample.
+func splitSampleCategory(sample string) (category, text string) {
+	m := sampleCategoryRe.FindStringSubmatch(sample)
+	if m == nil {
+		return "", sample
+	}
+	return strings.ToLower(m[1]), sample[len(m[0]):]
 }
 
 // isCasSpam checks if a given user ID is a spammer with CAS API.
-func (d *Detector) isCasSpam(msgID string) CheckResult {
+func (d *Detector) isCasSpam(ctx context.Context, msgID string) CheckResult {
 	if _, err := strconv.ParseInt(msgID, 10, 64); err != nil {
 		return CheckResult{Spam: false, Name: "cas", Details: fmt.Sprintf("invalid user id %q", msgID)}
 	}
 	reqURL := fmt.Sprintf("%s/check?user_id=%s", d.CasAPI, msgID)
-	req, err := http.NewRequest("GET", reqURL, http.NoBody)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
 	if err != nil {
 		return CheckResult{Spam: false, Name: "cas", Details: fmt.Sprintf("failed to make request %s: %v", reqURL, err)}
 	}
@@ -484,19 +1143,82 @@ func (d *Detector) isCasSpam(msgID string) CheckResult {
 	return CheckResult{Name: "cas", Spam: false, Details: details}
 }
 
-// isSpamClassified classify tokens from a document
-func (d *Detector) isSpamClassified(msg string) CheckResult {
+// isLolsSpam checks if a given user ID is banned by lols.bot API.
+func (d *Detector) isLolsSpam(ctx context.Context, userID string) CheckResult {
+	if _, err := strconv.ParseInt(userID, 10, 64); err != nil {
+		return CheckResult{Spam: false, Name: "lols", Details: fmt.Sprintf("invalid user id %q", userID)}
+	}
+	reqURL := fmt.Sprintf("%s/account?id=%s", d.LolsAPI, userID)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, http.NoBody)
+	if err != nil {
+		return CheckResult{Spam: false, Name: "lols", Details: fmt.Sprintf("failed to make request %s: %v", reqURL, err)}
+	}
+
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		return CheckResult{Spam: false, Name: "lols", Details: fmt.Sprintf("failed to send request %s: %v", reqURL, err)}
+	}
+	defer resp.Body.Close()
+
+	respData := struct {
+		OK       bool `json:"ok"`
+		Banned   bool `json:"banned"` // banned means user is a spammer
+		Offenses int  `json:"offenses"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
+		return CheckResult{Spam: false, Name: "lols", Details: fmt.Sprintf("failed to parse response from %s: %v", reqURL, err)}
+	}
+	if !respData.OK {
+		return CheckResult{Spam: false, Name: "lols", Details: "request failed"}
+	}
+	if respData.Banned {
+		return CheckResult{Name: "lols", Spam: true, Details: fmt.Sprintf("banned, %d offenses", respData.Offenses)}
+	}
+	return CheckResult{Name: "lols", Spam: false, Details: "not found"}
+}
+
+// isSpamClassified checks message with the classifier. Boost is added to spam probability, in percents,
+// and the message is spam if boosted probability is over 50%.
+func (d *Detector) isSpamClassified(msg string, boost float64) CheckResult {
 	tm := d.tokenize(msg)
 	tokens := make([]string, 0, len(tm))
 	for token := range tm {
 		tokens = append(tokens, token)
 	}
-	class, prob, certain := d.classifier.classify(tokens...)
+	class, prob, certain := d.classifier.classify(d.ClassifierPriors, tokens...)
+	if boost > 0 {
+		spamProb := prob
+		if class != "spam" {
+			spamProb = 100 - prob
+		}
+		spamProb = math.Min(spamProb+boost, 100)
+		isSpam := spamProb > 50 && (d.MinSpamProbability == 0 || spamProb >= d.MinSpamProbability)
+		return CheckResult{Name: "classifier", Spam: isSpam,
+			Details: fmt.Sprintf("probability of spam: %.2f%%, boosted by %.2f%%", spamProb, boost)}
+	}
 	isSpam := class == "spam" && certain && (d.MinSpamProbability == 0 || prob >= d.MinSpamProbability)
 	return CheckResult{Name: "classifier", Spam: isSpam,
 		Details: fmt.Sprintf("probability of %s: %.2f%%", class, prob)}
 }
 
+// isDeadHours checks if the current time is outside of active hours of the group, in the timezone of the group.
+// The result is never spam, it is reported to explain boosted spam probability of the classifier.
+func (d *Detector) isDeadHours() (CheckResult, bool) {
+	ah := d.ActivityHours
+	now := d.now().UTC()
+	if ah.Location != nil {
+		now = now.In(ah.Location)
+	}
+	hour := now.Hour()
+	active := hour >= ah.Start && hour < ah.End
+	if ah.End <= ah.Start { // period wraps midnight, i.e. 20-02
+		active = hour >= ah.Start || hour < ah.End
+	}
+	return CheckResult{Name: "activity hours", Spam: false, Details: fmt.Sprintf("new user posted at %s, outside of %02d-%02d",
+		now.Format("15:04 MST"), ah.Start, ah.End)}, !active
+}
+
 // isStopWord checks if a given message contains any of the stop words.
 func (d *Detector) isStopWord(msg string) CheckResult {
 	cleanMsg := cleanEmoji(strings.ToLower(msg))
@@ -513,11 +1235,3 @@ func (d *Detector) isManyEmojis(msg string) CheckResult {
 	count := countEmoji(msg)
 	return CheckResult{Name: "emoji", Spam: count > d.MaxAllowedEmoji, Details: fmt.Sprintf("%d/%d", count, d.MaxAllowedEmoji)}
 }
-
-func (c *CheckResult) String() string {
-	spamOrHam := "ham"
-	if c.Spam {
-		spamOrHam = "spam"
-	}
-	return fmt.Sprintf("%s: %s, %s", c.Name, spamOrHam, c.Details)
-}
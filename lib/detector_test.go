@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
@@ -242,10 +245,10 @@ func TestDetector_CheckSimilarity(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2}, lr)
 	d.classifier.reset() // we don't need a classifier for this test
-	assert.Len(t, d.tokenizedSpam, 2)
-	t.Logf("%+v", d.tokenizedSpam)
-	assert.Equal(t, map[string]int{"win": 1, "free": 1, "iphone": 1}, d.tokenizedSpam[0])
-	assert.Equal(t, map[string]int{"lottery": 1, "prize": 1}, d.tokenizedSpam[1])
+	assert.Equal(t, 2, d.spamSamples.len())
+	t.Logf("%+v", d.spamSamples)
+	assert.Equal(t, map[string]int{"win": 1, "free": 1, "iphone": 1}, d.spamSamples.frequencies(0))
+	assert.Equal(t, map[string]int{"lottery": 1, "prize": 1}, d.spamSamples.frequencies(1))
 
 	tests := []struct {
 		name      string
@@ -272,6 +275,55 @@ func TestDetector_CheckSimilarity(t *testing.T) {
 	}
 }
 
+func TestDetector_CheckSimilarityCategories(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, SimilarityCategories: map[string]SimilarityCategory{
+		"crypto":   {Threshold: 0.3},
+		"job-scam": {Threshold: 0.5, Action: SimilarityActionReport},
+		"disabled": {Threshold: 0},
+	}})
+	spamSamples := strings.NewReader("win free iPhone\n[crypto] bitcoin wallet profit daily\n[Job-Scam] remote work salary daily\n" +
+		"[disabled] hello world friends\n[unknown] cheap pills online")
+	lr, err := d.LoadSamples(strings.NewReader(""), []io.Reader{spamSamples}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, lr.SpamSamples)
+	d.classifier.reset() // we don't need a classifier for this test
+	assert.Equal(t, []string{"", "crypto", "job-scam", "disabled", "unknown"}, d.spamSamples.categories)
+	assert.Equal(t, map[string]int{"bitcoin": 1, "wallet": 1, "profit": 1, "daily": 1}, d.spamSamples.frequencies(1))
+
+	tests := []struct {
+		name    string
+		message string
+		spam    bool
+		details string
+	}{
+		{"untagged sample", "win free iphone", true, "1.00/0.50"},
+		{"category with low threshold", "bitcoin profit", true, "0.71/0.30, category crypto"},
+		{"category with report action", "remote work salary", false, "0.87/0.50, category job-scam, reported"},
+		{"disabled category", "hello world friends", false, "0.00/0.50"},
+		{"unknown category with default threshold", "cheap pills online", true, "1.00/0.50, category unknown"},
+		{"not similar", "how are you today", false, "0.00/0.50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spam, cr := d.Check(tt.message, "")
+			assert.Equal(t, tt.spam, spam)
+			require.Len(t, cr, 1)
+			assert.Equal(t, CheckResult{Name: "similarity", Spam: tt.spam, Details: tt.details}, cr[0])
+		})
+	}
+
+	t.Run("categories without default threshold", func(t *testing.T) {
+		d.Config.SimilarityThreshold = 0
+		defer func() { d.Config.SimilarityThreshold = 0.5 }()
+		spam, cr := d.Check("bitcoin profit", "")
+		assert.True(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "0.71/0.30, category crypto", cr[0].Details)
+		spam, _ = d.Check("win free iphone", "")
+		assert.False(t, spam, "untagged samples are not matched")
+	})
+}
+
 func TestDetector_CheckClassificator(t *testing.T) {
 	d := NewDetector(Config{MaxAllowedEmoji: -1, MinSpamProbability: 60})
 	spamSamples := strings.NewReader("win free iPhone\nlottery prize xyz")
@@ -279,7 +331,7 @@ func TestDetector_CheckClassificator(t *testing.T) {
 	lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{spamSamples}, []io.Reader{hamsSamples})
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2, HamSamples: 3}, lr)
-	d.tokenizedSpam = nil // we don't need tokenizedSpam samples for this test
+	d.spamSamples.reset() // we don't need spam samples for this test
 	assert.Equal(t, 5, d.classifier.nAllDocument)
 	exp := map[string]map[spamClass]int{"win": {"spam": 1}, "free": {"spam": 1}, "iphone": {"spam": 1}, "lottery": {"spam": 1},
 		"prize": {"spam": 1}, "hello": {"ham": 1}, "world": {"ham": 1}, "how": {"ham": 1}, "are": {"ham": 1}, "you": {"ham": 1},
@@ -321,6 +373,79 @@ func TestDetector_CheckClassificator(t *testing.T) {
 	})
 }
 
+func TestDetector_CheckActivityHours(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	newDetector := func(ah ActivityHours, now time.Time) *Detector {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinSpamProbability: 60, FirstMessagesCount: 1, ActivityHours: ah})
+		_, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{strings.NewReader("win free iPhone\nlottery prize xyz")},
+			[]io.Reader{strings.NewReader("hello world\nhow are you\nhave a good day")})
+		require.NoError(t, err)
+		d.spamSamples.reset() // we don't need spam samples for this test
+		d.now = func() time.Time { return now }
+		return d
+	}
+	night := time.Date(2024, 5, 10, 1, 30, 0, 0, time.UTC) // 03:30 in Berlin
+	day := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	msg := "You won a free lottery iphone have a good day" // probability of spam: 53.36%
+
+	t.Run("new user at dead hours", func(t *testing.T) {
+		d := newDetector(ActivityHours{Location: berlin, Start: 8, End: 23, Boost: 10}, night)
+		spam, cr := d.Check(msg, "123")
+		assert.True(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, CheckResult{Name: "activity hours", Spam: false,
+			Details: "new user posted at 03:30 CEST, outside of 08-23"}, cr[0])
+		assert.Equal(t, CheckResult{Name: "classifier", Spam: true,
+			Details: "probability of spam: 63.36%, boosted by 10.00%"}, cr[1])
+	})
+
+	t.Run("new user at active hours", func(t *testing.T) {
+		d := newDetector(ActivityHours{Location: berlin, Start: 8, End: 23, Boost: 10}, day)
+		spam, cr := d.Check(msg, "123")
+		assert.False(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "probability of spam: 53.36%", cr[0].Details)
+	})
+
+	t.Run("active hours wrap midnight", func(t *testing.T) {
+		d := newDetector(ActivityHours{Start: 20, End: 2, Boost: 10}, night)
+		spam, cr := d.Check(msg, "123")
+		assert.False(t, spam, "01:30 utc is active")
+		require.Len(t, cr, 1)
+
+		d = newDetector(ActivityHours{Start: 20, End: 2, Boost: 10}, day)
+		spam, cr = d.Check(msg, "123")
+		assert.True(t, spam, "12:00 utc is dead")
+		require.Len(t, cr, 2)
+		assert.Equal(t, "new user posted at 12:00 UTC, outside of 20-02", cr[0].Details)
+	})
+
+	t.Run("ham boosted below threshold", func(t *testing.T) {
+		d := newDetector(ActivityHours{Location: berlin, Start: 8, End: 23, Boost: 10}, night)
+		spam, cr := d.Check("Hello, how are you?", "123")
+		assert.False(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "probability of spam: 17.17%, boosted by 10.00%", cr[1].Details)
+	})
+
+	t.Run("known user at dead hours", func(t *testing.T) {
+		d := newDetector(ActivityHours{Location: berlin, Start: 8, End: 23, Boost: 10}, night)
+		d.approvedUsers["123"] = &ApprovedUser{UserID: "123", Count: 1} // one ham message checked, not approved yet
+		spam, cr := d.Check(msg, "123")
+		assert.False(t, spam)
+		require.Len(t, cr, 1)
+		assert.Equal(t, "probability of spam: 53.36%", cr[0].Details)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		d := newDetector(ActivityHours{Location: berlin, Start: 8, End: 23}, night)
+		spam, cr := d.Check(msg, "123")
+		assert.False(t, spam)
+		require.Len(t, cr, 1)
+	})
+}
+
 func TestDetector_CheckOpenAI(t *testing.T) {
 	t.Run("with openai and first-only", func(t *testing.T) {
 		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true})
@@ -343,6 +468,26 @@ func TestDetector_CheckOpenAI(t *testing.T) {
 		assert.Equal(t, 1, len(mockOpenAIClient.CreateChatCompletionCalls()))
 	})
 
+	t.Run("with openai category to warn", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true})
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{{
+						Message: openai.ChatCompletionMessage{Content: `{"spam": true, "reason":"about football", "confidence":90, "category":"off-topic"}`},
+					}},
+				}, nil
+			},
+		}
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4",
+			Categories: map[string]OpenAICategory{"off-topic": {Action: OpenAICategoryActionWarn}}})
+		spam, cr := d.Check("some message 1234", "")
+		assert.Equal(t, false, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, CheckResult{Name: "openai", Details: "about football, confidence: 90%, category: off-topic, warn"}, cr[0])
+		assert.Equal(t, CheckResult{Name: CheckOpenAICategory, Details: "off-topic, warn, about football"}, cr[1])
+	})
+
 	t.Run("with openai and not first-only", func(t *testing.T) {
 		d := NewDetector(Config{MaxAllowedEmoji: -1})
 		mockOpenAIClient := &mocks.OpenAIClientMock{
@@ -473,6 +618,266 @@ func TestDetector_CheckOpenAI(t *testing.T) {
 
 		assert.Equal(t, 1, len(mockOpenAIClient.CreateChatCompletionCalls()))
 	})
+
+	t.Run("with openai veto failed, fail-open and fail-closed", func(t *testing.T) {
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{}, errors.New("service unavailable")
+			},
+		}
+		for _, failClosed := range []bool{false, true} {
+			d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, OpenAIVeto: true})
+			d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4", FailClosed: failClosed})
+			d.LoadStopWords(strings.NewReader("some message"))
+
+			spam, cr := d.Check("some message 1234", "")
+			assert.Equal(t, failClosed, spam, "verdict of other checks kept in fail-closed mode only")
+			require.Len(t, cr, 2)
+			assert.Equal(t, "openai", cr[1].Name)
+			assert.Equal(t, "OpenAI error: service unavailable", cr[1].Details)
+		}
+	})
+
+	t.Run("with openai circuit breaker", func(t *testing.T) {
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{}, errors.New("service unavailable")
+			},
+		}
+		var changes []bool
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, OpenAIVeto: true})
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4", FailClosed: true, BreakerThreshold: 2,
+			BreakerCooldown: time.Hour, BreakerNotify: func(open bool, err error) {
+				changes = append(changes, open)
+				assert.EqualError(t, err, "service unavailable")
+			}})
+		d.LoadStopWords(strings.NewReader("some message"))
+
+		for i := 0; i < 3; i++ {
+			spam, cr := d.Check("some message 1234", "")
+			assert.True(t, spam)
+			require.Len(t, cr, 2)
+			if i == 2 {
+				assert.Equal(t, "OpenAI skipped, circuit breaker open", cr[1].Details)
+			}
+		}
+		assert.Equal(t, 2, len(mockOpenAIClient.CreateChatCompletionCalls()), "no requests with open breaker")
+		assert.Equal(t, []bool{true}, changes)
+	})
+
+	t.Run("with openai policy, confirm and override with min confidence", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, FirstMessageOnly: true, OpenAIVeto: true,
+			OpenAIPolicy: OpenAIPolicy{OnHam: true, OnSpam: true, Rescue: true, MinConfidence: 80}})
+		resp := `{"spam": false, "reason":"good text", "confidence":70}`
+		mockOpenAIClient := &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: resp}}},
+				}, nil
+			},
+		}
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+		d.LoadStopWords(strings.NewReader("some message"))
+
+		spam, cr := d.Check("some message 1234", "1")
+		assert.True(t, spam, "not confident enough to rescue")
+		require.Len(t, cr, 2)
+		assert.Equal(t, CheckResult{Name: "openai", Spam: false,
+			Details: "good text, confidence: 70%, ignored, confidence below 80%"}, cr[1])
+
+		resp = `{"spam": false, "reason":"good text", "confidence":90}`
+		spam, _ = d.Check("some message 1234", "2")
+		assert.False(t, spam, "rescued")
+
+		resp = `{"spam": true, "reason":"bad text", "confidence":90}`
+		spam, cr = d.Check("other message 1234", "3")
+		assert.False(t, spam, "ban not allowed")
+		require.Len(t, cr, 2, "ham checked")
+		assert.Equal(t, "bad text, confidence: 90%, ignored, ban not allowed by policy", cr[1].Details)
+		assert.Equal(t, 3, len(mockOpenAIClient.CreateChatCompletionCalls()))
+	})
+}
+
+func TestDetector_CheckLocal(t *testing.T) {
+	mockedHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": true}`))}, nil
+		},
+	}
+	mockOpenAIClient := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{{
+					Message: openai.ChatCompletionMessage{Content: `{"spam": true, "reason":"bad text", "confidence":100}`},
+				}},
+			}, nil
+		},
+	}
+	d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: mockedHTTPClient, MaxAllowedEmoji: 1, FirstMessageOnly: true})
+	d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+
+	spam, cr := d.CheckLocal("some message 1234", "123")
+	assert.False(t, spam)
+	assert.Equal(t, []CheckResult{{Name: "emoji", Spam: false, Details: "0/1"}}, cr)
+
+	spam, cr = d.CheckLocal("some message 😁😁😁", "456")
+	assert.True(t, spam)
+	require.Len(t, cr, 1)
+	assert.Equal(t, "emoji", cr[0].Name)
+
+	assert.Empty(t, mockedHTTPClient.DoCalls(), "cas not called")
+	assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls(), "openai not called")
+
+	spam, _ = d.Check("some message 1234", "789")
+	assert.True(t, spam, "cas reported spam")
+	assert.Len(t, mockedHTTPClient.DoCalls(), 1)
+}
+
+func TestDetector_CheckUser(t *testing.T) {
+	mockedHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			switch {
+			case req.URL.String() == "http://cas/check?user_id=123":
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": true, "description": "Record found."}`))}, nil
+			case req.URL.String() == "http://lols/account?id=456":
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(
+					`{"ok": true, "user_id": 456, "banned": true, "offenses": 3}`))}, nil
+			case strings.HasPrefix(req.URL.String(), "http://lols/"):
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": true, "banned": false}`))}, nil
+			}
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+		},
+	}
+
+	d := NewDetector(Config{HTTPClient: mockedHTTPClient})
+	spam, cr := d.CheckUser(context.Background(), "123")
+	assert.False(t, spam)
+	assert.Empty(t, cr, "neither cas nor lols set")
+
+	d = NewDetector(Config{CasAPI: "http://cas", LolsAPI: "http://lols", HTTPClient: mockedHTTPClient})
+	spam, cr = d.CheckUser(context.Background(), "123")
+	assert.True(t, spam)
+	assert.Equal(t, []CheckResult{{Name: "cas", Spam: true, Details: "record found"},
+		{Name: "lols", Spam: false, Details: "not found"}}, cr)
+
+	spam, cr = d.CheckUser(context.Background(), "456")
+	assert.True(t, spam)
+	assert.Equal(t, []CheckResult{{Name: "cas", Spam: false, Details: "not found"},
+		{Name: "lols", Spam: true, Details: "banned, 3 offenses"}}, cr)
+
+	spam, cr = d.CheckUser(context.Background(), "789")
+	assert.False(t, spam)
+	assert.Len(t, cr, 2)
+
+	spam, cr = d.Check("some message long enough to be checked", "456")
+	assert.True(t, spam, "lols used for messages too")
+	assert.Equal(t, CheckResult{Name: "lols", Spam: true, Details: "banned, 3 offenses"}, cr[len(cr)-1])
+	assert.Len(t, mockedHTTPClient.DoCalls(), 8)
+}
+
+func TestDetector_CheckContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "trace")
+	mockedHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "trace", req.Context().Value(ctxKey{}), "cas request made with the caller's context")
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+		},
+	}
+	mockOpenAIClient := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			assert.Equal(t, "trace", ctx.Value(ctxKey{}), "openai request made with the caller's context")
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{{
+					Message: openai.ChatCompletionMessage{Content: `{"spam": true, "reason":"bad text", "confidence":100}`},
+				}},
+			}, nil
+		},
+	}
+	d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: mockedHTTPClient, MaxAllowedEmoji: -1, FirstMessageOnly: true})
+	d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+
+	spam, cr := d.CheckContext(ctx, "some message", "123")
+	assert.True(t, spam)
+	assert.Equal(t, []CheckResult{{Name: "cas", Spam: false, Details: "not found"},
+		{Name: "openai", Spam: true, Details: "bad text, confidence: 100%"}}, cr)
+	assert.Len(t, mockedHTTPClient.DoCalls(), 1)
+	assert.Len(t, mockOpenAIClient.CreateChatCompletionCalls(), 1)
+}
+
+func TestDetector_CheckBudget(t *testing.T) {
+	slowHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		},
+	}
+	newOpenAIClient := func() *mocks.OpenAIClientMock {
+		return &mocks.OpenAIClientMock{
+			CreateChatCompletionFunc: func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{{
+						Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"good text", "confidence":100}`},
+					}},
+				}, nil
+			},
+		}
+	}
+
+	t.Run("budget exceeded, openai skipped", func(t *testing.T) {
+		mockOpenAIClient := newOpenAIClient()
+		d := NewDetector(Config{CasAPI: "http://cas", LolsAPI: "http://lols", HTTPClient: slowHTTPClient, MaxAllowedEmoji: -1,
+			FirstMessageOnly: true, CheckBudget: 50 * time.Millisecond})
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+		st := time.Now()
+		spam, cr := d.Check("some message", "123")
+		assert.Less(t, time.Since(st), time.Second)
+		assert.False(t, spam)
+		require.Len(t, cr, 2)
+		assert.Equal(t, "cas", cr[0].Name)
+		assert.Contains(t, cr[0].Details, "context deadline exceeded")
+		assert.Equal(t, CheckResult{Name: CheckDegraded, Spam: false,
+			Details: "check budget 50ms exceeded, cas interrupted, lols skipped, openai skipped"}, cr[1])
+		assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls())
+	})
+
+	t.Run("budget exceeded, spam of completed checks kept without openai veto", func(t *testing.T) {
+		mockOpenAIClient := newOpenAIClient()
+		d := NewDetector(Config{CasAPI: "http://cas", HTTPClient: slowHTTPClient, MaxAllowedEmoji: 1, OpenAIVeto: true,
+			FirstMessageOnly: true, CheckBudget: 50 * time.Millisecond})
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+		spam, cr := d.Check("spam 😁😁😁", "123")
+		assert.True(t, spam)
+		require.Len(t, cr, 3)
+		assert.Equal(t, "emoji", cr[0].Name)
+		assert.Equal(t, CheckResult{Name: CheckDegraded, Spam: false,
+			Details: "check budget 50ms exceeded, cas interrupted, openai skipped"}, cr[2])
+		assert.Empty(t, mockOpenAIClient.CreateChatCompletionCalls())
+	})
+
+	t.Run("within budget", func(t *testing.T) {
+		mockOpenAIClient := newOpenAIClient()
+		httpClient := &mocks.HTTPClientMock{
+			DoFunc: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": false}`))}, nil
+			},
+		}
+		d := NewDetector(Config{CasAPI: "http://cas", HTTPClient: httpClient, MaxAllowedEmoji: -1,
+			FirstMessageOnly: true, CheckBudget: time.Second})
+		d.WithOpenAIChecker(mockOpenAIClient, OpenAIConfig{Model: "gpt4"})
+		spam, cr := d.Check("some message", "123")
+		assert.False(t, spam)
+		assert.Equal(t, []CheckResult{{Name: "cas", Spam: false, Details: "not found"},
+			{Name: "openai", Spam: false, Details: "good text, confidence: 100%"}}, cr)
+	})
+
+	t.Run("local check not limited", func(t *testing.T) {
+		d := NewDetector(Config{CasAPI: "http://cas", HTTPClient: slowHTTPClient, MaxAllowedEmoji: -1,
+			CheckBudget: time.Nanosecond})
+		spam, cr := d.CheckLocal("some message", "123")
+		assert.False(t, spam)
+		assert.Empty(t, cr)
+	})
 }
 
 func TestDetector_UpdateSpam(t *testing.T) {
@@ -490,7 +895,7 @@ func TestDetector_UpdateSpam(t *testing.T) {
 	lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{spamSamples}, []io.Reader{hamsSamples})
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2, HamSamples: 3}, lr)
-	d.tokenizedSpam = nil // we don't need tokenizedSpam samples for this test
+	d.spamSamples.reset() // we don't need spam samples for this test
 	assert.Equal(t, 5, d.classifier.nAllDocument)
 	exp := map[string]map[spamClass]int{"win": {"spam": 1}, "free": {"spam": 1}, "iphone": {"spam": 1}, "lottery": {"spam": 1},
 		"prize": {"spam": 1}, "hello": {"ham": 1}, "world": {"ham": 1}, "how": {"ham": 1}, "are": {"ham": 1}, "you": {"ham": 1},
@@ -537,7 +942,7 @@ func TestDetector_UpdateHam(t *testing.T) {
 	lr, err := d.LoadSamples(strings.NewReader("xyz"), []io.Reader{spamSamples}, []io.Reader{hamsSamples})
 	require.NoError(t, err)
 	assert.Equal(t, LoadResult{ExcludedTokens: 1, SpamSamples: 2, HamSamples: 3}, lr)
-	d.tokenizedSpam = nil // we don't need tokenizedSpam samples for this test
+	d.spamSamples.reset() // we don't need spam samples for this test
 	assert.Equal(t, 5, d.classifier.nAllDocument)
 	exp := map[string]map[spamClass]int{"win": {"spam": 1}, "free": {"spam": 1}, "iphone": {"spam": 1}, "lottery": {"spam": 1},
 		"prize": {"spam": 1}, "hello": {"ham": 1}, "world": {"ham": 1}, "how": {"ham": 1}, "are": {"ham": 1}, "you": {"ham": 1},
@@ -569,6 +974,70 @@ func TestDetector_UpdateHam(t *testing.T) {
 	})
 }
 
+func TestDetector_LoadSamplesInBackground(t *testing.T) {
+	upd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+	d.WithSpamUpdater(upd)
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("win free iphone")}, nil)
+	require.NoError(t, err)
+
+	pr, pw := io.Pipe()
+	loaded := make(chan LoadResult)
+	go func() {
+		lr, err := d.LoadSamples(strings.NewReader(""), []io.Reader{pr}, nil)
+		assert.NoError(t, err)
+		loaded <- lr
+	}()
+	_, err = pw.Write([]byte("lottery prize today\n"))
+	require.NoError(t, err) // the load is in progress, it waits for more samples
+
+	similar := func(msg string) bool {
+		_, cr := d.Check(msg, "")
+		for _, r := range cr {
+			if r.Name == "similarity" {
+				return r.Spam
+			}
+		}
+		return false
+	}
+	assert.True(t, similar("win free iphone"), "checked with samples loaded before")
+	assert.False(t, similar("lottery prize today"), "samples being loaded are not used yet")
+	require.NoError(t, d.UpdateSpam("cheap pills online"))
+	require.NoError(t, d.UpdateSpam("buy crypto signals"))
+
+	_, err = pw.Write([]byte("buy crypto signals\n"))
+	require.NoError(t, err)
+	require.NoError(t, pw.Close())
+	select {
+	case lr := <-loaded:
+		assert.Equal(t, LoadResult{SpamSamples: 2}, lr)
+	case <-time.After(time.Second):
+		t.Fatal("samples not loaded")
+	}
+
+	assert.True(t, similar("lottery prize today"), "loaded samples swapped in")
+	assert.False(t, similar("win free iphone"), "samples of the previous load dropped")
+	assert.Equal(t, 3, d.classifier.nAllDocument, "sample updated during the load learned once")
+	assert.Contains(t, d.learned, sampleHash("spam", "cheap pills online"), "update during the load kept")
+	assert.Empty(t, d.pending)
+}
+
+func TestDetector_SetThresholds(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: 2, MinMsgLen: 5, SimilarityThreshold: 0.5, MinSpamProbability: 50})
+	assert.Equal(t, Thresholds{SimilarityThreshold: 0.5, MinMsgLen: 5, MaxAllowedEmoji: 2, MinSpamProbability: 50}, d.Thresholds())
+
+	spam, cr := d.Check("😁🐶🍕 hello", "")
+	assert.True(t, spam)
+	assert.Equal(t, "3/2", cr[0].Details)
+
+	d.SetThresholds(Thresholds{SimilarityThreshold: 0.8, MinMsgLen: 100, MaxAllowedEmoji: 5, MinSpamProbability: 80})
+	assert.Equal(t, Thresholds{SimilarityThreshold: 0.8, MinMsgLen: 100, MaxAllowedEmoji: 5, MinSpamProbability: 80}, d.Thresholds())
+	spam, cr = d.Check("😁🐶🍕 hello", "")
+	assert.False(t, spam)
+	assert.Equal(t, []CheckResult{{Name: "emoji", Spam: false, Details: "3/5"},
+		{Name: "message length", Spam: false, Details: "too short"}}, cr)
+}
+
 func TestDetector_Reset(t *testing.T) {
 	d := NewDetector(Config{})
 	spamSamples := strings.NewReader("win free iPhone\nlottery prize xyz")
@@ -581,13 +1050,13 @@ func TestDetector_Reset(t *testing.T) {
 	assert.Equal(t, LoadResult{StopWords: 2}, sr)
 
 	assert.Equal(t, 5, d.classifier.nAllDocument)
-	assert.Equal(t, 2, len(d.tokenizedSpam))
+	assert.Equal(t, 2, d.spamSamples.len())
 	assert.Equal(t, 1, len(d.excludedTokens))
 	assert.Equal(t, 2, len(d.stopWords))
 
 	d.Reset()
 	assert.Equal(t, 0, d.classifier.nAllDocument)
-	assert.Equal(t, 0, len(d.tokenizedSpam))
+	assert.Equal(t, 0, d.spamSamples.len())
 	assert.Equal(t, 0, len(d.excludedTokens))
 	assert.Equal(t, 0, len(d.stopWords))
 }
@@ -635,7 +1104,11 @@ func TestDetector(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 			}
-			assert.ElementsMatch(t, tt.wantApproved, d.ApprovedUsers())
+			ids := []string{}
+			for _, u := range d.ApprovedUsers() {
+				ids = append(ids, u.UserID)
+			}
+			assert.ElementsMatch(t, tt.wantApproved, ids)
 		})
 	}
 }
@@ -698,6 +1171,83 @@ func TestDetector_FirstMessagesCount(t *testing.T) {
 	})
 }
 
+func TestDetector_IsNewUser(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessagesCount: 2})
+	_, err := d.LoadStopWords(strings.NewReader("buy cryptocurrency"))
+	require.NoError(t, err)
+	assert.True(t, d.IsNewUser("123"))
+
+	spam, _ := d.Check("buy cryptocurrency now!", "123")
+	require.True(t, spam)
+	assert.True(t, d.IsNewUser("123"), "spam is not counted")
+	spam, _ = d.Check("Hello, how are you my friend?", "123")
+	require.False(t, spam)
+	assert.False(t, d.IsNewUser("123"), "ham message checked, not approved yet")
+
+	d.AddApprovedUsers("456")
+	assert.False(t, d.IsNewUser("456"), "approved manually")
+
+	d = NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5}) // paranoid mode, users not tracked
+	assert.False(t, d.IsNewUser("123"))
+}
+
+func TestDetector_Recheck(t *testing.T) {
+	mockedHTTPClient := &mocks.HTTPClientMock{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"ok": true}`))}, nil
+		},
+	}
+
+	t.Run("every nth message", func(t *testing.T) {
+		d := NewDetector(Config{CasAPI: "http://localhost", HTTPClient: mockedHTTPClient, MaxAllowedEmoji: -1, MinMsgLen: 5,
+			FirstMessagesCount: 1, Recheck: Recheck{Every: 3}})
+		_, err := d.LoadStopWords(strings.NewReader("buy cryptocurrency"))
+		require.NoError(t, err)
+		d.AddApprovedUsers("123") // count set to 2
+
+		spam, cr := d.Check("Hello, how are you my friend?", "123")
+		assert.False(t, spam)
+		require.Len(t, cr, 2, "3rd message re-checked")
+		assert.Equal(t, CheckResult{Name: CheckRecheck, Spam: false, Details: "approved user re-checked"}, cr[0])
+		assert.Equal(t, "stopword", cr[1].Name)
+
+		for i := 0; i < 2; i++ {
+			spam, cr = d.Check("buy cryptocurrency now!", "123")
+			assert.False(t, spam, "not re-checked")
+			assert.Equal(t, "pre-approved", cr[0].Name)
+		}
+
+		spam, cr = d.Check("buy cryptocurrency now!", "123")
+		assert.True(t, spam, "6th message re-checked")
+		assert.Equal(t, CheckRecheck, cr[0].Name)
+		assert.Equal(t, CheckResult{Name: "stopword", Spam: true, Details: "buy cryptocurrency"}, cr[1])
+		assert.Empty(t, mockedHTTPClient.DoCalls(), "cas not called on re-check")
+		assert.Equal(t, 6, d.ApprovedUsers()[0].Count, "re-checked messages counted once")
+	})
+
+	t.Run("random sampling", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessageOnly: true, Recheck: Recheck{Rate: 0.1}})
+		_, err := d.LoadStopWords(strings.NewReader("buy cryptocurrency"))
+		require.NoError(t, err)
+		d.AddApprovedUsers("123")
+		random := 0.5
+		d.random = func() float64 { return random }
+
+		spam, cr := d.Check("buy cryptocurrency now!", "123")
+		assert.False(t, spam)
+		assert.Equal(t, "pre-approved", cr[0].Name)
+
+		random = 0.05
+		spam, cr = d.Check("buy cryptocurrency now!", "123")
+		assert.True(t, spam, "sampled for re-check")
+		assert.Equal(t, CheckRecheck, cr[0].Name)
+
+		spam, cr = d.Check("buy cryptocurrency now!", "456")
+		assert.True(t, spam, "new user checked as usual")
+		assert.Equal(t, "stopword", cr[0].Name)
+	})
+}
+
 func TestDetector_AddAndRemoveApprovedUsers(t *testing.T) {
 	t.Run("user not approved, sent spam", func(t *testing.T) {
 		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessageOnly: true})
@@ -753,6 +1303,117 @@ func TestDetector_AddAndRemoveApprovedUsers(t *testing.T) {
 		assert.Equal(t, "stopword", info[0].Name)
 	})
 
+	t.Run("add user with metadata", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessagesCount: 2})
+		firstSeen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		d.AddApprovedUser(ApprovedUser{UserID: "123", UserName: "user1", FirstSeen: firstSeen})
+		d.AddApprovedUser(ApprovedUser{UserID: "456", Count: 10})
+		d.SetApprovedUserName("456", "user2")
+		d.SetApprovedUserName("789", "unknown")
+
+		res := d.ApprovedUsers()
+		require.Len(t, res, 2)
+		assert.Equal(t, ApprovedUser{UserID: "123", UserName: "user1", Count: 3, FirstSeen: firstSeen}, res[0], "count set to approve")
+		assert.Equal(t, "user2", res[1].UserName)
+		assert.Equal(t, 10, res[1].Count)
+
+		isSpam, info := d.Check("Hello, how are you my friend?", "123")
+		assert.False(t, isSpam)
+		assert.Equal(t, "pre-approved", info[0].Name)
+		res = d.ApprovedUsers()
+		assert.Equal(t, 4, res[0].Count, "count of messages updated")
+		assert.False(t, res[0].LastSeen.IsZero())
+	})
+
+	t.Run("ham messages counted", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessagesCount: 2})
+		for i := 0; i < 4; i++ {
+			isSpam, _ := d.Check("Hello, how are you my friend?", "123")
+			assert.False(t, isSpam)
+		}
+		res := d.ApprovedUsers()
+		require.Len(t, res, 1)
+		assert.Equal(t, "123", res[0].UserID)
+		assert.Equal(t, 4, res[0].Count)
+		assert.False(t, res[0].FirstSeen.IsZero())
+		assert.True(t, !res[0].LastSeen.Before(res[0].FirstSeen))
+	})
+
+	t.Run("changes written to user storage", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessagesCount: 1})
+		d.AddApprovedUsers("100") // added before storage set, not written
+		us := &userStorage{users: map[string]ApprovedUser{}}
+		d.WithUserStorage(us)
+
+		d.AddApprovedUsers("123")
+		assert.Equal(t, 2, us.users["123"].Count)
+		d.SetApprovedUserName("123", "user1")
+		assert.Equal(t, "user1", us.users["123"].UserName)
+
+		isSpam, _ := d.Check("Hello, how are you my friend?", "456")
+		assert.False(t, isSpam)
+		assert.Equal(t, 1, us.users["456"].Count, "ham message counted")
+		isSpam, _ = d.Check("Hello, how are you my friend?", "123")
+		assert.False(t, isSpam)
+		assert.Equal(t, 3, us.users["123"].Count, "approved user message counted")
+
+		d.RemoveApprovedUsers("123")
+		_, ok := us.users["123"]
+		assert.False(t, ok)
+		_, ok = us.users["100"]
+		assert.False(t, ok)
+		assert.Len(t, us.users, 1)
+	})
+
+	t.Run("users approved by other instances loaded from shared storage", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, MinMsgLen: 5, FirstMessageOnly: true, FirstMessagesCount: 1})
+		us := &sharedUserStorage{userStorage: userStorage{users: map[string]ApprovedUser{
+			"123": {UserID: "123", UserName: "user1", Count: 5}}}}
+		d.WithUserStorage(us)
+		assert.False(t, d.IsNewUser("123"), "approved by other instance")
+		assert.True(t, d.IsNewUser("456"))
+
+		isSpam, info := d.Check("Hello, how are you my friend?", "123")
+		assert.False(t, isSpam)
+		assert.Equal(t, "pre-approved", info[0].Name)
+		assert.Equal(t, 6, us.users["123"].Count, "loaded user counted")
+		assert.Equal(t, "user1", us.users["123"].UserName)
+		assert.Equal(t, []string{"123", "456"}, us.loaded, "loaded once, unknown user asked again")
+
+		us.err = errors.New("failed")
+		assert.True(t, d.IsNewUser("789"), "failed load")
+	})
+}
+
+// sharedUserStorage is an in-memory UserStorage loading users, as shared by several instances
+type sharedUserStorage struct {
+	userStorage
+	loaded []string
+	err    error
+}
+
+func (s *sharedUserStorage) Load(userID string) (ApprovedUser, bool, error) {
+	if s.err != nil {
+		return ApprovedUser{}, false, s.err
+	}
+	s.loaded = append(s.loaded, userID)
+	user, ok := s.users[userID]
+	return user, ok, nil
+}
+
+// userStorage is an in-memory UserStorage, mock from lib/mocks can't be used here due to import cycle
+type userStorage struct {
+	users map[string]ApprovedUser
+}
+
+func (s *userStorage) Write(user ApprovedUser) error {
+	s.users[user.UserID] = user
+	return nil
+}
+
+func (s *userStorage) Delete(userID string) error {
+	delete(s.users, userID)
+	return nil
 }
 
 func TestDetector_tokenize(t *testing.T) {
@@ -771,13 +1432,50 @@ func TestDetector_tokenize(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			d := Detector{
-				excludedTokens: []string{"the", "she"},
+				samplesIndex: samplesIndex{excludedTokens: []string{"the", "she"}},
 			}
 			assert.Equal(t, tt.expected, d.tokenize(tt.input))
 		})
 	}
 }
 
+// fuzzSeeds are messages tricky for tokenization and checks: malformed utf-8, rtl overrides, zero-width
+// and combining characters, emoji sequences and long messages
+var fuzzSeeds = []string{
+	"",
+	"hello world, how are you?",
+	"\xff\xfe\xfd invalid utf-8 \xc3\x28 bytes",
+	"\u202ebuy crypto now\u202c earn \u202d100$\u202c a day",
+	"b\u200buy c\u200cr\u200dypto\ufeff",
+	"z\u0335a\u0335l\u0335g\u0335o\u0335 t\u0336e\u0336x\u0336t",
+	"👨‍👩‍👧‍👦🏳️‍🌈 #️⃣ 1️⃣ 🇺🇸🇺🇸 \U000e0067",
+	"Привет, مرحبا, שלום, 你好, ",
+	strings.Repeat("spam ", 10000),
+	strings.Repeat("😁", 5000),
+	strings.Repeat("a", 100000),
+	"\"quoted, tokens\", \"like\", \"excluded\"",
+}
+
+func FuzzDetector_tokenize(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	d := Detector{samplesIndex: samplesIndex{excludedTokens: []string{"the", "she"}}}
+	f.Fuzz(func(t *testing.T, inp string) {
+		for token, count := range d.tokenize(inp) {
+			if count <= 0 {
+				t.Fatalf("invalid count %d of token %q", count, token)
+			}
+			if utf8.RuneCountInString(token) < 3 {
+				t.Fatalf("short token %q", token)
+			}
+			if token != strings.ToLower(token) {
+				t.Fatalf("token %q is not lowercase", token)
+			}
+		}
+	})
+}
+
 func TestDetector_tokenChan(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -849,3 +1547,189 @@ func TestCheckResult_String(t *testing.T) {
 		})
 	}
 }
+
+func TestDetector_UpdateSampleDedup(t *testing.T) {
+	upd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	d.WithSpamUpdater(upd)
+	d.WithHamUpdater(upd)
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("win free iPhone")},
+		[]io.Reader{strings.NewReader("hello world")})
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.classifier.nAllDocument)
+
+	require.NoError(t, d.UpdateSpam("win free iPhone"))
+	assert.Equal(t, 2, d.classifier.nAllDocument, "loaded sample is not learned again")
+	assert.Empty(t, upd.AppendCalls())
+
+	require.NoError(t, d.UpdateSpam("lottery prize"))
+	require.NoError(t, d.UpdateSpam("lottery prize"))
+	assert.Equal(t, 3, d.classifier.nAllDocument, "confirmed twice, learned once")
+	assert.Len(t, upd.AppendCalls(), 1)
+
+	require.NoError(t, d.UpdateHam("lottery prize"))
+	assert.Equal(t, 4, d.classifier.nAllDocument, "the same text as ham is a different sample")
+	assert.Len(t, upd.AppendCalls(), 2)
+
+	d.Reset()
+	require.NoError(t, d.UpdateSpam("lottery prize"))
+	assert.Equal(t, 1, d.classifier.nAllDocument, "learned again after reset")
+}
+
+func TestDetector_UpdateSampleFrom(t *testing.T) {
+	spamUpd := &mocks.SourcedSampleUpdaterMock{AppendFromFunc: func(msg, source string) error { return nil }}
+	hamUpd := &mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }}
+
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	d.WithSpamUpdater(spamUpd)
+	d.WithHamUpdater(hamUpd)
+
+	require.NoError(t, d.UpdateSpamFrom("win free iPhone", "admin:bob"))
+	require.NoError(t, d.UpdateSpam("lottery prize"))
+	require.Len(t, spamUpd.AppendFromCalls(), 2)
+	assert.Equal(t, "win free iPhone", spamUpd.AppendFromCalls()[0].Msg)
+	assert.Equal(t, "admin:bob", spamUpd.AppendFromCalls()[0].Source)
+	assert.Equal(t, "", spamUpd.AppendFromCalls()[1].Source, "no source")
+	assert.Empty(t, spamUpd.AppendCalls())
+
+	require.NoError(t, d.UpdateHamFrom("hello world", "api:basic"))
+	require.Len(t, hamUpd.AppendCalls(), 1, "source is not recorded by plain updater")
+	assert.Equal(t, "hello world", hamUpd.AppendCalls()[0].Msg)
+	assert.Equal(t, 3, d.classifier.nAllDocument)
+}
+
+func TestDetector_CheckMaxMsgLen(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, MaxMsgLen: 20})
+	_, err := d.LoadStopWords(strings.NewReader("buy crypto"))
+	require.NoError(t, err)
+
+	spam, cr := d.Check("hello there, buy crypto", "123")
+	assert.False(t, spam, "stop word is out of the checked part")
+	assert.Equal(t, []CheckResult{{Name: "stopword", Spam: false, Details: "not found"}}, cr)
+
+	spam, _ = d.Check("привет, buy crypto now", "123")
+	assert.True(t, spam, "limit is in runes")
+
+	d = NewDetector(Config{MaxAllowedEmoji: -1})
+	_, err = d.LoadStopWords(strings.NewReader("buy crypto"))
+	require.NoError(t, err)
+	spam, _ = d.Check(strings.Repeat("long message ", 1000)+"buy crypto", "123")
+	assert.True(t, spam, "not limited by default")
+}
+
+func TestDetector_NoSimilarityCorpus(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, MinSpamProbability: 50, NoSimilarityCorpus: true})
+	spamSamples := strings.NewReader("win free iPhone\nlottery prize xyz")
+	hamSamples := strings.NewReader("hello, how are you\nhave a nice day")
+	lr, err := d.LoadSamples(strings.NewReader(""), []io.Reader{spamSamples}, []io.Reader{hamSamples})
+	require.NoError(t, err)
+	assert.Equal(t, LoadResult{SpamSamples: 2, HamSamples: 2}, lr)
+	assert.Equal(t, 0, d.spamSamples.len(), "samples not kept")
+	assert.Equal(t, 4, d.classifier.nAllDocument, "classifier learned all samples")
+
+	spam, cr := d.Check("win a free iphone", "123")
+	assert.True(t, spam)
+	for _, r := range cr {
+		assert.NotEqual(t, "similarity", r.Name)
+	}
+	assert.Equal(t, "classifier", cr[len(cr)-1].Name)
+}
+
+func Test_truncateRunes(t *testing.T) {
+	tests := []struct {
+		inp    string
+		maxLen int
+		res    string
+	}{
+		{"", 5, ""},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello"},
+		{"привет мир", 6, "привет"},
+		{"😁😁😁", 2, "😁😁"},
+		{"ab\xffcd", 3, "ab\xff"},
+		{"hello", 0, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.res, truncateRunes(tt.inp, tt.maxLen), tt.inp)
+	}
+}
+
+// FuzzDetector_Check checks the full local check path doesn't panic on any input, and the verdict is consistent
+// with results of the checks
+func FuzzDetector_Check(f *testing.F) {
+	for _, s := range fuzzSeeds {
+		f.Add(s)
+	}
+	d := NewDetector(Config{MaxAllowedEmoji: 5, MinMsgLen: 10, SimilarityThreshold: 0.5, MinSpamProbability: 50,
+		MaxMsgLen: 4096})
+	_, err := d.LoadSamples(strings.NewReader("the, she"),
+		[]io.Reader{strings.NewReader("win a free iphone now\nbuy crypto and earn 100$ a day\n[job] remote job, 500$ a week")},
+		[]io.Reader{strings.NewReader("hello, how are you\nmeeting is at 5pm today\nthanks for the help")})
+	require.NoError(f, err)
+	_, err = d.LoadStopWords(strings.NewReader("earn money\nwrite me in private"))
+	require.NoError(f, err)
+
+	f.Fuzz(func(t *testing.T, msg string) {
+		spam, cr := d.Check(msg, "123")
+		anySpam := false
+		for _, r := range cr {
+			if r.Name == "" {
+				t.Fatalf("check result without name: %+v", r)
+			}
+			if strings.Contains(r.Details, "NaN") || strings.Contains(r.Details, "Inf") {
+				t.Fatalf("invalid details of %s: %q", r.Name, r.Details)
+			}
+			anySpam = anySpam || r.Spam
+		}
+		if spam != anySpam {
+			t.Fatalf("verdict %v is inconsistent with check results %+v", spam, cr)
+		}
+	})
+}
+
+func TestDetector_HamVeto(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5, MinSpamProbability: 50, HamVetoMargin: 0.1})
+	spamSamples := strings.NewReader("earn money fast with crypto signals, join channel\nwin free iphone lottery prize")
+	hamSamples := strings.NewReader("crypto signals channel promising to earn money fast is a scam, do not join\nhave a nice day")
+	_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{spamSamples}, []io.Reader{hamSamples})
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.hamSamples.len())
+
+	spam, cr := d.Check("the crypto signals channel promising to earn money fast is a scam, don't join it", "123")
+	assert.False(t, spam, "spam of similarity vetoed")
+	require.Equal(t, CheckHamVeto, cr[len(cr)-1].Name)
+	assert.False(t, cr[len(cr)-1].Spam)
+	assert.Equal(t, "suspicious, ham similarity 0.86, spam similarity 0.75, vetoed similarity", cr[len(cr)-1].Details)
+	assert.Equal(t, CheckResult{Name: "similarity", Spam: false, Details: "0.75/0.50, vetoed"}, cr[0])
+	for _, r := range cr[:len(cr)-1] {
+		assert.False(t, r.Spam, r.Name)
+	}
+
+	spam, cr = d.Check("earn money fast with crypto signals, join channel now", "123")
+	assert.True(t, spam, "similar to spam, not vetoed")
+	assert.NotEqual(t, CheckHamVeto, cr[len(cr)-1].Name)
+
+	t.Run("spam of other checks not vetoed", func(t *testing.T) {
+		_, err := d.LoadStopWords(strings.NewReader("is a scam"))
+		require.NoError(t, err)
+		defer func() { _, _ = d.LoadStopWords() }()
+		spam, cr := d.Check("the crypto signals channel promising to earn money fast is a scam, don't join it", "123")
+		assert.True(t, spam)
+		assert.NotEqual(t, CheckHamVeto, cr[len(cr)-1].Name)
+	})
+
+	t.Run("updated ham", func(t *testing.T) {
+		d.WithHamUpdater(&mocks.SampleUpdaterMock{AppendFunc: func(msg string) error { return nil }})
+		require.NoError(t, d.UpdateHam("win free iphone in the lottery, the prize is fake"))
+		assert.Equal(t, 3, d.hamSamples.len())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		d := NewDetector(Config{MaxAllowedEmoji: -1, SimilarityThreshold: 0.5})
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader("earn money fast with crypto signals, join channel")},
+			[]io.Reader{strings.NewReader("crypto signals channel promising to earn money fast is a scam, do not join")})
+		require.NoError(t, err)
+		assert.Equal(t, 0, d.hamSamples.len(), "ham samples not kept")
+	})
+}
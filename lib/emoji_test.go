@@ -1,7 +1,9 @@
 package lib
 
 import (
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -53,3 +55,23 @@ func Test_cleanEmoji(t *testing.T) {
 		})
 	}
 }
+
+func Fuzz_countEmoji(f *testing.F) {
+	for _, s := range []string{"", "Hello, world!", "👨‍👩‍👧‍👦 Family", "🏳️‍🌈", "#️⃣1️⃣", "🇺🇸🇺🇸", "\xf0\x9f\x98", "\u202e😁\u202c",
+		strings.Repeat("😁", 1000)} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		count := countEmoji(s)
+		if count < 0 || count > utf8.RuneCountInString(s) {
+			t.Fatalf("invalid count %d of emojis in %q", count, s)
+		}
+		clean := cleanEmoji(s)
+		if len(clean) > len(s) {
+			t.Fatalf("cleaned %q is longer than %q", clean, s)
+		}
+		if count == 0 && clean != s {
+			t.Fatalf("%q without emojis changed to %q", s, clean)
+		}
+	})
+}
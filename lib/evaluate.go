@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EvalSamples are labeled messages to evaluate detection on, with optional stop-words and excluded tokens
+type EvalSamples struct {
+	Spam           []string // spam messages, one message per item
+	Ham            []string // ham messages, one message per item
+	StopWords      []string // optional stop-words, loaded to each detector
+	ExcludedTokens []string // optional tokens excluded from tokenization of samples
+}
+
+// EvalReport is the result of evaluation, with confusion matrix and quality metrics of spam detection.
+// Spam is the positive class, i.e. false positive is a ham message detected as spam.
+type EvalReport struct {
+	Folds          int     `json:"folds"`
+	Spam           int     `json:"spam"`            // number of spam samples
+	Ham            int     `json:"ham"`             // number of ham samples
+	TruePositives  int     `json:"true_positives"`  // spam detected as spam
+	FalsePositives int     `json:"false_positives"` // ham detected as spam
+	TrueNegatives  int     `json:"true_negatives"`  // ham detected as ham
+	FalseNegatives int     `json:"false_negatives"` // spam detected as ham
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+	F1             float64 `json:"f1"`
+	Accuracy       float64 `json:"accuracy"`
+}
+
+// Evaluate estimates quality of detection with the given config on labeled samples, using k-fold cross-validation.
+// Samples of each class are split into folds, sample i goes to fold i%folds, so the result is reproducible.
+// Messages of each fold are checked by a detector trained on samples of all other folds. Network checks,
+// i.e. CAS and OpenAI, are not used, and each message is checked as sent by a new user.
+func Evaluate(cfg Config, samples EvalSamples, folds int) (EvalReport, error) {
+	if folds < 2 {
+		return EvalReport{}, fmt.Errorf("folds should be at least 2, got %d", folds)
+	}
+	if len(samples.Spam) < folds || len(samples.Ham) < folds {
+		return EvalReport{}, fmt.Errorf("not enough samples for %d folds, spam: %d, ham: %d",
+			folds, len(samples.Spam), len(samples.Ham))
+	}
+	cfg.FirstMessageOnly, cfg.FirstMessagesCount = false, 0
+
+	res := EvalReport{Folds: folds, Spam: len(samples.Spam), Ham: len(samples.Ham)}
+	for fold := 0; fold < folds; fold++ {
+		spamTrain, spamTest := splitFold(samples.Spam, folds, fold)
+		hamTrain, hamTest := splitFold(samples.Ham, folds, fold)
+
+		d := NewDetector(cfg)
+		if _, err := d.LoadSamples(joinSamples(samples.ExcludedTokens),
+			[]io.Reader{joinSamples(spamTrain)}, []io.Reader{joinSamples(hamTrain)}); err != nil {
+			return EvalReport{}, fmt.Errorf("failed to load samples of fold %d: %w", fold, err)
+		}
+		if len(samples.StopWords) > 0 {
+			if _, err := d.LoadStopWords(joinSamples(samples.StopWords)); err != nil {
+				return EvalReport{}, fmt.Errorf("failed to load stop-words: %w", err)
+			}
+		}
+
+		for i, msg := range spamTest {
+			if spam, _ := d.CheckLocal(msg, fmt.Sprintf("eval-spam-%d-%d", fold, i)); spam {
+				res.TruePositives++
+				continue
+			}
+			res.FalseNegatives++
+		}
+		for i, msg := range hamTest {
+			if spam, _ := d.CheckLocal(msg, fmt.Sprintf("eval-ham-%d-%d", fold, i)); spam {
+				res.FalsePositives++
+				continue
+			}
+			res.TrueNegatives++
+		}
+	}
+
+	res.Precision = ratio(res.TruePositives, res.TruePositives+res.FalsePositives)
+	res.Recall = ratio(res.TruePositives, res.TruePositives+res.FalseNegatives)
+	if res.Precision+res.Recall > 0 {
+		res.F1 = 2 * res.Precision * res.Recall / (res.Precision + res.Recall)
+	}
+	res.Accuracy = ratio(res.TruePositives+res.TrueNegatives, res.Spam+res.Ham)
+	return res, nil
+}
+
+// splitFold returns samples used for training and for test of the fold
+func splitFold(samples []string, folds, fold int) (train, test []string) {
+	for i, s := range samples {
+		if i%folds == fold {
+			test = append(test, s)
+			continue
+		}
+		train = append(train, s)
+	}
+	return train, test
+}
+
+// joinSamples returns a reader of samples, one sample per line, as samples are read from files
+func joinSamples(samples []string) io.Reader {
+	lines := make([]string, 0, len(samples))
+	for _, s := range samples {
+		lines = append(lines, strings.ReplaceAll(s, "\n", " "))
+	}
+	return strings.NewReader(strings.Join(lines, "\n"))
+}
+
+// ratio returns a/b, or 0 if b is 0
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	samples := EvalSamples{
+		Spam: []string{"win a free prize now", "free prize waiting for you", "claim your free prize today",
+			"earn money fast with crypto", "crypto money fast and easy", "fast money with crypto trading"},
+		Ham: []string{"see you at the meeting tomorrow", "the meeting is moved to friday", "thanks for the notes from the meeting",
+			"lunch at noon works for me", "can we have lunch on monday", "lunch place near the office"},
+	}
+	cfg := Config{SimilarityThreshold: 0.3, MaxAllowedEmoji: -1, FirstMessageOnly: true}
+
+	res, err := Evaluate(cfg, samples, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Folds)
+	assert.Equal(t, 6, res.Spam)
+	assert.Equal(t, 6, res.Ham)
+	assert.Equal(t, 6, res.TruePositives+res.FalseNegatives)
+	assert.Equal(t, 6, res.TrueNegatives+res.FalsePositives)
+	assert.Equal(t, 6, res.TruePositives)
+	assert.Equal(t, 0, res.FalsePositives)
+	assert.InDelta(t, 1.0, res.Precision, 0.001)
+	assert.InDelta(t, 1.0, res.Recall, 0.001)
+	assert.InDelta(t, 1.0, res.F1, 0.001)
+	assert.InDelta(t, 1.0, res.Accuracy, 0.001)
+
+	again, err := Evaluate(cfg, samples, 3)
+	require.NoError(t, err)
+	assert.Equal(t, res, again, "reproducible")
+
+	t.Run("stop-words", func(t *testing.T) {
+		samples := samples
+		samples.StopWords = []string{"meeting"}
+		res, err := Evaluate(cfg, samples, 3)
+		require.NoError(t, err)
+		assert.Equal(t, 3, res.FalsePositives, "ham with stop-word detected as spam")
+		assert.InDelta(t, 6.0/9.0, res.Precision, 0.001)
+		assert.InDelta(t, 1.0, res.Recall, 0.001)
+		assert.InDelta(t, 0.8, res.F1, 0.001)
+		assert.InDelta(t, 0.75, res.Accuracy, 0.001)
+	})
+
+	t.Run("nothing detected", func(t *testing.T) {
+		res, err := Evaluate(Config{MinMsgLen: 1000, MaxAllowedEmoji: -1}, samples, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 6, res.FalseNegatives)
+		assert.Zero(t, res.Precision)
+		assert.Zero(t, res.Recall)
+		assert.Zero(t, res.F1)
+		assert.InDelta(t, 0.5, res.Accuracy, 0.001)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Evaluate(cfg, samples, 1)
+		assert.EqualError(t, err, "folds should be at least 2, got 1")
+		_, err = Evaluate(cfg, samples, 7)
+		assert.EqualError(t, err, "not enough samples for 7 folds, spam: 6, ham: 6")
+	})
+}
+
+func TestSplitFold(t *testing.T) {
+	train, test := splitFold([]string{"a", "b", "c", "d", "e"}, 2, 1)
+	assert.Equal(t, []string{"a", "c", "e"}, train)
+	assert.Equal(t, []string{"b", "d"}, test)
+}
@@ -47,4 +47,13 @@
 // user-defined structs that implement the SampleUpdater interface.
 //
 // The user can also add (lib.AddApprovedUsers) and remove (lib.RemoveApprovedUsers) users to/from the list of approved user ids.
+// To persist approved users on each change, Detector.WithUserStorage should be used to provide a user-defined
+// struct that implements the UserStorage interface.
+//
+// Evaluate estimates quality of detection with a given Config on labeled spam and ham samples, using k-fold
+// cross-validation. It reports the confusion matrix, precision, recall and F1 score, so changes of samples
+// and thresholds can be checked before deployment.
+//
+// Package tgspam exposes the stable part of this api, covered by the compatibility policy, and package spamcheck
+// has requests and results of checks, shared with the check api served by package server.
 package lib
@@ -3,8 +3,14 @@ package lib
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	tokenizer "github.com/sandwich-go/gpt3-encoder"
 	"github.com/sashabaranov/go-openai"
@@ -14,8 +20,13 @@ import (
 
 // openAIChecker is a wrapper for OpenAI API to check if a text is spam
 type openAIChecker struct {
-	client openAIClient
-	params OpenAIConfig
+	client  openAIClient
+	params  OpenAIConfig
+	breaker *circuitBreaker // nil if circuit breaker is disabled
+	usage   *openAIUsageTracker
+
+	suspended  atomic.Bool  // requests are skipped, set by Detector.SuspendOpenAI
+	promptLock sync.RWMutex // guards SystemPrompt of params, changed by setPrompt
 }
 
 // OpenAIConfig contains parameters for openAIChecker
@@ -26,25 +37,154 @@ type OpenAIConfig struct {
 	MaxTokensRequest  int // Max request length in tokens
 	MaxSymbolsRequest int // Fallback: Max request length in symbols, if tokenizer was failed
 	Model             string
-	SystemPrompt      string
+	SystemPrompt      string        // default prompt if empty, can be changed at runtime with Detector.SetOpenAIPrompt
+	Timeout           time.Duration // max time of a request, no limit if 0
+
+	// circuit breaker stops requests to OpenAI after BreakerThreshold of consecutive failures or timeouts,
+	// and probes it with a single request every BreakerCooldown till it succeeds
+	BreakerThreshold int                        // consecutive failures opening the breaker, disabled if 0
+	BreakerCooldown  time.Duration              // time the open breaker skips requests before a probe, 1m if not set
+	BreakerNotify    func(open bool, err error) // optional, called when the breaker opens, with the last error, and closes
+
+	// usage is tracked per day, in local time, with the cost estimated by prices of 1M tokens
+	PromptPrice     float64                 // price of 1M prompt tokens
+	CompletionPrice float64                 // price of 1M completion tokens
+	DailyBudget     float64                 // max estimated cost of requests per day, requests skipped after, no limit if 0
+	BudgetNotify    func(usage OpenAIUsage) // optional, called once a day when the budget is exceeded, with usage of the day
+
+	// Categories are actions of categories of messages reported by OpenAI, by category name. OpenAI is asked
+	// to classify the message into OpenAICategories and configured ones if set. The action of the category replaces
+	// the spam flag of the response if the confidence is at least MinConfidence of the category.
+	Categories map[string]OpenAICategory
+
+	// FailClosed keeps the verdict of other checks if OpenAI failed or skipped by the open breaker, i.e. spam
+	// detected by other checks in veto mode. Otherwise, the message is considered ham, as OpenAI didn't confirm spam.
+	FailClosed bool
+}
+
+// OpenAICategoryAction is an action on message of the category reported by OpenAI
+type OpenAICategoryAction string
+
+// enum of openai category actions
+const (
+	OpenAICategoryActionSpam   OpenAICategoryAction = "spam"   // message is spam, the default
+	OpenAICategoryActionWarn   OpenAICategoryAction = "warn"   // user is warned with a reply, message is not spam
+	OpenAICategoryActionReport OpenAICategoryAction = "report" // message is reported to admins, message is not spam
+)
+
+// OpenAICategory is a min confidence and action of messages of the category reported by OpenAI
+type OpenAICategory struct {
+	MinConfidence int                  // min confidence of openai in percents to apply the action, 0 - any
+	Action        OpenAICategoryAction // action on message of the category, OpenAICategoryActionSpam if empty
+}
+
+// OpenAICategories are built-in categories OpenAI classifies messages into, if categories are configured
+var OpenAICategories = []string{"advertising", "scam", "crypto", "adult", "off-topic", "harassment"}
+
+// CheckOpenAICategory is a name of check result reported if OpenAI classified the message into a category
+// with warn or report action. The result is never spam, Details are the category and the reason of OpenAI.
+const CheckOpenAICategory = "openai category"
+
+// OpenAIPolicy defines which verdicts of other checks are checked by OpenAI, and which of them OpenAI can override.
+// OpenAI confirms the verdict it agrees with, and overrides the one it disagrees with if allowed by the policy
+// and confident enough. I.e. the policy with OnSpam and Rescue only lets OpenAI rescue false positives of other
+// checks, but never creates new bans, which is the veto mode.
+type OpenAIPolicy struct {
+	OnHam         bool // openai checks messages found ham by other checks
+	OnSpam        bool // openai checks messages found spam by other checks
+	Ban           bool // openai can override ham verdict, making the message spam
+	Rescue        bool // openai can override spam verdict, making the message ham
+	MinConfidence int  // min confidence of openai in percents to override the verdict, 0 - any
+}
+
+// String returns the policy as "on ham, spam; override ban, rescue; min confidence 80%"
+func (p OpenAIPolicy) String() string {
+	list := func(names []string, enabled ...bool) string {
+		res := []string{}
+		for i, name := range names {
+			if enabled[i] {
+				res = append(res, name)
+			}
+		}
+		if len(res) == 0 {
+			return "none"
+		}
+		return strings.Join(res, ", ")
+	}
+	res := "on " + list([]string{"ham", "spam"}, p.OnHam, p.OnSpam) + "; override " + list([]string{"ban", "rescue"}, p.Ban, p.Rescue)
+	if p.MinConfidence > 0 {
+		res += fmt.Sprintf("; min confidence %d%%", p.MinConfidence)
+	}
+	return res
+}
+
+// verdict returns the verdict of the message, made by OpenAI verdict over the prior verdict of other checks.
+// The prior verdict is kept if OpenAI is not allowed to override it or not confident enough, and the reason
+// is returned. Failed OpenAI didn't confirm spam, so the spam verdict is overridden if rescue is allowed,
+// unless failClosed is set.
+func (p OpenAIPolicy) verdict(prior, spam bool, confidence int, failed, failClosed bool) (res bool, ignored string) {
+	switch {
+	case failed:
+		return prior && (failClosed || !p.Rescue), ""
+	case spam == prior:
+		return prior, "" // confirmed
+	case spam && !p.Ban:
+		return prior, "ban not allowed by policy"
+	case !spam && !p.Rescue:
+		return prior, "rescue not allowed by policy"
+	case confidence < p.MinConfidence:
+		return prior, fmt.Sprintf("confidence below %d%%", p.MinConfidence)
+	}
+	return spam, ""
+}
+
+// Conversation is a context of the checked message in the chat, passed to OpenAI with WithConversation, so the model
+// can judge relevance of the message, i.e. "check my channel" is spam on its own, but not as an answer to
+// "where can I read more?". Other checks don't use it.
+type Conversation struct {
+	ReplyTo string   // text of the message the checked one replies to, empty if not a reply
+	Recent  []string // texts of recent messages of the chat before the checked one, oldest first
+}
+
+type conversationKey struct{}
+
+// WithConversation returns the context with the conversation of the checked message, for CheckContext
+func WithConversation(ctx context.Context, c Conversation) context.Context {
+	return context.WithValue(ctx, conversationKey{}, c)
+}
+
+// ConversationFrom returns the conversation set by WithConversation, false if not set or empty
+func ConversationFrom(ctx context.Context) (Conversation, bool) {
+	c, ok := ctx.Value(conversationKey{}).(Conversation)
+	return c, ok && (c.ReplyTo != "" || len(c.Recent) > 0)
 }
 
 type openAIClient interface {
 	CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
 }
 
-const defaultPrompt = `I'll give you a text from the messaging application and you will return me a json with three fields: {"spam": true/false, "reason":"why this is spam", "confidence":1-100}. Set spam:true only of confidence above 80`
+// errBreakerOpen is returned by check if the request is skipped by the open circuit breaker
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// errSuspended is returned by check if the request is skipped, as requests are suspended, i.e. by exceeded quota
+var errSuspended = errors.New("openai suspended")
+
+// DefaultOpenAIPrompt is the system prompt used if not set
+const DefaultOpenAIPrompt = `I'll give you a text from the messaging application and you will return me a json with three fields: {"spam": true/false, "reason":"why this is spam", "confidence":1-100}. Set spam:true only of confidence above 80`
 
 type openAIResponse struct {
 	IsSpam     bool   `json:"spam"`
 	Reason     string `json:"reason"`
 	Confidence int    `json:"confidence"`
+	Category   string `json:"category"` // requested only if categories are configured, "none" if no category fits
+
+	action OpenAICategoryAction // action of the configured category applied to the response, empty if not applied
 }
 
 // newOpenAIChecker makes a bot for ChatGPT
 func newOpenAIChecker(client openAIClient, params OpenAIConfig) *openAIChecker {
 	if params.SystemPrompt == "" {
-		params.SystemPrompt = defaultPrompt
+		params.SystemPrompt = DefaultOpenAIPrompt
 	}
 	if params.MaxTokensResponse == 0 {
 		params.MaxTokensResponse = 1024
@@ -58,24 +198,77 @@ func newOpenAIChecker(client openAIClient, params OpenAIConfig) *openAIChecker {
 	if params.Model == "" {
 		params.Model = "gpt-4"
 	}
-	return &openAIChecker{client: client, params: params}
+	if params.BreakerCooldown == 0 {
+		params.BreakerCooldown = time.Minute
+	}
+	res := &openAIChecker{client: client, params: params, usage: &openAIUsageTracker{params: params, now: time.Now}}
+	if params.BreakerThreshold > 0 {
+		res.breaker = newCircuitBreaker(params.BreakerThreshold, params.BreakerCooldown, params.BreakerNotify)
+	}
+	return res
 }
 
-// check checks if a text is spam
-func (o *openAIChecker) check(msg string) (spam bool, cr CheckResult) {
+// check checks if a text is spam, with confidence of the verdict in percents and the category of the message,
+// if categories are configured. The spam flag of the response is set by the action of the category.
+// Returns error if OpenAI failed, or the request was skipped by suspension, the open breaker or the exceeded daily budget.
+func (o *openAIChecker) check(ctx context.Context, msg string) (resp openAIResponse, cr CheckResult, err error) {
 	if o.client == nil {
-		return false, CheckResult{}
+		return openAIResponse{}, CheckResult{}, nil
+	}
+	if o.suspended.Load() {
+		return openAIResponse{}, CheckResult{Spam: false, Name: "openai", Details: "OpenAI skipped, suspended"}, errSuspended
+	}
+	if o.usage.exceeded() {
+		return openAIResponse{}, CheckResult{Spam: false, Name: "openai", Details: "OpenAI skipped, daily budget exceeded"}, errBudgetExceeded
+	}
+	if o.breaker != nil && !o.breaker.allow() {
+		return openAIResponse{}, CheckResult{Spam: false, Name: "openai", Details: "OpenAI skipped, circuit breaker open"}, errBreakerOpen
 	}
 
-	resp, err := o.sendRequest(msg)
+	if o.params.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.params.Timeout)
+		defer cancel()
+	}
+	resp, err = o.sendRequest(ctx, msg)
+	if o.breaker != nil {
+		switch {
+		case err == nil:
+			o.breaker.success()
+		case ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded):
+			o.breaker.cancel() // canceled by the caller, i.e. on shutdown
+		default:
+			o.breaker.failure(err)
+		}
+	}
 	if err != nil {
-		return false, CheckResult{Spam: false, Name: "openai", Details: fmt.Sprintf("OpenAI error: %v", err)}
+		return openAIResponse{}, CheckResult{Spam: false, Name: "openai", Details: fmt.Sprintf("OpenAI error: %v", err)}, err
+	}
+	details := strings.TrimSuffix(resp.Reason, ".") + ", confidence: " + fmt.Sprintf("%d%%", resp.Confidence)
+	if c, ok := o.params.Categories[resp.Category]; ok && resp.Confidence >= c.MinConfidence {
+		resp.action = c.Action
+		if resp.action == "" {
+			resp.action = OpenAICategoryActionSpam
+		}
+		resp.IsSpam = resp.action == OpenAICategoryActionSpam
+		details += ", category: " + resp.Category
+		if !resp.IsSpam {
+			details += ", " + string(resp.action)
+		}
+	}
+	return resp, CheckResult{Spam: resp.IsSpam, Name: "openai", Details: details}, nil
+}
+
+// categoryResult returns the check result of the category with warn or report action applied to the response
+func (o *openAIChecker) categoryResult(resp openAIResponse) (CheckResult, bool) {
+	if resp.action != OpenAICategoryActionWarn && resp.action != OpenAICategoryActionReport {
+		return CheckResult{}, false
 	}
-	return resp.IsSpam, CheckResult{Spam: resp.IsSpam, Name: "openai",
-		Details: strings.TrimSuffix(resp.Reason, ".") + ", confidence: " + fmt.Sprintf("%d%%", resp.Confidence)}
+	return CheckResult{Name: CheckOpenAICategory, Spam: false,
+		Details: resp.Category + ", " + string(resp.action) + ", " + strings.TrimSuffix(resp.Reason, ".")}, true
 }
 
-func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err error) {
+func (o *openAIChecker) sendRequest(ctx context.Context, msg string) (response openAIResponse, err error) {
 	// Reduce the request size with tokenizer and fallback to default reducer if it fails
 	// The API supports 4097 tokens ~16000 characters (<=4 per token) for request + result together
 	// The response is limited to 1000 tokens and OpenAI always reserved it for the result
@@ -108,19 +301,26 @@ func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err er
 
 	r := reduceRequest(msg)
 
-	data := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: o.params.SystemPrompt},
-		{Role: openai.ChatMessageRoleUser, Content: r},
+	data := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: o.prompt()}}
+	if conv, ok := ConversationFrom(ctx); ok {
+		// context of the conversation is passed as a separate system message, so it is not judged as the text itself
+		data = append(data, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem,
+			Content: reduceRequest(conversationPrompt(conv))})
 	}
+	if len(o.params.Categories) > 0 {
+		data = append(data, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: o.categoriesPrompt()})
+	}
+	data = append(data, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: r})
 
 	resp, err := o.client.CreateChatCompletion(
-		context.Background(),
+		ctx,
 		openai.ChatCompletionRequest{Model: o.params.Model, MaxTokens: o.params.MaxTokensResponse, Messages: data},
 	)
 
 	if err != nil {
 		return openAIResponse{}, err
 	}
+	o.usage.record(resp.Usage) // tokens are billed even if the response is not valid
 
 	// OpenAI platform supports returning multiple chat completion choices, but we use only the first one:
 	// https://platform.openai.com/docs/api-reference/chat/create#chat/create-n
@@ -134,3 +334,52 @@ func (o *openAIChecker) sendRequest(msg string) (response openAIResponse, err er
 
 	return response, nil
 }
+
+// prompt returns the current system prompt
+func (o *openAIChecker) prompt() string {
+	o.promptLock.RLock()
+	defer o.promptLock.RUnlock()
+	return o.params.SystemPrompt
+}
+
+// setPrompt changes the system prompt, the default one is set if empty
+func (o *openAIChecker) setPrompt(prompt string) {
+	if prompt == "" {
+		prompt = DefaultOpenAIPrompt
+	}
+	o.promptLock.Lock()
+	defer o.promptLock.Unlock()
+	o.params.SystemPrompt = prompt
+}
+
+// categoriesPrompt makes a prompt asking for the category of the text, built-in and configured ones
+func (o *openAIChecker) categoriesPrompt() string {
+	categories := append([]string{}, OpenAICategories...)
+	extra := []string{}
+	for name := range o.params.Categories {
+		if !slices.Contains(categories, name) {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	categories = append(categories, extra...)
+	return `Add "category" field to the json, with the category of the text, one of: ` + strings.Join(categories, ", ") +
+		`, or "none" if none of them fits.`
+}
+
+// conversationPrompt makes a prompt with the conversation of the checked text
+func conversationPrompt(c Conversation) string {
+	sb := strings.Builder{}
+	sb.WriteString("The text is a message of a group chat. Use the conversation below to judge whether the text is " +
+		"relevant to it, don't check the conversation itself.\n")
+	if len(c.Recent) > 0 {
+		sb.WriteString("\nRecent messages of the chat, oldest first:\n")
+		for _, m := range c.Recent {
+			sb.WriteString("- " + strings.ReplaceAll(m, "\n", " ") + "\n")
+		}
+	}
+	if c.ReplyTo != "" {
+		sb.WriteString("\nThe text is a reply to the message:\n" + c.ReplyTo + "\n")
+	}
+	return sb.String()
+}
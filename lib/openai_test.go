@@ -3,9 +3,11 @@ package lib
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/umputun/tg-spam/lib/mocks"
 )
@@ -39,9 +41,11 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
-		t.Logf("spam: %v, details: %+v", spam, details)
-		assert.True(t, spam)
+		resp, details, err := checker.check(context.Background(), "some text")
+		assert.NoError(t, err)
+		t.Logf("spam: %v, details: %+v", resp.IsSpam, details)
+		assert.True(t, resp.IsSpam)
+		assert.Equal(t, 100, resp.Confidence)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "bad text, confidence: 100%", details.Details)
 	})
@@ -55,9 +59,10 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
-		t.Logf("spam: %v, details: %+v", spam, details)
-		assert.False(t, spam)
+		resp, details, err := checker.check(context.Background(), "some text")
+		assert.NoError(t, err)
+		t.Logf("spam: %v, details: %+v", resp.IsSpam, details)
+		assert.False(t, resp.IsSpam)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "good text, confidence: 99%", details.Details)
 	})
@@ -67,9 +72,10 @@ func TestOpenAIChecker_Check(t *testing.T) {
 			contextMoqParam context.Context, chatCompletionRequest openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 			return openai.ChatCompletionResponse{}, assert.AnError
 		}
-		spam, details := checker.check("some text")
-		t.Logf("spam: %v, details: %+v", spam, details)
-		assert.False(t, spam)
+		resp, details, err := checker.check(context.Background(), "some text")
+		assert.Error(t, err)
+		t.Logf("spam: %v, details: %+v", resp.IsSpam, details)
+		assert.False(t, resp.IsSpam)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "OpenAI error: assert.AnError general error for testing", details.Details)
 	})
@@ -83,9 +89,10 @@ func TestOpenAIChecker_Check(t *testing.T) {
 				}},
 			}, nil
 		}
-		spam, details := checker.check("some text")
-		t.Logf("spam: %v, details: %+v", spam, details)
-		assert.False(t, spam)
+		resp, details, err := checker.check(context.Background(), "some text")
+		assert.Error(t, err)
+		t.Logf("spam: %v, details: %+v", resp.IsSpam, details)
+		assert.False(t, resp.IsSpam)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "OpenAI error: can't unmarshal response: invalid character 'b' looking for beginning of value", details.Details)
 	})
@@ -95,10 +102,226 @@ func TestOpenAIChecker_Check(t *testing.T) {
 			contextMoqParam context.Context, chatCompletionRequest openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 			return openai.ChatCompletionResponse{}, nil
 		}
-		spam, details := checker.check("some text")
-		t.Logf("spam: %v, details: %+v", spam, details)
-		assert.False(t, spam)
+		resp, details, err := checker.check(context.Background(), "some text")
+		assert.Error(t, err)
+		t.Logf("spam: %v, details: %+v", resp.IsSpam, details)
+		assert.False(t, resp.IsSpam)
 		assert.Equal(t, "openai", details.Name)
 		assert.Equal(t, "OpenAI error: no choices in response", details.Details)
 	})
 }
+
+func TestOpenAIChecker_CheckConversation(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"answer", "confidence":90}`},
+			}}}, nil
+		},
+	}
+	checker := newOpenAIChecker(clientMock, OpenAIConfig{SystemPrompt: "prompt"})
+
+	ctx := WithConversation(context.Background(), Conversation{ReplyTo: "where can I read more?",
+		Recent: []string{"hi all", "multi\nline"}})
+	_, _, err := checker.check(ctx, "check my channel")
+	assert.NoError(t, err)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 1)
+	msgs := clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest.Messages
+	require.Len(t, msgs, 3)
+	assert.Equal(t, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "prompt"}, msgs[0])
+	assert.Equal(t, openai.ChatMessageRoleSystem, msgs[1].Role)
+	assert.Contains(t, msgs[1].Content, "Recent messages of the chat, oldest first:\n- hi all\n- multi line\n")
+	assert.Contains(t, msgs[1].Content, "The text is a reply to the message:\nwhere can I read more?\n")
+	assert.Equal(t, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "check my channel"}, msgs[2])
+
+	// empty conversation is not passed
+	_, _, err = checker.check(WithConversation(context.Background(), Conversation{}), "check my channel")
+	assert.NoError(t, err)
+	require.Len(t, clientMock.CreateChatCompletionCalls(), 2)
+	assert.Len(t, clientMock.CreateChatCompletionCalls()[1].ChatCompletionRequest.Messages, 2)
+}
+
+func TestOpenAIChecker_CheckCategories(t *testing.T) {
+	response := ""
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: response}}}}, nil
+		},
+	}
+	checker := newOpenAIChecker(clientMock, OpenAIConfig{SystemPrompt: "prompt", Categories: map[string]OpenAICategory{
+		"scam":      {MinConfidence: 80},
+		"off-topic": {MinConfidence: 70, Action: OpenAICategoryActionWarn},
+		"politics":  {Action: OpenAICategoryActionReport},
+	}})
+
+	tbl := []struct {
+		name     string
+		response string
+		spam     bool
+		details  string
+		category string // details of category result, empty if not reported
+	}{
+		{name: "scam", response: `{"spam": false, "reason":"fake giveaway", "confidence":90, "category":"scam"}`,
+			spam: true, details: "fake giveaway, confidence: 90%, category: scam"},
+		{name: "scam not confident", response: `{"spam": false, "reason":"giveaway", "confidence":60, "category":"scam"}`,
+			spam: false, details: "giveaway, confidence: 60%"},
+		{name: "off-topic", response: `{"spam": true, "reason":"about football", "confidence":75, "category":"off-topic"}`,
+			spam: false, details: "about football, confidence: 75%, category: off-topic, warn", category: "off-topic, warn, about football"},
+		{name: "custom category", response: `{"spam": false, "reason":"elections", "confidence":50, "category":"politics"}`,
+			spam: false, details: "elections, confidence: 50%, category: politics, report", category: "politics, report, elections"},
+		{name: "not configured", response: `{"spam": true, "reason":"ads", "confidence":90, "category":"advertising"}`,
+			spam: true, details: "ads, confidence: 90%"},
+		{name: "none", response: `{"spam": false, "reason":"fine", "confidence":90, "category":"none"}`,
+			spam: false, details: "fine, confidence: 90%"},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			response = tt.response
+			resp, cr, err := checker.check(context.Background(), "some text")
+			require.NoError(t, err)
+			assert.Equal(t, tt.spam, resp.IsSpam)
+			assert.Equal(t, CheckResult{Name: "openai", Spam: tt.spam, Details: tt.details}, cr)
+			res, ok := checker.categoryResult(resp)
+			assert.Equal(t, tt.category != "", ok)
+			if ok {
+				assert.Equal(t, CheckResult{Name: CheckOpenAICategory, Details: tt.category}, res)
+			}
+		})
+	}
+
+	msgs := clientMock.CreateChatCompletionCalls()[0].ChatCompletionRequest.Messages
+	require.Len(t, msgs, 3)
+	assert.Equal(t, openai.ChatMessageRoleSystem, msgs[1].Role)
+	assert.Contains(t, msgs[1].Content, "one of: advertising, scam, crypto, adult, off-topic, harassment, politics, "+
+		`or "none"`)
+
+	// categories are not requested if not configured
+	checker = newOpenAIChecker(clientMock, OpenAIConfig{SystemPrompt: "prompt"})
+	_, _, err := checker.check(context.Background(), "some text")
+	require.NoError(t, err)
+	calls := clientMock.CreateChatCompletionCalls()
+	assert.Len(t, calls[len(calls)-1].ChatCompletionRequest.Messages, 2)
+}
+
+func TestDetector_SetOpenAIPrompt(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"ok", "confidence":90}`},
+			}}}, nil
+		},
+	}
+	d := NewDetector(Config{})
+	d.SetOpenAIPrompt("ignored") // no-op without checker
+	d.WithOpenAIChecker(clientMock, OpenAIConfig{SystemPrompt: "prompt"})
+
+	sentPrompt := func() string {
+		_, _, err := d.openaiChecker.check(context.Background(), "some text")
+		require.NoError(t, err)
+		calls := clientMock.CreateChatCompletionCalls()
+		return calls[len(calls)-1].ChatCompletionRequest.Messages[0].Content
+	}
+	assert.Equal(t, "prompt", sentPrompt())
+	d.SetOpenAIPrompt("new prompt")
+	assert.Equal(t, "new prompt", sentPrompt())
+	d.SetOpenAIPrompt("")
+	assert.Equal(t, DefaultOpenAIPrompt, sentPrompt(), "default prompt if empty")
+}
+
+func TestDetector_SuspendOpenAI(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"ok", "confidence":90}`},
+			}}}, nil
+		},
+	}
+	d := NewDetector(Config{})
+	d.SuspendOpenAI(true) // no-op without checker
+	d.WithOpenAIChecker(clientMock, OpenAIConfig{})
+
+	d.SuspendOpenAI(true)
+	_, cr, err := d.openaiChecker.check(context.Background(), "some text")
+	assert.ErrorIs(t, err, errSuspended)
+	assert.Equal(t, "OpenAI skipped, suspended", cr.Details)
+	assert.Empty(t, clientMock.CreateChatCompletionCalls())
+
+	d.SuspendOpenAI(false)
+	_, _, err = d.openaiChecker.check(context.Background(), "some text")
+	require.NoError(t, err)
+	assert.Len(t, clientMock.CreateChatCompletionCalls(), 1)
+}
+
+func TestOpenAIChecker_CheckTimeout(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(ctx context.Context, _ openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			<-ctx.Done()
+			return openai.ChatCompletionResponse{}, ctx.Err()
+		},
+	}
+	checker := newOpenAIChecker(clientMock, OpenAIConfig{Timeout: 10 * time.Millisecond, BreakerThreshold: 1})
+
+	resp, details, err := checker.check(context.Background(), "some text")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, resp.IsSpam)
+	assert.Equal(t, "OpenAI error: context deadline exceeded", details.Details)
+	assert.True(t, checker.breaker.isOpen(), "timeout is a failure")
+
+	_, details, err = checker.check(context.Background(), "some text")
+	assert.ErrorIs(t, err, errBreakerOpen)
+	assert.Equal(t, "OpenAI skipped, circuit breaker open", details.Details)
+	assert.Len(t, clientMock.CreateChatCompletionCalls(), 1)
+
+	// canceled by the caller, not a failure of the service
+	checker = newOpenAIChecker(clientMock, OpenAIConfig{BreakerThreshold: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = checker.check(ctx, "some text")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, checker.breaker.isOpen())
+}
+
+func TestOpenAIPolicy_verdict(t *testing.T) {
+	veto := OpenAIPolicy{OnSpam: true, Rescue: true}
+	full := OpenAIPolicy{OnHam: true, OnSpam: true, Ban: true, Rescue: true, MinConfidence: 80}
+	tbl := []struct {
+		name       string
+		policy     OpenAIPolicy
+		prior      bool
+		spam       bool
+		confidence int
+		failed     bool
+		failClosed bool
+		res        bool
+		ignored    string
+	}{
+		{name: "veto confirms spam", policy: veto, prior: true, spam: true, confidence: 90, res: true},
+		{name: "veto rescues spam", policy: veto, prior: true, spam: false, confidence: 90, res: false},
+		{name: "veto can't ban", policy: veto, prior: false, spam: true, confidence: 90, res: false,
+			ignored: "ban not allowed by policy"},
+		{name: "ban only can't rescue", policy: OpenAIPolicy{OnHam: true, OnSpam: true, Ban: true}, prior: true,
+			spam: false, confidence: 90, res: true, ignored: "rescue not allowed by policy"},
+		{name: "full bans", policy: full, prior: false, spam: true, confidence: 80, res: true},
+		{name: "full not confident", policy: full, prior: true, spam: false, confidence: 79, res: true,
+			ignored: "confidence below 80%"},
+		{name: "failed, fail-open rescue", policy: full, prior: true, failed: true, res: false},
+		{name: "failed, fail-closed", policy: full, prior: true, failed: true, failClosed: true, res: true},
+		{name: "failed, no rescue", policy: OpenAIPolicy{OnSpam: true, Ban: true}, prior: true, failed: true, res: true},
+		{name: "failed, ham", policy: full, prior: false, failed: true, res: false},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.name, func(t *testing.T) {
+			res, ignored := tt.policy.verdict(tt.prior, tt.spam, tt.confidence, tt.failed, tt.failClosed)
+			assert.Equal(t, tt.res, res)
+			assert.Equal(t, tt.ignored, ignored)
+		})
+	}
+}
+
+func TestOpenAIPolicy_String(t *testing.T) {
+	assert.Equal(t, "on spam; override rescue", OpenAIPolicy{OnSpam: true, Rescue: true}.String())
+	assert.Equal(t, "on ham, spam; override ban, rescue; min confidence 80%",
+		OpenAIPolicy{OnHam: true, OnSpam: true, Ban: true, Rescue: true, MinConfidence: 80}.String())
+	assert.Equal(t, "on none; override none", OpenAIPolicy{}.String())
+}
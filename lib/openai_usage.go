@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// errBudgetExceeded is returned by check if the request is skipped, as the daily budget is exceeded
+var errBudgetExceeded = errors.New("daily budget exceeded")
+
+// OpenAIUsage is a usage of OpenAI, number of requests, tokens and estimated cost
+type OpenAIUsage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"` // estimated with prices of OpenAIConfig
+}
+
+// Add returns the sum of usages
+func (u OpenAIUsage) Add(other OpenAIUsage) OpenAIUsage {
+	return OpenAIUsage{Requests: u.Requests + other.Requests, PromptTokens: u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens, Cost: u.Cost + other.Cost}
+}
+
+// OpenAIUsageStorage is an interface to keep usage of OpenAI, i.e. in stats.
+// Detector calls it after each request, so implementations should be fast, i.e. batch writes.
+type OpenAIUsageStorage interface {
+	AddOpenAIUsage(usage OpenAIUsage) // add usage of the request
+}
+
+// openAIUsageTracker keeps usage of the current day, in local time, and checks it against the daily budget
+type openAIUsageTracker struct {
+	params OpenAIConfig
+	now    func() time.Time
+
+	lock     sync.Mutex
+	storage  OpenAIUsageStorage // optional, usage of each request is added to it
+	day      time.Time          // start of the current day
+	today    OpenAIUsage
+	notified bool // budget notification sent for the current day
+}
+
+// record adds usage of the request, writes it to the storage, and notifies once a day if the budget is exceeded
+func (t *openAIUsageTracker) record(u openai.Usage) {
+	usage := OpenAIUsage{Requests: 1, PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens,
+		Cost: (float64(u.PromptTokens)*t.params.PromptPrice + float64(u.CompletionTokens)*t.params.CompletionPrice) / 1e6}
+	today, exceeded := t.add(usage)
+	t.lock.Lock()
+	storage := t.storage
+	t.lock.Unlock()
+	if storage != nil {
+		storage.AddOpenAIUsage(usage)
+	}
+	if exceeded && t.params.BudgetNotify != nil {
+		t.params.BudgetNotify(today)
+	}
+}
+
+// add adds usage to the current day, returns usage of the day and true if the budget is exceeded by this usage
+func (t *openAIUsageTracker) add(usage OpenAIUsage) (today OpenAIUsage, exceeded bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.rollDay()
+	t.today = t.today.Add(usage)
+	if t.params.DailyBudget > 0 && t.today.Cost >= t.params.DailyBudget && !t.notified {
+		t.notified = true
+		return t.today, true
+	}
+	return t.today, false
+}
+
+// exceeded returns true if the usage of the current day is over the daily budget
+func (t *openAIUsageTracker) exceeded() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.rollDay()
+	return t.params.DailyBudget > 0 && t.today.Cost >= t.params.DailyBudget
+}
+
+// usage returns usage of the current day
+func (t *openAIUsageTracker) usage() OpenAIUsage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.rollDay()
+	return t.today
+}
+
+// rollDay resets usage on the start of a new day, should be called under lock
+func (t *openAIUsageTracker) rollDay() {
+	now := t.now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !day.Equal(t.day) {
+		t.day, t.today, t.notified = day, OpenAIUsage{}, false
+	}
+}
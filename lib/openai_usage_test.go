@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/mocks"
+)
+
+func TestOpenAIChecker_Usage(t *testing.T) {
+	clientMock := &mocks.OpenAIClientMock{
+		CreateChatCompletionFunc: func(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			return openai.ChatCompletionResponse{
+				Usage: openai.Usage{PromptTokens: 1000, CompletionTokens: 100},
+				Choices: []openai.ChatCompletionChoice{{
+					Message: openai.ChatCompletionMessage{Content: `{"spam": false, "reason":"good text", "confidence":99}`},
+				}},
+			}, nil
+		},
+	}
+	storage := &openAIUsageRecorder{}
+	var notified []OpenAIUsage
+	// 1000 prompt tokens at $30/1M and 100 completion tokens at $60/1M cost $0.036
+	checker := newOpenAIChecker(clientMock, OpenAIConfig{PromptPrice: 30, CompletionPrice: 60, DailyBudget: 0.07,
+		BudgetNotify: func(u OpenAIUsage) { notified = append(notified, u) }})
+	checker.usage.storage = storage
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.Local)
+	checker.usage.now = func() time.Time { return now }
+
+	_, _, err := checker.check(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Empty(t, notified)
+	_, _, err = checker.check(context.Background(), "text")
+	require.NoError(t, err)
+	require.Len(t, storage.usage, 2)
+	assert.Equal(t, 1, storage.usage[0].Requests)
+	assert.InDelta(t, 0.036, storage.usage[0].Cost, 1e-9)
+	require.Len(t, notified, 1, "budget exceeded by the second request")
+	assert.Equal(t, 2, notified[0].Requests)
+	assert.Equal(t, 2000, notified[0].PromptTokens)
+	assert.Equal(t, 200, notified[0].CompletionTokens)
+
+	_, cr, err := checker.check(context.Background(), "text")
+	assert.ErrorIs(t, err, errBudgetExceeded)
+	assert.Equal(t, "OpenAI skipped, daily budget exceeded", cr.Details)
+	assert.Len(t, clientMock.CreateChatCompletionCalls(), 2, "no requests over budget")
+	assert.Len(t, notified, 1, "notified once a day")
+
+	// budget is reset on the next day
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, OpenAIUsage{}, checker.usage.usage())
+	_, _, err = checker.check(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, 1, checker.usage.usage().Requests)
+}
+
+func TestDetector_OpenAIUsage(t *testing.T) {
+	d := NewDetector(Config{})
+	assert.Equal(t, OpenAIUsage{}, d.OpenAIUsage(), "no openai checker")
+	d.AddOpenAIUsage(OpenAIUsage{Requests: 1})       // no-op
+	d.WithOpenAIUsageStorage(&openAIUsageRecorder{}) // no-op
+
+	var notified int
+	d.WithOpenAIChecker(&mocks.OpenAIClientMock{}, OpenAIConfig{DailyBudget: 1, BudgetNotify: func(OpenAIUsage) { notified++ }})
+	d.AddOpenAIUsage(OpenAIUsage{Requests: 10, PromptTokens: 100, Cost: 0.5})
+	d.AddOpenAIUsage(OpenAIUsage{Requests: 10, PromptTokens: 100, Cost: 0.5})
+	assert.Equal(t, OpenAIUsage{Requests: 20, PromptTokens: 200, Cost: 1}, d.OpenAIUsage())
+	assert.True(t, d.openaiChecker.usage.exceeded(), "restored usage counts for the budget")
+	assert.Zero(t, notified, "restored usage is not notified")
+
+	storage := &openAIUsageRecorder{}
+	d.WithOpenAIUsageStorage(storage)
+	assert.Equal(t, storage, d.openaiChecker.usage.storage)
+	assert.Empty(t, storage.usage, "restored usage is not written to the storage")
+}
+
+type openAIUsageRecorder struct{ usage []OpenAIUsage }
+
+func (r *openAIUsageRecorder) AddOpenAIUsage(usage OpenAIUsage) { r.usage = append(r.usage, usage) }
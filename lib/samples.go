@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"math"
+	"sort"
+)
+
+// corpus keeps tokenized spam or ham samples for similarity check, as compact sparse vectors of interned tokens.
+// Each unique token is stored once and referenced by id, samples keep ids of their tokens with frequencies,
+// so memory of large corpora is dominated by the number of tokens in samples, 10 bytes each with the index,
+// and not by maps per sample. The inverted index of tokens limits comparisons to samples sharing tokens with
+// the message, samples without shared tokens have zero similarity anyway.
+type corpus struct {
+	ids        map[string]uint32 // ids of interned tokens
+	tokens     []string          // interned tokens, by id
+	vectors    []sparseVector    // token vectors of samples
+	categories []string          // categories of samples, by index, empty for untagged samples and ham
+	postings   [][]uint32        // indexes of samples with the token, ascending, by token id
+}
+
+// sparseVector is a token frequency vector of a sample or a message
+type sparseVector struct {
+	ids    []uint32 // ids of tokens, ascending
+	counts []uint16 // frequencies of tokens, saturated at math.MaxUint16
+	norm   float64  // euclidean norm of frequencies, including tokens without ids in vectors of messages
+}
+
+// reset removes all samples and interned tokens
+func (s *corpus) reset() {
+	*s = corpus{ids: map[string]uint32{}}
+}
+
+// len returns the number of samples
+func (s *corpus) len() int { return len(s.vectors) }
+
+// add adds sample tokenized to frequencies, with the category of the sample. Tokens are interned.
+func (s *corpus) add(tokens map[string]int, category string) {
+	if s.ids == nil {
+		s.ids = map[string]uint32{}
+	}
+	v := sparseVector{ids: make([]uint32, 0, len(tokens)), counts: make([]uint16, 0, len(tokens))}
+	sumSq := 0.0
+	for _, token := range sortedTokens(tokens) {
+		id, ok := s.ids[token]
+		if !ok {
+			id = uint32(len(s.tokens))
+			s.ids[token] = id
+			s.tokens = append(s.tokens, token)
+			s.postings = append(s.postings, nil)
+		}
+		s.postings[id] = append(s.postings[id], uint32(len(s.vectors)))
+		count := min(tokens[token], math.MaxUint16)
+		v.ids = append(v.ids, id)
+		v.counts = append(v.counts, uint16(count))
+		sumSq += float64(count * count)
+	}
+	v.norm = math.Sqrt(sumSq)
+	v.sort()
+	s.vectors = append(s.vectors, v)
+	s.categories = append(s.categories, category)
+}
+
+// vector makes vector of the message tokenized to frequencies. Tokens unknown to samples are not interned,
+// they can't match any sample and are counted in the norm only.
+func (s *corpus) vector(tokens map[string]int) sparseVector {
+	v := sparseVector{ids: make([]uint32, 0, len(tokens)), counts: make([]uint16, 0, len(tokens))}
+	sumSq := 0.0
+	for token, count := range tokens {
+		count = min(count, math.MaxUint16)
+		sumSq += float64(count * count)
+		if id, ok := s.ids[token]; ok {
+			v.ids = append(v.ids, id)
+			v.counts = append(v.counts, uint16(count))
+		}
+	}
+	v.norm = math.Sqrt(sumSq)
+	v.sort()
+	return v
+}
+
+// maxSimilarity returns the max cosine similarity of the message tokenized to frequencies to samples, 0 if no samples
+func (s *corpus) maxSimilarity(tokens map[string]int) float64 {
+	v := s.vector(tokens)
+	res := 0.0
+	for _, idx := range s.candidates(v, 1) {
+		res = max(res, v.cosine(s.vectors[idx]))
+	}
+	return res
+}
+
+// candidates returns indexes of samples sharing at least minShared tokens with the message vector, ascending.
+// With minShared of 1 all samples with non-zero similarity are returned, so results are the same as
+// comparing with all samples. Higher minShared skips samples matching a few common tokens only.
+func (s *corpus) candidates(v sparseVector, minShared int) []int {
+	minShared = max(minShared, 1)
+	shared := make([]uint16, len(s.vectors)) // number of shared tokens by index of sample, ids of vector are unique
+	found := 0
+	for _, id := range v.ids {
+		for _, idx := range s.postings[id] {
+			if shared[idx]++; int(shared[idx]) == minShared {
+				found++
+			}
+		}
+	}
+	res := make([]int, 0, found)
+	for idx, n := range shared {
+		if int(n) >= minShared {
+			res = append(res, idx)
+		}
+	}
+	return res
+}
+
+// frequencies returns tokens of the sample with frequencies, as they were added
+func (s *corpus) frequencies(idx int) map[string]int {
+	res := make(map[string]int, len(s.vectors[idx].ids))
+	for i, id := range s.vectors[idx].ids {
+		res[s.tokens[id]] = int(s.vectors[idx].counts[i])
+	}
+	return res
+}
+
+// cosine calculates the cosine similarity between two vectors, merging their sorted ids
+func (v sparseVector) cosine(o sparseVector) float64 {
+	if v.norm == 0 || o.norm == 0 {
+		return 0.0
+	}
+	dotProduct := 0 // sum of product of corresponding frequencies
+	for i, j := 0, 0; i < len(v.ids) && j < len(o.ids); {
+		switch {
+		case v.ids[i] < o.ids[j]:
+			i++
+		case v.ids[i] > o.ids[j]:
+			j++
+		default:
+			dotProduct += int(v.counts[i]) * int(o.counts[j])
+			i++
+			j++
+		}
+	}
+	return float64(dotProduct) / (v.norm * o.norm)
+}
+
+// sort sorts ids of the vector ascending, with their frequencies
+func (v *sparseVector) sort() {
+	sort.Sort(vectorByID{v})
+}
+
+type vectorByID struct{ *sparseVector }
+
+func (v vectorByID) Len() int           { return len(v.ids) }
+func (v vectorByID) Less(i, j int) bool { return v.ids[i] < v.ids[j] }
+func (v vectorByID) Swap(i, j int) {
+	v.ids[i], v.ids[j] = v.ids[j], v.ids[i]
+	v.counts[i], v.counts[j] = v.counts[j], v.counts[i]
+}
+
+// sortedTokens returns tokens of frequencies sorted, so ids of interned tokens don't depend on order of map iteration
+func sortedTokens(tokens map[string]int) []string {
+	res := make([]string, 0, len(tokens))
+	for token := range tokens {
+		res = append(res, token)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syntheticSpam makes n spam samples of 15-40 words from vocabulary of 20k words, with zipf distribution of words
+func syntheticSpam(n int) string {
+	rnd := rand.New(rand.NewSource(42)) //nolint:gosec // no need for crypto rand
+	zipf := rand.NewZipf(rnd, 1.1, 1, 20000-1)
+	sb := strings.Builder{}
+	for i := 0; i < n; i++ {
+		words := 15 + rnd.Intn(26)
+		for j := 0; j < words; j++ {
+			if j > 0 {
+				sb.WriteString(" ")
+			}
+			fmt.Fprintf(&sb, "word%d", zipf.Uint64())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// BenchmarkDetector_LoadSamples reports memory of similarity and classifier data per 10k spam samples
+func BenchmarkDetector_LoadSamples(b *testing.B) {
+	const samples = 100000
+	spam := syntheticSpam(samples)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		d := NewDetector(Config{SimilarityThreshold: 0.5})
+		_, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spam)}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(samples/10000)/1024/1024, "MB/10k-samples")
+		runtime.KeepAlive(d)
+	}
+}
+
+func Test_corpus(t *testing.T) {
+	s := corpus{}
+	s.add(map[string]int{"win": 2, "free": 1, "iphone": 1}, "")
+	s.add(map[string]int{"free": 1, "bitcoin": 3}, "crypto")
+	s.add(map[string]int{}, "empty")
+	assert.Equal(t, 3, s.len())
+	assert.Equal(t, []string{"", "crypto", "empty"}, s.categories)
+	assert.Len(t, s.tokens, 4, "tokens are interned once")
+	assert.Equal(t, map[string]int{"win": 2, "free": 1, "iphone": 1}, s.frequencies(0))
+	assert.Equal(t, map[string]int{"free": 1, "bitcoin": 3}, s.frequencies(1))
+	assert.Empty(t, s.frequencies(2))
+
+	msg := s.vector(map[string]int{"free": 1, "bitcoin": 1, "unknown": 2})
+	assert.Len(t, msg.ids, 2, "unknown token not in vector")
+	assert.InDelta(t, math.Sqrt(6), msg.norm, 1e-9, "unknown token counted in norm")
+	assert.Len(t, s.tokens, 4, "message tokens not interned")
+
+	s.add(map[string]int{"overflow": 100000}, "")
+	assert.Equal(t, math.MaxUint16, s.frequencies(3)["overflow"])
+
+	s.reset()
+	assert.Equal(t, 0, s.len())
+	assert.Empty(t, s.tokens)
+	assert.Empty(t, s.categories)
+}
+
+func Test_sparseVector_cosine(t *testing.T) {
+	// reference implementation on maps
+	cosine := func(a, b map[string]int) float64 {
+		dot, normA, normB := 0, 0, 0
+		for k, v := range a {
+			dot += v * b[k]
+			normA += v * v
+		}
+		for _, v := range b {
+			normB += v * v
+		}
+		if normA == 0 || normB == 0 {
+			return 0
+		}
+		return float64(dot) / (math.Sqrt(float64(normA)) * math.Sqrt(float64(normB)))
+	}
+
+	tbl := []struct {
+		sample, msg map[string]int
+	}{
+		{map[string]int{"win": 1, "free": 1, "iphone": 1}, map[string]int{"win": 1, "free": 1, "iphone": 1}},
+		{map[string]int{"win": 1, "free": 1, "iphone": 1}, map[string]int{"free": 2, "car": 1}},
+		{map[string]int{"a": 3, "b": 1, "c": 2, "d": 5}, map[string]int{"d": 1, "b": 4, "x": 1, "y": 7}},
+		{map[string]int{"a": 1}, map[string]int{"b": 1}},
+		{map[string]int{"a": 1}, map[string]int{}},
+		{map[string]int{}, map[string]int{"a": 1}},
+	}
+	for i, tt := range tbl {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			s := corpus{}
+			s.add(map[string]int{"z": 1, "y": 1, "a": 1}, "") // other sample to shift ids of tokens
+			s.add(tt.sample, "")
+			msg := s.vector(tt.msg)
+			assert.InDelta(t, cosine(tt.msg, tt.sample), msg.cosine(s.vectors[1]), 1e-9)
+			assert.InDelta(t, cosine(tt.msg, tt.sample), s.vectors[1].cosine(msg), 1e-9)
+		})
+	}
+}
+
+func Test_corpus_candidates(t *testing.T) {
+	s := corpus{}
+	s.add(map[string]int{"win": 2, "free": 1, "iphone": 1}, "")
+	s.add(map[string]int{"free": 1, "bitcoin": 3}, "")
+	s.add(map[string]int{"hello": 1}, "")
+	s.add(map[string]int{"free": 1, "iphone": 1, "bitcoin": 1}, "")
+
+	msg := s.vector(map[string]int{"free": 1, "iphone": 1, "unknown": 1})
+	assert.Equal(t, []int{0, 1, 3}, s.candidates(msg, 0))
+	assert.Equal(t, []int{0, 1, 3}, s.candidates(msg, 1))
+	assert.Equal(t, []int{0, 3}, s.candidates(msg, 2))
+	assert.Empty(t, s.candidates(msg, 3))
+	assert.Empty(t, s.candidates(s.vector(map[string]int{"unknown": 1}), 1))
+
+	// the same max similarity as comparing with all samples
+	spam := syntheticSpam(2000)
+	s.reset()
+	d := NewDetector(Config{})
+	for _, line := range strings.Split(strings.TrimSpace(spam), "\n") {
+		s.add(d.tokenize(line), "")
+	}
+	for _, line := range strings.Split(syntheticSpam(2050), "\n")[2000:2050] {
+		msg := s.vector(d.tokenize(line))
+		all := 0.0
+		for _, v := range s.vectors {
+			all = max(all, msg.cosine(v))
+		}
+		assert.InDelta(t, all, s.maxSimilarity(d.tokenize(line)), 1e-9)
+		assert.Less(t, len(s.candidates(msg, 3)), len(s.candidates(msg, 1)))
+	}
+}
+
+// BenchmarkDetector_CheckSimilarity reports time of similarity check with 100k spam samples,
+// and the number of samples compared, per check
+func BenchmarkDetector_CheckSimilarity(b *testing.B) {
+	for _, minTokens := range []int{1, 3} {
+		b.Run(fmt.Sprintf("min-tokens-%d", minTokens), func(b *testing.B) {
+			spam := syntheticSpam(100000)
+			d := NewDetector(Config{SimilarityThreshold: 0.5, SimilarityMinTokens: minTokens})
+			if _, err := d.LoadSamples(strings.NewReader(""), []io.Reader{strings.NewReader(spam)}, nil); err != nil {
+				b.Fatal(err)
+			}
+			msgs := strings.Split(strings.TrimSpace(syntheticSpam(100100)), "\n")[100000:]
+			compared := 0
+			for _, msg := range msgs {
+				compared += len(d.spamSamples.candidates(d.spamSamples.vector(d.tokenize(msg)), minTokens))
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d.isSpamSimilarityHigh(msgs[i%len(msgs)])
+			}
+			b.ReportMetric(float64(compared)/float64(len(msgs)), "samples/check")
+		})
+	}
+}
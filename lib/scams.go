@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	_ "embed" // for built-in scam patterns
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+//go:embed scams.json
+var builtinScams []byte
+
+// CheckScam is a name of check result reported by scam patterns. Details are the name and language
+// of the matched template, i.e. "easy money (en)".
+const CheckScam = "scam"
+
+// ScamPattern is a detector of a common scam template, i.e. "I earn $500/day" or a fake giveaway,
+// in one language. The template is matched if any of its patterns matches the message.
+type ScamPattern struct {
+	Name     string   `json:"name"`     // name of the template, i.e. "easy money"
+	Language string   `json:"language"` // language of the template, i.e. "en"
+	Patterns []string `json:"patterns"` // regular expressions of the template, matched case-insensitively
+}
+
+// ScamPatterns is a versioned set of scam patterns. Built-in patterns are shipped with the package,
+// and can be replaced by a newer version of a signed feed, see VerifyScamPatterns.
+type ScamPatterns struct {
+	Version  int           `json:"version"`
+	Patterns []ScamPattern `json:"patterns"`
+}
+
+// compiledScam is a scam pattern with compiled regular expressions
+type compiledScam struct {
+	name     string
+	language string
+	res      []*regexp.Regexp
+}
+
+// BuiltinScamPatterns returns scam patterns shipped with the package
+func BuiltinScamPatterns() ScamPatterns {
+	res, err := ParseScamPatterns(builtinScams)
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in scam patterns, %v", err)) // verified by tests
+	}
+	return res
+}
+
+// ParseScamPatterns parses scam patterns from json, all the patterns should be valid regular expressions
+func ParseScamPatterns(data []byte) (ScamPatterns, error) {
+	var res ScamPatterns
+	if err := json.Unmarshal(data, &res); err != nil {
+		return ScamPatterns{}, fmt.Errorf("can't unmarshal scam patterns, %w", err)
+	}
+	if _, err := compileScams(res); err != nil {
+		return ScamPatterns{}, err
+	}
+	return res, nil
+}
+
+// VerifyScamPatterns parses scam patterns of the feed, signed by the ed25519 key of the feed publisher.
+// The signature is of the whole data, as is.
+func VerifyScamPatterns(data, sig []byte, key ed25519.PublicKey) (ScamPatterns, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return ScamPatterns{}, fmt.Errorf("invalid public key size %d, expected %d", len(key), ed25519.PublicKeySize)
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return ScamPatterns{}, errors.New("invalid signature of scam patterns")
+	}
+	return ParseScamPatterns(data)
+}
+
+// compileScams compiles regular expressions of scam patterns, case-insensitive
+func compileScams(p ScamPatterns) ([]compiledScam, error) {
+	res := make([]compiledScam, 0, len(p.Patterns))
+	for _, sp := range p.Patterns {
+		if sp.Name == "" || len(sp.Patterns) == 0 {
+			return nil, fmt.Errorf("scam pattern %q of %q has no name or patterns", sp.Name, sp.Language)
+		}
+		cs := compiledScam{name: sp.Name, language: sp.Language, res: make([]*regexp.Regexp, 0, len(sp.Patterns))}
+		for _, pattern := range sp.Patterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scam pattern %q of %q, %w", sp.Name, sp.Language, err)
+			}
+			cs.res = append(cs.res, re)
+		}
+		res = append(res, cs)
+	}
+	return res, nil
+}
+
+// isScam checks if a given message matches any of the scam patterns
+func (d *Detector) isScam(msg string) CheckResult {
+	for _, sp := range d.scams {
+		for _, re := range sp.res {
+			if re.MatchString(msg) {
+				details := sp.name
+				if sp.language != "" {
+					details += " (" + sp.language + ")"
+				}
+				return CheckResult{Name: CheckScam, Spam: true, Details: details}
+			}
+		}
+	}
+	return CheckResult{Name: CheckScam, Spam: false, Details: "not found"}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinScamPatterns(t *testing.T) {
+	p := BuiltinScamPatterns()
+	assert.Positive(t, p.Version)
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	require.NoError(t, d.LoadScamPatterns(p))
+
+	tbl := []struct {
+		msg     string
+		details string // empty if not a scam
+	}{
+		{"I earn $500 a day working from my phone, ask me how", "easy money (en)"},
+		{"Making 300 USD per day with a simple app!", "easy money (en)"},
+		{"Зарабатываю от 500$ в день, пиши кому интересно", "easy money (ru)"},
+		{"Заробляю 2000 грн за день, деталі в особистих", "easy money (uk)"},
+		{"Gano 200 dólares al día desde casa", "easy money (es)"},
+		{"Looking for 3 people for remote work, 2 hours a day", "remote job offer (en)"},
+		{"Ищу людей для удаленной работы, от 18 лет", "remote job offer (ru)"},
+		{"Шукаю людей на дистанційну роботу", "remote job offer (uk)"},
+		{"Hello, I am the official admin of this group, please DM me to verify your account", "fake support (en)"},
+		{"Contact our official support @help_desk_team to restore access", "fake support (en)"},
+		{"Я администратор чата, напиши мне в лс", "fake support (ru)"},
+		{"Huge giveaway! The first 100 users to connect wallet get 1 ETH", "fake giveaway (en)"},
+		{"Send 0.1 BTC and get 0.2 BTC back instantly", "fake giveaway (en)"},
+		{"Раздача USDT, первым 50 участникам бонус", "fake giveaway (ru)"},
+
+		{"I made a pull request yesterday, please review", ""},
+		{"we pay $5 per month for the hosting", ""},
+		{"Ищу, как настроить удаленный доступ к серверу", ""},
+		{"I am the admin of this group, please keep on topic", ""},
+		{"the giveaway of conference tickets is over", ""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.msg, func(t *testing.T) {
+			res := d.isScam(tt.msg)
+			assert.Equal(t, CheckScam, res.Name)
+			assert.Equal(t, tt.details != "", res.Spam, res.Details)
+			if tt.details != "" {
+				assert.Equal(t, tt.details, res.Details)
+			}
+		})
+	}
+}
+
+func TestVerifyScamPatterns(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	data := []byte(`{"version": 5, "patterns": [{"name": "test", "language": "en", "patterns": ["buy now"]}]}`)
+
+	p, err := VerifyScamPatterns(data, ed25519.Sign(priv, data), pub)
+	require.NoError(t, err)
+	assert.Equal(t, ScamPatterns{Version: 5, Patterns: []ScamPattern{{Name: "test", Language: "en", Patterns: []string{"buy now"}}}}, p)
+
+	_, err = VerifyScamPatterns(append(data, ' '), ed25519.Sign(priv, data), pub)
+	assert.EqualError(t, err, "invalid signature of scam patterns")
+
+	_, err = VerifyScamPatterns(data, ed25519.Sign(priv, data), pub[:10])
+	assert.EqualError(t, err, "invalid public key size 10, expected 32")
+
+	bad := []byte(`{"version": 6, "patterns": [{"name": "test", "patterns": ["buy (now"]}]}`)
+	_, err = VerifyScamPatterns(bad, ed25519.Sign(priv, bad), pub)
+	assert.ErrorContains(t, err, `invalid scam pattern "test"`)
+}
+
+func TestDetector_CheckScams(t *testing.T) {
+	d := NewDetector(Config{MaxAllowedEmoji: -1})
+	spam, cr := d.Check("I earn $500 a day", "")
+	assert.False(t, spam)
+	assert.Empty(t, cr, "no scam check without patterns")
+	assert.Equal(t, 0, d.ScamPatternsVersion())
+
+	require.NoError(t, d.LoadScamPatterns(BuiltinScamPatterns()))
+	assert.Equal(t, BuiltinScamPatterns().Version, d.ScamPatternsVersion())
+	spam, cr = d.Check("I earn $500 a day", "")
+	assert.True(t, spam)
+	assert.Equal(t, []CheckResult{{Name: CheckScam, Spam: true, Details: "easy money (en)"}}, cr)
+
+	d.Reset()
+	spam, _ = d.Check("I earn $500 a day", "")
+	assert.True(t, spam, "patterns are kept on reset")
+
+	err := d.LoadScamPatterns(ScamPatterns{Version: 2, Patterns: []ScamPattern{{Name: "bad", Patterns: []string{"("}}}})
+	require.Error(t, err)
+	assert.Equal(t, BuiltinScamPatterns().Version, d.ScamPatternsVersion(), "invalid patterns not loaded")
+
+	require.NoError(t, d.LoadScamPatterns(ScamPatterns{}))
+	spam, cr = d.Check("I earn $500 a day", "")
+	assert.False(t, spam)
+	assert.Empty(t, cr, "scam check disabled")
+}
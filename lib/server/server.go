@@ -0,0 +1,169 @@
+// Package server provides http handler of spam check api, the same as served by tg-spam webapi, so Go services can
+// mount spam checks into their own router, with their own middlewares, i.e. auth and logging, instead of running
+// tg-spam as a separate process.
+//
+// The handler serves two endpoints:
+//
+//   - POST /check - checks a message for spam. The request is {"msg": "text", "user_id": "123"},
+//     the response is {"spam": true, "checks": [...]} with results of all checks.
+//
+//   - POST /check/batch - checks a list of messages, up to Config.MaxBatchSize, concurrently.
+//     The request is {"messages": [{"msg": "text", "user_id": "123"}, ...], "skip_network": false},
+//     the response is {"results": [...], "count": 2, "spam": 1} with results in the order of messages.
+//     With skip_network set, CAS and OpenAI checks are skipped.
+//
+// Requests and responses are defined in spamcheck package. Invalid requests are rejected with 400 and
+// {"error": "...", "details": "..."} response.
+//
+// Example of mounting the handler on /spam/ prefix:
+//
+//	detector := lib.NewDetector(lib.Config{...})
+//	// load samples and stop-words to the detector
+//	mux.Handle("/spam/", http.StripPrefix("/spam", server.New(detector, server.Config{})))
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/umputun/tg-spam/lib"
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// Checker checks messages for spam, implemented by lib.Detector
+type Checker interface {
+	Check(msg string, userID string) (spam bool, cr []lib.CheckResult)
+	CheckLocal(msg string, userID string) (spam bool, cr []lib.CheckResult)
+}
+
+// Config is a configuration of the check handler
+type Config struct {
+	BatchWorkers int // max number of concurrent checks of POST /check/batch, 4 if not set
+	MaxBatchSize int // max number of messages in POST /check/batch, 1000 if not set
+}
+
+const (
+	// DefaultBatchWorkers is the default number of concurrent checks of POST /check/batch
+	DefaultBatchWorkers = 4
+	// DefaultMaxBatchSize is the default max number of messages in POST /check/batch
+	DefaultMaxBatchSize = 1000
+)
+
+// Server is http handler of spam check api
+type Server struct {
+	checker Checker
+	config  Config
+}
+
+// New makes http handler of spam check api with the checker, i.e. lib.Detector with loaded samples
+func New(checker Checker, config Config) *Server {
+	if config.BatchWorkers <= 0 {
+		config.BatchWorkers = DefaultBatchWorkers
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = DefaultMaxBatchSize
+	}
+	return &Server{checker: checker, config: config}
+}
+
+// ServeHTTP serves POST /check and POST /check/batch, other paths are not found, and other methods are not allowed
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handler http.HandlerFunc
+	switch r.URL.Path {
+	case "/check":
+		handler = s.CheckHandler
+	case "/check/batch":
+		handler = s.CheckBatchHandler
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	handler(w, r)
+}
+
+// CheckHandler handles POST /check request, for routers mounting endpoints separately.
+// It gets message text and user id from request body and returns spam status and check results.
+func (s *Server) CheckHandler(w http.ResponseWriter, r *http.Request) {
+	var req spamcheck.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, "can't decode request", err.Error())
+		return
+	}
+
+	spam, cr := s.checker.Check(req.Msg, req.UserID)
+	renderJSON(w, http.StatusOK, spamcheck.Response{Spam: spam, Checks: cr})
+}
+
+// CheckBatchHandler handles POST /check/batch request, for routers mounting endpoints separately.
+// It gets a list of messages with user ids and returns spam status and check results for each message, in the same
+// order. Messages are checked concurrently, up to BatchWorkers at a time. With skip_network set, CAS and OpenAI checks
+// are skipped, which makes re-scanning of large histories fast and free.
+func (s *Server) CheckBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req spamcheck.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		renderError(w, "can't decode request", err.Error())
+		return
+	}
+	if len(req.Messages) == 0 || len(req.Messages) > s.config.MaxBatchSize {
+		renderError(w, "invalid batch size",
+			fmt.Sprintf("got %d messages, expected 1-%d", len(req.Messages), s.config.MaxBatchSize))
+		return
+	}
+
+	checkFn := s.checker.Check
+	if req.SkipNetwork {
+		checkFn = s.checker.CheckLocal
+	}
+
+	results := make([]spamcheck.Response, len(req.Messages))
+	sema := make(chan struct{}, s.config.BatchWorkers)
+	var wg sync.WaitGroup
+	for i, m := range req.Messages {
+		select {
+		case <-r.Context().Done(): // client is gone or request timed out, no need to check the rest
+			wg.Wait()
+			return
+		case sema <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int, m spamcheck.Request) {
+			defer func() { <-sema; wg.Done() }()
+			spam, cr := checkFn(m.Msg, m.UserID)
+			results[i] = spamcheck.Response{Spam: spam, Checks: cr}
+		}(i, m)
+	}
+	wg.Wait()
+
+	resp := spamcheck.BatchResponse{Results: results, Count: len(results)}
+	for _, res := range results {
+		if res.Spam {
+			resp.Spam++
+		}
+	}
+	renderJSON(w, http.StatusOK, resp)
+}
+
+// renderError sends error response with 400 status
+func renderError(w http.ResponseWriter, msg, details string) {
+	renderJSON(w, http.StatusBadRequest, map[string]string{"error": msg, "details": details})
+}
+
+// renderJSON sends data as json with the status
+func renderJSON(w http.ResponseWriter, status int, data any) {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
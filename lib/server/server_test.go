@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib"
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+func TestServer(t *testing.T) {
+	detector := lib.NewDetector(lib.Config{MaxAllowedEmoji: -1})
+	_, err := detector.LoadStopWords(strings.NewReader("buy crypto\n"))
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/spam/", http.StripPrefix("/spam", New(detector, Config{})))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	t.Run("check", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/spam/check", "application/json",
+			strings.NewReader(`{"msg": "please buy crypto", "user_id": "1"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+		var res spamcheck.Response
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.True(t, res.Spam)
+		assert.Equal(t, []lib.CheckResult{{Name: "stopword", Spam: true, Details: "buy crypto"}}, res.Checks)
+	})
+
+	t.Run("check batch", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/spam/check/batch", "application/json", strings.NewReader(
+			`{"messages": [{"msg": "please buy crypto", "user_id": "1"}, {"msg": "hello", "user_id": "2"}], "skip_network": true}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var res spamcheck.BatchResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		assert.Equal(t, 2, res.Count)
+		assert.Equal(t, 1, res.Spam)
+		require.Len(t, res.Results, 2)
+		assert.True(t, res.Results[0].Spam)
+		assert.False(t, res.Results[1].Spam)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		tests := []struct {
+			name, method, path, body string
+			status                   int
+		}{
+			{name: "bad json", method: http.MethodPost, path: "/spam/check", body: "bad", status: http.StatusBadRequest},
+			{name: "empty batch", method: http.MethodPost, path: "/spam/check/batch", body: `{"messages": []}`,
+				status: http.StatusBadRequest},
+			{name: "wrong method", method: http.MethodGet, path: "/spam/check", status: http.StatusMethodNotAllowed},
+			{name: "unknown path", method: http.MethodPost, path: "/spam/other", body: "{}", status: http.StatusNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+				require.NoError(t, err)
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				assert.Equal(t, tt.status, resp.StatusCode)
+			})
+		}
+	})
+}
+
+func TestServer_CheckBatchHandler_MaxBatchSize(t *testing.T) {
+	detector := lib.NewDetector(lib.Config{})
+	srv := New(detector, Config{MaxBatchSize: 2, BatchWorkers: 1})
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/check/batch",
+		strings.NewReader(`{"messages": [{"msg": "1"}, {"msg": "2"}, {"msg": "3"}]}`))
+	srv.CheckBatchHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error": "invalid batch size", "details": "got 3 messages, expected 1-2"}`, rr.Body.String())
+}
@@ -0,0 +1,50 @@
+// Package spamcheck defines requests and results of spam checks, shared by the detector, the check api and its
+// clients. It has no dependencies, so clients of the check api can use it without importing the detector.
+//
+// Types of this package are a part of the stable api, see package tgspam for the compatibility policy.
+package spamcheck
+
+import "fmt"
+
+// Request is a message to check for spam, a request of POST /check
+type Request struct {
+	Msg    string `json:"msg"`
+	UserID string `json:"user_id"`
+}
+
+// Response is a result of the spam check of a message, with results of all checks, a response of POST /check
+type Response struct {
+	Spam   bool     `json:"spam"`
+	Checks []Result `json:"checks"`
+}
+
+// BatchRequest is a list of messages to check for spam, a request of POST /check/batch.
+// With SkipNetwork set, CAS and OpenAI checks are skipped.
+type BatchRequest struct {
+	Messages    []Request `json:"messages"`
+	SkipNetwork bool      `json:"skip_network"`
+}
+
+// BatchResponse is a result of the spam check of a list of messages, in the order of messages,
+// a response of POST /check/batch
+type BatchResponse struct {
+	Results []Response `json:"results"`
+	Count   int        `json:"count"` // number of checked messages
+	Spam    int        `json:"spam"`  // number of spam messages
+}
+
+// Result is a result of a single check of a message, i.e. stop-words or similarity
+type Result struct {
+	Name    string `json:"name"`    // name of the check
+	Spam    bool   `json:"spam"`    // true if spam
+	Details string `json:"details"` // details of the check
+}
+
+// String returns the result as "name: spam|ham, details"
+func (c *Result) String() string {
+	spamOrHam := "ham"
+	if c.Spam {
+		spamOrHam = "spam"
+	}
+	return fmt.Sprintf("%s: %s, %s", c.Name, spamOrHam, c.Details)
+}
@@ -0,0 +1,79 @@
+// Package tgspam is the stable public api of tg-spam spam detection, for Go projects embedding the detector.
+// Types and functions of this package, and of spamcheck package with requests and results of checks, follow
+// semantic versioning of the repository tags: within a major version nothing is removed, renamed or changed in
+// an incompatible way, i.e. signatures of functions and methods, fields of structs and their json names. New
+// functions, methods and fields can be added in minor versions. The compatibility is checked by tests of
+// this package, pinning the signatures.
+//
+// Package lib has the implementation, and can get additions before they are promoted to this package. Its exported
+// api, not exposed here, is not covered by the compatibility policy. Types are aliases of lib ones, so both packages
+// can be used together during migration, i.e. lib.Detector and tgspam.Detector are the same type.
+//
+// Example:
+//
+//	detector := tgspam.NewDetector(tgspam.Config{SimilarityThreshold: 0.5, MaxAllowedEmoji: 2})
+//	if _, err := detector.LoadSamples(exclReader, []io.Reader{spamReader}, []io.Reader{hamReader}); err != nil {
+//		return err
+//	}
+//	spam, results := detector.Check("message text", "user id")
+package tgspam
+
+import (
+	"github.com/umputun/tg-spam/lib"
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// Detector is a spam detector, thread-safe. See lib.Detector for details.
+type Detector = lib.Detector
+
+// Config is a configuration of the detector. See lib.Config for details.
+type Config = lib.Config
+
+// Thresholds are the thresholds of the detector, which can be changed at runtime with Detector.SetThresholds
+type Thresholds = lib.Thresholds
+
+// CheckResult is a result of a single check of a message
+type CheckResult = spamcheck.Result
+
+// ApprovedUser is a user known to the detector, not checked anymore once approved
+type ApprovedUser = lib.ApprovedUser
+
+// LoadResult is a result of loading samples and stop-words
+type LoadResult = lib.LoadResult
+
+// SampleUpdater is a storage of samples updated on the fly, by Detector.UpdateSpam and Detector.UpdateHam
+type SampleUpdater = lib.SampleUpdater
+
+// SourcedSampleUpdater is a SampleUpdater recording sources of samples added by Detector.UpdateSpamFrom and Detector.UpdateHamFrom
+type SourcedSampleUpdater = lib.SourcedSampleUpdater
+
+// UserStorage is a storage of approved users, written on each change
+type UserStorage = lib.UserStorage
+
+// HTTPClient is a client of CAS api, satisfied by http.Client
+type HTTPClient = lib.HTTPClient
+
+// OpenAIConfig is a configuration of OpenAI check, enabled by Detector.WithOpenAIChecker
+type OpenAIConfig = lib.OpenAIConfig
+
+// OpenAIUsage is a usage of OpenAI, number of requests, tokens and estimated cost
+type OpenAIUsage = lib.OpenAIUsage
+
+// OpenAIUsageStorage is a storage of OpenAI usage, set by Detector.WithOpenAIUsageStorage
+type OpenAIUsageStorage = lib.OpenAIUsageStorage
+
+// EvalSamples are labeled samples to evaluate the detector on
+type EvalSamples = lib.EvalSamples
+
+// EvalReport is a report of evaluation, with confusion matrix and quality metrics
+type EvalReport = lib.EvalReport
+
+// NewDetector makes a new detector with the config. Samples and stop-words should be loaded before checks.
+func NewDetector(p Config) *Detector {
+	return lib.NewDetector(p)
+}
+
+// Evaluate estimates quality of detection with the config on labeled samples, with k-fold cross-validation
+func Evaluate(cfg Config, samples EvalSamples, folds int) (EvalReport, error) {
+	return lib.Evaluate(cfg, samples, folds)
+}
@@ -0,0 +1,79 @@
+package tgspam
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/umputun/tg-spam/lib/spamcheck"
+)
+
+// signatures of the stable api, compilation fails on incompatible changes
+var (
+	_ func(Config) *Detector                                                   = NewDetector
+	_ func(Config, EvalSamples, int) (EvalReport, error)                       = Evaluate
+	_ func(*Detector, string, string) (bool, []CheckResult)                    = (*Detector).Check
+	_ func(*Detector, string, string) (bool, []CheckResult)                    = (*Detector).CheckLocal
+	_ func(*Detector, context.Context, string, string) (bool, []CheckResult)   = (*Detector).CheckContext
+	_ func(*Detector, io.Reader, []io.Reader, []io.Reader) (LoadResult, error) = (*Detector).LoadSamples
+	_ func(*Detector, ...io.Reader) (LoadResult, error)                        = (*Detector).LoadStopWords
+	_ func(*Detector, string) error                                            = (*Detector).UpdateSpam
+	_ func(*Detector, string) error                                            = (*Detector).UpdateHam
+	_ func(*Detector, string, string) error                                    = (*Detector).UpdateSpamFrom
+	_ func(*Detector, string, string) error                                    = (*Detector).UpdateHamFrom
+	_ func(*Detector, SampleUpdater)                                           = (*Detector).WithSpamUpdater
+	_ func(*Detector, SampleUpdater)                                           = (*Detector).WithHamUpdater
+	_ func(*Detector, UserStorage)                                             = (*Detector).WithUserStorage
+	_ func(*Detector, OpenAIUsageStorage)                                      = (*Detector).WithOpenAIUsageStorage
+	_ func(*Detector, ...string)                                               = (*Detector).AddApprovedUsers
+	_ func(*Detector, ApprovedUser)                                            = (*Detector).AddApprovedUser
+	_ func(*Detector, ...string)                                               = (*Detector).RemoveApprovedUsers
+	_ func(*Detector) []ApprovedUser                                           = (*Detector).ApprovedUsers
+	_ func(*Detector, io.Reader) (int, error)                                  = (*Detector).LoadApprovedUsers
+	_ func(*Detector) Thresholds                                               = (*Detector).Thresholds
+	_ func(*Detector, Thresholds)                                              = (*Detector).SetThresholds
+	_ func(*Detector)                                                          = (*Detector).Reset
+	_ func(*Detector) OpenAIUsage                                              = (*Detector).OpenAIUsage
+	_ func(*CheckResult) string                                                = (*CheckResult).String
+)
+
+func TestDetector(t *testing.T) {
+	detector := NewDetector(Config{SimilarityThreshold: 0.5, MaxAllowedEmoji: -1})
+	_, err := detector.LoadStopWords(strings.NewReader("buy crypto\n"))
+	require.NoError(t, err)
+	spam, cr := detector.Check("please buy crypto", "1")
+	assert.True(t, spam)
+	assert.Equal(t, []CheckResult{{Name: "stopword", Spam: true, Details: "buy crypto"}}, cr)
+}
+
+// json of requests and results is a part of the check api, field names should not be changed
+func TestCheckResultJSON(t *testing.T) {
+	resp := spamcheck.Response{Spam: true, Checks: []CheckResult{{Name: "stopword", Spam: true, Details: "buy crypto"}}}
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spam": true, "checks": [{"name": "stopword", "spam": true, "details": "buy crypto"}]}`, string(data))
+
+	batch := spamcheck.BatchRequest{Messages: []spamcheck.Request{{Msg: "text", UserID: "1"}}, SkipNetwork: true}
+	data, err = json.Marshal(batch)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"messages": [{"msg": "text", "user_id": "1"}], "skip_network": true}`, string(data))
+
+	batchResp := spamcheck.BatchResponse{Results: []spamcheck.Response{resp}, Count: 1, Spam: 1}
+	data, err = json.Marshal(batchResp)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"results": [{"spam": true, "checks": [{"name": "stopword", "spam": true, "details": "buy crypto"}]}],
+		"count": 1, "spam": 1}`, string(data))
+
+	user := ApprovedUser{UserID: "1", UserName: "user", Count: 2, FirstSeen: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		LastSeen: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)}
+	data, err = json.Marshal(user)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"user_id": "1", "user_name": "user", "count": 2, "first_seen": "2024-05-01T00:00:00Z",
+		"last_seen": "2024-05-02T00:00:00Z"}`, string(data))
+}